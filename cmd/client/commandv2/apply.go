@@ -45,6 +45,9 @@ func ApplyCmd() *cobra.Command {
 			return nil
 		},
 		Run: func(cmd *cobra.Command, args []string) {
+			// The objects are applied in a batch after the custom data, so
+			// that a bulk apply is broadcast to the cluster once.
+			var objects []*general.Spec
 			visitor := general.BuildSpecVisitor(specFile, cmd)
 			visitor.Visit(func(s *general.Spec) error {
 				var err error
@@ -60,11 +63,15 @@ func ApplyCmd() *cobra.Command {
 				case resources.CustomData().Kind:
 					err = resources.ApplyCustomData(cmd, s)
 				default:
-					err = resources.ApplyObject(cmd, s)
+					objects = append(objects, s)
 				}
 				return err
 			})
 			visitor.Close()
+
+			if err := resources.ApplyObjects(cmd, objects); err != nil {
+				general.ExitWithError(err)
+			}
 		},
 	}
 
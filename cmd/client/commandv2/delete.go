@@ -26,7 +26,10 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var deleteAllFlag = false
+var (
+	deleteAllFlag   = false
+	deleteForceFlag = false
+)
 
 // DeleteCmd returns delete command.
 func DeleteCmd() *cobra.Command {
@@ -37,6 +40,7 @@ func DeleteCmd() *cobra.Command {
 		{Desc: "Delete a httpserver", Command: "egctl delete httpserver <name>"},
 		{Desc: "Delete multiply pipeline", Command: "egctl delete pipeline <name1> <name2> <name3>"},
 		{Desc: "Delete all globalfilter", Command: "egctl delete globalfilter --all"},
+		{Desc: "Delete a pipeline even if it is referenced by other objects", Command: "egctl delete pipeline <name> --force"},
 		{Desc: "Delete a customdata kind", Command: "egctl delete customdatakind <name>"},
 		{Desc: "Delete a customdata of given kind", Command: "egctl delete customdata <kind> <name>"},
 		{Desc: "Purge a Easegress member. This command should be run after the easegress node uninstalled", Command: "egctl delete member <name>"},
@@ -51,6 +55,7 @@ func DeleteCmd() *cobra.Command {
 		Run:     deleteCmdRun,
 	}
 	cmd.Flags().BoolVar(&deleteAllFlag, "all", false, "delete all resources in given kind")
+	cmd.Flags().BoolVar(&deleteForceFlag, "force", false, "delete objects even if they are referenced by other objects")
 	return cmd
 }
 
@@ -76,7 +81,7 @@ func deleteCmdRun(cmd *cobra.Command, args []string) {
 	case resources.Member().Kind:
 		err = resources.DeleteMember(cmd, args[1:])
 	default:
-		err = resources.DeleteObject(cmd, kind, args[1:], deleteAllFlag)
+		err = resources.DeleteObject(cmd, kind, args[1:], deleteAllFlag, deleteForceFlag)
 	}
 }
 
@@ -22,8 +22,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 
 	"github.com/megaease/easegress/v2/cmd/client/general"
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
 	"github.com/spf13/cobra"
 )
 
@@ -72,9 +75,14 @@ func LogsCmd() *cobra.Command {
 }
 
 func setLogLevelCmd() *cobra.Command {
+	var module string
+	var local bool
 	examples := []general.Example{
-		{Desc: "Set log level to info", Command: "egctl logs set-level info"},
-		{Desc: "Set log level to debug", Command: "egctl logs set-level debug"},
+		{Desc: "Set log level of all members to info", Command: "egctl logs set-level info"},
+		{Desc: "Set log level of all members to debug", Command: "egctl logs set-level debug"},
+		{Desc: "Set log level of module cluster to debug", Command: "egctl logs set-level debug --module cluster"},
+		{Desc: "Reset log level of module cluster to the global one", Command: "egctl logs set-level default --module cluster"},
+		{Desc: "Set log level of the connected member only", Command: "egctl logs set-level debug --local"},
 	}
 
 	cmd := &cobra.Command{
@@ -84,28 +92,76 @@ func setLogLevelCmd() *cobra.Command {
 		Args:    cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			level := args[0]
-			p := general.LogsLevelURL + "/" + level
-			if _, err := general.HandleRequest(http.MethodPut, p, nil); err != nil {
+			if local {
+				if module != "" {
+					general.ExitWithErrorf("--module is not supported with --local")
+				}
+				p := general.LogsLevelURL + "/" + level
+				if _, err := general.HandleRequest(http.MethodPut, p, nil); err != nil {
+					general.ExitWithError(err)
+				}
+				fmt.Println("Set log level to", level)
+				return
+			}
+
+			levels := getLogLevels()
+			if module == "" {
+				levels.Level = level
+			} else if level == "default" {
+				delete(levels.Modules, module)
+			} else {
+				if levels.Modules == nil {
+					levels.Modules = map[string]string{}
+				}
+				levels.Modules[module] = level
+			}
+
+			body := codectool.MustMarshalJSON(levels)
+			if _, err := general.HandleRequest(http.MethodPut, general.LogLevelsURL, body); err != nil {
 				general.ExitWithError(err)
 			}
-			fmt.Println("Set log level to", level)
+			if module == "" {
+				fmt.Println("Set log level to", level)
+			} else {
+				fmt.Printf("Set log level of module %s to %s\n", module, level)
+			}
 		},
 	}
+	cmd.Flags().StringVar(&module, "module", "", "The module to set log level for, like cluster and HTTPServer, use level default to reset it.")
+	cmd.Flags().BoolVar(&local, "local", false, "Set the global log level of the connected member only.")
 	return cmd
 }
 
+func getLogLevels() *api.LogLevels {
+	body, err := general.HandleRequest(http.MethodGet, general.LogLevelsURL, nil)
+	if err != nil {
+		general.ExitWithError(err)
+	}
+	levels := &api.LogLevels{}
+	if err = codectool.UnmarshalJSON(body, levels); err != nil {
+		general.ExitWithErrorf("unmarshal log levels failed: %v", err)
+	}
+	return levels
+}
+
 func getLogLevelCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "get-level",
 		Short:   "Get Easegress log level",
-		Example: createExample("Get current log level.", "egctl logs get-level"),
+		Example: createExample("Get current log levels.", "egctl logs get-level"),
 		Args:    cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			body, err := general.HandleRequest(http.MethodGet, general.LogsLevelURL, nil)
-			if err != nil {
-				general.ExitWithError(err)
+			levels := getLogLevels()
+			fmt.Println(levels.Level)
+
+			modules := make([]string, 0, len(levels.Modules))
+			for module := range levels.Modules {
+				modules = append(modules, module)
+			}
+			sort.Strings(modules)
+			for _, module := range modules {
+				fmt.Printf("%s: %s\n", module, levels.Modules[module])
 			}
-			fmt.Println(string(body))
 		},
 	}
 	return cmd
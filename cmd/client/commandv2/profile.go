@@ -20,7 +20,9 @@ package commandv2
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"os"
 
 	"github.com/megaease/easegress/v2/cmd/client/general"
 	"github.com/spf13/cobra"
@@ -35,6 +37,7 @@ func ProfileCmd() *cobra.Command {
 	cmd.AddCommand(infoProfileCmd())
 	cmd.AddCommand(startProfilingCmd())
 	cmd.AddCommand(stopProfilingCmd())
+	cmd.AddCommand(diagnosticsCmd())
 	return cmd
 }
 
@@ -139,3 +142,30 @@ func stopProfilingCmd() *cobra.Command {
 	}
 	return cmd
 }
+
+func diagnosticsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "diagnostics",
+		Short:   "Download the diagnostics bundle of the member, the debug API must be enabled",
+		Example: createExample("Download the diagnostics bundle.", "egctl profile diagnostics <path/to/bundle.tar.gz>"),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("requires one file path")
+			}
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			body, err := handleReq(http.MethodGet, makePath(general.DiagnosticsURL), nil)
+			if err != nil {
+				general.ExitWithError(err)
+				return
+			}
+			if err = os.WriteFile(args[0], body, 0o644); err != nil {
+				general.ExitWithError(err)
+				return
+			}
+			fmt.Printf("diagnostics bundle saved to %s\n", args[0])
+		},
+	}
+	return cmd
+}
@@ -0,0 +1,383 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stat
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/megaease/easegress/v2/cmd/client/general"
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/sampler"
+)
+
+type (
+	// Indicators are the request indicators of a traffic gate, like
+	// HTTPServer, on a member or aggregated over all members.
+	Indicators struct {
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+		Kind      string `json:"kind"`
+		// Member is empty if the indicators are aggregated.
+		Member  string `json:"member,omitempty"`
+		Members int    `json:"members"`
+
+		Count uint64 `json:"count"`
+		// RPS and ErrorRPS are the rates of the requests and the failed
+		// requests in the last minute.
+		RPS          float64 `json:"rps"`
+		ErrorRPS     float64 `json:"errorRPS"`
+		ErrorPercent float64 `json:"errorPercent"`
+		// P50, P95 and P99 are the percentiles of the durations in
+		// milliseconds. If aggregated, they are computed from the merged
+		// sketches of the members, or the max of the members if there are
+		// no sketches.
+		P50 float64 `json:"p50"`
+		P95 float64 `json:"p95"`
+		P99 float64 `json:"p99"`
+		// FirstByteP99 is the 99th percentile of the durations until the
+		// responses start to be sent in milliseconds, ReqSizeP99 and
+		// RespSizeP99 are the 99th percentiles of the sizes in bytes.
+		FirstByteP99 float64 `json:"firstByteP99"`
+		ReqSizeP99   float64 `json:"reqSizeP99"`
+		RespSizeP99  float64 `json:"respSizeP99"`
+
+		sketches *sketches
+	}
+
+	// sketches are the mergeable histograms in the status, which are
+	// the same as httpstat.Sketches.
+	sketches struct {
+		ReqSize   *sampler.SketchData `json:"reqSize"`
+		RespSize  *sampler.SketchData `json:"respSize"`
+		FirstByte *sampler.SketchData `json:"firstByte"`
+		Duration  *sampler.SketchData `json:"duration"`
+	}
+
+	// trafficObjectStatus is the status of a traffic object in the cluster,
+	// it is stored with the spec.
+	trafficObjectStatus struct {
+		Spec   map[string]interface{} `json:"spec"`
+		Status map[string]interface{} `json:"status"`
+	}
+)
+
+// fetchIndicators returns the indicators of the traffic gates, or the
+// pipelines if byPipeline is true, of every member, in the namespace if it
+// is not empty.
+func fetchIndicators(namespace string, byPipeline bool) ([]*Indicators, error) {
+	body, err := general.HandleRequest(http.MethodGet, general.StatusObjectsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if byPipeline {
+		return parsePipelineIndicators(body, namespace)
+	}
+	return parseIndicators(body, namespace)
+}
+
+// parseIndicators parses the indicators from the statuses of all objects,
+// whose keys are <namespace>/<name>/<member>. The objects without request
+// indicators, like pipelines and controllers, are skipped.
+func parseIndicators(body []byte, namespace string) ([]*Indicators, error) {
+	result := []*Indicators{}
+	err := walkTrafficGates(body, namespace, func(ns, name, member string, s *trafficObjectStatus) {
+		ind := newIndicators(ns, name, member, s.Status)
+		ind.Kind, _ = s.Spec["kind"].(string)
+		result = append(result, ind)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortIndicators(result, "name")
+	return result, nil
+}
+
+// parsePipelineIndicators parses the indicators of the pipelines from the
+// statuses of the routes of the traffic gates, so only the pipelines
+// routed by the HTTPServers enabling routeMetrics are included. The
+// indicators of the routes to the same pipeline on a member are
+// aggregated.
+func parsePipelineIndicators(body []byte, namespace string) ([]*Indicators, error) {
+	m := map[string]*Indicators{}
+	result := []*Indicators{}
+	err := walkTrafficGates(body, namespace, func(ns, name, member string, s *trafficObjectStatus) {
+		routes, _ := s.Status["routes"].([]interface{})
+		for _, r := range routes {
+			route, _ := r.(map[string]interface{})
+			backend, _ := route["backend"].(string)
+			if backend == "" {
+				continue
+			}
+			ind := newIndicators(ns, backend, member, route)
+			key := ns + "/" + backend + "/" + member
+			if total := m[key]; total != nil {
+				total.add(ind)
+				continue
+			}
+			ind.Kind = "Pipeline"
+			m[key] = ind
+			result = append(result, ind)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortIndicators(result, "name")
+	return result, nil
+}
+
+// walkTrafficGates calls fn for the status of every traffic gate on every
+// member, in the namespace if it is not empty.
+func walkTrafficGates(body []byte, namespace string, fn func(ns, name, member string, s *trafficObjectStatus)) error {
+	statuses := map[string]*trafficObjectStatus{}
+	if err := codectool.Unmarshal(body, &statuses); err != nil {
+		return fmt.Errorf("unmarshal statuses failed: %v", err)
+	}
+
+	for key, s := range statuses {
+		parts := strings.Split(key, "/")
+		if len(parts) != 3 || !strings.HasPrefix(parts[0], cluster.NamespacetrafficPrefix) {
+			continue
+		}
+		if s == nil || s.Status == nil {
+			continue
+		}
+		if _, ok := s.Status["m1"]; !ok {
+			continue
+		}
+
+		ns := strings.TrimPrefix(parts[0], cluster.NamespacetrafficPrefix)
+		if namespace != "" && ns != namespace {
+			continue
+		}
+		fn(ns, parts[1], parts[2], s)
+	}
+	return nil
+}
+
+func newIndicators(namespace, name, member string, status map[string]interface{}) *Indicators {
+	ind := &Indicators{
+		Namespace:    namespace,
+		Name:         name,
+		Member:       member,
+		Members:      1,
+		Count:        uint64(number(status["count"])),
+		RPS:          number(status["m1"]),
+		ErrorRPS:     number(status["m1Err"]),
+		ErrorPercent: number(status["m1ErrPercent"]),
+		P50:          number(status["p50"]),
+		P95:          number(status["p95"]),
+		P99:          number(status["p99"]),
+		sketches:     &sketches{},
+	}
+
+	// the sketches are absent if there are no requests recently.
+	if v, ok := status["sketches"]; ok {
+		if err := codectool.Unmarshal(codectool.MustMarshalJSON(v), ind.sketches); err != nil {
+			ind.sketches = &sketches{}
+		}
+	}
+	ind.FirstByteP99 = ind.sketches.FirstByte.Quantile(0.99)
+	ind.ReqSizeP99 = ind.sketches.ReqSize.Quantile(0.99)
+	ind.RespSizeP99 = ind.sketches.RespSize.Quantile(0.99)
+	return ind
+}
+
+// merge merges other into s.
+func (s *sketches) merge(other *sketches) {
+	mergeSketch(&s.ReqSize, other.ReqSize)
+	mergeSketch(&s.RespSize, other.RespSize)
+	mergeSketch(&s.FirstByte, other.FirstByte)
+	mergeSketch(&s.Duration, other.Duration)
+}
+
+func mergeSketch(dst **sampler.SketchData, src *sampler.SketchData) {
+	if src == nil {
+		return
+	}
+	if *dst == nil {
+		*dst = &sampler.SketchData{}
+	}
+	(*dst).Merge(src)
+}
+
+func number(v interface{}) float64 {
+	f, _ := v.(float64)
+	return f
+}
+
+// aggregate aggregates the indicators of the same object over the
+// members. The rates are summed, and the percentiles are computed from the
+// merged sketches of the members.
+func aggregate(indicators []*Indicators) []*Indicators {
+	m := map[string]*Indicators{}
+	members := map[string]map[string]struct{}{}
+	result := []*Indicators{}
+	for _, ind := range indicators {
+		key := ind.Namespace + "/" + ind.Name
+		total := m[key]
+		if total == nil {
+			total = &Indicators{Namespace: ind.Namespace, Name: ind.Name, Kind: ind.Kind}
+			m[key] = total
+			members[key] = map[string]struct{}{}
+			result = append(result, total)
+		}
+		total.add(ind)
+		members[key][ind.Member] = struct{}{}
+		total.Members = len(members[key])
+	}
+	return result
+}
+
+func (ind *Indicators) add(other *Indicators) {
+	ind.Count += other.Count
+	ind.RPS += other.RPS
+	ind.ErrorRPS += other.ErrorRPS
+	if ind.RPS > 0 {
+		ind.ErrorPercent = ind.ErrorRPS / ind.RPS * 100
+	}
+	if other.P50 > ind.P50 {
+		ind.P50 = other.P50
+	}
+	if other.P95 > ind.P95 {
+		ind.P95 = other.P95
+	}
+	if other.P99 > ind.P99 {
+		ind.P99 = other.P99
+	}
+	if other.FirstByteP99 > ind.FirstByteP99 {
+		ind.FirstByteP99 = other.FirstByteP99
+	}
+	if other.ReqSizeP99 > ind.ReqSizeP99 {
+		ind.ReqSizeP99 = other.ReqSizeP99
+	}
+	if other.RespSizeP99 > ind.RespSizeP99 {
+		ind.RespSizeP99 = other.RespSizeP99
+	}
+
+	// the max of the members is only an upper bound of the real
+	// percentiles, so they are replaced by the percentiles of the merged
+	// sketches if there are any.
+	if other.sketches == nil {
+		return
+	}
+	if ind.sketches == nil {
+		ind.sketches = &sketches{}
+	}
+	ind.sketches.merge(other.sketches)
+	if d := ind.sketches.Duration; d != nil && d.Count > 0 {
+		ind.P50 = d.Quantile(0.5)
+		ind.P95 = d.Quantile(0.95)
+		ind.P99 = d.Quantile(0.99)
+	}
+	if d := ind.sketches.FirstByte; d != nil && d.Count > 0 {
+		ind.FirstByteP99 = d.Quantile(0.99)
+	}
+	if d := ind.sketches.ReqSize; d != nil && d.Count > 0 {
+		ind.ReqSizeP99 = d.Quantile(0.99)
+	}
+	if d := ind.sketches.RespSize; d != nil && d.Count > 0 {
+		ind.RespSizeP99 = d.Quantile(0.99)
+	}
+}
+
+// sortKeys are the valid keys to sort the indicators.
+var sortKeys = []string{"name", "rps", "errors", "p99"}
+
+// sortIndicators sorts the indicators by the key, the names are in
+// ascending order, and the others are in descending order.
+func sortIndicators(indicators []*Indicators, key string) {
+	less := func(a, b *Indicators) bool {
+		switch key {
+		case "rps":
+			return a.RPS > b.RPS
+		case "errors":
+			return a.ErrorPercent > b.ErrorPercent
+		case "p99":
+			return a.P99 > b.P99
+		}
+		return false
+	}
+	sort.SliceStable(indicators, func(i, j int) bool {
+		a, b := indicators[i], indicators[j]
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Member < b.Member
+	})
+}
+
+func (ind *Indicators) row(withMember bool) []string {
+	row := []string{ind.Namespace, ind.Name}
+	if withMember {
+		member := ind.Member
+		if member == "" {
+			member = "TOTAL"
+		}
+		row = append(row, member)
+	} else {
+		row = append(row, fmt.Sprint(ind.Members))
+	}
+	return append(row,
+		fmt.Sprint(ind.Count),
+		fmt.Sprintf("%.2f", ind.RPS),
+		fmt.Sprintf("%.2f", ind.ErrorPercent),
+		fmt.Sprintf("%.1f", ind.P50),
+		fmt.Sprintf("%.1f", ind.P95),
+		fmt.Sprintf("%.1f", ind.P99),
+		fmt.Sprintf("%.1f", ind.FirstByteP99),
+		fmt.Sprintf("%.0f", ind.RespSizeP99),
+	)
+}
+
+func header(withMember bool) []string {
+	second := "MEMBERS"
+	if withMember {
+		second = "MEMBER"
+	}
+	return []string{"NAMESPACE", "NAME", second, "REQUESTS", "RPS(1M)", "ERR%(1M)", "P50(MS)", "P95(MS)", "P99(MS)", "TTFB-P99(MS)", "RESP-P99(B)"}
+}
+
+// printIndicators prints the indicators as a table, or in JSON or YAML.
+func printIndicators(indicators []*Indicators, withMember bool) {
+	if !general.CmdGlobalFlags.DefaultFormat() {
+		general.PrintBody(codectool.MustMarshalJSON(indicators))
+		return
+	}
+
+	table := [][]string{header(withMember)}
+	for _, ind := range indicators {
+		table = append(table, ind.row(withMember))
+	}
+	general.PrintTable(table)
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package stat provides the stat commands to view the live indicators of
+// the traffic gates.
+package stat
+
+import (
+	"fmt"
+
+	"github.com/megaease/easegress/v2/cmd/client/general"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+	"github.com/spf13/cobra"
+)
+
+// Cmd returns stat command.
+func Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stat",
+		Short: "View the live indicators of the traffic gates",
+	}
+	cmd.AddCommand(topCmd())
+	cmd.AddCommand(getCmd())
+	cmd.AddCommand(watchCmd())
+	return cmd
+}
+
+func topCmd() *cobra.Command {
+	var namespace, sortBy string
+	var limit int
+	examples := []general.Example{
+		{Desc: "List the indicators of all traffic gates, aggregated over the members", Command: "egctl stat top"},
+		{Desc: "List the 10 traffic gates with the highest error rates", Command: "egctl stat top --sort errors --limit 10"},
+		{Desc: "List the traffic gates in a namespace in JSON", Command: "egctl stat top --namespace default -o json"},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "top",
+		Short:   "List the indicators of the traffic gates, aggregated over the members",
+		Example: general.CreateMultiExample(examples),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if !stringtool.StrInSlice(sortBy, sortKeys) {
+				return fmt.Errorf("invalid sort key %s, must be one of %v", sortBy, sortKeys)
+			}
+			if limit < 0 {
+				return fmt.Errorf("invalid limit %d", limit)
+			}
+			return cobra.NoArgs(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			indicators, err := fetchIndicators(namespace, false)
+			if err != nil {
+				general.ExitWithError(err)
+			}
+			indicators = aggregate(indicators)
+			sortIndicators(indicators, sortBy)
+			if limit > 0 && len(indicators) > limit {
+				indicators = indicators[:limit]
+			}
+			printIndicators(indicators, false)
+		},
+	}
+
+	cmd.Flags().StringVar(&namespace, "namespace", "", "The namespace of the traffic gates, all namespaces if empty.")
+	cmd.Flags().StringVar(&sortBy, "sort", "rps", "The key to sort the traffic gates, one of name, rps, errors and p99.")
+	cmd.Flags().IntVar(&limit, "limit", 0, "The max number of the traffic gates to list, 0 means no limit.")
+	return cmd
+}
+
+func getCmd() *cobra.Command {
+	var namespace string
+	examples := []general.Example{
+		{Desc: "Get the indicators of a traffic gate on every member", Command: "egctl stat get <name>"},
+		{Desc: "Get the indicators of a traffic gate in a namespace", Command: "egctl stat get <name> --namespace <namespace>"},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "get",
+		Short:   "Get the indicators of a traffic gate on every member",
+		Example: general.CreateMultiExample(examples),
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if namespace == "" {
+				namespace = "default"
+			}
+			all, err := fetchIndicators(namespace, false)
+			if err != nil {
+				general.ExitWithError(err)
+			}
+			indicators := general.Filter(all, func(ind *Indicators) bool {
+				return ind.Name == args[0]
+			})
+			if len(indicators) == 0 {
+				general.ExitWithErrorf("no indicators of %s in namespace %s", args[0], namespace)
+			}
+
+			// the total is appended for more than one member.
+			if len(indicators) > 1 {
+				indicators = append(indicators, aggregate(indicators)...)
+			}
+			printIndicators(indicators, true)
+		},
+	}
+
+	cmd.Flags().StringVar(&namespace, "namespace", "", "The namespace of the traffic gate, default is default.")
+	return cmd
+}
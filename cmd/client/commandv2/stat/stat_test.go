@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stat
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/sampler"
+	"github.com/stretchr/testify/assert"
+)
+
+const statuses = `{
+  "eg-traffic-default/server-demo/member-1": {
+    "spec": {"kind": "HTTPServer", "name": "server-demo"},
+    "status": {"health": "ok", "count": 1000, "m1": 10, "m1Err": 1, "m1ErrPercent": 10, "p50": 5, "p95": 20, "p99": 50}
+  },
+  "eg-traffic-default/server-demo/member-2": {
+    "spec": {"kind": "HTTPServer", "name": "server-demo"},
+    "status": {"health": "ok", "count": 3000, "m1": 30, "m1Err": 0, "m1ErrPercent": 0, "p50": 8, "p95": 15, "p99": 80}
+  },
+  "eg-traffic-ns/server-ns/member-1": {
+    "spec": {"kind": "HTTPServer", "name": "server-ns"},
+    "status": {"count": 10, "m1": 50, "m1Err": 25, "m1ErrPercent": 50, "p50": 1, "p95": 2, "p99": 3}
+  },
+  "eg-traffic-default/pipeline-demo/member-1": {
+    "spec": {"kind": "Pipeline", "name": "pipeline-demo"},
+    "status": {"health": "ok", "filters": {}}
+  },
+  "default/StatusSyncController/member-1": {
+    "process": {"cpuPercent": 1}
+  }
+}`
+
+func TestParseIndicators(t *testing.T) {
+	assert := assert.New(t)
+
+	indicators, err := parseIndicators([]byte(statuses), "")
+	assert.Nil(err)
+	assert.Len(indicators, 3)
+	assert.Equal("server-demo", indicators[0].Name)
+	assert.Equal("member-1", indicators[0].Member)
+	assert.Equal("HTTPServer", indicators[0].Kind)
+	assert.Equal(uint64(1000), indicators[0].Count)
+	assert.Equal(10.0, indicators[0].ErrorPercent)
+
+	indicators, err = parseIndicators([]byte(statuses), "ns")
+	assert.Nil(err)
+	assert.Len(indicators, 1)
+	assert.Equal("server-ns", indicators[0].Name)
+
+	_, err = parseIndicators([]byte("not json"), "")
+	assert.NotNil(err)
+}
+
+func TestAggregate(t *testing.T) {
+	assert := assert.New(t)
+
+	indicators, _ := parseIndicators([]byte(statuses), "")
+	totals := aggregate(indicators)
+	assert.Len(totals, 2)
+
+	demo := totals[0]
+	assert.Equal("server-demo", demo.Name)
+	assert.Equal("", demo.Member)
+	assert.Equal(2, demo.Members)
+	assert.Equal(uint64(4000), demo.Count)
+	assert.Equal(40.0, demo.RPS)
+	assert.Equal(2.5, demo.ErrorPercent)
+	assert.Equal(8.0, demo.P50)
+	assert.Equal(80.0, demo.P99)
+
+	sortIndicators(totals, "errors")
+	assert.Equal("server-ns", totals[0].Name)
+	sortIndicators(totals, "p99")
+	assert.Equal("server-demo", totals[0].Name)
+	sortIndicators(totals, "rps")
+	assert.Equal("server-ns", totals[0].Name)
+	sortIndicators(totals, "name")
+	assert.Equal("server-demo", totals[0].Name)
+}
+
+func TestAggregateSketches(t *testing.T) {
+	assert := assert.New(t)
+
+	// member-1 serves 990 fast requests and member-2 serves 10 slow ones,
+	// so the p99 of the cluster is much less than the p99 of member-2.
+	status := func(n int, d float64) map[string]interface{} {
+		s := sampler.NewSketch()
+		for i := 0; i < n; i++ {
+			s.Add(d)
+		}
+		return map[string]interface{}{
+			"spec": map[string]interface{}{"kind": "HTTPServer"},
+			"status": map[string]interface{}{
+				"count": n, "m1": 1, "p99": d,
+				"sketches": map[string]interface{}{
+					"firstByte": s.Flush(),
+				},
+			},
+		}
+	}
+	body := codectool.MustMarshalJSON(map[string]interface{}{
+		"eg-traffic-default/server-demo/member-1": status(990, 10),
+		"eg-traffic-default/server-demo/member-2": status(10, 1000),
+	})
+
+	indicators, err := parseIndicators(body, "")
+	assert.Nil(err)
+	assert.InEpsilon(1000.0, indicators[1].FirstByteP99, 0.02)
+
+	totals := aggregate(indicators)
+	assert.Len(totals, 1)
+	assert.InEpsilon(10.0, totals[0].FirstByteP99, 0.02)
+	// the durations have no sketches, so their percentiles are the max.
+	assert.Equal(1000.0, totals[0].P99)
+}
+
+const routeStatuses = `{
+  "eg-traffic-default/server-demo/member-1": {
+    "spec": {"kind": "HTTPServer", "name": "server-demo"},
+    "status": {"m1": 30, "routes": [
+      {"path": "/a", "backend": "pipeline-a", "count": 100, "m1": 10, "m1Err": 1, "m1ErrPercent": 10, "p99": 20},
+      {"path": "/b", "backend": "pipeline-a", "count": 100, "m1": 10, "m1Err": 0, "m1ErrPercent": 0, "p99": 40},
+      {"path": "/c", "backend": "pipeline-c", "count": 50, "m1": 10, "m1Err": 0, "m1ErrPercent": 0, "p99": 5}
+    ]}
+  },
+  "eg-traffic-default/server-demo/member-2": {
+    "spec": {"kind": "HTTPServer", "name": "server-demo"},
+    "status": {"m1": 20, "routes": [
+      {"path": "/a", "backend": "pipeline-a", "count": 200, "m1": 20, "m1Err": 2, "m1ErrPercent": 10, "p99": 30}
+    ]}
+  },
+  "eg-traffic-default/server-other/member-1": {
+    "spec": {"kind": "HTTPServer", "name": "server-other"},
+    "status": {"m1": 10}
+  }
+}`
+
+func TestParsePipelineIndicators(t *testing.T) {
+	assert := assert.New(t)
+
+	indicators, err := parsePipelineIndicators([]byte(routeStatuses), "")
+	assert.Nil(err)
+	assert.Len(indicators, 3)
+	assert.Equal("pipeline-a", indicators[0].Name)
+	assert.Equal("Pipeline", indicators[0].Kind)
+	assert.Equal("member-1", indicators[0].Member)
+	assert.Equal(uint64(200), indicators[0].Count)
+	assert.Equal(20.0, indicators[0].RPS)
+	assert.Equal(5.0, indicators[0].ErrorPercent)
+	assert.Equal(40.0, indicators[0].P99)
+
+	// the routes of the same pipeline on different members are counted as
+	// the members of the pipeline.
+	totals := aggregate(indicators)
+	assert.Len(totals, 2)
+	assert.Equal("pipeline-a", totals[0].Name)
+	assert.Equal(2, totals[0].Members)
+	assert.Equal(uint64(400), totals[0].Count)
+	assert.Equal(1, totals[1].Members)
+
+	indicators, err = parsePipelineIndicators([]byte(routeStatuses), "ns")
+	assert.Nil(err)
+	assert.Len(indicators, 0)
+}
+
+func TestRender(t *testing.T) {
+	assert := assert.New(t)
+
+	indicators, _ := parsePipelineIndicators([]byte(routeStatuses), "")
+	totals := aggregate(indicators)
+	sortIndicators(totals, "rps")
+
+	buf := &bytes.Buffer{}
+	render(buf, totals, nil, byPipeline, 2*time.Second, 1, time.Now())
+	out := buf.String()
+	assert.Contains(out, "Every 2s, by pipeline")
+	assert.Contains(out, "Objects: 2")
+	assert.Contains(out, "pipeline-a")
+	assert.NotContains(out, "pipeline-c")
+
+	buf.Reset()
+	render(buf, nil, nil, byPipeline, time.Second, 0, time.Now())
+	assert.Contains(buf.String(), "routeMetrics")
+
+	buf.Reset()
+	render(buf, nil, errors.New("connection refused"), byGate, time.Second, 0, time.Now())
+	assert.Contains(buf.String(), "Error: connection refused")
+}
+
+func TestCmd(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd := Cmd()
+	assert.Len(cmd.Commands(), 3)
+
+	top := topCmd()
+	assert.Nil(top.Args(top, nil))
+	top.Flags().Set("sort", "latency")
+	assert.NotNil(top.Args(top, nil))
+
+	get := getCmd()
+	assert.NotNil(get.Args(get, nil))
+	assert.Nil(get.Args(get, []string{"server-demo"}))
+
+	watch := watchCmd()
+	assert.Nil(watch.Args(watch, nil))
+	assert.NotNil(watch.Args(watch, []string{"server-demo"}))
+	watch.Flags().Set("by", "filter")
+	assert.NotNil(watch.Args(watch, nil))
+	watch.Flags().Set("by", "gate")
+	watch.Flags().Set("interval", "100ms")
+	assert.NotNil(watch.Args(watch, nil))
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package stat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/megaease/easegress/v2/cmd/client/general"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+	"github.com/spf13/cobra"
+)
+
+const (
+	byPipeline = "pipeline"
+	byGate     = "gate"
+
+	// clearScreen moves the cursor to the top left and clears the screen.
+	clearScreen = "\033[H\033[2J"
+)
+
+func watchCmd() *cobra.Command {
+	var namespace, sortBy, by string
+	var interval time.Duration
+	var limit int
+	examples := []general.Example{
+		{Desc: "Watch the indicators of the pipelines, refreshed every 2 seconds", Command: "egctl stat watch"},
+		{Desc: "Watch the 20 slowest pipelines, refreshed every 5 seconds", Command: "egctl stat watch --sort p99 --limit 20 --interval 5s"},
+		{Desc: "Watch the indicators of the traffic gates", Command: "egctl stat watch --by gate"},
+	}
+
+	cmd := &cobra.Command{
+		Use:     "watch",
+		Short:   "Watch the live indicators of the pipelines or the traffic gates",
+		Example: general.CreateMultiExample(examples),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if by != byPipeline && by != byGate {
+				return fmt.Errorf("invalid by %s, must be %s or %s", by, byPipeline, byGate)
+			}
+			if !stringtool.StrInSlice(sortBy, sortKeys) {
+				return fmt.Errorf("invalid sort key %s, must be one of %v", sortBy, sortKeys)
+			}
+			if interval < time.Second {
+				return fmt.Errorf("invalid interval %s, must be at least 1s", interval)
+			}
+			if limit < 0 {
+				return fmt.Errorf("invalid limit %d", limit)
+			}
+			return cobra.NoArgs(cmd, args)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			sig := make(chan os.Signal, 1)
+			signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+			defer signal.Stop(sig)
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				indicators, err := fetchIndicators(namespace, by == byPipeline)
+				if err == nil {
+					indicators = aggregate(indicators)
+					sortIndicators(indicators, sortBy)
+				}
+
+				if general.CmdGlobalFlags.DefaultFormat() {
+					buf := &bytes.Buffer{}
+					buf.WriteString(clearScreen)
+					render(buf, indicators, err, by, interval, limit, time.Now())
+					os.Stdout.Write(buf.Bytes())
+				} else if err != nil {
+					general.Warnf("%v", err)
+				} else {
+					// the snapshots are printed one after another, like the
+					// watch of kubectl.
+					general.PrintBody(codectool.MustMarshalJSON(indicators))
+				}
+
+				select {
+				case <-ticker.C:
+				case <-sig:
+					return
+				}
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&namespace, "namespace", "", "The namespace of the objects, all namespaces if empty.")
+	cmd.Flags().StringVar(&by, "by", byPipeline, "Watch the indicators by pipeline or gate. The indicators of the pipelines come from the HTTPServers enabling routeMetrics.")
+	cmd.Flags().StringVar(&sortBy, "sort", "rps", "The key to sort the objects, one of name, rps, errors and p99.")
+	cmd.Flags().DurationVar(&interval, "interval", 2*time.Second, "The interval to refresh the indicators.")
+	cmd.Flags().IntVar(&limit, "limit", 0, "The max number of the objects to show, 0 means no limit.")
+	return cmd
+}
+
+// render renders a top-like view of the indicators, with a summary of all
+// objects on the top.
+func render(w io.Writer, indicators []*Indicators, err error, by string, interval time.Duration, limit int, now time.Time) {
+	fmt.Fprintf(w, "Every %s, by %s: %s\n", interval, by, now.Format(time.RFC3339))
+	if err != nil {
+		fmt.Fprintf(w, "\nError: %v\n", err)
+		return
+	}
+
+	total := &Indicators{}
+	for _, ind := range indicators {
+		total.add(ind)
+	}
+	fmt.Fprintf(w, "Objects: %d, RPS(1M): %.2f, ERR%%(1M): %.2f, P99(MS): %.1f\n\n",
+		len(indicators), total.RPS, total.ErrorPercent, total.P99)
+
+	if len(indicators) == 0 {
+		if by == byPipeline {
+			fmt.Fprintln(w, "No indicators of the pipelines, enable routeMetrics of the HTTPServers to collect them.")
+		} else {
+			fmt.Fprintln(w, "No indicators of the traffic gates.")
+		}
+		return
+	}
+
+	if limit > 0 && len(indicators) > limit {
+		indicators = indicators[:limit]
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, '\t', 0)
+	for _, row := range append([][]string{header(false)}, rows(indicators)...) {
+		for _, col := range row {
+			fmt.Fprintf(tw, "%s\t", col)
+		}
+		fmt.Fprintln(tw)
+	}
+	tw.Flush()
+}
+
+func rows(indicators []*Indicators) [][]string {
+	result := make([][]string, 0, len(indicators))
+	for _, ind := range indicators {
+		result = append(result, ind.row(false))
+	}
+	return result
+}
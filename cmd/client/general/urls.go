@@ -66,11 +66,15 @@ const (
 	ProfileStartURL = APIURL + "/profile/start/%s"
 	// ProfileStopURL is the URL of stop profile.
 	ProfileStopURL = APIURL + "/profile/stop"
+	// DiagnosticsURL is the URL of the diagnostics bundle.
+	DiagnosticsURL = APIURL + "/debug/diagnostics"
 
 	// LogsURL is the URL of logs.
 	LogsURL = APIURL + "/logs"
 	// LogsLevelURL is the URL of logs level.
 	LogsLevelURL = APIURL + "/logs/level"
+	// LogLevelsURL is the URL of the log levels shared by all members.
+	LogLevelsURL = APIURL + "/logs/levels"
 
 	// MetricsURL is the URL of metrics.
 	MetricsURL = APIURL + "/metrics"
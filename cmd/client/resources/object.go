@@ -461,7 +461,7 @@ func CreateObject(cmd *cobra.Command, s *general.Spec) error {
 }
 
 // DeleteObject deletes an object.
-func DeleteObject(cmd *cobra.Command, kind string, names []string, all bool) error {
+func DeleteObject(cmd *cobra.Command, kind string, names []string, all bool, force bool) error {
 	// define error msg
 	msg := fmt.Sprintf("all %s", kind)
 	if !all {
@@ -470,6 +470,13 @@ func DeleteObject(cmd *cobra.Command, kind string, names []string, all bool) err
 	getErr := func(err error) error {
 		return general.ErrorMsg(general.DeleteCmd, err, msg)
 	}
+	itemURL := func(name string) string {
+		url := makePath(general.ObjectItemURL, name)
+		if force {
+			url += "?force=true"
+		}
+		return url
+	}
 
 	// get all objects and filter by kind
 	body, err := httpGetObject("", nil)
@@ -486,7 +493,7 @@ func DeleteObject(cmd *cobra.Command, kind string, names []string, all bool) err
 
 	if all {
 		for _, m := range metas {
-			_, err = handleReq(http.MethodDelete, makePath(general.ObjectItemURL, m.Name), nil)
+			_, err = handleReq(http.MethodDelete, itemURL(m.Name), nil)
 			if err != nil {
 				return getErr(err)
 			}
@@ -503,7 +510,7 @@ func DeleteObject(cmd *cobra.Command, kind string, names []string, all bool) err
 		if !ok {
 			return getErr(fmt.Errorf("no such %s %s", kind, name))
 		}
-		_, err = handleReq(http.MethodDelete, makePath(general.ObjectItemURL, name), nil)
+		_, err = handleReq(http.MethodDelete, itemURL(name), nil)
 		if err != nil {
 			return getErr(err)
 		}
@@ -541,6 +548,41 @@ func ApplyObject(cmd *cobra.Command, s *general.Spec) error {
 	return nil
 }
 
+// ApplyObjects creates or updates the objects in a batch, the server saves
+// them at once so that the cluster is notified of the changes once.
+func ApplyObjects(cmd *cobra.Command, specs []*general.Spec) error {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	objects := make([]map[string]interface{}, 0, len(specs))
+	for _, s := range specs {
+		var object map[string]interface{}
+		if err := codectool.Unmarshal([]byte(s.Doc()), &object); err != nil {
+			return general.ErrorMsg(general.ApplyCmd, err, s.Kind, s.Name)
+		}
+		objects = append(objects, object)
+	}
+	body, err := codectool.MarshalJSON(objects)
+	if err != nil {
+		return general.ErrorMsg(general.ApplyCmd, err, "objects")
+	}
+
+	body, err = handleReq(http.MethodPut, makePath(general.ObjectsURL), body)
+	if err != nil {
+		return general.ErrorMsg(general.ApplyCmd, err, "objects")
+	}
+
+	var results []*api.ApplyResult
+	if err = codectool.Unmarshal(body, &results); err != nil {
+		return general.ErrorMsg(general.ApplyCmd, err, "objects")
+	}
+	for _, r := range results {
+		fmt.Printf("%s %s %s\n", r.Kind, r.Name, r.Action)
+	}
+	return nil
+}
+
 type objectStatusInfo struct {
 	namespace string
 	name      string
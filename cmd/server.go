@@ -21,11 +21,14 @@ package cmd
 import (
 	"log"
 	"os"
+	"runtime"
+	"strings"
 	"sync"
 
 	"github.com/megaease/easegress/v2/pkg/api"
 	"github.com/megaease/easegress/v2/pkg/cluster"
 	"github.com/megaease/easegress/v2/pkg/common"
+	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/env"
 	"github.com/megaease/easegress/v2/pkg/graceupdate"
 	"github.com/megaease/easegress/v2/pkg/logger"
@@ -33,6 +36,8 @@ import (
 	"github.com/megaease/easegress/v2/pkg/pidfile"
 	"github.com/megaease/easegress/v2/pkg/profile"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/maxprocs"
+	"github.com/megaease/easegress/v2/pkg/util/systemd"
 	"github.com/megaease/easegress/v2/pkg/version"
 )
 
@@ -60,6 +65,15 @@ func RunServer() {
 	defer logger.Sync()
 	logger.Infof("%s", version.Long)
 
+	context.EnablePool(opt.ObjectPool)
+
+	procs := maxprocs.Set(opt.GOMAXPROCS)
+	if quota, ok := maxprocs.Quota(); ok {
+		logger.Infof("GOMAXPROCS is %d, CPU quota is %.2f of %d CPUs", procs, quota, runtime.NumCPU())
+	} else {
+		logger.Infof("GOMAXPROCS is %d, no CPU quota on %d CPUs", procs, runtime.NumCPU())
+	}
+
 	if opt.SignalUpgrade {
 		pid, err := pidfile.Read(opt)
 
@@ -78,6 +92,29 @@ func RunServer() {
 		return
 	}
 
+	if opt.SignalReload {
+		pid, err := pidfile.Read(opt)
+
+		if err != nil {
+			logger.Errorf("failed to read pidfile: %v", err)
+			os.Exit(1)
+		}
+
+		if err := common.RaiseSignal(pid, common.SignalHup); err != nil {
+			logger.Errorf("failed to send signal: %v", err)
+			os.Exit(1)
+		}
+
+		logger.Infof("reload signal sent")
+
+		return
+	}
+
+	sigChan := make(chan common.Signal, 1)
+	ready := make(chan struct{})
+	stopService := startService(sigChan, ready)
+	defer stopService()
+
 	// disable force-new-cluster for graceful update
 	if graceupdate.IsInherit() {
 		opt.ForceNewCluster = false
@@ -104,7 +141,9 @@ func RunServer() {
 
 	apiServer := api.MustNewServer(opt, cls, super, profile)
 
-	if graceupdate.CallOriProcessTerm(super.FirstHandleDone()) {
+	go notifySystemd(super.FirstHandleDone(), ready)
+
+	if graceupdate.CallOriProcessTerm(ready) {
 		pidfile.Write(opt)
 	}
 
@@ -124,7 +163,18 @@ func RunServer() {
 		os.Exit(1)
 	}
 
-	sigChan := make(chan common.Signal, 1)
+	hupChan := make(chan common.Signal, 1)
+	if err := common.NotifySignal(hupChan, common.SignalHup); err != nil {
+		log.Printf("failed to register signal: %v", err)
+		os.Exit(1)
+	}
+	go func() {
+		for sig := range hupChan {
+			logger.Infof("%s signal received, reloading options", sig)
+			reloadOptions(opt, apiServer)
+		}
+	}()
+
 	if err := common.NotifySignal(sigChan, common.SignalInt, common.SignalTerm); err != nil {
 		log.Printf("failed to register signal: %v", err)
 		os.Exit(1)
@@ -136,6 +186,9 @@ func RunServer() {
 		os.Exit(255)
 	}()
 	logger.Infof("%s signal received, closing easegress", sig)
+	if !graceupdate.IsUpgrading() {
+		systemd.Notify(systemd.StateStopping)
+	}
 
 	wg := &sync.WaitGroup{}
 	wg.Add(4)
@@ -145,3 +198,53 @@ func RunServer() {
 	profile.Close(wg)
 	wg.Wait()
 }
+
+// reloadOptions reloads the options which could be changed at runtime, the
+// labels are published to the cluster with the next member status.
+func reloadOptions(opt *option.Options, apiServer *api.Server) {
+	changed, restartRequired, err := opt.Reload()
+	if err != nil {
+		logger.Errorf("reload options failed: %v", err)
+		return
+	}
+	if restartRequired {
+		logger.Warnf("some changed options take effect only after restart")
+	}
+	if len(changed) == 0 {
+		logger.Infof("no reloadable options changed")
+		return
+	}
+	logger.Infof("options reloaded: %s", strings.Join(changed, ", "))
+
+	for _, name := range changed {
+		if name == "gomaxprocs" {
+			logger.Infof("GOMAXPROCS is %d", maxprocs.Set(opt.Snapshot().GOMAXPROCS))
+		}
+	}
+	apiServer.ReloadOptions()
+}
+
+// notifySystemd tells systemd the server is ready after creating all
+// objects at first time, then closes ready and keeps the watchdog alive if
+// it is enabled. The MAINPID is sent too, so the child process of a
+// graceful upgrade takes over the service and the watchdog before the
+// parent exits.
+func notifySystemd(firstHandleDone, ready chan struct{}) {
+	<-firstHandleDone
+
+	state := systemd.StateReady + "\n" + systemd.StateMainPID(os.Getpid())
+	sent, err := systemd.Notify(state)
+	close(ready)
+	if err != nil {
+		logger.Errorf("notify systemd failed: %v", err)
+		return
+	} else if !sent {
+		return
+	}
+	logger.Infof("systemd notified ready")
+
+	if graceupdate.IsInherit() {
+		systemd.TakeOverWatchdog()
+	}
+	systemd.RunWatchdog(nil)
+}
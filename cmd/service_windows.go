@@ -0,0 +1,113 @@
+//go:build windows
+// +build windows
+
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+
+	"github.com/megaease/easegress/v2/pkg/common"
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+// serviceStopWaitHint is the time to wait for stopping the server, which
+// is a bit longer than the timeout to close the admin API server.
+const serviceStopWaitHint = 35 * time.Second
+
+// serviceHandler handles the requests from the service control manager.
+type serviceHandler struct {
+	sigChan chan<- common.Signal
+	ready   <-chan struct{}
+	stopped chan struct{}
+}
+
+// startService runs the server as a Windows service if it is started by
+// the service control manager, the stop and shutdown requests are relayed
+// to sigChan as SignalTerm. The returned function must be called after the
+// server is closed, to report the service is stopped.
+func startService(sigChan chan<- common.Signal, ready <-chan struct{}) func() {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		logger.Errorf("detect windows service failed: %v", err)
+		return func() {}
+	}
+	if !isService {
+		return func() {}
+	}
+
+	h := &serviceHandler{
+		sigChan: sigChan,
+		ready:   ready,
+		stopped: make(chan struct{}),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// the name is ignored for a service running in its own process.
+		if err := svc.Run("", h); err != nil {
+			logger.Errorf("run windows service failed: %v", err)
+		}
+	}()
+
+	return func() {
+		close(h.stopped)
+		<-done
+	}
+}
+
+// Execute implements svc.Handler.
+func (h *serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	const accepts = svc.AcceptStop | svc.AcceptShutdown
+
+	s <- svc.Status{State: svc.StartPending}
+
+	ready, stopping := h.ready, false
+	for {
+		select {
+		case <-ready:
+			ready = nil
+			if !stopping {
+				s <- svc.Status{State: svc.Running, Accepts: accepts}
+				logger.Infof("windows service is running")
+			}
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				s <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				if stopping {
+					continue
+				}
+				stopping = true
+				s <- svc.Status{State: svc.StopPending, WaitHint: uint32(serviceStopWaitHint / time.Millisecond)}
+				logger.Infof("windows service is stopping")
+				select {
+				case h.sigChan <- common.SignalTerm:
+				default: // a signal is pending already.
+				}
+			}
+		case <-h.stopped:
+			s <- svc.Status{State: svc.Stopped}
+			return false, 0
+		}
+	}
+}
@@ -101,13 +101,29 @@ func (s *Server) registerAPIs() {
 	group.Entries = append(group.Entries, s.listAPIEntries()...)
 	group.Entries = append(group.Entries, s.memberAPIEntries()...)
 	group.Entries = append(group.Entries, s.objectAPIEntries()...)
+	group.Entries = append(group.Entries, s.replayAPIEntries()...)
+	group.Entries = append(group.Entries, s.slowRequestsAPIEntries()...)
+	group.Entries = append(group.Entries, s.eventsAPIEntries()...)
+	group.Entries = append(group.Entries, s.tapAPIEntries()...)
+	group.Entries = append(group.Entries, s.captureAPIEntries()...)
+	group.Entries = append(group.Entries, s.sessionAPIEntries()...)
+	group.Entries = append(group.Entries, s.pipelineProfileAPIEntries()...)
+	group.Entries = append(group.Entries, s.maintenanceAPIEntries()...)
+	group.Entries = append(group.Entries, s.canaryAPIEntries()...)
+	group.Entries = append(group.Entries, s.overrideAPIEntries()...)
+	group.Entries = append(group.Entries, s.featureFlagAPIEntries()...)
+	group.Entries = append(group.Entries, s.templateAPIEntries()...)
+	group.Entries = append(group.Entries, s.dependencyAPIEntries()...)
 	group.Entries = append(group.Entries, s.metadataAPIEntries()...)
 	group.Entries = append(group.Entries, s.healthAPIEntries()...)
 	group.Entries = append(group.Entries, s.aboutAPIEntries()...)
+	group.Entries = append(group.Entries, s.dashboardAPIEntries()...)
 	group.Entries = append(group.Entries, s.customDataAPIEntries()...)
 	group.Entries = append(group.Entries, s.profileAPIEntries()...)
 	group.Entries = append(group.Entries, s.prometheusMetricsAPIEntries()...)
 	group.Entries = append(group.Entries, s.logsAPIEntries()...)
+	group.Entries = append(group.Entries, s.logLevelsAPIEntries()...)
+	group.Entries = append(group.Entries, s.debugAPIEntries()...)
 
 	for _, fn := range appendAddonAPIs {
 		fn(s, group)
@@ -0,0 +1,548 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const (
+	defaultCanarySoakPeriod = 5 * time.Minute
+	canaryCheckInterval     = 10 * time.Second
+)
+
+type (
+	// CanarySpec is the request to roll out a new spec of an object to a
+	// part of the members first.
+	CanarySpec struct {
+		// Spec is the new spec of the object.
+		Spec map[string]interface{} `json:"spec" jsonschema:"required"`
+		// Members are the members applying the new spec first, Percent of
+		// the members sorted by name are chosen if it is empty.
+		Members []string `json:"members,omitempty"`
+		Percent int      `json:"percent,omitempty" jsonschema:"minimum=1,maximum=100"`
+		// SoakPeriod is how long the canary members are watched before the
+		// new spec is applied to all members.
+		SoakPeriod string `json:"soakPeriod,omitempty" jsonschema:"format=duration"`
+		// Checks are the indicators watched on the canary members, the
+		// canary is rolled back once any of them exceeds its max value.
+		Checks []*CanaryCheck `json:"checks,omitempty"`
+	}
+
+	// CanaryCheck is an indicator watched on the canary members.
+	CanaryCheck struct {
+		// Object is the object having the indicator in its status, it is
+		// the object of the canary by default.
+		Object    string `json:"object,omitempty"`
+		Namespace string `json:"namespace,omitempty"`
+		// Indicator is the dot separated path of the indicator in the
+		// status, like m1ErrPercent.
+		Indicator string  `json:"indicator" jsonschema:"required"`
+		Max       float64 `json:"max"`
+	}
+
+	// Canary is a canary rollout of an object.
+	Canary struct {
+		CanarySpec
+
+		// BaseSpec is the spec of the object when the canary started.
+		BaseSpec   map[string]interface{} `json:"baseSpec"`
+		State      string                 `json:"state"`
+		StartedAt  time.Time              `json:"startedAt"`
+		SoakUntil  time.Time              `json:"soakUntil"`
+		FinishedAt *time.Time             `json:"finishedAt,omitempty"`
+		Reason     string                 `json:"reason,omitempty"`
+	}
+)
+
+func (s *Server) canaryAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ObjectPrefix + "/{name}/canary",
+			Method:  http.MethodGet,
+			Handler: s.getCanary,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/canary",
+			Method:  http.MethodPost,
+			Handler: s.startCanary,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/canary/promote",
+			Method:  http.MethodPost,
+			Handler: s.promoteCanary,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/canary",
+			Method:  http.MethodDelete,
+			Handler: s.deleteCanary,
+		},
+	}
+}
+
+func (s *Server) getCanary(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	c := s._getCanary(name)
+	if c == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("object %s has no canary", name))
+		return
+	}
+	WriteBody(w, r, c)
+}
+
+// startCanary applies the new spec of the object to the canary members, the
+// leader promotes it to all members after the soak period, or rolls it back
+// once a check fails.
+func (s *Server) startCanary(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	cs := &CanarySpec{}
+	if err = codectool.Unmarshal(body, cs); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("unmarshal canary failed: %v", err))
+		return
+	}
+
+	spec, soakPeriod, err := s.validateCanarySpec(name, cs)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	existedSpec := s._getObject(name)
+	if existedSpec == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	if existedSpec.Kind() != spec.Kind() {
+		HandleAPIError(w, r, http.StatusBadRequest,
+			fmt.Errorf("different kinds: %s, %s", existedSpec.Kind(), spec.Kind()))
+		return
+	}
+
+	// Validate hooks.
+	for _, hook := range objectValidateHooks {
+		err := hook(OperationTypeUpdate, spec)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("validate failed: %v", err))
+			return
+		}
+	}
+
+	if s._soakingCanary(name) != nil {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("object %s already has a soaking canary", name))
+		return
+	}
+
+	members, err := s._canaryMembers(cs)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	if isDryRun(r) {
+		return
+	}
+
+	now := time.Now().UTC()
+	c := &Canary{
+		CanarySpec: *cs,
+		BaseSpec:   existedSpec.RawSpec(),
+		State:      supervisor.CanaryStateSoaking,
+		StartedAt:  now,
+		SoakUntil:  now.Add(soakPeriod),
+	}
+	c.Spec = spec.RawSpec()
+	c.Members = members
+	s._putCanary(name, c)
+
+	logger.Infof("canary of object %s started on members %v", name, members)
+	w.WriteHeader(http.StatusCreated)
+	WriteBody(w, r, c)
+}
+
+func (s *Server) validateCanarySpec(name string, cs *CanarySpec) (*supervisor.Spec, time.Duration, error) {
+	if cs.Spec == nil {
+		return nil, 0, fmt.Errorf("spec is required")
+	}
+	config, err := codectool.MarshalJSON(cs.Spec)
+	if err != nil {
+		return nil, 0, fmt.Errorf("marshal spec failed: %v", err)
+	}
+	spec, err := s.super.CreateSpec(string(config))
+	if err != nil {
+		return nil, 0, err
+	}
+	if spec.Name() != name {
+		return nil, 0, fmt.Errorf("inconsistent name in url and spec")
+	}
+	if spec.Categroy() == supervisor.CategorySystemController {
+		return nil, 0, fmt.Errorf("can't roll out system controller object %s", name)
+	}
+
+	if len(cs.Members) == 0 && (cs.Percent <= 0 || cs.Percent > 100) {
+		return nil, 0, fmt.Errorf("members or a percent in (0, 100] is required")
+	}
+
+	soakPeriod := defaultCanarySoakPeriod
+	if cs.SoakPeriod != "" {
+		soakPeriod, err = time.ParseDuration(cs.SoakPeriod)
+		if err != nil || soakPeriod <= 0 {
+			return nil, 0, fmt.Errorf("invalid soak period %s", cs.SoakPeriod)
+		}
+	}
+
+	for _, check := range cs.Checks {
+		if check.Indicator == "" {
+			return nil, 0, fmt.Errorf("indicator of check is required")
+		}
+	}
+
+	return spec, soakPeriod, nil
+}
+
+// _canaryMembers returns the members of the canary, the members chosen by
+// percent are the first ones sorted by name, so the choice is predictable.
+func (s *Server) _canaryMembers(cs *CanarySpec) ([]string, error) {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().StatusMemberPrefix())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	names := make([]string, 0, len(kvs))
+	for _, v := range kvs {
+		ms := cluster.MemberStatus{}
+		if err := codectool.Unmarshal([]byte(v), &ms); err != nil {
+			panic(fmt.Errorf("unmarshal %s to member status failed: %v", v, err))
+		}
+		names = append(names, ms.Options.Name)
+	}
+	sort.Strings(names)
+
+	if len(cs.Members) > 0 {
+		for _, m := range cs.Members {
+			i := sort.SearchStrings(names, m)
+			if i == len(names) || names[i] != m {
+				return nil, fmt.Errorf("member %s not found", m)
+			}
+		}
+		return cs.Members, nil
+	}
+
+	n := (len(names)*cs.Percent + 99) / 100
+	if n == 0 {
+		return nil, fmt.Errorf("no members found")
+	}
+	return names[:n], nil
+}
+
+// promoteCanary applies the new spec to all members without waiting for
+// the end of the soak period.
+func (s *Server) promoteCanary(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	s.Lock()
+	defer s.Unlock()
+
+	c := s._soakingCanary(name)
+	if c == nil {
+		HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("object %s has no soaking canary", name))
+		return
+	}
+	if err := s._promoteCanary(name, c, "promoted manually"); err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set(ConfigVersionKey, strconv.FormatInt(s._getVersion(), 10))
+}
+
+// deleteCanary rolls back the soaking canary of the object, or removes the
+// record of a finished one.
+func (s *Server) deleteCanary(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	s.Lock()
+	defer s.Unlock()
+
+	c := s._getCanary(name)
+	if c == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("object %s has no canary", name))
+		return
+	}
+
+	if c.State == supervisor.CanaryStateSoaking {
+		s._finishCanary(name, c, supervisor.CanaryStateRolledBack, "rolled back manually")
+		return
+	}
+
+	if err := s.cluster.Delete(s.cluster.Layout().CanaryKey(name)); err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _getCanary(name string) *Canary {
+	value, err := s.cluster.Get(s.cluster.Layout().CanaryKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if value == nil {
+		return nil
+	}
+
+	c := &Canary{}
+	if err = codectool.UnmarshalJSON([]byte(*value), c); err != nil {
+		panic(fmt.Errorf("unmarshal canary of object %s failed: %v", name, err))
+	}
+	return c
+}
+
+// _soakingCanary returns the canary of the object if it is soaking.
+func (s *Server) _soakingCanary(name string) *Canary {
+	c := s._getCanary(name)
+	if c == nil || c.State != supervisor.CanaryStateSoaking {
+		return nil
+	}
+	return c
+}
+
+func (s *Server) _putCanary(name string, c *Canary) {
+	data, err := codectool.MarshalJSON(c)
+	if err != nil {
+		panic(fmt.Errorf("marshal canary of object %s failed: %v", name, err))
+	}
+	if err = s.cluster.Put(s.cluster.Layout().CanaryKey(name), string(data)); err != nil {
+		ClusterPanic(err)
+	}
+}
+
+func (s *Server) _finishCanary(name string, c *Canary, state, reason string) {
+	now := time.Now().UTC()
+	c.State, c.Reason, c.FinishedAt = state, reason, &now
+	s._putCanary(name, c)
+	logger.Infof("canary of object %s is %s: %s", name, state, reason)
+}
+
+// _promoteCanary saves the new spec of the object and the promoted canary
+// in a single transaction.
+func (s *Server) _promoteCanary(name string, c *Canary, reason string) error {
+	config, err := codectool.MarshalJSON(c.Spec)
+	if err != nil {
+		return fmt.Errorf("marshal spec failed: %v", err)
+	}
+	spec, err := s.super.CreateSpec(string(config))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	c.State, c.Reason, c.FinishedAt = supervisor.CanaryStatePromoted, reason, &now
+	data, err := codectool.MarshalJSON(c)
+	if err != nil {
+		return fmt.Errorf("marshal canary failed: %v", err)
+	}
+
+	version := strconv.FormatInt(s._getVersion()+1, 10)
+	jsonConfig, canary := spec.JSONConfig(), string(data)
+	err = s.cluster.PutAndDelete(map[string]*string{
+		s.cluster.Layout().ConfigVersion():       &version,
+		s.cluster.Layout().ConfigObjectKey(name): &jsonConfig,
+		s.cluster.Layout().CanaryKey(name):       &canary,
+	})
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	logger.Infof("canary of object %s is %s: %s", name, c.State, reason)
+	return nil
+}
+
+// runCanaries checks the soaking canaries periodically, only the leader
+// promotes or rolls back them.
+func (s *Server) runCanaries() {
+	ticker := time.NewTicker(canaryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if s.cluster.IsLeader() {
+				s.checkCanaries()
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Server) checkCanaries() {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Errorf("check canaries failed: %v", err)
+		}
+	}()
+
+	prefix := s.cluster.Layout().CanaryPrefix()
+	kvs, err := s.cluster.GetPrefix(prefix)
+	if err != nil {
+		logger.Errorf("get canaries failed: %v", err)
+		return
+	}
+
+	for k, v := range kvs {
+		name := strings.TrimPrefix(k, prefix)
+		c := &Canary{}
+		if err := codectool.UnmarshalJSON([]byte(v), c); err != nil {
+			logger.Errorf("unmarshal canary of object %s failed: %v", name, err)
+			continue
+		}
+		if c.State != supervisor.CanaryStateSoaking {
+			continue
+		}
+
+		failure := s.canaryFailure(name, c)
+		if failure == "" && time.Now().Before(c.SoakUntil) {
+			continue
+		}
+
+		s.settleCanary(name, c.StartedAt, failure)
+	}
+}
+
+// settleCanary rolls back the canary if it failed, or promotes it, unless
+// it has been changed since it was checked.
+func (s *Server) settleCanary(name string, startedAt time.Time, failure string) {
+	s.Lock()
+	defer s.Unlock()
+
+	c := s._soakingCanary(name)
+	if c == nil || !c.StartedAt.Equal(startedAt) {
+		return
+	}
+
+	if failure != "" {
+		s._finishCanary(name, c, supervisor.CanaryStateRolledBack, failure)
+		return
+	}
+	if err := s._promoteCanary(name, c, "soak period passed"); err != nil {
+		s._finishCanary(name, c, supervisor.CanaryStateRolledBack, err.Error())
+	}
+}
+
+// canaryFailure returns the reason if any check fails on the canary
+// members, or an empty string. A member reporting no status of the object
+// fails the checks, it may have crashed with the new spec.
+func (s *Server) canaryFailure(name string, c *Canary) string {
+	for _, check := range c.Checks {
+		object := check.Object
+		if object == "" {
+			object = name
+		}
+
+		prefix, isTraffic := s.canaryStatusPrefix(object, check.Namespace)
+		kvs, err := s.cluster.GetPrefix(prefix)
+		if err != nil {
+			logger.Errorf("get status of object %s failed: %v", object, err)
+			continue
+		}
+
+		for _, member := range c.Members {
+			v, ok := kvs[prefix+member]
+			if !ok {
+				return fmt.Sprintf("no status of %s on member %s", object, member)
+			}
+			m := map[string]interface{}{}
+			if err := codectool.UnmarshalJSON([]byte(v), &m); err != nil {
+				return fmt.Sprintf("invalid status of %s on member %s: %v", object, member, err)
+			}
+			// the status of a traffic object is stored with its spec.
+			if isTraffic {
+				if m, _ = m["status"].(map[string]interface{}); m == nil {
+					return fmt.Sprintf("no status of %s on member %s", object, member)
+				}
+			}
+
+			value, ok := statusIndicator(m, check.Indicator)
+			if ok && value > check.Max {
+				return fmt.Sprintf("%s of %s on member %s is %g, exceeds %g",
+					check.Indicator, object, member, value, check.Max)
+			}
+		}
+	}
+	return ""
+}
+
+func (s *Server) canaryStatusPrefix(object, namespace string) (string, bool) {
+	layout := s.cluster.Layout()
+	if namespace == "" {
+		_, isSystem := s.super.GetSystemController(object)
+		_, isBusiness := s.super.GetBusinessController(object)
+		if isSystem || isBusiness {
+			return layout.StatusObjectPrefix(cluster.NamespaceDefault, object), false
+		}
+		namespace = cluster.NamespaceDefault
+	}
+	return layout.StatusObjectPrefix(cluster.TrafficNamespace(namespace), object), true
+}
+
+// statusIndicator returns the number at the dot separated path in the
+// status.
+func statusIndicator(status map[string]interface{}, indicator string) (float64, bool) {
+	var v interface{} = status
+	for _, key := range strings.Split(indicator, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return 0, false
+		}
+		if v, ok = m[key]; !ok {
+			return 0, false
+		}
+	}
+
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/filters"
+)
+
+type (
+	// filterGetter is implemented by the pipelines, to get their filters.
+	filterGetter interface {
+		GetFilter(name string) (filters.Filter, bool)
+	}
+
+	// captureKeeper is implemented by the filters capturing the requests,
+	// like BodyCapture.
+	captureKeeper interface {
+		Captures() interface{}
+		ClearCaptures()
+	}
+)
+
+func (s *Server) captureAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ObjectPrefix + "/{name}/filters/{filter}/captures",
+			Method:  http.MethodGet,
+			Handler: s.getCaptures,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/filters/{filter}/captures",
+			Method:  http.MethodDelete,
+			Handler: s.clearCaptures,
+		},
+	}
+}
+
+// getPipelineFilter returns the filter specified by the request, it writes
+// the error to the response and returns nil if the filter is not found.
+func (s *Server) getPipelineFilter(w http.ResponseWriter, r *http.Request) filters.Filter {
+	name := chi.URLParam(r, "name")
+	filterName := chi.URLParam(r, "filter")
+	_, namespace := parseNamespaces(r)
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	tc := getTrafficController(s.super)
+	if tc == nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("traffic controller not found"))
+		return nil
+	}
+	entity, exists := tc.GetPipeline(namespace, name)
+	if !exists {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("pipeline %s not found in namespace %s", name, namespace))
+		return nil
+	}
+	getter, ok := entity.Instance().(filterGetter)
+	if !ok {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s is not a pipeline", name))
+		return nil
+	}
+	filter, exists := getter.GetFilter(filterName)
+	if !exists {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("filter %s not found in pipeline %s", filterName, name))
+		return nil
+	}
+	return filter
+}
+
+func (s *Server) getCaptureKeeper(w http.ResponseWriter, r *http.Request) captureKeeper {
+	filter := s.getPipelineFilter(w, r)
+	if filter == nil {
+		return nil
+	}
+	keeper, ok := filter.(captureKeeper)
+	if !ok {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("filter %s does not capture requests", filter.Name()))
+		return nil
+	}
+	return keeper
+}
+
+// getCaptures returns the requests captured by the filter, the most recent
+// first.
+func (s *Server) getCaptures(w http.ResponseWriter, r *http.Request) {
+	keeper := s.getCaptureKeeper(w, r)
+	if keeper == nil {
+		return
+	}
+	WriteBody(w, r, keeper.Captures())
+}
+
+func (s *Server) clearCaptures(w http.ResponseWriter, r *http.Request) {
+	keeper := s.getCaptureKeeper(w, r)
+	if keeper == nil {
+		return
+	}
+	keeper.ClearCaptures()
+}
@@ -109,11 +109,64 @@ func (s *Server) _putObject(spec *supervisor.Spec) {
 	}
 }
 
+// _applyObjects puts and deletes the objects, and plus one to the config
+// version in a single transaction, so that the members are notified of the
+// changes once no matter how many objects are changed.
+func (s *Server) _applyObjects(puts []*supervisor.Spec, deletes []string) int64 {
+	version := s._getVersion() + 1
+	value := strconv.FormatInt(version, 10)
+
+	kvs := make(map[string]*string, len(puts)+3*len(deletes)+1)
+	kvs[s.cluster.Layout().ConfigVersion()] = &value
+	for _, spec := range puts {
+		config := spec.JSONConfig()
+		kvs[s.cluster.Layout().ConfigObjectKey(spec.Name())] = &config
+	}
+	for _, name := range deletes {
+		kvs[s.cluster.Layout().ConfigObjectKey(name)] = nil
+		// like _deleteObject, the maintenance switch, the canary and the
+		// overrides go with the object.
+		kvs[s.cluster.Layout().MaintenanceKey(name)] = nil
+		kvs[s.cluster.Layout().CanaryKey(name)] = nil
+
+		overrides, err := s.cluster.GetPrefix(s.cluster.Layout().OverrideObjectPrefix(name))
+		if err != nil {
+			ClusterPanic(err)
+		}
+		for key := range overrides {
+			kvs[key] = nil
+		}
+	}
+
+	err := s.cluster.PutAndDelete(kvs)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	return version
+}
+
 func (s *Server) _deleteObject(name string) {
 	err := s.cluster.Delete(s.cluster.Layout().ConfigObjectKey(name))
 	if err != nil {
 		ClusterPanic(err)
 	}
+
+	// a pipeline created later with the same name is not in maintenance.
+	err = s.cluster.Delete(s.cluster.Layout().MaintenanceKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	err = s.cluster.Delete(s.cluster.Layout().CanaryKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	err = s.cluster.DeletePrefix(s.cluster.Layout().OverrideObjectPrefix(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
 }
 
 // _getStatusObject returns the status object with the specified name.
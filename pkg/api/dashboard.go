@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// DashboardPath is the path of the web dashboard.
+const DashboardPath = "/dashboard"
+
+// dashboardPage is a single page application using the admin APIs, so it
+// is served with the same authentication as the APIs.
+//
+//go:embed dashboard/index.html
+var dashboardPage []byte
+
+func (s *Server) dashboardAPIEntries() []*Entry {
+	if s.opt.DisableDashboard {
+		return nil
+	}
+
+	return []*Entry{
+		{
+			Path:    DashboardPath,
+			Method:  http.MethodGet,
+			Handler: s.getDashboard,
+		},
+	}
+}
+
+func (s *Server) getDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardPage)
+}
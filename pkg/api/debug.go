@@ -0,0 +1,246 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	httppprof "net/http/pprof"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/maxprocs"
+	"github.com/megaease/easegress/v2/pkg/version"
+)
+
+const (
+	// DebugPrefix is the prefix of the debug APIs, which are registered
+	// only if the option enable-debug-api is set.
+	DebugPrefix = "/debug"
+	// PprofPrefix is the prefix of the pprof APIs.
+	PprofPrefix = DebugPrefix + "/pprof"
+	// GoroutinesPath is the path of the goroutine dump API.
+	GoroutinesPath = DebugPrefix + "/goroutines"
+	// DiagnosticsPath is the path of the diagnostics bundle API.
+	DiagnosticsPath = DebugPrefix + "/diagnostics"
+)
+
+type (
+	// PprofProfile is a profile of the runtime/pprof package.
+	PprofProfile struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	// DiagnosticsSummary is the summary of the member in the diagnostics
+	// bundle.
+	DiagnosticsSummary struct {
+		Time        time.Time      `json:"time"`
+		Version     string         `json:"version"`
+		GoVersion   string         `json:"goVersion"`
+		Name        string         `json:"name"`
+		ClusterName string         `json:"clusterName"`
+		ClusterRole string         `json:"clusterRole"`
+		APIAddr     string         `json:"apiAddr"`
+		LogFormat   string         `json:"logFormat"`
+		LogLevel    string         `json:"logLevel"`
+		NumCPU      int            `json:"numCPU"`
+		CPUQuota    float64        `json:"cpuQuota,omitempty"`
+		GOMAXPROCS  int            `json:"gomaxprocs"`
+		Goroutines  int            `json:"goroutines"`
+		HeapAlloc   uint64         `json:"heapAlloc"`
+		HeapSys     uint64         `json:"heapSys"`
+		NumGC       uint32         `json:"numGC"`
+		Controllers map[string]int `json:"controllers"`
+	}
+)
+
+func (s *Server) debugAPIEntries() []*Entry {
+	if !s.opt.EnableDebugAPI {
+		return nil
+	}
+
+	return []*Entry{
+		{
+			Path:    PprofPrefix,
+			Method:  http.MethodGet,
+			Handler: s.listPprofProfiles,
+		},
+		{
+			Path:    PprofPrefix + "/cmdline",
+			Method:  http.MethodGet,
+			Handler: httppprof.Cmdline,
+		},
+		{
+			Path:    PprofPrefix + "/profile",
+			Method:  http.MethodGet,
+			Handler: httppprof.Profile,
+		},
+		{
+			Path:    PprofPrefix + "/symbol",
+			Method:  http.MethodGet,
+			Handler: httppprof.Symbol,
+		},
+		{
+			Path:    PprofPrefix + "/trace",
+			Method:  http.MethodGet,
+			Handler: httppprof.Trace,
+		},
+		{
+			Path:    PprofPrefix + "/{profile}",
+			Method:  http.MethodGet,
+			Handler: s.getPprofProfile,
+		},
+		{
+			Path:    GoroutinesPath,
+			Method:  http.MethodGet,
+			Handler: s.getGoroutines,
+		},
+		{
+			Path:    DiagnosticsPath,
+			Method:  http.MethodGet,
+			Handler: s.getDiagnostics,
+		},
+	}
+}
+
+// listPprofProfiles lists the profiles could be got from
+// /debug/pprof/{profile}, besides profile (CPU) and trace.
+func (s *Server) listPprofProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles := []*PprofProfile{}
+	for _, p := range pprof.Profiles() {
+		profiles = append(profiles, &PprofProfile{Name: p.Name(), Count: p.Count()})
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	WriteBody(w, r, profiles)
+}
+
+// getPprofProfile writes the profile in the same way as net/http/pprof,
+// the query debug and seconds are supported.
+func (s *Server) getPprofProfile(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "profile")
+	if pprof.Lookup(name) == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("profile %s not found", name))
+		return
+	}
+	httppprof.Handler(name).ServeHTTP(w, r)
+}
+
+// getGoroutines writes the stack traces of all goroutines in text.
+func (s *Server) getGoroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	pprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+func (s *Server) diagnosticsSummary() *DiagnosticsSummary {
+	ms := &runtime.MemStats{}
+	runtime.ReadMemStats(ms)
+
+	controllers := map[string]int{}
+	s.super.WalkControllers(func(entity *supervisor.ObjectEntity) bool {
+		controllers[entity.Spec().Kind()]++
+		return true
+	})
+
+	parallelism := maxprocs.CurrentStatus()
+	return &DiagnosticsSummary{
+		Time:        time.Now(),
+		Version:     version.Long,
+		GoVersion:   runtime.Version(),
+		Name:        s.opt.Name,
+		ClusterName: s.opt.ClusterName,
+		ClusterRole: s.opt.ClusterRole,
+		APIAddr:     s.opt.APIAddr,
+		LogFormat:   s.opt.LogFormat,
+		LogLevel:    logger.GetLogLevel(),
+		NumCPU:      parallelism.NumCPU,
+		CPUQuota:    parallelism.CPUQuota,
+		GOMAXPROCS:  parallelism.GOMAXPROCS,
+		Goroutines:  runtime.NumGoroutine(),
+		HeapAlloc:   ms.HeapAlloc,
+		HeapSys:     ms.HeapSys,
+		NumGC:       ms.NumGC,
+		Controllers: controllers,
+	}
+}
+
+// getDiagnostics writes a gzipped tarball of the diagnostics of the member:
+// the summary, the heap profile, the goroutine dump and the recent errors.
+func (s *Server) getDiagnostics(w http.ResponseWriter, r *http.Request) {
+	files := []struct {
+		name  string
+		write func(buf *bytes.Buffer) error
+	}{
+		{"summary.json", func(buf *bytes.Buffer) error {
+			data, err := codectool.MarshalJSON(s.diagnosticsSummary())
+			buf.Write(data)
+			return err
+		}},
+		{"heap.pprof", func(buf *bytes.Buffer) error {
+			return pprof.Lookup("heap").WriteTo(buf, 0)
+		}},
+		{"goroutines.txt", func(buf *bytes.Buffer) error {
+			return pprof.Lookup("goroutine").WriteTo(buf, 2)
+		}},
+		{"errors.log", func(buf *bytes.Buffer) error {
+			for _, log := range logger.RecentErrors() {
+				buf.WriteString(strings.TrimSuffix(log, "\n"))
+				buf.WriteByte('\n')
+			}
+			return nil
+		}},
+	}
+
+	bundle := bytes.NewBuffer(nil)
+	gw := gzip.NewWriter(bundle)
+	tw := tar.NewWriter(gw)
+	now := time.Now()
+	for _, f := range files {
+		buf := bytes.NewBuffer(nil)
+		if err := f.write(buf); err != nil {
+			HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("write %s failed: %v", f.name, err))
+			return
+		}
+		hdr := &tar.Header{Name: f.name, Mode: 0o644, Size: int64(buf.Len()), ModTime: now}
+		if err := tw.WriteHeader(hdr); err != nil {
+			HandleAPIError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		tw.Write(buf.Bytes())
+	}
+	tw.Close()
+	gw.Close()
+
+	filename := fmt.Sprintf("diagnostics-%s-%s.tar.gz", s.opt.Name, now.Format("20060102150405"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Write(bundle.Bytes())
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+// ObjectDependenciesPrefix is the prefix of the dependencies of objects.
+const ObjectDependenciesPrefix = "/object-dependencies"
+
+type (
+	// ObjectDependency is the dependency of an object, the objects are
+	// referenced by name, like the pipelines in the rules of an HTTPServer
+	// and the service registries of the proxy pools in a pipeline.
+	ObjectDependency struct {
+		Name string `json:"name"`
+		Kind string `json:"kind"`
+		// References are the objects referenced by the object.
+		References []string `json:"references,omitempty"`
+		// ReferencedBy are the objects referencing the object directly.
+		ReferencedBy []string `json:"referencedBy,omitempty"`
+	}
+
+	// ObjectImpact is the impact of changing or deleting an object.
+	ObjectImpact struct {
+		ObjectDependency `json:",inline"`
+		// Affected are the objects referencing the object directly or
+		// indirectly.
+		Affected []string `json:"affected,omitempty"`
+		// Pipelines are the affected pipelines, including the object itself
+		// if it is a pipeline.
+		Pipelines []string `json:"pipelines,omitempty"`
+	}
+
+	objectGraph struct {
+		specs     map[string]*supervisor.Spec
+		refs      map[string][]string
+		referrers map[string][]string
+	}
+)
+
+func newObjectGraph(specs []*supervisor.Spec) *objectGraph {
+	g := &objectGraph{
+		specs:     map[string]*supervisor.Spec{},
+		refs:      map[string][]string{},
+		referrers: map[string][]string{},
+	}
+
+	// specs are sorted, so the referrers are sorted too.
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].Name() < specs[j].Name()
+	})
+	kinds := map[string][]string{}
+	for _, spec := range specs {
+		g.specs[spec.Name()] = spec
+		kinds[spec.Kind()] = append(kinds[spec.Kind()], spec.Name())
+	}
+
+	for _, spec := range specs {
+		name := spec.Name()
+		refs := spec.References()
+		for _, kind := range spec.KindReferences() {
+			refs = append(refs, kinds[kind]...)
+		}
+		refs = uniqueReferences(name, refs)
+
+		g.refs[name] = refs
+		for _, ref := range refs {
+			g.referrers[ref] = append(g.referrers[ref], name)
+		}
+	}
+
+	return g
+}
+
+// uniqueReferences returns the sorted references without duplications and
+// the object itself, an object referencing itself, like a pipeline calling
+// itself by SubPipeline, never prevents its deletion.
+func uniqueReferences(name string, refs []string) []string {
+	var result []string
+	seen := map[string]bool{name: true}
+	for _, ref := range refs {
+		if !seen[ref] {
+			seen[ref] = true
+			result = append(result, ref)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (g *objectGraph) dependency(name string) ObjectDependency {
+	return ObjectDependency{
+		Name:         name,
+		Kind:         g.specs[name].Kind(),
+		References:   g.refs[name],
+		ReferencedBy: g.referrers[name],
+	}
+}
+
+// impact returns the impact of the object, the references are followed
+// backward until no more referrers are found, so reference cycles are fine.
+func (g *objectGraph) impact(name string) *ObjectImpact {
+	impact := &ObjectImpact{ObjectDependency: g.dependency(name)}
+
+	visited := map[string]bool{name: true}
+	queue := []string{name}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		for _, referrer := range g.referrers[n] {
+			if !visited[referrer] {
+				visited[referrer] = true
+				queue = append(queue, referrer)
+				impact.Affected = append(impact.Affected, referrer)
+			}
+		}
+	}
+	sort.Strings(impact.Affected)
+
+	if g.isPipeline(name) {
+		impact.Pipelines = append(impact.Pipelines, name)
+	}
+	for _, n := range impact.Affected {
+		if g.isPipeline(n) {
+			impact.Pipelines = append(impact.Pipelines, n)
+		}
+	}
+	sort.Strings(impact.Pipelines)
+
+	return impact
+}
+
+func (g *objectGraph) isPipeline(name string) bool {
+	spec := g.specs[name]
+	return spec != nil && spec.Categroy() == supervisor.CategoryPipeline
+}
+
+func (s *Server) dependencyAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ObjectDependenciesPrefix,
+			Method:  "GET",
+			Handler: s.listObjectDependencies,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/impact",
+			Method:  "GET",
+			Handler: s.getObjectImpact,
+		},
+	}
+}
+
+func (s *Server) listObjectDependencies(w http.ResponseWriter, r *http.Request) {
+	g := newObjectGraph(s._listObjects())
+
+	deps := make([]ObjectDependency, 0, len(g.specs))
+	for name := range g.specs {
+		deps = append(deps, g.dependency(name))
+	}
+	sort.Slice(deps, func(i, j int) bool {
+		return deps[i].Name < deps[j].Name
+	})
+
+	WriteBody(w, r, deps)
+}
+
+func (s *Server) getObjectImpact(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	g := newObjectGraph(s._listObjects())
+	if g.specs[name] == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	WriteBody(w, r, g.impact(name))
+}
+
+// _checkReferrers returns an error if the object is referenced by other
+// objects.
+func (s *Server) _checkReferrers(name string) error {
+	g := newObjectGraph(s._listObjects())
+	if referrers := g.referrers[name]; len(referrers) > 0 {
+		return fmt.Errorf("%s is referenced by %s, delete them first or use force=true", name, strings.Join(referrers, ", "))
+	}
+	return nil
+}
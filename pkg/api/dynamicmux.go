@@ -84,8 +84,8 @@ func (m *dynamicMux) reloadAPIs() {
 	router.Use(m.newAPILogger)
 	router.Use(m.newConfigVersionAttacher)
 	router.Use(m.newRecoverer)
-	if len(m.server.opt.BasicAuth) > 0 {
-		router.Use(m.basicAuth("easegress-basic-auth", m.server.opt.BasicAuth))
+	if basicAuth := m.server.opt.Snapshot().BasicAuth; len(basicAuth) > 0 {
+		router.Use(m.basicAuth("easegress-basic-auth", basicAuth))
 	}
 
 	// For access from browser.
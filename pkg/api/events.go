@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+// eventSource is implemented by the objects publishing events, like
+// AnomalyDetector and HTTPServer.
+type eventSource interface {
+	Events() interface{}
+	SubscribeEvents() (<-chan interface{}, func())
+}
+
+func (s *Server) eventsAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ObjectPrefix + "/{name}/events",
+			Method:  http.MethodGet,
+			Handler: s.getEvents,
+		},
+	}
+}
+
+// getEventSource looks up the object in the business controllers, and then
+// in the traffic gates of the namespace of the query namespace, default is
+// default.
+func (s *Server) getEventSource(r *http.Request, name string) (source eventSource, ok bool, exists bool) {
+	if entity, exists := s.super.GetBusinessController(name); exists {
+		source, ok = entity.Instance().(eventSource)
+		return source, ok, true
+	}
+
+	_, namespace := parseNamespaces(r)
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	tc := getTrafficController(s.super)
+	if tc == nil {
+		return nil, false, false
+	}
+	entity, exists := tc.GetTrafficGate(namespace, name)
+	if !exists {
+		return nil, false, false
+	}
+	source, ok = entity.Instance().(eventSource)
+	return source, ok, true
+}
+
+// getEvents returns the recent events of the object, the oldest first. If
+// the query follow is true, the new events are streamed as JSON lines
+// until the client disconnects.
+func (s *Server) getEvents(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	follow := false
+	if value := r.URL.Query().Get("follow"); value != "" {
+		var err error
+		follow, err = strconv.ParseBool(value)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid follow %s, %v", value, err))
+			return
+		}
+	}
+
+	source, ok, exists := s.getEventSource(r, name)
+	if !exists {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("object %s not found", name))
+		return
+	}
+	if !ok {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s does not publish events", name))
+		return
+	}
+
+	if !follow {
+		WriteBody(w, r, source.Events())
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+
+	events, cancel := source.SubscribeEvents()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case event := <-events:
+			buff := append(codectool.MustMarshalJSON(event), '\n')
+			if _, err := w.Write(buff); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,238 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/featureflags"
+)
+
+// FeatureFlagPrefix is the prefix of the feature flag APIs.
+const FeatureFlagPrefix = "/feature-flags"
+
+type (
+	// FeatureFlagRequest is a request to evaluate a feature flag by the
+	// evaluation API.
+	FeatureFlagRequest struct {
+		Consumer string            `json:"consumer,omitempty"`
+		Key      string            `json:"key,omitempty"`
+		Headers  map[string]string `json:"headers,omitempty"`
+	}
+
+	// FeatureFlagResult is the result of evaluating a feature flag.
+	FeatureFlagResult struct {
+		Name string `json:"name"`
+		On   bool   `json:"on"`
+	}
+)
+
+func (s *Server) featureFlagAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    FeatureFlagPrefix,
+			Method:  http.MethodGet,
+			Handler: s.listFeatureFlags,
+		},
+		{
+			Path:    FeatureFlagPrefix + "/{name}",
+			Method:  http.MethodGet,
+			Handler: s.getFeatureFlag,
+		},
+		{
+			Path:    FeatureFlagPrefix + "/{name}",
+			Method:  http.MethodPut,
+			Handler: s.putFeatureFlag,
+		},
+		{
+			Path:    FeatureFlagPrefix + "/{name}",
+			Method:  http.MethodDelete,
+			Handler: s.deleteFeatureFlag,
+		},
+		{
+			Path:    FeatureFlagPrefix + "/{name}/evaluate",
+			Method:  http.MethodPost,
+			Handler: s.evaluateFeatureFlag,
+		},
+	}
+}
+
+func (s *Server) listFeatureFlags(w http.ResponseWriter, r *http.Request) {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().FeatureFlagPrefix())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	flags := make([]*featureflags.Flag, 0, len(kvs))
+	for k, v := range kvs {
+		f := &featureflags.Flag{}
+		if err = codectool.UnmarshalJSON([]byte(v), f); err != nil {
+			panic(fmt.Errorf("unmarshal feature flag %s failed: %v", k, err))
+		}
+		flags = append(flags, f)
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i].Name < flags[j].Name
+	})
+	WriteBody(w, r, flags)
+}
+
+func (s *Server) _getFeatureFlag(name string) *featureflags.Flag {
+	value, err := s.cluster.Get(s.cluster.Layout().FeatureFlagKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if value == nil {
+		return nil
+	}
+
+	f := &featureflags.Flag{}
+	if err = codectool.UnmarshalJSON([]byte(*value), f); err != nil {
+		panic(fmt.Errorf("unmarshal feature flag %s failed: %v", name, err))
+	}
+	return f
+}
+
+func (s *Server) getFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	f := s._getFeatureFlag(name)
+	if f == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("feature flag %s not found", name))
+		return
+	}
+	WriteBody(w, r, f)
+}
+
+// putFeatureFlag creates or updates the feature flag, it is applied to this
+// member at once and to other members by watching.
+func (s *Server) putFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	f := &featureflags.Flag{}
+	if err = codectool.Unmarshal(body, f); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("unmarshal feature flag failed: %v", err))
+		return
+	}
+	if f.Name != "" && f.Name != name {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("inconsistent name in url and feature flag"))
+		return
+	}
+	if err = f.Validate(); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	f.Name = name
+	f.UpdatedAt = time.Now().UTC()
+
+	data, err := codectool.MarshalJSON(f)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err = s.cluster.Put(s.cluster.Layout().FeatureFlagKey(name), string(data)); err != nil {
+		ClusterPanic(err)
+	}
+
+	featureflags.Put(f)
+	logger.Infof("feature flag %s is updated, enabled: %v", name, f.Enabled)
+}
+
+func (s *Server) deleteFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	if err := s.cluster.Delete(s.cluster.Layout().FeatureFlagKey(name)); err != nil {
+		ClusterPanic(err)
+	}
+
+	featureflags.Delete(name)
+	logger.Infof("feature flag %s is deleted", name)
+}
+
+// evaluateFeatureFlag evaluates the feature flag for a request described
+// in the body, for the services evaluating the flags by themselves.
+func (s *Server) evaluateFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	req := &FeatureFlagRequest{}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err = codectool.Unmarshal(body, req); err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("unmarshal request failed: %v", err))
+			return
+		}
+	}
+
+	f := s._getFeatureFlag(name)
+	if f == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("feature flag %s not found", name))
+		return
+	}
+
+	header := http.Header{}
+	for k, v := range req.Headers {
+		header.Set(k, v)
+	}
+	key := req.Key
+	if key == "" {
+		key = req.Consumer
+	}
+	WriteBody(w, r, &FeatureFlagResult{Name: name, On: f.Evaluate(req.Consumer, key, header)})
+}
+
+// applyFeatureFlags replaces the feature flags of this member with the ones
+// in the cluster.
+func (s *Server) applyFeatureFlags(kvs map[string]string) {
+	prefix := s.cluster.Layout().FeatureFlagPrefix()
+
+	flags := make(map[string]*featureflags.Flag, len(kvs))
+	for k, v := range kvs {
+		name := strings.TrimPrefix(k, prefix)
+		f := &featureflags.Flag{}
+		if err := codectool.UnmarshalJSON([]byte(v), f); err != nil {
+			logger.Errorf("unmarshal feature flag %s failed: %v", name, err)
+			continue
+		}
+		flags[name] = f
+	}
+	featureflags.Replace(flags)
+}
+
+// watchFeatureFlags applies the feature flags shared by all members when
+// they are changed.
+func (s *Server) watchFeatureFlags() {
+	s.watchPrefix("feature flags", s.cluster.Layout().FeatureFlagPrefix(), s.applyFeatureFlags)
+}
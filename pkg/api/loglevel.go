@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+// LogLevelsPrefix is the prefix of the log levels shared by all members.
+const LogLevelsPrefix = "/logs/levels"
+
+// LogLevels are the log levels shared by all members of the cluster, the
+// levels of the modules override the global level for their logs.
+type LogLevels struct {
+	Level   string            `json:"level"`
+	Modules map[string]string `json:"modules,omitempty"`
+}
+
+func (s *Server) logLevelsAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    LogLevelsPrefix,
+			Method:  http.MethodGet,
+			Handler: s.getLogLevels,
+		},
+		{
+			Path:    LogLevelsPrefix,
+			Method:  http.MethodPut,
+			Handler: s.putLogLevels,
+		},
+	}
+}
+
+// parse parses the log levels, the global level is the default level if it
+// is empty.
+func (ll *LogLevels) parse(defaultLevel zapcore.Level) (zapcore.Level, map[string]zapcore.Level, error) {
+	level := defaultLevel
+	if ll.Level != "" {
+		l, err := logger.ParseLevel(ll.Level)
+		if err != nil {
+			return level, nil, err
+		}
+		level = l
+	}
+
+	modules := make(map[string]zapcore.Level, len(ll.Modules))
+	for module, v := range ll.Modules {
+		if module == "" {
+			return level, nil, fmt.Errorf("empty module name")
+		}
+		l, err := logger.ParseLevel(v)
+		if err != nil {
+			return level, nil, fmt.Errorf("module %s: %v", module, err)
+		}
+		modules[module] = l
+	}
+
+	return level, modules, nil
+}
+
+func (s *Server) defaultLogLevel() zapcore.Level {
+	if s.opt.Snapshot().Debug {
+		return zapcore.DebugLevel
+	}
+	return zapcore.InfoLevel
+}
+
+// getLogLevels returns the log levels in effect on this member.
+func (s *Server) getLogLevels(w http.ResponseWriter, r *http.Request) {
+	WriteBody(w, r, &LogLevels{
+		Level:   logger.GetLogLevel(),
+		Modules: logger.GetModuleLogLevels(),
+	})
+}
+
+// putLogLevels replaces the log levels of all members, the levels are
+// applied to this member at once and to other members by watching.
+func (s *Server) putLogLevels(w http.ResponseWriter, r *http.Request) {
+	ll := &LogLevels{}
+	codectool.MustDecode(r.Body, ll)
+
+	level, modules, err := ll.parse(s.defaultLogLevel())
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	data, err := codectool.MarshalJSON(ll)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err = s.cluster.Put(s.cluster.Layout().ConfigLogLevels(), string(data)); err != nil {
+		ClusterPanic(err)
+	}
+
+	logger.SetLogLevels(level, modules)
+}
+
+func (s *Server) applyLogLevels(value *string) {
+	// the levels are reset if they are deleted.
+	if value == nil {
+		logger.SetLogLevels(s.defaultLogLevel(), nil)
+		return
+	}
+
+	ll := &LogLevels{}
+	if err := codectool.UnmarshalJSON([]byte(*value), ll); err != nil {
+		logger.Errorf("unmarshal log levels %s failed: %v", *value, err)
+		return
+	}
+	level, modules, err := ll.parse(s.defaultLogLevel())
+	if err != nil {
+		logger.Errorf("invalid log levels %s: %v", *value, err)
+		return
+	}
+	logger.SetLogLevels(level, modules)
+}
+
+// watchLogLevels applies the log levels shared by all members when they
+// are changed.
+func (s *Server) watchLogLevels() {
+	var (
+		ch     <-chan *string
+		syncer cluster.Syncer
+		err    error
+	)
+
+	for {
+		syncer, err = s.cluster.Syncer(time.Minute)
+		if err == nil {
+			ch, err = syncer.Sync(s.cluster.Layout().ConfigLogLevels())
+			if err == nil {
+				break
+			}
+		}
+		logger.Errorf("failed to watch log levels: %v", err)
+		select {
+		case <-time.After(10 * time.Second):
+		case <-s.done:
+			return
+		}
+	}
+	defer syncer.Close()
+
+	for {
+		select {
+		case value, ok := <-ch:
+			if !ok {
+				return
+			}
+			s.applyLogLevels(value)
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -29,7 +29,6 @@ import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/go-chi/chi/v5"
 	"github.com/megaease/easegress/v2/pkg/logger"
-	"go.uber.org/zap"
 )
 
 func (s *Server) logsAPIEntries() []*Entry {
@@ -101,15 +100,14 @@ func (s *Server) setLogLevel(w http.ResponseWriter, r *http.Request) {
 		HandleAPIError(w, r, http.StatusBadRequest, errors.New("level is required"))
 		return
 	}
-	level = strings.ToLower(level)
-	if level == "debug" {
-		logger.SetLogLevel(zap.DebugLevel)
-	} else if level == "info" {
-		logger.SetLogLevel(zap.InfoLevel)
-	} else {
-		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid level %s, only support to set log level to info or debug", level))
+	// the level is set on this member only, use the log levels API to set
+	// it for all members.
+	l, err := logger.ParseLevel(strings.ToLower(level))
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
 		return
 	}
+	logger.SetLogLevel(l)
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -0,0 +1,221 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+// Maintenance is the maintenance switch of a pipeline, which is shared by
+// all members. A pipeline in maintenance responds with its maintenance
+// page instead of handling the requests.
+type Maintenance struct {
+	// Message is shown in the maintenance page.
+	Message string    `json:"message,omitempty"`
+	Since   time.Time `json:"since"`
+}
+
+// maintenances are the maintenance switches of the pipelines in this
+// member, the key is the name of the pipeline.
+var maintenances sync.Map
+
+// GetMaintenance returns the maintenance switch of the pipeline, ok is
+// false if the pipeline is not in maintenance.
+func GetMaintenance(name string) (m *Maintenance, ok bool) {
+	v, ok := maintenances.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return v.(*Maintenance), true
+}
+
+func (s *Server) maintenanceAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ObjectPrefix + "/{name}/maintenance",
+			Method:  http.MethodGet,
+			Handler: s.getMaintenance,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/maintenance",
+			Method:  http.MethodPut,
+			Handler: s.putMaintenance,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/maintenance",
+			Method:  http.MethodDelete,
+			Handler: s.deleteMaintenance,
+		},
+	}
+}
+
+func (s *Server) getMaintenance(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	value, err := s.cluster.Get(s.cluster.Layout().MaintenanceKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if value == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("pipeline %s is not in maintenance", name))
+		return
+	}
+
+	m := &Maintenance{}
+	if err = codectool.UnmarshalJSON([]byte(*value), m); err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("unmarshal maintenance failed: %v", err))
+		return
+	}
+	WriteBody(w, r, m)
+}
+
+// putMaintenance puts the pipeline into maintenance on all members, the
+// body is optional, and the switch is applied to this member at once and
+// to other members by watching.
+func (s *Server) putMaintenance(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	tc := getTrafficController(s.super)
+	if tc == nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("traffic controller not found"))
+		return
+	}
+	if _, exists := tc.GetPipeline(DefaultNamespace, name); !exists {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("pipeline %s not found", name))
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	m := &Maintenance{}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err = codectool.Unmarshal(body, m); err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("unmarshal maintenance failed: %v", err))
+			return
+		}
+	}
+	m.Since = time.Now().UTC()
+
+	data, err := codectool.MarshalJSON(m)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err = s.cluster.Put(s.cluster.Layout().MaintenanceKey(name), string(data)); err != nil {
+		ClusterPanic(err)
+	}
+
+	maintenances.Store(name, m)
+	logger.Infof("pipeline %s is in maintenance", name)
+}
+
+// deleteMaintenance brings the pipeline back from maintenance.
+func (s *Server) deleteMaintenance(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	if err := s.cluster.Delete(s.cluster.Layout().MaintenanceKey(name)); err != nil {
+		ClusterPanic(err)
+	}
+
+	maintenances.Delete(name)
+	logger.Infof("pipeline %s is out of maintenance", name)
+}
+
+// applyMaintenances replaces the maintenance switches of this member with
+// the ones in the cluster.
+func (s *Server) applyMaintenances(kvs map[string]string) {
+	prefix := s.cluster.Layout().MaintenancePrefix()
+
+	names := make(map[string]bool, len(kvs))
+	for k, v := range kvs {
+		name := strings.TrimPrefix(k, prefix)
+		m := &Maintenance{}
+		if err := codectool.UnmarshalJSON([]byte(v), m); err != nil {
+			logger.Errorf("unmarshal maintenance of pipeline %s failed: %v", name, err)
+			continue
+		}
+		maintenances.Store(name, m)
+		names[name] = true
+	}
+
+	maintenances.Range(func(k, v interface{}) bool {
+		if !names[k.(string)] {
+			maintenances.Delete(k)
+		}
+		return true
+	})
+}
+
+// watchMaintenances applies the maintenance switches shared by all
+// members when they are changed.
+func (s *Server) watchMaintenances() {
+	s.watchPrefix("maintenances", s.cluster.Layout().MaintenancePrefix(), s.applyMaintenances)
+}
+
+// watchPrefix calls apply with all the keys under the prefix whenever any
+// of them is changed, until the server is closed.
+func (s *Server) watchPrefix(what, prefix string, apply func(kvs map[string]string)) {
+	var (
+		ch     <-chan map[string]string
+		syncer cluster.Syncer
+		err    error
+	)
+
+	for {
+		syncer, err = s.cluster.Syncer(time.Minute)
+		if err == nil {
+			ch, err = syncer.SyncPrefix(prefix)
+			if err == nil {
+				break
+			}
+		}
+		logger.Errorf("failed to watch %s: %v", what, err)
+		select {
+		case <-time.After(10 * time.Second):
+		case <-s.done:
+			return
+		}
+	}
+	defer syncer.Close()
+
+	for {
+		select {
+		case kvs, ok := <-ch:
+			if !ok {
+				return
+			}
+			apply(kvs)
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -62,6 +62,11 @@ func (s *Server) metadataAPIEntries() []*Entry {
 			Method:  "GET",
 			Handler: s.getFilterResults,
 		},
+		{
+			Path:    FilterMetaPrefix + "/{kind}" + "/indicators",
+			Method:  "GET",
+			Handler: s.getFilterIndicators,
+		},
 	}
 }
 
@@ -116,3 +121,21 @@ func (s *Server) getFilterResults(w http.ResponseWriter, r *http.Request) {
 
 	WriteBody(w, r, k.Results)
 }
+
+// getFilterIndicators returns the names, descriptions, value types and units
+// of all indicators of the filter kind.
+func (s *Server) getFilterIndicators(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, "kind")
+
+	k := filters.GetKind(kind)
+	if k == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+
+	indicators := k.Indicators
+	if indicators == nil {
+		indicators = []*filters.Indicator{}
+	}
+	WriteBody(w, r, indicators)
+}
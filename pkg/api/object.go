@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -47,8 +48,22 @@ const (
 
 	// ObjectAPIResourcesPrefix is the prefix of object api resources.
 	ObjectAPIResourcesPrefix = "/object-api-resources"
+
+	// ApplyActionCreated means the object is created by applying.
+	ApplyActionCreated = "created"
+	// ApplyActionUpdated means the object is updated by applying.
+	ApplyActionUpdated = "updated"
+	// ApplyActionUnchanged means the object is applied without change.
+	ApplyActionUnchanged = "unchanged"
 )
 
+// ApplyResult is the result of an object in a batch apply.
+type ApplyResult struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+}
+
 func RegisterValidateHook() {}
 
 func (s *Server) objectAPIEntries() []*Entry {
@@ -68,6 +83,11 @@ func (s *Server) objectAPIEntries() []*Entry {
 			Method:  "POST",
 			Handler: s.createObject,
 		},
+		{
+			Path:    ObjectPrefix,
+			Method:  "PUT",
+			Handler: s.applyObjects,
+		},
 		{
 			Path:    ObjectPrefix,
 			Method:  "GET",
@@ -130,6 +150,40 @@ func (s *Server) readObjectSpec(w http.ResponseWriter, r *http.Request) (*superv
 	return spec, err
 }
 
+// readObjectSpecs reads the specs of a batch of objects, the body is a list
+// of object specs in JSON or YAML.
+func (s *Server) readObjectSpecs(r *http.Request) ([]*supervisor.Spec, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body failed: %v", err)
+	}
+
+	var objects []map[string]interface{}
+	if err = codectool.Unmarshal(body, &objects); err != nil {
+		return nil, fmt.Errorf("unmarshal objects failed: %v", err)
+	}
+
+	specs := make([]*supervisor.Spec, 0, len(objects))
+	names := make(map[string]struct{}, len(objects))
+	for i, object := range objects {
+		config, err := codectool.MarshalJSON(object)
+		if err != nil {
+			return nil, fmt.Errorf("marshal object %d failed: %v", i, err)
+		}
+		spec, err := s.super.CreateSpec(string(config))
+		if err != nil {
+			return nil, fmt.Errorf("object %d: %v", i, err)
+		}
+		if _, ok := names[spec.Name()]; ok {
+			return nil, fmt.Errorf("duplicated name: %s", spec.Name())
+		}
+		names[spec.Name()] = struct{}{}
+		specs = append(specs, spec)
+	}
+
+	return specs, nil
+}
+
 func (s *Server) upgradeConfigVersion(w http.ResponseWriter, r *http.Request) {
 	version := s._plusOneVersion()
 	w.Header().Set(ConfigVersionKey, fmt.Sprintf("%d", version))
@@ -166,6 +220,10 @@ func (s *Server) createObject(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if isDryRun(r) {
+		return
+	}
+
 	s._putObject(spec)
 	s.upgradeConfigVersion(w, r)
 
@@ -201,6 +259,15 @@ func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Objects in use are not deleted unless forced, as the referrers stop
+	// working without them.
+	if r.URL.Query().Get("force") != "true" {
+		if err := s._checkReferrers(name); err != nil {
+			HandleAPIError(w, r, http.StatusConflict, err)
+			return
+		}
+	}
+
 	s._deleteObject(name)
 	s.upgradeConfigVersion(w, r)
 }
@@ -211,6 +278,7 @@ func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request) {
 		s.Lock()
 		defer s.Unlock()
 
+		var names []string
 		specs := s._listObjects()
 		for _, spec := range specs {
 			if spec.Categroy() == supervisor.CategorySystemController {
@@ -226,11 +294,99 @@ func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 
-			s._deleteObject(spec.Name())
+			names = append(names, spec.Name())
+		}
+
+		version := s._applyObjects(nil, names)
+		w.Header().Set(ConfigVersionKey, fmt.Sprintf("%d", version))
+	}
+}
+
+// applyObjects creates or updates a batch of objects. All of them are
+// validated before any is saved, and the changed ones are saved in a
+// single transaction, so that a bulk apply is broadcast to the members
+// once instead of once per object.
+func (s *Server) applyObjects(w http.ResponseWriter, r *http.Request) {
+	specs, err := s.readObjectSpecs(r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	existedSpecs := make(map[string]*supervisor.Spec)
+	for _, spec := range s._listObjects() {
+		existedSpecs[spec.Name()] = spec
+	}
+
+	var changed []*supervisor.Spec
+	results := make([]*ApplyResult, 0, len(specs))
+	for _, spec := range specs {
+		if spec.Categroy() == supervisor.CategorySystemController {
+			HandleAPIError(w, r, http.StatusBadRequest,
+				fmt.Errorf("can't apply system controller object %s", spec.Name()))
+			return
+		}
+
+		result := &ApplyResult{Kind: spec.Kind(), Name: spec.Name(), Action: ApplyActionCreated}
+		operation := OperationTypeCreate
+		if existedSpec := existedSpecs[spec.Name()]; existedSpec != nil {
+			if existedSpec.Kind() != spec.Kind() {
+				HandleAPIError(w, r, http.StatusBadRequest,
+					fmt.Errorf("different kinds of %s: %s, %s",
+						spec.Name(), existedSpec.Kind(), spec.Kind()))
+				return
+			}
+			result.Action = ApplyActionUpdated
+			operation = OperationTypeUpdate
+			if sameSpec(existedSpec, spec) {
+				result.Action = ApplyActionUnchanged
+			} else if s._soakingCanary(spec.Name()) != nil {
+				HandleAPIError(w, r, http.StatusConflict,
+					fmt.Errorf("object %s has a soaking canary, promote or roll back it first", spec.Name()))
+				return
+			}
+		}
+
+		// Validate hooks.
+		for _, hook := range objectValidateHooks {
+			err := hook(operation, spec)
+			if err != nil {
+				HandleAPIError(w, r, http.StatusBadRequest,
+					fmt.Errorf("validate %s failed: %v", spec.Name(), err))
+				return
+			}
 		}
 
-		s.upgradeConfigVersion(w, r)
+		if result.Action != ApplyActionUnchanged {
+			changed = append(changed, spec)
+		}
+		results = append(results, result)
+	}
+
+	if !isDryRun(r) && len(changed) > 0 {
+		version := s._applyObjects(changed, nil)
+		w.Header().Set(ConfigVersionKey, fmt.Sprintf("%d", version))
+	}
+
+	WriteBody(w, r, results)
+}
+
+// sameSpec returns whether the two specs are the same except the creation
+// time.
+func sameSpec(s1, s2 *supervisor.Spec) bool {
+	withoutCreatedAt := func(raw map[string]interface{}) map[string]interface{} {
+		m := make(map[string]interface{}, len(raw))
+		for k, v := range raw {
+			if k != "createdAt" {
+				m[k] = v
+			}
+		}
+		return m
 	}
+	return reflect.DeepEqual(withoutCreatedAt(s1.RawSpec()), withoutCreatedAt(s2.RawSpec()))
 }
 
 // getObjectTemplate returns the template of the object in yaml format.
@@ -318,6 +474,12 @@ func (s *Server) updateObject(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s._soakingCanary(name) != nil {
+		HandleAPIError(w, r, http.StatusConflict,
+			fmt.Errorf("object %s has a soaking canary, promote or roll back it first", name))
+		return
+	}
+
 	// Validate hooks.
 	for _, hook := range objectValidateHooks {
 		err := hook(OperationTypeUpdate, spec)
@@ -327,10 +489,21 @@ func (s *Server) updateObject(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if isDryRun(r) {
+		return
+	}
+
 	s._putObject(spec)
 	s.upgradeConfigVersion(w, r)
 }
 
+// isDryRun returns whether the request only validates the object, and
+// the object is not saved.
+func isDryRun(r *http.Request) bool {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	return dryRun
+}
+
 func parseNamespaces(r *http.Request) (bool, string) {
 	allNamespaces := strings.TrimSpace(r.URL.Query().Get("all-namespaces"))
 	namespace := strings.TrimSpace(r.URL.Query().Get("namespace"))
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func (s *Server) overrideAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ObjectPrefix + "/{name}/overrides",
+			Method:  http.MethodGet,
+			Handler: s.listOverrides,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/overrides/{member}",
+			Method:  http.MethodGet,
+			Handler: s.getOverride,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/overrides/{member}",
+			Method:  http.MethodPut,
+			Handler: s.putOverride,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/overrides/{member}",
+			Method:  http.MethodDelete,
+			Handler: s.deleteOverride,
+		},
+	}
+}
+
+// listOverrides returns the overrides of the object, the key is the name
+// of the member.
+func (s *Server) listOverrides(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	prefix := s.cluster.Layout().OverrideObjectPrefix(name)
+	kvs, err := s.cluster.GetPrefix(prefix)
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	overrides := make(map[string]map[string]interface{}, len(kvs))
+	for k, v := range kvs {
+		override := map[string]interface{}{}
+		if err = codectool.UnmarshalJSON([]byte(v), &override); err != nil {
+			panic(fmt.Errorf("unmarshal override %s failed: %v", k, err))
+		}
+		overrides[strings.TrimPrefix(k, prefix)] = override
+	}
+	WriteBody(w, r, overrides)
+}
+
+func (s *Server) getOverride(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	member := chi.URLParam(r, "member")
+
+	value, err := s.cluster.Get(s.cluster.Layout().OverrideKey(name, member))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if value == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("object %s has no override on member %s", name, member))
+		return
+	}
+
+	override := map[string]interface{}{}
+	if err = codectool.UnmarshalJSON([]byte(*value), &override); err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("unmarshal override failed: %v", err))
+		return
+	}
+	WriteBody(w, r, override)
+}
+
+// putOverride sets the fields of the object overridden on the member, like
+// the listening address or the local file paths. The spec in the config
+// stays the same for all members, and the override is merged into it when
+// the member runs the object.
+func (s *Server) putOverride(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	member := chi.URLParam(r, "member")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	override := map[string]interface{}{}
+	if err = codectool.Unmarshal(body, &override); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("unmarshal override failed: %v", err))
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	existedSpec := s._getObject(name)
+	if existedSpec == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	if existedSpec.Categroy() == supervisor.CategorySystemController {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("can't override system controller object %s", name))
+		return
+	}
+	if err = supervisor.ValidateOverride(existedSpec.Kind(), override); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	config, err := codectool.MarshalJSON(supervisor.MergeOverride(existedSpec.RawSpec(), override))
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	spec, err := s.super.NewSpec(string(config))
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid overridden spec: %v", err))
+		return
+	}
+
+	// Validate hooks.
+	for _, hook := range objectValidateHooks {
+		err := hook(OperationTypeUpdate, spec)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("validate failed: %v", err))
+			return
+		}
+	}
+
+	if isDryRun(r) {
+		return
+	}
+
+	data, err := codectool.MarshalJSON(override)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err = s.cluster.Put(s.cluster.Layout().OverrideKey(name, member), string(data)); err != nil {
+		ClusterPanic(err)
+	}
+	logger.Infof("override of object %s on member %s is updated", name, member)
+}
+
+func (s *Server) deleteOverride(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	member := chi.URLParam(r, "member")
+
+	if err := s.cluster.Delete(s.cluster.Layout().OverrideKey(name, member)); err != nil {
+		ClusterPanic(err)
+	}
+	logger.Infof("override of object %s on member %s is deleted", name, member)
+}
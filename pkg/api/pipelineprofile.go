@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+const (
+	// defaultProfileDuration is the default sampling window of a pipeline
+	// profile.
+	defaultProfileDuration = 10 * time.Second
+	// maxProfileDuration is the max sampling window of a pipeline profile,
+	// the request is blocked during the window.
+	maxProfileDuration = time.Minute
+)
+
+type (
+	// PipelineProfile is the time spent in the filters of a pipeline during
+	// a sampling window.
+	PipelineProfile struct {
+		Pipeline  string    `json:"pipeline"`
+		StartedAt time.Time `json:"startedAt"`
+		Duration  string    `json:"duration"`
+		Tasks     uint64    `json:"tasks"`
+		// TaskTime is the total wall time of the tasks in nanoseconds,
+		// including the time not spent in the filters, like waiting for
+		// the concurrency limiter.
+		TaskTime time.Duration `json:"taskTime"`
+		// CPUError is the reason why the CPU time is not sampled, like
+		// another CPU profile is running.
+		CPUError string           `json:"cpuError,omitempty"`
+		Filters  []*FilterProfile `json:"filters"`
+	}
+
+	// FilterProfile is the time spent in a filter during a sampling window.
+	FilterProfile struct {
+		Name  string `json:"name"`
+		Kind  string `json:"kind"`
+		Calls uint64 `json:"calls"`
+		// WallTime is the total wall time of the calls in nanoseconds,
+		// including the time waiting for the backends.
+		WallTime time.Duration `json:"wallTime"`
+		// CPUTime is the CPU time in nanoseconds sampled while running the
+		// filter, including the goroutines started by the filter.
+		CPUTime time.Duration `json:"cpuTime"`
+	}
+
+	// pipelineProfiler is implemented by the objects supporting the
+	// profiling of the filters, like Pipeline.
+	pipelineProfiler interface {
+		Profile(ctx context.Context, duration time.Duration, cpu bool) (*PipelineProfile, error)
+	}
+)
+
+func (s *Server) pipelineProfileAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ObjectPrefix + "/{name}/profile",
+			Method:  http.MethodGet,
+			Handler: s.profilePipeline,
+		},
+	}
+}
+
+// Folded returns the profile in the folded stack format, which is
+// accepted by the flame graph tools like flamegraph.pl and speedscope. The
+// values are the CPU time if cpu is true, otherwise the wall time, in
+// microseconds.
+func (p *PipelineProfile) Folded(cpu bool) string {
+	var sb strings.Builder
+	var total time.Duration
+
+	for _, f := range p.Filters {
+		d := f.WallTime
+		if cpu {
+			d = f.CPUTime
+		}
+		total += d
+		if us := d.Microseconds(); us > 0 {
+			fmt.Fprintf(&sb, "%s;%s(%s) %d\n", p.Pipeline, f.Name, f.Kind, us)
+		}
+	}
+
+	// the wall time of the tasks not spent in the filters.
+	if !cpu && p.TaskTime > total {
+		fmt.Fprintf(&sb, "%s %d\n", p.Pipeline, (p.TaskTime - total).Microseconds())
+	}
+	return sb.String()
+}
+
+// SortFilters sorts the filters by the time spent in them, the most
+// expensive first.
+func (p *PipelineProfile) SortFilters(cpu bool) {
+	sort.SliceStable(p.Filters, func(i, j int) bool {
+		if cpu && p.Filters[i].CPUTime != p.Filters[j].CPUTime {
+			return p.Filters[i].CPUTime > p.Filters[j].CPUTime
+		}
+		return p.Filters[i].WallTime > p.Filters[j].WallTime
+	})
+}
+
+// profilePipeline profiles the filters of a pipeline for a sampling window,
+// and returns the profile in JSON, or in the folded stack format if the
+// format is folded.
+func (s *Server) profilePipeline(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	_, namespace := parseNamespaces(r)
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	query := r.URL.Query()
+	duration := defaultProfileDuration
+	if v := query.Get("duration"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxProfileDuration {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid duration %s, it must be in (0, %s]", v, maxProfileDuration))
+			return
+		}
+		duration = d
+	}
+
+	cpu := true
+	if v := query.Get("cpu"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid cpu %s", v))
+			return
+		}
+		cpu = b
+	}
+
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "folded" {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid format %s, it must be json or folded", format))
+		return
+	}
+	value := query.Get("value")
+	if value != "" && value != "wall" && value != "cpu" {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid value %s, it must be wall or cpu", value))
+		return
+	}
+
+	tc := getTrafficController(s.super)
+	if tc == nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("traffic controller not found"))
+		return
+	}
+	entity, exists := tc.GetPipeline(namespace, name)
+	if !exists {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("pipeline %s not found in namespace %s", name, namespace))
+		return
+	}
+	profiler, ok := entity.Instance().(pipelineProfiler)
+	if !ok {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s does not support profiling", name))
+		return
+	}
+
+	logger.Infof("profile pipeline %s in namespace %s for %s", name, namespace, duration)
+	profile, err := profiler.Profile(r.Context(), duration, cpu)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusConflict, err)
+		return
+	}
+
+	byCPU := value == "cpu"
+	profile.SortFilters(byCPU)
+	if format != "folded" {
+		WriteBody(w, r, profile)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(profile.Folded(byCPU)))
+}
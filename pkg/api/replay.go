@@ -0,0 +1,229 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/tracing"
+)
+
+const (
+	// defaultReplayRate is the default number of tasks replayed per second.
+	defaultReplayRate = 10
+	// maxReplayRate is the max number of tasks replayed per second.
+	maxReplayRate = 10000
+)
+
+type (
+	// replayTask is a task to replay, it has the same format as the dead
+	// letters of the pipeline, and only the request is used.
+	replayTask struct {
+		Request *replayRequest `json:"request"`
+	}
+
+	replayRequest struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header,omitempty"`
+		Body   []byte      `json:"body,omitempty"`
+	}
+
+	// ReplayResult is the result of replaying tasks to a pipeline.
+	ReplayResult struct {
+		Total     int `json:"total"`
+		Replayed  int `json:"replayed"`
+		Succeeded int `json:"succeeded"`
+		Failed    int `json:"failed"`
+		// Failures are the tasks failed again, the index is the position of
+		// the task in the request body, starting from 0.
+		Failures []*ReplayFailure `json:"failures,omitempty"`
+	}
+
+	// ReplayFailure is a task failed in replaying.
+	ReplayFailure struct {
+		Index      int    `json:"index"`
+		Result     string `json:"result,omitempty"`
+		StatusCode int    `json:"statusCode,omitempty"`
+		Error      string `json:"error,omitempty"`
+	}
+)
+
+func (s *Server) replayAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ObjectPrefix + "/{name}/replay",
+			Method:  "POST",
+			Handler: s.replayTasks,
+		},
+	}
+}
+
+// decodeReplayTasks decodes the tasks from a JSON array, or JSON documents
+// separated by whitespaces, which is the format of the dead letter file.
+func decodeReplayTasks(r io.Reader) ([]*replayTask, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	body = bytes.TrimSpace(body)
+
+	var tasks []*replayTask
+	if len(body) > 0 && body[0] == '[' {
+		if err := json.Unmarshal(body, &tasks); err != nil {
+			return nil, err
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		for {
+			task := &replayTask{}
+			err := decoder.Decode(task)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("task %d: %v", len(tasks), err)
+			}
+			tasks = append(tasks, task)
+		}
+	}
+
+	for i, task := range tasks {
+		if task == nil || task.Request == nil {
+			return nil, fmt.Errorf("task %d: no request", i)
+		}
+	}
+	return tasks, nil
+}
+
+func parseReplayRate(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("rate")
+	if v == "" {
+		return defaultReplayRate, nil
+	}
+	rate, err := strconv.Atoi(v)
+	if err != nil || rate <= 0 || rate > maxReplayRate {
+		return 0, fmt.Errorf("invalid rate %s, it must be in [1, %d]", v, maxReplayRate)
+	}
+	return rate, nil
+}
+
+// replay replays a task to the pipeline, it returns nil if the task
+// succeeds.
+func replay(handler context.Handler, task *replayTask) *ReplayFailure {
+	stdr, err := http.NewRequest(task.Request.Method, task.Request.URL, bytes.NewReader(task.Request.Body))
+	if err != nil {
+		return &ReplayFailure{Error: err.Error()}
+	}
+	for k, v := range task.Request.Header {
+		stdr.Header[k] = v
+	}
+
+	// httpprot.NewRequest never returns an error.
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+
+	ctx := context.New(tracing.NoopSpan)
+	defer ctx.Finish()
+	ctx.SetRequest(context.DefaultNamespace, req)
+
+	result := handler.Handle(ctx)
+	statusCode := 0
+	if resp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response); ok {
+		statusCode = resp.StatusCode()
+	}
+	if result != "" || statusCode >= http.StatusInternalServerError {
+		return &ReplayFailure{Result: result, StatusCode: statusCode}
+	}
+	return nil
+}
+
+// replayTasks re-injects the tasks, usually the dead letters, into the
+// pipeline at the specified rate. The tasks are replayed one by one, so a
+// slow pipeline also slows down the replay.
+func (s *Server) replayTasks(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	_, namespace := parseNamespaces(r)
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	rate, err := parseReplayRate(r)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	tc := getTrafficController(s.super)
+	if tc == nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("traffic controller not found"))
+		return
+	}
+	entity, exists := tc.GetPipeline(namespace, name)
+	if !exists {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("pipeline %s not found in namespace %s", name, namespace))
+		return
+	}
+	handler, ok := entity.Instance().(context.Handler)
+	if !ok {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s is not a pipeline", name))
+		return
+	}
+
+	tasks, err := decodeReplayTasks(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("decode tasks failed: %v", err))
+		return
+	}
+
+	result := &ReplayResult{Total: len(tasks)}
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	defer ticker.Stop()
+
+	for i, task := range tasks {
+		if i > 0 {
+			select {
+			case <-ticker.C:
+			case <-r.Context().Done():
+				// the client is gone, stop replaying the remaining tasks.
+				return
+			}
+		}
+
+		result.Replayed++
+		if f := replay(handler, task); f != nil {
+			f.Index = i
+			result.Failed++
+			result.Failures = append(result.Failures, f)
+		} else {
+			result.Succeeded++
+		}
+	}
+
+	WriteBody(w, r, result)
+}
@@ -44,6 +44,7 @@ type (
 		super   *supervisor.Supervisor
 		cds     *customdata.Store
 		profile pprof.Profile
+		done    chan struct{}
 
 		mutex      cluster.Mutex
 		mutexMutex sync.Mutex
@@ -70,6 +71,7 @@ func MustNewServer(opt *option.Options, cls cluster.Cluster, super *supervisor.S
 		cluster: cls,
 		super:   super,
 		profile: profile,
+		done:    make(chan struct{}),
 	}
 	s.router = newDynamicMux(s)
 	s.server = http.Server{Addr: opt.APIAddr, Handler: s.router}
@@ -99,6 +101,11 @@ func MustNewServer(opt *option.Options, cls cluster.Cluster, super *supervisor.S
 	s.cds = customdata.NewStore(cls, kindPrefix, dataPrefix)
 
 	s.registerAPIs()
+	go s.watchLogLevels()
+	go s.watchMaintenances()
+	go s.watchFeatureFlags()
+	go s.watchTemplates()
+	go s.runCanaries()
 
 	go func() {
 		var err error
@@ -121,6 +128,8 @@ func MustNewServer(opt *option.Options, cls cluster.Cluster, super *supervisor.S
 func (s *Server) Close(wg *sync.WaitGroup) {
 	defer wg.Done()
 
+	close(s.done)
+
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
@@ -133,6 +142,19 @@ func (s *Server) Close(wg *sync.WaitGroup) {
 	logger.Infof("server stopped")
 }
 
+// ReloadOptions applies the options reloaded at runtime, the log levels are
+// recalculated on the new default level and the basic auth is replaced.
+func (s *Server) ReloadOptions() {
+	value, err := s.cluster.Get(s.cluster.Layout().ConfigLogLevels())
+	if err != nil {
+		logger.Errorf("get log levels failed: %v", err)
+	} else {
+		s.applyLogLevels(value)
+	}
+
+	s.router.reloadAPIs()
+}
+
 func (s *Server) getMutex() (cluster.Mutex, error) {
 	s.mutexMutex.Lock()
 	defer s.mutexMutex.Unlock()
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/util/session"
+)
+
+type (
+	// sessionManagerGetter is implemented by the filters managing server
+	// side sessions, like OIDCAdaptor and SAMLAdaptor.
+	sessionManagerGetter interface {
+		SessionManager() *session.Manager
+	}
+
+	// DeleteSessionsResponse is the response of deleting sessions.
+	DeleteSessionsResponse struct {
+		Deleted int `json:"deleted"`
+	}
+)
+
+func (s *Server) sessionAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ObjectPrefix + "/{name}/filters/{filter}/sessions",
+			Method:  http.MethodDelete,
+			Handler: s.deleteSubjectSessions,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/filters/{filter}/sessions/{id}",
+			Method:  http.MethodDelete,
+			Handler: s.deleteSession,
+		},
+	}
+}
+
+func (s *Server) getSessionManager(w http.ResponseWriter, r *http.Request) *session.Manager {
+	filter := s.getPipelineFilter(w, r)
+	if filter == nil {
+		return nil
+	}
+	getter, ok := filter.(sessionManagerGetter)
+	if !ok || getter.SessionManager() == nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("filter %s does not manage sessions", filter.Name()))
+		return nil
+	}
+	return getter.SessionManager()
+}
+
+// deleteSubjectSessions deletes all sessions of the subject in the query.
+func (s *Server) deleteSubjectSessions(w http.ResponseWriter, r *http.Request) {
+	subject := r.URL.Query().Get("subject")
+	if subject == "" {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("subject is required"))
+		return
+	}
+
+	m := s.getSessionManager(w, r)
+	if m == nil {
+		return
+	}
+	n, err := m.DeleteSubject(subject)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("delete sessions of %s failed: %v", subject, err))
+		return
+	}
+	WriteBody(w, r, &DeleteSessionsResponse{Deleted: n})
+}
+
+func (s *Server) deleteSession(w http.ResponseWriter, r *http.Request) {
+	m := s.getSessionManager(w, r)
+	if m == nil {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	if err := m.Delete(id); err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("delete session failed: %v", err))
+	}
+}
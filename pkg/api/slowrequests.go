@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// slowRequestsKeeper is implemented by the traffic gates capturing the slow
+// requests, like HTTPServer.
+type slowRequestsKeeper interface {
+	SlowRequests() interface{}
+	ClearSlowRequests()
+}
+
+func (s *Server) slowRequestsAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ObjectPrefix + "/{name}/slowrequests",
+			Method:  http.MethodGet,
+			Handler: s.getSlowRequests,
+		},
+		{
+			Path:    ObjectPrefix + "/{name}/slowrequests",
+			Method:  http.MethodDelete,
+			Handler: s.clearSlowRequests,
+		},
+	}
+}
+
+func (s *Server) getSlowRequestsKeeper(w http.ResponseWriter, r *http.Request) slowRequestsKeeper {
+	name := chi.URLParam(r, "name")
+	_, namespace := parseNamespaces(r)
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	tc := getTrafficController(s.super)
+	if tc == nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("traffic controller not found"))
+		return nil
+	}
+	entity, exists := tc.GetTrafficGate(namespace, name)
+	if !exists {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("traffic gate %s not found in namespace %s", name, namespace))
+		return nil
+	}
+	keeper, ok := entity.Instance().(slowRequestsKeeper)
+	if !ok {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s does not capture slow requests", name))
+		return nil
+	}
+	return keeper
+}
+
+// getSlowRequests returns the slow requests captured by the traffic gate,
+// the most recent first.
+func (s *Server) getSlowRequests(w http.ResponseWriter, r *http.Request) {
+	keeper := s.getSlowRequestsKeeper(w, r)
+	if keeper == nil {
+		return
+	}
+	WriteBody(w, r, keeper.SlowRequests())
+}
+
+func (s *Server) clearSlowRequests(w http.ResponseWriter, r *http.Request) {
+	keeper := s.getSlowRequestsKeeper(w, r)
+	if keeper == nil {
+		return
+	}
+	keeper.ClearSlowRequests()
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"nhooyr.io/websocket"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const (
+	// defaultTapDuration is the default duration of a tap.
+	defaultTapDuration = time.Minute
+	// maxTapDuration is the max duration of a tap, the tap expires
+	// automatically, so a forgotten tap does not slow down the pipeline.
+	maxTapDuration = 10 * time.Minute
+	// defaultTapMaxBodySize is the default max size of the captured bodies.
+	defaultTapMaxBodySize = 1024
+	// maxTapMaxBodySize is the max size of the captured bodies.
+	maxTapMaxBodySize = 64 * 1024
+)
+
+type (
+	// TapSpec is the spec of a tap on a pipeline.
+	TapSpec struct {
+		// Duration is the duration of the tap.
+		Duration time.Duration
+		// SampleRate is the fraction of the requests captured, in (0, 1].
+		SampleRate float64
+		// MaxBodySize is the max size of the captured request and response
+		// bodies, the bodies are truncated beyond it, and 0 disables
+		// capturing the bodies.
+		MaxBodySize int
+		// RedactHeaders are the headers whose values are redacted, in
+		// addition to the credentials like Authorization and Cookie.
+		RedactHeaders []string
+		// RedactPatterns are the regular expressions of the text redacted
+		// from the URLs and the bodies.
+		RedactPatterns []string
+	}
+
+	// tapper is implemented by the objects supporting the traffic tap, like
+	// Pipeline. The channel is closed when the tap expires.
+	tapper interface {
+		Tap(spec *TapSpec) (<-chan interface{}, func(), error)
+	}
+)
+
+func (s *Server) tapAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    ObjectPrefix + "/{name}/tap",
+			Method:  http.MethodGet,
+			Handler: s.tap,
+		},
+	}
+}
+
+// parseTapSpec parses the spec of a tap from the queries.
+func parseTapSpec(query url.Values) (*TapSpec, error) {
+	spec := &TapSpec{
+		Duration:    defaultTapDuration,
+		SampleRate:  1,
+		MaxBodySize: defaultTapMaxBodySize,
+	}
+
+	if v := query.Get("duration"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxTapDuration {
+			return nil, fmt.Errorf("invalid duration %s, it must be in (0, %s]", v, maxTapDuration)
+		}
+		spec.Duration = d
+	}
+
+	if v := query.Get("sampleRate"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid sampleRate %s, it must be in (0, 1]", v)
+		}
+		spec.SampleRate = rate
+	}
+
+	if v := query.Get("maxBodySize"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 0 || size > maxTapMaxBodySize {
+			return nil, fmt.Errorf("invalid maxBodySize %s, it must be in [0, %d]", v, maxTapMaxBodySize)
+		}
+		spec.MaxBodySize = size
+	}
+
+	for _, v := range query["redactHeader"] {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				spec.RedactHeaders = append(spec.RedactHeaders, h)
+			}
+		}
+	}
+	spec.RedactPatterns = query["redactPattern"]
+
+	return spec, nil
+}
+
+// tap streams the summaries of the requests handled by the pipeline over
+// WebSocket, one JSON message per request, until the tap expires or the
+// client disconnects.
+func (s *Server) tap(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	_, namespace := parseNamespaces(r)
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	spec, err := parseTapSpec(r.URL.Query())
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	tc := getTrafficController(s.super)
+	if tc == nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("traffic controller not found"))
+		return
+	}
+	entity, exists := tc.GetPipeline(namespace, name)
+	if !exists {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("pipeline %s not found in namespace %s", name, namespace))
+		return
+	}
+	t, ok := entity.Instance().(tapper)
+	if !ok {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("%s does not support tap", name))
+		return
+	}
+
+	records, cancel, err := t.Tap(spec)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	defer cancel()
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		// Accept has written the error response.
+		logger.Errorf("tap pipeline %s: accept websocket failed: %v", name, err)
+		return
+	}
+	defer conn.Close(websocket.StatusInternalError, "")
+
+	logger.Infof("tap pipeline %s in namespace %s started for %s", name, namespace, spec.Duration)
+
+	// the messages from the client are discarded, and ctx is done when the
+	// client closes the connection.
+	ctx := conn.CloseRead(r.Context())
+	for {
+		select {
+		case record, ok := <-records:
+			if !ok {
+				conn.Close(websocket.StatusNormalClosure, "tap expired")
+				return
+			}
+			err := conn.Write(ctx, websocket.MessageText, codectool.MustMarshalJSON(record))
+			if err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
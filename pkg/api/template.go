@@ -0,0 +1,219 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/inlinetemplate"
+)
+
+// TemplatePrefix is the prefix of the shared template APIs.
+const TemplatePrefix = "/templates"
+
+// SharedTemplate is an inline template shared by all members, the filters
+// and the objects refer to it by name, like the bodies of Mock.
+type SharedTemplate struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Text        string    `json:"text"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+func (s *Server) templateAPIEntries() []*Entry {
+	return []*Entry{
+		{
+			Path:    TemplatePrefix,
+			Method:  http.MethodGet,
+			Handler: s.listTemplates,
+		},
+		{
+			Path:    TemplatePrefix + "/{name}",
+			Method:  http.MethodGet,
+			Handler: s.getTemplate,
+		},
+		{
+			Path:    TemplatePrefix + "/{name}",
+			Method:  http.MethodPut,
+			Handler: s.putTemplate,
+		},
+		{
+			Path:    TemplatePrefix + "/{name}",
+			Method:  http.MethodDelete,
+			Handler: s.deleteTemplate,
+		},
+	}
+}
+
+func (s *Server) listTemplates(w http.ResponseWriter, r *http.Request) {
+	kvs, err := s.cluster.GetPrefix(s.cluster.Layout().TemplatePrefix())
+	if err != nil {
+		ClusterPanic(err)
+	}
+
+	templates := make([]*SharedTemplate, 0, len(kvs))
+	for k, v := range kvs {
+		t := &SharedTemplate{}
+		if err = codectool.UnmarshalJSON([]byte(v), t); err != nil {
+			panic(fmt.Errorf("unmarshal template %s failed: %v", k, err))
+		}
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	WriteBody(w, r, templates)
+}
+
+func (s *Server) getTemplate(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	value, err := s.cluster.Get(s.cluster.Layout().TemplateKey(name))
+	if err != nil {
+		ClusterPanic(err)
+	}
+	if value == nil {
+		HandleAPIError(w, r, http.StatusNotFound, fmt.Errorf("template %s not found", name))
+		return
+	}
+
+	t := &SharedTemplate{}
+	if err = codectool.UnmarshalJSON([]byte(*value), t); err != nil {
+		HandleAPIError(w, r, http.StatusInternalServerError, fmt.Errorf("unmarshal template failed: %v", err))
+		return
+	}
+	WriteBody(w, r, t)
+}
+
+// putTemplate creates or updates the shared template, it is applied to this
+// member at once and to other members by watching.
+func (s *Server) putTemplate(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("read body failed: %v", err))
+		return
+	}
+	t := &SharedTemplate{}
+	if err = codectool.Unmarshal(body, t); err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("unmarshal template failed: %v", err))
+		return
+	}
+	if t.Name != "" && t.Name != name {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("inconsistent name in url and template"))
+		return
+	}
+	tmpl, err := inlinetemplate.Parse(t.Text)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, fmt.Errorf("invalid template: %v", err))
+		return
+	}
+	t.Name = name
+	t.UpdatedAt = time.Now().UTC()
+
+	data, err := codectool.MarshalJSON(t)
+	if err != nil {
+		HandleAPIError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err = s.cluster.Put(s.cluster.Layout().TemplateKey(name), string(data)); err != nil {
+		ClusterPanic(err)
+	}
+
+	inlinetemplate.SetShared(name, tmpl)
+	logger.Infof("template %s is updated", name)
+}
+
+func (s *Server) deleteTemplate(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	s.Lock()
+	defer s.Unlock()
+
+	// like the objects, the templates in use are not deleted unless forced,
+	// as the referrers fail to render without them.
+	if r.URL.Query().Get("force") != "true" {
+		if referrers := s._templateReferrers(name); len(referrers) > 0 {
+			HandleAPIError(w, r, http.StatusConflict, fmt.Errorf("template %s is referenced by %s, delete them first or use force=true",
+				name, strings.Join(referrers, ", ")))
+			return
+		}
+	}
+
+	if err := s.cluster.Delete(s.cluster.Layout().TemplateKey(name)); err != nil {
+		ClusterPanic(err)
+	}
+
+	inlinetemplate.DeleteShared(name)
+	logger.Infof("template %s is deleted", name)
+}
+
+// _templateReferrers returns the sorted names of the objects referencing
+// the shared template.
+func (s *Server) _templateReferrers(name string) []string {
+	var referrers []string
+	for _, spec := range s._listObjects() {
+		for _, ref := range spec.TemplateReferences() {
+			if ref == name {
+				referrers = append(referrers, spec.Name())
+				break
+			}
+		}
+	}
+	sort.Strings(referrers)
+	return referrers
+}
+
+// applyTemplates replaces the shared templates of this member with the ones
+// in the cluster.
+func (s *Server) applyTemplates(kvs map[string]string) {
+	prefix := s.cluster.Layout().TemplatePrefix()
+
+	templates := make(map[string]*inlinetemplate.Template, len(kvs))
+	for k, v := range kvs {
+		name := strings.TrimPrefix(k, prefix)
+		t := &SharedTemplate{}
+		if err := codectool.UnmarshalJSON([]byte(v), t); err != nil {
+			logger.Errorf("unmarshal template %s failed: %v", name, err)
+			continue
+		}
+		tmpl, err := inlinetemplate.Parse(t.Text)
+		if err != nil {
+			logger.Errorf("parse template %s failed: %v", name, err)
+			continue
+		}
+		templates[name] = tmpl
+	}
+
+	inlinetemplate.ReplaceShared(templates)
+}
+
+// watchTemplates applies the shared templates when they are changed.
+func (s *Server) watchTemplates() {
+	s.watchPrefix("templates", s.cluster.Layout().TemplatePrefix(), s.applyTemplates)
+}
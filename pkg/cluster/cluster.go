@@ -57,6 +57,10 @@ const (
 	minTTL = 5 // grant a new lease if the lease ttl is less than minTTL
 )
 
+// clusterLogger is the logger of module cluster, so the log level of the
+// cluster could be changed separately.
+var clusterLogger = logger.Module("cluster")
+
 type (
 	// MemberStatus is the member status.
 	MemberStatus struct {
@@ -189,13 +193,13 @@ func (c *cluster) run() {
 	// NOTE: Try to be ready in first time synchronously.
 	// If it got failed, try it asynchronously.
 	if err := tryReady(); err != nil {
-		logger.Errorf("start cluster failed (%d retries): %v", tryTimes, err)
+		clusterLogger.Errorf("start cluster failed (%d retries): %v", tryTimes, err)
 
 		for {
 			time.Sleep(HeartbeatInterval)
 			err := tryReady()
 			if err != nil {
-				logger.Errorf("failed start many times(%d), "+
+				clusterLogger.Errorf("failed start many times(%d), "+
 					"start others if they're not online, "+
 					"otherwise purge this member, clean data directory "+
 					"and rejoin it back.", tryTimes)
@@ -205,7 +209,7 @@ func (c *cluster) run() {
 		}
 	}
 
-	logger.Infof("cluster is ready")
+	clusterLogger.Infof("cluster is ready")
 
 	if c.opt.ClusterRole == "primary" {
 		go c.defrag()
@@ -249,7 +253,7 @@ func (c *cluster) getReady() error {
 		}
 	case <-timeout:
 		err := fmt.Errorf("start server timeout(%v)", waitServerTimeout)
-		logger.Errorf("%v", err)
+		clusterLogger.Errorf("%v", err)
 		panic(err)
 	}
 
@@ -277,7 +281,7 @@ func (c *cluster) checkClusterName() error {
 		if c.opt.ClusterName != *value {
 			err := fmt.Errorf("cluster names mismatch, local(%s) != existed(%s)",
 				c.opt.ClusterName, *value)
-			logger.Errorf("%v", err)
+			clusterLogger.Errorf("%v", err)
 			panic(err)
 		}
 	} else if c.opt.UseStandaloneEtcd {
@@ -311,7 +315,7 @@ func (c *cluster) getClient() (*clientv3.Client, error) {
 	}
 
 	endpoints := c.opt.GetPeerURLs()
-	logger.Infof("client connect with endpoints: %v", endpoints)
+	clusterLogger.Infof("client connect with endpoints: %v", endpoints)
 	client, err := clientv3.New(clientv3.Config{
 		Endpoints:            endpoints,
 		AutoSyncInterval:     autoSyncInterval,
@@ -325,7 +329,7 @@ func (c *cluster) getClient() (*clientv3.Client, error) {
 		return nil, fmt.Errorf("create client failed: %v", err)
 	}
 
-	logger.Infof("client is ready")
+	clusterLogger.Infof("client is ready")
 
 	c.client = client
 
@@ -342,7 +346,7 @@ func (c *cluster) closeClient() {
 
 	err := c.client.Close()
 	if err != nil {
-		logger.Errorf("close client failed: %v", err)
+		clusterLogger.Errorf("close client failed: %v", err)
 	}
 
 	c.client = nil
@@ -363,7 +367,7 @@ func (c *cluster) keepAliveLease() {
 	handleFailed := func() {
 		err := c.grantNewLease()
 		if err != nil {
-			logger.Errorf("grant new lease failed: %v", err)
+			clusterLogger.Errorf("grant new lease failed: %v", err)
 		}
 	}
 
@@ -374,13 +378,13 @@ func (c *cluster) keepAliveLease() {
 		case <-time.After(c.requestTimeout):
 			client, err := c.getClient()
 			if err != nil {
-				logger.Errorf("get client failed: %v", err)
+				clusterLogger.Errorf("get client failed: %v", err)
 				continue
 			}
 
 			leaseID, err := c.getLease()
 			if err != nil {
-				logger.Errorf("get lease failed: %v", err)
+				clusterLogger.Errorf("get lease failed: %v", err)
 				handleFailed()
 				continue
 			}
@@ -391,7 +395,7 @@ func (c *cluster) keepAliveLease() {
 				return client.Lease.KeepAliveOnce(ctx, leaseID)
 			}()
 			if err != nil {
-				logger.Errorf("keep alive for lease %x failed: %v", leaseID, err)
+				clusterLogger.Errorf("keep alive for lease %x failed: %v", leaseID, err)
 				handleFailed()
 				continue
 			}
@@ -409,7 +413,7 @@ func (c *cluster) initLease() error {
 	if leaseStr != nil {
 		leaseID, err = strToLease(*leaseStr)
 		if err != nil {
-			logger.Errorf("BUG: parse lease %s failed: %v", *leaseStr, err)
+			clusterLogger.Errorf("BUG: parse lease %s failed: %v", *leaseStr, err)
 			return err
 		}
 	}
@@ -430,7 +434,7 @@ func (c *cluster) initLease() error {
 		}
 		// NOTE: Use existed lease.
 		c.lease = leaseID
-		logger.Infof("lease is ready(use existed one: %x)", *c.lease)
+		clusterLogger.Infof("lease is ready(use existed one: %x)", *c.lease)
 		return nil
 
 	}
@@ -477,7 +481,7 @@ func (c *cluster) grantNewLease() error {
 	lease := respGrant.ID
 	c.lease = &lease
 
-	logger.Infof("lease is ready (grant new one: %x)", *c.lease)
+	clusterLogger.Infof("lease is ready (grant new one: %x)", *c.lease)
 
 	return nil
 }
@@ -517,7 +521,7 @@ func (c *cluster) getSession() (*concurrency.Session, error) {
 
 	c.session = session
 
-	logger.Infof("session is ready")
+	clusterLogger.Infof("session is ready")
 
 	return session, nil
 }
@@ -532,7 +536,7 @@ func (c *cluster) closeSession() {
 
 	err := c.session.Close()
 	if err != nil {
-		logger.Errorf("close session failed: %v", err)
+		clusterLogger.Errorf("close session failed: %v", err)
 	}
 
 	c.session = nil
@@ -564,7 +568,7 @@ func closeEtcdServer(s *embed.Etcd) {
 				peer.Close()
 			}
 		}
-		logger.Infof("hard stop server")
+		clusterLogger.Infof("hard stop server")
 	}
 }
 
@@ -592,7 +596,7 @@ func (c *cluster) startServer() (done, timeout chan struct{}, err error) {
 		select {
 		case err, ok := <-s.Err():
 			if ok {
-				logger.Errorf("etcd server %s serve failed: %v",
+				clusterLogger.Errorf("etcd server %s serve failed: %v",
 					c.server.Config().Name, err)
 				closeEtcdServer(s)
 			}
@@ -612,12 +616,12 @@ func (c *cluster) startServer() (done, timeout chan struct{}, err error) {
 				if err != nil {
 					err = fmt.Errorf("register cluster name %s failed: %v",
 						c.opt.ClusterName, err)
-					logger.Errorf("%v", err)
+					clusterLogger.Errorf("%v", err)
 					panic(err)
 				}
 			}
 			go monitorServer(c.server)
-			logger.Infof("server is ready")
+			clusterLogger.Infof("server is ready")
 			close(done)
 		case <-time.After(waitServerTimeout):
 			closeEtcdServer(server)
@@ -655,7 +659,7 @@ func (c *cluster) heartbeat() {
 		case <-time.After(HeartbeatInterval):
 			err := c.syncStatus()
 			if err != nil {
-				logger.Errorf("sync status failed: %v", err)
+				clusterLogger.Errorf("sync status failed: %v", err)
 			}
 		case <-c.done:
 			return
@@ -666,12 +670,12 @@ func (c *cluster) heartbeat() {
 func (c *cluster) runDefrag() time.Duration {
 	client, err := c.getClient()
 	if err != nil {
-		logger.Errorf("defrag failed: get client failed: %v", err)
+		clusterLogger.Errorf("defrag failed: get client failed: %v", err)
 		return defragFailedInterval
 	}
 	defragmentURL, err := c.opt.GetFirstAdvertiseClientURL()
 	if err != nil {
-		logger.Errorf("defrag failed: %v", err)
+		clusterLogger.Errorf("defrag failed: %v", err)
 		return defragNormalInterval // url is wrong
 	}
 	// NOTICE: It needs longer time than normal ones.
@@ -681,11 +685,11 @@ func (c *cluster) runDefrag() time.Duration {
 		return client.Defragment(ctx, defragmentURL)
 	}()
 	if err != nil {
-		logger.Errorf("defrag failed: %v", err)
+		clusterLogger.Errorf("defrag failed: %v", err)
 		return defragFailedInterval
 	}
 
-	logger.Infof("defrag successfully")
+	clusterLogger.Infof("defrag successfully")
 	return defragNormalInterval
 }
 
@@ -703,7 +707,7 @@ func (c *cluster) defrag() {
 
 func (c *cluster) syncStatus() error {
 	status := MemberStatus{
-		Options: *c.opt,
+		Options: c.opt.Snapshot(),
 	}
 
 	if c.opt.ClusterRole == "primary" {
@@ -21,8 +21,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/megaease/easegress/v2/pkg/logger"
-
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/concurrency"
@@ -48,6 +46,10 @@ type (
 
 		PutUnderTimeout(key, value string, timeout time.Duration) error
 
+		// GrantLease grants a lease expiring after ttl, the keys put
+		// with it, e.g. in an STM, are deleted when it expires.
+		GrantLease(ttl time.Duration) (clientv3.LeaseID, error)
+
 		Delete(key string) error
 		DeletePrefix(prefix string) error
 
@@ -122,7 +124,7 @@ func getOpOption(op ClientOp) clientv3.OpOption {
 	case OpKeysOnly:
 		return clientv3.WithKeysOnly()
 	default:
-		logger.Errorf("unsupported client operation: %v", op)
+		clusterLogger.Errorf("unsupported client operation: %v", op)
 		return nil
 	}
 }
@@ -39,6 +39,7 @@ type MockedCluster struct {
 	MockedGetWithOp              func(key string, ops ...cluster.ClientOp) (map[string]string, error)
 	MockedPut                    func(key, value string) error
 	MockedPutUnderTimeout        func(key, value string, timeout time.Duration) error
+	MockedGrantLease             func(ttl time.Duration) (clientv3.LeaseID, error)
 	MockedPutUnderLease          func(key, value string) error
 	MockedPutAndDelete           func(map[string]*string) error
 	MockedPutAndDeleteUnderLease func(map[string]*string) error
@@ -133,6 +134,14 @@ func (mc *MockedCluster) PutUnderTimeout(key, value string, timeout time.Duratio
 	return nil
 }
 
+// GrantLease implements interface function GrantLease
+func (mc *MockedCluster) GrantLease(ttl time.Duration) (clientv3.LeaseID, error) {
+	if mc.MockedGrantLease != nil {
+		return mc.MockedGrantLease(ttl)
+	}
+	return 0, nil
+}
+
 // PutUnderLease implements interface function PutUnderLease
 func (mc *MockedCluster) PutUnderLease(key, value string) error {
 	if mc.MockedPutUnderLease != nil {
@@ -24,7 +24,6 @@ import (
 	"go.etcd.io/etcd/server/v3/embed"
 
 	"github.com/megaease/easegress/v2/pkg/common"
-	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/option"
 )
 
@@ -107,7 +106,7 @@ func CreateStaticClusterEtcdConfig(opt *option.Options) (*embed.Config, error) {
 	}
 	ec.InitialCluster = opt.InitialClusterToString()
 
-	logger.Infof("etcd config: advertise-client-urls: %+v advertise-peer-urls: %+v init-cluster: %s cluster-state: %s force-new-cluster: %v",
+	clusterLogger.Infof("etcd config: advertise-client-urls: %+v advertise-peer-urls: %+v init-cluster: %s cluster-state: %s force-new-cluster: %v",
 		ec.AdvertiseClientUrls, ec.AdvertisePeerUrls,
 		ec.InitialCluster, ec.ClusterState, ec.ForceNewCluster)
 
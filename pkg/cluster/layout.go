@@ -40,10 +40,28 @@ const (
 	configObjectPrefix        = "/config/objects/"
 	configObjectFormat        = "/config/objects/%s" // +objectName
 	configVersion             = "/config/version"
+	configLogLevels           = "/config/log-levels"
 	wasmCodeEvent             = "/wasm/code"
 	wasmDataPrefixFormat      = "/wasm/data/%s/%s/" // + pipelineName + filterName
 	customDataKindPrefix      = "/custom-data-kinds/"
 	customDataPrefix          = "/custom-data/"
+	schedulerFireFormat       = "/scheduler/%s/fire"          // +objectName
+	sessionTicketKeysFormat   = "/tls/%s/session-ticket-keys" // +objectName
+	usageCheckpointFormat     = "/usage/%s/%s"                // +objectName +memberName
+	quotaCounterFormat        = "/quota/%s/%s/%s/%s"          // +pipelineName +filterName +window +consumer
+	tokenIssuerKeysFormat     = "/token-issuer/%s/%s/keys"    // +pipelineName +filterName
+	maintenancePrefix         = "/maintenance/"
+	maintenanceFormat         = "/maintenance/%s" // +pipelineName
+	canaryPrefix              = "/canary/objects/"
+	canaryFormat              = "/canary/objects/%s" // +objectName
+	overridePrefix            = "/overrides/objects/"
+	overrideObjectPrefix      = "/overrides/objects/%s/"   // +objectName
+	overrideFormat            = "/overrides/objects/%s/%s" // +objectName +memberName
+	featureFlagPrefix         = "/feature-flags/"
+	featureFlagFormat         = "/feature-flags/%s" // +flagName
+	templatePrefix            = "/templates/"
+	templateFormat            = "/templates/%s" // +templateName
+	authCacheSecret           = "/authcache/secret"
 
 	// the cluster name of this eg group will be registered under this path in etcd
 	// any new member(primary or secondary ) will be rejected if it is configured a different cluster name
@@ -138,6 +156,11 @@ func (l *Layout) ConfigVersion() string {
 	return configVersion
 }
 
+// ConfigLogLevels returns the key of the log levels shared by all members.
+func (l *Layout) ConfigLogLevels() string {
+	return configLogLevels
+}
+
 // WasmCodeEvent returns the key of wasm code event
 func (l *Layout) WasmCodeEvent() string {
 	return wasmCodeEvent
@@ -157,3 +180,96 @@ func (l *Layout) CustomDataPrefix() string {
 func (l *Layout) CustomDataKindPrefix() string {
 	return customDataKindPrefix
 }
+
+// SchedulerFireKey returns the key of the last fire time of the scheduler,
+// which is used to elect the member to fire.
+func (l *Layout) SchedulerFireKey(name string) string {
+	return fmt.Sprintf(schedulerFireFormat, name)
+}
+
+// SessionTicketKeysKey returns the key of the TLS session ticket keys of
+// the server shared by all members.
+func (l *Layout) SessionTicketKeysKey(name string) string {
+	return fmt.Sprintf(sessionTicketKeysFormat, name)
+}
+
+// UsageCheckpointKey returns the key of the checkpoint of the usage
+// metered by the object in the member.
+func (l *Layout) UsageCheckpointKey(name string) string {
+	return fmt.Sprintf(usageCheckpointFormat, name, l.memberName)
+}
+
+// QuotaCounterKey returns the key of the counter of the consumer in the
+// window, which is shared by all members.
+func (l *Layout) QuotaCounterKey(pipeline, filter, window, consumer string) string {
+	return fmt.Sprintf(quotaCounterFormat, pipeline, filter, window, consumer)
+}
+
+// TokenIssuerKeysKey returns the key of the signing keys of the token
+// issuer filter, which are shared by all members.
+func (l *Layout) TokenIssuerKeysKey(pipeline, filter string) string {
+	return fmt.Sprintf(tokenIssuerKeysFormat, pipeline, filter)
+}
+
+// MaintenancePrefix returns the prefix of the maintenance switches of the
+// pipelines.
+func (l *Layout) MaintenancePrefix() string {
+	return maintenancePrefix
+}
+
+// MaintenanceKey returns the key of the maintenance switch of the pipeline.
+func (l *Layout) MaintenanceKey(name string) string {
+	return fmt.Sprintf(maintenanceFormat, name)
+}
+
+// CanaryPrefix returns the prefix of the canary rollouts of the objects.
+func (l *Layout) CanaryPrefix() string {
+	return canaryPrefix
+}
+
+// CanaryKey returns the key of the canary rollout of the object.
+func (l *Layout) CanaryKey(name string) string {
+	return fmt.Sprintf(canaryFormat, name)
+}
+
+// OverridePrefix returns the prefix of the member overrides of all objects.
+func (l *Layout) OverridePrefix() string {
+	return overridePrefix
+}
+
+// OverrideObjectPrefix returns the prefix of the member overrides of the
+// object.
+func (l *Layout) OverrideObjectPrefix(name string) string {
+	return fmt.Sprintf(overrideObjectPrefix, name)
+}
+
+// OverrideKey returns the key of the override of the object on the member.
+func (l *Layout) OverrideKey(name, member string) string {
+	return fmt.Sprintf(overrideFormat, name, member)
+}
+
+// FeatureFlagPrefix returns the prefix of the feature flags.
+func (l *Layout) FeatureFlagPrefix() string {
+	return featureFlagPrefix
+}
+
+// FeatureFlagKey returns the key of the feature flag.
+func (l *Layout) FeatureFlagKey(name string) string {
+	return fmt.Sprintf(featureFlagFormat, name)
+}
+
+// TemplatePrefix returns the prefix of the shared templates.
+func (l *Layout) TemplatePrefix() string {
+	return templatePrefix
+}
+
+// TemplateKey returns the key of the shared template.
+func (l *Layout) TemplateKey(name string) string {
+	return fmt.Sprintf(templateFormat, name)
+}
+
+// AuthCacheSecretKey returns the key of the secret hashing the keys of the
+// auth caches, which is shared by all members.
+func (l *Layout) AuthCacheSecretKey() string {
+	return authCacheSecret
+}
@@ -240,3 +240,17 @@ func (c *cluster) PutUnderTimeout(key, value string, timeout time.Duration) erro
 	_, err = client.Put(ctx, key, value, clientv3.WithLease(lgr.ID))
 	return err
 }
+
+func (c *cluster) GrantLease(ttl time.Duration) (clientv3.LeaseID, error) {
+	client, err := c.getClient()
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := c.requestContext()
+	defer cancel()
+	lgr, err := client.Lease.Grant(ctx, int64(ttl.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	return lgr.ID, nil
+}
@@ -24,8 +24,6 @@ import (
 
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
-
-	"github.com/megaease/easegress/v2/pkg/logger"
 )
 
 type syncer struct {
@@ -54,14 +52,14 @@ func (s *syncer) pull(key string, prefix bool) (map[string]*mvccpb.KeyValue, err
 	if prefix {
 		result, err := s.cluster.GetRawPrefix(key)
 		if err != nil {
-			logger.Errorf("failed to pull data for prefix %s: %v", key, err)
+			clusterLogger.Errorf("failed to pull data for prefix %s: %v", key, err)
 		}
 		return result, err
 	}
 
 	kv, err := s.cluster.GetRaw(key)
 	if err != nil {
-		logger.Errorf("failed to pull data for key %s: %v", key, err)
+		clusterLogger.Errorf("failed to pull data for key %s: %v", key, err)
 		return nil, err
 	}
 
@@ -80,7 +78,7 @@ func (s *syncer) watch(key string, prefix bool) (clientv3.Watcher, clientv3.Watc
 	}
 	watcher := clientv3.NewWatcher(s.client)
 	watchChan := watcher.Watch(context.Background(), key, opts...)
-	logger.Debugf("watcher created for key %s (prefix: %v)", key, prefix)
+	clusterLogger.Debugf("watcher created for key %s (prefix: %v)", key, prefix)
 	return watcher, watchChan
 }
 
@@ -129,7 +127,7 @@ func (s *syncer) run(key string, prefix bool, send func(data map[string]*mvccpb.
 	pullCompareSend := func() {
 		newData, err := s.pull(key, prefix)
 		if err != nil {
-			logger.Errorf("pull data for key %s (prefix: %v) failed: %v", key, prefix, err)
+			clusterLogger.Errorf("pull data for key %s (prefix: %v) failed: %v", key, prefix, err)
 			return
 		}
 		if !isDataEqual(data, newData) {
@@ -152,7 +150,7 @@ func (s *syncer) run(key string, prefix bool, send func(data map[string]*mvccpb.
 			if resp.Canceled {
 				// Etcd cancels a watcher when it cannot catch up with the progress of
 				// the key-value store. And no matter what happens, we restart the watcher.
-				logger.Debugf("watch key %s canceled: %v", key, resp.Err())
+				clusterLogger.Debugf("watch key %s canceled: %v", key, resp.Err())
 				watcher.Close()
 				watcher, watchChan = s.watch(key, prefix)
 				continue
@@ -161,7 +159,33 @@ func (s *syncer) run(key string, prefix bool, send func(data map[string]*mvccpb.
 				continue
 			}
 
+			// A bulk change may arrive as a burst of responses, one pull
+			// covers all of them.
+			canceled := coalesce(watchChan)
 			pullCompareSend()
+			if canceled {
+				clusterLogger.Debugf("watch key %s canceled", key)
+				watcher.Close()
+				watcher, watchChan = s.watch(key, prefix)
+			}
+		}
+	}
+}
+
+// coalesce drains the watch responses queued in watchChan without
+// blocking, it returns true if the watcher is canceled.
+func coalesce(watchChan clientv3.WatchChan) bool {
+	for {
+		select {
+		case resp, ok := <-watchChan:
+			if !ok {
+				return false
+			}
+			if resp.Canceled {
+				return true
+			}
+		default:
+			return false
 		}
 	}
 }
@@ -102,3 +102,24 @@ func TestSyncer(t *testing.T) {
 		assert.True(isDataEqual(data1, data2))
 	}
 }
+
+func TestCoalesce(t *testing.T) {
+	assert := assert.New(t)
+
+	ch := make(chan clientv3.WatchResponse, 3)
+	assert.False(coalesce(ch))
+
+	ch <- clientv3.WatchResponse{}
+	ch <- clientv3.WatchResponse{}
+	assert.False(coalesce(ch))
+	assert.Empty(ch)
+
+	ch <- clientv3.WatchResponse{}
+	ch <- clientv3.WatchResponse{Canceled: true}
+	ch <- clientv3.WatchResponse{}
+	assert.True(coalesce(ch))
+	assert.Len(ch, 1)
+
+	close(ch)
+	assert.False(coalesce(ch))
+}
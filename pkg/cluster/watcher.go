@@ -23,8 +23,6 @@ import (
 
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
-
-	"github.com/megaease/easegress/v2/pkg/logger"
 )
 
 type (
@@ -65,7 +63,7 @@ func (w *watcher) Watch(key string) (<-chan *string, error) {
 				return
 			case resp := <-watchResp:
 				if resp.Canceled {
-					logger.Infof("watch key %s canceled: %v", key, resp.Err())
+					clusterLogger.Infof("watch key %s canceled: %v", key, resp.Err())
 					return
 				}
 				if resp.IsProgressNotify() {
@@ -79,7 +77,7 @@ func (w *watcher) Watch(key string) (<-chan *string, error) {
 					case mvccpb.DELETE:
 						keyChan <- nil
 					default:
-						logger.Errorf("BUG: key %s received unknown event type %v",
+						clusterLogger.Errorf("BUG: key %s received unknown event type %v",
 							key, event.Type)
 					}
 				}
@@ -106,7 +104,7 @@ func (w *watcher) WatchRaw(key string) (<-chan *clientv3.Event, error) {
 				return
 			case resp := <-watchResp:
 				if resp.Canceled {
-					logger.Infof("watch raw key %s canceled: %v", key, resp.Err())
+					clusterLogger.Infof("watch raw key %s canceled: %v", key, resp.Err())
 					return
 				}
 				if resp.IsProgressNotify() {
@@ -119,7 +117,7 @@ func (w *watcher) WatchRaw(key string) (<-chan *clientv3.Event, error) {
 					case mvccpb.DELETE:
 						eventChan <- nil
 					default:
-						logger.Errorf("BUG: key %s received unknown event type %v",
+						clusterLogger.Errorf("BUG: key %s received unknown event type %v",
 							key, event.Type)
 					}
 				}
@@ -147,7 +145,7 @@ func (w *watcher) WatchPrefix(prefix string) (<-chan map[string]*string, error)
 				return
 			case resp := <-watchResp:
 				if resp.Canceled {
-					logger.Errorf("watch prefix %s canceled: %v", prefix, resp.Err())
+					clusterLogger.Errorf("watch prefix %s canceled: %v", prefix, resp.Err())
 					return
 				}
 				if resp.IsProgressNotify() {
@@ -165,7 +163,7 @@ func (w *watcher) WatchPrefix(prefix string) (<-chan map[string]*string, error)
 							string(event.Kv.Key): nil,
 						}
 					default:
-						logger.Errorf("BUG: prefix %s received unknown event type %v",
+						clusterLogger.Errorf("BUG: prefix %s received unknown event type %v",
 							prefix, event.Type)
 					}
 				}
@@ -192,7 +190,7 @@ func (w *watcher) WatchRawPrefix(prefix string) (<-chan map[string]*clientv3.Eve
 				return
 			case resp := <-watchResp:
 				if resp.Canceled {
-					logger.Errorf("watch raw prefix %s canceled: %v", prefix, resp.Err())
+					clusterLogger.Errorf("watch raw prefix %s canceled: %v", prefix, resp.Err())
 					return
 				}
 				if resp.IsProgressNotify() {
@@ -209,7 +207,7 @@ func (w *watcher) WatchRawPrefix(prefix string) (<-chan map[string]*clientv3.Eve
 							string(event.Kv.Key): nil,
 						}
 					default:
-						logger.Errorf("BUG: prefix %s received unknown event type %v",
+						clusterLogger.Errorf("BUG: prefix %s received unknown event type %v",
 							prefix, event.Type)
 					}
 				}
@@ -243,7 +241,7 @@ func (w *watcher) WatchWithOp(key string, ops ...ClientOp) (<-chan map[string]*s
 				return
 			case resp := <-watchResp:
 				if resp.Canceled {
-					logger.Errorf("watch %s with ops %v canceled: %v", key, ops, resp.Err())
+					clusterLogger.Errorf("watch %s with ops %v canceled: %v", key, ops, resp.Err())
 					return
 				}
 				if resp.IsProgressNotify() {
@@ -261,7 +259,7 @@ func (w *watcher) WatchWithOp(key string, ops ...ClientOp) (<-chan map[string]*s
 							string(event.Kv.Key): nil,
 						}
 					default:
-						logger.Errorf("BUG: key %s with ops %v received unknown event type %v",
+						clusterLogger.Errorf("BUG: key %s with ops %v received unknown event type %v",
 							key, ops, event.Type)
 					}
 				}
@@ -277,6 +275,6 @@ func (w *watcher) Close() {
 
 	err := w.w.Close()
 	if err != nil {
-		logger.Errorf("close watcher failed: %v", err)
+		clusterLogger.Errorf("close watcher failed: %v", err)
 	}
 }
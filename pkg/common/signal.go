@@ -28,4 +28,7 @@ const (
 
 	// SignalUsr2 represents reload signal in Easegress
 	SignalUsr2 Signal = "usr2"
+
+	// SignalHup represents reload options in Easegress
+	SignalHup Signal = "hup"
 )
@@ -31,12 +31,14 @@ var signalToOsMap = map[Signal]syscall.Signal{
 	SignalInt:  syscall.SIGINT,
 	SignalTerm: syscall.SIGTERM,
 	SignalUsr2: syscall.SIGUSR2,
+	SignalHup:  syscall.SIGHUP,
 }
 
 var signalFromOsMap = map[os.Signal]Signal{
 	syscall.SIGINT:  SignalInt,
 	syscall.SIGTERM: SignalTerm,
 	syscall.SIGUSR2: SignalUsr2,
+	syscall.SIGHUP:  SignalHup,
 }
 
 // NotifySignal is identical to os/signal.Notify on Linux
@@ -24,10 +24,20 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"golang.org/x/sys/windows"
 )
 
+// consoleSignals maps the signals to the console events relayed by Go,
+// Ctrl+C and Ctrl+Break come as os.Interrupt, while closing the console,
+// logging off and shutting down come as syscall.SIGTERM.
+var consoleSignals = map[Signal]os.Signal{
+	SignalInt:  os.Interrupt,
+	SignalTerm: syscall.SIGTERM,
+}
+
 func eventName(s Signal, pid int) string {
 	return fmt.Sprintf("Global\\easegress_%v_%v", s, pid)
 }
@@ -35,7 +45,8 @@ func eventName(s Signal, pid int) string {
 // NotifySignal is the windows impl of os/signal.Notify
 // which takes abstract Signal and causes common to relay incoming signals to c
 //
-// On Windows, the impl is based on https://docs.microsoft.com/en-us/windows/win32/api/synchapi/nf-synchapi-createeventw
+// On Windows, the impl is based on https://docs.microsoft.com/en-us/windows/win32/api/synchapi/nf-synchapi-createeventw,
+// and the console events are relayed as SignalInt and SignalTerm too.
 func NotifySignal(c chan<- Signal, sig ...Signal) error {
 	if c == nil {
 		return fmt.Errorf("NotifySignal using nil channel")
@@ -43,8 +54,13 @@ func NotifySignal(c chan<- Signal, sig ...Signal) error {
 
 	var pid = os.Getpid()
 	evts := make([]windows.Handle, 0, len(sig))
+	consoleSigs := map[os.Signal]Signal{}
 
 	for _, s := range sig {
+		if oss, ok := consoleSignals[s]; ok {
+			consoleSigs[oss] = s
+		}
+
 		name, err := windows.UTF16PtrFromString(eventName(s, pid))
 		if err != nil {
 			return err
@@ -58,6 +74,18 @@ func NotifySignal(c chan<- Signal, sig ...Signal) error {
 		evts = append(evts, h)
 	}
 
+	if len(consoleSigs) > 0 {
+		ch := make(chan os.Signal, cap(c))
+		for oss := range consoleSigs {
+			signal.Notify(ch, oss)
+		}
+		go func() {
+			for oss := range ch {
+				c <- consoleSigs[oss]
+			}
+		}()
+	}
+
 	go func() {
 		for {
 			ev, err := windows.WaitForMultipleObjects(evts, false, windows.INFINITE)
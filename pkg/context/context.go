@@ -41,6 +41,23 @@ type MuxMapper interface {
 	GetHandler(name string) (Handler, bool)
 }
 
+// Backpressurer is implemented by the handlers and filters which could fall
+// behind, like a Kafka producer, the traffic sources slow down the intake
+// while Backpressure returns true.
+type Backpressurer interface {
+	Backpressure() bool
+}
+
+// PayloadNeeder is implemented by the handlers and filters which declare
+// whether they need the whole payloads of the requests or the responses,
+// like a filter reading the body of a request. The traffic gates could
+// stream the payloads to the handlers which don't need them, instead of
+// buffering the payloads. Streaming is opt-in: the payloads are buffered
+// for the handlers and filters not implementing it.
+type PayloadNeeder interface {
+	NeedPayload() (request, response bool)
+}
+
 type requestRef struct {
 	req     protocols.Request
 	counter int
@@ -79,6 +96,9 @@ type Context struct {
 
 	data        map[string]interface{}
 	finishFuncs []func()
+
+	// pooled is true if the Context is acquired from the pool.
+	pooled bool
 }
 
 // New creates a new Context.
@@ -112,6 +132,12 @@ func (ctx *Context) Span() *tracing.Span {
 	return ctx.span
 }
 
+// SetSpan sets the span of this Context, the pipelines and filters set
+// their own spans, so the spans created by the filters are their children.
+func (ctx *Context) SetSpan(span *tracing.Span) {
+	ctx.span = span
+}
+
 // AddTag add a tag to the Context.
 func (ctx *Context) AddTag(tag string) {
 	ctx.lazyTags = append(ctx.lazyTags, func() string { return tag })
@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package context
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type (
+	// DataKey is a typed key of the task data. The keys defined by a filter
+	// or an object are in its own namespace, so they never conflict with
+	// the keys of others. The keys configured by users are in the user
+	// namespace, which could not contain the keys defined by the code.
+	DataKey[T any] struct {
+		name string
+		user bool
+	}
+
+	// DataDecl declares a key of the task data and the type of its value,
+	// the filters declare the data they read and write with it, so the
+	// pipeline could check them at config time.
+	DataDecl struct {
+		Name string
+		Type reflect.Type
+		// User means the key is configured by users, the data of it may
+		// be written by the filters which do not declare their data, or
+		// by the caller of the pipeline, so the pipeline only checks its
+		// type against the declaration of the writer, if there is one.
+		User bool
+	}
+)
+
+var (
+	anyType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+	runtimeDataKeys sync.Map
+	// definedDataKeys are the keys defined by the code.
+	definedDataKeys sync.Map
+)
+
+// NewDataKey creates a typed key of the task data, the name of the key is
+// prefixed by namespace. The namespace could be empty for the keys which
+// existed before namespaces were introduced, like PIPELINE.
+func NewDataKey[T any](namespace, name string) DataKey[T] {
+	if namespace != "" {
+		name = namespace + "." + name
+	}
+	definedDataKeys.Store(name, struct{}{})
+	return DataKey[T]{name: name}
+}
+
+// NewUserDataKey creates a typed key of the task data configured by users,
+// like the dataKey of DataBuilder.
+func NewUserDataKey[T any](name string) DataKey[T] {
+	return DataKey[T]{name: name, user: true}
+}
+
+// ValidateUserDataKey validates a key configured by users, it must not be
+// a key defined by the code, or in the namespace of a filter or an object,
+// so the data of users never overwrites the data of Easegress.
+func ValidateUserDataKey(name string) error {
+	if strings.Contains(name, ".") {
+		return fmt.Errorf("data key %s contains '.', which is reserved for the namespaces", name)
+	}
+	if _, ok := definedDataKeys.Load(name); ok {
+		return fmt.Errorf("data key %s is reserved", name)
+	}
+	return nil
+}
+
+// Name returns the full name of the key.
+func (k DataKey[T]) Name() string {
+	return k.name
+}
+
+// Get returns the value of the key, it returns false if the value is not
+// set or is not of type T.
+func (k DataKey[T]) Get(ctx *Context) (T, bool) {
+	v, ok := ctx.data[k.name].(T)
+	return v, ok
+}
+
+// Set sets the value of the key.
+func (k DataKey[T]) Set(ctx *Context, v T) {
+	ctx.data[k.name] = v
+}
+
+// Decl returns the declaration of the key.
+func (k DataKey[T]) Decl() DataDecl {
+	return DataDecl{Name: k.name, Type: reflect.TypeOf((*T)(nil)).Elem(), User: k.user}
+}
+
+// AnyData declares a key whose value could be of any type, it is used for
+// the keys configured by users, like the dataKey of DataBuilder.
+func AnyData(name string) DataDecl {
+	return DataDecl{Name: name, Type: anyType, User: true}
+}
+
+// Accepts reports whether the value written as decl w could be read as d.
+// A value written as an interface type is accepted by any type, because its
+// type is unknown until the runtime.
+func (d DataDecl) Accepts(w DataDecl) bool {
+	if w.Type.Kind() == reflect.Interface {
+		return true
+	}
+	return w.Type.AssignableTo(d.Type)
+}
+
+// RegisterRuntimeData registers a key of the task data written by the
+// runtime instead of the filters, like the response writer set by the
+// HTTPServer, so the filters reading it pass the check of the pipeline.
+func RegisterRuntimeData(decl DataDecl) {
+	runtimeDataKeys.Store(decl.Name, decl)
+}
+
+// GetRuntimeData returns the declaration of a key written by the runtime.
+func GetRuntimeData(name string) (DataDecl, bool) {
+	v, ok := runtimeDataKeys.Load(name)
+	if !ok {
+		return DataDecl{}, false
+	}
+	return v.(DataDecl), true
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package context
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/v2/pkg/tracing"
+)
+
+var (
+	poolEnabled atomic.Bool
+
+	contextPool = sync.Pool{
+		New: func() interface{} {
+			return &Context{
+				requests:  map[string]*requestRef{},
+				responses: map[string]*responseRef{},
+				data:      map[string]interface{}{},
+			}
+		},
+	}
+)
+
+// EnablePool enables or disables the pooling of the objects allocated for
+// every task, like the contexts, which reduces the GC pressure at high
+// RPS. It is disabled by default and is set once at startup.
+func EnablePool(enabled bool) {
+	poolEnabled.Store(enabled)
+}
+
+// PoolEnabled returns whether the pooling of the objects is enabled.
+func PoolEnabled() bool {
+	return poolEnabled.Load()
+}
+
+// Acquire returns a Context from the pool if the pooling is enabled, or
+// creates a new one otherwise. The caller should call Release after the
+// Context is finished and no longer referenced.
+func Acquire(span *tracing.Span) *Context {
+	if !poolEnabled.Load() {
+		return New(span)
+	}
+
+	ctx := contextPool.Get().(*Context)
+	ctx.span = span
+	ctx.activeNs = DefaultNamespace
+	ctx.pooled = true
+	return ctx
+}
+
+// Release resets the Context and puts it back to the pool if it is
+// acquired from the pool, the Context must not be used after Release.
+func (ctx *Context) Release() {
+	if !ctx.pooled {
+		return
+	}
+
+	ctx.span = nil
+	clear(ctx.lazyTags)
+	ctx.lazyTags = ctx.lazyTags[:0]
+	ctx.route = nil
+	clear(ctx.requests)
+	clear(ctx.responses)
+	clear(ctx.data)
+	clear(ctx.finishFuncs)
+	ctx.finishFuncs = ctx.finishFuncs[:0]
+	ctx.pooled = false
+
+	contextPool.Put(ctx)
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package context
+
+import (
+	"testing"
+
+	"github.com/megaease/easegress/v2/pkg/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	assert := assert.New(t)
+	defer EnablePool(false)
+
+	EnablePool(false)
+	ctx := Acquire(tracing.NoopSpan)
+	assert.False(ctx.pooled)
+	ctx.Release()
+
+	EnablePool(true)
+	assert.True(PoolEnabled())
+	ctx = Acquire(tracing.NoopSpan)
+	assert.True(ctx.pooled)
+	assert.Equal(DefaultNamespace, ctx.Namespace())
+
+	ctx.SetData("key", "value")
+	ctx.AddTag("tag")
+	ctx.OnFinish(func() {})
+	ctx.UseNamespace("ns")
+	ctx.Finish()
+	ctx.Release()
+
+	// the released context is reset.
+	ctx = Acquire(tracing.NoopSpan)
+	assert.Nil(ctx.GetData("key"))
+	assert.Empty(ctx.Tags())
+	assert.Empty(ctx.finishFuncs)
+	assert.Empty(ctx.Requests())
+	assert.Equal(DefaultNamespace, ctx.Namespace())
+	ctx.Release()
+}
+
+func BenchmarkContext(b *testing.B) {
+	run := func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ctx := Acquire(tracing.NoopSpan)
+			ctx.SetData("key", i)
+			ctx.AddTag("tag")
+			ctx.Finish()
+			ctx.Release()
+		}
+	}
+
+	b.Run("New", func(b *testing.B) {
+		EnablePool(false)
+		run(b)
+	})
+	b.Run("Pool", func(b *testing.B) {
+		EnablePool(true)
+		defer EnablePool(false)
+		run(b)
+	})
+}
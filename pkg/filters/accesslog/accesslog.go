@@ -0,0 +1,227 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package accesslog implements the AccessLog filter.
+package accesslog
+
+import (
+	"fmt"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/httpserver/routers"
+	"github.com/megaease/easegress/v2/pkg/object/pipeline"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
+)
+
+const (
+	// Kind is the kind of AccessLog.
+	Kind = "AccessLog"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "AccessLog writes a structured access log after the request is handled.",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{Format: formatText}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &AccessLog{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// AccessLog is filter AccessLog.
+	AccessLog struct {
+		spec      *Spec
+		formatter *formatter
+		shippers  []*shipper
+		// write writes the formatted record, it is a variable for testing.
+		write func(fn func() string)
+	}
+
+	// Spec describes the AccessLog.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Format   string   `json:"format,omitempty" jsonschema:"enum=text,enum=json"`
+		Template string   `json:"template,omitempty"`
+		Fields   []string `json:"fields,omitempty" jsonschema:"uniqueItems=true"`
+		// Sinks ship the access logs to other targets instead of the HTTP
+		// filter access log.
+		Sinks []*SinkSpec `json:"sinks,omitempty"`
+	}
+
+	// Status is the status of AccessLog.
+	Status struct {
+		Sinks []*SinkStatus `json:"sinks,omitempty"`
+	}
+)
+
+// Validate validates the Spec.
+func (s *Spec) Validate() error {
+	if _, err := newFormatter(s); err != nil {
+		return err
+	}
+	for i, sink := range s.Sinks {
+		if err := sink.Validate(); err != nil {
+			return fmt.Errorf("sinks[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the AccessLog filter instance.
+func (a *AccessLog) Name() string {
+	return a.spec.Name()
+}
+
+// Kind returns the kind of AccessLog.
+func (a *AccessLog) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the AccessLog
+func (a *AccessLog) Spec() filters.Spec {
+	return a.spec
+}
+
+// Init initializes AccessLog.
+func (a *AccessLog) Init() {
+	a.reload()
+}
+
+// Inherit inherits previous generation of AccessLog.
+func (a *AccessLog) Inherit(previousGeneration filters.Filter) {
+	a.Init()
+}
+
+func (a *AccessLog) reload() {
+	// the spec has been validated, so the error is impossible.
+	a.formatter, _ = newFormatter(a.spec)
+	for _, spec := range a.spec.Sinks {
+		a.shippers = append(a.shippers, newShipper(a.spec.Name(), spec))
+	}
+	if a.write == nil {
+		if len(a.shippers) == 0 {
+			a.write = logger.LazyHTTPAccess
+		} else {
+			a.write = a.ship
+		}
+	}
+}
+
+// ship ships the access log to the sinks, it never blocks.
+func (a *AccessLog) ship(fn func() string) {
+	data := []byte(fn())
+	for _, s := range a.shippers {
+		s.ship(data)
+	}
+}
+
+// Handle registers a callback to write the access log after the request is
+// handled, so the duration is measured from here to the end of the request,
+// and the filter should be the first one of the pipeline to cover the full
+// request.
+func (a *AccessLog) Handle(ctx *context.Context) string {
+	r := &record{
+		time:     fasttime.Now(),
+		pipeline: a.spec.Pipeline(),
+	}
+
+	// the request may be released when the callback runs, so the fields of
+	// the request are captured here.
+	if req, ok := ctx.GetInputRequest().(*httpprot.Request); ok {
+		r.method = req.Method()
+		r.uri = req.Std().RequestURI
+		if r.uri == "" {
+			r.uri = req.URL().RequestURI()
+		}
+		r.host = req.Host()
+		r.proto = req.Proto()
+		r.realIP = req.RealIP()
+	}
+
+	if route, ok := ctx.GetRoute(); ok {
+		if hr, ok := route.(routers.Route); ok {
+			r.route = routePath(hr)
+		}
+	}
+
+	if span := ctx.Span(); span != nil && !span.IsNoop() {
+		if sc := span.SpanContext(); sc.HasTraceID() {
+			r.traceID = sc.TraceID().String()
+		}
+	}
+
+	ctx.OnFinish(func() {
+		r.duration = fasttime.Since(r.time)
+		if resp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response); ok {
+			r.statusCode = resp.StatusCode()
+		}
+		r.filters, _ = pipeline.StatsDataKey.Get(ctx)
+		r.upstream, _ = httpprot.UpstreamDataKey.Get(ctx)
+
+		a.write(func() string {
+			return a.formatter.formatRecord(r)
+		})
+	})
+
+	return ""
+}
+
+// routePath returns the path of the route, which is the exact path, the
+// path prefix or the path regexp.
+func routePath(route routers.Route) string {
+	if p := route.GetExactPath(); p != "" {
+		return p
+	}
+	if p := route.GetPathPrefix(); p != "" {
+		return p
+	}
+	return route.GetPathRegexp()
+}
+
+// NeedPayload returns false for both payloads, the access logs have no
+// bodies, it implements context.PayloadNeeder.
+func (a *AccessLog) NeedPayload() (request, response bool) {
+	return false, false
+}
+
+// Status returns Status.
+func (a *AccessLog) Status() interface{} {
+	s := &Status{}
+	for _, shipper := range a.shippers {
+		s.Sinks = append(s.Sinks, shipper.status())
+	}
+	return s
+}
+
+// Close closes AccessLog, the access logs in the buffers are shipped
+// before the sinks are closed.
+func (a *AccessLog) Close() {
+	for _, s := range a.shippers {
+		s.close()
+	}
+}
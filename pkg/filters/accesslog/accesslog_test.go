@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/object/pipeline"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/tracing"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func createAccessLog(t *testing.T, yamlConfig string) (*AccessLog, error) {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	if err != nil {
+		return nil, err
+	}
+	al := kind.CreateInstance(spec).(*AccessLog)
+	al.Init()
+	return al, nil
+}
+
+func TestParseTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	segments, err := parseTemplate("[{{Method}} {{URI}}]")
+	assert.Nil(err)
+	assert.Len(segments, 5)
+	assert.Equal("[", segments[0].literal)
+	assert.Equal(fields["Method"], segments[1].field)
+	assert.Equal(" ", segments[2].literal)
+	assert.Equal(fields["URI"], segments[3].field)
+	assert.Equal("]", segments[4].literal)
+
+	_, err = parseTemplate("{{Method}} {{Unknown}}")
+	assert.Error(err)
+
+	_, err = parseFields([]string{"Method", "Unknown"})
+	assert.Error(err)
+}
+
+func TestFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	r := &record{
+		time:       time.Date(2023, 1, 2, 3, 4, 5, 6000000, time.UTC),
+		pipeline:   "pipeline-demo",
+		route:      "/api",
+		method:     http.MethodGet,
+		uri:        "/api?a=b",
+		statusCode: 200,
+		duration:   15 * time.Millisecond,
+		filters: []pipeline.FilterStat{
+			{Name: "auth", Kind: "Validator", Duration: 5 * time.Millisecond},
+			{Name: "proxy", Kind: "Proxy", Result: "serverError", Duration: 10 * time.Millisecond},
+		},
+		upstream: "http://127.0.0.1:9095",
+	}
+
+	f, err := newFormatter(&Spec{Template: "{{Time}} {{Method}} {{URI}} {{StatusCode}} {{Duration}} {{Route}} {{Upstream}} {{Filters}}"})
+	assert.Nil(err)
+	assert.Equal("2023-01-02T03:04:05.006Z GET /api?a=b 200 15ms /api http://127.0.0.1:9095 auth(5ms)->proxy(serverError,10ms)", f.formatRecord(r))
+
+	f, err = newFormatter(&Spec{Format: formatJSON, Fields: []string{"Method", "StatusCode", "Duration", "Filters"}})
+	assert.Nil(err)
+	m := map[string]interface{}{}
+	codectool.MustUnmarshalJSON([]byte(f.formatRecord(r)), &m)
+	assert.Len(m, 4)
+	assert.Equal("GET", m["method"])
+	assert.Equal(float64(200), m["statusCode"])
+	assert.Equal(float64(15), m["duration"])
+	filterStats := m["filters"].([]interface{})
+	assert.Len(filterStats, 2)
+	assert.Equal("serverError", filterStats[1].(map[string]interface{})["result"])
+
+	f, err = newFormatter(&Spec{Format: formatJSON})
+	assert.Nil(err)
+	m = map[string]interface{}{}
+	codectool.MustUnmarshalJSON([]byte(f.formatRecord(r)), &m)
+	assert.Len(m, len(fieldNames))
+
+	_, err = newFormatter(&Spec{Format: "xml"})
+	assert.Error(err)
+}
+
+func TestAccessLog(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := createAccessLog(t, `
+kind: AccessLog
+name: accesslog
+template: "{{Method}} {{Unknown}}"
+`)
+	assert.Error(err)
+
+	al, err := createAccessLog(t, `
+kind: AccessLog
+name: accesslog
+template: "{{Method}} {{URI}} {{StatusCode}} {{Upstream}} {{Filters}}"
+`)
+	assert.Nil(err)
+	assert.Equal("accesslog", al.Name())
+	assert.Equal(kind, al.Kind())
+	assert.Equal(&Status{}, al.Status())
+
+	var logs []string
+	al.write = func(fn func() string) {
+		logs = append(logs, fn())
+	}
+
+	ctx := context.New(tracing.NoopSpan)
+	stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/api?a=b", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+	resp, _ := httpprot.NewResponse(nil)
+	ctx.SetInputResponse(resp)
+
+	assert.Equal("", al.Handle(ctx))
+	assert.Empty(logs)
+
+	resp.SetStatusCode(http.StatusBadGateway)
+	httpprot.UpstreamDataKey.Set(ctx, "http://127.0.0.1:9095")
+	pipeline.StatsDataKey.Set(ctx, []pipeline.FilterStat{
+		{Name: "proxy", Kind: "Proxy", Result: "serverError", Duration: time.Millisecond},
+	})
+	ctx.Finish()
+
+	assert.Equal([]string{"POST /api?a=b 502 http://127.0.0.1:9095 proxy(serverError,1ms)"}, logs)
+
+	rawSpec := map[string]interface{}{"kind": Kind, "name": "accesslog", "format": formatJSON}
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Nil(err)
+	newAl := kind.CreateInstance(spec).(*AccessLog)
+	newAl.Inherit(al)
+	al.Close()
+	assert.Equal(formatJSON, newAl.formatter.format)
+}
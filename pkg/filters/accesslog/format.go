@@ -0,0 +1,288 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/object/pipeline"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+
+	defaultTemplate = "[{{Time}}] [{{RealIP}} {{Method}} {{URI}} {{Proto}} {{StatusCode}}] [{{Duration}}] [{{Pipeline}} {{Route}} -> {{Upstream}}] [{{Filters}}] [{{TraceID}}]"
+)
+
+type (
+	// record is an access log record.
+	record struct {
+		time       time.Time
+		pipeline   string
+		route      string
+		method     string
+		uri        string
+		host       string
+		proto      string
+		realIP     string
+		statusCode int
+		duration   time.Duration
+		filters    []pipeline.FilterStat
+		upstream   string
+		traceID    string
+	}
+
+	// field is a field of the access log, text returns its value in the
+	// text format, and json returns its value in the json format.
+	field struct {
+		key  string
+		text func(r *record) string
+		json func(r *record) interface{}
+	}
+
+	// segment is a segment of the template, it is either a literal or a
+	// field.
+	segment struct {
+		literal string
+		field   *field
+	}
+
+	// formatter formats the access log records.
+	formatter struct {
+		format   string
+		segments []segment
+		fields   []*field
+	}
+
+	filterStat struct {
+		Name     string  `json:"name"`
+		Kind     string  `json:"kind"`
+		Result   string  `json:"result,omitempty"`
+		Duration float64 `json:"duration"`
+	}
+)
+
+var (
+	fieldReg = regexp.MustCompile(`\{\{([a-zA-Z]*)\}\}`)
+
+	// fieldNames are the names of the fields in the order of the json
+	// format by default.
+	fieldNames = []string{
+		"Time", "Pipeline", "Route", "Method", "URI", "Host", "Proto", "RealIP",
+		"StatusCode", "Duration", "Filters", "Upstream", "TraceID",
+	}
+
+	fields = map[string]*field{
+		"Time": {
+			key:  "time",
+			text: func(r *record) string { return fasttime.Format(r.time, fasttime.RFC3339Milli) },
+		},
+		"Pipeline": {
+			key:  "pipeline",
+			text: func(r *record) string { return r.pipeline },
+		},
+		"Route": {
+			key:  "route",
+			text: func(r *record) string { return r.route },
+		},
+		"Method": {
+			key:  "method",
+			text: func(r *record) string { return r.method },
+		},
+		"URI": {
+			key:  "uri",
+			text: func(r *record) string { return r.uri },
+		},
+		"Host": {
+			key:  "host",
+			text: func(r *record) string { return r.host },
+		},
+		"Proto": {
+			key:  "proto",
+			text: func(r *record) string { return r.proto },
+		},
+		"RealIP": {
+			key:  "realIP",
+			text: func(r *record) string { return r.realIP },
+		},
+		"StatusCode": {
+			key:  "statusCode",
+			text: func(r *record) string { return strconv.Itoa(r.statusCode) },
+			json: func(r *record) interface{} { return r.statusCode },
+		},
+		"Duration": {
+			key:  "duration",
+			text: func(r *record) string { return r.duration.String() },
+			json: func(r *record) interface{} { return milliseconds(r.duration) },
+		},
+		"Filters": {
+			key:  "filters",
+			text: formatFilters,
+			json: func(r *record) interface{} {
+				stats := make([]*filterStat, 0, len(r.filters))
+				for i := range r.filters {
+					s := &r.filters[i]
+					stats = append(stats, &filterStat{
+						Name:     s.Name,
+						Kind:     s.Kind,
+						Result:   s.Result,
+						Duration: milliseconds(s.Duration),
+					})
+				}
+				return stats
+			},
+		},
+		"Upstream": {
+			key:  "upstream",
+			text: func(r *record) string { return r.upstream },
+		},
+		"TraceID": {
+			key:  "traceID",
+			text: func(r *record) string { return r.traceID },
+		},
+	}
+)
+
+// milliseconds converts d to milliseconds, the json format uses numbers
+// for durations so that they could be aggregated by the log systems.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// formatFilters formats the latency breakdown of the filters like
+// name(result,duration)->name(duration).
+func formatFilters(r *record) string {
+	var sb strings.Builder
+	for i := range r.filters {
+		if i > 0 {
+			sb.WriteString("->")
+		}
+		s := &r.filters[i]
+		sb.WriteString(s.Name)
+		sb.WriteByte('(')
+		if s.Result != "" {
+			sb.WriteString(s.Result)
+			sb.WriteByte(',')
+		}
+		sb.WriteString(s.Duration.String())
+		sb.WriteByte(')')
+	}
+	return sb.String()
+}
+
+// parseTemplate parses the template of the text format, the fields are
+// referenced as {{Field}}.
+func parseTemplate(tpl string) ([]segment, error) {
+	var segments []segment
+	last := 0
+	for _, m := range fieldReg.FindAllStringSubmatchIndex(tpl, -1) {
+		name := tpl[m[2]:m[3]]
+		f := fields[name]
+		if f == nil {
+			return nil, fmt.Errorf("unknown field %q in template", name)
+		}
+		if m[0] > last {
+			segments = append(segments, segment{literal: tpl[last:m[0]]})
+		}
+		segments = append(segments, segment{field: f})
+		last = m[1]
+	}
+	if last < len(tpl) {
+		segments = append(segments, segment{literal: tpl[last:]})
+	}
+	return segments, nil
+}
+
+// parseFields parses the fields of the json format, all fields are used if
+// names is empty.
+func parseFields(names []string) ([]*field, error) {
+	if len(names) == 0 {
+		names = fieldNames
+	}
+
+	result := make([]*field, 0, len(names))
+	for _, name := range names {
+		f := fields[name]
+		if f == nil {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+func newFormatter(spec *Spec) (*formatter, error) {
+	f := &formatter{format: spec.Format}
+	if f.format == "" {
+		f.format = formatText
+	}
+
+	var err error
+	switch f.format {
+	case formatText:
+		tpl := spec.Template
+		if tpl == "" {
+			tpl = defaultTemplate
+		}
+		f.segments, err = parseTemplate(tpl)
+	case formatJSON:
+		f.fields, err = parseFields(spec.Fields)
+	default:
+		err = fmt.Errorf("unknown format %q", spec.Format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *formatter) formatRecord(r *record) string {
+	if f.format == formatJSON {
+		return f.formatJSON(r)
+	}
+
+	var sb strings.Builder
+	for _, s := range f.segments {
+		if s.field == nil {
+			sb.WriteString(s.literal)
+		} else {
+			sb.WriteString(s.field.text(r))
+		}
+	}
+	return sb.String()
+}
+
+func (f *formatter) formatJSON(r *record) string {
+	m := make(map[string]interface{}, len(f.fields))
+	for _, field := range f.fields {
+		if field.json != nil {
+			m[field.key] = field.json(r)
+		} else {
+			m[field.key] = field.text(r)
+		}
+	}
+	return string(codectool.MustMarshalJSON(m))
+}
@@ -0,0 +1,544 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
+)
+
+const (
+	policyDropNewest = "dropNewest"
+	policyDropOldest = "dropOldest"
+
+	defaultBufferSize     = 10240
+	defaultBatchSize      = 100
+	defaultFlushInterval  = time.Second
+	defaultSinkTimeout    = 10 * time.Second
+	defaultFileMaxSize    = 100 // in MB
+	defaultFileMaxBackups = 5
+	defaultSyslogTag      = "easegress"
+	defaultSyslogFacility = 16 // local0
+
+	syslogSeverityInfo = 6
+)
+
+type (
+	// SinkSpec describes where to ship the access logs, only one of the
+	// targets could be specified.
+	SinkSpec struct {
+		// BufferSize is the max number of access logs waiting to be shipped.
+		BufferSize int `json:"bufferSize,omitempty" jsonschema:"minimum=1"`
+		// BatchSize is the max number of access logs shipped at once.
+		BatchSize int `json:"batchSize,omitempty" jsonschema:"minimum=1"`
+		// FlushInterval is the max time an access log waits for a batch.
+		FlushInterval string `json:"flushInterval,omitempty" jsonschema:"format=duration"`
+		// OverloadPolicy decides which access log to drop when the buffer
+		// is full.
+		OverloadPolicy string `json:"overloadPolicy,omitempty" jsonschema:"enum=,enum=dropNewest,enum=dropOldest"`
+
+		File          *FileSinkSpec          `json:"file,omitempty"`
+		Kafka         *KafkaSinkSpec         `json:"kafka,omitempty"`
+		Elasticsearch *ElasticsearchSinkSpec `json:"elasticsearch,omitempty"`
+		Syslog        *SyslogSinkSpec        `json:"syslog,omitempty"`
+	}
+
+	// FileSinkSpec appends the access logs to a file, one per line, the
+	// file is rotated when it exceeds the max size, the same way as the
+	// log files of Easegress.
+	FileSinkSpec struct {
+		Path string `json:"path" jsonschema:"required"`
+		// MaxSize is the max size of the file in megabytes.
+		MaxSize int64 `json:"maxSize,omitempty" jsonschema:"minimum=1"`
+		// MaxBackups is the max number of the rotated files to keep.
+		MaxBackups int `json:"maxBackups,omitempty" jsonschema:"minimum=1"`
+	}
+
+	// KafkaSinkSpec sends the access logs to a Kafka topic.
+	KafkaSinkSpec struct {
+		Backend []string `json:"backend" jsonschema:"required,uniqueItems=true"`
+		Topic   string   `json:"topic" jsonschema:"required"`
+	}
+
+	// ElasticsearchSinkSpec indexes the access logs with the bulk API of
+	// Elasticsearch.
+	ElasticsearchSinkSpec struct {
+		Endpoint string `json:"endpoint" jsonschema:"required,format=uri"`
+		Index    string `json:"index" jsonschema:"required"`
+		Username string `json:"username,omitempty"`
+		Password string `json:"password,omitempty"`
+		Timeout  string `json:"timeout,omitempty" jsonschema:"format=duration"`
+	}
+
+	// SyslogSinkSpec sends the access logs to a syslog server in the
+	// format of RFC 5424.
+	SyslogSinkSpec struct {
+		Network  string `json:"network,omitempty" jsonschema:"enum=,enum=udp,enum=tcp"`
+		Address  string `json:"address" jsonschema:"required"`
+		Tag      string `json:"tag,omitempty"`
+		Facility int    `json:"facility,omitempty" jsonschema:"minimum=0,maximum=23"`
+	}
+
+	// SinkStatus is the status of a sink.
+	SinkStatus struct {
+		Sent    uint64 `json:"sent"`
+		Failed  uint64 `json:"failed"`
+		Dropped uint64 `json:"dropped"`
+	}
+
+	sink interface {
+		send(batch [][]byte) error
+		close()
+	}
+
+	// shipper ships the access logs to a sink in background in batches, so
+	// request handling is never blocked by a slow target. The access logs
+	// are dropped according to the overload policy if the buffer is full.
+	shipper struct {
+		spec          *SinkSpec
+		sink          sink
+		batchSize     int
+		flushInterval time.Duration
+		ch            chan []byte
+		done          chan struct{}
+
+		sent    uint64
+		failed  uint64
+		dropped uint64
+	}
+
+	fileSink struct {
+		spec *FileSinkSpec
+		f    *logger.RotateFile
+	}
+
+	kafkaSink struct {
+		name     string
+		spec     *KafkaSinkSpec
+		producer sarama.SyncProducer
+	}
+
+	elasticsearchSink struct {
+		spec   *ElasticsearchSinkSpec
+		client *http.Client
+		action []byte
+	}
+
+	syslogSink struct {
+		spec     *SyslogSinkSpec
+		hostname string
+		conn     net.Conn
+	}
+)
+
+// Validate validates SinkSpec.
+func (s *SinkSpec) Validate() error {
+	if s.FlushInterval != "" {
+		if d, err := time.ParseDuration(s.FlushInterval); err != nil || d <= 0 {
+			return fmt.Errorf("invalid flushInterval %s", s.FlushInterval)
+		}
+	}
+
+	targets := 0
+	if s.File != nil {
+		targets++
+	}
+	if s.Kafka != nil {
+		targets++
+	}
+	if s.Elasticsearch != nil {
+		targets++
+		if _, err := url.Parse(s.Elasticsearch.Endpoint); err != nil {
+			return fmt.Errorf("invalid endpoint %s: %v", s.Elasticsearch.Endpoint, err)
+		}
+		if s.Elasticsearch.Timeout != "" {
+			if d, err := time.ParseDuration(s.Elasticsearch.Timeout); err != nil || d <= 0 {
+				return fmt.Errorf("invalid timeout %s", s.Elasticsearch.Timeout)
+			}
+		}
+	}
+	if s.Syslog != nil {
+		targets++
+	}
+	if targets != 1 {
+		return fmt.Errorf("exactly one of file, kafka, elasticsearch and syslog is required")
+	}
+	return nil
+}
+
+func newShipper(name string, spec *SinkSpec) *shipper {
+	s := &shipper{
+		spec:          spec,
+		batchSize:     spec.BatchSize,
+		flushInterval: defaultFlushInterval,
+		done:          make(chan struct{}),
+	}
+
+	bufferSize := spec.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+	s.ch = make(chan []byte, bufferSize)
+	if s.batchSize <= 0 {
+		s.batchSize = defaultBatchSize
+	}
+	if spec.FlushInterval != "" {
+		s.flushInterval, _ = time.ParseDuration(spec.FlushInterval)
+	}
+
+	switch {
+	case spec.File != nil:
+		s.sink = &fileSink{spec: spec.File}
+	case spec.Kafka != nil:
+		s.sink = &kafkaSink{name: name, spec: spec.Kafka}
+	case spec.Elasticsearch != nil:
+		s.sink = newElasticsearchSink(spec.Elasticsearch)
+	default:
+		s.sink = newSyslogSink(spec.Syslog)
+	}
+
+	go s.run()
+	return s
+}
+
+func (s *shipper) run() {
+	defer s.sink.close()
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([][]byte, 0, s.batchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			s.send(batch)
+			batch = make([][]byte, 0, s.batchSize)
+		}
+	}
+
+	for {
+		select {
+		case <-s.done:
+			// ship the access logs already in the buffer.
+			for {
+				select {
+				case data := <-s.ch:
+					batch = append(batch, data)
+					if len(batch) >= s.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		case data := <-s.ch:
+			batch = append(batch, data)
+			if len(batch) >= s.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (s *shipper) send(batch [][]byte) {
+	if err := s.sink.send(batch); err != nil {
+		logger.Errorf("ship %d access logs failed: %v", len(batch), err)
+		atomic.AddUint64(&s.failed, uint64(len(batch)))
+		return
+	}
+	atomic.AddUint64(&s.sent, uint64(len(batch)))
+}
+
+// ship puts the access log into the buffer, it never blocks.
+func (s *shipper) ship(data []byte) {
+	select {
+	case s.ch <- data:
+		return
+	default:
+	}
+
+	if s.spec.OverloadPolicy == policyDropOldest {
+		// make room for the new one by dropping the oldest one, the
+		// buffer may be drained or refilled concurrently, so the new
+		// one is dropped if it is full again.
+		select {
+		case <-s.ch:
+			atomic.AddUint64(&s.dropped, 1)
+		default:
+		}
+		select {
+		case s.ch <- data:
+			return
+		default:
+		}
+	}
+
+	atomic.AddUint64(&s.dropped, 1)
+}
+
+func (s *shipper) status() *SinkStatus {
+	return &SinkStatus{
+		Sent:    atomic.LoadUint64(&s.sent),
+		Failed:  atomic.LoadUint64(&s.failed),
+		Dropped: atomic.LoadUint64(&s.dropped),
+	}
+}
+
+func (s *shipper) close() {
+	close(s.done)
+}
+
+// Shipper ships the records to a sink in background, it is exported for
+// the filters shipping records other than the access logs, like
+// BodyCapture.
+type Shipper struct {
+	s *shipper
+}
+
+// NewShipper creates a Shipper of the sink, the spec has been validated.
+func NewShipper(name string, spec *SinkSpec) *Shipper {
+	return &Shipper{s: newShipper(name, spec)}
+}
+
+// Ship puts the record into the buffer, it never blocks.
+func (s *Shipper) Ship(data []byte) {
+	s.s.ship(data)
+}
+
+// Status returns the status of the sink.
+func (s *Shipper) Status() *SinkStatus {
+	return s.s.status()
+}
+
+// Close closes the Shipper after the records in the buffer are shipped.
+func (s *Shipper) Close() {
+	s.s.close()
+}
+
+// The sinks create their resources on the first send, so an unavailable
+// target does not prevent the pipeline from starting.
+
+// open opens the file, which is rotated the same way as the log files of
+// Easegress.
+func (s *fileSink) open() error {
+	maxSize := s.spec.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultFileMaxSize
+	}
+	maxBackups := s.spec.MaxBackups
+	if maxBackups <= 0 {
+		maxBackups = defaultFileMaxBackups
+	}
+
+	f, err := logger.OpenRotateFile(s.spec.Path, 0o644, logger.RotateOptions{
+		MaxSize:  maxSize * 1024 * 1024,
+		MaxFiles: maxBackups,
+	})
+	if err != nil {
+		return err
+	}
+	s.f = f
+	return nil
+}
+
+func (s *fileSink) send(batch [][]byte) error {
+	if s.f == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, data := range batch {
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	_, err := s.f.Write(buf.Bytes())
+	return err
+}
+
+func (s *fileSink) close() {
+	if s.f != nil {
+		s.f.Close()
+	}
+}
+
+func (s *kafkaSink) send(batch [][]byte) error {
+	if s.producer == nil {
+		config := sarama.NewConfig()
+		config.ClientID = s.name
+		config.Version = sarama.V1_0_0_0
+		config.Producer.Return.Successes = true
+		producer, err := sarama.NewSyncProducer(s.spec.Backend, config)
+		if err != nil {
+			return err
+		}
+		s.producer = producer
+	}
+
+	msgs := make([]*sarama.ProducerMessage, 0, len(batch))
+	for _, data := range batch {
+		msgs = append(msgs, &sarama.ProducerMessage{
+			Topic: s.spec.Topic,
+			Value: sarama.ByteEncoder(data),
+		})
+	}
+	return s.producer.SendMessages(msgs)
+}
+
+func (s *kafkaSink) close() {
+	if s.producer != nil {
+		if err := s.producer.Close(); err != nil {
+			logger.Errorf("close kafka producer failed: %v", err)
+		}
+	}
+}
+
+func newElasticsearchSink(spec *ElasticsearchSinkSpec) *elasticsearchSink {
+	timeout := defaultSinkTimeout
+	if spec.Timeout != "" {
+		timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+
+	action, _ := json.Marshal(map[string]interface{}{
+		"index": map[string]string{"_index": spec.Index},
+	})
+
+	return &elasticsearchSink{
+		spec:   spec,
+		client: &http.Client{Timeout: timeout},
+		action: action,
+	}
+}
+
+func (s *elasticsearchSink) send(batch [][]byte) error {
+	var buf bytes.Buffer
+	for _, data := range batch {
+		buf.Write(s.action)
+		buf.WriteByte('\n')
+		// the text format is not a document, so it is wrapped.
+		if !json.Valid(data) {
+			data, _ = json.Marshal(map[string]string{"message": string(data)})
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.spec.Endpoint+"/_bulk", &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.spec.Username != "" {
+		req.SetBasicAuth(s.spec.Username, s.spec.Password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	// the bulk API returns 200 even if some of the documents fail.
+	result := struct {
+		Errors bool `json:"errors"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if result.Errors {
+		return fmt.Errorf("bulk index returns errors")
+	}
+	return nil
+}
+
+func (s *elasticsearchSink) close() {
+	s.client.CloseIdleConnections()
+}
+
+func newSyslogSink(spec *SyslogSinkSpec) *syslogSink {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return &syslogSink{spec: spec, hostname: hostname}
+}
+
+func (s *syslogSink) send(batch [][]byte) error {
+	if s.conn == nil {
+		network := s.spec.Network
+		if network == "" {
+			network = "udp"
+		}
+		conn, err := net.DialTimeout(network, s.spec.Address, defaultSinkTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	facility := s.spec.Facility
+	if facility == 0 {
+		facility = defaultSyslogFacility
+	}
+	tag := s.spec.Tag
+	if tag == "" {
+		tag = defaultSyslogTag
+	}
+	timestamp := fasttime.Format(fasttime.Now(), fasttime.RFC3339Milli)
+
+	for _, data := range batch {
+		msg := fmt.Sprintf("<%d>1 %s %s %s - - - %s", facility*8+syslogSeverityInfo, timestamp, s.hostname, tag, data)
+		// messages are framed by octet counting over TCP, see RFC 6587.
+		if s.spec.Network == "tcp" {
+			msg = strconv.Itoa(len(msg)) + " " + msg
+		}
+		if _, err := s.conn.Write([]byte(msg)); err != nil {
+			// reconnect on the next send.
+			s.conn.Close()
+			s.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syslogSink) close() {
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
@@ -0,0 +1,257 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslog
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSink struct {
+	mu      sync.Mutex
+	batches [][]string
+	closed  chan struct{}
+}
+
+func newMockSink() *mockSink {
+	return &mockSink{closed: make(chan struct{})}
+}
+
+func (s *mockSink) send(batch [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b []string
+	for _, data := range batch {
+		b = append(b, string(data))
+	}
+	s.batches = append(s.batches, b)
+	return nil
+}
+
+func (s *mockSink) close() {
+	close(s.closed)
+}
+
+func (s *mockSink) all() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var all []string
+	for _, b := range s.batches {
+		all = append(all, b...)
+	}
+	return all
+}
+
+func newTestShipper(spec *SinkSpec, sink sink, bufferSize int) *shipper {
+	s := &shipper{
+		spec:          spec,
+		sink:          sink,
+		batchSize:     spec.BatchSize,
+		flushInterval: time.Hour,
+		ch:            make(chan []byte, bufferSize),
+		done:          make(chan struct{}),
+	}
+	return s
+}
+
+func TestSinkSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &SinkSpec{}
+	assert.Error(spec.Validate())
+
+	spec.File = &FileSinkSpec{Path: "/tmp/access.log"}
+	assert.Nil(spec.Validate())
+
+	spec.Syslog = &SyslogSinkSpec{Address: "127.0.0.1:514"}
+	assert.Error(spec.Validate())
+
+	spec = &SinkSpec{FlushInterval: "abc", File: &FileSinkSpec{Path: "/tmp/access.log"}}
+	assert.Error(spec.Validate())
+
+	spec = &SinkSpec{Elasticsearch: &ElasticsearchSinkSpec{Endpoint: "http://127.0.0.1:9200", Index: "logs", Timeout: "-1s"}}
+	assert.Error(spec.Validate())
+}
+
+func TestShipperBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := newMockSink()
+	s := newTestShipper(&SinkSpec{BatchSize: 2}, sink, 10)
+	go s.run()
+
+	for i := 0; i < 5; i++ {
+		s.ship([]byte(fmt.Sprint(i)))
+	}
+	assert.Eventually(func() bool {
+		return len(sink.all()) == 4
+	}, time.Second, 10*time.Millisecond)
+
+	// the last one is shipped on close.
+	s.close()
+	<-sink.closed
+	assert.Equal([]string{"0", "1", "2", "3", "4"}, sink.all())
+	for _, b := range sink.batches {
+		assert.LessOrEqual(len(b), 2)
+	}
+	assert.Equal(&SinkStatus{Sent: 5}, s.status())
+}
+
+func TestShipperFlushInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	sink := newMockSink()
+	s := newTestShipper(&SinkSpec{BatchSize: 100}, sink, 10)
+	s.flushInterval = 10 * time.Millisecond
+	go s.run()
+	defer s.close()
+
+	s.ship([]byte("a"))
+	assert.Eventually(func() bool {
+		return len(sink.all()) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestShipperOverload(t *testing.T) {
+	assert := assert.New(t)
+
+	// the buffer is not consumed, so it is full after 2 access logs.
+	s := newTestShipper(&SinkSpec{BatchSize: 1}, newMockSink(), 2)
+	for i := 0; i < 4; i++ {
+		s.ship([]byte(fmt.Sprint(i)))
+	}
+	assert.Equal(uint64(2), s.status().Dropped)
+	assert.Equal("0", string(<-s.ch))
+	assert.Equal("1", string(<-s.ch))
+
+	s = newTestShipper(&SinkSpec{BatchSize: 1, OverloadPolicy: policyDropOldest}, newMockSink(), 2)
+	for i := 0; i < 4; i++ {
+		s.ship([]byte(fmt.Sprint(i)))
+	}
+	assert.Equal(uint64(2), s.status().Dropped)
+	assert.Equal("2", string(<-s.ch))
+	assert.Equal("3", string(<-s.ch))
+}
+
+func TestFileSink(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "access.log")
+	s := &fileSink{spec: &FileSinkSpec{Path: path, MaxSize: 1, MaxBackups: 2}}
+	defer s.close()
+
+	line := []byte(strings.Repeat("a", 1023))
+	batch := make([][]byte, 512)
+	for i := range batch {
+		batch[i] = line
+	}
+
+	// each batch is 512KB, so the file is rotated every 2 batches.
+	for i := 0; i < 7; i++ {
+		assert.Nil(s.send(batch))
+	}
+
+	fi, err := os.Stat(path)
+	assert.Nil(err)
+	assert.LessOrEqual(fi.Size(), int64(1024*1024))
+
+	// wait for the background clean up of the rotated files.
+	var backups []string
+	for i := 0; i < 100; i++ {
+		backups, _ = filepath.Glob(path + ".*")
+		if len(backups) == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Len(backups, 2)
+	for _, p := range backups {
+		fi, err := os.Stat(p)
+		assert.Nil(err)
+		assert.LessOrEqual(fi.Size(), int64(1024*1024))
+	}
+}
+
+func TestElasticsearchSink(t *testing.T) {
+	assert := assert.New(t)
+
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/_bulk", r.URL.Path)
+		user, pass, _ := r.BasicAuth()
+		assert.Equal("user", user)
+		assert.Equal("pass", pass)
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		if strings.Contains(body, "fail") {
+			w.Write([]byte(`{"errors":true}`))
+			return
+		}
+		w.Write([]byte(`{"errors":false}`))
+	}))
+	defer server.Close()
+
+	s := newElasticsearchSink(&ElasticsearchSinkSpec{
+		Endpoint: server.URL,
+		Index:    "logs",
+		Username: "user",
+		Password: "pass",
+	})
+	defer s.close()
+
+	assert.Nil(s.send([][]byte{[]byte(`{"method":"GET"}`), []byte("GET /")}))
+	expected := `{"index":{"_index":"logs"}}
+{"method":"GET"}
+{"index":{"_index":"logs"}}
+{"message":"GET /"}
+`
+	assert.Equal(expected, body)
+
+	assert.Error(s.send([][]byte{[]byte("fail")}))
+}
+
+func TestSyslogSink(t *testing.T) {
+	assert := assert.New(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(err)
+	defer conn.Close()
+
+	s := newSyslogSink(&SyslogSinkSpec{Address: conn.LocalAddr().String(), Tag: "gateway"})
+	defer s.close()
+	assert.Nil(s.send([][]byte{[]byte("GET /")}))
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.Nil(err)
+	msg := string(buf[:n])
+	assert.True(strings.HasPrefix(msg, "<134>1 "))
+	assert.True(strings.HasSuffix(msg, " gateway - - - GET /"))
+}
@@ -0,0 +1,298 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package accessschedule implements a filter to restrict the access to the
+// routes by schedule.
+package accessschedule
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/urlrule"
+)
+
+const (
+	// Kind is the kind of AccessSchedule.
+	Kind = "AccessSchedule"
+
+	resultOutOfWindow = "outOfWindow"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "AccessSchedule restricts the access to the routes by schedule.",
+	Results:     []string{resultOutOfWindow},
+	Indicators: []*filters.Indicator{
+		{Name: "open", Description: "Whether the requests are allowed now", Type: filters.IndicatorTypeBoolean},
+		{Name: "nextChange", Description: "Next time the access opens or closes", Type: filters.IndicatorTypeString},
+		{Name: "rejected", Description: "Number of the requests rejected out of the access windows", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &AccessSchedule{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// AccessSchedule is the filter to restrict the access by schedule.
+	AccessSchedule struct {
+		spec     *Spec
+		location *time.Location
+		windows  []*window
+		body     []byte
+
+		rejected uint64
+	}
+
+	// Spec is the spec of AccessSchedule.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Timezone is the IANA time zone of the windows, like
+		// America/New_York, default is UTC.
+		Timezone string `json:"timezone,omitempty"`
+		// Windows are the time windows, the requests are allowed in any
+		// of them.
+		Windows []*WindowSpec `json:"windows" jsonschema:"required,minItems=1"`
+		// Deny denies the requests in the windows instead of allowing
+		// them, like for the maintenance windows.
+		Deny bool `json:"deny,omitempty"`
+		// URLs are the requests restricted by the schedule, all requests
+		// are restricted if it is empty.
+		URLs []*urlrule.URLRule `json:"urls,omitempty"`
+		// Response is the response of the requests out of the access
+		// windows, default is 403 without body.
+		Response *ResponseSpec `json:"response,omitempty"`
+	}
+
+	// WindowSpec is the spec of a time window, which opens on a cron
+	// schedule and lasts for a duration.
+	WindowSpec struct {
+		// Start is a standard cron expression with 5 fields, like
+		// "30 9 * * MON-FRI".
+		Start    string `json:"start" jsonschema:"required"`
+		Duration string `json:"duration" jsonschema:"required,format=duration"`
+	}
+
+	// ResponseSpec is the spec of the response out of the access windows.
+	ResponseSpec struct {
+		StatusCode int               `json:"statusCode,omitempty" jsonschema:"format=httpcode"`
+		Headers    map[string]string `json:"headers,omitempty"`
+		Body       string            `json:"body,omitempty"`
+	}
+
+	// Status is the status of AccessSchedule.
+	Status struct {
+		// Open is whether the requests are allowed now.
+		Open bool `json:"open"`
+		// NextChange is the next time the access opens or closes, it is
+		// empty if unknown.
+		NextChange string `json:"nextChange,omitempty"`
+		Rejected   uint64 `json:"rejected"`
+	}
+
+	window struct {
+		schedule cron.Schedule
+		duration time.Duration
+	}
+)
+
+// Validate validates the spec of AccessSchedule.
+func (s *Spec) Validate() error {
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %s: %v", s.Timezone, err)
+	}
+	for _, w := range s.Windows {
+		if _, err := cron.ParseStandard(w.Start); err != nil {
+			return fmt.Errorf("invalid start %q: %v", w.Start, err)
+		}
+		if d, err := time.ParseDuration(w.Duration); err != nil || d <= 0 {
+			return fmt.Errorf("invalid duration %s", w.Duration)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the AccessSchedule filter instance.
+func (as *AccessSchedule) Name() string {
+	return as.spec.Name()
+}
+
+// Kind returns the kind of AccessSchedule.
+func (as *AccessSchedule) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the AccessSchedule.
+func (as *AccessSchedule) Spec() filters.Spec {
+	return as.spec
+}
+
+// Init initializes AccessSchedule.
+func (as *AccessSchedule) Init() {
+	as.reload()
+}
+
+// Inherit inherits previous generation of AccessSchedule.
+func (as *AccessSchedule) Inherit(previousGeneration filters.Filter) {
+	as.reload()
+}
+
+func (as *AccessSchedule) reload() {
+	// the spec has been validated, so the errors are impossible.
+	as.location, _ = time.LoadLocation(as.spec.Timezone)
+	for _, spec := range as.spec.Windows {
+		w := &window{}
+		w.schedule, _ = cron.ParseStandard(spec.Start)
+		w.duration, _ = time.ParseDuration(spec.Duration)
+		as.windows = append(as.windows, w)
+	}
+	for _, u := range as.spec.URLs {
+		u.Init()
+	}
+	if as.spec.Response != nil {
+		as.body = []byte(as.spec.Response.Body)
+	}
+}
+
+// end returns the end of the window containing t, or the zero time if t is
+// not in the window. The window is open if it starts in (t-duration, t].
+func (w *window) end(t time.Time) time.Time {
+	start := w.schedule.Next(t.Add(-w.duration))
+	if start.After(t) {
+		return time.Time{}
+	}
+	return start.Add(w.duration)
+}
+
+// inWindow reports whether t is in any of the windows, and returns the
+// time the windows open or close next. The time is approximate for the
+// overlapping windows.
+func (as *AccessSchedule) inWindow(t time.Time) (bool, time.Time) {
+	t = t.In(as.location)
+
+	var end time.Time
+	for _, w := range as.windows {
+		if e := w.end(t); e.After(end) {
+			end = e
+		}
+	}
+	if !end.IsZero() {
+		return true, end
+	}
+
+	var next time.Time
+	for _, w := range as.windows {
+		if n := w.schedule.Next(t); !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	return false, next
+}
+
+// open reports whether the requests are allowed at t, and returns the time
+// it changes.
+func (as *AccessSchedule) open(t time.Time) (bool, time.Time) {
+	in, change := as.inWindow(t)
+	return in != as.spec.Deny, change
+}
+
+func (as *AccessSchedule) match(req *httpprot.Request) bool {
+	if len(as.spec.URLs) == 0 {
+		return true
+	}
+	for _, u := range as.spec.URLs {
+		if u.Match(req.Std()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle rejects the request if it is out of the access windows.
+func (as *AccessSchedule) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if !as.match(req) {
+		return ""
+	}
+
+	now := time.Now()
+	open, change := as.open(now)
+	if open {
+		return ""
+	}
+
+	atomic.AddUint64(&as.rejected, 1)
+	ctx.AddTag("accessSchedule: out of the access windows")
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusForbidden)
+	if r := as.spec.Response; r != nil {
+		if r.StatusCode != 0 {
+			resp.SetStatusCode(r.StatusCode)
+		}
+		for k, v := range r.Headers {
+			resp.HTTPHeader().Set(k, v)
+		}
+	}
+	if !change.IsZero() && resp.HTTPHeader().Get("Retry-After") == "" {
+		retryAfter := int(math.Ceil(change.Sub(now).Seconds()))
+		resp.HTTPHeader().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+	resp.SetPayload(as.body)
+	ctx.SetOutputResponse(resp)
+	return resultOutOfWindow
+}
+
+// NeedPayload returns false for both payloads, it implements
+// context.PayloadNeeder.
+func (as *AccessSchedule) NeedPayload() (request, response bool) {
+	return false, false
+}
+
+// Status returns Status generated by Runtime.
+func (as *AccessSchedule) Status() interface{} {
+	open, change := as.open(time.Now())
+	s := &Status{
+		Open:     open,
+		Rejected: atomic.LoadUint64(&as.rejected),
+	}
+	if !change.IsZero() {
+		s.NextChange = change.Format(time.RFC3339)
+	}
+	return s
+}
+
+// Close closes AccessSchedule.
+func (as *AccessSchedule) Close() {
+}
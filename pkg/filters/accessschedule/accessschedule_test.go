@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accessschedule
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func newAccessSchedule(t *testing.T, yamlConfig string) *AccessSchedule {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	as := kind.CreateInstance(spec).(*AccessSchedule)
+	as.Init()
+	return as
+}
+
+func newContext(t *testing.T, path string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1"+path, nil)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	w := &WindowSpec{Start: "30 9 * * MON-FRI", Duration: "6h30m"}
+	assert.NoError((&Spec{Windows: []*WindowSpec{w}}).Validate())
+	assert.NoError((&Spec{Timezone: "America/New_York", Windows: []*WindowSpec{w}}).Validate())
+	assert.Error((&Spec{Timezone: "Mars/Olympus", Windows: []*WindowSpec{w}}).Validate())
+
+	bad := &WindowSpec{Start: "30 9 * *", Duration: "1h"}
+	assert.Error((&Spec{Windows: []*WindowSpec{bad}}).Validate())
+	bad = &WindowSpec{Start: "30 9 * * *", Duration: "0s"}
+	assert.Error((&Spec{Windows: []*WindowSpec{bad}}).Validate())
+}
+
+func TestWindows(t *testing.T) {
+	assert := assert.New(t)
+
+	as := newAccessSchedule(t, `
+kind: AccessSchedule
+name: as
+timezone: America/New_York
+windows:
+- start: "30 9 * * MON-FRI"
+  duration: 6h30m
+`)
+	loc, _ := time.LoadLocation("America/New_York")
+
+	// Wednesday, in the window.
+	open, change := as.open(time.Date(2023, 6, 7, 12, 0, 0, 0, loc))
+	assert.True(open)
+	assert.Equal(time.Date(2023, 6, 7, 16, 0, 0, 0, loc), change)
+
+	// the window start is included and the end is excluded.
+	open, _ = as.open(time.Date(2023, 6, 7, 9, 30, 0, 0, loc))
+	assert.True(open)
+	open, change = as.open(time.Date(2023, 6, 7, 16, 0, 0, 0, loc))
+	assert.False(open)
+	assert.Equal(time.Date(2023, 6, 8, 9, 30, 0, 0, loc), change)
+
+	// Saturday, opens on Monday.
+	open, change = as.open(time.Date(2023, 6, 10, 12, 0, 0, 0, loc))
+	assert.False(open)
+	assert.Equal(time.Date(2023, 6, 12, 9, 30, 0, 0, loc), change)
+
+	// the time zone of the input does not matter.
+	open, _ = as.open(time.Date(2023, 6, 7, 16, 0, 0, 0, time.UTC))
+	assert.True(open)
+	open, _ = as.open(time.Date(2023, 6, 7, 21, 0, 0, 0, time.UTC))
+	assert.False(open)
+}
+
+func TestDenyWindows(t *testing.T) {
+	assert := assert.New(t)
+
+	as := newAccessSchedule(t, `
+kind: AccessSchedule
+name: as
+deny: true
+windows:
+- start: "0 2 * * SUN"
+  duration: 2h
+`)
+
+	open, change := as.open(time.Date(2023, 6, 11, 3, 0, 0, 0, time.UTC))
+	assert.False(open)
+	assert.Equal(time.Date(2023, 6, 11, 4, 0, 0, 0, time.UTC), change)
+
+	open, change = as.open(time.Date(2023, 6, 11, 4, 0, 0, 0, time.UTC))
+	assert.True(open)
+	assert.Equal(time.Date(2023, 6, 18, 2, 0, 0, 0, time.UTC), change)
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	// the window is always open, so the requests are always denied.
+	as := newAccessSchedule(t, `
+kind: AccessSchedule
+name: as
+deny: true
+windows:
+- start: "* * * * *"
+  duration: 1m
+urls:
+- url:
+    prefix: /trade
+response:
+  statusCode: 503
+  headers:
+    Content-Type: text/plain
+  body: closed
+`)
+	assert.Equal(Kind, as.Kind().Name)
+	assert.Equal("as", as.Name())
+
+	ctx := newContext(t, "/trade/orders")
+	assert.Equal(resultOutOfWindow, as.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode())
+	assert.Equal("text/plain", resp.Std().Header.Get("Content-Type"))
+	assert.NotEmpty(resp.Std().Header.Get("Retry-After"))
+	assert.Equal("closed", string(resp.RawPayload()))
+
+	// not restricted.
+	ctx = newContext(t, "/quotes")
+	assert.Empty(as.Handle(ctx))
+
+	status := as.Status().(*Status)
+	assert.False(status.Open)
+	assert.Equal(uint64(1), status.Rejected)
+
+	// the requests are always allowed.
+	as2 := kind.CreateInstance(&Spec{
+		Windows: []*WindowSpec{{Start: "* * * * *", Duration: "1m"}},
+	}).(*AccessSchedule)
+	as2.Inherit(as)
+	assert.Empty(as2.Handle(newContext(t, "/trade/orders")))
+	assert.True(as2.Status().(*Status).Open)
+
+	as.Close()
+	as2.Close()
+}
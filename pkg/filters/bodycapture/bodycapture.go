@@ -0,0 +1,429 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package bodycapture implements a filter to capture the bodies of the
+// requests and the responses with the sensitive data redacted.
+package bodycapture
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/filters/accesslog"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/urlrule"
+)
+
+const (
+	// Kind is the kind of BodyCapture.
+	Kind = "BodyCapture"
+
+	defaultMaxBodySize = 4096
+	defaultBufferSize  = 100
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "BodyCapture captures the bodies of the requests and the responses with the sensitive data redacted.",
+	Results:     []string{},
+	Indicators: []*filters.Indicator{
+		{Name: "captured", Description: "Number of the captured requests", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &BodyCapture{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// BodyCapture is the filter to capture the bodies of the requests and
+	// the responses.
+	BodyCapture struct {
+		spec     *Spec
+		redactor *redactor
+		buffer   *buffer
+		shippers []*accesslog.Shipper
+	}
+
+	// Spec is the spec of BodyCapture.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// URLs are the requests to capture, all requests are captured if
+		// it is empty.
+		URLs []*urlrule.URLRule `json:"urls,omitempty"`
+		// SampleRate is the fraction of the matching requests captured,
+		// default is 1.
+		SampleRate float64 `json:"sampleRate,omitempty" jsonschema:"minimum=0,maximum=1"`
+		// MaxBodySize is the max size of the captured bodies, they are
+		// truncated beyond it after the redaction.
+		MaxBodySize int `json:"maxBodySize,omitempty" jsonschema:"minimum=1"`
+		// BufferSize is the number of the most recent captures kept in
+		// memory for the admin API, 0 means the default, and -1 disables
+		// the buffer.
+		BufferSize int `json:"bufferSize,omitempty" jsonschema:"minimum=-1"`
+
+		// RedactHeaders are the headers whose values are redacted, in
+		// addition to the credentials like Authorization and Cookie.
+		RedactHeaders []string `json:"redactHeaders,omitempty"`
+		// RedactFields are the fields of JSON and form bodies, and the
+		// query parameters, whose values are redacted. A name matches the
+		// fields at any depth, and a dotted path, like user.ssn, matches
+		// the field from the root.
+		RedactFields []string `json:"redactFields,omitempty"`
+		// RedactPatterns are the regular expressions of the text redacted
+		// from the URLs and the bodies.
+		RedactPatterns []string `json:"redactPatterns,omitempty"`
+
+		// Sinks ship the captures to other targets, one JSON per capture.
+		Sinks []*accesslog.SinkSpec `json:"sinks,omitempty"`
+	}
+
+	// Capture is a captured request and its response.
+	Capture struct {
+		Time     time.Time        `json:"time"`
+		Pipeline string           `json:"pipeline"`
+		Filter   string           `json:"filter"`
+		Request  *CapturedRequest `json:"request"`
+		// Response is nil if no response is built, like the request is
+		// rejected by the HTTPServer.
+		Response *CapturedResponse `json:"response,omitempty"`
+	}
+
+	// CapturedRequest is a captured request, as it is when it reaches the
+	// filter.
+	CapturedRequest struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header,omitempty"`
+		CapturedBody
+	}
+
+	// CapturedResponse is a captured response, as it is sent to the
+	// client.
+	CapturedResponse struct {
+		StatusCode int         `json:"statusCode"`
+		Header     http.Header `json:"header,omitempty"`
+		CapturedBody
+	}
+
+	// CapturedBody is a redacted body truncated to the max body size, the
+	// body of a stream is not captured.
+	CapturedBody struct {
+		Body          string `json:"body,omitempty"`
+		BodySize      int64  `json:"bodySize"`
+		BodyTruncated bool   `json:"bodyTruncated,omitempty"`
+		Stream        bool   `json:"stream,omitempty"`
+	}
+
+	// Status is the status of BodyCapture.
+	Status struct {
+		Captured uint64                  `json:"captured"`
+		Sinks    []*accesslog.SinkStatus `json:"sinks,omitempty"`
+	}
+
+	// buffer keeps the most recent captures, it is shared by the
+	// generations of the filter.
+	buffer struct {
+		mutex    sync.Mutex
+		entries  []*Capture
+		next     int
+		count    int
+		captured uint64
+	}
+)
+
+// Validate validates the spec of BodyCapture.
+func (s *Spec) Validate() error {
+	for _, p := range s.RedactPatterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("invalid redact pattern %s: %v", p, err)
+		}
+	}
+	for i, sink := range s.Sinks {
+		if err := sink.Validate(); err != nil {
+			return fmt.Errorf("sinks[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the BodyCapture filter instance.
+func (bc *BodyCapture) Name() string {
+	return bc.spec.Name()
+}
+
+// Kind returns the kind of BodyCapture.
+func (bc *BodyCapture) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the BodyCapture.
+func (bc *BodyCapture) Spec() filters.Spec {
+	return bc.spec
+}
+
+// Init initializes BodyCapture.
+func (bc *BodyCapture) Init() {
+	bc.reload(nil)
+}
+
+// Inherit inherits previous generation of BodyCapture, the captures in the
+// buffer are kept.
+func (bc *BodyCapture) Inherit(previousGeneration filters.Filter) {
+	bc.reload(previousGeneration.(*BodyCapture))
+}
+
+func (bc *BodyCapture) reload(prev *BodyCapture) {
+	for _, u := range bc.spec.URLs {
+		u.Init()
+	}
+	bc.redactor = newRedactor(bc.spec.RedactHeaders, bc.spec.RedactFields, bc.spec.RedactPatterns)
+
+	if prev != nil {
+		bc.buffer = prev.buffer
+	} else {
+		bc.buffer = &buffer{}
+	}
+	size := bc.spec.BufferSize
+	if size == 0 {
+		size = defaultBufferSize
+	}
+	bc.buffer.resize(size)
+
+	for _, spec := range bc.spec.Sinks {
+		bc.shippers = append(bc.shippers, accesslog.NewShipper(bc.spec.Name(), spec))
+	}
+}
+
+func (bc *BodyCapture) match(req *httpprot.Request) bool {
+	if len(bc.spec.URLs) > 0 {
+		matched := false
+		for _, u := range bc.spec.URLs {
+			if u.Match(req.Std()) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	rate := bc.spec.SampleRate
+	return rate == 0 || rate >= 1 || rand.Float64() < rate
+}
+
+// Handle captures the request as it is now, and the response after it is
+// sent to the client, so the filter could be anywhere in the flow.
+func (bc *BodyCapture) Handle(ctx *context.Context) string {
+	req, ok := ctx.GetInputRequest().(*httpprot.Request)
+	if !ok || !bc.match(req) {
+		return ""
+	}
+
+	c := &Capture{
+		Time:     time.Now(),
+		Pipeline: bc.spec.Pipeline(),
+		Filter:   bc.spec.Name(),
+		Request: &CapturedRequest{
+			Method: req.Method(),
+			URL:    bc.redactor.redactURL(req.URL()),
+			Header: bc.redactor.redactHeader(req.HTTPHeader()),
+		},
+	}
+	// the payload is not copied, as the filters replace it instead of
+	// modifying it, and it is redacted after the response is sent.
+	var reqBody []byte
+	if req.IsStream() {
+		c.Request.Stream = true
+	} else {
+		reqBody = req.RawPayload()
+	}
+	reqContentType := req.HTTPHeader().Get("Content-Type")
+
+	ctx.OnFinish(func() {
+		if req.IsStream() {
+			c.Request.BodySize = req.PayloadSize()
+		} else {
+			c.Request.CapturedBody = bc.body(reqContentType, reqBody)
+		}
+
+		if resp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response); ok {
+			c.Response = &CapturedResponse{
+				StatusCode: resp.StatusCode(),
+				Header:     bc.redactor.redactHeader(resp.HTTPHeader()),
+			}
+			if resp.IsStream() {
+				c.Response.Stream = true
+				c.Response.BodySize = resp.PayloadSize()
+			} else {
+				c.Response.CapturedBody = bc.body(resp.HTTPHeader().Get("Content-Type"), resp.RawPayload())
+			}
+		}
+
+		bc.buffer.add(c)
+		if len(bc.shippers) > 0 {
+			data, err := codectool.MarshalJSON(c)
+			if err != nil {
+				return
+			}
+			for _, s := range bc.shippers {
+				s.Ship(data)
+			}
+		}
+	})
+
+	return ""
+}
+
+// body redacts the body, then truncates it to the max body size. It is
+// redacted first, so a secret across the truncation point is not leaked.
+func (bc *BodyCapture) body(contentType string, data []byte) CapturedBody {
+	b := CapturedBody{BodySize: int64(len(data))}
+	if len(data) == 0 {
+		return b
+	}
+
+	maxBodySize := bc.spec.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultMaxBodySize
+	}
+	b.Body = bc.redactor.redactBody(contentType, data)
+	if len(b.Body) > maxBodySize {
+		b.Body, b.BodyTruncated = b.Body[:maxBodySize], true
+	}
+	return b
+}
+
+// Captures returns the captures in the buffer, the most recent first.
+func (bc *BodyCapture) Captures() interface{} {
+	return bc.buffer.list()
+}
+
+// ClearCaptures removes the captures in the buffer.
+func (bc *BodyCapture) ClearCaptures() {
+	bc.buffer.clear()
+}
+
+// Status returns Status generated by Runtime.
+func (bc *BodyCapture) Status() interface{} {
+	s := &Status{Captured: atomic.LoadUint64(&bc.buffer.captured)}
+	for _, shipper := range bc.shippers {
+		s.Sinks = append(s.Sinks, shipper.Status())
+	}
+	return s
+}
+
+// Close closes BodyCapture, the captures in the buffers of the sinks are
+// shipped before the sinks are closed.
+func (bc *BodyCapture) Close() {
+	for _, s := range bc.shippers {
+		s.Close()
+	}
+}
+
+// resize changes the size of the buffer, the most recent captures are
+// kept, and the buffer is disabled if size is negative.
+func (b *buffer) resize(size int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if size < 0 {
+		size = 0
+	}
+	if size == len(b.entries) {
+		return
+	}
+
+	entries := b.oldestFirst()
+	if len(entries) > size {
+		entries = entries[len(entries)-size:]
+	}
+	b.entries = make([]*Capture, size)
+	b.count = copy(b.entries, entries)
+	b.next = 0
+	if size > 0 {
+		b.next = b.count % size
+	}
+}
+
+func (b *buffer) add(c *Capture) {
+	atomic.AddUint64(&b.captured, 1)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.entries) == 0 {
+		return
+	}
+	b.entries[b.next] = c
+	b.next = (b.next + 1) % len(b.entries)
+	if b.count < len(b.entries) {
+		b.count++
+	}
+}
+
+// oldestFirst returns the captures, the oldest first, the caller must hold
+// the mutex.
+func (b *buffer) oldestFirst() []*Capture {
+	entries := make([]*Capture, 0, b.count)
+	size := len(b.entries)
+	start := 0
+	if size > 0 {
+		start = (b.next - b.count + size) % size
+	}
+	for i := 0; i < b.count; i++ {
+		entries = append(entries, b.entries[(start+i)%size])
+	}
+	return entries
+}
+
+// list returns the captures, the most recent first.
+func (b *buffer) list() []*Capture {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	entries := b.oldestFirst()
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries
+}
+
+func (b *buffer) clear() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for i := range b.entries {
+		b.entries[i] = nil
+	}
+	b.next, b.count = 0, 0
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodycapture
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func newBodyCapture(t *testing.T, yamlConfig string) *BodyCapture {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	bc := kind.CreateInstance(spec).(*BodyCapture)
+	bc.Init()
+	return bc
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{RedactPatterns: []string{`\d{16}`}}).Validate())
+	assert.Error((&Spec{RedactPatterns: []string{`(`}}).Validate())
+}
+
+func TestRedactor(t *testing.T) {
+	assert := assert.New(t)
+
+	r := newRedactor([]string{"X-Secret"}, []string{"password", "user.ssn"}, []string{`\d{4}-\d{4}-\d{4}-\d{4}`})
+
+	h := http.Header{}
+	h.Set("Authorization", "Bearer abc")
+	h.Set("X-Secret", "s")
+	h.Set("X-Other", "o")
+	redactedHeader := r.redactHeader(h)
+	assert.Equal(redacted, redactedHeader.Get("Authorization"))
+	assert.Equal(redacted, redactedHeader.Get("X-Secret"))
+	assert.Equal("o", redactedHeader.Get("X-Other"))
+	assert.Equal("Bearer abc", h.Get("Authorization"), "the original header is not changed")
+
+	u, _ := url.Parse("http://127.0.0.1/login?name=alice&password=123")
+	assert.NotContains(r.redactURL(u), "123")
+	assert.Contains(r.redactURL(u), "name=alice")
+
+	body := r.redactBody("application/json", []byte(`{"password":"p","user":{"ssn":"1","name":"a"},"ssn":"2","card":"1234-5678-9012-3456"}`))
+	assert.NotContains(body, `"p"`)
+	assert.NotContains(body, `"1"`)
+	assert.Contains(body, `"ssn":"2"`, "dotted path only matches from the root")
+	assert.Contains(body, `"name":"a"`)
+	assert.NotContains(body, "1234-5678")
+
+	body = r.redactBody("application/x-www-form-urlencoded", []byte("name=alice&password=123"))
+	assert.NotContains(body, "123")
+	assert.Contains(body, "name=alice")
+
+	body = r.redactBody("text/plain", []byte("card 1234-5678-9012-3456"))
+	assert.Equal("card "+redacted, body)
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	bc := newBodyCapture(t, `
+kind: BodyCapture
+name: bc
+maxBodySize: 20
+bufferSize: 2
+redactFields: [password]
+urls:
+- url:
+    prefix: /login
+`)
+	defer bc.Close()
+
+	handle := func(path, body string) {
+		ctx := context.New(nil)
+		stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1"+path, strings.NewReader(body))
+		stdr.Header.Set("Content-Type", "application/json")
+		req, err := httpprot.NewRequest(stdr)
+		assert.NoError(err)
+		assert.NoError(req.FetchPayload(0))
+		ctx.SetInputRequest(req)
+
+		assert.Equal("", bc.Handle(ctx))
+
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(http.StatusUnauthorized)
+		resp.SetPayload([]byte("denied"))
+		ctx.SetOutputResponse(resp)
+		ctx.Finish()
+	}
+
+	handle("/other", `{}`)
+	assert.Empty(bc.Captures())
+
+	handle("/login", `{"name":"alice","password":"123"}`)
+	captures := bc.Captures().([]*Capture)
+	assert.Len(captures, 1)
+	c := captures[0]
+	assert.Equal(http.MethodPost, c.Request.Method)
+	assert.NotContains(c.Request.Body, "123")
+	assert.True(c.Request.BodyTruncated)
+	assert.Len(c.Request.Body, 20)
+	assert.Equal(http.StatusUnauthorized, c.Response.StatusCode)
+	assert.Equal("denied", c.Response.Body)
+
+	// the buffer keeps the most recent captures, and it is kept by the
+	// next generation.
+	handle("/login/2", `{}`)
+	handle("/login/3", `{}`)
+	captures = bc.Captures().([]*Capture)
+	assert.Len(captures, 2)
+	assert.Contains(captures[0].Request.URL, "/login/3")
+	assert.Contains(captures[1].Request.URL, "/login/2")
+
+	next := kind.CreateInstance(bc.spec).(*BodyCapture)
+	next.Inherit(bc)
+	assert.Len(next.Captures(), 2)
+	assert.Equal(uint64(3), next.Status().(*Status).Captured)
+
+	next.ClearCaptures()
+	assert.Empty(next.Captures())
+}
+
+func TestBuffer(t *testing.T) {
+	assert := assert.New(t)
+
+	b := &buffer{}
+	b.resize(3)
+	for i := 0; i < 5; i++ {
+		b.add(&Capture{Filter: string(rune('a' + i))})
+	}
+	names := func() string {
+		s := ""
+		for _, c := range b.list() {
+			s += c.Filter
+		}
+		return s
+	}
+	assert.Equal("edc", names())
+
+	b.resize(2)
+	assert.Equal("ed", names())
+	b.resize(4)
+	assert.Equal("ed", names())
+	b.add(&Capture{Filter: "f"})
+	assert.Equal("fed", names())
+
+	b.resize(-1)
+	b.add(&Capture{Filter: "g"})
+	assert.Empty(b.list())
+}
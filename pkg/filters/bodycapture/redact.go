@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodycapture
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// defaultRedactHeaders are the headers always redacted.
+var defaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// redactor redacts the sensitive data from the captured requests and
+// responses before they are stored.
+type redactor struct {
+	headers []string
+	// names are the field names redacted at any depth, paths are the
+	// dotted paths of the fields redacted from the root, both are in lower
+	// case.
+	names    map[string]bool
+	paths    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+// newRedactor creates a redactor, the patterns have been validated.
+func newRedactor(headers, fields, patterns []string) *redactor {
+	r := &redactor{
+		headers: append(append([]string{}, defaultRedactHeaders...), headers...),
+		names:   map[string]bool{},
+		paths:   map[string]bool{},
+	}
+	for _, f := range fields {
+		f = strings.ToLower(f)
+		if strings.Contains(f, ".") {
+			r.paths[f] = true
+		} else {
+			r.names[f] = true
+		}
+	}
+	for _, p := range patterns {
+		r.patterns = append(r.patterns, regexp.MustCompile(p))
+	}
+	return r
+}
+
+func (r *redactor) isSensitive(name, path string) bool {
+	return r.names[strings.ToLower(name)] || r.paths[strings.ToLower(path)]
+}
+
+func (r *redactor) redactText(s string) string {
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+func (r *redactor) redactHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range r.headers {
+		if values := h.Values(name); len(values) > 0 {
+			h.Set(name, redacted)
+		}
+	}
+	return h
+}
+
+// redactURL redacts the sensitive query parameters and the patterns.
+func (r *redactor) redactURL(u *url.URL) string {
+	if u.RawQuery != "" && (len(r.names) > 0 || len(r.paths) > 0) {
+		u = &url.URL{
+			Scheme:   u.Scheme,
+			Host:     u.Host,
+			Path:     u.Path,
+			RawPath:  u.RawPath,
+			RawQuery: r.redactForm(u.RawQuery),
+		}
+	}
+	return r.redactText(u.String())
+}
+
+// redactForm redacts the sensitive fields of a URL encoded form, it is
+// returned as is if it can not be parsed.
+func (r *redactor) redactForm(s string) string {
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		return s
+	}
+	changed := false
+	for name, v := range values {
+		if r.isSensitive(name, name) {
+			for i := range v {
+				v[i] = redacted
+			}
+			changed = true
+		}
+	}
+	if !changed {
+		return s
+	}
+	return values.Encode()
+}
+
+// redactJSON redacts the values of the sensitive fields, the fields are
+// matched by the names at any depth, or by the dotted paths from the root,
+// where the indexes of the arrays are omitted.
+func (r *redactor) redactJSON(v interface{}, path string) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, fv := range x {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			if r.isSensitive(k, p) {
+				x[k] = redacted
+			} else {
+				x[k] = r.redactJSON(fv, p)
+			}
+		}
+	case []interface{}:
+		for i, ev := range x {
+			x[i] = r.redactJSON(ev, path)
+		}
+	}
+	return v
+}
+
+// redactBody redacts the sensitive fields of a JSON or form body according
+// to its content type, and then the patterns.
+func (r *redactor) redactBody(contentType string, body []byte) string {
+	s := string(body)
+	if len(r.names) > 0 || len(r.paths) > 0 {
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		switch {
+		case mediaType == "application/x-www-form-urlencoded":
+			s = r.redactForm(s)
+		case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+			// the numbers are kept as they are, like the large IDs.
+			var v interface{}
+			d := json.NewDecoder(bytes.NewReader(body))
+			d.UseNumber()
+			if err := d.Decode(&v); err == nil {
+				if data, err := json.Marshal(r.redactJSON(v, "")); err == nil {
+					s = string(data)
+				}
+			}
+		}
+	}
+	return r.redactText(s)
+}
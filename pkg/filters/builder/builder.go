@@ -21,6 +21,7 @@ package builder
 import (
 	"bytes"
 	"text/template"
+	"text/template/parse"
 
 	sprig "github.com/go-task/slim-sprig"
 	"github.com/megaease/easegress/v2/pkg/context"
@@ -35,6 +36,9 @@ type (
 	// Builder is the base HTTP builder.
 	Builder struct {
 		template *template.Template
+		// readsBody is true if the template may read the body of the
+		// requests or the responses.
+		readsBody bool
 	}
 
 	// Spec is the spec of Builder.
@@ -54,6 +58,115 @@ func (b *Builder) reload(spec *Spec) {
 	t := template.New("").Delims(spec.LeftDelim, spec.RightDelim)
 	t.Funcs(sprig.TxtFuncMap()).Funcs(extraFuncs)
 	b.template = template.Must(t.Parse(spec.Template))
+	b.readsBody = templateReadsBody(b.template)
+}
+
+// bodyFields are the fields of the requests and the responses in the
+// template data which read their bodies.
+var bodyFields = map[string]bool{
+	"Body":     true,
+	"RawBody":  true,
+	"JSONBody": true,
+	"YAMLBody": true,
+	"GetBody":  true,
+}
+
+// templateReadsBody inspects the parse trees of the template, and returns
+// whether it may read the body of the requests or the responses. It is
+// conservative: besides referencing a body field, a template passing the
+// whole data, a request or a response to a function or an action, like
+// {{toJson .req}} or {{with .req}}, may read the body too.
+func templateReadsBody(t *template.Template) bool {
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil && nodeReadsBody(tmpl.Tree.Root) {
+			return true
+		}
+	}
+	return false
+}
+
+func nodeReadsBody(node parse.Node) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if nodeReadsBody(child) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return nodeReadsBody(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			if nodeReadsBody(cmd) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if nodeReadsBody(arg) {
+				return true
+			}
+		}
+	case *parse.IfNode:
+		return nodeReadsBody(n.Pipe) || nodeReadsBody(n.List) || nodeReadsBody(n.ElseList)
+	case *parse.RangeNode:
+		return nodeReadsBody(n.Pipe) || nodeReadsBody(n.List) || nodeReadsBody(n.ElseList)
+	case *parse.WithNode:
+		return nodeReadsBody(n.Pipe) || nodeReadsBody(n.List) || nodeReadsBody(n.ElseList)
+	case *parse.TemplateNode:
+		return nodeReadsBody(n.Pipe)
+	case *parse.ChainNode:
+		return nodeReadsBody(n.Node) || fieldsReadBody(n.Field, false)
+	case *parse.FieldNode:
+		return fieldsReadBody(n.Ident, true)
+	case *parse.VariableNode:
+		// $ is the whole data, the other variables are assigned from the
+		// fields checked in their declarations.
+		if n.Ident[0] == "$" {
+			return fieldsReadBody(n.Ident[1:], true)
+		}
+		return fieldsReadBody(n.Ident[1:], false)
+	case *parse.DotNode:
+		return true
+	}
+	return false
+}
+
+// fieldsReadBody returns whether the field chain may read a body, fromData
+// is true if the chain starts from the template data.
+func fieldsReadBody(idents []string, fromData bool) bool {
+	for _, ident := range idents {
+		if bodyFields[ident] {
+			return true
+		}
+	}
+	if !fromData {
+		return false
+	}
+
+	// the chain ends at the whole data, a request or a response.
+	if len(idents) == 0 {
+		return true
+	}
+	switch idents[0] {
+	case "req", "resp":
+		return len(idents) == 1
+	case "requests", "responses":
+		return len(idents) <= 2
+	}
+	return false
+}
+
+// NeedPayload returns whether the payloads are needed by the template, it
+// implements context.PayloadNeeder.
+func (b *Builder) NeedPayload() (request, response bool) {
+	return b.readsBody, b.readsBody
 }
 
 func (b *Builder) build(data map[string]interface{}, v interface{}) error {
@@ -44,3 +44,36 @@ func TestBuilderSpec(t *testing.T) {
 	err = invalidSpec2.Validate()
 	assert.Nil(err)
 }
+
+func TestBuilderNeedPayload(t *testing.T) {
+	assert := assert.New(t)
+
+	b := &Builder{}
+	b.reload(&Spec{Template: "header: {{.req.Header}}"})
+	req, resp := b.NeedPayload()
+	assert.False(req)
+	assert.False(resp)
+
+	b.reload(&Spec{Template: "body: {{.req.Body}}"})
+	req, resp = b.NeedPayload()
+	assert.True(req)
+	assert.True(resp)
+
+	for tmpl, readsBody := range map[string]bool{
+		"{{.req.Method}} {{.req.URL.Path}}":                     false,
+		"{{.responses.backend.StatusCode}}":                     false,
+		"{{range $k, $v := .req.Header}}{{$k}}: {{$v}}{{end}}":  false,
+		"{{.data.user}} {{.namespace}}":                         false,
+		"{{.requests.backend.JSONBody.name}}":                   true,
+		"{{$.resp.RawBody}}":                                    true,
+		"{{toJson .req}}":                                       true,
+		"{{with .req}}{{.Method}}{{end}}":                       true,
+		"{{$r := .responses.backend}}{{$r.Header}}":             true,
+		"{{toJson .}}":                                          true,
+		`{{define "x"}}{{.Method}}{{end}}{{template "x" .req}}`: true,
+		`{{define "x"}}{{.req.Body}}{{end}}{{.req.Method}}`:     true,
+	} {
+		b.reload(&Spec{Template: tmpl})
+		assert.Equal(readsBody, b.readsBody, tmpl)
+	}
+}
@@ -66,6 +66,9 @@ func (spec *DataBuilderSpec) Validate() error {
 	if spec.DataKey == "" {
 		return fmt.Errorf("dataKey must be specified")
 	}
+	if err := context.ValidateUserDataKey(spec.DataKey); err != nil {
+		return err
+	}
 
 	if spec.Template == "" {
 		return fmt.Errorf("template must be specified")
@@ -74,6 +77,17 @@ func (spec *DataBuilderSpec) Validate() error {
 	return spec.Spec.Validate()
 }
 
+// DataInputs returns the data read by DataBuilder, the template could read
+// any data, but none of them is required.
+func (spec *DataBuilderSpec) DataInputs() []context.DataDecl {
+	return nil
+}
+
+// DataOutputs returns the data written by DataBuilder.
+func (spec *DataBuilderSpec) DataOutputs() []context.DataDecl {
+	return []context.DataDecl{context.AnyData(spec.DataKey)}
+}
+
 // Name returns the name of the DataBuilder filter instance.
 func (db *DataBuilder) Name() string {
 	return db.spec.Name()
@@ -118,6 +132,6 @@ func (db *DataBuilder) Handle(ctx *context.Context) (result string) {
 		return resultBuildErr
 	}
 
-	ctx.SetData(db.spec.DataKey, r)
+	context.NewUserDataKey[interface{}](db.spec.DataKey).Set(ctx, r)
 	return ""
 }
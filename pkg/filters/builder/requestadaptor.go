@@ -414,6 +414,16 @@ func (ra *RequestAdaptor) signRequest(req *httpprot.Request) string {
 	return ""
 }
 
+// NeedPayload returns whether the payloads are needed by the template, and
+// the request payload is also needed to sign the request with its body.
+func (ra *RequestAdaptor) NeedPayload() (request, response bool) {
+	request, response = ra.Builder.NeedPayload()
+	if s := ra.spec.Sign; s != nil && !s.ExcludeBody {
+		request = true
+	}
+	return request, response
+}
+
 // Status returns status.
 func (ra *RequestAdaptor) Status() interface{} {
 	return nil
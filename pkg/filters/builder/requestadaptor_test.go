@@ -404,3 +404,19 @@ func TestRequestAdaptorProcessCompressDecompress(t *testing.T) {
 
 	assert.Empty(ra.processDecompress(req))
 }
+
+func TestRequestAdaptorNeedPayload(t *testing.T) {
+	assert := assert.New(t)
+
+	ra := &RequestAdaptor{spec: &RequestAdaptorSpec{}}
+	ra.Init()
+	req, resp := ra.NeedPayload()
+	assert.False(req)
+	assert.False(resp)
+
+	ra = &RequestAdaptor{spec: &RequestAdaptorSpec{Sign: &SignerSpec{}}}
+	ra.Init()
+	req, resp = ra.NeedPayload()
+	assert.True(req)
+	assert.False(resp)
+}
@@ -18,6 +18,7 @@
 package builder
 
 import (
+	"fmt"
 	"io"
 	"strconv"
 	"strings"
@@ -27,6 +28,7 @@ import (
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot/httpheader"
+	"github.com/megaease/easegress/v2/pkg/util/inlinetemplate"
 	"github.com/megaease/easegress/v2/pkg/util/readers"
 )
 
@@ -62,6 +64,7 @@ type (
 	ResponseAdaptor struct {
 		spec *ResponseAdaptorSpec
 		Builder
+		renderer *inlinetemplate.Renderer
 	}
 
 	// ResponseAdaptorSpec is HTTPAdaptor ResponseAdaptorSpec.
@@ -72,6 +75,10 @@ type (
 		ResponseAdaptorTemplate `json:",inline"`
 		Compress                string `json:"compress,omitempty"`
 		Decompress              string `json:"decompress,omitempty"`
+
+		// BodyTemplate is an inline template of the body, it is mutually
+		// exclusive with Body.
+		BodyTemplate *inlinetemplate.Spec `json:"bodyTemplate,omitempty"`
 	}
 
 	// ResponseAdaptorTemplate is the template of ResponseAdaptor.
@@ -81,6 +88,27 @@ type (
 	}
 )
 
+// TemplateReferences returns the shared template of the body template.
+func (spec *ResponseAdaptorSpec) TemplateReferences() []string {
+	if spec.BodyTemplate == nil {
+		return nil
+	}
+	return []string{spec.BodyTemplate.Ref}
+}
+
+// Validate validates the ResponseAdaptor Spec.
+func (spec *ResponseAdaptorSpec) Validate() error {
+	if spec.BodyTemplate != nil {
+		if spec.Body != "" {
+			return fmt.Errorf("body and bodyTemplate are mutually exclusive")
+		}
+		if err := spec.BodyTemplate.Validate(); err != nil {
+			return err
+		}
+	}
+	return spec.Spec.Validate()
+}
+
 // Name returns the name of the ResponseAdaptor filter instance.
 func (ra *ResponseAdaptor) Name() string {
 	return ra.spec.Name()
@@ -107,7 +135,7 @@ func (ra *ResponseAdaptor) Init() {
 	if ra.spec.Compress != "" && ra.spec.Decompress != "" {
 		panic("ResponseAdaptor can only do compress or decompress for given request body, not both")
 	}
-	if ra.spec.Body != "" && ra.spec.Decompress != "" {
+	if (ra.spec.Body != "" || ra.spec.BodyTemplate != nil) && ra.spec.Decompress != "" {
 		panic("No need to decompress when body is specified in ResponseAdaptor spec")
 	}
 	ra.reload()
@@ -122,6 +150,9 @@ func (ra *ResponseAdaptor) reload() {
 	if ra.spec.Template != "" {
 		ra.Builder.reload(&ra.spec.Spec)
 	}
+	if ra.spec.BodyTemplate != nil {
+		ra.renderer = inlinetemplate.NewRenderer(ra.spec.BodyTemplate)
+	}
 }
 
 // Handle adapts response.
@@ -156,6 +187,14 @@ func (ra *ResponseAdaptor) Handle(ctx *context.Context) string {
 	}
 
 	newBody := templateSpec.Body
+	if newBody == "" && ra.renderer != nil {
+		body, err := ra.renderer.Render(inlinetemplate.NewContextValues(ctx, nil))
+		if err != nil {
+			logger.Warnf("ResponseAdaptor(%s): failed to render body: %v", ra.Name(), err)
+			return resultBuildErr
+		}
+		newBody = body
+	}
 	if newBody == "" {
 		newBody = ra.spec.Body
 	}
@@ -262,6 +262,36 @@ func TestResponseAdaptorTemplate(t *testing.T) {
 	assert.Equal(data, ctx.GetOutputResponse().RawPayload())
 }
 
+func TestResponseAdaptorBodyTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlSpec := `
+kind: ResponseAdaptor
+name: ra
+bodyTemplate:
+  text: '{"status": ${resp.status}, "server": ${resp.header.Server | default "unknown" | json}}'
+`
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlSpec), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+
+	ra := responseAdaptorKind.CreateInstance(spec)
+	ra.Init()
+
+	w := httptest.NewRecorder()
+	w.Header().Set("Server", "easegress")
+	w.WriteHeader(http.StatusCreated)
+	ctx := getCtx(t, w.Result())
+	assert.Equal("", ra.Handle(ctx))
+	assert.Equal(`{"status": 201, "server": "easegress"}`, string(ctx.GetOutputResponse().RawPayload()))
+
+	// body and bodyTemplate are mutually exclusive.
+	rawSpec["body"] = "hello"
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.Error(err)
+}
+
 func TestResponseAdaptorCompressDecompress(t *testing.T) {
 	assert := assert.New(t)
 
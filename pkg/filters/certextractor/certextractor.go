@@ -156,5 +156,11 @@ func (ce *CertExtractor) Handle(ctx *context.Context) string {
 	return ""
 }
 
+// NeedPayload returns false for both payloads, the certificate comes from
+// the TLS connection, it implements context.PayloadNeeder.
+func (ce *CertExtractor) NeedPayload() (request, response bool) {
+	return false, false
+}
+
 // Status returns status.
 func (ce *CertExtractor) Status() interface{} { return nil }
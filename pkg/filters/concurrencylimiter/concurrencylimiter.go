@@ -0,0 +1,241 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package concurrencylimiter implements a filter to limit the in-flight
+// requests of every consumer.
+package concurrencylimiter
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/object/tenantmanager"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of ConcurrencyLimiter.
+	Kind = "ConcurrencyLimiter"
+
+	resultConcurrencyLimited = "concurrencyLimited"
+
+	defaultQueueTimeout = time.Second
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ConcurrencyLimiter limits the in-flight requests of every consumer with fair queuing.",
+	Results:     []string{resultConcurrencyLimited},
+	Indicators: []*filters.Indicator{
+		{Name: "inFlight", Description: "Number of the requests being processed", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "waiting", Description: "Number of the requests waiting for a slot", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ConcurrencyLimiter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ConcurrencyLimiter is the filter to limit the in-flight requests of
+	// every consumer.
+	ConcurrencyLimiter struct {
+		spec         *Spec
+		queueTimeout time.Duration
+		limiter      *limiter
+	}
+
+	// Spec is the spec of ConcurrencyLimiter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// ConsumerHeader is the request header carrying the consumer, it
+		// is used if the consumer is not identified by a TenantLimiter.
+		ConsumerHeader string `json:"consumerHeader,omitempty"`
+		// MaxConcurrency is the maximum in-flight requests of a consumer.
+		MaxConcurrency int `json:"maxConcurrency" jsonschema:"required,minimum=1"`
+		// TotalConcurrency is the maximum in-flight requests of all
+		// consumers, zero means unlimited.
+		TotalConcurrency int `json:"totalConcurrency,omitempty" jsonschema:"minimum=0"`
+		// MaxQueueLength is the maximum waiting requests of a consumer,
+		// the requests over the limits are rejected at once if it is zero.
+		MaxQueueLength int    `json:"maxQueueLength,omitempty" jsonschema:"minimum=0"`
+		QueueTimeout   string `json:"queueTimeout,omitempty" jsonschema:"format=duration"`
+
+		Consumers []*ConsumerSpec `json:"consumers,omitempty"`
+	}
+
+	// ConsumerSpec is the spec of a consumer with its own limit.
+	ConsumerSpec struct {
+		Name           string `json:"name" jsonschema:"required"`
+		MaxConcurrency int    `json:"maxConcurrency" jsonschema:"required,minimum=1"`
+	}
+
+	// Status is the status of ConcurrencyLimiter.
+	Status struct {
+		InFlight int `json:"inFlight"`
+		Waiting  int `json:"waiting"`
+	}
+)
+
+// Validate validates the spec of ConcurrencyLimiter.
+func (s *Spec) Validate() error {
+	if s.QueueTimeout != "" {
+		if _, err := time.ParseDuration(s.QueueTimeout); err != nil {
+			return fmt.Errorf("invalid queueTimeout %s: %v", s.QueueTimeout, err)
+		}
+	}
+
+	names := map[string]bool{}
+	for _, c := range s.Consumers {
+		if names[c.Name] {
+			return fmt.Errorf("duplicated consumer %s", c.Name)
+		}
+		names[c.Name] = true
+	}
+	return nil
+}
+
+// limitOf returns the maximum in-flight requests of the consumer.
+func (s *Spec) limitOf(name string) int {
+	for _, c := range s.Consumers {
+		if c.Name == name {
+			return c.MaxConcurrency
+		}
+	}
+	return s.MaxConcurrency
+}
+
+// Name returns the name of the ConcurrencyLimiter filter instance.
+func (cl *ConcurrencyLimiter) Name() string {
+	return cl.spec.Name()
+}
+
+// Kind returns the kind of ConcurrencyLimiter.
+func (cl *ConcurrencyLimiter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ConcurrencyLimiter.
+func (cl *ConcurrencyLimiter) Spec() filters.Spec {
+	return cl.spec
+}
+
+// Init initializes ConcurrencyLimiter.
+func (cl *ConcurrencyLimiter) Init() {
+	cl.reload(nil)
+}
+
+// Inherit inherits previous generation of ConcurrencyLimiter, the
+// requests in flight and waiting are kept and counted with the new limits.
+func (cl *ConcurrencyLimiter) Inherit(previousGeneration filters.Filter) {
+	cl.reload(previousGeneration.(*ConcurrencyLimiter))
+}
+
+func (cl *ConcurrencyLimiter) reload(prev *ConcurrencyLimiter) {
+	cl.queueTimeout = defaultQueueTimeout
+	if cl.spec.QueueTimeout != "" {
+		cl.queueTimeout, _ = time.ParseDuration(cl.spec.QueueTimeout)
+	}
+
+	if prev == nil {
+		cl.limiter = newLimiter(cl.spec.TotalConcurrency, cl.spec.limitOf)
+		return
+	}
+	cl.limiter = prev.limiter
+	cl.limiter.update(cl.spec.TotalConcurrency, cl.spec.limitOf)
+}
+
+// Handle handles HTTP request, the admitted request is released after the
+// response is sent to the client, so a slow client holds its slot.
+func (cl *ConcurrencyLimiter) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	// the requests whose consumer is not identified share the anonymous
+	// consumer, whose name is empty.
+	name := tenantmanager.ConsumerOf(ctx, req, cl.spec.ConsumerHeader)
+	l := cl.limiter
+
+	w, ok := l.tryAcquire(name, cl.spec.MaxQueueLength)
+	if !ok {
+		return cl.reject(ctx, name, "queue-full")
+	}
+
+	if w != nil {
+		start := time.Now()
+		timer := time.NewTimer(cl.queueTimeout)
+		select {
+		case <-w.ready:
+			timer.Stop()
+			ctx.AddTag(fmt.Sprintf("concurrencyLimiter: waiting duration: %s", time.Since(start)))
+		case <-timer.C:
+			if l.cancel(name, w) {
+				return cl.reject(ctx, name, "queue-timeout")
+			}
+		case <-req.Context().Done():
+			timer.Stop()
+			if l.cancel(name, w) {
+				return cl.reject(ctx, name, "client-canceled")
+			}
+		}
+	}
+
+	ctx.OnFinish(func() {
+		l.release(name)
+	})
+	return ""
+}
+
+func (cl *ConcurrencyLimiter) reject(ctx *context.Context, name, reason string) string {
+	ctx.AddTag(fmt.Sprintf("concurrencyLimiter: too many concurrent requests of %s", name))
+
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+
+	resp.SetStatusCode(http.StatusTooManyRequests)
+	resp.HTTPHeader().Set("X-EG-Concurrency-Limiter", reason)
+
+	ctx.SetOutputResponse(resp)
+	return resultConcurrencyLimited
+}
+
+// NeedPayload returns false for both payloads, it implements
+// context.PayloadNeeder.
+func (cl *ConcurrencyLimiter) NeedPayload() (request, response bool) {
+	return false, false
+}
+
+// Status returns Status generated by Runtime.
+func (cl *ConcurrencyLimiter) Status() interface{} {
+	s := &Status{}
+	s.InFlight, s.Waiting = cl.limiter.stat()
+	return s
+}
+
+// Close closes ConcurrencyLimiter.
+func (cl *ConcurrencyLimiter) Close() {
+}
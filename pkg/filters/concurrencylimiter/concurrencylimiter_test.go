@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package concurrencylimiter
+
+import (
+	stdcontext "context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func newConcurrencyLimiter(t *testing.T, yamlConfig string) *ConcurrencyLimiter {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	cl := kind.CreateInstance(spec).(*ConcurrencyLimiter)
+	cl.Init()
+	return cl
+}
+
+func newContext(t *testing.T, apiKey string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	stdr.Header.Set("X-API-Key", apiKey)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func limitOf(limits map[string]int) func(string) int {
+	return func(name string) int {
+		return limits[name]
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{MaxConcurrency: 1, QueueTimeout: "1s"}).Validate())
+	assert.Error((&Spec{MaxConcurrency: 1, QueueTimeout: "1x"}).Validate())
+	assert.Error((&Spec{MaxConcurrency: 1, Consumers: []*ConsumerSpec{
+		{Name: "a", MaxConcurrency: 1},
+		{Name: "a", MaxConcurrency: 2},
+	}}).Validate())
+
+	spec := &Spec{MaxConcurrency: 2, Consumers: []*ConsumerSpec{{Name: "vip", MaxConcurrency: 10}}}
+	assert.Equal(2, spec.limitOf("alice"))
+	assert.Equal(10, spec.limitOf("vip"))
+}
+
+func TestLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	l := newLimiter(0, limitOf(map[string]int{"alice": 1, "bob": 2}))
+
+	w, ok := l.tryAcquire("alice", 1)
+	assert.True(ok)
+	assert.Nil(w)
+
+	// queued, and then rejected as the queue is full.
+	w, ok = l.tryAcquire("alice", 1)
+	assert.True(ok)
+	assert.NotNil(w)
+	_, ok = l.tryAcquire("alice", 1)
+	assert.False(ok)
+
+	// other consumers are not affected.
+	for i := 0; i < 2; i++ {
+		bw, ok := l.tryAcquire("bob", 0)
+		assert.True(ok)
+		assert.Nil(bw)
+	}
+	_, ok = l.tryAcquire("bob", 0)
+	assert.False(ok)
+
+	inFlight, waiting := l.stat()
+	assert.Equal(3, inFlight)
+	assert.Equal(1, waiting)
+
+	l.release("alice")
+	select {
+	case <-w.ready:
+	default:
+		t.Fatal("waiter is not admitted")
+	}
+	assert.False(l.cancel("alice", w))
+
+	// a waiter is removed after cancelled.
+	w, _ = l.tryAcquire("alice", 1)
+	assert.True(l.cancel("alice", w))
+	_, waiting = l.stat()
+	assert.Equal(0, waiting)
+
+	l.release("alice")
+	l.release("bob")
+	l.release("bob")
+	assert.Empty(l.consumers)
+	assert.Equal(0, l.inFlight)
+
+	// raising the limits admits the waiters.
+	l.tryAcquire("alice", 1)
+	w, _ = l.tryAcquire("alice", 1)
+	l.update(0, limitOf(map[string]int{"alice": 2}))
+	<-w.ready
+}
+
+func TestLimiterFairness(t *testing.T) {
+	assert := assert.New(t)
+
+	l := newLimiter(2, limitOf(map[string]int{"alice": 2, "bob": 2, "carol": 2}))
+
+	l.tryAcquire("alice", 10)
+	l.tryAcquire("alice", 10)
+
+	// alice queues many requests before the others.
+	var order []string
+	waiters := map[*waiter]string{}
+	for i := 0; i < 4; i++ {
+		w, _ := l.tryAcquire("alice", 10)
+		waiters[w] = "alice"
+	}
+	for _, name := range []string{"bob", "carol"} {
+		w, _ := l.tryAcquire(name, 10)
+		waiters[w] = name
+	}
+
+	// the total limit is reached, the waiters are admitted in turn.
+	for len(order) < 3 {
+		inFlight, _ := l.stat()
+		assert.Equal(2, inFlight)
+		l.release("alice")
+		for w, name := range waiters {
+			select {
+			case <-w.ready:
+				order = append(order, name)
+				delete(waiters, w)
+			default:
+			}
+		}
+	}
+	assert.Equal([]string{"alice", "bob", "carol"}, order)
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	cl := newConcurrencyLimiter(t, `
+kind: ConcurrencyLimiter
+name: limiter
+consumerHeader: X-API-Key
+maxConcurrency: 1
+maxQueueLength: 1
+queueTimeout: 50ms
+`)
+	defer cl.Close()
+
+	ctx1 := newContext(t, "alice")
+	assert.Equal("", cl.Handle(ctx1))
+
+	// waits until the first request is finished.
+	done := make(chan string)
+	go func() {
+		ctx := newContext(t, "alice")
+		result := cl.Handle(ctx)
+		ctx.Finish()
+		done <- result
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// the queue is full.
+	ctx := newContext(t, "alice")
+	assert.Equal(resultConcurrencyLimited, cl.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusTooManyRequests, resp.StatusCode())
+	assert.Equal("queue-full", resp.HTTPHeader().Get("X-EG-Concurrency-Limiter"))
+
+	ctx1.Finish()
+	assert.Equal("", <-done)
+
+	// times out in the queue.
+	ctx1 = newContext(t, "alice")
+	assert.Equal("", cl.Handle(ctx1))
+	ctx = newContext(t, "alice")
+	assert.Equal(resultConcurrencyLimited, cl.Handle(ctx))
+	assert.Equal("queue-timeout", ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader().Get("X-EG-Concurrency-Limiter"))
+
+	// the client goes away in the queue.
+	ctx = newContext(t, "alice")
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	stdctx, cancel := stdcontext.WithCancel(req.Context())
+	cancel()
+	req.SetContext(stdctx)
+	assert.Equal(resultConcurrencyLimited, cl.Handle(ctx))
+	assert.Equal("client-canceled", ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader().Get("X-EG-Concurrency-Limiter"))
+
+	// the requests in flight are kept by the next generation.
+	cl2 := kind.CreateInstance(cl.spec).(*ConcurrencyLimiter)
+	cl2.Inherit(cl)
+	defer cl2.Close()
+	status := cl2.Status().(*Status)
+	assert.Equal(1, status.InFlight)
+
+	ctx1.Finish()
+	ctx = newContext(t, "alice")
+	assert.Equal("", cl2.Handle(ctx))
+	ctx.Finish()
+}
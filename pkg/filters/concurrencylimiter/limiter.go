@@ -0,0 +1,231 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package concurrencylimiter
+
+import (
+	"sync"
+)
+
+type (
+	// limiter limits the in-flight requests of every consumer, and the
+	// total in-flight requests of all consumers if total is not zero. The
+	// requests over the limits wait in the queues of their consumers, and
+	// the queues are served in turn when the requests finish, so a
+	// consumer with a long queue does not starve the others.
+	limiter struct {
+		mutex     sync.Mutex
+		total     int
+		inFlight  int
+		limitOf   func(consumer string) int
+		consumers map[string]*consumerState
+		// active are the consumers with waiting requests, in the order to
+		// be served, next is the index of the one to be served first.
+		active []*consumerState
+		next   int
+	}
+
+	consumerState struct {
+		name     string
+		limit    int
+		inFlight int
+		queue    []*waiter
+	}
+
+	waiter struct {
+		ready   chan struct{}
+		granted bool
+	}
+)
+
+func newLimiter(total int, limitOf func(string) int) *limiter {
+	return &limiter{
+		total:     total,
+		limitOf:   limitOf,
+		consumers: map[string]*consumerState{},
+	}
+}
+
+// update updates the limits, the waiting requests are admitted at once if
+// the limits are raised.
+func (l *limiter) update(total int, limitOf func(string) int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.total, l.limitOf = total, limitOf
+	for _, cs := range l.consumers {
+		cs.limit = limitOf(cs.name)
+	}
+	l.dispatch()
+}
+
+func (l *limiter) available() bool {
+	return l.total <= 0 || l.inFlight < l.total
+}
+
+// tryAcquire admits a request of the consumer at once if it is under the
+// limits and no request of it is waiting, otherwise, the request is
+// queued if the queue of the consumer is not longer than maxQueue, and
+// the waiter is returned. ok is false if the request is rejected.
+func (l *limiter) tryAcquire(consumer string, maxQueue int) (w *waiter, ok bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	cs := l.consumers[consumer]
+	if cs == nil {
+		cs = &consumerState{name: consumer, limit: l.limitOf(consumer)}
+		l.consumers[consumer] = cs
+	}
+
+	if len(cs.queue) == 0 && cs.inFlight < cs.limit && l.available() {
+		cs.inFlight++
+		l.inFlight++
+		return nil, true
+	}
+
+	if len(cs.queue) >= maxQueue {
+		l.forget(cs)
+		return nil, false
+	}
+
+	w = &waiter{ready: make(chan struct{})}
+	cs.queue = append(cs.queue, w)
+	if len(cs.queue) == 1 {
+		l.active = append(l.active, cs)
+	}
+	return w, true
+}
+
+// cancel removes the waiter from the queue of the consumer, it returns
+// false if the waiter has already been admitted, and the request must be
+// released as usual.
+func (l *limiter) cancel(consumer string, w *waiter) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if w.granted {
+		return false
+	}
+
+	cs := l.consumers[consumer]
+	for i, qw := range cs.queue {
+		if qw == w {
+			cs.queue = append(cs.queue[:i], cs.queue[i+1:]...)
+			break
+		}
+	}
+	if len(cs.queue) == 0 {
+		l.deactivate(cs)
+	}
+	// the request could block the others of the consumer when it is at
+	// the head of the queue.
+	l.dispatch()
+	l.forget(cs)
+	return true
+}
+
+// release releases an admitted request of the consumer, and admits the
+// waiting requests.
+func (l *limiter) release(consumer string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	cs := l.consumers[consumer]
+	cs.inFlight--
+	l.inFlight--
+	l.dispatch()
+	l.forget(cs)
+}
+
+// dispatch admits the waiting requests of the active consumers in turn,
+// until no more request can be admitted.
+func (l *limiter) dispatch() {
+	for len(l.active) > 0 && l.available() {
+		admitted := false
+		for i := 0; i < len(l.active); i++ {
+			idx := (l.next + i) % len(l.active)
+			cs := l.active[idx]
+			if cs.inFlight >= cs.limit {
+				continue
+			}
+
+			w := cs.queue[0]
+			cs.queue[0] = nil
+			cs.queue = cs.queue[1:]
+			w.granted = true
+			close(w.ready)
+			cs.inFlight++
+			l.inFlight++
+
+			if len(cs.queue) == 0 {
+				// the next consumer takes the place of this one.
+				l.active = append(l.active[:idx], l.active[idx+1:]...)
+				l.next = idx
+			} else {
+				l.next = idx + 1
+			}
+			admitted = true
+			break
+		}
+
+		if !admitted {
+			break
+		}
+	}
+
+	if len(l.active) == 0 {
+		l.next = 0
+	} else {
+		l.next %= len(l.active)
+	}
+}
+
+func (l *limiter) deactivate(cs *consumerState) {
+	for i, a := range l.active {
+		if a == cs {
+			l.active = append(l.active[:i], l.active[i+1:]...)
+			if i < l.next {
+				l.next--
+			}
+			break
+		}
+	}
+	if len(l.active) == 0 {
+		l.next = 0
+	} else {
+		l.next %= len(l.active)
+	}
+}
+
+// forget removes the state of the consumer if it has no request in
+// flight or waiting.
+func (l *limiter) forget(cs *consumerState) {
+	if cs.inFlight == 0 && len(cs.queue) == 0 {
+		delete(l.consumers, cs.name)
+	}
+}
+
+// stat returns the number of requests in flight and waiting.
+func (l *limiter) stat() (inFlight, waiting int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for _, cs := range l.active {
+		waiting += len(cs.queue)
+	}
+	return l.inFlight, waiting
+}
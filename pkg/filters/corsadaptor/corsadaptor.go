@@ -151,6 +151,12 @@ func (a *CORSAdaptor) Handle(ctx *context.Context) string {
 	return ""
 }
 
+// NeedPayload returns false for both payloads, CORSAdaptor only handles
+// the headers, it implements context.PayloadNeeder.
+func (a *CORSAdaptor) NeedPayload() (request, response bool) {
+	return false, false
+}
+
 // Status return status.
 func (a *CORSAdaptor) Status() interface{} {
 	return nil
@@ -0,0 +1,221 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package datamasker implements a filter to mask the sensitive data in the
+// responses.
+package datamasker
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of DataMasker.
+	Kind = "DataMasker"
+
+	resultStreamRejected = "streamRejected"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "DataMasker masks the sensitive data in the responses, like credit card numbers and emails.",
+	Results:     []string{resultStreamRejected},
+	Indicators: []*filters.Indicator{
+		{Name: "policies.*.responses", Description: "Number of the responses masked by the policy", Type: filters.IndicatorTypeInteger, Unit: "responses"},
+		{Name: "policies.*.occurrences", Description: "Number of the values masked by the policy", Type: filters.IndicatorTypeInteger, Unit: "values"},
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &DataMasker{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// DataMasker is the filter to mask the sensitive data in the responses.
+	DataMasker struct {
+		spec     *Spec
+		policies []*policy
+	}
+
+	// Spec is the spec of DataMasker.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Mask replaces the masked values, default is ****.
+		Mask string `json:"mask,omitempty"`
+		// Policies are the masking policies, the first one matching the
+		// request is used.
+		Policies []*PolicySpec `json:"policies" jsonschema:"required,minItems=1"`
+	}
+
+	// Status is the status of DataMasker.
+	Status struct {
+		Policies map[string]*PolicyStatus `json:"policies"`
+	}
+)
+
+// Validate validates the spec of DataMasker.
+func (s *Spec) Validate() error {
+	names := map[string]bool{}
+	for _, p := range s.Policies {
+		if names[p.Name] {
+			return fmt.Errorf("duplicated policy %s", p.Name)
+		}
+		names[p.Name] = true
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the DataMasker filter instance.
+func (dm *DataMasker) Name() string {
+	return dm.spec.Name()
+}
+
+// Kind returns the kind of DataMasker.
+func (dm *DataMasker) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the DataMasker.
+func (dm *DataMasker) Spec() filters.Spec {
+	return dm.spec
+}
+
+// Init initializes DataMasker.
+func (dm *DataMasker) Init() {
+	dm.reload()
+}
+
+// Inherit inherits previous generation of DataMasker.
+func (dm *DataMasker) Inherit(previousGeneration filters.Filter) {
+	dm.reload()
+}
+
+func (dm *DataMasker) reload() {
+	mask := dm.spec.Mask
+	if mask == "" {
+		mask = defaultMask
+	}
+	for _, spec := range dm.spec.Policies {
+		dm.policies = append(dm.policies, newPolicy(spec, mask))
+	}
+}
+
+func (dm *DataMasker) match(req *httpprot.Request) *policy {
+	for _, p := range dm.policies {
+		if len(p.spec.URLs) == 0 {
+			return p
+		}
+		for _, u := range p.spec.URLs {
+			if u.Match(req.Std()) {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// NeedPayload returns true for the response payload, which is masked, it
+// implements context.PayloadNeeder.
+func (dm *DataMasker) NeedPayload() (request, response bool) {
+	return false, true
+}
+
+// Handle masks the sensitive data in the response. The compressed bodies
+// are not masked, and a stream, which can't be masked, is replaced by a
+// 502 response, so the sensitive data is never leaked.
+func (dm *DataMasker) Handle(ctx *context.Context) string {
+	req, ok := ctx.GetInputRequest().(*httpprot.Request)
+	if !ok {
+		return ""
+	}
+	resp, ok := ctx.GetInputResponse().(*httpprot.Response)
+	if !ok {
+		return ""
+	}
+
+	p := dm.match(req)
+	if p == nil {
+		return ""
+	}
+
+	if resp.IsStream() {
+		rejectStream(resp)
+		return resultStreamRejected
+	}
+	if ce := resp.HTTPHeader().Get("Content-Encoding"); ce != "" && ce != "identity" {
+		return ""
+	}
+
+	data, count := p.maskPayload(resp)
+	if count == 0 {
+		return ""
+	}
+
+	resp.SetPayload(data)
+	resp.ContentLength = int64(len(data))
+	resp.HTTPHeader().Set("Content-Length", strconv.Itoa(len(data)))
+
+	atomic.AddUint64(&p.responses, 1)
+	atomic.AddUint64(&p.occurrences, uint64(count))
+	return ""
+}
+
+// rejectStream closes the stream of the response, and replaces the response
+// by an empty 502 response.
+func rejectStream(resp *httpprot.Response) {
+	if c, ok := resp.GetPayload().(io.Closer); ok {
+		c.Close()
+	}
+	resp.SetPayload(nil)
+	resp.SetStatusCode(http.StatusBadGateway)
+	h := resp.HTTPHeader()
+	h.Del("Content-Encoding")
+	h.Del("Content-Type")
+	h.Set("Content-Length", "0")
+	resp.ContentLength = 0
+}
+
+// Status returns Status generated by Runtime.
+func (dm *DataMasker) Status() interface{} {
+	s := &Status{Policies: map[string]*PolicyStatus{}}
+	for _, p := range dm.policies {
+		s.Policies[p.spec.Name] = p.status()
+	}
+	return s
+}
+
+// Close closes DataMasker.
+func (dm *DataMasker) Close() {
+}
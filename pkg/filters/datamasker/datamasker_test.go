@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package datamasker
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func newDataMasker(t *testing.T, yamlConfig string) *DataMasker {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	dm := kind.CreateInstance(spec).(*DataMasker)
+	dm.Init()
+	return dm
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&PolicySpec{Name: "p", Fields: []string{"password"}}).Validate())
+	assert.NoError((&PolicySpec{Name: "p", BuiltinPatterns: []string{BuiltinEmail}}).Validate())
+	assert.Error((&PolicySpec{Name: "p"}).Validate())
+	assert.Error((&PolicySpec{Name: "p", BuiltinPatterns: []string{"phone"}}).Validate())
+	assert.Error((&PolicySpec{Name: "p", Patterns: []string{"("}}).Validate())
+
+	assert.Error((&Spec{Policies: []*PolicySpec{
+		{Name: "p", Fields: []string{"a"}},
+		{Name: "p", Fields: []string{"b"}},
+	}}).Validate())
+}
+
+func TestLuhn(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(luhn("4111 1111 1111 1111"))
+	assert.True(luhn("5500-0000-0000-0004"))
+	assert.False(luhn("4111 1111 1111 1112"))
+}
+
+func TestMaskPayload(t *testing.T) {
+	assert := assert.New(t)
+
+	maskBody := func(p *policy, contentType, body string) ([]byte, int) {
+		resp, _ := httpprot.NewResponse(nil)
+		resp.HTTPHeader().Set("Content-Type", contentType)
+		resp.SetPayload([]byte(body))
+		return p.maskPayload(resp)
+	}
+
+	p := newPolicy(&PolicySpec{
+		Name:            "p",
+		Fields:          []string{"password", "user.phone"},
+		BuiltinPatterns: []string{BuiltinCreditCard, BuiltinEmail},
+		KeepLast:        4,
+	}, defaultMask)
+
+	body := `{"password":"secret","user":{"phone":"13800001234","id":12345678901234567},` +
+		`"phone":"555","card":"4111 1111 1111 1111","id":"1234567890123","note":"mail alice@example.com <now>"}`
+	data, count := maskBody(p, "application/json; charset=utf-8", body)
+	assert.Equal(4, count)
+	s := string(data)
+	assert.Contains(s, `"password":"****cret"`)
+	assert.Contains(s, `"phone":"****1234"`)
+	assert.Contains(s, `"phone":"555"`, "dotted path only matches from the root")
+	assert.Contains(s, `"card":"****1111"`)
+	assert.Contains(s, `"id":"1234567890123"`, "not a credit card number")
+	assert.Contains(s, `"id":12345678901234567`, "numbers are kept as they are")
+	assert.Contains(s, `mail ****.com <now>`)
+
+	data, count = maskBody(p, "text/plain", "card: 4111111111111111")
+	assert.Equal(1, count)
+	assert.Equal("card: ****1111", string(data))
+
+	data, count = maskBody(p, "image/png", "4111111111111111")
+	assert.Equal(0, count)
+	assert.Nil(data)
+
+	data, count = maskBody(p, "application/json", `{"name":"alice"}`)
+	assert.Equal(0, count)
+	assert.Nil(data)
+
+	// objects are masked as a whole.
+	p = newPolicy(&PolicySpec{Name: "p", Fields: []string{"address"}}, "[MASKED]")
+	data, count = maskBody(p, "application/json", `[{"address":{"city":"x"}},{"address":null}]`)
+	assert.Equal(1, count)
+	assert.Equal(`[{"address":"[MASKED]"},{"address":null}]`, string(data))
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	dm := newDataMasker(t, `
+kind: DataMasker
+name: dm
+policies:
+- name: users
+  urls:
+  - url:
+      prefix: /users
+  fields: [password]
+- name: default
+  builtinPatterns: [email]
+`)
+	defer dm.Close()
+
+	handle := func(path, contentType, body string) *httpprot.Response {
+		ctx := context.New(nil)
+		stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1"+path, nil)
+		req, err := httpprot.NewRequest(stdr)
+		assert.NoError(err)
+		ctx.SetInputRequest(req)
+
+		resp, _ := httpprot.NewResponse(nil)
+		resp.HTTPHeader().Set("Content-Type", contentType)
+		resp.SetPayload([]byte(body))
+		ctx.SetOutputResponse(resp)
+
+		assert.Equal("", dm.Handle(ctx))
+		return resp
+	}
+
+	resp := handle("/users/1", "application/json", `{"password":"p","email":"a@b.com"}`)
+	assert.Equal(`{"email":"a@b.com","password":"****"}`, string(resp.RawPayload()))
+	assert.Equal("37", resp.HTTPHeader().Get("Content-Length"))
+
+	resp = handle("/orders/1", "text/plain", "contact a@b.com or c@d.org")
+	assert.Equal("contact **** or ****", string(resp.RawPayload()))
+
+	handle("/orders/2", "text/plain", "nothing")
+
+	// a stream can't be masked, so it is rejected.
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/users/2", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+	resp, _ = httpprot.NewResponse(nil)
+	resp.HTTPHeader().Set("Content-Type", "application/json")
+	resp.SetPayload(strings.NewReader(`{"password":"p"}`))
+	ctx.SetOutputResponse(resp)
+	assert.Equal(resultStreamRejected, dm.Handle(ctx))
+	assert.Equal(http.StatusBadGateway, resp.StatusCode())
+	assert.False(resp.IsStream())
+	assert.Empty(resp.RawPayload())
+
+	req2, resp2 := dm.NeedPayload()
+	assert.False(req2)
+	assert.True(resp2)
+
+	status := dm.Status().(*Status)
+	assert.Equal(&PolicyStatus{Responses: 1, Occurrences: 1}, status.Policies["users"])
+	assert.Equal(&PolicyStatus{Responses: 1, Occurrences: 2}, status.Policies["default"])
+}
@@ -0,0 +1,299 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package datamasker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/urlrule"
+)
+
+const (
+	// BuiltinCreditCard matches the credit card numbers, with optional
+	// spaces or dashes between the digit groups.
+	BuiltinCreditCard = "creditCard"
+	// BuiltinEmail matches the email addresses.
+	BuiltinEmail = "email"
+
+	defaultMask = "****"
+)
+
+var builtinPatterns = map[string]*pattern{
+	// the Luhn checksum reduces the false positives, like the long IDs.
+	BuiltinCreditCard: {
+		re:    regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		check: luhn,
+	},
+	BuiltinEmail: {
+		re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	},
+}
+
+type (
+	// PolicySpec is the spec of a masking policy.
+	PolicySpec struct {
+		Name string `json:"name" jsonschema:"required"`
+		// URLs are the requests whose responses are masked by the policy,
+		// it matches all requests if empty.
+		URLs []*urlrule.URLRule `json:"urls,omitempty"`
+		// Fields are the fields of JSON bodies to mask. A name matches the
+		// fields at any depth, and a dotted path, like user.phone, matches
+		// the field from the root.
+		Fields []string `json:"fields,omitempty"`
+		// BuiltinPatterns are the names of the builtin patterns to mask.
+		BuiltinPatterns []string `json:"builtinPatterns,omitempty" jsonschema:"uniqueItems=true,enum=creditCard,enum=email"`
+		// Patterns are the regular expressions of the text to mask.
+		Patterns []string `json:"patterns,omitempty"`
+		// KeepLast is the number of the trailing characters kept in the
+		// masked values, like the last 4 digits of a credit card number.
+		KeepLast int `json:"keepLast,omitempty" jsonschema:"minimum=0"`
+	}
+
+	// PolicyStatus is the status of a masking policy.
+	PolicyStatus struct {
+		// Responses is the number of the responses masked.
+		Responses uint64 `json:"responses"`
+		// Occurrences is the number of the values masked.
+		Occurrences uint64 `json:"occurrences"`
+	}
+
+	// pattern matches the text to mask, the matches are masked only if
+	// they pass the check, if any.
+	pattern struct {
+		re    *regexp.Regexp
+		check func(string) bool
+	}
+
+	policy struct {
+		spec     *PolicySpec
+		mask     string
+		names    map[string]bool
+		paths    map[string]bool
+		patterns []*pattern
+
+		responses   uint64
+		occurrences uint64
+	}
+)
+
+// Validate validates the PolicySpec.
+func (s *PolicySpec) Validate() error {
+	if len(s.Fields) == 0 && len(s.BuiltinPatterns) == 0 && len(s.Patterns) == 0 {
+		return fmt.Errorf("policy %s masks nothing", s.Name)
+	}
+	for _, name := range s.BuiltinPatterns {
+		if _, ok := builtinPatterns[name]; !ok {
+			return fmt.Errorf("policy %s: unknown builtin pattern %s", s.Name, name)
+		}
+	}
+	for _, p := range s.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("policy %s: invalid pattern %s: %v", s.Name, p, err)
+		}
+	}
+	return nil
+}
+
+// newPolicy creates a policy, the spec has been validated.
+func newPolicy(spec *PolicySpec, mask string) *policy {
+	p := &policy{
+		spec:  spec,
+		mask:  mask,
+		names: map[string]bool{},
+		paths: map[string]bool{},
+	}
+	for _, u := range spec.URLs {
+		u.Init()
+	}
+	for _, f := range spec.Fields {
+		f = strings.ToLower(f)
+		if strings.Contains(f, ".") {
+			p.paths[f] = true
+		} else {
+			p.names[f] = true
+		}
+	}
+	for _, name := range spec.BuiltinPatterns {
+		p.patterns = append(p.patterns, builtinPatterns[name])
+	}
+	for _, s := range spec.Patterns {
+		p.patterns = append(p.patterns, &pattern{re: regexp.MustCompile(s)})
+	}
+	return p
+}
+
+func (p *policy) status() *PolicyStatus {
+	return &PolicyStatus{
+		Responses:   atomic.LoadUint64(&p.responses),
+		Occurrences: atomic.LoadUint64(&p.occurrences),
+	}
+}
+
+// maskValue masks a value, keeping the trailing characters as configured.
+func (p *policy) maskValue(s string) string {
+	runes := []rune(s)
+	keep := p.spec.KeepLast
+	if keep >= len(runes) {
+		return p.mask
+	}
+	return p.mask + string(runes[len(runes)-keep:])
+}
+
+// maskText masks the text matching the patterns, and returns the number of
+// the masked occurrences.
+func (p *policy) maskText(s string) (string, int) {
+	count := 0
+	for _, pattern := range p.patterns {
+		s = pattern.re.ReplaceAllStringFunc(s, func(m string) string {
+			if pattern.check != nil && !pattern.check(m) {
+				return m
+			}
+			count++
+			return p.maskValue(m)
+		})
+	}
+	return s, count
+}
+
+// maskJSON masks the values of the fields, and the patterns in the other
+// string values. The fields are matched by the names at any depth, or by the
+// dotted paths from the root, where the indexes of the arrays are omitted.
+func (p *policy) maskJSON(v interface{}, path string) (interface{}, int) {
+	count := 0
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, fv := range x {
+			fp := k
+			if path != "" {
+				fp = path + "." + k
+			}
+			if fv != nil && (p.names[strings.ToLower(k)] || p.paths[strings.ToLower(fp)]) {
+				x[k] = p.maskField(fv)
+				count++
+				continue
+			}
+			var n int
+			x[k], n = p.maskJSON(fv, fp)
+			count += n
+		}
+	case []interface{}:
+		for i, ev := range x {
+			var n int
+			x[i], n = p.maskJSON(ev, path)
+			count += n
+		}
+	case string:
+		return p.maskText(x)
+	case json.Number:
+		// a number is masked to a string, like a credit card number.
+		if s, n := p.maskText(x.String()); n > 0 {
+			return s, n
+		}
+	}
+	return v, count
+}
+
+// maskField masks the value of a field, objects and arrays are masked as a
+// whole.
+func (p *policy) maskField(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return p.maskValue(x)
+	case json.Number:
+		return p.maskValue(x.String())
+	case bool:
+		return p.maskValue(fmt.Sprint(x))
+	default:
+		return p.mask
+	}
+}
+
+// maskPayload masks the payload of the response according to its content
+// type, it returns the masked payload and the number of the masked
+// occurrences, or nil if nothing is masked. A JSON payload is parsed by
+// the response, which shares the parsing with the other filters.
+func (p *policy) maskPayload(resp *httpprot.Response) ([]byte, int) {
+	mediaType, _, _ := mime.ParseMediaType(resp.HTTPHeader().Get("Content-Type"))
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		// the numbers are kept as they are, like the large IDs, and the
+		// copy of the parsed payload is modified in place.
+		v, err := resp.JSONPayload()
+		if err != nil {
+			return nil, 0
+		}
+		v, count := p.maskJSON(v, "")
+		if count == 0 {
+			return nil, 0
+		}
+		buf := bytes.NewBuffer(nil)
+		e := json.NewEncoder(buf)
+		e.SetEscapeHTML(false)
+		if err := e.Encode(v); err != nil {
+			return nil, 0
+		}
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), count
+	}
+
+	if !isText(mediaType) || len(p.patterns) == 0 {
+		return nil, 0
+	}
+	s, count := p.maskText(string(resp.RawPayload()))
+	if count == 0 {
+		return nil, 0
+	}
+	return []byte(s), count
+}
+
+func isText(mediaType string) bool {
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/xml", "application/javascript", "application/x-www-form-urlencoded":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+xml")
+}
+
+// luhn reports whether the digits in s pass the Luhn checksum.
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
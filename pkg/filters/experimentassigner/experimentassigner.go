@@ -0,0 +1,327 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package experimentassigner implements a filter to assign the requests to
+// the buckets of an A/B experiment.
+package experimentassigner
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
+)
+
+const (
+	// Kind is the kind of ExperimentAssigner.
+	Kind = "ExperimentAssigner"
+
+	defaultBucketHeader = "X-Experiment-Bucket"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ExperimentAssigner assigns the requests to the buckets of an A/B experiment by the hash of the user.",
+	Results:     []string{},
+	Indicators: []*filters.Indicator{
+		{Name: "experiment", Description: "Name of the experiment", Type: filters.IndicatorTypeString},
+		{Name: "unassigned", Description: "Number of the requests without a user when there is no default bucket", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "buckets.*.requests", Description: "Number of the requests assigned to the bucket", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "buckets.*.errors", Description: "Number of the responses with a 5xx status code of the bucket", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "buckets.*.errorRate", Description: "Ratio of the errors to the requests of the bucket", Type: filters.IndicatorTypeNumber},
+		{Name: "buckets.*.meanDuration", Description: "Mean duration of the requests of the bucket", Type: filters.IndicatorTypeNumber, Unit: "ms"},
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ExperimentAssigner{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ExperimentAssigner is the filter to assign the requests to the
+	// buckets of an A/B experiment.
+	ExperimentAssigner struct {
+		spec        *Spec
+		experiment  string
+		totalWeight uint64
+		buckets     []*bucket
+		unassigned  *uint64
+	}
+
+	// Spec is the spec of ExperimentAssigner.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Experiment is the name of the experiment, it is hashed with the
+		// user, so a user is assigned independently in the experiments.
+		// Default is the name of the filter.
+		Experiment string `json:"experiment,omitempty"`
+		// UserHeader and UserCookie identify the user of a request, the
+		// header is checked first.
+		UserHeader string `json:"userHeader,omitempty"`
+		UserCookie string `json:"userCookie,omitempty"`
+		// DefaultBucket is the bucket of the requests without a user, they
+		// are not assigned if it is empty.
+		DefaultBucket string `json:"defaultBucket,omitempty"`
+		// BucketHeader is the request header carrying the bucket to the
+		// backends, default is X-Experiment-Bucket.
+		BucketHeader string `json:"bucketHeader,omitempty"`
+		// Buckets are the buckets of the experiment, the users are assigned
+		// to them in proportion to their weights.
+		Buckets []*BucketSpec `json:"buckets" jsonschema:"required,minItems=1"`
+	}
+
+	// BucketSpec is the spec of a bucket.
+	BucketSpec struct {
+		Name   string `json:"name" jsonschema:"required"`
+		Weight int    `json:"weight" jsonschema:"required,minimum=0"`
+	}
+
+	// Status is the status of ExperimentAssigner.
+	Status struct {
+		Experiment string                   `json:"experiment"`
+		Buckets    map[string]*BucketStatus `json:"buckets"`
+		// Unassigned is the number of the requests without a user, when
+		// there is no default bucket.
+		Unassigned uint64 `json:"unassigned"`
+	}
+
+	// BucketStatus is the traffic indicators of a bucket.
+	BucketStatus struct {
+		Requests uint64 `json:"requests"`
+		// Errors is the number of the responses with a 5xx status code.
+		Errors uint64 `json:"errors"`
+		// ErrorRate is the ratio of the errors to the requests.
+		ErrorRate float64 `json:"errorRate"`
+		// MeanDuration is the mean duration of the requests in
+		// milliseconds, measured from the filter to the end of the
+		// request.
+		MeanDuration float64 `json:"meanDuration"`
+	}
+
+	bucket struct {
+		spec *BucketSpec
+		// upper is the exclusive upper bound of the hash values assigned
+		// to the bucket.
+		upper uint64
+		stat  *bucketStat
+	}
+
+	// bucketStat is kept across the generations of the filter, so
+	// changing the weights does not reset the indicators.
+	bucketStat struct {
+		requests uint64
+		errors   uint64
+		// duration is the total duration of the requests in nanoseconds.
+		duration uint64
+	}
+)
+
+// Validate validates the spec of ExperimentAssigner.
+func (s *Spec) Validate() error {
+	if s.UserHeader == "" && s.UserCookie == "" {
+		return fmt.Errorf("userHeader or userCookie is required")
+	}
+
+	names := map[string]bool{}
+	total := 0
+	for _, b := range s.Buckets {
+		if names[b.Name] {
+			return fmt.Errorf("duplicated bucket %s", b.Name)
+		}
+		names[b.Name] = true
+		total += b.Weight
+	}
+	if total <= 0 {
+		return fmt.Errorf("the total weight of the buckets must be positive")
+	}
+	if s.DefaultBucket != "" && !names[s.DefaultBucket] {
+		return fmt.Errorf("default bucket %s not found", s.DefaultBucket)
+	}
+	return nil
+}
+
+// Name returns the name of the ExperimentAssigner filter instance.
+func (ea *ExperimentAssigner) Name() string {
+	return ea.spec.Name()
+}
+
+// Kind returns the kind of ExperimentAssigner.
+func (ea *ExperimentAssigner) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ExperimentAssigner.
+func (ea *ExperimentAssigner) Spec() filters.Spec {
+	return ea.spec
+}
+
+// Init initializes ExperimentAssigner.
+func (ea *ExperimentAssigner) Init() {
+	ea.reload(nil)
+}
+
+// Inherit inherits previous generation of ExperimentAssigner, the
+// indicators of the buckets with the same names are kept.
+func (ea *ExperimentAssigner) Inherit(previousGeneration filters.Filter) {
+	ea.reload(previousGeneration.(*ExperimentAssigner))
+}
+
+func (ea *ExperimentAssigner) reload(prev *ExperimentAssigner) {
+	ea.experiment = ea.spec.Experiment
+	if ea.experiment == "" {
+		ea.experiment = ea.spec.Name()
+	}
+
+	stats := map[string]*bucketStat{}
+	ea.unassigned = new(uint64)
+	if prev != nil {
+		for _, b := range prev.buckets {
+			stats[b.spec.Name] = b.stat
+		}
+		ea.unassigned = prev.unassigned
+	}
+
+	for _, spec := range ea.spec.Buckets {
+		ea.totalWeight += uint64(spec.Weight)
+		stat := stats[spec.Name]
+		if stat == nil {
+			stat = &bucketStat{}
+		}
+		ea.buckets = append(ea.buckets, &bucket{
+			spec:  spec,
+			upper: ea.totalWeight,
+			stat:  stat,
+		})
+	}
+}
+
+// user returns the user of the request, or an empty string if the request
+// does not have one.
+func (ea *ExperimentAssigner) user(req *httpprot.Request) string {
+	if ea.spec.UserHeader != "" {
+		if user := req.HTTPHeader().Get(ea.spec.UserHeader); user != "" {
+			return user
+		}
+	}
+	if ea.spec.UserCookie != "" {
+		if c, err := req.Cookie(ea.spec.UserCookie); err == nil && c.Value != "" {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// assign returns the bucket of the user, a user is always assigned to the
+// same bucket as long as the weights are not changed.
+func (ea *ExperimentAssigner) assign(user string) *bucket {
+	if user == "" {
+		for _, b := range ea.buckets {
+			if b.spec.Name == ea.spec.DefaultBucket {
+				return b
+			}
+		}
+		return nil
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(ea.experiment))
+	h.Write([]byte{0})
+	h.Write([]byte(user))
+	v := h.Sum64() % ea.totalWeight
+	for _, b := range ea.buckets {
+		if v < b.upper {
+			return b
+		}
+	}
+	return nil
+}
+
+// Handle assigns the request to a bucket, and injects the bucket into the
+// request header. The header from the client is removed, so a client can
+// not choose its bucket.
+func (ea *ExperimentAssigner) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	header := ea.spec.BucketHeader
+	if header == "" {
+		header = defaultBucketHeader
+	}
+
+	b := ea.assign(ea.user(req))
+	if b == nil {
+		req.HTTPHeader().Del(header)
+		atomic.AddUint64(ea.unassigned, 1)
+		return ""
+	}
+
+	req.HTTPHeader().Set(header, b.spec.Name)
+	ctx.AddTag(fmt.Sprintf("experiment: %s=%s", ea.experiment, b.spec.Name))
+
+	start := fasttime.Now()
+	ctx.OnFinish(func() {
+		atomic.AddUint64(&b.stat.requests, 1)
+		atomic.AddUint64(&b.stat.duration, uint64(fasttime.Since(start)))
+		if resp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response); ok && resp.StatusCode() >= 500 {
+			atomic.AddUint64(&b.stat.errors, 1)
+		}
+	})
+	return ""
+}
+
+// NeedPayload returns false for both payloads, it implements
+// context.PayloadNeeder.
+func (ea *ExperimentAssigner) NeedPayload() (request, response bool) {
+	return false, false
+}
+
+// Status returns Status generated by Runtime.
+func (ea *ExperimentAssigner) Status() interface{} {
+	s := &Status{
+		Experiment: ea.experiment,
+		Buckets:    map[string]*BucketStatus{},
+		Unassigned: atomic.LoadUint64(ea.unassigned),
+	}
+	for _, b := range ea.buckets {
+		bs := &BucketStatus{
+			Requests: atomic.LoadUint64(&b.stat.requests),
+			Errors:   atomic.LoadUint64(&b.stat.errors),
+		}
+		if bs.Requests > 0 {
+			bs.ErrorRate = float64(bs.Errors) / float64(bs.Requests)
+			d := time.Duration(atomic.LoadUint64(&b.stat.duration) / bs.Requests)
+			bs.MeanDuration = float64(d) / float64(time.Millisecond)
+		}
+		s.Buckets[b.spec.Name] = bs
+	}
+	return s
+}
+
+// Close closes ExperimentAssigner.
+func (ea *ExperimentAssigner) Close() {
+}
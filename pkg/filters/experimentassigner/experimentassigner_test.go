@@ -0,0 +1,144 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package experimentassigner
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func newExperimentAssigner(t *testing.T, yamlConfig string) *ExperimentAssigner {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	ea := kind.CreateInstance(spec).(*ExperimentAssigner)
+	ea.Init()
+	return ea
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	buckets := []*BucketSpec{{Name: "a", Weight: 1}, {Name: "b", Weight: 0}}
+	assert.NoError((&Spec{UserHeader: "X-User", Buckets: buckets}).Validate())
+	assert.NoError((&Spec{UserCookie: "uid", DefaultBucket: "b", Buckets: buckets}).Validate())
+	assert.Error((&Spec{Buckets: buckets}).Validate())
+	assert.Error((&Spec{UserHeader: "X-User", DefaultBucket: "c", Buckets: buckets}).Validate())
+	assert.Error((&Spec{UserHeader: "X-User", Buckets: []*BucketSpec{{Name: "a"}}}).Validate())
+	assert.Error((&Spec{UserHeader: "X-User", Buckets: []*BucketSpec{{Name: "a", Weight: 1}, {Name: "a", Weight: 1}}}).Validate())
+}
+
+func TestAssign(t *testing.T) {
+	assert := assert.New(t)
+
+	ea := newExperimentAssigner(t, `
+kind: ExperimentAssigner
+name: ea
+userHeader: X-User
+buckets:
+- name: control
+  weight: 80
+- name: treatment
+  weight: 20
+- name: disabled
+  weight: 0
+`)
+
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		b := ea.assign(user)
+		assert.Same(b, ea.assign(user), "assignment is deterministic")
+		counts[b.spec.Name]++
+	}
+	assert.Zero(counts["disabled"])
+	assert.InDelta(8000, counts["control"], 300)
+	assert.InDelta(2000, counts["treatment"], 300)
+
+	assert.Nil(ea.assign(""))
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	ea := newExperimentAssigner(t, `
+kind: ExperimentAssigner
+name: ea
+experiment: checkout
+userHeader: X-User
+userCookie: uid
+buckets:
+- name: a
+  weight: 1
+`)
+	defer ea.Close()
+
+	handle := func(header, cookie string, statusCode int) *httpprot.Request {
+		ctx := context.New(nil)
+		stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+		stdr.Header.Set(defaultBucketHeader, "spoofed")
+		if header != "" {
+			stdr.Header.Set("X-User", header)
+		}
+		if cookie != "" {
+			stdr.AddCookie(&http.Cookie{Name: "uid", Value: cookie})
+		}
+		req, err := httpprot.NewRequest(stdr)
+		assert.NoError(err)
+		ctx.SetInputRequest(req)
+
+		assert.Equal("", ea.Handle(ctx))
+
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(statusCode)
+		ctx.SetOutputResponse(resp)
+		ctx.Finish()
+		return req
+	}
+
+	req := handle("alice", "", http.StatusOK)
+	assert.Equal("a", req.HTTPHeader().Get(defaultBucketHeader))
+	req = handle("", "bob", http.StatusInternalServerError)
+	assert.Equal("a", req.HTTPHeader().Get(defaultBucketHeader))
+	req = handle("", "", http.StatusOK)
+	assert.Empty(req.HTTPHeader().Get(defaultBucketHeader))
+
+	status := ea.Status().(*Status)
+	assert.Equal("checkout", status.Experiment)
+	assert.Equal(uint64(1), status.Unassigned)
+	assert.Equal(uint64(2), status.Buckets["a"].Requests)
+	assert.Equal(uint64(1), status.Buckets["a"].Errors)
+	assert.Equal(0.5, status.Buckets["a"].ErrorRate)
+
+	// the indicators are kept by the next generation.
+	next := kind.CreateInstance(ea.spec).(*ExperimentAssigner)
+	next.Inherit(ea)
+	status = next.Status().(*Status)
+	assert.Equal(uint64(2), status.Buckets["a"].Requests)
+	assert.Equal(uint64(1), status.Unassigned)
+}
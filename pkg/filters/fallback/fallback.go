@@ -123,6 +123,12 @@ func (f *Fallback) Handle(ctx *context.Context) string {
 	return resultFallback
 }
 
+// NeedPayload returns false for both payloads, the failed response is
+// closed and replaced, it implements context.PayloadNeeder.
+func (f *Fallback) NeedPayload() (request, response bool) {
+	return false, false
+}
+
 // Status returns Status.
 func (f *Fallback) Status() interface{} {
 	return nil
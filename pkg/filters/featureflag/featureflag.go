@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package featureflag implements a filter to evaluate the feature flags for
+// the requests.
+package featureflag
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/object/tenantmanager"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/featureflags"
+)
+
+const (
+	// Kind is the kind of FeatureFlag.
+	Kind = "FeatureFlag"
+
+	defaultFlagsHeader = "X-Feature-Flags"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "FeatureFlag evaluates the feature flags for the requests, and passes the ones turned on to the backends in a header.",
+	Results:     []string{},
+	Indicators: []*filters.Indicator{
+		{Name: "flags.*.on", Description: "Number of the requests the flag is on for", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "flags.*.off", Description: "Number of the requests the flag is off for", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "flags.*.undefined", Description: "Number of the requests evaluated when the flag is not defined, which are off", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &FeatureFlag{spec: spec.(*Spec), lookup: featureflags.Get}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// FeatureFlag is the filter to evaluate the feature flags.
+	FeatureFlag struct {
+		spec  *Spec
+		flags []*flag
+		// lookup returns the feature flag shared by the members, it is
+		// replaced in the tests.
+		lookup func(name string) (*featureflags.Flag, bool)
+	}
+
+	// Spec is the spec of FeatureFlag.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Flags are the names of the feature flags to evaluate, the flags
+		// are managed by the admin API.
+		Flags []string `json:"flags" jsonschema:"required,minItems=1"`
+		// ConsumerHeader is the header identifying the consumer if it is
+		// not identified by a TenantLimiter.
+		ConsumerHeader string `json:"consumerHeader,omitempty"`
+		// KeyHeader is the header identifying the request in the
+		// percentage rollout, the consumer or the real IP is used if it is
+		// empty or absent.
+		KeyHeader string `json:"keyHeader,omitempty"`
+		// Header is the request header carrying the flags turned on to the
+		// backends, separated by commas, default is X-Feature-Flags.
+		Header string `json:"header,omitempty"`
+	}
+
+	// Status is the status of FeatureFlag.
+	Status struct {
+		Flags map[string]*FlagStatus `json:"flags"`
+	}
+
+	// FlagStatus is the evaluation indicators of a flag.
+	FlagStatus struct {
+		On  uint64 `json:"on"`
+		Off uint64 `json:"off"`
+		// Undefined is the number of the requests evaluated when the flag
+		// is not defined, they are included in Off.
+		Undefined uint64 `json:"undefined"`
+	}
+
+	flag struct {
+		name string
+		stat *flagStat
+	}
+
+	// flagStat is kept across the generations of the filter, so updating
+	// the filter does not reset the indicators.
+	flagStat struct {
+		on        uint64
+		off       uint64
+		undefined uint64
+	}
+)
+
+// Validate validates the spec of FeatureFlag.
+func (s *Spec) Validate() error {
+	names := map[string]bool{}
+	for _, name := range s.Flags {
+		if name == "" {
+			return fmt.Errorf("empty flag name")
+		}
+		if strings.Contains(name, ",") {
+			return fmt.Errorf("flag name %s contains a comma", name)
+		}
+		if names[name] {
+			return fmt.Errorf("duplicated flag %s", name)
+		}
+		names[name] = true
+	}
+	return nil
+}
+
+// Name returns the name of the FeatureFlag filter instance.
+func (ff *FeatureFlag) Name() string {
+	return ff.spec.Name()
+}
+
+// Kind returns the kind of FeatureFlag.
+func (ff *FeatureFlag) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the FeatureFlag.
+func (ff *FeatureFlag) Spec() filters.Spec {
+	return ff.spec
+}
+
+// Init initializes FeatureFlag.
+func (ff *FeatureFlag) Init() {
+	ff.reload(nil)
+}
+
+// Inherit inherits previous generation of FeatureFlag, the indicators of
+// the flags still evaluated are kept.
+func (ff *FeatureFlag) Inherit(previousGeneration filters.Filter) {
+	ff.reload(previousGeneration.(*FeatureFlag))
+}
+
+func (ff *FeatureFlag) reload(prev *FeatureFlag) {
+	stats := map[string]*flagStat{}
+	if prev != nil {
+		for _, f := range prev.flags {
+			stats[f.name] = f.stat
+		}
+	}
+
+	for _, name := range ff.spec.Flags {
+		stat := stats[name]
+		if stat == nil {
+			stat = &flagStat{}
+		}
+		ff.flags = append(ff.flags, &flag{name: name, stat: stat})
+	}
+}
+
+// keyOf returns the key of the request in the percentage rollout.
+func (ff *FeatureFlag) keyOf(req *httpprot.Request, consumer string) string {
+	if ff.spec.KeyHeader != "" {
+		if key := req.HTTPHeader().Get(ff.spec.KeyHeader); key != "" {
+			return key
+		}
+	}
+	if consumer != "" {
+		return consumer
+	}
+	return req.RealIP()
+}
+
+// Handle evaluates the flags for the request, and sets the ones turned on
+// to the request header. The header from the client is removed, so a
+// client can not turn on a flag by itself.
+func (ff *FeatureFlag) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	consumer := tenantmanager.ConsumerOf(ctx, req, ff.spec.ConsumerHeader)
+	key := ff.keyOf(req, consumer)
+
+	var on []string
+	for _, f := range ff.flags {
+		def, ok := ff.lookup(f.name)
+		if !ok {
+			atomic.AddUint64(&f.stat.undefined, 1)
+			atomic.AddUint64(&f.stat.off, 1)
+			continue
+		}
+		if def.Evaluate(consumer, key, req.HTTPHeader()) {
+			atomic.AddUint64(&f.stat.on, 1)
+			on = append(on, f.name)
+		} else {
+			atomic.AddUint64(&f.stat.off, 1)
+		}
+	}
+
+	header := ff.spec.Header
+	if header == "" {
+		header = defaultFlagsHeader
+	}
+	if len(on) == 0 {
+		req.HTTPHeader().Del(header)
+		return ""
+	}
+
+	flags := strings.Join(on, ",")
+	req.HTTPHeader().Set(header, flags)
+	ctx.AddTag(fmt.Sprintf("featureFlags: %s", flags))
+	return ""
+}
+
+// NeedPayload returns false for both payloads, the flags are evaluated
+// with the headers, it implements context.PayloadNeeder.
+func (ff *FeatureFlag) NeedPayload() (request, response bool) {
+	return false, false
+}
+
+// Status returns Status generated by Runtime.
+func (ff *FeatureFlag) Status() interface{} {
+	s := &Status{Flags: map[string]*FlagStatus{}}
+	for _, f := range ff.flags {
+		s.Flags[f.name] = &FlagStatus{
+			On:        atomic.LoadUint64(&f.stat.on),
+			Off:       atomic.LoadUint64(&f.stat.off),
+			Undefined: atomic.LoadUint64(&f.stat.undefined),
+		}
+	}
+	return s
+}
+
+// Close closes FeatureFlag.
+func (ff *FeatureFlag) Close() {
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package featureflag
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/featureflags"
+)
+
+func newFeatureFlag(t *testing.T, yamlConfig string, flags ...*featureflags.Flag) *FeatureFlag {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	ff := kind.CreateInstance(spec).(*FeatureFlag)
+	ff.lookup = func(name string) (*featureflags.Flag, bool) {
+		for _, f := range flags {
+			if f.Name == name {
+				return f, true
+			}
+		}
+		return nil, false
+	}
+	ff.Init()
+	return ff
+}
+
+func newContext(t *testing.T, header http.Header) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{Flags: []string{"a", "b"}}).Validate())
+	assert.Error((&Spec{Flags: []string{"a", "a"}}).Validate())
+	assert.Error((&Spec{Flags: []string{""}}).Validate())
+	assert.Error((&Spec{Flags: []string{"a,b"}}).Validate())
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	ff := newFeatureFlag(t, `
+kind: FeatureFlag
+name: ff
+flags: [new-ui, fast-path, missing]
+consumerHeader: X-Consumer
+`,
+		&featureflags.Flag{Name: "new-ui", Enabled: true, Consumers: []string{"alice"}},
+		&featureflags.Flag{Name: "fast-path", Enabled: true, Percent: 100},
+	)
+
+	ctx := newContext(t, http.Header{"X-Consumer": {"alice"}, "X-Feature-Flags": {"missing"}})
+	assert.Equal("", ff.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("new-ui,fast-path", req.HTTPHeader().Get("X-Feature-Flags"))
+
+	ctx = newContext(t, http.Header{"X-Consumer": {"bob"}})
+	ff.Handle(ctx)
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("fast-path", req.HTTPHeader().Get("X-Feature-Flags"))
+
+	// the indicators are kept by the next generation.
+	next := kind.CreateInstance(ff.spec).(*FeatureFlag)
+	next.lookup = ff.lookup
+	next.Inherit(ff)
+	ctx = newContext(t, http.Header{"X-Feature-Flags": {"new-ui"}})
+	next.Handle(ctx)
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("fast-path", req.HTTPHeader().Get("X-Feature-Flags"))
+
+	status := next.Status().(*Status)
+	assert.Equal(&FlagStatus{On: 1, Off: 2}, status.Flags["new-ui"])
+	assert.Equal(&FlagStatus{On: 3}, status.Flags["fast-path"])
+	assert.Equal(&FlagStatus{Off: 3, Undefined: 3}, status.Flags["missing"])
+}
@@ -19,6 +19,7 @@
 package filters
 
 import (
+	stdcontext "context"
 	"fmt"
 
 	"github.com/megaease/easegress/v2/pkg/context"
@@ -28,6 +29,14 @@ import (
 	"github.com/megaease/easegress/v2/pkg/v"
 )
 
+// The types of the indicator values.
+const (
+	IndicatorTypeInteger = "integer"
+	IndicatorTypeNumber  = "number"
+	IndicatorTypeString  = "string"
+	IndicatorTypeBoolean = "boolean"
+)
+
 type (
 	// Kind contains the meta data and functions of a filter kind.
 	Kind struct {
@@ -48,6 +57,24 @@ type (
 		// function should always return a new spec copy, because the caller
 		// may modify the returned spec.
 		DefaultSpec func() Spec
+
+		// Indicators describe the indicators in the status of the filter,
+		// it is optional.
+		Indicators []*Indicator
+	}
+
+	// Indicator describes an indicator in the status of the filter.
+	Indicator struct {
+		// Name is the path of the indicator in the status, the keys of
+		// the maps are represented by '*', like 'classes.*.requests'.
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		// Type is the type of the value, one of integer, number, string
+		// and boolean.
+		Type string `json:"type"`
+		// Unit is the unit of the value, like requests, ms or %, it is
+		// empty if the value has no unit.
+		Unit string `json:"unit,omitempty"`
 	}
 
 	// Filter is the interface of filters handling traffic of various protocols.
@@ -82,11 +109,56 @@ type (
 		Close()
 	}
 
+	// Warmer is the interface of filters which need to warm up before
+	// receiving traffic, like preloading caches or establishing connection
+	// pools.
+	Warmer interface {
+		// Warmup is called after Init or Inherit, the pipeline doesn't
+		// receive traffic until all of its filters warm up. It should
+		// return when ctx is done, which means the warm-up timeout expires.
+		Warmup(ctx stdcontext.Context) error
+	}
+
+	// Drainer is the interface of filters which need to flush the buffered
+	// data when the pipeline is closed or replaced by a new generation.
+	Drainer interface {
+		// Drain is called after the in-flight tasks complete or the drain
+		// timeout expires, and before Close.
+		Drain()
+	}
+
 	// Resiliencer is the interface of objects that accept resilience policies.
 	Resiliencer interface {
 		InjectResiliencePolicy(policies map[string]resilience.Policy)
 	}
 
+	// DataSpec is the interface of filter specs which read or write the
+	// task data, the pipeline checks at config time that the data read by
+	// a filter is written before it and the types match.
+	DataSpec interface {
+		// DataInputs returns the data read by the filter, the filter
+		// can't work without them.
+		DataInputs() []context.DataDecl
+		// DataOutputs returns the data written by the filter.
+		DataOutputs() []context.DataDecl
+	}
+
+	// ReferenceSpec is implemented by the filter specs which reference
+	// objects by name, like the service registry of a proxy pool, the
+	// pipeline collects them to track the dependencies between objects.
+	ReferenceSpec interface {
+		// References returns the names of the referenced objects.
+		References() []string
+	}
+
+	// TemplateReferenceSpec is implemented by the filter specs which refer
+	// to the shared inline templates, the pipeline collects them so the
+	// templates in use are not deleted.
+	TemplateReferenceSpec interface {
+		// TemplateReferences returns the names of the shared templates.
+		TemplateReferences() []string
+	}
+
 	// Spec is the common interface of filter specs
 	Spec interface {
 		// Super returns supervisor
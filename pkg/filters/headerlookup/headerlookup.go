@@ -284,5 +284,11 @@ func (hl *HeaderLookup) Handle(ctx *context.Context) string {
 	return ""
 }
 
+// NeedPayload returns false for both payloads, the looked up values are
+// set to the headers only, it implements context.PayloadNeeder.
+func (hl *HeaderLookup) NeedPayload() (request, response bool) {
+	return false, false
+}
+
 // Status returns status.
 func (hl *HeaderLookup) Status() interface{} { return nil }
@@ -105,6 +105,12 @@ func (h *HeaderToJSON) Inherit(previousGeneration filters.Filter) {
 func (h *HeaderToJSON) Close() {
 }
 
+// NeedPayload returns true for the request payload, which is merged with
+// the headers, it implements context.PayloadNeeder.
+func (h *HeaderToJSON) NeedPayload() (request, response bool) {
+	return true, false
+}
+
 // Status return status of HeaderToJSON
 func (h *HeaderToJSON) Status() interface{} {
 	return nil
@@ -59,9 +59,9 @@ type (
 		done     chan struct{}
 
 		defaultTopic string
-		topicKey     string
-		headerKey    string
-		payloadKey   string
+		topicKey     context.DataKey[string]
+		headerKey    context.DataKey[map[string]string]
+		payloadKey   context.DataKey[[]byte]
 	}
 )
 
@@ -85,9 +85,9 @@ func (k *Kafka) Spec() filters.Spec {
 func (k *Kafka) setKV() {
 	kv := k.spec.KVMap
 	if kv != nil {
-		k.topicKey = kv.TopicKey
-		k.headerKey = kv.HeaderKey
-		k.payloadKey = kv.PayloadKey
+		k.topicKey = context.NewUserDataKey[string](kv.TopicKey)
+		k.headerKey = context.NewUserDataKey[map[string]string](kv.HeaderKey)
+		k.payloadKey = context.NewUserDataKey[[]byte](kv.PayloadKey)
 	}
 	if k.spec.Topic != nil {
 		k.defaultTopic = k.spec.Topic.Default
@@ -154,21 +154,21 @@ func (k *Kafka) Handle(ctx *context.Context) string {
 	var ok bool
 
 	// set data from kv map
-	if k.topicKey != "" {
-		topic, ok = ctx.GetData(k.topicKey).(string)
+	if k.topicKey.Name() != "" {
+		topic, ok = k.topicKey.Get(ctx)
 		if !ok {
 			return resultGetDataFailed
 		}
 	}
 	var headerFromData map[string]string
-	if k.headerKey != "" {
-		headerFromData, ok = ctx.GetData(k.headerKey).(map[string]string)
+	if k.headerKey.Name() != "" {
+		headerFromData, ok = k.headerKey.Get(ctx)
 		if !ok {
 			return resultGetDataFailed
 		}
 	}
-	if k.payloadKey != "" {
-		payload, ok = ctx.GetData(k.payloadKey).([]byte)
+	if k.payloadKey.Name() != "" {
+		payload, ok = k.payloadKey.Get(ctx)
 		if !ok {
 			return resultGetDataFailed
 		}
@@ -17,7 +17,10 @@
 
 package kafka
 
-import "github.com/megaease/easegress/v2/pkg/filters"
+import (
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+)
 
 type (
 	// Spec is spec of Kafka
@@ -41,3 +44,25 @@ type (
 		PayloadKey string `json:"payloadKey" jsonschema:"required"`
 	}
 )
+
+// DataInputs returns the data read by Kafka.
+func (s *Spec) DataInputs() []context.DataDecl {
+	var decls []context.DataDecl
+	if kv := s.KVMap; kv != nil {
+		if kv.TopicKey != "" {
+			decls = append(decls, context.NewUserDataKey[string](kv.TopicKey).Decl())
+		}
+		if kv.HeaderKey != "" {
+			decls = append(decls, context.NewUserDataKey[map[string]string](kv.HeaderKey).Decl())
+		}
+		if kv.PayloadKey != "" {
+			decls = append(decls, context.NewUserDataKey[[]byte](kv.PayloadKey).Decl())
+		}
+	}
+	return decls
+}
+
+// DataOutputs returns the data written by Kafka.
+func (s *Spec) DataOutputs() []context.DataDecl {
+	return nil
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/Shopify/sarama"
 	"github.com/megaease/easegress/v2/pkg/context"
@@ -64,6 +65,16 @@ type (
 		headerTopic string
 		headerKey   string
 		done        chan struct{}
+
+		// pending is the number of messages sent but not acknowledged, it
+		// is only counted when MaxPending is set.
+		pending int64
+	}
+
+	// Status is the status of Kafka.
+	Status struct {
+		Pending      int64 `json:"pending,omitempty"`
+		Backpressure bool  `json:"backpressure,omitempty"`
 	}
 
 	// Err is the error of Kafka
@@ -73,7 +84,10 @@ type (
 	}
 )
 
-var _ filters.Filter = (*Kafka)(nil)
+var (
+	_ filters.Filter        = (*Kafka)(nil)
+	_ context.Backpressurer = (*Kafka)(nil)
+)
 
 // Name returns the name of the Kafka filter instance.
 func (k *Kafka) Name() string {
@@ -122,6 +136,8 @@ func (k *Kafka) Init() {
 		}
 		k.syncProcuder = producer
 	} else {
+		// the successes are required to count the pending messages.
+		config.Producer.Return.Successes = spec.MaxPending > 0
 		producer, err := sarama.NewAsyncProducer(k.spec.Backend, config)
 		if err != nil {
 			panic(fmt.Errorf("start sarama async producer with address %v failed: %v", k.spec.Backend, err))
@@ -145,11 +161,28 @@ func (k *Kafka) checkProduceError() {
 			if !ok {
 				return
 			}
+			k.acked()
 			logger.Errorf("sarama producer failed: %v", err)
+		case _, ok := <-k.asyncProducer.Successes():
+			if !ok {
+				return
+			}
+			k.acked()
 		}
 	}
 }
 
+func (k *Kafka) acked() {
+	if k.spec.MaxPending > 0 {
+		atomic.AddInt64(&k.pending, -1)
+	}
+}
+
+// Backpressure reports whether the pending messages reach MaxPending.
+func (k *Kafka) Backpressure() bool {
+	return k.spec.MaxPending > 0 && atomic.LoadInt64(&k.pending) >= k.spec.MaxPending
+}
+
 // Inherit init Kafka based on previous generation
 func (k *Kafka) Inherit(previousGeneration filters.Filter) {
 	k.Init()
@@ -162,7 +195,13 @@ func (k *Kafka) Close() {
 
 // Status return status of Kafka
 func (k *Kafka) Status() interface{} {
-	return nil
+	if k.spec.Sync || k.spec.MaxPending == 0 {
+		return nil
+	}
+	return &Status{
+		Pending:      atomic.LoadInt64(&k.pending),
+		Backpressure: k.Backpressure(),
+	}
 }
 
 func (k *Kafka) getTopic(req *httpprot.Request) string {
@@ -217,6 +256,9 @@ func (k *Kafka) Handle(ctx *context.Context) (result string) {
 		return ""
 	}
 
+	if k.spec.MaxPending > 0 {
+		atomic.AddInt64(&k.pending, 1)
+	}
 	k.asyncProducer.Input() <- msg
 	return ""
 }
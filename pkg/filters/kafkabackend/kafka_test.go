@@ -23,6 +23,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/megaease/easegress/v2/pkg/context"
@@ -37,7 +38,8 @@ func init() {
 }
 
 type mockAsyncProducer struct {
-	ch chan *sarama.ProducerMessage
+	ch        chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
 }
 
 func (m *mockAsyncProducer) IsTransactional() bool {
@@ -69,7 +71,7 @@ func (m *mockAsyncProducer) AddMessageToTxn(msg *sarama.ConsumerMessage, groupID
 }
 
 func (m *mockAsyncProducer) AsyncClose()                               {}
-func (m *mockAsyncProducer) Successes() <-chan *sarama.ProducerMessage { return nil }
+func (m *mockAsyncProducer) Successes() <-chan *sarama.ProducerMessage { return m.successes }
 func (m *mockAsyncProducer) Errors() <-chan *sarama.ProducerError      { return nil }
 
 func (m *mockAsyncProducer) Input() chan<- *sarama.ProducerMessage {
@@ -226,6 +228,39 @@ func TestHandleHTTP(t *testing.T) {
 	assert.Equal("text", string(value))
 }
 
+func TestBackpressure(t *testing.T) {
+	assert := assert.New(t)
+	producer := &mockAsyncProducer{
+		ch:        make(chan *sarama.ProducerMessage, 100),
+		successes: make(chan *sarama.ProducerMessage, 100),
+	}
+	kafka := Kafka{
+		spec: &Spec{
+			Topic:      &Topic{Default: "default-topic"},
+			MaxPending: 2,
+		},
+		asyncProducer: producer,
+		done:          make(chan struct{}),
+	}
+	kafka.setHeader()
+
+	ctx := context.New(nil)
+	for i := 0; i < 2; i++ {
+		assert.False(kafka.Backpressure())
+		req, err := http.NewRequest(http.MethodPost, "127.0.0.1", strings.NewReader("text"))
+		assert.Nil(err)
+		setRequest(t, ctx, req)
+		assert.Equal("", kafka.Handle(ctx))
+	}
+	assert.True(kafka.Backpressure())
+	assert.True(kafka.Status().(*Status).Backpressure)
+
+	go kafka.checkProduceError()
+	defer kafka.Close()
+	producer.successes <- <-producer.ch
+	assert.Eventually(func() bool { return !kafka.Backpressure() }, time.Second, 10*time.Millisecond)
+}
+
 func TestHandleHTTPSync(t *testing.T) {
 	assert := assert.New(t)
 	kafka := Kafka{
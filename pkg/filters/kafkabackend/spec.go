@@ -29,6 +29,11 @@ type (
 
 		Topic *Topic `json:"topic" jsonschema:"required"`
 		Key   Key    `json:"key,omitempty"`
+
+		// MaxPending is the number of messages sent but not acknowledged by
+		// Kafka, above which the filter signals backpressure, so that the
+		// traffic sources slow down. It only works in async mode.
+		MaxPending int64 `json:"maxPending,omitempty" jsonschema:"minimum=1"`
 	}
 
 	// Topic defined ways to get Kafka topic
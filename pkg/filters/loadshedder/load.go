@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadshedder
+
+import (
+	"sync"
+	"time"
+)
+
+// load tracks the in-flight requests and their latency, it is shared by
+// the generations of the filter, as the requests admitted by a previous
+// generation finish after the filter is updated.
+type load struct {
+	mutex    sync.Mutex
+	inflight int
+
+	// the latency is the mean duration of the requests finished in the
+	// last window, so it recovers even if no request finishes, like when
+	// all requests are shed.
+	window      time.Duration
+	windowStart time.Time
+	sum         time.Duration
+	count       int
+	latency     time.Duration
+}
+
+func newLoad(window time.Duration, now time.Time) *load {
+	return &load{window: window, windowStart: now}
+}
+
+// roll starts a new window if the current one is over, the caller must
+// hold the mutex.
+func (l *load) roll(now time.Time) {
+	elapsed := now.Sub(l.windowStart)
+	if elapsed < l.window {
+		return
+	}
+	l.latency = 0
+	if elapsed < 2*l.window && l.count > 0 {
+		l.latency = l.sum / time.Duration(l.count)
+	}
+	l.windowStart = now
+	l.sum, l.count = 0, 0
+}
+
+func (l *load) start() {
+	l.mutex.Lock()
+	l.inflight++
+	l.mutex.Unlock()
+}
+
+func (l *load) finish(d time.Duration, now time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.inflight--
+	l.roll(now)
+	l.sum += d
+	l.count++
+}
+
+// stat returns the in-flight requests and the latency.
+func (l *load) stat(now time.Time) (int, time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.roll(now)
+	return l.inflight, l.latency
+}
+
+// saturation returns the saturation in percentage, which is the max of the
+// ratios of the in-flight requests and the latency to their limits, a zero
+// limit is ignored.
+func saturation(inflight, maxInflight int, latency, maxLatency time.Duration) float64 {
+	s := 0.0
+	if maxInflight > 0 {
+		s = float64(inflight) * 100 / float64(maxInflight)
+	}
+	if maxLatency > 0 {
+		if ls := float64(latency) * 100 / float64(maxLatency); ls > s {
+			s = ls
+		}
+	}
+	return s
+}
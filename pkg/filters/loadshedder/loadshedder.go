@@ -0,0 +1,341 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package loadshedder implements a filter to shed the low priority requests
+// first when the upstreams are saturated.
+package loadshedder
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/object/tenantmanager"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+	"github.com/megaease/easegress/v2/pkg/util/urlrule"
+)
+
+const (
+	// Kind is the kind of LoadShedder.
+	Kind = "LoadShedder"
+
+	resultShed = "shed"
+
+	defaultLatencyWindow = 5 * time.Second
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "LoadShedder sheds the low priority requests first when the upstreams are saturated.",
+	Results:     []string{resultShed},
+	Indicators: []*filters.Indicator{
+		{Name: "saturation", Description: "Saturation of the pipeline", Type: filters.IndicatorTypeNumber, Unit: "%"},
+		{Name: "inflight", Description: "Number of the requests being processed", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "latency", Description: "Recent latency of the pipeline, a duration like 120ms", Type: filters.IndicatorTypeString},
+		{Name: "classes.*.requests", Description: "Number of the requests of the priority class", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "classes.*.shed", Description: "Number of the shed requests of the priority class", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &LoadShedder{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// LoadShedder is the filter to shed the requests by their priorities.
+	LoadShedder struct {
+		spec          *Spec
+		maxLatency    time.Duration
+		load          *load
+		classes       []*class
+		defaultClass  *class
+		latencyWindow time.Duration
+	}
+
+	// Spec is the spec of LoadShedder.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// MaxInflight and MaxLatency are the triggers of the saturation,
+		// the saturation is 100% when the in-flight requests or the mean
+		// latency reaches them, a zero value disables the trigger.
+		MaxInflight int    `json:"maxInflight,omitempty" jsonschema:"minimum=0"`
+		MaxLatency  string `json:"maxLatency,omitempty" jsonschema:"format=duration"`
+		// LatencyWindow is the window of the mean latency, default is 5s.
+		LatencyWindow string `json:"latencyWindow,omitempty" jsonschema:"format=duration"`
+		// ConsumerHeader is the header carrying the consumer of a request,
+		// used when the consumer is not identified by a TenantLimiter.
+		ConsumerHeader string `json:"consumerHeader,omitempty"`
+		// Classes are the priority classes, from the highest priority to
+		// the lowest.
+		Classes []*ClassSpec `json:"classes" jsonschema:"required,minItems=1"`
+		// DefaultClass is the class of the requests not matching any
+		// class, default is the last one.
+		DefaultClass string `json:"defaultClass,omitempty"`
+	}
+
+	// ClassSpec is the spec of a priority class. A request belongs to the
+	// class if it matches any of the URLs, the headers and the consumers.
+	ClassSpec struct {
+		Name      string                               `json:"name" jsonschema:"required"`
+		URLs      []*urlrule.URLRule                   `json:"urls,omitempty"`
+		Headers   map[string]*stringtool.StringMatcher `json:"headers,omitempty"`
+		Consumers []string                             `json:"consumers,omitempty"`
+		// ShedAt is the saturation in percentage from which the requests
+		// of the class are shed, the class is never shed if it is zero.
+		ShedAt float64 `json:"shedAt,omitempty" jsonschema:"minimum=0"`
+	}
+
+	// Status is the status of LoadShedder.
+	Status struct {
+		// Saturation is in percentage.
+		Saturation float64                 `json:"saturation"`
+		Inflight   int                     `json:"inflight"`
+		Latency    string                  `json:"latency"`
+		Classes    map[string]*ClassStatus `json:"classes"`
+	}
+
+	// ClassStatus is the status of a priority class.
+	ClassStatus struct {
+		Requests uint64 `json:"requests"`
+		Shed     uint64 `json:"shed"`
+	}
+
+	class struct {
+		spec      *ClassSpec
+		consumers map[string]bool
+		// stat is kept across the generations of the filter.
+		stat *classStat
+	}
+
+	classStat struct {
+		requests uint64
+		shed     uint64
+	}
+)
+
+// Validate validates the spec of LoadShedder.
+func (s *Spec) Validate() error {
+	if s.MaxInflight == 0 && s.MaxLatency == "" {
+		return fmt.Errorf("maxInflight or maxLatency is required")
+	}
+	if s.MaxLatency != "" {
+		if d, err := time.ParseDuration(s.MaxLatency); err != nil || d <= 0 {
+			return fmt.Errorf("invalid maxLatency %s", s.MaxLatency)
+		}
+	}
+	if s.LatencyWindow != "" {
+		if d, err := time.ParseDuration(s.LatencyWindow); err != nil || d <= 0 {
+			return fmt.Errorf("invalid latencyWindow %s", s.LatencyWindow)
+		}
+	}
+
+	names := map[string]bool{}
+	for i, c := range s.Classes {
+		if names[c.Name] {
+			return fmt.Errorf("duplicated class %s", c.Name)
+		}
+		names[c.Name] = true
+		for _, h := range c.Headers {
+			if err := h.Validate(); err != nil {
+				return fmt.Errorf("class %s: %v", c.Name, err)
+			}
+		}
+		// a class must be shed before the classes of higher priorities.
+		if i > 0 {
+			prev := s.Classes[i-1]
+			if prev.ShedAt > 0 && (c.ShedAt == 0 || c.ShedAt > prev.ShedAt) {
+				return fmt.Errorf("shedAt of class %s must not be greater than that of class %s", c.Name, prev.Name)
+			}
+		}
+	}
+	if s.DefaultClass != "" && !names[s.DefaultClass] {
+		return fmt.Errorf("default class %s not found", s.DefaultClass)
+	}
+	return nil
+}
+
+// Name returns the name of the LoadShedder filter instance.
+func (ls *LoadShedder) Name() string {
+	return ls.spec.Name()
+}
+
+// Kind returns the kind of LoadShedder.
+func (ls *LoadShedder) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the LoadShedder.
+func (ls *LoadShedder) Spec() filters.Spec {
+	return ls.spec
+}
+
+// Init initializes LoadShedder.
+func (ls *LoadShedder) Init() {
+	ls.reload(nil)
+}
+
+// Inherit inherits previous generation of LoadShedder, the load and the
+// indicators of the classes with the same names are kept.
+func (ls *LoadShedder) Inherit(previousGeneration filters.Filter) {
+	ls.reload(previousGeneration.(*LoadShedder))
+}
+
+func (ls *LoadShedder) reload(prev *LoadShedder) {
+	if ls.spec.MaxLatency != "" {
+		ls.maxLatency, _ = time.ParseDuration(ls.spec.MaxLatency)
+	}
+	ls.latencyWindow = defaultLatencyWindow
+	if ls.spec.LatencyWindow != "" {
+		ls.latencyWindow, _ = time.ParseDuration(ls.spec.LatencyWindow)
+	}
+
+	stats := map[string]*classStat{}
+	if prev != nil {
+		ls.load = prev.load
+		ls.load.mutex.Lock()
+		ls.load.window = ls.latencyWindow
+		ls.load.mutex.Unlock()
+		for _, c := range prev.classes {
+			stats[c.spec.Name] = c.stat
+		}
+	} else {
+		ls.load = newLoad(ls.latencyWindow, time.Now())
+	}
+
+	for _, spec := range ls.spec.Classes {
+		for _, u := range spec.URLs {
+			u.Init()
+		}
+		for _, h := range spec.Headers {
+			h.Init()
+		}
+		c := &class{spec: spec, consumers: map[string]bool{}, stat: stats[spec.Name]}
+		if c.stat == nil {
+			c.stat = &classStat{}
+		}
+		for _, name := range spec.Consumers {
+			c.consumers[name] = true
+		}
+		ls.classes = append(ls.classes, c)
+		if spec.Name == ls.spec.DefaultClass {
+			ls.defaultClass = c
+		}
+	}
+	if ls.defaultClass == nil {
+		ls.defaultClass = ls.classes[len(ls.classes)-1]
+	}
+}
+
+// classify returns the class of the request.
+func (ls *LoadShedder) classify(ctx *context.Context, req *httpprot.Request) *class {
+	consumer := tenantmanager.ConsumerOf(ctx, req, ls.spec.ConsumerHeader)
+	for _, c := range ls.classes {
+		if consumer != "" && c.consumers[consumer] {
+			return c
+		}
+		for _, u := range c.spec.URLs {
+			if u.Match(req.Std()) {
+				return c
+			}
+		}
+		for key, m := range c.spec.Headers {
+			if m.MatchAny(req.HTTPHeader().Values(key)) {
+				return c
+			}
+		}
+	}
+	return ls.defaultClass
+}
+
+// Handle sheds the request if the saturation reaches the threshold of its
+// class, the admitted request is counted until the response is sent.
+func (ls *LoadShedder) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	c := ls.classify(ctx, req)
+	atomic.AddUint64(&c.stat.requests, 1)
+
+	if c.spec.ShedAt > 0 {
+		inflight, latency := ls.load.stat(time.Now())
+		if s := saturation(inflight, ls.spec.MaxInflight, latency, ls.maxLatency); s >= c.spec.ShedAt {
+			atomic.AddUint64(&c.stat.shed, 1)
+			return ls.shed(ctx, c, s)
+		}
+	}
+
+	l := ls.load
+	l.start()
+	start := time.Now()
+	ctx.OnFinish(func() {
+		now := time.Now()
+		l.finish(now.Sub(start), now)
+	})
+	return ""
+}
+
+func (ls *LoadShedder) shed(ctx *context.Context, c *class, saturation float64) string {
+	ctx.AddTag(fmt.Sprintf("loadShedder: shed %s at saturation %.1f%%", c.spec.Name, saturation))
+
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+
+	resp.SetStatusCode(http.StatusServiceUnavailable)
+	resp.HTTPHeader().Set("X-EG-Load-Shedder", c.spec.Name)
+
+	ctx.SetOutputResponse(resp)
+	return resultShed
+}
+
+// NeedPayload returns false for both payloads, requests are shed before
+// their bodies are read, it implements context.PayloadNeeder.
+func (ls *LoadShedder) NeedPayload() (request, response bool) {
+	return false, false
+}
+
+// Status returns Status generated by Runtime.
+func (ls *LoadShedder) Status() interface{} {
+	inflight, latency := ls.load.stat(time.Now())
+	s := &Status{
+		Saturation: saturation(inflight, ls.spec.MaxInflight, latency, ls.maxLatency),
+		Inflight:   inflight,
+		Latency:    latency.String(),
+		Classes:    map[string]*ClassStatus{},
+	}
+	for _, c := range ls.classes {
+		s.Classes[c.spec.Name] = &ClassStatus{
+			Requests: atomic.LoadUint64(&c.stat.requests),
+			Shed:     atomic.LoadUint64(&c.stat.shed),
+		}
+	}
+	return s
+}
+
+// Close closes LoadShedder.
+func (ls *LoadShedder) Close() {
+}
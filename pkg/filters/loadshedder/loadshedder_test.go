@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package loadshedder
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func newLoadShedder(t *testing.T, yamlConfig string) *LoadShedder {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	ls := kind.CreateInstance(spec).(*LoadShedder)
+	ls.Init()
+	return ls
+}
+
+func newContext(t *testing.T, path string, header map[string]string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1"+path, nil)
+	for k, v := range header {
+		stdr.Header.Set(k, v)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	classes := []*ClassSpec{{Name: "high"}, {Name: "normal", ShedAt: 90}, {Name: "low", ShedAt: 70}}
+	assert.NoError((&Spec{MaxInflight: 10, Classes: classes}).Validate())
+	assert.NoError((&Spec{MaxLatency: "1s", DefaultClass: "normal", Classes: classes}).Validate())
+	assert.Error((&Spec{Classes: classes}).Validate())
+	assert.Error((&Spec{MaxLatency: "x", Classes: classes}).Validate())
+	assert.Error((&Spec{MaxInflight: 10, DefaultClass: "none", Classes: classes}).Validate())
+	assert.Error((&Spec{MaxInflight: 10, Classes: []*ClassSpec{{Name: "a"}, {Name: "a"}}}).Validate())
+	assert.Error((&Spec{MaxInflight: 10, Classes: []*ClassSpec{{Name: "a", ShedAt: 70}, {Name: "b", ShedAt: 90}}}).Validate())
+	assert.Error((&Spec{MaxInflight: 10, Classes: []*ClassSpec{{Name: "a", ShedAt: 70}, {Name: "b"}}}).Validate())
+}
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	l := newLoad(time.Second, now)
+	l.start()
+	l.start()
+	l.finish(100*time.Millisecond, now)
+	l.finish(300*time.Millisecond, now.Add(500*time.Millisecond))
+
+	inflight, latency := l.stat(now.Add(900 * time.Millisecond))
+	assert.Equal(0, inflight)
+	assert.Zero(latency, "the first window is not over")
+
+	_, latency = l.stat(now.Add(1500 * time.Millisecond))
+	assert.Equal(200*time.Millisecond, latency)
+
+	// no request finishes in the next window.
+	_, latency = l.stat(now.Add(2600 * time.Millisecond))
+	assert.Zero(latency)
+
+	assert.Equal(50.0, saturation(5, 10, 0, 0))
+	assert.Equal(150.0, saturation(5, 10, 300*time.Millisecond, 200*time.Millisecond))
+	assert.Equal(0.0, saturation(5, 0, 0, 0))
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	ls := newLoadShedder(t, `
+kind: LoadShedder
+name: ls
+maxInflight: 4
+consumerHeader: X-Consumer
+classes:
+- name: critical
+  urls:
+  - url:
+      prefix: /checkout
+  consumers: [vip]
+- name: normal
+  headers:
+    X-Priority:
+      exact: normal
+  shedAt: 75
+- name: low
+  shedAt: 50
+`)
+	defer ls.Close()
+
+	ctx := newContext(t, "/checkout", nil)
+	assert.Equal("critical", ls.classify(ctx, ctx.GetInputRequest().(*httpprot.Request)).spec.Name)
+
+	handle := func(path string, header map[string]string) (*context.Context, string) {
+		ctx := newContext(t, path, header)
+		return ctx, ls.Handle(ctx)
+	}
+
+	var admitted []*context.Context
+	for i := 0; i < 2; i++ {
+		ctx, result := handle("/", nil)
+		assert.Equal("", result)
+		admitted = append(admitted, ctx)
+	}
+
+	// the saturation is 50%, the low class is shed.
+	var result string
+	ctx, result = handle("/", nil)
+	assert.Equal(resultShed, result)
+	assert.Equal(http.StatusServiceUnavailable, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+	assert.Equal("low", ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader().Get("X-EG-Load-Shedder"))
+
+	ctx, result = handle("/", map[string]string{"X-Priority": "normal"})
+	assert.Equal("", result)
+	admitted = append(admitted, ctx)
+
+	// the saturation is 75%, the normal class is shed, but not the
+	// critical one.
+	_, result = handle("/", map[string]string{"X-Priority": "normal"})
+	assert.Equal(resultShed, result)
+	ctx, result = handle("/", map[string]string{"X-Consumer": "vip"})
+	assert.Equal("", result)
+	admitted = append(admitted, ctx)
+
+	for _, ctx := range admitted {
+		ctx.Finish()
+	}
+	_, result = handle("/", nil)
+	assert.Equal("", result)
+
+	status := ls.Status().(*Status)
+	assert.Equal(1, status.Inflight)
+	assert.Equal(&ClassStatus{Requests: 4, Shed: 1}, status.Classes["low"])
+	assert.Equal(&ClassStatus{Requests: 2, Shed: 1}, status.Classes["normal"])
+	assert.Equal(&ClassStatus{Requests: 1, Shed: 0}, status.Classes["critical"])
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package localqueuewriter implements a filter to write the requests to a
+// LocalQueue.
+package localqueuewriter
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/localqueue"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of LocalQueueWriter.
+	Kind = "LocalQueueWriter"
+
+	resultEnqueueFailed = "enqueueFailed"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "LocalQueueWriter writes the requests to a LocalQueue, which drains them to a pipeline.",
+	Results:     []string{resultEnqueueFailed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &LocalQueueWriter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// LocalQueueWriter is the filter to write the requests to a LocalQueue.
+	LocalQueueWriter struct {
+		spec *Spec
+
+		enqueued uint64
+		failed   uint64
+	}
+
+	// Spec is the spec of LocalQueueWriter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Queue is the name of the LocalQueue.
+		Queue string `json:"queue" jsonschema:"required"`
+	}
+
+	// Status is the status of LocalQueueWriter.
+	Status struct {
+		Enqueued uint64 `json:"enqueued"`
+		Failed   uint64 `json:"failed"`
+	}
+)
+
+// Validate validates the spec of LocalQueueWriter.
+func (s *Spec) Validate() error {
+	if s.Queue == "" {
+		return errors.New("queue is required")
+	}
+	return nil
+}
+
+// References returns the LocalQueue.
+func (s *Spec) References() []string {
+	return []string{s.Queue}
+}
+
+// Name returns the name of the LocalQueueWriter filter instance.
+func (w *LocalQueueWriter) Name() string {
+	return w.spec.Name()
+}
+
+// Kind returns the kind of LocalQueueWriter.
+func (w *LocalQueueWriter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the LocalQueueWriter.
+func (w *LocalQueueWriter) Spec() filters.Spec {
+	return w.spec
+}
+
+// Init initializes LocalQueueWriter.
+func (w *LocalQueueWriter) Init() {
+}
+
+// Inherit inherits previous generation of LocalQueueWriter.
+func (w *LocalQueueWriter) Inherit(previousGeneration filters.Filter) {
+	prev := previousGeneration.(*LocalQueueWriter)
+	w.enqueued = atomic.LoadUint64(&prev.enqueued)
+	w.failed = atomic.LoadUint64(&prev.failed)
+}
+
+// NeedPayload returns true for the request, which is written to the queue
+// with its payload, it implements context.PayloadNeeder.
+func (w *LocalQueueWriter) NeedPayload() (request, response bool) {
+	return true, false
+}
+
+// Handle writes the request to the queue, and responds 202 Accepted.
+func (w *LocalQueueWriter) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	lq, ok := localqueue.Get(w.spec.Queue)
+	if !ok {
+		logger.Errorf("%s: queue %s not found", w.Name(), w.spec.Queue)
+		atomic.AddUint64(&w.failed, 1)
+		return resultEnqueueFailed
+	}
+	if err := lq.Enqueue(req); err != nil {
+		logger.Errorf("%s: write request to queue %s failed: %v", w.Name(), w.spec.Queue, err)
+		atomic.AddUint64(&w.failed, 1)
+		return resultEnqueueFailed
+	}
+	atomic.AddUint64(&w.enqueued, 1)
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusAccepted)
+	ctx.SetOutputResponse(resp)
+	return ""
+}
+
+// Status returns the status of LocalQueueWriter.
+func (w *LocalQueueWriter) Status() interface{} {
+	return &Status{
+		Enqueued: atomic.LoadUint64(&w.enqueued),
+		Failed:   atomic.LoadUint64(&w.failed),
+	}
+}
+
+// Close closes LocalQueueWriter.
+func (w *LocalQueueWriter) Close() {
+}
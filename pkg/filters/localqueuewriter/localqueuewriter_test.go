@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package localqueuewriter
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/context/contexttest"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/localqueue"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newWriter(t *testing.T, yamlConfig string) *LocalQueueWriter {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+	w := kind.CreateInstance(spec).(*LocalQueueWriter)
+	w.Init()
+	return w
+}
+
+func newContext(body string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/events", strings.NewReader(body))
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestLocalQueueWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := filters.NewSpec(nil, "", map[string]interface{}{"name": "writer", "kind": Kind})
+	assert.Error(err)
+
+	w := newWriter(t, `
+name: writer
+kind: LocalQueueWriter
+queue: events
+`)
+	assert.Equal("writer", w.Name())
+	assert.Equal(kind, w.Kind())
+
+	// the queue is not running.
+	assert.Equal(resultEnqueueFailed, w.Handle(newContext("event-0")))
+
+	superSpec, err := supervisor.NewSpec(fmt.Sprintf(`
+name: events
+kind: LocalQueue
+pipeline: drainer
+dir: %s
+`, t.TempDir()))
+	assert.NoError(err)
+	lq := &localqueue.LocalQueue{}
+	lq.Init(superSpec, &contexttest.MockedMuxMapper{
+		MockedGetHandler: func(name string) (context.Handler, bool) {
+			return nil, false
+		},
+	})
+	defer lq.Close()
+
+	ctx := newContext("event-1")
+	assert.Equal("", w.Handle(ctx))
+	assert.Equal(http.StatusAccepted, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	queueStatus := lq.Status().ObjectStatus.(*localqueue.Status)
+	assert.Equal(uint64(1), queueStatus.Enqueued)
+	assert.Greater(queueStatus.Pending, int64(0))
+
+	w2 := newWriter(t, `
+name: writer
+kind: LocalQueueWriter
+queue: events
+`)
+	w2.Inherit(w)
+	status := w2.Status().(*Status)
+	assert.Equal(uint64(1), status.Enqueued)
+	assert.Equal(uint64(1), status.Failed)
+	w2.Close()
+}
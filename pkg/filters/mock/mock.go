@@ -19,6 +19,8 @@
 package mock
 
 import (
+	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -26,6 +28,7 @@ import (
 	"github.com/megaease/easegress/v2/pkg/filters"
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/inlinetemplate"
 	"github.com/megaease/easegress/v2/pkg/util/stringtool"
 )
 
@@ -33,13 +36,14 @@ const (
 	// Kind is the kind of Mock.
 	Kind = "Mock"
 
-	resultMocked = "mocked"
+	resultMocked       = "mocked"
+	resultRenderFailed = "renderFailed"
 )
 
 var kind = &filters.Kind{
 	Name:        Kind,
 	Description: "Mock mocks the response.",
-	Results:     []string{resultMocked},
+	Results:     []string{resultMocked, resultRenderFailed},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{}
 	},
@@ -71,9 +75,13 @@ type (
 		Code    int               `json:"code" jsonschema:"required,format=httpcode"`
 		Headers map[string]string `json:"headers,omitempty"`
 		Body    string            `json:"body,omitempty"`
-		Delay   string            `json:"delay,omitempty" jsonschema:"format=duration"`
+		// BodyTemplate is an inline template of the body rendered with the
+		// request, it is mutually exclusive with Body.
+		BodyTemplate *inlinetemplate.Spec `json:"bodyTemplate,omitempty"`
+		Delay        string               `json:"delay,omitempty" jsonschema:"format=duration"`
 
-		delay time.Duration
+		delay    time.Duration
+		renderer *inlinetemplate.Renderer
 	}
 
 	// MatchRule is the rule to match a request
@@ -85,6 +93,33 @@ type (
 	}
 )
 
+// TemplateReferences returns the shared templates of the body templates.
+func (s *Spec) TemplateReferences() []string {
+	var names []string
+	for _, r := range s.Rules {
+		if r.BodyTemplate != nil {
+			names = append(names, r.BodyTemplate.Ref)
+		}
+	}
+	return names
+}
+
+// Validate validates the spec of Mock.
+func (s *Spec) Validate() error {
+	for i, r := range s.Rules {
+		if r.BodyTemplate == nil {
+			continue
+		}
+		if r.Body != "" {
+			return fmt.Errorf("rule %d: body and bodyTemplate are mutually exclusive", i)
+		}
+		if err := r.BodyTemplate.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
 // Name returns the name of the Mock filter instance.
 func (m *Mock) Name() string {
 	return m.spec.Name()
@@ -112,6 +147,9 @@ func (m *Mock) Inherit(previousGeneration filters.Filter) {
 
 func (m *Mock) reload() {
 	for _, r := range m.spec.Rules {
+		if r.BodyTemplate != nil {
+			r.renderer = inlinetemplate.NewRenderer(r.BodyTemplate)
+		}
 		if r.Delay == "" {
 			continue
 		}
@@ -121,12 +159,10 @@ func (m *Mock) reload() {
 
 // Handle mocks Context.
 func (m *Mock) Handle(ctx *context.Context) string {
-	result := ""
 	if rule := m.match(ctx); rule != nil {
-		m.mock(ctx, rule)
-		result = resultMocked
+		return m.mock(ctx, rule)
 	}
-	return result
+	return ""
 }
 
 func (m *Mock) match(ctx *context.Context) *Rule {
@@ -197,18 +233,31 @@ func (m *Mock) match(ctx *context.Context) *Rule {
 	return nil
 }
 
-func (m *Mock) mock(ctx *context.Context, rule *Rule) {
+func (m *Mock) mock(ctx *context.Context, rule *Rule) string {
 	resp, _ := httpprot.NewResponse(nil)
 
+	body := rule.Body
+	if rule.renderer != nil {
+		var err error
+		body, err = rule.renderer.Render(inlinetemplate.NewContextValues(ctx, nil))
+		if err != nil {
+			// a partial body is never mocked as if it succeeded.
+			logger.Errorf("%s: render body template failed: %v", m.Name(), err)
+			resp.SetStatusCode(http.StatusInternalServerError)
+			ctx.SetOutputResponse(resp)
+			return resultRenderFailed
+		}
+	}
+
 	resp.SetStatusCode(rule.Code)
 	for key, value := range rule.Headers {
 		resp.Std().Header.Set(key, value)
 	}
-	resp.SetPayload([]byte(rule.Body))
+	resp.SetPayload([]byte(body))
 	ctx.SetOutputResponse(resp)
 
 	if rule.delay <= 0 {
-		return
+		return resultMocked
 	}
 
 	req := ctx.GetInputRequest().(*httpprot.Request)
@@ -218,6 +267,13 @@ func (m *Mock) mock(ctx *context.Context, rule *Rule) {
 		logger.Debugf("request cancelled in the middle of delay mocking")
 	case <-time.After(rule.delay):
 	}
+	return resultMocked
+}
+
+// NeedPayload returns false for both payloads, a mocked response replaces
+// the response without reading it, it implements context.PayloadNeeder.
+func (m *Mock) NeedPayload() (request, response bool) {
+	return false, false
 }
 
 // Status returns status.
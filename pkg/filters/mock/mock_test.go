@@ -28,6 +28,7 @@ import (
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/inlinetemplate"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -213,3 +214,56 @@ rules:
 		assert.Equal(204, resp.StatusCode())
 	}
 }
+
+func TestMockBodyTemplate(t *testing.T) {
+	assert := assert.New(t)
+	const yamlConfig = `
+kind: Mock
+name: mock
+rules:
+- code: 200
+  bodyTemplate:
+    text: '{"path": ${req.path | json}, "user": "${req.header.X-User | default "guest"}"}'
+`
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+
+	m := kind.CreateInstance(spec)
+	m.Init()
+
+	ctx := context.New(nil)
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/pets", nil)
+	assert.Nil(err)
+	req.Header.Set("X-User", "alice")
+	setRequest(t, ctx, context.DefaultNamespace, req)
+
+	m.Handle(ctx)
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	body, err := io.ReadAll(resp.GetPayload())
+	assert.Nil(err)
+	assert.Equal(`{"path": "/pets", "user": "alice"}`, string(body))
+
+	// a reference to a template not defined fails the rendering.
+	rawSpec = make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(`
+kind: Mock
+name: mock
+rules:
+- code: 200
+  bodyTemplate:
+    ref: missing
+`), &rawSpec)
+	spec, err = filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	m = kind.CreateInstance(spec)
+	m.Init()
+	assert.Equal(resultRenderFailed, m.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode())
+
+	assert.Error((&Spec{Rules: []*Rule{{Body: "a", BodyTemplate: &inlinetemplate.Spec{Text: "b"}}}}).Validate())
+	assert.Error((&Spec{Rules: []*Rule{{BodyTemplate: &inlinetemplate.Spec{Text: "${"}}}}).Validate())
+}
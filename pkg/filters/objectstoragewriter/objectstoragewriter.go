@@ -0,0 +1,535 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package objectstoragewriter implements a filter to archive the payloads
+// of the tasks to an object storage, like S3 and Google Cloud Storage.
+package objectstoragewriter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/inlinetemplate"
+)
+
+const (
+	// Kind is the kind of ObjectStorageWriter.
+	Kind = "ObjectStorageWriter"
+
+	sourceRequest   = "request"
+	sourceResponse  = "response"
+	sourceData      = "data"
+	sourceAccessLog = "accessLog"
+
+	compressionGzip = "gzip"
+
+	defaultKey          = "${vars.pipeline}/${vars.filter}/${vars.date}/${vars.time}-${vars.uuid}${vars.ext}"
+	defaultMaxBatchSize = 8 << 20
+	defaultMaxBatchAge  = time.Minute
+	defaultTimeout      = 30 * time.Second
+
+	// uploadQueueSize is the max number of the batches waiting for the
+	// upload, the new batches are dropped when it is full.
+	uploadQueueSize = 8
+	maxAttempts     = 3
+	checkInterval   = time.Second
+)
+
+// retryBackoff is the backoff of the first retry of a failed upload, it
+// increases linearly with the attempts.
+var retryBackoff = time.Second
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ObjectStorageWriter archives the payloads of the requests or responses to an object storage in batches.",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{Source: sourceRequest}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ObjectStorageWriter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ObjectStorageWriter is the filter to archive the payloads of the
+	// tasks to an object storage. The payloads are appended to a batch,
+	// separated by new lines, and the batch is uploaded as an object when
+	// it is large or old enough.
+	ObjectStorageWriter struct {
+		spec        *Spec
+		uploader    uploader
+		key         *inlinetemplate.Template
+		dataKey     context.DataKey[[]byte]
+		member      string
+		maxSize     int64
+		maxAge      time.Duration
+		contentType string
+
+		mutex   sync.Mutex
+		closed  bool
+		batch   *batch
+		uploads chan *batch
+		done    chan struct{}
+		wg      sync.WaitGroup
+
+		records uint64
+		batches uint64
+		bytes   uint64
+		failed  uint64
+		dropped uint64
+
+		statusLock sync.Mutex
+		lastKey    string
+		lastError  string
+	}
+
+	// Spec is the spec of ObjectStorageWriter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Source is the payload to archive: the body of the request or
+		// the response, the task data of DataKey, or an access log
+		// record of the request.
+		Source  string `json:"source,omitempty" jsonschema:"enum=,enum=request,enum=response,enum=data,enum=accessLog"`
+		DataKey string `json:"dataKey,omitempty"`
+		// Key is the inline template of the object keys.
+		Key         string `json:"key,omitempty"`
+		Compression string `json:"compression,omitempty" jsonschema:"enum=,enum=gzip"`
+		ContentType string `json:"contentType,omitempty"`
+		// MaxBatchSize is the size of the payloads a batch is uploaded at,
+		// before the compression.
+		MaxBatchSize int64 `json:"maxBatchSize,omitempty" jsonschema:"minimum=1"`
+		// MaxBatchAge is the max duration a batch waits for the upload.
+		MaxBatchAge string `json:"maxBatchAge,omitempty" jsonschema:"format=duration"`
+		Timeout     string `json:"timeout,omitempty" jsonschema:"format=duration"`
+
+		S3  *S3Spec  `json:"s3,omitempty"`
+		GCS *GCSSpec `json:"gcs,omitempty"`
+	}
+
+	// Status is the status of ObjectStorageWriter.
+	Status struct {
+		// Records is the number of the archived payloads, and Dropped is
+		// the number of the payloads dropped because the uploads fail or
+		// can't keep up.
+		Records   uint64 `json:"records"`
+		Batches   uint64 `json:"batches"`
+		Bytes     uint64 `json:"bytes"`
+		Failed    uint64 `json:"failed"`
+		Dropped   uint64 `json:"dropped"`
+		LastKey   string `json:"lastKey,omitempty"`
+		LastError string `json:"lastError,omitempty"`
+	}
+
+	batch struct {
+		buf     bytes.Buffer
+		zw      *gzip.Writer
+		records uint64
+		size    int64
+		created time.Time
+	}
+
+	accessLogRecord struct {
+		Time         time.Time `json:"time"`
+		Method       string    `json:"method"`
+		Host         string    `json:"host"`
+		URI          string    `json:"uri"`
+		RealIP       string    `json:"realIP"`
+		UserAgent    string    `json:"userAgent,omitempty"`
+		StatusCode   int       `json:"statusCode,omitempty"`
+		RequestSize  int64     `json:"requestSize"`
+		ResponseSize int64     `json:"responseSize"`
+	}
+)
+
+// Validate validates the spec of ObjectStorageWriter.
+func (s *Spec) Validate() error {
+	if (s.S3 == nil) == (s.GCS == nil) {
+		return fmt.Errorf("exactly one of s3 and gcs is required")
+	}
+	if s.Source == sourceData && s.DataKey == "" {
+		return fmt.Errorf("dataKey is required for the source data")
+	}
+	if s.Key != "" {
+		if _, err := inlinetemplate.Parse(s.Key); err != nil {
+			return fmt.Errorf("invalid key: %v", err)
+		}
+	}
+	for _, d := range []string{s.MaxBatchAge, s.Timeout} {
+		if d == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d); err != nil || v <= 0 {
+			return fmt.Errorf("invalid duration %s", d)
+		}
+	}
+	return nil
+}
+
+// DataInputs returns the data read by ObjectStorageWriter.
+func (s *Spec) DataInputs() []context.DataDecl {
+	if s.Source != sourceData {
+		return nil
+	}
+	return []context.DataDecl{context.NewUserDataKey[[]byte](s.DataKey).Decl()}
+}
+
+// DataOutputs returns the data written by ObjectStorageWriter.
+func (s *Spec) DataOutputs() []context.DataDecl {
+	return nil
+}
+
+// Name returns the name of the ObjectStorageWriter filter instance.
+func (w *ObjectStorageWriter) Name() string {
+	return w.spec.Name()
+}
+
+// Kind returns the kind of ObjectStorageWriter.
+func (w *ObjectStorageWriter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ObjectStorageWriter.
+func (w *ObjectStorageWriter) Spec() filters.Spec {
+	return w.spec
+}
+
+// Init initializes ObjectStorageWriter.
+func (w *ObjectStorageWriter) Init() {
+	w.reload()
+}
+
+// Inherit inherits previous generation of ObjectStorageWriter, the
+// previous generation uploads its batch when it is drained.
+func (w *ObjectStorageWriter) Inherit(previousGeneration filters.Filter) {
+	prev := previousGeneration.(*ObjectStorageWriter)
+	w.records = atomic.LoadUint64(&prev.records)
+	w.batches = atomic.LoadUint64(&prev.batches)
+	w.bytes = atomic.LoadUint64(&prev.bytes)
+	w.failed = atomic.LoadUint64(&prev.failed)
+	w.dropped = atomic.LoadUint64(&prev.dropped)
+	w.reload()
+}
+
+func (w *ObjectStorageWriter) reload() {
+	key := w.spec.Key
+	if key == "" {
+		key = defaultKey
+	}
+	w.key, _ = inlinetemplate.Parse(key)
+	w.dataKey = context.NewUserDataKey[[]byte](w.spec.DataKey)
+	if super := w.spec.Super(); super != nil {
+		w.member = super.Options().Name
+	}
+
+	w.maxSize = w.spec.MaxBatchSize
+	if w.maxSize <= 0 {
+		w.maxSize = defaultMaxBatchSize
+	}
+	w.maxAge = defaultMaxBatchAge
+	if w.spec.MaxBatchAge != "" {
+		w.maxAge, _ = time.ParseDuration(w.spec.MaxBatchAge)
+	}
+	timeout := defaultTimeout
+	if w.spec.Timeout != "" {
+		timeout, _ = time.ParseDuration(w.spec.Timeout)
+	}
+
+	w.contentType = w.spec.ContentType
+	if w.contentType == "" {
+		w.contentType = "application/octet-stream"
+		if w.spec.Compression == compressionGzip {
+			w.contentType = "application/gzip"
+		}
+	}
+
+	if w.spec.S3 != nil {
+		w.uploader = newS3Uploader(w.spec.S3, timeout)
+	} else {
+		w.uploader = newGCSUploader(w.spec.GCS, timeout)
+	}
+
+	w.uploads = make(chan *batch, uploadQueueSize)
+	w.done = make(chan struct{})
+	w.wg.Add(2)
+	go w.runUploads()
+	go w.runRollover()
+}
+
+// record returns the payload to archive.
+func (w *ObjectStorageWriter) record(ctx *context.Context) []byte {
+	switch w.spec.Source {
+	case sourceResponse:
+		if resp, ok := ctx.GetInputResponse().(*httpprot.Response); ok && !resp.IsStream() {
+			return resp.RawPayload()
+		}
+	case sourceData:
+		data, _ := w.dataKey.Get(ctx)
+		return data
+	case sourceAccessLog:
+		return w.accessLog(ctx)
+	default:
+		if req, ok := ctx.GetInputRequest().(*httpprot.Request); ok && !req.IsStream() {
+			return req.RawPayload()
+		}
+	}
+	return nil
+}
+
+func (w *ObjectStorageWriter) accessLog(ctx *context.Context) []byte {
+	req, ok := ctx.GetInputRequest().(*httpprot.Request)
+	if !ok {
+		return nil
+	}
+	rec := &accessLogRecord{
+		Time:        time.Now().UTC(),
+		Method:      req.Method(),
+		Host:        req.Host(),
+		URI:         req.URL().RequestURI(),
+		RealIP:      req.RealIP(),
+		UserAgent:   req.HTTPHeader().Get("User-Agent"),
+		RequestSize: req.PayloadSize(),
+	}
+	if resp, ok := ctx.GetInputResponse().(*httpprot.Response); ok {
+		rec.StatusCode = resp.StatusCode()
+		rec.ResponseSize = resp.PayloadSize()
+	}
+	data, _ := codectool.MarshalJSON(rec)
+	return data
+}
+
+// NeedPayload returns whether the payload of the request or the response
+// is needed, it implements context.PayloadNeeder.
+func (w *ObjectStorageWriter) NeedPayload() (request, response bool) {
+	return w.spec.Source == "" || w.spec.Source == sourceRequest, w.spec.Source == sourceResponse
+}
+
+// Handle appends the payload of the task to the batch, it never fails the
+// task, as archiving is not a part of the business.
+func (w *ObjectStorageWriter) Handle(ctx *context.Context) string {
+	data := w.record(ctx)
+	if len(data) == 0 {
+		return ""
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		atomic.AddUint64(&w.dropped, 1)
+		return ""
+	}
+	if w.batch == nil {
+		w.batch = w.newBatch()
+	}
+
+	b := w.batch
+	var out io.Writer = &b.buf
+	if b.zw != nil {
+		out = b.zw
+	}
+	out.Write(data)
+	b.size += int64(len(data))
+	if data[len(data)-1] != '\n' {
+		out.Write([]byte{'\n'})
+		b.size++
+	}
+	b.records++
+	atomic.AddUint64(&w.records, 1)
+
+	if b.size >= w.maxSize {
+		w.roll()
+	}
+	return ""
+}
+
+func (w *ObjectStorageWriter) newBatch() *batch {
+	b := &batch{created: time.Now()}
+	if w.spec.Compression == compressionGzip {
+		b.zw = gzip.NewWriter(&b.buf)
+	}
+	return b
+}
+
+// roll sends the batch to the upload queue, the caller must hold the
+// mutex.
+func (w *ObjectStorageWriter) roll() {
+	b := w.batch
+	if b == nil {
+		return
+	}
+	w.batch = nil
+	if b.zw != nil {
+		b.zw.Close()
+	}
+
+	select {
+	case w.uploads <- b:
+	default:
+		atomic.AddUint64(&w.dropped, b.records)
+		logger.Warnf("%s: drop a batch of %d records, the uploads can't keep up", w.Name(), b.records)
+	}
+}
+
+// runRollover uploads the batches older than the max age.
+func (w *ObjectStorageWriter) runRollover() {
+	defer w.wg.Done()
+
+	interval := checkInterval
+	if w.maxAge < interval {
+		interval = w.maxAge
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			w.mutex.Lock()
+			if !w.closed && w.batch != nil && now.Sub(w.batch.created) >= w.maxAge {
+				w.roll()
+			}
+			w.mutex.Unlock()
+		}
+	}
+}
+
+func (w *ObjectStorageWriter) runUploads() {
+	defer w.wg.Done()
+
+	for b := range w.uploads {
+		w.upload(b)
+	}
+}
+
+func (w *ObjectStorageWriter) objectKey(b *batch) (string, error) {
+	t := b.created.UTC()
+	vars := inlinetemplate.Vars{
+		"pipeline": w.spec.Pipeline(),
+		"filter":   w.Name(),
+		"member":   w.member,
+		"date":     t.Format("2006/01/02"),
+		"hour":     t.Format("15"),
+		"time":     t.Format("20060102T150405Z"),
+		"uuid":     uuid.NewString(),
+		"ext":      "",
+	}
+	if w.spec.Compression == compressionGzip {
+		vars["ext"] = ".gz"
+	}
+
+	key, err := w.key.Render(vars)
+	if err != nil {
+		return "", err
+	}
+	key = strings.TrimLeft(key, "/")
+	if key == "" {
+		return "", fmt.Errorf("empty key")
+	}
+	return key, nil
+}
+
+// upload uploads the batch, the failed uploads are retried a few times
+// before the batch is dropped.
+func (w *ObjectStorageWriter) upload(b *batch) {
+	key, err := w.objectKey(b)
+	if err == nil {
+		for attempt := 1; attempt <= maxAttempts; attempt++ {
+			if err = w.uploader.upload(key, w.contentType, b.buf.Bytes()); err == nil {
+				break
+			}
+			if attempt < maxAttempts {
+				time.Sleep(time.Duration(attempt) * retryBackoff)
+			}
+		}
+	}
+
+	if err != nil {
+		logger.Errorf("%s: upload a batch of %d records failed: %v", w.Name(), b.records, err)
+		atomic.AddUint64(&w.failed, 1)
+		atomic.AddUint64(&w.dropped, b.records)
+		w.statusLock.Lock()
+		w.lastError = err.Error()
+		w.statusLock.Unlock()
+		return
+	}
+
+	atomic.AddUint64(&w.batches, 1)
+	atomic.AddUint64(&w.bytes, uint64(b.buf.Len()))
+	w.statusLock.Lock()
+	w.lastKey = key
+	w.statusLock.Unlock()
+}
+
+// Drain sends the batch to the upload queue, so the payloads are uploaded
+// before the filter is closed.
+func (w *ObjectStorageWriter) Drain() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if !w.closed {
+		w.roll()
+	}
+}
+
+// Status returns the status of ObjectStorageWriter.
+func (w *ObjectStorageWriter) Status() interface{} {
+	s := &Status{
+		Records: atomic.LoadUint64(&w.records),
+		Batches: atomic.LoadUint64(&w.batches),
+		Bytes:   atomic.LoadUint64(&w.bytes),
+		Failed:  atomic.LoadUint64(&w.failed),
+		Dropped: atomic.LoadUint64(&w.dropped),
+	}
+	w.statusLock.Lock()
+	s.LastKey, s.LastError = w.lastKey, w.lastError
+	w.statusLock.Unlock()
+	return s
+}
+
+// Close uploads the batch and waits for the uploads in the queue.
+func (w *ObjectStorageWriter) Close() {
+	close(w.done)
+
+	w.mutex.Lock()
+	w.roll()
+	w.closed = true
+	close(w.uploads)
+	w.mutex.Unlock()
+
+	w.wg.Wait()
+}
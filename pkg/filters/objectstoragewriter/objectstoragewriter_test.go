@@ -0,0 +1,256 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package objectstoragewriter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+type uploaded struct {
+	method string
+	path   string
+	query  string
+	header http.Header
+	body   []byte
+}
+
+type storageServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	requests []*uploaded
+}
+
+func newStorageServer() *storageServer {
+	s := &storageServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.lock.Lock()
+		s.requests = append(s.requests, &uploaded{r.Method, r.URL.Path, r.URL.RawQuery, r.Header, body})
+		s.lock.Unlock()
+	}))
+	return s
+}
+
+func (s *storageServer) uploaded() []*uploaded {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]*uploaded(nil), s.requests...)
+}
+
+func newWriter(t *testing.T, yamlConfig string) *ObjectStorageWriter {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "pipeline-archive", rawSpec)
+	assert.NoError(t, err)
+	w := kind.CreateInstance(spec).(*ObjectStorageWriter)
+	w.Init()
+	return w
+}
+
+func newContext(body string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/events?id=1", strings.NewReader(body))
+	stdr.Header.Set("User-Agent", "test")
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	s3 := &S3Spec{Region: "us-east-1", Bucket: "logs", AccessKeyID: "id", SecretAccessKey: "secret"}
+	spec := &Spec{S3: s3}
+	assert.NoError(spec.Validate())
+
+	spec.GCS = &GCSSpec{Bucket: "logs"}
+	assert.Error(spec.Validate())
+	spec.GCS = nil
+
+	spec.Source = sourceData
+	assert.Error(spec.Validate())
+	spec.DataKey = "captured"
+	assert.NoError(spec.Validate())
+	assert.Len(spec.DataInputs(), 1)
+
+	spec.Key = "${vars.date"
+	assert.Error(spec.Validate())
+	spec.Key = ""
+	spec.MaxBatchAge = "0s"
+	assert.Error(spec.Validate())
+}
+
+func TestS3(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newStorageServer()
+	defer server.Close()
+
+	w := newWriter(t, `
+name: archiver
+kind: ObjectStorageWriter
+compression: gzip
+maxBatchSize: 16
+s3:
+  endpoint: `+server.URL+`
+  region: us-east-1
+  bucket: logs
+  accessKeyId: id
+  secretAccessKey: secret
+`)
+	assert.Equal("archiver", w.Name())
+	assert.Equal(kind, w.Kind())
+	request, response := w.NeedPayload()
+	assert.True(request)
+	assert.False(response)
+
+	for _, body := range []string{"event-0", "event-1\n", "event-2", ""} {
+		assert.Equal("", w.Handle(newContext(body)))
+	}
+	w.Drain()
+	w.Close()
+
+	requests := server.uploaded()
+	assert.Len(requests, 2)
+	var records []string
+	for _, r := range requests {
+		assert.Equal(http.MethodPut, r.method)
+		assert.True(strings.HasPrefix(r.path, "/logs/pipeline-archive/archiver/"), r.path)
+		assert.True(strings.HasSuffix(r.path, ".gz"))
+		assert.Equal("application/gzip", r.header.Get("Content-Type"))
+		assert.Contains(r.header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=id/")
+
+		zr, err := gzip.NewReader(bytes.NewReader(r.body))
+		assert.NoError(err)
+		data, _ := io.ReadAll(zr)
+		records = append(records, string(data))
+	}
+	assert.Equal([]string{"event-0\nevent-1\n", "event-2\n"}, records)
+
+	status := w.Status().(*Status)
+	assert.Equal(uint64(3), status.Records)
+	assert.Equal(uint64(2), status.Batches)
+	assert.Zero(status.Dropped)
+	assert.NotEmpty(status.LastKey)
+}
+
+func TestGCS(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newStorageServer()
+	defer server.Close()
+
+	w := newWriter(t, `
+name: archiver
+kind: ObjectStorageWriter
+source: accessLog
+key: access/${vars.date}/${vars.hour}-${vars.uuid}.jsonl
+contentType: application/x-ndjson
+maxBatchAge: 10ms
+gcs:
+  endpoint: `+server.URL+`
+  bucket: logs
+`)
+	w.uploader.(*gcsUploader).source = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	defer w.Close()
+
+	ctx := newContext("hello")
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusCreated)
+	ctx.SetOutputResponse(resp)
+	w.Handle(ctx)
+
+	assert.Eventually(func() bool {
+		return len(server.uploaded()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	r := server.uploaded()[0]
+	assert.Equal(http.MethodPost, r.method)
+	assert.Equal("/upload/storage/v1/b/logs/o", r.path)
+	assert.Contains(r.query, "name=access%2F"+url.QueryEscape(time.Now().UTC().Format("2006/01/02")))
+	assert.Equal("Bearer token", r.header.Get("Authorization"))
+	assert.Equal("application/x-ndjson", r.header.Get("Content-Type"))
+
+	rec := &accessLogRecord{}
+	assert.NoError(codectool.UnmarshalJSON(bytes.TrimSpace(r.body), rec))
+	assert.Equal(http.MethodPost, rec.Method)
+	assert.Equal("/events?id=1", rec.URI)
+	assert.Equal("test", rec.UserAgent)
+	assert.Equal(http.StatusCreated, rec.StatusCode)
+	assert.Equal(int64(5), rec.RequestSize)
+}
+
+func TestUploadFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	w := newWriter(t, `
+name: archiver
+kind: ObjectStorageWriter
+s3:
+  endpoint: `+server.URL+`
+  region: us-east-1
+  bucket: logs
+  accessKeyId: id
+  secretAccessKey: secret
+`)
+	retryBackoff = time.Millisecond
+	w.Handle(newContext("event-0"))
+	w.Handle(newContext("event-1"))
+
+	b := w.batch
+	w.batch = nil
+	w.upload(b)
+
+	status := w.Status().(*Status)
+	assert.Equal(uint64(1), status.Failed)
+	assert.Equal(uint64(2), status.Dropped)
+	assert.Contains(status.LastError, "status code 403")
+	w.Close()
+
+	// the payloads are dropped after the filter is closed.
+	w.Handle(newContext("event-2"))
+	assert.Equal(uint64(3), w.Status().(*Status).Dropped)
+}
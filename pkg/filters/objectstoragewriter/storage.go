@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package objectstoragewriter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"github.com/megaease/easegress/v2/pkg/util/s3"
+)
+
+const (
+	defaultGCSEndpoint = "https://storage.googleapis.com"
+	gcsScope           = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+type (
+	// S3Spec describes an S3 compatible storage. The virtual hosted style
+	// URL of AWS is used if the endpoint is empty, otherwise, the path
+	// style URL of the endpoint is used.
+	S3Spec struct {
+		Endpoint        string `json:"endpoint,omitempty" jsonschema:"format=uri"`
+		Region          string `json:"region" jsonschema:"required"`
+		Bucket          string `json:"bucket" jsonschema:"required"`
+		AccessKeyID     string `json:"accessKeyId" jsonschema:"required"`
+		SecretAccessKey string `json:"secretAccessKey" jsonschema:"required"`
+	}
+
+	// GCSSpec describes a bucket of Google Cloud Storage.
+	GCSSpec struct {
+		Bucket string `json:"bucket" jsonschema:"required"`
+		// CredentialsFile is the path of the credentials file, like the
+		// key file of a service account, the application default
+		// credentials are used if it is empty.
+		CredentialsFile string `json:"credentialsFile,omitempty"`
+		// Endpoint overrides the endpoint of Cloud Storage.
+		Endpoint string `json:"endpoint,omitempty" jsonschema:"format=uri"`
+	}
+
+	// uploader uploads an object to the storage.
+	uploader interface {
+		upload(key, contentType string, data []byte) error
+	}
+
+	s3Uploader struct {
+		uploader *s3.Uploader
+	}
+
+	gcsUploader struct {
+		spec     *GCSSpec
+		timeout  time.Duration
+		endpoint string
+
+		// source is the source of the access tokens, it is created from
+		// the credentials at the first upload if it is nil.
+		source oauth2.TokenSource
+		client *http.Client
+	}
+)
+
+func newS3Uploader(spec *S3Spec, timeout time.Duration) *s3Uploader {
+	return &s3Uploader{
+		uploader: s3.NewUploader(&s3.Options{
+			Endpoint:        spec.Endpoint,
+			Region:          spec.Region,
+			Bucket:          spec.Bucket,
+			AccessKeyID:     spec.AccessKeyID,
+			SecretAccessKey: spec.SecretAccessKey,
+			Timeout:         timeout,
+		}),
+	}
+}
+
+func (u *s3Uploader) upload(key, contentType string, data []byte) error {
+	return u.uploader.Upload(key, contentType, data)
+}
+
+func newGCSUploader(spec *GCSSpec, timeout time.Duration) *gcsUploader {
+	u := &gcsUploader{
+		spec:     spec,
+		timeout:  timeout,
+		endpoint: strings.TrimSuffix(spec.Endpoint, "/"),
+	}
+	if u.endpoint == "" {
+		u.endpoint = defaultGCSEndpoint
+	}
+	return u
+}
+
+func (u *gcsUploader) tokenSource() (oauth2.TokenSource, error) {
+	ctx := context.Background()
+	if u.spec.CredentialsFile == "" {
+		return google.DefaultTokenSource(ctx, gcsScope)
+	}
+
+	data, err := os.ReadFile(u.spec.CredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read credentials file failed: %v", err)
+	}
+	creds, err := google.CredentialsFromJSON(ctx, data, gcsScope)
+	if err != nil {
+		return nil, fmt.Errorf("parse credentials file failed: %v", err)
+	}
+	return creds.TokenSource, nil
+}
+
+func (u *gcsUploader) httpClient() (*http.Client, error) {
+	if u.client != nil {
+		return u.client, nil
+	}
+
+	if u.source == nil {
+		source, err := u.tokenSource()
+		if err != nil {
+			return nil, err
+		}
+		u.source = source
+	}
+	u.client = &http.Client{
+		Transport: &oauth2.Transport{Source: u.source, Base: http.DefaultTransport},
+		Timeout:   u.timeout,
+	}
+	return u.client, nil
+}
+
+// upload uploads the object with the simple upload of the JSON API.
+func (u *gcsUploader) upload(key, contentType string, data []byte) error {
+	client, err := u.httpClient()
+	if err != nil {
+		return err
+	}
+
+	target := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s",
+		u.endpoint, url.PathEscape(u.spec.Bucket), url.QueryEscape(key))
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return doRequest(client, req)
+}
+
+func doRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -36,12 +36,18 @@ import (
 	"github.com/megaease/easegress/v2/pkg/filters"
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/session"
 )
 
 // https://openid.net/specs/openid-connect-core-1_0.html
 const (
 	kindName       = "OIDCAdaptor"
 	resultFiltered = "oidcFiltered"
+
+	// keys of the session values
+	accessTokenKey = "accessToken"
+	idTokenKey     = "idToken"
+	userInfoKey    = "userInfo"
 )
 
 var httpCli = &http.Client{
@@ -82,6 +88,7 @@ type OIDCAdaptor struct {
 	redirectPath string
 	oidcConfig   *oidcConfig
 	jwks         *keyfunc.JWKS
+	sessions     *session.Manager
 }
 
 // Spec defines the spec of OIDCAdaptor.
@@ -101,6 +108,12 @@ type Spec struct {
 	UserInfoEndpoint      string `json:"userinfoEndpoint"`
 
 	RedirectURI string `json:"redirectURI" jsonschema:"required"`
+
+	// Session enables the server side sessions, the tokens and the user
+	// info are kept in the session after the authorization, and the
+	// requests with a valid session are allowed. CookieName is ignored
+	// if it is specified.
+	Session *session.Spec `json:"session,omitempty"`
 }
 
 type oidcConfig struct {
@@ -150,8 +163,24 @@ func (o *OIDCAdaptor) Kind() *filters.Kind {
 
 // Init initializes the filter.
 func (o *OIDCAdaptor) Init() {
+	o.reload(nil)
+}
+
+// Inherit inherits previous generation of the filter instance.
+func (o *OIDCAdaptor) Inherit(previousGeneration filters.Filter) {
+	o.reload(previousGeneration.(*OIDCAdaptor))
+}
+
+func (o *OIDCAdaptor) reload(previousGeneration *OIDCAdaptor) {
 	// delegate store interface operation to itself for testing
 	o.store = o
+	if o.spec.Session != nil {
+		var prev *session.Manager
+		if previousGeneration != nil {
+			prev = previousGeneration.sessions
+		}
+		o.sessions = session.Inherit(o.spec.Session, prev)
+	}
 	if len(o.spec.Discovery) > 0 {
 		o.initDiscoveryOIDCConf()
 	} else {
@@ -171,12 +200,6 @@ func (o *OIDCAdaptor) Init() {
 	o.redirectPath = parsed.Path
 }
 
-// Inherit inherits previous generation of the filter instance.
-func (o *OIDCAdaptor) Inherit(previousGeneration filters.Filter) {
-	o.Init()
-	previousGeneration.Close()
-}
-
 // Handle handles the request.
 func (o *OIDCAdaptor) Handle(ctx *context.Context) (result string) {
 	req := ctx.GetInputRequest().(*httpprot.Request)
@@ -187,7 +210,12 @@ func (o *OIDCAdaptor) Handle(ctx *context.Context) (result string) {
 	}
 	spec := o.spec
 
-	if len(spec.CookieName) != 0 {
+	if o.sessions != nil {
+		if s := o.sessions.Get(req.Std()); s != nil {
+			o.setSessionHeaders(req, s)
+			return ""
+		}
+	} else if len(spec.CookieName) != 0 {
 		if _, e := req.Cookie(spec.CookieName); e == nil {
 			return ""
 		}
@@ -212,8 +240,63 @@ func (o *OIDCAdaptor) Status() interface{} {
 	return nil
 }
 
+// SessionManager returns the manager of the server side sessions, it is nil
+// if the server side sessions are not enabled.
+func (o *OIDCAdaptor) SessionManager() *session.Manager {
+	return o.sessions
+}
+
 // Close closes the filter instance.
 func (o *OIDCAdaptor) Close() {
+	if o.sessions != nil {
+		o.sessions.Close()
+	}
+}
+
+// setSessionHeaders sets the tokens and the user info kept in the session
+// to the request headers.
+func (o *OIDCAdaptor) setSessionHeaders(req *httpprot.Request, s *session.Session) {
+	h := req.HTTPHeader()
+	if v := s.Values[accessTokenKey]; o.setAccessTokenHeader && v != "" {
+		h.Set("X-Access-Token", v)
+	}
+	if v := s.Values[idTokenKey]; o.setIDTokenHeader && v != "" {
+		h.Set("X-ID-Token", v)
+	}
+	if v := s.Values[userInfoKey]; o.setUserInfoHeader && v != "" {
+		h.Set("X-User-Info", v)
+	}
+}
+
+// createSession creates the session after the authorization, and redirects
+// the user agent to the original request URL with the session cookie.
+func (o *OIDCAdaptor) createSession(rw *httpprot.Response, reqURL string, token *oidcIDToken, userInfo map[string]any) string {
+	jsonBytes, err := json.Marshal(userInfo)
+	if err != nil {
+		logger.Errorf("marshal oidc userinfo to json error: %s", err)
+	}
+	values := map[string]string{
+		accessTokenKey: token.AccessToken,
+		idTokenKey:     token.IDToken,
+		userInfoKey:    base64.StdEncoding.EncodeToString(jsonBytes),
+	}
+
+	subject := ""
+	if sub, ok := userInfo["sub"]; ok {
+		subject = fmt.Sprint(sub)
+	}
+	s, err := o.sessions.Create(subject, values)
+	if err != nil {
+		return errorResp(rw, "create session error: "+err.Error())
+	}
+
+	if reqURL == "" {
+		reqURL = "/"
+	}
+	rw.SetStatusCode(http.StatusFound)
+	rw.Header().Set("Location", reqURL)
+	rw.SetCookie(o.sessions.Cookie(s))
+	return resultFiltered
 }
 
 func (o *OIDCAdaptor) initDiscoveryOIDCConf() {
@@ -283,6 +366,9 @@ func (o *OIDCAdaptor) handleOIDCCallback(ctx *context.Context) string {
 			return errorResp(rw, "fetch OAuth2 userinfo error: "+err.Error())
 		}
 	}
+	if o.sessions != nil {
+		return o.createSession(rw, reqURL, oidcToken, userInfo)
+	}
 	if o.setUserInfoHeader {
 		jsonBytes, err := json.Marshal(userInfo)
 		if err != nil {
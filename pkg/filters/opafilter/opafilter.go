@@ -141,6 +141,12 @@ func (o *OPAFilter) Handle(ctx *context.Context) (result string) {
 	return o.evalRequest(req, rw)
 }
 
+// NeedPayload returns whether the request payload is needed by the
+// policy, it implements context.PayloadNeeder.
+func (o *OPAFilter) NeedPayload() (request, response bool) {
+	return o.spec.ReadBody, false
+}
+
 // Status returns the status of the filter instance.
 func (o *OPAFilter) Status() interface{} {
 	return nil
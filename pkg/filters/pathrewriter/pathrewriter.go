@@ -0,0 +1,262 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package pathrewriter implements a filter to rewrite or redirect the
+// request path.
+package pathrewriter
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/pathadaptor"
+)
+
+const (
+	// Kind is the kind of PathRewriter.
+	Kind = "PathRewriter"
+
+	resultRedirected = "redirected"
+
+	trailingSlashAdd    = "add"
+	trailingSlashRemove = "remove"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "PathRewriter rewrites the request path, or redirects the request to the rewritten path.",
+	Results:     []string{resultRedirected},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &PathRewriter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// PathRewriter is filter PathRewriter.
+	PathRewriter struct {
+		spec  *Spec
+		rules []*rule
+	}
+
+	// Spec describes the PathRewriter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Rules are applied in order, each rule works on the result of the
+		// rules before it.
+		Rules []*Rule `json:"rules" jsonschema:"required,minItems=1"`
+	}
+
+	// Rule describes how to rewrite the path. The rule is skipped if Match
+	// is specified and the path does not match it, otherwise the path is
+	// rewritten by Replace, TrimPrefix, AddPrefix and TrailingSlash in turn.
+	Rule struct {
+		Match string `json:"match,omitempty" jsonschema:"format=regexp"`
+		// Replace is the replacement of the text matching Match, capture
+		// groups can be referenced like $1 or ${name}.
+		Replace       string `json:"replace,omitempty"`
+		TrimPrefix    string `json:"trimPrefix,omitempty" jsonschema:"pattern=^/"`
+		AddPrefix     string `json:"addPrefix,omitempty" jsonschema:"pattern=^/"`
+		TrailingSlash string `json:"trailingSlash,omitempty" jsonschema:"enum=,enum=add,enum=remove"`
+		// RedirectCode redirects the client to the rewritten path with the
+		// status code instead of rewriting the request, the rules after it
+		// are not applied.
+		RedirectCode int `json:"redirectCode,omitempty" jsonschema:"enum=0,enum=301,enum=302,enum=307,enum=308"`
+	}
+
+	rule struct {
+		spec *Rule
+		re   *regexp.Regexp
+		// adaptors replace, trim and add the prefix of the path in turn.
+		adaptors []*pathadaptor.PathAdaptor
+	}
+)
+
+var _ filters.Filter = (*PathRewriter)(nil)
+
+// Validate validates the spec.
+func (s *Spec) Validate() error {
+	for i, r := range s.Rules {
+		if r.Match != "" {
+			if _, err := regexp.Compile(r.Match); err != nil {
+				return fmt.Errorf("rule %d: invalid match %q: %v", i, r.Match, err)
+			}
+		} else if r.Replace != "" {
+			return fmt.Errorf("rule %d: replace is specified without match", i)
+		}
+
+		switch r.TrailingSlash {
+		case "", trailingSlashAdd, trailingSlashRemove:
+		default:
+			return fmt.Errorf("rule %d: invalid trailingSlash %q", i, r.TrailingSlash)
+		}
+
+		switch r.RedirectCode {
+		case 0, http.StatusMovedPermanently, http.StatusFound,
+			http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return fmt.Errorf("rule %d: invalid redirectCode %d", i, r.RedirectCode)
+		}
+	}
+	return nil
+}
+
+func newRule(spec *Rule) *rule {
+	r := &rule{spec: spec}
+	if spec.Match != "" {
+		r.re = regexp.MustCompile(spec.Match)
+	}
+
+	if spec.Replace != "" {
+		r.adaptors = append(r.adaptors, pathadaptor.New(&pathadaptor.Spec{
+			RegexpReplace: &pathadaptor.RegexpReplace{Regexp: spec.Match, Replace: spec.Replace},
+		}))
+	}
+	if spec.TrimPrefix != "" {
+		r.adaptors = append(r.adaptors, pathadaptor.New(&pathadaptor.Spec{TrimPrefix: spec.TrimPrefix}))
+	}
+	if spec.AddPrefix != "" {
+		r.adaptors = append(r.adaptors, pathadaptor.New(&pathadaptor.Spec{AddPrefix: spec.AddPrefix}))
+	}
+	return r
+}
+
+// rewrite returns the rewritten path and whether the rule is applied.
+func (r *rule) rewrite(path string) (string, bool) {
+	if r.re != nil && !r.re.MatchString(path) {
+		return path, false
+	}
+
+	for _, pa := range r.adaptors {
+		path = pa.Adapt(path)
+	}
+
+	switch r.spec.TrailingSlash {
+	case trailingSlashAdd:
+		if !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+	case trailingSlashRemove:
+		path = strings.TrimRight(path, "/")
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path, true
+}
+
+// Name returns the name of the PathRewriter filter instance.
+func (pr *PathRewriter) Name() string {
+	return pr.spec.Name()
+}
+
+// Kind returns the kind of PathRewriter.
+func (pr *PathRewriter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the PathRewriter.
+func (pr *PathRewriter) Spec() filters.Spec {
+	return pr.spec
+}
+
+// Init initializes PathRewriter.
+func (pr *PathRewriter) Init() {
+	pr.reload()
+}
+
+// Inherit inherits previous generation of PathRewriter.
+func (pr *PathRewriter) Inherit(previousGeneration filters.Filter) {
+	pr.Init()
+}
+
+func (pr *PathRewriter) reload() {
+	pr.rules = make([]*rule, len(pr.spec.Rules))
+	for i, spec := range pr.spec.Rules {
+		pr.rules[i] = newRule(spec)
+	}
+}
+
+// Handle rewrites the path of the request.
+func (pr *PathRewriter) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	path := req.Path()
+	for _, r := range pr.rules {
+		newPath, ok := r.rewrite(path)
+		if !ok {
+			continue
+		}
+
+		// do not redirect the client to the same path, which results in
+		// a redirect loop.
+		if r.spec.RedirectCode != 0 && newPath != req.Path() {
+			pr.redirect(ctx, req, newPath, r.spec.RedirectCode)
+			return resultRedirected
+		}
+		path = newPath
+	}
+
+	if path != req.Path() {
+		req.SetPath(path)
+		req.URL().RawPath = ""
+	}
+	return ""
+}
+
+func (pr *PathRewriter) redirect(ctx *context.Context, req *httpprot.Request, path string, code int) {
+	u := *req.URL()
+	u.Path, u.RawPath = path, ""
+	location := u.EscapedPath()
+	if u.RawQuery != "" {
+		location += "?" + u.RawQuery
+	}
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	resp.Header().Set("Location", location)
+	resp.SetPayload([]byte(http.StatusText(code)))
+	ctx.SetOutputResponse(resp)
+}
+
+// NeedPayload returns false for both payloads, only the path is rewritten,
+// it implements context.PayloadNeeder.
+func (pr *PathRewriter) NeedPayload() (request, response bool) {
+	return false, false
+}
+
+// Status returns status.
+func (pr *PathRewriter) Status() interface{} {
+	return nil
+}
+
+// Close closes PathRewriter.
+func (pr *PathRewriter) Close() {
+}
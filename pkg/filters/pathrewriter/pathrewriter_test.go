@@ -0,0 +1,167 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pathrewriter
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func createPathRewriter(t *testing.T, yamlConfig string) *PathRewriter {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+	pr := kind.CreateInstance(spec).(*PathRewriter)
+	pr.Init()
+	return pr
+}
+
+func handle(pr *PathRewriter, url string) (*context.Context, *httpprot.Request, string) {
+	stdr, _ := http.NewRequest(http.MethodGet, url, nil)
+	req, _ := httpprot.NewRequest(stdr)
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx, req, pr.Handle(ctx)
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, yamlConfig := range []string{
+		`
+kind: PathRewriter
+name: pr
+rules:
+- replace: /abc
+`, `
+kind: PathRewriter
+name: pr
+rules:
+- match: "[a"
+`, `
+kind: PathRewriter
+name: pr
+rules:
+- trailingSlash: keep
+`, `
+kind: PathRewriter
+name: pr
+rules:
+- addPrefix: /v1
+  redirectCode: 303
+`,
+	} {
+		rawSpec := make(map[string]interface{})
+		codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+		_, err := filters.NewSpec(nil, "", rawSpec)
+		assert.Error(err, yamlConfig)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	assert := assert.New(t)
+
+	pr := createPathRewriter(t, `
+kind: PathRewriter
+name: pr
+rules:
+- trimPrefix: /api
+  addPrefix: /v2
+- match: ^/v2/users/(?P<id>\d+)/profile$
+  replace: /v2/profiles/${id}
+- trailingSlash: remove
+`)
+	assert.Equal("pr", pr.Name())
+	assert.Equal(kind, pr.Kind())
+	assert.Nil(pr.Status())
+
+	cases := []struct {
+		url  string
+		path string
+	}{
+		{url: "http://a.com/api/orders/", path: "/v2/orders"},
+		{url: "http://a.com/api/users/12/profile", path: "/v2/profiles/12"},
+		{url: "http://a.com/other", path: "/v2/other"},
+		{url: "http://a.com/api/", path: "/v2"},
+	}
+	for _, c := range cases {
+		ctx, req, result := handle(pr, c.url)
+		assert.Equal("", result, c.url)
+		assert.Equal(c.path, req.Path(), c.url)
+		assert.Nil(ctx.GetOutputResponse(), c.url)
+	}
+
+	pr2 := kind.CreateInstance(pr.spec).(*PathRewriter)
+	pr2.Inherit(pr)
+	_, req, _ := handle(pr2, "http://a.com/")
+	assert.Equal("/v2", req.Path())
+	pr2.Close()
+}
+
+func TestRedirect(t *testing.T) {
+	assert := assert.New(t)
+
+	pr := createPathRewriter(t, `
+kind: PathRewriter
+name: pr
+rules:
+- match: ^/docs(/.*)?$
+  trailingSlash: add
+  redirectCode: 308
+- match: ^/old/(.*)$
+  replace: /new/$1
+  redirectCode: 301
+- trimPrefix: /new
+`)
+
+	cases := []struct {
+		url      string
+		result   string
+		code     int
+		location string
+		path     string
+	}{
+		{url: "http://a.com/docs?lang=en", result: resultRedirected, code: 308, location: "/docs/?lang=en"},
+		{url: "http://a.com/docs/", path: "/docs/"},
+		{url: "http://a.com/old/a%20b", result: resultRedirected, code: 301, location: "/new/a%20b"},
+		{url: "http://a.com/new/page", path: "/page"},
+	}
+	for _, c := range cases {
+		ctx, req, result := handle(pr, c.url)
+		assert.Equal(c.result, result, c.url)
+		if c.result == "" {
+			assert.Equal(c.path, req.Path(), c.url)
+			continue
+		}
+		resp := ctx.GetOutputResponse().(*httpprot.Response)
+		assert.Equal(c.code, resp.StatusCode(), c.url)
+		assert.Equal(c.location, resp.Header().Get("Location"), c.url)
+	}
+}
@@ -0,0 +1,320 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package protobufvalidator implements a filter to validate protobuf
+// request bodies.
+package protobufvalidator
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	// Kind is the kind of ProtobufValidator.
+	Kind = "ProtobufValidator"
+
+	resultInvalid = "invalid"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ProtobufValidator validates protobuf request bodies against message descriptors.",
+	Results:     []string{resultInvalid},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ProtobufValidator{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ProtobufValidator is filter ProtobufValidator.
+	ProtobufValidator struct {
+		spec *Spec
+
+		defaultMessage protoreflect.MessageDescriptor
+		rules          []*rule
+	}
+
+	// Spec describes the ProtobufValidator.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// DescriptorSetBase64 is a base64 encoded FileDescriptorSet, which
+		// could be generated by 'protoc --include_imports --descriptor_set_out'.
+		DescriptorSetBase64 string `json:"descriptorSetBase64" jsonschema:"required,format=base64"`
+		// MessageType is the full name of the message type used when no
+		// rule matches the request.
+		MessageType         string  `json:"messageType,omitempty"`
+		Rules               []*Rule `json:"rules,omitempty"`
+		RejectUnknownFields bool    `json:"rejectUnknownFields,omitempty"`
+		// RenderJSON replaces the request body with its JSON representation
+		// after validation, so that filters after this one can process the
+		// body as JSON.
+		RenderJSON bool `json:"renderJSON,omitempty"`
+	}
+
+	// Rule specifies the message type of requests matching the path.
+	Rule struct {
+		Path        string `json:"path,omitempty" jsonschema:"pattern=^/"`
+		PathPrefix  string `json:"pathPrefix,omitempty" jsonschema:"pattern=^/"`
+		MessageType string `json:"messageType" jsonschema:"required"`
+	}
+
+	rule struct {
+		spec    *Rule
+		message protoreflect.MessageDescriptor
+	}
+)
+
+var _ filters.Filter = (*ProtobufValidator)(nil)
+
+func (r *Rule) match(path string) bool {
+	if r.Path != "" {
+		return r.Path == path
+	}
+	if r.PathPrefix != "" {
+		return strings.HasPrefix(path, r.PathPrefix)
+	}
+	return true
+}
+
+func (s *Spec) loadFiles() (*protoregistry.Files, error) {
+	data, err := base64.StdEncoding.DecodeString(s.DescriptorSetBase64)
+	if err != nil {
+		return nil, fmt.Errorf("decode descriptor set: %v", err)
+	}
+
+	fds := &descriptorpb.FileDescriptorSet{}
+	if err = proto.Unmarshal(data, fds); err != nil {
+		return nil, fmt.Errorf("unmarshal descriptor set: %v", err)
+	}
+
+	files, err := protodesc.NewFiles(fds)
+	if err != nil {
+		return nil, fmt.Errorf("build descriptors: %v", err)
+	}
+
+	return files, nil
+}
+
+func findMessage(files *protoregistry.Files, name string) (protoreflect.MessageDescriptor, error) {
+	d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("message type %s: %v", name, err)
+	}
+
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message type", name)
+	}
+	return md, nil
+}
+
+// Validate validates the spec.
+func (s *Spec) Validate() error {
+	if s.MessageType == "" && len(s.Rules) == 0 {
+		return fmt.Errorf("neither messageType nor rules is specified")
+	}
+
+	files, err := s.loadFiles()
+	if err != nil {
+		return err
+	}
+
+	if s.MessageType != "" {
+		if _, err = findMessage(files, s.MessageType); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range s.Rules {
+		if r.Path != "" && r.PathPrefix != "" {
+			return fmt.Errorf("path and pathPrefix are mutually exclusive")
+		}
+		if _, err = findMessage(files, r.MessageType); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Name returns the name of the ProtobufValidator filter instance.
+func (v *ProtobufValidator) Name() string {
+	return v.spec.Name()
+}
+
+// Kind returns the kind of ProtobufValidator.
+func (v *ProtobufValidator) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ProtobufValidator
+func (v *ProtobufValidator) Spec() filters.Spec {
+	return v.spec
+}
+
+// Init initializes ProtobufValidator.
+func (v *ProtobufValidator) Init() {
+	v.reload()
+}
+
+// Inherit inherits previous generation of ProtobufValidator.
+func (v *ProtobufValidator) Inherit(previousGeneration filters.Filter) {
+	v.Init()
+}
+
+func (v *ProtobufValidator) reload() {
+	// the spec is validated, so the errors are impossible.
+	files, _ := v.spec.loadFiles()
+
+	if v.spec.MessageType != "" {
+		v.defaultMessage, _ = findMessage(files, v.spec.MessageType)
+	}
+
+	v.rules = nil
+	for _, r := range v.spec.Rules {
+		md, _ := findMessage(files, r.MessageType)
+		v.rules = append(v.rules, &rule{spec: r, message: md})
+	}
+}
+
+func (v *ProtobufValidator) messageOf(path string) protoreflect.MessageDescriptor {
+	for _, r := range v.rules {
+		if r.spec.match(path) {
+			return r.message
+		}
+	}
+	return v.defaultMessage
+}
+
+// hasUnknownFields reports whether m or any of its sub messages contains
+// unknown fields.
+func hasUnknownFields(m protoreflect.Message) bool {
+	if len(m.GetUnknown()) > 0 {
+		return true
+	}
+
+	found := false
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsList() && fd.Message() != nil:
+			list := v.List()
+			for i := 0; i < list.Len() && !found; i++ {
+				found = hasUnknownFields(list.Get(i).Message())
+			}
+		case fd.IsMap() && fd.MapValue().Message() != nil:
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				found = hasUnknownFields(mv.Message())
+				return !found
+			})
+		case !fd.IsList() && !fd.IsMap() && fd.Message() != nil:
+			found = hasUnknownFields(v.Message())
+		}
+		return !found
+	})
+
+	return found
+}
+
+func (v *ProtobufValidator) validate(req *httpprot.Request) error {
+	md := v.messageOf(req.Path())
+	if md == nil {
+		return nil
+	}
+
+	if req.IsStream() {
+		return fmt.Errorf("stream body is not supported")
+	}
+
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(req.RawPayload(), msg); err != nil {
+		return fmt.Errorf("unmarshal %s: %v", md.FullName(), err)
+	}
+
+	if v.spec.RejectUnknownFields && hasUnknownFields(msg) {
+		return fmt.Errorf("%s contains unknown fields", md.FullName())
+	}
+
+	if !v.spec.RenderJSON {
+		return nil
+	}
+
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("render %s to JSON: %v", md.FullName(), err)
+	}
+	req.SetPayload(data)
+	req.Std().Header.Set("Content-Type", "application/json")
+
+	return nil
+}
+
+// Handle validates the request body in the context.
+func (v *ProtobufValidator) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	if err := v.validate(req); err != nil {
+		resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+		if resp == nil {
+			resp, _ = httpprot.NewResponse(nil)
+		}
+
+		resp.SetStatusCode(http.StatusBadRequest)
+		ctx.SetOutputResponse(resp)
+		ctx.AddTag(stringtool.Cat("protobuf validator: ", err.Error()))
+		return resultInvalid
+	}
+
+	return ""
+}
+
+// NeedPayload returns true for the request payload, which is unmarshaled
+// to validate the request, it implements context.PayloadNeeder.
+func (v *ProtobufValidator) NeedPayload() (request, response bool) {
+	return true, false
+}
+
+// Status returns status.
+func (v *ProtobufValidator) Status() interface{} {
+	return nil
+}
+
+// Close closes ProtobufValidator.
+func (v *ProtobufValidator) Close() {
+}
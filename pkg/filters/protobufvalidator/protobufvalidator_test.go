@@ -0,0 +1,228 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package protobufvalidator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+var demoFile = &descriptorpb.FileDescriptorProto{
+	Name:    proto.String("demo.proto"),
+	Package: proto.String("demo"),
+	Syntax:  proto.String("proto3"),
+	MessageType: []*descriptorpb.DescriptorProto{
+		{
+			Name: proto.String("User"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("name"),
+					JsonName: proto.String("name"),
+					Number:   proto.Int32(1),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				},
+				{
+					Name:     proto.String("addresses"),
+					JsonName: proto.String("addresses"),
+					Number:   proto.Int32(2),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+					TypeName: proto.String(".demo.Address"),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+				},
+			},
+		},
+		{
+			Name: proto.String("Address"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("city"),
+					JsonName: proto.String("city"),
+					Number:   proto.Int32(1),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				},
+			},
+		},
+	},
+}
+
+func descriptorSetBase64(t *testing.T) string {
+	fds := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{
+			demoFile,
+			protodesc.ToFileDescriptorProto(wrapperspb.File_google_protobuf_wrappers_proto),
+		},
+	}
+	data, err := proto.Marshal(fds)
+	assert.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func newUser(t *testing.T, name, city string) []byte {
+	fd, err := protodesc.NewFile(demoFile, nil)
+	assert.NoError(t, err)
+
+	userType := fd.Messages().ByName("User")
+	addrType := fd.Messages().ByName("Address")
+
+	user := dynamicpb.NewMessage(userType)
+	user.Set(userType.Fields().ByName("name"), protoreflect.ValueOfString(name))
+
+	addr := dynamicpb.NewMessage(addrType)
+	addr.Set(addrType.Fields().ByName("city"), protoreflect.ValueOfString(city))
+	list := user.Mutable(userType.Fields().ByName("addresses")).List()
+	list.Append(protoreflect.ValueOfMessage(addr))
+
+	data, err := proto.Marshal(user)
+	assert.NoError(t, err)
+	return data
+}
+
+func createValidator(t *testing.T, spec *Spec) *ProtobufValidator {
+	spec.BaseSpec.MetaSpec.Kind = Kind
+	spec.BaseSpec.MetaSpec.Name = "protobuf-validator"
+	s, err := filters.NewSpec(nil, "pipeline-demo", spec)
+	assert.NoError(t, err)
+
+	v := kind.CreateInstance(s).(*ProtobufValidator)
+	v.Init()
+	return v
+}
+
+func newContext(t *testing.T, path string, body []byte) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1"+path, bytes.NewReader(body))
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	assert.NoError(t, req.FetchPayload(0))
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestProtobufValidator(t *testing.T) {
+	assert := assert.New(t)
+
+	v := createValidator(t, &Spec{
+		DescriptorSetBase64: descriptorSetBase64(t),
+		MessageType:         "demo.User",
+		Rules: []*Rule{
+			{PathPrefix: "/names/", MessageType: "google.protobuf.StringValue"},
+		},
+		RejectUnknownFields: true,
+	})
+	assert.Equal("protobuf-validator", v.Name())
+	assert.Equal(kind, v.Kind())
+	assert.Nil(v.Status())
+
+	user := newUser(t, "megaease", "Beijing")
+	ctx := newContext(t, "/users", user)
+	assert.Equal("", v.Handle(ctx))
+	assert.Equal(user, ctx.GetInputRequest().RawPayload())
+
+	ctx = newContext(t, "/users", []byte{0xff, 0xff, 0xff})
+	assert.Equal(resultInvalid, v.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// unknown field in the nested message
+	fd, err := protodesc.NewFile(demoFile, nil)
+	assert.NoError(err)
+	addrType := fd.Messages().ByName("Address")
+	addr := dynamicpb.NewMessage(addrType)
+	addr.SetUnknown(protowire.AppendVarint(protowire.AppendTag(nil, 99, protowire.VarintType), 1))
+	userType := fd.Messages().ByName("User")
+	u := dynamicpb.NewMessage(userType)
+	u.Mutable(userType.Fields().ByName("addresses")).List().Append(protoreflect.ValueOfMessage(addr))
+	data, err := proto.Marshal(u)
+	assert.NoError(err)
+	ctx = newContext(t, "/users", data)
+	assert.Equal(resultInvalid, v.Handle(ctx))
+
+	name, err := proto.Marshal(wrapperspb.String("easegress"))
+	assert.NoError(err)
+	ctx = newContext(t, "/names/1", name)
+	assert.Equal("", v.Handle(ctx))
+
+	v.Inherit(v)
+	v.Close()
+}
+
+func TestRenderJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	v := createValidator(t, &Spec{
+		DescriptorSetBase64: descriptorSetBase64(t),
+		Rules: []*Rule{
+			{Path: "/users", MessageType: "demo.User"},
+		},
+		RenderJSON: true,
+	})
+
+	ctx := newContext(t, "/users", newUser(t, "megaease", "Beijing"))
+	assert.Equal("", v.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.JSONEq(`{"name":"megaease","addresses":[{"city":"Beijing"}]}`, string(req.RawPayload()))
+	assert.Equal("application/json", req.HTTPHeader().Get("Content-Type"))
+
+	// no message type for the path, the body is not validated.
+	ctx = newContext(t, "/others", []byte{0xff})
+	assert.Equal("", v.Handle(ctx))
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{DescriptorSetBase64: descriptorSetBase64(t)}
+	assert.Error(spec.Validate())
+
+	spec.MessageType = "demo.Unknown"
+	assert.Error(spec.Validate())
+
+	spec.MessageType = "demo"
+	assert.Error(spec.Validate())
+
+	spec.MessageType = "demo.User"
+	assert.NoError(spec.Validate())
+
+	spec.Rules = []*Rule{{Path: "/a", PathPrefix: "/a", MessageType: "demo.User"}}
+	assert.Error(spec.Validate())
+
+	spec.Rules = nil
+	spec.DescriptorSetBase64 = base64.StdEncoding.EncodeToString([]byte{0xff})
+	assert.Error(spec.Validate())
+}
@@ -180,6 +180,15 @@ func (sp *ServerPool) CreateLoadBalancer(spec *LoadBalanceSpec, servers []*Serve
 		return newForwardLoadBalancer(spec)
 	}
 
+	// a call may be a long living stream, its latency and result do not
+	// tell whether the server is an outlier.
+	if spec.OutlierDetection != nil {
+		logger.Warnf("%s: outlier detection is not supported by GRPCProxy", sp.Name)
+		copied := *spec
+		copied.OutlierDetection = nil
+		spec = &copied
+	}
+
 	lb := proxies.NewGeneralLoadBalancer(spec, servers)
 	lb.Init(nil, nil, nil)
 	return lb
@@ -284,8 +293,20 @@ func (sp *ServerPool) doHandle(ctx stdcontext.Context, spCtx *serverPoolContext)
 		logger.Debugf("%s: no available server", sp.Name)
 		return serverPoolError{status.New(codes.InvalidArgument, "no available server"), resultClientError}
 	}
+
+	// the server is returned after the call is finished, so the load
+	// balancer sees the calls in flight and their latency.
+	err := sp.call(ctx, spCtx, svr)
+	if err == nil {
+		lb.ReturnServer(svr, spCtx.req, spCtx.resp)
+	} else {
+		lb.ReturnServer(svr, spCtx.req, nil)
+	}
+	return err
+}
+
+func (sp *ServerPool) call(ctx stdcontext.Context, spCtx *serverPoolContext, svr *Server) error {
 	target := sp.getTarget(svr.URL)
-	lb.ReturnServer(svr, spCtx.req, spCtx.resp)
 	if target == "" {
 		logger.Debugf("request %v from %v context target address %s invalid", spCtx.req.FullMethod(), spCtx.req.RealIP(), target)
 		return serverPoolError{status.New(codes.Internal, "server url invalid"), resultInternalError}
@@ -135,6 +135,15 @@ func (c *clientConnWrapper) HealthCheck() bool {
 	return c.GetState() != connectivity.Shutdown
 }
 
+// References returns the service registries used by the pools.
+func (s *Spec) References() []string {
+	var names []string
+	for _, pool := range s.Pools {
+		names = append(names, pool.ServiceRegistry)
+	}
+	return names
+}
+
 // Validate validates Spec.
 func (s *Spec) Validate() error {
 	numMainPool := 0
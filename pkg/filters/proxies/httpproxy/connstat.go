@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpproxy
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
+)
+
+type (
+	// connStat collects the statistics of the connections from a server
+	// pool to its servers.
+	connStat struct {
+		requests    atomic.Uint64
+		reused      atomic.Uint64
+		exhaustions atomic.Uint64
+		dials       atomic.Uint64
+		dialErrors  atomic.Uint64
+		dialNanos   atomic.Int64
+	}
+
+	// ConnStatus is the status of the connections from a server pool to
+	// its servers.
+	ConnStatus struct {
+		Requests uint64 `json:"requests"`
+		Reused   uint64 `json:"reused"`
+		// ReuseRate is the rate of the requests sent on reused connections.
+		ReuseRate float64 `json:"reuseRate"`
+		// Exhaustions is the count of the requests which had to wait for a
+		// connection in use, because there was no idle one and no more
+		// connection could be created.
+		Exhaustions uint64 `json:"exhaustions"`
+		Dials       uint64 `json:"dials"`
+		DialErrors  uint64 `json:"dialErrors"`
+		// DialLatency is the average latency of the dials in milliseconds.
+		DialLatency float64 `json:"dialLatency"`
+	}
+)
+
+// clientTrace returns a client trace to collect the statistics of a
+// single request.
+func (cs *connStat) clientTrace() *httptrace.ClientTrace {
+	var dialStart atomic.Int64
+
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			cs.requests.Add(1)
+			if !info.Reused {
+				return
+			}
+			cs.reused.Add(1)
+
+			// an HTTP/1 connection which is reused but was not idle is
+			// handed over from another request, the request waited for it.
+			// HTTP/2 connections are shared by concurrent requests.
+			if !info.WasIdle && !isHTTP2(info) {
+				cs.exhaustions.Add(1)
+			}
+		},
+		ConnectStart: func(network, addr string) {
+			// only the first one counts if multiple addresses are dialed.
+			dialStart.CompareAndSwap(0, fasttime.NowUnixNano())
+		},
+		ConnectDone: func(network, addr string, err error) {
+			start := dialStart.Swap(0)
+			if start == 0 {
+				return
+			}
+			if err != nil {
+				cs.dialErrors.Add(1)
+				return
+			}
+			cs.dials.Add(1)
+			cs.dialNanos.Add(fasttime.NowUnixNano() - start)
+		},
+	}
+}
+
+func isHTTP2(info httptrace.GotConnInfo) bool {
+	conn, ok := info.Conn.(*tls.Conn)
+	return ok && conn.ConnectionState().NegotiatedProtocol == "h2"
+}
+
+func (cs *connStat) status() *ConnStatus {
+	s := &ConnStatus{
+		Requests:    cs.requests.Load(),
+		Reused:      cs.reused.Load(),
+		Exhaustions: cs.exhaustions.Load(),
+		Dials:       cs.dials.Load(),
+		DialErrors:  cs.dialErrors.Load(),
+	}
+
+	if s.Requests > 0 {
+		s.ReuseRate = float64(s.Reused) / float64(s.Requests)
+	}
+	if s.Dials > 0 {
+		s.DialLatency = float64(cs.dialNanos.Load()) / float64(s.Dials) / float64(time.Millisecond)
+	}
+
+	return s
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpproxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnStat(t *testing.T) {
+	assert := assert.New(t)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	cs := &connStat{}
+	client := HTTPClient(nil, &HTTPClientSpec{
+		MaxIdleConnsPerHost: 1,
+		MaxConnsPerHost:     1,
+	}, 0)
+
+	send := func() {
+		ctx := httptrace.WithClientTrace(context.Background(), cs.clientTrace())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+		resp, err := client.Do(req)
+		assert.NoError(err)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	for i := 0; i < 3; i++ {
+		send()
+	}
+
+	s := cs.status()
+	assert.Equal(uint64(3), s.Requests)
+	assert.Equal(uint64(2), s.Reused)
+	assert.InDelta(2.0/3, s.ReuseRate, 0.001)
+	assert.Equal(uint64(1), s.Dials)
+	assert.Zero(s.DialErrors)
+	assert.Zero(s.Exhaustions)
+	assert.Greater(s.DialLatency, 0.0)
+
+	// only one connection is allowed, concurrent requests have to wait.
+	wg := sync.WaitGroup{}
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			send()
+		}()
+	}
+	wg.Wait()
+
+	s = cs.status()
+	assert.Equal(uint64(8), s.Requests)
+	assert.Greater(s.Exhaustions, uint64(0))
+
+	// dial errors.
+	ts.Close()
+	ctx := httptrace.WithClientTrace(context.Background(), cs.clientTrace())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	client.CloseIdleConnections()
+	_, err := client.Do(req)
+	assert.Error(err)
+	assert.Equal(uint64(1), cs.status().DialErrors)
+}
+
+func TestHTTPClientSpec(t *testing.T) {
+	assert := assert.New(t)
+
+	client := HTTPClient(nil, &HTTPClientSpec{
+		MaxConnsPerHost:     10,
+		IdleConnTimeout:     time.Minute,
+		TLSSessionCacheSize: 64,
+	}, 0)
+	transport := client.Transport.(*http.Transport)
+	assert.Equal(10, transport.MaxConnsPerHost)
+	assert.Equal(time.Minute, transport.IdleConnTimeout)
+	assert.NotNil(transport.TLSClientConfig.ClientSessionCache)
+
+	client = HTTPClient(nil, &HTTPClientSpec{}, 0)
+	transport = client.Transport.(*http.Transport)
+	assert.Equal(90*time.Second, transport.IdleConnTimeout)
+	assert.Nil(transport.TLSClientConfig)
+}
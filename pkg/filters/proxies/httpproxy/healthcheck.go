@@ -22,9 +22,11 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/websocket"
@@ -42,6 +44,14 @@ const (
 type ProxyHealthCheckSpec struct {
 	proxies.HealthCheckSpec `json:",inline"`
 	HTTPHealthCheckSpec     `json:",inline"`
+	// TCP replaces the HTTP health check with a TCP one if specified.
+	TCP *TCPHealthCheckSpec `json:"tcp,omitempty"`
+}
+
+// TCPHealthCheckSpec is the spec of TCP health check, a server is healthy
+// if a TCP connection to it can be established.
+type TCPHealthCheckSpec struct {
+	Port int `json:"port,omitempty"`
 }
 
 // HTTPHealthCheckSpec is the spec of HTTP health check.
@@ -200,6 +210,9 @@ func (spec *HTTPHealthCheckSpec) Validate() error {
 
 // Validate validates HealthCheckSpec.
 func (spec *ProxyHealthCheckSpec) Validate() error {
+	if spec.TCP != nil && spec.TCP.Port < 0 {
+		return fmt.Errorf("invalid tcp port: %d", spec.TCP.Port)
+	}
 	return spec.HTTPHealthCheckSpec.Validate()
 }
 
@@ -254,11 +267,39 @@ func (hc *httpHealthChecker) Check(server *proxies.Server) bool {
 // Close closes the health checker.
 func (hc *httpHealthChecker) Close() {}
 
-// NewHTTPHealthChecker creates a new HTTP health checker.
+type tcpHealthChecker struct {
+	spec *ProxyHealthCheckSpec
+}
+
+// BaseSpec returns the base spec.
+func (hc *tcpHealthChecker) BaseSpec() proxies.HealthCheckSpec {
+	return hc.spec.HealthCheckSpec
+}
+
+// Check checks the health of the server.
+func (hc *tcpHealthChecker) Check(server *proxies.Server) bool {
+	addr := getAddress(server, hc.spec.TCP.Port)
+	conn, err := net.DialTimeout("tcp", addr, hc.spec.GetTimeout())
+	if err != nil {
+		logger.Warnf("health check tcp %s failed: %v", addr, err)
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Close closes the health checker.
+func (hc *tcpHealthChecker) Close() {}
+
+// NewHTTPHealthChecker creates a new HTTP health checker, or a TCP health
+// checker if the TCP spec is specified.
 func NewHTTPHealthChecker(tlsConfig *tls.Config, spec *ProxyHealthCheckSpec) proxies.HealthChecker {
 	if spec == nil {
 		return nil
 	}
+	if spec.TCP != nil {
+		return &tcpHealthChecker{spec: spec}
+	}
 	if spec.Method == "" {
 		spec.Method = http.MethodGet
 	}
@@ -450,6 +491,25 @@ func NewWebSocketHealthChecker(spec *WSProxyHealthCheckSpec) proxies.HealthCheck
 	return res
 }
 
+// getAddress returns the host:port address of the server, the port is
+// replaced if not zero.
+func getAddress(server *proxies.Server, port int) string {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		return server.URL
+	}
+	if port == 0 {
+		if u.Port() != "" {
+			return u.Host
+		}
+		port = 80
+		if u.Scheme == "https" || u.Scheme == "wss" {
+			port = 443
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), strconv.Itoa(port))
+}
+
 func getURL(server *proxies.Server, uri *url.URL, port int, ws bool) string {
 	serverURL, err := url.Parse(server.URL)
 	if err != nil {
@@ -21,6 +21,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"sync/atomic"
 	"testing"
@@ -628,3 +629,36 @@ func TestWebSocketHealthCheck(t *testing.T) {
 		assert.False(hc.Check(s))
 	}
 }
+
+func TestTCPHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &ProxyHealthCheckSpec{TCP: &TCPHealthCheckSpec{Port: -1}}
+	assert.Error(spec.Validate())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	spec = &ProxyHealthCheckSpec{
+		HealthCheckSpec: proxies.HealthCheckSpec{Timeout: "100ms"},
+		TCP:             &TCPHealthCheckSpec{},
+	}
+	assert.Nil(spec.Validate())
+	hc := NewHTTPHealthChecker(nil, spec)
+	assert.Equal("100ms", hc.BaseSpec().Timeout)
+
+	s := &proxies.Server{URL: fmt.Sprintf("http://127.0.0.1:%d/api", port)}
+	assert.True(hc.Check(s))
+
+	spec.TCP.Port = port
+	assert.True(hc.Check(&proxies.Server{URL: "http://127.0.0.1"}))
+
+	ln.Close()
+	assert.False(hc.Check(s))
+	hc.Close()
+
+	assert.Equal("a.com:80", getAddress(&proxies.Server{URL: "http://a.com/"}, 0))
+	assert.Equal("a.com:443", getAddress(&proxies.Server{URL: "https://a.com"}, 0))
+	assert.Equal("[::1]:8080", getAddress(&proxies.Server{URL: "https://[::1]:443"}, 8080))
+}
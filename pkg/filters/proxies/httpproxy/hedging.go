@@ -0,0 +1,379 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpproxy
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
+	"github.com/megaease/easegress/v2/pkg/util/sampler"
+)
+
+const (
+	// the latency percentile is only used after enough samples are
+	// collected, and the samples are discarded periodically to follow
+	// the changes of the servers.
+	hedgingMinSamples      = 100
+	hedgingWindowSize      = 10000
+	hedgingRefreshInterval = time.Second
+)
+
+// hedgingPercentiles maps the supported percentiles to their indexes in
+// the result of sampler.DurationSampler.Percentiles.
+var hedgingPercentiles = map[float64]int{
+	50:   1,
+	75:   2,
+	95:   3,
+	98:   4,
+	99:   5,
+	99.9: 6,
+}
+
+// idempotentMethods are the methods hedged by default.
+var idempotentMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+
+type (
+	// HedgingSpec is the spec of request hedging. If the response of a
+	// request is not received within the latency threshold, a duplicate
+	// request is sent to another server, and the response which arrives
+	// first is used.
+	HedgingSpec struct {
+		// Percentile is the latency percentile of the requests to the
+		// pool used as the threshold, valid values are 50, 75, 95, 98,
+		// 99 and 99.9.
+		Percentile float64 `json:"percentile,omitempty"`
+		// Delay is the fixed threshold, it is also the threshold before
+		// enough samples are collected if Percentile is set.
+		Delay string `json:"delay,omitempty" jsonschema:"format=duration"`
+		// MinDelay is the lower bound of the threshold.
+		MinDelay string `json:"minDelay,omitempty" jsonschema:"format=duration"`
+		// Methods are the methods of the requests which could be hedged,
+		// default is GET, HEAD and OPTIONS.
+		Methods []string `json:"methods,omitempty" jsonschema:"uniqueItems=true"`
+	}
+
+	// HedgingStatus is the status of request hedging.
+	HedgingStatus struct {
+		Requests uint64 `json:"requests"`
+		Hedged   uint64 `json:"hedged"`
+		// Wins is the count of the hedged requests which responded
+		// earlier than the primary ones.
+		Wins uint64 `json:"wins"`
+		// Threshold is the current latency threshold in milliseconds.
+		Threshold float64 `json:"threshold"`
+	}
+
+	hedger struct {
+		percentile int
+		delay      time.Duration
+		minDelay   time.Duration
+		methods    map[string]struct{}
+
+		requests atomic.Uint64
+		hedged   atomic.Uint64
+		wins     atomic.Uint64
+
+		// latency is the latency of the percentile in nanoseconds, zero
+		// means it is not available yet.
+		latency atomic.Int64
+
+		mu          sync.Mutex
+		sampler     *sampler.DurationSampler
+		samples     int
+		nextRefresh time.Time
+	}
+
+	// hedgingLoadBalancer is a load balancer supporting hedging.
+	hedgingLoadBalancer interface {
+		LoadBalancer
+		ChooseServerExcept(req protocols.Request, except *Server) *Server
+		ReleaseServer(server *Server, req protocols.Request)
+	}
+
+	// hedgedAttempt is one of the requests sent for a hedged request.
+	hedgedAttempt struct {
+		svr       *Server
+		stdReq    *http.Request
+		resp      *http.Response
+		err       error
+		cancel    stdcontext.CancelFunc
+		startTime time.Time
+		// done is only accessed by the goroutine handling the request.
+		done bool
+	}
+)
+
+// Validate validates HedgingSpec.
+func (spec *HedgingSpec) Validate() error {
+	if spec.Percentile == 0 && spec.Delay == "" {
+		return fmt.Errorf("at least one of percentile and delay must be set")
+	}
+	if spec.Percentile != 0 {
+		if _, ok := hedgingPercentiles[spec.Percentile]; !ok {
+			return fmt.Errorf("invalid percentile %v", spec.Percentile)
+		}
+	}
+	if spec.Delay != "" {
+		if d, err := time.ParseDuration(spec.Delay); err != nil || d <= 0 {
+			return fmt.Errorf("invalid delay %s", spec.Delay)
+		}
+	}
+	if spec.MinDelay != "" {
+		if d, err := time.ParseDuration(spec.MinDelay); err != nil || d < 0 {
+			return fmt.Errorf("invalid minDelay %s", spec.MinDelay)
+		}
+	}
+	for _, m := range spec.Methods {
+		if _, ok := httpMethods[m]; !ok {
+			return fmt.Errorf("invalid method %s", m)
+		}
+		if m == http.MethodConnect {
+			return fmt.Errorf("method %s can not be hedged", m)
+		}
+	}
+	return nil
+}
+
+func newHedger(spec *HedgingSpec, name string) *hedger {
+	h := &hedger{
+		percentile: -1,
+		methods:    map[string]struct{}{},
+		sampler:    sampler.NewDurationSampler(),
+	}
+
+	if spec.Percentile != 0 {
+		h.percentile = hedgingPercentiles[spec.Percentile]
+	}
+	if spec.Delay != "" {
+		h.delay, _ = time.ParseDuration(spec.Delay)
+	}
+	if spec.MinDelay != "" {
+		h.minDelay, _ = time.ParseDuration(spec.MinDelay)
+	}
+
+	methods := spec.Methods
+	if len(methods) == 0 {
+		methods = idempotentMethods
+	}
+	for _, m := range methods {
+		h.methods[m] = struct{}{}
+		if m == http.MethodPost || m == http.MethodPatch {
+			logger.Warnf("%s: hedging is enabled for %s requests, they may be processed more than once", name, m)
+		}
+	}
+
+	return h
+}
+
+// eligible reports whether the request could be hedged, requests with a
+// stream body can't be hedged because the body can only be read once.
+func (h *hedger) eligible(method string, isStream bool) bool {
+	if isStream {
+		return false
+	}
+	_, ok := h.methods[method]
+	return ok
+}
+
+// threshold returns the latency threshold, zero means no hedging.
+func (h *hedger) threshold() time.Duration {
+	d := h.delay
+	if l := h.latency.Load(); l > 0 {
+		d = time.Duration(l)
+	}
+	if d > 0 && d < h.minDelay {
+		d = h.minDelay
+	}
+	return d
+}
+
+// observe records the latency of a successful attempt.
+func (h *hedger) observe(d time.Duration) {
+	if h.percentile < 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sampler.Update(d)
+	h.samples++
+
+	now := fasttime.Now()
+	if h.samples < hedgingMinSamples || now.Before(h.nextRefresh) {
+		return
+	}
+	h.nextRefresh = now.Add(hedgingRefreshInterval)
+
+	// the resolution of the sampler is 1ms.
+	l := time.Duration(h.sampler.Percentiles()[h.percentile]) * time.Millisecond
+	if l < time.Millisecond {
+		l = time.Millisecond
+	}
+	h.latency.Store(int64(l))
+
+	if h.samples >= hedgingWindowSize {
+		h.sampler.Reset()
+		h.samples = 0
+	}
+}
+
+func (h *hedger) status() *HedgingStatus {
+	return &HedgingStatus{
+		Requests:  h.requests.Load(),
+		Hedged:    h.hedged.Load(),
+		Wins:      h.wins.Load(),
+		Threshold: float64(h.threshold()) / float64(time.Millisecond),
+	}
+}
+
+// doHandleHedged is the hedging version of doHandle.
+func (sp *ServerPool) doHandleHedged(stdctx stdcontext.Context, spCtx *serverPoolContext, lb hedgingLoadBalancer) error {
+	h := sp.hedger
+	h.requests.Add(1)
+
+	var attempts []*hedgedAttempt
+	results := make(chan *hedgedAttempt, 2)
+
+	send := func(svr *Server) error {
+		ctx, cancel := stdcontext.WithCancel(stdctx)
+		if err := spCtx.prepareRequest(sp, svr, ctx, false); err != nil {
+			cancel()
+			lb.ReleaseServer(svr, spCtx.req)
+			return err
+		}
+
+		a := &hedgedAttempt{
+			svr:       svr,
+			stdReq:    spCtx.stdReq,
+			cancel:    cancel,
+			startTime: fasttime.Now(),
+		}
+		attempts = append(attempts, a)
+
+		go func() {
+			a.resp, a.err = fnSendRequest(a.stdReq, sp.httpClient())
+			results <- a
+		}()
+		return nil
+	}
+
+	svr := lb.ChooseServer(spCtx.req)
+	if svr == nil {
+		logger.Errorf("%s: no available server", sp.Name)
+		return serverPoolError{http.StatusServiceUnavailable, resultInternalError}
+	}
+	if err := send(svr); err != nil {
+		logger.Errorf("%s: failed to prepare request: %v", sp.Name, err)
+		return serverPoolError{http.StatusInternalServerError, resultInternalError}
+	}
+
+	var timeout <-chan time.Time
+	if d := h.threshold(); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var winner, failed *hedgedAttempt
+	for pending := 1; winner == nil && pending > 0; {
+		select {
+		case <-timeout:
+			timeout = nil
+			// it makes no sense to send the duplicate to the same server.
+			svr := lb.ChooseServerExcept(spCtx.req, attempts[0].svr)
+			if svr == nil {
+				break
+			}
+			if err := send(svr); err != nil {
+				logger.Errorf("%s: failed to prepare hedged request: %v", sp.Name, err)
+				break
+			}
+			pending++
+			h.hedged.Add(1)
+			spCtx.AddTag("hedged")
+
+		case a := <-results:
+			pending--
+			a.done = true
+			if a.err == nil {
+				winner = a
+				h.observe(fasttime.Since(a.startTime))
+				break
+			}
+			logger.Errorf("%s: failed to send request: %v", sp.Name, a.err)
+			a.cancel()
+			lb.ReturnServer(a.svr, spCtx.req, nil)
+			if failed == nil {
+				failed = a
+			}
+		}
+	}
+
+	// cancel the slower attempts, and release their servers after they
+	// are finished, they are not failures of the servers. The context of
+	// the winner is released along with its parent, it can't be cancelled
+	// here as the body of a stream response is still in use.
+	losers := 0
+	for _, a := range attempts {
+		if !a.done {
+			a.cancel()
+			losers++
+		}
+	}
+	if losers > 0 {
+		req := spCtx.req
+		go func() {
+			for i := 0; i < losers; i++ {
+				a := <-results
+				if a.resp != nil {
+					a.resp.Body.Close()
+				}
+				lb.ReleaseServer(a.svr, req)
+			}
+		}()
+	}
+
+	if winner == nil {
+		spCtx.stdReq = failed.stdReq
+		return sp.sendRequestError(failed.stdReq)
+	}
+
+	if winner != attempts[0] {
+		h.wins.Add(1)
+	}
+
+	spCtx.stdReq = winner.stdReq
+	httpprot.UpstreamDataKey.Set(spCtx.Context, winner.svr.URL)
+	spCtx.stdResp = winner.resp
+	if err := sp.buildResponse(spCtx); err != nil {
+		lb.ReturnServer(winner.svr, spCtx.req, nil)
+		return serverPoolError{http.StatusInternalServerError, resultInternalError}
+	}
+	lb.ReturnServer(winner.svr, spCtx.req, spCtx.resp)
+
+	return sp.checkResponse(spCtx)
+}
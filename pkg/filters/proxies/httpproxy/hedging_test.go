@@ -0,0 +1,146 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpproxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/resilience"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHedgingSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &HedgingSpec{}
+	assert.Error(spec.Validate())
+
+	spec = &HedgingSpec{Percentile: 90}
+	assert.Error(spec.Validate())
+
+	spec = &HedgingSpec{Delay: "-1s"}
+	assert.Error(spec.Validate())
+
+	spec = &HedgingSpec{Percentile: 99.9, MinDelay: "abc"}
+	assert.Error(spec.Validate())
+
+	spec = &HedgingSpec{Delay: "10ms", Methods: []string{"CONNECT"}}
+	assert.Error(spec.Validate())
+
+	spec = &HedgingSpec{Percentile: 95, Delay: "10ms", MinDelay: "5ms", Methods: []string{"GET", "PUT"}}
+	assert.NoError(spec.Validate())
+}
+
+func TestHedger(t *testing.T) {
+	assert := assert.New(t)
+
+	h := newHedger(&HedgingSpec{Delay: "10ms"}, "test")
+	assert.True(h.eligible(http.MethodGet, false))
+	assert.False(h.eligible(http.MethodGet, true))
+	assert.False(h.eligible(http.MethodPost, false))
+	assert.Equal(10*time.Millisecond, h.threshold())
+
+	// the samples are ignored if percentile is not set.
+	h.observe(time.Second)
+	assert.Equal(10*time.Millisecond, h.threshold())
+
+	h = newHedger(&HedgingSpec{Percentile: 50, MinDelay: "20ms", Methods: []string{"POST"}}, "test")
+	assert.True(h.eligible(http.MethodPost, false))
+	assert.False(h.eligible(http.MethodGet, false))
+	assert.Equal(time.Duration(0), h.threshold())
+
+	for i := 0; i < hedgingMinSamples; i++ {
+		h.observe(100 * time.Millisecond)
+	}
+	assert.Equal(100*time.Millisecond, h.threshold())
+
+	// the lower bound.
+	h.latency.Store(int64(time.Millisecond))
+	assert.Equal(20*time.Millisecond, h.threshold())
+}
+
+func TestPoolHedging(t *testing.T) {
+	assert := assert.New(t)
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(300 * time.Millisecond):
+		}
+		w.Write([]byte("slow"))
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fast"))
+	}))
+	defer fast.Close()
+
+	yamlConfig := fmt.Sprintf(`
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: %s
+  - url: %s
+  loadBalance:
+    policy: roundRobin
+  hedging:
+    delay: 20ms
+`, slow.URL, fast.URL)
+	proxy := newTestProxy(yamlConfig, assert)
+	proxy.InjectResiliencePolicy(make(map[string]resilience.Policy))
+	defer proxy.Close()
+
+	// the round robin policy chooses the slow server first for both
+	// requests, and the responses come from the fast server.
+	for i := 0; i < 2; i++ {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com", nil)
+		ctx := getCtx(stdr)
+		start := time.Now()
+		assert.Equal("", proxy.Handle(ctx))
+		assert.Less(time.Since(start), 200*time.Millisecond)
+		resp := ctx.GetOutputResponse().(*httpprot.Response)
+		assert.Equal("fast", string(resp.RawPayload()))
+	}
+
+	status := proxy.mainPool.status().Hedging
+	assert.Equal(uint64(2), status.Requests)
+	assert.Equal(uint64(2), status.Hedged)
+	assert.Equal(uint64(2), status.Wins)
+
+	// POST requests are not hedged by default.
+	slowCount := 0
+	for i := 0; i < 2; i++ {
+		stdr, _ := http.NewRequest(http.MethodPost, "http://www.megaease.com", strings.NewReader("body"))
+		ctx := getCtx(stdr)
+		assert.Equal("", proxy.Handle(ctx))
+		resp := ctx.GetOutputResponse().(*httpprot.Response)
+		if string(resp.RawPayload()) == "slow" {
+			slowCount++
+		}
+	}
+	assert.Equal(1, slowCount)
+	assert.Equal(uint64(2), proxy.mainPool.status().Hedging.Requests)
+}
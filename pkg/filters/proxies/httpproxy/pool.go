@@ -22,7 +22,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
 	"net/textproto"
+	"strconv"
 	"strings"
 	"time"
 
@@ -81,6 +83,9 @@ type serverPoolContext struct {
 	*context.Context
 	span      *tracing.Span
 	startTime time.Time
+	// firstByteTime is the time the response header is received, it is
+	// zero if there's no response from the backend.
+	firstByteTime time.Time
 
 	req     *httpprot.Request
 	stdReq  *http.Request
@@ -150,13 +155,22 @@ func (spCtx *serverPoolContext) prepareRequest(pool *ServerPool, svr *Server, ct
 	} else {
 		payload = req.GetPayload()
 	}
+	ctx = httptrace.WithClientTrace(ctx, pool.connStat.clientTrace())
 	stdr, err := http.NewRequestWithContext(ctx, req.Method(), url, payload)
 	if err != nil {
 		return err
 	}
 	svrHost := stdr.Host
 
-	stdr.Header = req.HTTPHeader().Clone()
+	// the header of a mirrored or hedged request could be still in use
+	// after the task finishes, so it is not pooled.
+	if context.PoolEnabled() && !mirror && pool.hedger == nil {
+		ph := httpprot.AcquireHeader(req.HTTPHeader())
+		spCtx.OnFinish(ph.Release)
+		stdr.Header = ph.Header
+	} else {
+		stdr.Header = req.HTTPHeader().Clone()
+	}
 	removeHopByHopHeaders(stdr.Header)
 
 	// only set host when server address is not host name OR
@@ -172,6 +186,16 @@ func (spCtx *serverPoolContext) prepareRequest(pool *ServerPool, svr *Server, ct
 		stdr.Header.Add("Host", svrHost)
 	}
 
+	if h := pool.proxy.spec.DeadlineHeader; h != "" {
+		if deadline, ok := ctx.Deadline(); ok {
+			remaining := deadline.Sub(fasttime.Now()).Milliseconds()
+			if remaining < 0 {
+				remaining = 0
+			}
+			stdr.Header.Set(h, strconv.FormatInt(remaining, 10))
+		}
+	}
+
 	if spCtx.span != nil {
 		spCtx.span.InjectHTTP(stdr)
 	}
@@ -197,6 +221,12 @@ type ServerPool struct {
 	memoryCache   *MemoryCache
 	metrics       *metrics
 	healthChecker proxies.HealthChecker
+
+	// client is only created if the pool has its own TLS configuration,
+	// otherwise, the client of the proxy is used.
+	client   *http.Client
+	connStat connStat
+	hedger   *hedger
 }
 
 // ServerPoolSpec is the spec for a server pool.
@@ -211,6 +241,8 @@ type ServerPoolSpec struct {
 	CircuitBreakerPolicy string                `json:"circuitBreakerPolicy,omitempty"`
 	MemoryCache          *MemoryCacheSpec      `json:"memoryCache,omitempty"`
 	HealthCheck          *ProxyHealthCheckSpec `json:"healthCheck,omitempty"`
+	TLS                  *TLSSpec              `json:"tls,omitempty"`
+	Hedging              *HedgingSpec          `json:"hedging,omitempty"`
 
 	// FailureCodes would be 5xx if it isn't assigned any value.
 	FailureCodes []int `json:"failureCodes,omitempty" jsonschema:"uniqueItems=true"`
@@ -223,6 +255,16 @@ func (spec *ServerPoolSpec) Validate() error {
 	if spec.ServiceName != "" && spec.HealthCheck != nil {
 		return fmt.Errorf("serviceName and healthCheck can't be set at the same time")
 	}
+	if spec.TLS != nil {
+		if err := spec.TLS.Validate(); err != nil {
+			return fmt.Errorf("tls: %v", err)
+		}
+	}
+	if spec.Hedging != nil {
+		if err := spec.Hedging.Validate(); err != nil {
+			return fmt.Errorf("hedging: %v", err)
+		}
+	}
 	if spec.HealthCheck != nil {
 		return spec.HealthCheck.Validate()
 	}
@@ -231,12 +273,27 @@ func (spec *ServerPoolSpec) Validate() error {
 
 // ServerPoolStatus is the status of Pool.
 type ServerPoolStatus struct {
-	Stat *httpstat.Status `json:"stat"`
+	Stat        *httpstat.Status           `json:"stat"`
+	LoadBalance *proxies.LoadBalanceStatus `json:"loadBalance,omitempty"`
+	Conn        *ConnStatus                `json:"conn,omitempty"`
+	Hedging     *HedgingStatus             `json:"hedging,omitempty"`
+	// CircuitBreaker is the state of the circuit breaker, like Closed and
+	// Open, it is empty if there is no circuit breaker policy.
+	CircuitBreaker string `json:"circuitBreaker,omitempty"`
 }
 
 // NewServerPool creates a new server pool according to spec.
 func NewServerPool(proxy *Proxy, spec *ServerPoolSpec, name string) *ServerPool {
 	tlsConfig, _ := proxy.tlsConfig()
+	var client *http.Client
+	if spec.TLS != nil {
+		tlsConfig, _ = spec.TLS.tlsConfig()
+		client = HTTPClient(tlsConfig, proxy.httpClientSpec(), 0)
+		if spec.TLS.InsecureSkipVerify {
+			logger.Warnf("%s: insecureSkipVerify is enabled, certificates of the servers are NOT verified, "+
+				"connections are vulnerable to man-in-the-middle attacks", name)
+		}
+	}
 	// backward compatibility, if healthCheck is not set, but loadBalance's healthCheck is set, use it.
 	if spec.HealthCheck == nil && spec.LoadBalance != nil && spec.LoadBalance.HealthCheck != nil {
 		spec.HealthCheck = &ProxyHealthCheckSpec{
@@ -248,6 +305,7 @@ func NewServerPool(proxy *Proxy, spec *ServerPoolSpec, name string) *ServerPool
 		spec:          spec,
 		httpStat:      httpstat.New(),
 		healthChecker: NewHTTPHealthChecker(tlsConfig, spec.HealthCheck),
+		client:        client,
 	}
 	if spec.Filter != nil {
 		sp.filter = NewRequestMatcher(spec.Filter)
@@ -263,6 +321,10 @@ func NewServerPool(proxy *Proxy, spec *ServerPoolSpec, name string) *ServerPool
 		sp.timeout, _ = time.ParseDuration(spec.Timeout)
 	}
 
+	if spec.Hedging != nil {
+		sp.hedger = newHedger(spec.Hedging, name)
+	}
+
 	sp.failureCodes = map[int]struct{}{}
 	for _, code := range spec.FailureCodes {
 		sp.failureCodes[code] = struct{}{}
@@ -272,6 +334,13 @@ func NewServerPool(proxy *Proxy, spec *ServerPoolSpec, name string) *ServerPool
 	return sp
 }
 
+func (sp *ServerPool) httpClient() *http.Client {
+	if sp.client != nil {
+		return sp.client
+	}
+	return sp.proxy.client
+}
+
 // CreateLoadBalancer creates a load balancer according to spec.
 func (sp *ServerPool) CreateLoadBalancer(spec *LoadBalanceSpec, servers []*Server) LoadBalancer {
 	lb := proxies.NewGeneralLoadBalancer(spec, servers)
@@ -280,7 +349,19 @@ func (sp *ServerPool) CreateLoadBalancer(spec *LoadBalanceSpec, servers []*Serve
 }
 
 func (sp *ServerPool) status() *ServerPoolStatus {
-	s := &ServerPoolStatus{Stat: sp.httpStat.Status()}
+	s := &ServerPoolStatus{
+		Stat: sp.httpStat.Status(),
+		Conn: sp.connStat.status(),
+	}
+	if lb, ok := sp.LoadBalancer().(*proxies.GeneralLoadBalancer); ok {
+		s.LoadBalance = lb.Status()
+	}
+	if sp.hedger != nil {
+		s.Hedging = sp.hedger.status()
+	}
+	if sp.circuitBreakerWrapper != nil {
+		s.CircuitBreaker, _ = resilience.CircuitBreakerState(sp.circuitBreakerWrapper)
+	}
 	return s
 }
 
@@ -321,6 +402,10 @@ func (sp *ServerPool) collectMetrics(spCtx *serverPoolContext) {
 	metric.ReqSize += uint64(spCtx.req.PayloadSize())
 	metric.RespSize = uint64(spCtx.resp.MetaSize())
 
+	if !spCtx.firstByteTime.IsZero() {
+		metric.FirstByte = spCtx.firstByteTime.Sub(spCtx.startTime)
+	}
+
 	collect := func() {
 		metric.Duration = fasttime.Since(spCtx.startTime)
 		sp.httpStat.Stat(metric)
@@ -354,38 +439,47 @@ func (sp *ServerPool) collectMetrics(spCtx *serverPoolContext) {
 	})
 }
 
-func (sp *ServerPool) handleMirror(spCtx *serverPoolContext) {
-	svr := sp.LoadBalancer().ChooseServer(spCtx.req)
+// mirror sends a copy of the request to the pool in background. The copy
+// is prepared in the calling goroutine, because the request and the
+// context could be changed by the following filters, or even released to
+// the pool, when the copy is sent.
+func (sp *ServerPool) mirror(req *httpprot.Request) {
+	lb := sp.LoadBalancer()
+	svr := lb.ChooseServer(req)
 	if svr == nil {
 		return
 	}
 
-	err := spCtx.prepareRequest(sp, svr, spCtx.req.Context(), true)
+	// the context is not set, as the mirrored request must not reference
+	// it.
+	spCtx := &serverPoolContext{req: req}
+	err := spCtx.prepareRequest(sp, svr, req.Context(), true)
 	if err != nil {
+		lb.ReturnServer(svr, req, nil)
 		logger.Errorf("%s: failed to prepare request: %v", sp.Name, err)
 		return
 	}
 
-	resp, err := fnSendRequest(spCtx.stdReq, sp.proxy.client)
-	if err != nil {
-		return
-	}
+	stdReq := spCtx.stdReq
+	go func() {
+		defer lb.ReturnServer(svr, req, nil)
 
-	io.Copy(io.Discard, resp.Body)
-	resp.Body.Close()
+		resp, err := fnSendRequest(stdReq, sp.httpClient())
+		if err != nil {
+			return
+		}
+
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
 }
 
-func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
+func (sp *ServerPool) handle(ctx *context.Context) string {
 	spCtx := &serverPoolContext{
 		Context: ctx,
 		req:     ctx.GetInputRequest().(*httpprot.Request),
 	}
 
-	if mirror {
-		sp.handleMirror(spCtx)
-		return ""
-	}
-
 	spCtx.startTime = fasttime.Now()
 	defer sp.collectMetrics(spCtx)
 
@@ -411,6 +505,7 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 		spCtx.resp = nil
 		spCtx.stdResp = nil
 		spCtx.respCallbackBody = nil
+		spCtx.firstByteTime = time.Time{}
 
 		spanName := sp.spec.SpanName
 		if spanName == "" {
@@ -460,7 +555,14 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 }
 
 func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolContext) error {
-	svr := sp.LoadBalancer().ChooseServer(spCtx.req)
+	if sp.hedger != nil && sp.hedger.eligible(spCtx.req.Method(), spCtx.req.IsStream()) {
+		if lb, ok := sp.LoadBalancer().(hedgingLoadBalancer); ok {
+			return sp.doHandleHedged(stdctx, spCtx, lb)
+		}
+	}
+
+	lb := sp.LoadBalancer()
+	svr := lb.ChooseServer(spCtx.req)
 
 	// if there's no available server.
 	if svr == nil {
@@ -468,6 +570,15 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 		return serverPoolError{http.StatusServiceUnavailable, resultInternalError}
 	}
 
+	// the server must be returned on all paths, the response is only
+	// passed to the load balancer if it is built successfully.
+	returned := false
+	defer func() {
+		if !returned {
+			lb.ReturnServer(svr, spCtx.req, nil)
+		}
+	}()
+
 	// prepare the request to send.
 	statResult := &gohttpstat.Result{}
 	stdctx = gohttpstat.WithHTTPStat(stdctx, statResult)
@@ -475,8 +586,9 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 		logger.Errorf("%s: failed to prepare request: %v", sp.Name, err)
 		return serverPoolError{http.StatusInternalServerError, resultInternalError}
 	}
+	httpprot.UpstreamDataKey.Set(spCtx.Context, svr.URL)
 
-	resp, err := fnSendRequest(spCtx.stdReq, sp.proxy.client)
+	resp, err := fnSendRequest(spCtx.stdReq, sp.httpClient())
 	if err != nil {
 		logger.Errorf("%s: failed to send request: %v", sp.Name, err)
 
@@ -485,26 +597,39 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 			return fmt.Sprintf("trace %v", statResult)
 		})
 
-		if err := spCtx.stdReq.Context().Err(); err == nil {
-			return serverPoolError{http.StatusServiceUnavailable, resultServerError}
-		} else if err == stdcontext.DeadlineExceeded {
-			return serverPoolError{http.StatusRequestTimeout, resultTimeout}
-		}
-
-		// NOTE: return 499 if client is Disconnected.
-		// TODO: define a constant for 499
-		return serverPoolError{499, resultClientError}
+		return sp.sendRequestError(spCtx.stdReq)
 	}
 
+	spCtx.firstByteTime = fasttime.Now()
 	spCtx.stdResp = resp
 	if err = sp.buildResponse(spCtx); err != nil {
 		return serverPoolError{http.StatusInternalServerError, resultInternalError}
 	}
 
-	sp.LoadBalancer().ReturnServer(svr, spCtx.req, spCtx.resp)
+	lb.ReturnServer(svr, spCtx.req, spCtx.resp)
+	returned = true
+
+	return sp.checkResponse(spCtx)
+}
+
+// sendRequestError converts the failure of sending a request to the
+// error of the server pool.
+func (sp *ServerPool) sendRequestError(stdReq *http.Request) error {
+	if err := stdReq.Context().Err(); err == nil {
+		return serverPoolError{http.StatusServiceUnavailable, resultServerError}
+	} else if err == stdcontext.DeadlineExceeded {
+		return serverPoolError{http.StatusRequestTimeout, resultTimeout}
+	}
+
+	// NOTE: return 499 if client is Disconnected.
+	// TODO: define a constant for 499
+	return serverPoolError{499, resultClientError}
+}
 
+func (sp *ServerPool) checkResponse(spCtx *serverPoolContext) error {
+	code := spCtx.stdResp.StatusCode
 	spCtx.LazyAddTag(func() string {
-		return fmt.Sprintf("status code: %d", resp.StatusCode)
+		return fmt.Sprintf("status code: %d", code)
 	})
 
 	// If the status code is one of the failure codes, change result to
@@ -512,8 +637,8 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 	//
 	// This may be incorrect, but failure code is different from other
 	// errors, and it seems impossible to find a perfect solution.
-	if sp.inFailureCodes(resp.StatusCode) {
-		return serverPoolError{resp.StatusCode, resultFailureCode}
+	if sp.inFailureCodes(code) {
+		return serverPoolError{code, resultFailureCode}
 	}
 
 	return nil
@@ -555,7 +680,12 @@ func (sp *ServerPool) buildResponse(spCtx *serverPoolContext) (err error) {
 	if maxBodySize == 0 {
 		maxBodySize = sp.proxy.spec.ServerMaxBodySize
 	}
-	if err = resp.FetchPayload(maxBodySize); err != nil {
+	if stream, _ := httpprot.StreamResponseDataKey.Get(spCtx.Context); stream {
+		err = resp.FetchStreamPayload(maxBodySize)
+	} else {
+		err = resp.FetchPayload(maxBodySize)
+	}
+	if err != nil {
 		logger.Errorf("%s: failed to fetch response payload: %v, please consider to set serverMaxBodySize of Proxy to -1.", sp.Name, err)
 		body.Close()
 		return err
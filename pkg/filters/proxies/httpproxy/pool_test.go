@@ -18,8 +18,11 @@
 package httpproxy
 
 import (
+	stdcontext "context"
 	"net/http"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/option"
@@ -221,3 +224,36 @@ func TestInFailureCodes(t *testing.T) {
 	assert.False(sp.inFailureCodes(500))
 	assert.True(sp.inFailureCodes(400))
 }
+
+func TestDeadlineHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+name: proxy
+kind: Proxy
+deadlineHeader: X-Deadline
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+`
+	proxy := newTestProxy(yamlConfig, assert)
+	defer proxy.Close()
+	svr := proxy.mainPool.spec.Servers[0]
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com", nil)
+	stdr.Header.Set("X-Deadline", "100000")
+	spCtx := &serverPoolContext{Context: getCtx(stdr)}
+	spCtx.req = spCtx.GetInputRequest().(*httpprot.Request)
+
+	// the header is passed through if there's no deadline.
+	assert.NoError(spCtx.prepareRequest(proxy.mainPool, svr, stdcontext.Background(), false))
+	assert.Equal("100000", spCtx.stdReq.Header.Get("X-Deadline"))
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 10*time.Second)
+	defer cancel()
+	assert.NoError(spCtx.prepareRequest(proxy.mainPool, svr, ctx, false))
+	remaining, err := strconv.Atoi(spCtx.stdReq.Header.Get("X-Deadline"))
+	assert.NoError(err)
+	assert.LessOrEqual(remaining, 10000)
+	assert.Greater(remaining, 9000)
+}
@@ -62,6 +62,23 @@ var kind = &filters.Kind{
 		resultTimeout,
 		resultShortCircuited,
 	},
+	Indicators: []*filters.Indicator{
+		{Name: "mainPool.stat.count", Description: "Number of the requests sent to the main pool", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "mainPool.stat.errCount", Description: "Number of the requests to the main pool failed or responded with a status code of 4xx or 5xx", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "mainPool.stat.m1", Description: "Rate of the requests to the main pool in the last minute", Type: filters.IndicatorTypeNumber, Unit: "requests/s"},
+		{Name: "mainPool.stat.m1ErrPercent", Description: "Ratio of the failed requests to the main pool in the last minute, between 0 and 1", Type: filters.IndicatorTypeNumber},
+		{Name: "mainPool.stat.mean", Description: "Mean latency of the main pool", Type: filters.IndicatorTypeInteger, Unit: "ms"},
+		{Name: "mainPool.stat.p50", Description: "Median latency of the main pool", Type: filters.IndicatorTypeNumber, Unit: "ms"},
+		{Name: "mainPool.stat.p99", Description: "99th percentile latency of the main pool", Type: filters.IndicatorTypeNumber, Unit: "ms"},
+		{Name: "mainPool.stat.codes.*", Description: "Number of the responses of the main pool by the status code", Type: filters.IndicatorTypeInteger, Unit: "responses"},
+		{Name: "mainPool.conn.reuseRate", Description: "Rate of the requests sent on reused connections, between 0 and 1", Type: filters.IndicatorTypeNumber},
+		{Name: "mainPool.conn.exhaustions", Description: "Number of the requests waited for a connection in use", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "mainPool.conn.dialErrors", Description: "Number of the failed dials to the servers", Type: filters.IndicatorTypeInteger, Unit: "dials"},
+		{Name: "mainPool.conn.dialLatency", Description: "Average latency of the dials to the servers", Type: filters.IndicatorTypeNumber, Unit: "ms"},
+		{Name: "mainPool.hedging.hedged", Description: "Number of the requests hedged", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "mainPool.hedging.wins", Description: "Number of the hedged requests responded earlier than the primary ones", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "mainPool.circuitBreaker", Description: "State of the circuit breaker of the main pool, Closed, HalfOpen, Open, ForceOpen or Disabled", Type: filters.IndicatorTypeString},
+	},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{
 			MaxIdleConns:        10240,
@@ -116,6 +133,12 @@ type (
 		MaxIdleConnsPerHost int               `json:"maxIdleConnsPerHost,omitempty"`
 		MaxRedirection      int               `json:"maxRedirection,omitempty"`
 		ServerMaxBodySize   int64             `json:"serverMaxBodySize,omitempty"`
+		MaxConnsPerHost     int               `json:"maxConnsPerHost,omitempty" jsonschema:"minimum=0"`
+		IdleConnTimeout     string            `json:"idleConnTimeout,omitempty" jsonschema:"format=duration"`
+		TLSSessionCacheSize int               `json:"tlsSessionCacheSize,omitempty" jsonschema:"minimum=0"`
+		// DeadlineHeader is the header to tell the servers the remaining
+		// time of the request in milliseconds, if it has a deadline.
+		DeadlineHeader string `json:"deadlineHeader,omitempty"`
 	}
 
 	// Status is the status of Proxy.
@@ -138,6 +161,12 @@ type (
 		MaxIdleConns        int
 		MaxIdleConnsPerHost int
 		MaxRedirection      *int
+		MaxConnsPerHost     int
+		// IdleConnTimeout defaults to 90 seconds if it is zero.
+		IdleConnTimeout time.Duration
+		// TLSSessionCacheSize is the size of the cache of TLS sessions for
+		// resumption, the cache is disabled if it is zero.
+		TLSSessionCacheSize int
 	}
 
 	// Server is the backend server.
@@ -154,6 +183,18 @@ type (
 	BaseServerPoolSpec = proxies.ServerPoolBaseSpec
 )
 
+// References returns the service registries used by the pools.
+func (s *Spec) References() []string {
+	var names []string
+	for _, pool := range s.Pools {
+		names = append(names, pool.ServiceRegistry)
+	}
+	if s.MirrorPool != nil {
+		names = append(names, s.MirrorPool.ServiceRegistry)
+	}
+	return names
+}
+
 // Validate validates Spec.
 func (s *Spec) Validate() error {
 	numMainPool := 0
@@ -183,6 +224,20 @@ func (s *Spec) Validate() error {
 }
 
 func HTTPClient(tlsCfg *tls.Config, spec *HTTPClientSpec, timeout time.Duration) *http.Client {
+	idleConnTimeout := spec.IdleConnTimeout
+	if idleConnTimeout == 0 {
+		idleConnTimeout = 90 * time.Second
+	}
+
+	if spec.TLSSessionCacheSize > 0 {
+		if tlsCfg == nil {
+			tlsCfg = &tls.Config{}
+		} else {
+			tlsCfg = tlsCfg.Clone()
+		}
+		tlsCfg.ClientSessionCache = tls.NewLRUClientSessionCache(spec.TLSSessionCacheSize)
+	}
+
 	dialFunc := func(ctx stdctx.Context, network, addr string) (net.Conn, error) {
 		return (&net.Dialer{
 			Timeout:   30 * time.Second,
@@ -202,7 +257,8 @@ func HTTPClient(tlsCfg *tls.Config, spec *HTTPClientSpec, timeout time.Duration)
 			// reduce overhead of building connections.
 			MaxIdleConns:          spec.MaxIdleConns,
 			MaxIdleConnsPerHost:   spec.MaxIdleConnsPerHost,
-			IdleConnTimeout:       90 * time.Second,
+			MaxConnsPerHost:       spec.MaxConnsPerHost,
+			IdleConnTimeout:       idleConnTimeout,
 			TLSHandshakeTimeout:   10 * time.Second,
 			ExpectContinueTimeout: 1 * time.Second,
 		},
@@ -301,12 +357,19 @@ func (p *Proxy) reload() {
 	}
 
 	tlsCfg, _ := p.tlsConfig()
-	clientSpec := &HTTPClientSpec{
+	p.client = HTTPClient(tlsCfg, p.httpClientSpec(), 0)
+}
+
+func (p *Proxy) httpClientSpec() *HTTPClientSpec {
+	idleConnTimeout, _ := time.ParseDuration(p.spec.IdleConnTimeout)
+	return &HTTPClientSpec{
 		MaxIdleConns:        p.spec.MaxIdleConns,
 		MaxIdleConnsPerHost: p.spec.MaxIdleConnsPerHost,
 		MaxRedirection:      &p.spec.MaxRedirection,
+		MaxConnsPerHost:     p.spec.MaxConnsPerHost,
+		IdleConnTimeout:     idleConnTimeout,
+		TLSSessionCacheSize: p.spec.TLSSessionCacheSize,
 	}
-	p.client = HTTPClient(tlsCfg, clientSpec, 0)
 }
 
 // Status returns Proxy status.
@@ -339,12 +402,29 @@ func (p *Proxy) Close() {
 	}
 }
 
+// NeedPayload returns whether the payloads are needed, it implements
+// context.PayloadNeeder. The request payload is needed to mirror, retry or
+// hedge the requests, and the response payload is needed to cache the
+// responses, the others are streamed.
+func (p *Proxy) NeedPayload() (request, response bool) {
+	request = p.spec.MirrorPool != nil
+	for _, pool := range p.spec.Pools {
+		if pool.RetryPolicy != "" || pool.Hedging != nil {
+			request = true
+		}
+		if pool.MemoryCache != nil {
+			response = true
+		}
+	}
+	return request, response
+}
+
 // Handle handles HTTPContext.
 func (p *Proxy) Handle(ctx *context.Context) (result string) {
 	req := ctx.GetInputRequest().(*httpprot.Request)
 
 	if p.mirrorPool != nil && p.mirrorPool.filter.Match(req) {
-		go p.mirrorPool.handle(ctx, true)
+		p.mirrorPool.mirror(req)
 	}
 
 	sp := p.mainPool
@@ -355,7 +435,7 @@ func (p *Proxy) Handle(ctx *context.Context) (result string) {
 		}
 	}
 
-	return sp.handle(ctx, false)
+	return sp.handle(ctx)
 }
 
 // InjectResiliencePolicy injects resilience policies to the proxy.
@@ -179,7 +179,7 @@ func (shp *SimpleHTTPProxy) handleConnect(ctx *context.Context) string {
 	startTime := fasttime.Now()
 
 	host := ctx.GetInputRequest().(*httpprot.Request).Host()
-	w, _ := ctx.GetData("HTTP_RESPONSE_WRITER").(http.ResponseWriter)
+	w, _ := httpprot.ResponseWriterDataKey.Get(ctx)
 
 	destConn, err := net.Dial("tcp", host)
 	if err != nil {
@@ -187,6 +187,7 @@ func (shp *SimpleHTTPProxy) handleConnect(ctx *context.Context) string {
 		return resultServerError
 	}
 	w.WriteHeader(http.StatusOK)
+	metric.FirstByte = fasttime.Since(startTime)
 
 	hijacker, ok := w.(http.Hijacker)
 	if !ok {
@@ -230,7 +231,7 @@ func (shp *SimpleHTTPProxy) handleConnect(ctx *context.Context) string {
 
 	metric.StatusCode = http.StatusOK
 	metric.Duration = fasttime.Since(startTime)
-	ctx.SetData("HTTP_METRIC", metric)
+	httpstat.MetricDataKey.Set(ctx, metric)
 
 	return ""
 }
@@ -259,6 +260,13 @@ func (shp *SimpleHTTPProxy) doRequestWithRetry(req *httpprot.Request) (*http.Res
 	return resp, err
 }
 
+// NeedPayload returns whether the payloads are needed, it implements
+// context.PayloadNeeder. The request payload is needed to retry the
+// requests.
+func (shp *SimpleHTTPProxy) NeedPayload() (request, response bool) {
+	return shp.spec.RetryPolicy != "", false
+}
+
 // Handle handles HTTPContext.
 func (shp *SimpleHTTPProxy) Handle(ctx *context.Context) (result string) {
 	// get request from Context
@@ -281,7 +289,12 @@ func (shp *SimpleHTTPProxy) Handle(ctx *context.Context) (result string) {
 	httpResp, _ := httpprot.NewResponse(resp)
 
 	maxBodySize := shp.spec.ServerMaxBodySize
-	if err = httpResp.FetchPayload(maxBodySize); err != nil {
+	if stream, _ := httpprot.StreamResponseDataKey.Get(ctx); stream {
+		err = httpResp.FetchStreamPayload(maxBodySize)
+	} else {
+		err = httpResp.FetchPayload(maxBodySize)
+	}
+	if err != nil {
 		logger.Errorf("%s: failed to fetch response payload: %v, please consider to set serverMaxBodySize of SimpleHTTPProxy to -1.", shp.Name(), err)
 		return resultServerError
 	}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpproxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+)
+
+// TLSSpec is the TLS configuration of the connections from a server
+// pool to its servers.
+type TLSSpec struct {
+	// CACertBase64 is the CA bundle to verify the certificates of the
+	// servers, the system CAs are used if empty.
+	CACertBase64 string `json:"caCertBase64,omitempty" jsonschema:"format=base64"`
+	// CertBase64 and KeyBase64 are the client certificate for mTLS.
+	CertBase64 string `json:"certBase64,omitempty" jsonschema:"format=base64"`
+	KeyBase64  string `json:"keyBase64,omitempty" jsonschema:"format=base64"`
+	// ServerName overrides the server name for SNI and verification.
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+// Validate validates TLSSpec.
+func (spec *TLSSpec) Validate() error {
+	if (spec.CertBase64 == "") != (spec.KeyBase64 == "") {
+		return fmt.Errorf("certBase64 and keyBase64 must be both set or both empty")
+	}
+	_, err := spec.tlsConfig()
+	return err
+}
+
+func (spec *TLSSpec) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         spec.ServerName,
+		InsecureSkipVerify: spec.InsecureSkipVerify,
+	}
+
+	if spec.CACertBase64 != "" {
+		caPem, err := base64.StdEncoding.DecodeString(spec.CACertBase64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode CA certificates: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPem) {
+			return nil, fmt.Errorf("no valid CA certificate found")
+		}
+		cfg.RootCAs = pool
+	}
+
+	if spec.CertBase64 != "" {
+		certPem, err := base64.StdEncoding.DecodeString(spec.CertBase64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode certificate: %v", err)
+		}
+		keyPem, err := base64.StdEncoding.DecodeString(spec.KeyBase64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key: %v", err)
+		}
+		cert, err := tls.X509KeyPair(certPem, keyPem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
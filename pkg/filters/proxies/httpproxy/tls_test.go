@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpproxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func pemBase64(typ string, der []byte) string {
+	return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}))
+}
+
+func TestTLSSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &TLSSpec{}
+	assert.NoError(spec.Validate())
+
+	spec.CertBase64 = "YWJj"
+	assert.Error(spec.Validate(), "key is missing")
+
+	spec.KeyBase64 = "YWJj"
+	assert.Error(spec.Validate(), "invalid certificate")
+
+	spec = &TLSSpec{CACertBase64: "YWJj"}
+	assert.Error(spec.Validate(), "invalid CA")
+}
+
+func TestPoolTLS(t *testing.T) {
+	assert := assert.New(t)
+
+	// the client certificate is required but not verified by the server.
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	ts.StartTLS()
+	defer ts.Close()
+
+	cert := ts.TLS.Certificates[0]
+	keyDer, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	assert.NoError(err)
+	certBase64 := pemBase64("CERTIFICATE", cert.Certificate[0])
+	keyBase64 := pemBase64("PRIVATE KEY", keyDer)
+
+	newPool := func(tlsConfig string) *ServerPool {
+		yamlConfig := fmt.Sprintf(`
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: %s
+  tls:
+%s
+`, ts.URL, tlsConfig)
+		proxy := newTestProxy(yamlConfig, assert)
+		assert.NotSame(proxy.client, proxy.mainPool.httpClient())
+		return proxy.mainPool
+	}
+
+	get := func(sp *ServerPool) (int, error) {
+		resp, err := sp.httpClient().Get(ts.URL)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	// the CA is unknown.
+	sp := newPool(fmt.Sprintf("    certBase64: %s\n    keyBase64: %s", certBase64, keyBase64))
+	_, err = get(sp)
+	assert.Error(err)
+
+	// the test certificate is valid for example.com, but not for the SNI.
+	sp = newPool(fmt.Sprintf("    caCertBase64: %s\n    certBase64: %s\n    keyBase64: %s\n    serverName: wrong.com",
+		certBase64, certBase64, keyBase64))
+	_, err = get(sp)
+	assert.Error(err)
+
+	sp = newPool(fmt.Sprintf("    caCertBase64: %s\n    certBase64: %s\n    keyBase64: %s\n    serverName: example.com",
+		certBase64, certBase64, keyBase64))
+	code, err := get(sp)
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, code)
+
+	// no client certificate.
+	sp = newPool("    insecureSkipVerify: true")
+	_, err = get(sp)
+	assert.Error(err)
+}
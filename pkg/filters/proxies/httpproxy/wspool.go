@@ -186,7 +186,8 @@ func (sp *WebSocketServerPool) dialServer(svr *Server, req *httpprot.Request) (*
 
 func (sp *WebSocketServerPool) handle(ctx *context.Context) (result string) {
 	req := ctx.GetInputRequest().(*httpprot.Request)
-	svr := sp.LoadBalancer().ChooseServer(req)
+	lb := sp.LoadBalancer()
+	svr := lb.ChooseServer(req)
 
 	metric := &httpstat.Metric{}
 	startTime := fasttime.Now()
@@ -202,8 +203,9 @@ func (sp *WebSocketServerPool) handle(ctx *context.Context) (result string) {
 		metric.StatusCode = http.StatusServiceUnavailable
 		return resultInternalError
 	}
+	defer lb.ReturnServer(svr, req, nil)
 
-	stdw, _ := ctx.GetData("HTTP_RESPONSE_WRITER").(http.ResponseWriter)
+	stdw, _ := httpprot.ResponseWriterDataKey.Get(ctx)
 	if stdw == nil {
 		logger.Errorf("%s: cannot get response writer from context", sp.Name)
 		sp.buildFailureResponse(ctx, http.StatusInternalServerError)
@@ -226,6 +228,8 @@ func (sp *WebSocketServerPool) handle(ctx *context.Context) (result string) {
 		metric.StatusCode = http.StatusBadRequest
 		return resultClientError
 	}
+	// the client receives the handshake response once it is accepted.
+	metric.FirstByte = fasttime.Since(startTime)
 	if sp.spec.ClientMaxMsgSize > 0 || sp.spec.ClientMaxMsgSize == -1 {
 		clntConn.SetReadLimit(sp.spec.ClientMaxMsgSize)
 	}
@@ -314,7 +318,7 @@ func (sp *WebSocketServerPool) handle(ctx *context.Context) (result string) {
 
 	sp.buildSuccessResponse(ctx, resp)
 	metric.StatusCode = http.StatusSwitchingProtocols
-	ctx.SetData("HTTP_METRIC", metric)
+	httpstat.MetricDataKey.Set(ctx, metric)
 	return
 }
 
@@ -74,6 +74,15 @@ type (
 	}
 )
 
+// References returns the service registries used by the pools.
+func (s *WebSocketProxySpec) References() []string {
+	var names []string
+	for _, pool := range s.Pools {
+		names = append(names, pool.ServiceRegistry)
+	}
+	return names
+}
+
 // Validate validates Spec.
 func (s *WebSocketProxySpec) Validate() error {
 	numMainPool := 0
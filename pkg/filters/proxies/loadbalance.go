@@ -21,11 +21,15 @@ import (
 	"fmt"
 	"hash/fnv"
 	"math/rand"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/buraksezer/consistent"
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/protocols"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
 )
 
 const (
@@ -42,6 +46,17 @@ const (
 	// LoadBalancePolicyCookieHash is the load balance policy of HTTP cookie hash,
 	// which is the shorthand of headerHash with hash key Set-Cookie.
 	LoadBalancePolicyCookieHash = "cookieHash"
+	// LoadBalancePolicyLeastConnections is the load balance policy of least
+	// in-flight requests.
+	LoadBalancePolicyLeastConnections = "leastConnections"
+	// LoadBalancePolicyRingHash is the load balance policy of consistent hash
+	// on a header, a cookie or the client IP.
+	LoadBalancePolicyRingHash = "ringHash"
+	// LoadBalancePolicyEWMA is the load balance policy of the least EWMA
+	// latency weighted by in-flight requests.
+	LoadBalancePolicyEWMA = "ewma"
+
+	defaultEWMADecay = 10 * time.Second
 )
 
 // LoadBalancer is the interface of a load balancer.
@@ -64,6 +79,36 @@ type LoadBalanceSpec struct {
 	// Deprecated: HealthCheck is protocol related. It should be moved to protocol spec.
 	// This one is kept for backward compatibility.
 	HealthCheck *HealthCheckSpec `json:"healthCheck,omitempty"`
+	// CookieHashKey is the cookie name used by ringHash.
+	CookieHashKey string `json:"cookieHashKey,omitempty"`
+	// EWMADecay is the time for the weight of a latency sample to decay to
+	// about 37% (1/e) in the ewma policy.
+	EWMADecay string `json:"ewmaDecay,omitempty" jsonschema:"format=duration"`
+	// OutlierDetection ejects servers failing on live traffic.
+	OutlierDetection *OutlierDetectionSpec `json:"outlierDetection,omitempty"`
+}
+
+// LoadBalanceStatus is the status of a load balancer.
+type LoadBalanceStatus struct {
+	Policy  string          `json:"policy"`
+	Servers []*ServerStatus `json:"servers"`
+}
+
+// ServerStatus is the status of a server in the load balancer.
+type ServerStatus struct {
+	URL        string `json:"url"`
+	Healthy    bool   `json:"healthy"`
+	Inflight   int64  `json:"inflight"`
+	Selections uint64 `json:"selections"`
+	// EWMALatency is the EWMA latency in milliseconds.
+	EWMALatency float64 `json:"ewmaLatency,omitempty"`
+	Ejected     bool    `json:"ejected,omitempty"`
+}
+
+// attemptKey identifies the sending of a request to a server.
+type attemptKey struct {
+	req    protocols.Request
+	server *Server
 }
 
 // LoadBalancePolicy is the interface of a load balance policy.
@@ -83,6 +128,18 @@ type GeneralLoadBalancer struct {
 	ss     SessionSticker
 	hc     HealthChecker
 	hcSpec *HealthCheckSpec
+
+	// startTimes saves the time the servers are chosen for requests, keyed
+	// by attemptKey as a request may be sent to several servers, like the
+	// hedged requests. It is only used when the latency of servers need to
+	// be observed.
+	ewmaDecay  time.Duration
+	startTimes sync.Map
+
+	// mu protects the updating of healthyServers.
+	mu            sync.Mutex
+	od            *outlierDetector
+	nextReinstate int64
 }
 
 // NewGeneralLoadBalancer creates a new GeneralLoadBalancer.
@@ -116,6 +173,16 @@ func (glb *GeneralLoadBalancer) Init(
 			lbp = &HeaderHashLoadBalancePolicy{spec: glb.spec}
 		case LoadBalancePolicyCookieHash:
 			lbp = &HeaderHashLoadBalancePolicy{spec: &LoadBalanceSpec{HeaderHashKey: "Cookie"}}
+		case LoadBalancePolicyLeastConnections:
+			lbp = &LeastConnectionsLoadBalancePolicy{}
+		case LoadBalancePolicyRingHash:
+			lbp = &RingHashLoadBalancePolicy{spec: glb.spec}
+		case LoadBalancePolicyEWMA:
+			lbp = &EWMALoadBalancePolicy{}
+			glb.ewmaDecay, _ = time.ParseDuration(glb.spec.EWMADecay)
+			if glb.ewmaDecay <= 0 {
+				glb.ewmaDecay = defaultEWMADecay
+			}
 		default:
 			logger.Errorf("unsupported load balancing policy: %s", glb.spec.Policy)
 			lbp = &RoundRobinLoadBalancePolicy{}
@@ -123,6 +190,10 @@ func (glb *GeneralLoadBalancer) Init(
 	}
 	glb.lbp = lbp
 
+	if glb.spec.OutlierDetection != nil {
+		glb.od = newOutlierDetector(glb.spec.OutlierDetection)
+	}
+
 	// sticky session
 	if glb.spec.StickySession != nil {
 		ss := fnNewSessionSticker(glb.spec.StickySession)
@@ -161,12 +232,17 @@ func (glb *GeneralLoadBalancer) Init(
 }
 
 func (glb *GeneralLoadBalancer) checkServers() {
-	changed := false
+	results := make([]bool, len(glb.servers))
+	for i, svr := range glb.servers {
+		results[i] = glb.hc.Check(svr)
+	}
 
-	servers := make([]*Server, 0, len(glb.servers))
-	for _, svr := range glb.servers {
-		succ := glb.hc.Check(svr)
-		if succ {
+	glb.mu.Lock()
+	defer glb.mu.Unlock()
+
+	changed := false
+	for i, svr := range glb.servers {
+		if results[i] {
 			if svr.HealthCounter < 0 {
 				svr.HealthCounter = 0
 			}
@@ -187,14 +263,21 @@ func (glb *GeneralLoadBalancer) checkServers() {
 				changed = true
 			}
 		}
+	}
 
-		if svr.Healthy() {
-			servers = append(servers, svr)
-		}
+	if changed {
+		glb.updateHealthyServers()
 	}
+}
 
-	if !changed {
-		return
+// updateHealthyServers updates the servers available to the load balance
+// policy, the caller must hold glb.mu.
+func (glb *GeneralLoadBalancer) updateHealthyServers() {
+	servers := make([]*Server, 0, len(glb.servers))
+	for _, svr := range glb.servers {
+		if svr.Healthy() && !svr.Ejected() {
+			servers = append(servers, svr)
+		}
 	}
 
 	glb.healthyServers.Store(newServerGroup(servers))
@@ -205,27 +288,128 @@ func (glb *GeneralLoadBalancer) checkServers() {
 
 // ChooseServer chooses a server according to the load balancing spec.
 func (glb *GeneralLoadBalancer) ChooseServer(req protocols.Request) *Server {
+	if glb.od != nil {
+		glb.reinstateServers()
+	}
+
 	sg := glb.healthyServers.Load()
 	if sg == nil || len(sg.Servers) == 0 {
 		return nil
 	}
 
+	var svr *Server
 	if glb.ss != nil {
-		if svr := glb.ss.GetServer(req, sg); svr != nil {
-			return svr
+		svr = glb.ss.GetServer(req, sg)
+	}
+	if svr == nil {
+		svr = glb.lbp.ChooseServer(req, sg)
+	}
+
+	glb.acquire(svr, req)
+	return svr
+}
+
+// ChooseServerExcept chooses a server other than except for a duplicate
+// of a request, like a hedged request, the sticky session is ignored. It
+// returns nil if there is no other server.
+func (glb *GeneralLoadBalancer) ChooseServerExcept(req protocols.Request, except *Server) *Server {
+	sg := glb.healthyServers.Load()
+	if sg == nil || len(sg.Servers) == 0 {
+		return nil
+	}
+
+	svr := glb.lbp.ChooseServer(req, sg)
+	if svr == except {
+		// policies like the hashing ones always choose the same server
+		// for a request, take the next one.
+		for i, s := range sg.Servers {
+			if s == except {
+				svr = sg.Servers[(i+1)%len(sg.Servers)]
+				break
+			}
+		}
+		if svr == except {
+			return nil
 		}
 	}
 
-	return glb.lbp.ChooseServer(req, sg)
+	glb.acquire(svr, req)
+	return svr
+}
+
+func (glb *GeneralLoadBalancer) acquire(svr *Server, req protocols.Request) {
+	atomic.AddInt64(&svr.inflight, 1)
+	atomic.AddUint64(&svr.selections, 1)
+	if glb.trackLatency() && req != nil {
+		glb.startTimes.Store(attemptKey{req, svr}, fasttime.Now())
+	}
+}
+
+// ReleaseServer returns a server chosen for a request which is cancelled
+// by Easegress, like the slower ones of the hedged requests, the latency
+// and the result are not observed as they say nothing about the server.
+func (glb *GeneralLoadBalancer) ReleaseServer(server *Server, req protocols.Request) {
+	atomic.AddInt64(&server.inflight, -1)
+	if req != nil {
+		glb.startTimes.Delete(attemptKey{req, server})
+	}
 }
 
-// ReturnServer returns a server to the load balancer.
+// ReturnServer returns a server to the load balancer, it must be called
+// for every server returned by ChooseServer, resp is nil if the request
+// failed.
 func (glb *GeneralLoadBalancer) ReturnServer(server *Server, req protocols.Request, resp protocols.Response) {
-	if glb.ss != nil {
+	atomic.AddInt64(&server.inflight, -1)
+
+	var latency time.Duration
+	if glb.trackLatency() && req != nil {
+		if v, ok := glb.startTimes.LoadAndDelete(attemptKey{req, server}); ok {
+			latency = fasttime.Since(v.(time.Time))
+		}
+	}
+	if glb.ewmaDecay > 0 && latency > 0 {
+		server.observeLatency(latency, glb.ewmaDecay)
+	}
+	if glb.od != nil {
+		glb.observeResult(server, req, resp, latency)
+	}
+
+	if glb.ss != nil && resp != nil {
 		glb.ss.ReturnServer(server, req, resp)
 	}
 }
 
+func (glb *GeneralLoadBalancer) trackLatency() bool {
+	return glb.ewmaDecay > 0 || (glb.od != nil && glb.od.latencyThreshold > 0)
+}
+
+// Status returns the status of the load balancer.
+func (glb *GeneralLoadBalancer) Status() *LoadBalanceStatus {
+	policy := glb.spec.Policy
+	if policy == "" {
+		policy = LoadBalancePolicyRoundRobin
+	}
+
+	glb.mu.Lock()
+	defer glb.mu.Unlock()
+
+	s := &LoadBalanceStatus{
+		Policy:  policy,
+		Servers: make([]*ServerStatus, 0, len(glb.servers)),
+	}
+	for _, svr := range glb.servers {
+		s.Servers = append(s.Servers, &ServerStatus{
+			URL:         svr.URL,
+			Healthy:     svr.Healthy(),
+			Inflight:    svr.Inflight(),
+			Selections:  svr.Selections(),
+			EWMALatency: float64(svr.EWMALatency()) / float64(time.Millisecond),
+			Ejected:     svr.Ejected(),
+		})
+	}
+	return s
+}
+
 // Close closes the load balancer
 func (glb *GeneralLoadBalancer) Close() {
 	if glb.hc != nil {
@@ -299,3 +483,117 @@ func (lbp *HeaderHashLoadBalancePolicy) ChooseServer(req protocols.Request, sg *
 	hash.Write([]byte(v))
 	return sg.Servers[hash.Sum32()%uint32(len(sg.Servers))]
 }
+
+// LeastConnectionsLoadBalancePolicy is a load balance policy that chooses the
+// server with the least in-flight requests.
+type LeastConnectionsLoadBalancePolicy struct {
+	counter uint64
+}
+
+// ChooseServer chooses the server with the least in-flight requests, servers
+// with the same number of requests are chosen by round robin.
+func (lbp *LeastConnectionsLoadBalancePolicy) ChooseServer(req protocols.Request, sg *ServerGroup) *Server {
+	n := len(sg.Servers)
+	start := int(atomic.AddUint64(&lbp.counter, 1) % uint64(n))
+
+	var chosen *Server
+	for i := 0; i < n; i++ {
+		svr := sg.Servers[(start+i)%n]
+		if chosen == nil || svr.Inflight() < chosen.Inflight() {
+			chosen = svr
+		}
+	}
+	return chosen
+}
+
+// RingHashLoadBalancePolicy is a load balance policy that chooses a server by
+// consistent hash, so that only a small part of the keys are remapped when
+// servers are added or removed.
+type RingHashLoadBalancePolicy struct {
+	spec *LoadBalanceSpec
+	ring atomic.Pointer[hashRing]
+}
+
+type hashRing struct {
+	sg         *ServerGroup
+	consistent *consistent.Consistent
+}
+
+func (lbp *RingHashLoadBalancePolicy) hashKey(req protocols.Request) string {
+	if key := lbp.spec.HeaderHashKey; key != "" {
+		if v, ok := req.Header().Get(key).(string); ok && v != "" {
+			return v
+		}
+	}
+
+	if key := lbp.spec.CookieHashKey; key != "" {
+		if httpreq, ok := req.(*httpprot.Request); ok {
+			if c, err := httpreq.Cookie(key); err == nil && c.Value != "" {
+				return c.Value
+			}
+		}
+	}
+
+	return req.RealIP()
+}
+
+// ChooseServer chooses a server by consistent hash on the header, the cookie
+// or the client IP, in this order.
+func (lbp *RingHashLoadBalancePolicy) ChooseServer(req protocols.Request, sg *ServerGroup) *Server {
+	ring := lbp.ring.Load()
+
+	// the healthy servers are changed, rebuild the ring.
+	if ring == nil || ring.sg != sg {
+		members := make([]consistent.Member, len(sg.Servers))
+		for i, s := range sg.Servers {
+			members[i] = hashMember{server: s}
+		}
+
+		cfg := consistent.Config{
+			PartitionCount:    1024,
+			ReplicationFactor: 50,
+			Load:              1.25,
+			Hasher:            hasher{},
+		}
+
+		ring = &hashRing{sg: sg, consistent: consistent.New(members, cfg)}
+		lbp.ring.Store(ring)
+	}
+
+	return ring.consistent.LocateKey([]byte(lbp.hashKey(req))).(hashMember).server
+}
+
+// EWMALoadBalancePolicy is a load balance policy that chooses a server by
+// the power of two random choices, the one with the lower EWMA latency
+// weighted by in-flight requests is chosen.
+type EWMALoadBalancePolicy struct{}
+
+func ewmaScore(svr *Server) float64 {
+	latency := svr.EWMALatency()
+	if latency == 0 {
+		// servers without latency samples are preferred, so that they
+		// can get samples quickly.
+		return float64(svr.Inflight())
+	}
+	return float64(latency) * float64(svr.Inflight()+1)
+}
+
+// ChooseServer chooses a server by EWMA latency.
+func (lbp *EWMALoadBalancePolicy) ChooseServer(req protocols.Request, sg *ServerGroup) *Server {
+	n := len(sg.Servers)
+	if n == 1 {
+		return sg.Servers[0]
+	}
+
+	i := rand.Intn(n)
+	j := rand.Intn(n - 1)
+	if j >= i {
+		j++
+	}
+
+	a, b := sg.Servers[i], sg.Servers[j]
+	if ewmaScore(b) < ewmaScore(a) {
+		return b
+	}
+	return a
+}
@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"os"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -66,6 +67,7 @@ func TestGeneralLoadBalancer(t *testing.T) {
 	wg.Wait()
 	time.Sleep(20 * time.Millisecond)
 	assert.Equal(t, len(lb.healthyServers.Load().Servers), 0)
+	assert.False(t, lb.Status().Servers[0].Healthy)
 
 	lb.Close()
 
@@ -78,6 +80,7 @@ func TestGeneralLoadBalancer(t *testing.T) {
 	wg.Wait()
 	time.Sleep(20 * time.Millisecond)
 	assert.Equal(t, len(lb.healthyServers.Load().Servers), 10)
+	assert.True(t, lb.Status().Servers[0].Healthy)
 	lb.Close()
 }
 
@@ -180,3 +183,162 @@ func TestHeaderHashLoadBalancePolicy(t *testing.T) {
 		assert.GreaterOrEqual(t, counter[i], 1)
 	}
 }
+
+func TestLeastConnectionsLoadBalancePolicy(t *testing.T) {
+	assert := assert.New(t)
+	servers := prepareServers(3)
+
+	lb := NewGeneralLoadBalancer(&LoadBalanceSpec{Policy: LoadBalancePolicyLeastConnections}, servers)
+	lb.Init(nil, nil, nil)
+
+	chosen := map[*Server]bool{}
+	for i := 0; i < 3; i++ {
+		chosen[lb.ChooseServer(nil)] = true
+	}
+	assert.Len(chosen, 3)
+
+	// servers[1] finishes its request, and should be chosen next.
+	lb.ReturnServer(servers[1], nil, nil)
+	assert.Equal(servers[1], lb.ChooseServer(nil))
+
+	lb.ReturnServer(servers[0], nil, nil)
+	lb.ReturnServer(servers[0], nil, nil)
+	assert.Equal(servers[0], lb.ChooseServer(nil))
+	assert.Equal(servers[0], lb.ChooseServer(nil))
+
+	status := lb.Status()
+	assert.Equal(LoadBalancePolicyLeastConnections, status.Policy)
+	assert.Equal(int64(1), status.Servers[0].Inflight)
+	assert.Equal(uint64(3), status.Servers[0].Selections)
+	assert.True(status.Servers[0].Healthy)
+}
+
+func TestChooseServerExcept(t *testing.T) {
+	assert := assert.New(t)
+	servers := prepareServers(3)
+
+	lb := NewGeneralLoadBalancer(&LoadBalanceSpec{Policy: LoadBalancePolicyIPHash}, servers)
+	lb.Init(nil, nil, nil)
+
+	stdr := &http.Request{Header: http.Header{}, RemoteAddr: "192.168.1.1:8080"}
+	req, _ := httpprot.NewRequest(stdr)
+	svr := lb.ChooseServer(req)
+	for i := 0; i < 10; i++ {
+		other := lb.ChooseServerExcept(req, svr)
+		assert.NotNil(other)
+		assert.NotEqual(svr, other)
+		lb.ReleaseServer(other, req)
+	}
+	lb.ReleaseServer(svr, req)
+
+	for _, s := range lb.Status().Servers {
+		assert.Equal(int64(0), s.Inflight)
+	}
+
+	lb = NewGeneralLoadBalancer(&LoadBalanceSpec{}, servers[:1])
+	lb.Init(nil, nil, nil)
+	assert.Nil(lb.ChooseServerExcept(req, servers[0]))
+}
+
+func TestRingHashLoadBalancePolicy(t *testing.T) {
+	assert := assert.New(t)
+	servers := prepareServers(10)
+
+	spec := &LoadBalanceSpec{
+		Policy:        LoadBalancePolicyRingHash,
+		HeaderHashKey: "X-User",
+		CookieHashKey: "session",
+	}
+	lb := NewGeneralLoadBalancer(spec, servers)
+	lb.Init(nil, nil, nil)
+
+	newRequest := func(header, cookie, ip string) *httpprot.Request {
+		stdr := &http.Request{Header: http.Header{}}
+		if header != "" {
+			stdr.Header.Set("X-User", header)
+		}
+		if cookie != "" {
+			stdr.AddCookie(&http.Cookie{Name: "session", Value: cookie})
+		}
+		stdr.Header.Set("X-Real-Ip", ip)
+		r, _ := httpprot.NewRequest(stdr)
+		return r
+	}
+
+	counter := map[*Server]int{}
+	mapping := map[string]*Server{}
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		svr := lb.ChooseServer(newRequest(key, "", "10.0.0.1"))
+		counter[svr]++
+		mapping[key] = svr
+		assert.Equal(svr, lb.ChooseServer(newRequest(key, "", "10.0.0.2")))
+	}
+	assert.Len(counter, 10)
+
+	// cookie and client IP are used if the header is missing.
+	svr := lb.ChooseServer(newRequest("", "abc", "10.0.0.1"))
+	assert.Equal(svr, lb.ChooseServer(newRequest("", "abc", "10.0.0.2")))
+	svr = lb.ChooseServer(newRequest("", "", "10.0.0.1"))
+	assert.Equal(svr, lb.ChooseServer(newRequest("", "", "10.0.0.1")))
+
+	// remove a server, only keys mapped to it should be remapped.
+	removed := servers[3]
+	lb.healthyServers.Store(newServerGroup(append(append([]*Server{}, servers[:3]...), servers[4:]...)))
+	for key, old := range mapping {
+		svr := lb.ChooseServer(newRequest(key, "", "10.0.0.1"))
+		if old != removed {
+			assert.Equal(old, svr)
+		} else {
+			assert.NotEqual(removed, svr)
+		}
+	}
+}
+
+func TestEWMALoadBalancePolicy(t *testing.T) {
+	assert := assert.New(t)
+	servers := prepareServers(2)
+
+	lb := NewGeneralLoadBalancer(&LoadBalanceSpec{Policy: LoadBalancePolicyEWMA, EWMADecay: "1s"}, servers)
+	lb.Init(nil, nil, nil)
+	assert.Equal(time.Second, lb.ewmaDecay)
+
+	servers[0].observeLatency(100*time.Millisecond, lb.ewmaDecay)
+	servers[1].observeLatency(10*time.Millisecond, lb.ewmaDecay)
+	assert.Equal(100*time.Millisecond, servers[0].EWMALatency())
+
+	counter := map[*Server]int{}
+	for i := 0; i < 100; i++ {
+		svr := lb.ChooseServer(nil)
+		counter[svr]++
+		lb.ReturnServer(svr, nil, nil)
+	}
+	assert.Equal(100, counter[servers[1]])
+
+	// the latency is observed between choosing and returning the server.
+	stdr := &http.Request{Header: http.Header{}}
+	req, _ := httpprot.NewRequest(stdr)
+	svr := lb.ChooseServer(req)
+	time.Sleep(50 * time.Millisecond)
+	lb.ReturnServer(svr, req, nil)
+	assert.Greater(svr.EWMALatency(), 10*time.Millisecond)
+	assert.Less(svr.EWMALatency(), 100*time.Millisecond)
+
+	// the history decays.
+	servers[0].observeLatency(time.Millisecond, lb.ewmaDecay)
+	assert.Less(servers[0].EWMALatency(), 100*time.Millisecond)
+	assert.Greater(lb.Status().Servers[0].EWMALatency, 1.0)
+
+	// the attempts of a request to different servers are observed
+	// separately.
+	for _, svr := range servers {
+		atomic.AddInt64(&svr.inflight, 1)
+		lb.startTimes.Store(attemptKey{req, svr}, time.Now())
+	}
+	lb.ReturnServer(servers[1], req, nil)
+	_, ok := lb.startTimes.Load(attemptKey{req, servers[0]})
+	assert.True(ok)
+	lb.ReturnServer(servers[0], req, nil)
+	_, ok = lb.startTimes.Load(attemptKey{req, servers[0]})
+	assert.False(ok)
+}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxies
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols"
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
+)
+
+// OutlierDetectionSpec is the spec of outlier detection, which ejects
+// servers from the load balancer temporarily according to the results of
+// live traffic.
+type OutlierDetectionSpec struct {
+	// ConsecutiveFailures is the number of consecutive failures to eject a
+	// server, default is 5. A request fails if it gets no response, or the
+	// status code is 5xx, or its latency exceeds LatencyThreshold.
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty" jsonschema:"minimum=1"`
+	// LatencyThreshold is the latency to count a request as a failure, zero
+	// means latency is not checked.
+	LatencyThreshold string `json:"latencyThreshold,omitempty" jsonschema:"format=duration"`
+	// BaseEjectionTime is the ejection time of the first ejection, it is
+	// doubled on each ejection after that, default is 30s.
+	BaseEjectionTime string `json:"baseEjectionTime,omitempty" jsonschema:"format=duration"`
+	// MaxEjectionTime is the max ejection time, default is 300s.
+	MaxEjectionTime string `json:"maxEjectionTime,omitempty" jsonschema:"format=duration"`
+	// MaxEjectionPercent is the max percent of servers can be ejected at
+	// the same time, default is 50.
+	MaxEjectionPercent int `json:"maxEjectionPercent,omitempty" jsonschema:"minimum=1,maximum=100"`
+}
+
+type outlierDetector struct {
+	consecutiveFailures int32
+	latencyThreshold    time.Duration
+	baseEjectionTime    time.Duration
+	maxEjectionTime     time.Duration
+	maxEjectionPercent  int
+}
+
+func newOutlierDetector(spec *OutlierDetectionSpec) *outlierDetector {
+	od := &outlierDetector{
+		consecutiveFailures: int32(spec.ConsecutiveFailures),
+		maxEjectionPercent:  spec.MaxEjectionPercent,
+	}
+	od.latencyThreshold, _ = time.ParseDuration(spec.LatencyThreshold)
+	od.baseEjectionTime, _ = time.ParseDuration(spec.BaseEjectionTime)
+	od.maxEjectionTime, _ = time.ParseDuration(spec.MaxEjectionTime)
+
+	if od.consecutiveFailures <= 0 {
+		od.consecutiveFailures = 5
+	}
+	if od.baseEjectionTime <= 0 {
+		od.baseEjectionTime = 30 * time.Second
+	}
+	if od.maxEjectionTime <= 0 {
+		od.maxEjectionTime = 300 * time.Second
+	}
+	if od.maxEjectionTime < od.baseEjectionTime {
+		od.maxEjectionTime = od.baseEjectionTime
+	}
+	if od.maxEjectionPercent <= 0 {
+		od.maxEjectionPercent = 50
+	}
+	return od
+}
+
+// ejectionTime returns the ejection time of the nth ejection.
+func (od *outlierDetector) ejectionTime(n int32) time.Duration {
+	d := od.baseEjectionTime
+	for i := int32(1); i < n && d < od.maxEjectionTime; i++ {
+		d *= 2
+	}
+	if d > od.maxEjectionTime {
+		d = od.maxEjectionTime
+	}
+	return d
+}
+
+func (od *outlierDetector) isFailure(req protocols.Request, resp protocols.Response, latency time.Duration) bool {
+	if resp == nil {
+		// the client gives up the request, it is not the fault of the
+		// server.
+		if r, ok := req.(interface{ Context() context.Context }); ok {
+			if r.Context().Err() == context.Canceled {
+				return false
+			}
+		}
+		return true
+	}
+
+	if r, ok := resp.(interface{ StatusCode() int }); ok && r.StatusCode() >= 500 {
+		return true
+	}
+
+	return od.latencyThreshold > 0 && latency > od.latencyThreshold
+}
+
+// Ejected returns whether the server is ejected by outlier detection.
+func (s *Server) Ejected() bool {
+	return fasttime.NowUnixNano() < atomic.LoadInt64(&s.ejectedUntil)
+}
+
+// observeResult updates the outlier state of the server by the result of a
+// request, and ejects the server if it becomes an outlier.
+func (glb *GeneralLoadBalancer) observeResult(svr *Server, req protocols.Request, resp protocols.Response, latency time.Duration) {
+	od := glb.od
+	if !od.isFailure(req, resp, latency) {
+		atomic.StoreInt32(&svr.consecutiveFailures, 0)
+
+		// the server has been working well for a long time after its last
+		// ejection, forget the ejection history.
+		until := atomic.LoadInt64(&svr.ejectedUntil)
+		if until != 0 && fasttime.NowUnixNano()-until > int64(od.maxEjectionTime) {
+			atomic.StoreInt32(&svr.ejections, 0)
+			atomic.StoreInt64(&svr.ejectedUntil, 0)
+		}
+		return
+	}
+
+	if atomic.AddInt32(&svr.consecutiveFailures, 1) < od.consecutiveFailures {
+		return
+	}
+
+	glb.mu.Lock()
+	defer glb.mu.Unlock()
+
+	// the server may have been ejected by requests in parallel.
+	if svr.Ejected() || atomic.LoadInt32(&svr.consecutiveFailures) < od.consecutiveFailures {
+		return
+	}
+	atomic.StoreInt32(&svr.consecutiveFailures, 0)
+
+	ejected := 0
+	for _, s := range glb.servers {
+		if s.Ejected() {
+			ejected++
+		}
+	}
+	if (ejected+1)*100 > od.maxEjectionPercent*len(glb.servers) {
+		logger.Warnf("server:%v is an outlier, but max ejection percent is reached", svr.ID())
+		return
+	}
+
+	d := od.ejectionTime(atomic.AddInt32(&svr.ejections, 1))
+	until := fasttime.Now().Add(d).UnixNano()
+	atomic.StoreInt64(&svr.ejectedUntil, until)
+	logger.Warnf("server:%v is ejected for %v as an outlier.", svr.ID(), d)
+
+	if next := atomic.LoadInt64(&glb.nextReinstate); next == 0 || until < next {
+		atomic.StoreInt64(&glb.nextReinstate, until)
+	}
+	glb.updateHealthyServers()
+}
+
+// reinstateServers adds servers whose ejection time is over back to the
+// load balancer.
+func (glb *GeneralLoadBalancer) reinstateServers() {
+	next := atomic.LoadInt64(&glb.nextReinstate)
+	if next == 0 || fasttime.NowUnixNano() < next {
+		return
+	}
+
+	glb.mu.Lock()
+	defer glb.mu.Unlock()
+
+	// check again as other goroutines may have done this.
+	next = atomic.LoadInt64(&glb.nextReinstate)
+	now := fasttime.NowUnixNano()
+	if next == 0 || now < next {
+		return
+	}
+
+	next = 0
+	for _, s := range glb.servers {
+		until := atomic.LoadInt64(&s.ejectedUntil)
+		if until > now && (next == 0 || until < next) {
+			next = until
+		}
+	}
+	atomic.StoreInt64(&glb.nextReinstate, next)
+	glb.updateHealthyServers()
+}
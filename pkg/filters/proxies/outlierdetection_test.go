@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxies
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutlierDetector(t *testing.T) {
+	assert := assert.New(t)
+
+	od := newOutlierDetector(&OutlierDetectionSpec{})
+	assert.Equal(int32(5), od.consecutiveFailures)
+	assert.Equal(30*time.Second, od.ejectionTime(1))
+	assert.Equal(60*time.Second, od.ejectionTime(2))
+	assert.Equal(240*time.Second, od.ejectionTime(4))
+	assert.Equal(300*time.Second, od.ejectionTime(5))
+	assert.Equal(300*time.Second, od.ejectionTime(100))
+
+	od = newOutlierDetector(&OutlierDetectionSpec{LatencyThreshold: "100ms"})
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://a.com", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	resp, _ := httpprot.NewResponse(nil)
+
+	assert.False(od.isFailure(req, resp, 10*time.Millisecond))
+	assert.True(od.isFailure(req, resp, time.Second))
+	assert.True(od.isFailure(req, nil, 0))
+	resp.SetStatusCode(http.StatusBadGateway)
+	assert.True(od.isFailure(req, resp, 0))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ = httpprot.NewRequest(stdr.WithContext(ctx))
+	assert.False(od.isFailure(req, nil, 0))
+}
+
+func TestOutlierDetection(t *testing.T) {
+	assert := assert.New(t)
+	servers := prepareServers(4)
+
+	spec := &LoadBalanceSpec{
+		Policy: LoadBalancePolicyRoundRobin,
+		OutlierDetection: &OutlierDetectionSpec{
+			ConsecutiveFailures: 2,
+			BaseEjectionTime:    "100ms",
+			MaxEjectionTime:     "1s",
+		},
+	}
+	lb := NewGeneralLoadBalancer(spec, servers)
+	lb.Init(nil, nil, nil)
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://a.com", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	ok, _ := httpprot.NewResponse(nil)
+
+	fail := func(svr *Server, n int) {
+		for i := 0; i < n; i++ {
+			lb.ReturnServer(svr, req, nil)
+		}
+	}
+
+	// a success resets the consecutive failures.
+	fail(servers[0], 1)
+	lb.ReturnServer(servers[0], req, ok)
+	fail(servers[0], 1)
+	assert.False(servers[0].Ejected())
+
+	fail(servers[0], 1)
+	assert.True(servers[0].Ejected())
+	assert.Len(lb.healthyServers.Load().Servers, 3)
+	assert.True(lb.Status().Servers[0].Ejected)
+	for i := 0; i < 6; i++ {
+		assert.NotEqual(servers[0], lb.ChooseServer(req))
+	}
+
+	// at most 50% of the servers can be ejected.
+	fail(servers[1], 2)
+	fail(servers[2], 2)
+	assert.True(servers[1].Ejected())
+	assert.False(servers[2].Ejected())
+	assert.Len(lb.healthyServers.Load().Servers, 2)
+
+	// servers are reinstated after the ejection time.
+	time.Sleep(150 * time.Millisecond)
+	lb.ChooseServer(req)
+	assert.Len(lb.healthyServers.Load().Servers, 4)
+	assert.Equal(int64(0), lb.nextReinstate)
+
+	// the ejection time grows exponentially.
+	fail(servers[0], 2)
+	assert.True(servers[0].Ejected())
+	time.Sleep(150 * time.Millisecond)
+	assert.True(servers[0].Ejected())
+	time.Sleep(100 * time.Millisecond)
+	assert.False(servers[0].Ejected())
+	lb.ChooseServer(req)
+	assert.Len(lb.healthyServers.Load().Servers, 4)
+}
@@ -19,9 +19,14 @@ package proxies
 
 import (
 	"fmt"
+	"math"
 	"net"
 	"net/url"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
 )
 
 // Server is a backend proxy server.
@@ -35,6 +40,18 @@ type Server struct {
 	// HealthCounter is used to count the number of successive health checks
 	// result, positive for healthy, negative for unhealthy
 	HealthCounter int `json:"-"`
+
+	// runtime statistics used by load balance policies, they are updated
+	// atomically.
+	inflight   int64
+	selections uint64
+	ewma       uint64 // math.Float64bits of the EWMA latency in nanoseconds
+	ewmaStamp  int64
+
+	// outlier detection states.
+	consecutiveFailures int32
+	ejections           int32
+	ejectedUntil        int64
 }
 
 // String implements the Stringer interface.
@@ -77,6 +94,45 @@ func (s *Server) Healthy() bool {
 	return !s.Unhealth
 }
 
+// Inflight returns the number of requests being processed by the server.
+func (s *Server) Inflight() int64 {
+	return atomic.LoadInt64(&s.inflight)
+}
+
+// Selections returns the number of times the server has been selected.
+func (s *Server) Selections() uint64 {
+	return atomic.LoadUint64(&s.selections)
+}
+
+// EWMALatency returns the exponentially weighted moving average of the
+// latency of the server, zero means no latency has been observed.
+func (s *Server) EWMALatency() time.Duration {
+	return time.Duration(math.Float64frombits(atomic.LoadUint64(&s.ewma)))
+}
+
+// observeLatency updates the EWMA latency, the weight of the history decays
+// exponentially by the time elapsed since the last update.
+func (s *Server) observeLatency(latency, decay time.Duration) {
+	now := fasttime.NowUnixNano()
+	last := atomic.SwapInt64(&s.ewmaStamp, now)
+
+	for {
+		old := atomic.LoadUint64(&s.ewma)
+		value := float64(latency)
+		if old != 0 {
+			elapsed := float64(now - last)
+			if elapsed < 0 {
+				elapsed = 0
+			}
+			w := math.Exp(-elapsed / float64(decay))
+			value = math.Float64frombits(old)*w + value*(1-w)
+		}
+		if atomic.CompareAndSwapUint64(&s.ewma, old, math.Float64bits(value)) {
+			return
+		}
+	}
+}
+
 // ServerGroup is a group of servers.
 type ServerGroup struct {
 	TotalWeight int
@@ -36,6 +36,8 @@ import (
 const (
 	// StickySessionModeCookieConsistentHash is the sticky session mode of consistent hash on app cookie.
 	StickySessionModeCookieConsistentHash = "CookieConsistentHash"
+	// StickySessionModeHeaderConsistentHash is the sticky session mode of consistent hash on a header.
+	StickySessionModeHeaderConsistentHash = "HeaderConsistentHash"
 	// StickySessionModeDurationBased uses a load balancer-generated cookie for stickiness.
 	StickySessionModeDurationBased = "DurationBased"
 	// StickySessionModeApplicationBased uses a load balancer-generated cookie depends on app cookie for stickiness.
@@ -50,9 +52,11 @@ const (
 
 // StickySessionSpec is the spec for sticky session.
 type StickySessionSpec struct {
-	Mode string `json:"mode" jsonschema:"required,enum=CookieConsistentHash,enum=DurationBased,enum=ApplicationBased"`
+	Mode string `json:"mode" jsonschema:"required,enum=CookieConsistentHash,enum=HeaderConsistentHash,enum=DurationBased,enum=ApplicationBased"`
 	// AppCookieName is the user-defined cookie name in CookieConsistentHash and ApplicationBased mode.
 	AppCookieName string `json:"appCookieName,omitempty"`
+	// HeaderName is the name of the header in HeaderConsistentHash mode.
+	HeaderName string `json:"headerName,omitempty"`
 	// LBCookieName is the generated cookie name in DurationBased and ApplicationBased mode.
 	LBCookieName string `json:"lbCookieName,omitempty"`
 	// LBCookieExpire is the expire seconds of generated cookie in DurationBased and ApplicationBased mode.
@@ -110,7 +114,9 @@ func NewHTTPSessionSticker(spec *StickySessionSpec) SessionSticker {
 
 // UpdateServers update the servers for the HTTPSessionSticker.
 func (ss *HTTPSessionSticker) UpdateServers(servers []*Server) {
-	if ss.spec.Mode != StickySessionModeCookieConsistentHash {
+	switch ss.spec.Mode {
+	case StickySessionModeCookieConsistentHash, StickySessionModeHeaderConsistentHash:
+	default:
 		return
 	}
 
@@ -135,12 +141,19 @@ func (ss *HTTPSessionSticker) UpdateServers(servers []*Server) {
 }
 
 func (ss *HTTPSessionSticker) getServerByConsistentHash(req *httpprot.Request) *Server {
-	cookie, err := req.Cookie(ss.spec.AppCookieName)
-	if err != nil {
+	var key string
+	if ss.spec.Mode == StickySessionModeHeaderConsistentHash {
+		key = req.HTTPHeader().Get(ss.spec.HeaderName)
+	} else if cookie, err := req.Cookie(ss.spec.AppCookieName); err == nil {
+		key = cookie.Value
+	}
+
+	// the session is not identified, let the load balance policy choose.
+	if key == "" {
 		return nil
 	}
 
-	m := ss.consistentHash.Load().LocateKey([]byte(cookie.Value))
+	m := ss.consistentHash.Load().LocateKey([]byte(key))
 	if m != nil {
 		return m.(hashMember).server
 	}
@@ -181,7 +194,7 @@ func (ss *HTTPSessionSticker) GetServer(req protocols.Request, sg *ServerGroup)
 	}
 
 	switch ss.spec.Mode {
-	case StickySessionModeCookieConsistentHash:
+	case StickySessionModeCookieConsistentHash, StickySessionModeHeaderConsistentHash:
 		return ss.getServerByConsistentHash(httpreq)
 	case StickySessionModeDurationBased, StickySessionModeApplicationBased:
 		return ss.getServerByLBCookie(httpreq, sg)
@@ -229,6 +242,7 @@ func (ss *HTTPSessionSticker) ReturnServer(server *Server, req protocols.Request
 		cookie := &http.Cookie{
 			Name:    ss.spec.LBCookieName,
 			Value:   sign([]byte(server.ID())),
+			Path:    "/",
 			Expires: time.Now().Add(ss.cookieExpire),
 		}
 		httpresp.SetCookie(cookie)
@@ -60,6 +60,37 @@ func TestStickySession_ConsistentHash(t *testing.T) {
 	}
 }
 
+func TestStickySession_HeaderConsistentHash(t *testing.T) {
+	assert := assert.New(t)
+
+	servers := prepareServers(10)
+	spec := &LoadBalanceSpec{
+		Policy: LoadBalancePolicyRandom,
+		StickySession: &StickySessionSpec{
+			Mode:       StickySessionModeHeaderConsistentHash,
+			HeaderName: "X-Session-Id",
+		},
+	}
+
+	lb := NewGeneralLoadBalancer(spec, servers)
+	lb.Init(NewHTTPSessionSticker, nil, nil)
+
+	req := &http.Request{Header: http.Header{}}
+	req.Header.Set("X-Session-Id", "abcd-1")
+	r, _ := httpprot.NewRequest(req)
+	svr1 := lb.ChooseServer(r)
+
+	for i := 0; i < 100; i++ {
+		svr := lb.ChooseServer(r)
+		assert.Equal(svr1, svr)
+	}
+
+	// without the header, the server is chosen by the load balance policy.
+	r, _ = httpprot.NewRequest(&http.Request{Header: http.Header{}})
+	assert.Nil(lb.ss.GetServer(r, lb.healthyServers.Load()))
+	assert.NotNil(lb.ChooseServer(r))
+}
+
 func TestStickySession_DurationBased(t *testing.T) {
 	assert := assert.New(t)
 
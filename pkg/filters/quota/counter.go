@@ -0,0 +1,226 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package quota
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+)
+
+const (
+	windowHour  = "hour"
+	windowDay   = "day"
+	windowMonth = "month"
+
+	// a shared counter expires this long after the end of its window, so
+	// the members whose clocks are a bit behind still find it.
+	counterExpireDelay = 10 * time.Minute
+)
+
+type (
+	// store keeps the counters shared by all members.
+	store interface {
+		// reserve increases the counter of the key by at most n without
+		// exceeding max, it returns the reserved number and the counter
+		// after the reservation. The counter is removed at expire even if
+		// no one removes it.
+		reserve(key string, n, max int64, expire time.Time) (reserved, total int64, err error)
+		// remove removes the counter of the key.
+		remove(key string)
+	}
+
+	clusterStore struct {
+		cls cluster.Cluster
+
+		mutex sync.Mutex
+		// leases are keyed by the unix time they expire at, the
+		// counters of the windows ending at the same time share one.
+		leases map[int64]clientv3.LeaseID
+	}
+
+	// memoryStore is used when there is no cluster, e.g. in tests.
+	memoryStore struct {
+		mutex    sync.Mutex
+		counters map[string]int64
+	}
+
+	// counter counts the requests of a consumer in the current window of
+	// a limit. The member reserves the requests from the shared counter in
+	// blocks, and admits the requests with the reserved ones locally, so
+	// the cluster never admits more requests than the hard limit.
+	counter struct {
+		limit *LimitSpec
+		// hard is the limit including the grace.
+		hard  int64
+		block int64
+
+		start time.Time
+		end   time.Time
+		key   string
+		// local is the number of reserved requests not used yet, and
+		// total is the shared counter at the last reservation.
+		local int64
+		total int64
+	}
+)
+
+// windowOf returns the calendar window of kind containing t, in loc.
+func windowOf(kind string, t time.Time, loc *time.Location) (start, end time.Time) {
+	t = t.In(loc)
+	y, m, d := t.Date()
+	switch kind {
+	case windowHour:
+		start = time.Date(y, m, d, t.Hour(), 0, 0, 0, loc)
+		end = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, loc)
+	case windowDay:
+		start = time.Date(y, m, d, 0, 0, 0, 0, loc)
+		end = time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+	default:
+		start = time.Date(y, m, 1, 0, 0, 0, 0, loc)
+		end = time.Date(y, m+1, 1, 0, 0, 0, 0, loc)
+	}
+	// the same hour repeats when the daylight saving time ends.
+	if !end.After(start) {
+		end = start.Add(time.Hour)
+	}
+	return start, end
+}
+
+// windowID returns the identity of the window in the keys of the counters.
+func windowID(kind string, start time.Time) string {
+	return kind + "-" + strconv.FormatInt(start.Unix(), 10)
+}
+
+func (c *counter) used() int64 {
+	return c.total - c.local
+}
+
+// remaining returns the number of requests remaining under the limit,
+// the requests reserved but not used by other members are regarded as
+// used.
+func (c *counter) remaining() int64 {
+	if r := c.limit.Limit - c.used(); r > 0 {
+		return r
+	}
+	return 0
+}
+
+// ensure makes sure there is a reserved request, it returns false if the
+// hard limit is reached.
+func (c *counter) ensure(s store) (bool, error) {
+	if c.local > 0 {
+		return true, nil
+	}
+	reserved, total, err := s.reserve(c.key, c.block, c.hard, c.end.Add(counterExpireDelay))
+	if err != nil {
+		return false, err
+	}
+	c.local += reserved
+	c.total = total
+	return c.local > 0, nil
+}
+
+func newClusterStore(cls cluster.Cluster) *clusterStore {
+	return &clusterStore{cls: cls, leases: map[int64]clientv3.LeaseID{}}
+}
+
+// leaseOf returns the lease expiring at expire, the leases expired are
+// forgotten.
+func (s *clusterStore) leaseOf(expire time.Time) (clientv3.LeaseID, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().Unix()
+	for at := range s.leases {
+		if at <= now {
+			delete(s.leases, at)
+		}
+	}
+
+	at := expire.Unix()
+	if lease, ok := s.leases[at]; ok {
+		return lease, nil
+	}
+	lease, err := s.cls.GrantLease(time.Until(expire))
+	if err != nil {
+		return 0, err
+	}
+	s.leases[at] = lease
+	return lease, nil
+}
+
+func (s *clusterStore) reserve(key string, n, max int64, expire time.Time) (reserved, total int64, err error) {
+	lease, err := s.leaseOf(expire)
+	if err != nil {
+		return 0, 0, fmt.Errorf("grant lease failed: %v", err)
+	}
+
+	err = s.cls.STM(func(stm concurrency.STM) error {
+		current := int64(0)
+		if v := stm.Get(key); v != "" {
+			c, e := strconv.ParseInt(v, 10, 64)
+			if e != nil {
+				return fmt.Errorf("invalid counter %s: %v", v, e)
+			}
+			current = c
+		}
+		reserved = min(n, max-current)
+		if reserved <= 0 {
+			reserved, total = 0, current
+			return nil
+		}
+		total = current + reserved
+		stm.Put(key, strconv.FormatInt(total, 10), clientv3.WithLease(lease))
+		return nil
+	})
+	return reserved, total, err
+}
+
+func (s *clusterStore) remove(key string) {
+	s.cls.Delete(key)
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{counters: map[string]int64{}}
+}
+
+func (s *memoryStore) reserve(key string, n, max int64, expire time.Time) (reserved, total int64, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current := s.counters[key]
+	reserved = min(n, max-current)
+	if reserved <= 0 {
+		return 0, current, nil
+	}
+	s.counters[key] = current + reserved
+	return reserved, current + reserved, nil
+}
+
+func (s *memoryStore) remove(key string) {
+	s.mutex.Lock()
+	delete(s.counters, key)
+	s.mutex.Unlock()
+}
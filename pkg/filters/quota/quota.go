@@ -0,0 +1,495 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package quota implements a filter to limit the requests of the consumers
+// in the calendar windows, the counters are shared by all members.
+package quota
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/tenantmanager"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of Quota.
+	Kind = "Quota"
+
+	resultQuotaExceeded = "quotaExceeded"
+
+	// the default block size is 1% of the hard limit, but no more than
+	// maxDefaultBlockSize.
+	defaultBlockRatio   = 100
+	maxDefaultBlockSize = 1000
+
+	// a consumer is forgotten if it sends no request in idleTimeout, the
+	// requests it reserved but not used are wasted.
+	idleTimeout   = time.Hour
+	cleanInterval = time.Minute
+
+	// anonymous is the consumer of the requests not identified, it could
+	// have its own limits in the consumers of the spec.
+	anonymous = "anonymous"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "Quota limits the requests of the consumers in hourly, daily and monthly windows.",
+	Results:     []string{resultQuotaExceeded},
+	Indicators: []*filters.Indicator{
+		{Name: "consumers", Description: "Number of the consumers tracked by the member", Type: filters.IndicatorTypeInteger},
+		{Name: "admitted", Description: "Number of the admitted requests, including the ones in the grace", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "grace", Description: "Number of the requests admitted in the grace", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "exceeded", Description: "Number of the requests rejected for the quota is used up", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &Quota{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// Quota is the filter to limit the requests of the consumers.
+	Quota struct {
+		spec  *Spec
+		loc   *time.Location
+		store store
+
+		consumers *consumers
+		done      chan struct{}
+
+		admitted uint64
+		grace    uint64
+		exceeded uint64
+	}
+
+	// Status is the status of Quota.
+	Status struct {
+		Consumers int    `json:"consumers"`
+		Admitted  uint64 `json:"admitted"`
+		Grace     uint64 `json:"grace"`
+		Exceeded  uint64 `json:"exceeded"`
+	}
+
+	// Spec is the spec of Quota.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// ConsumerHeader is the header to identify the consumer if it is
+		// not identified by a TenantLimiter.
+		ConsumerHeader string `json:"consumerHeader,omitempty"`
+		// ConsumerByIP identifies the consumer by the real IP of the
+		// client if it is not identified otherwise. Every IP has its own
+		// counters in the cluster, so it is only for a few known clients,
+		// the requests not identified share the anonymous consumer if it
+		// is false.
+		ConsumerByIP bool `json:"consumerByIP,omitempty"`
+		// Timezone is the location of the calendar windows, default is UTC.
+		Timezone string `json:"timezone,omitempty"`
+		// Grace is the percentage of the limit the requests are still
+		// admitted after the limit is reached.
+		Grace float64 `json:"grace,omitempty" jsonschema:"minimum=0"`
+		// BlockSize is the number of requests a member reserves from the
+		// shared counter at a time.
+		BlockSize int64 `json:"blockSize,omitempty" jsonschema:"minimum=1"`
+		// Limits are the limits of the consumers not in Consumers.
+		Limits    []*LimitSpec    `json:"limits,omitempty"`
+		Consumers []*ConsumerSpec `json:"consumers,omitempty"`
+	}
+
+	// LimitSpec is the max number of requests in a calendar window.
+	LimitSpec struct {
+		Window string `json:"window" jsonschema:"required,enum=hour,enum=day,enum=month"`
+		Limit  int64  `json:"limit" jsonschema:"required,minimum=1"`
+	}
+
+	// ConsumerSpec is the limits of a consumer.
+	ConsumerSpec struct {
+		Name   string       `json:"name" jsonschema:"required"`
+		Limits []*LimitSpec `json:"limits" jsonschema:"required"`
+	}
+
+	// consumers are shared by the generations of Quota if the limits are
+	// not changed.
+	consumers struct {
+		mutex sync.Mutex
+		m     map[string]*consumer
+	}
+
+	consumer struct {
+		mutex    sync.Mutex
+		counters []*counter
+		lastUsed time.Time
+	}
+
+	// decision is the result of the admission of a request.
+	decision struct {
+		// tightest is the counter with the least remaining requests.
+		tightest *counter
+		// exceeded is the counter whose hard limit is reached.
+		exceeded *counter
+		// grace is true if the request exceeds a limit but is admitted.
+		grace bool
+	}
+)
+
+// Validate validates the spec of Quota.
+func (s *Spec) Validate() error {
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone %s: %v", s.Timezone, err)
+	}
+	if err := validateLimits(s.Limits); err != nil {
+		return err
+	}
+
+	names := map[string]bool{}
+	for _, c := range s.Consumers {
+		if names[c.Name] {
+			return fmt.Errorf("duplicated consumer %s", c.Name)
+		}
+		names[c.Name] = true
+		if len(c.Limits) == 0 {
+			return fmt.Errorf("consumer %s: no limits", c.Name)
+		}
+		if err := validateLimits(c.Limits); err != nil {
+			return fmt.Errorf("consumer %s: %v", c.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateLimits(limits []*LimitSpec) error {
+	windows := map[string]bool{}
+	for _, l := range limits {
+		switch l.Window {
+		case windowHour, windowDay, windowMonth:
+		default:
+			return fmt.Errorf("invalid window %s", l.Window)
+		}
+		if windows[l.Window] {
+			return fmt.Errorf("duplicated window %s", l.Window)
+		}
+		windows[l.Window] = true
+	}
+	return nil
+}
+
+// limitsOf returns the limits of the consumer.
+func (s *Spec) limitsOf(name string) []*LimitSpec {
+	for _, c := range s.Consumers {
+		if c.Name == name {
+			return c.Limits
+		}
+	}
+	return s.Limits
+}
+
+// hardLimit returns the limit including the grace.
+func (s *Spec) hardLimit(l *LimitSpec) int64 {
+	return l.Limit + int64(float64(l.Limit)*s.Grace/100)
+}
+
+func (s *Spec) blockSize(hard int64) int64 {
+	if s.BlockSize > 0 {
+		return s.BlockSize
+	}
+	return max(1, min(hard/defaultBlockRatio, maxDefaultBlockSize))
+}
+
+// Name returns the name of the Quota filter instance.
+func (q *Quota) Name() string {
+	return q.spec.Name()
+}
+
+// Kind returns the kind of Quota.
+func (q *Quota) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the Quota.
+func (q *Quota) Spec() filters.Spec {
+	return q.spec
+}
+
+// Init initializes Quota.
+func (q *Quota) Init() {
+	q.reload(nil)
+}
+
+// Inherit inherits previous generation of Quota, the consumers and their
+// reserved requests are kept if the limits are not changed.
+func (q *Quota) Inherit(previousGeneration filters.Filter) {
+	q.reload(previousGeneration.(*Quota))
+}
+
+func (q *Quota) reload(prev *Quota) {
+	q.loc, _ = time.LoadLocation(q.spec.Timezone)
+
+	// the counters are kept with the consumers, a new store would reset
+	// the counters in memory.
+	if prev != nil && q.sameLimits(prev.spec) {
+		q.store, q.consumers = prev.store, prev.consumers
+	} else {
+		if super := q.spec.Super(); super != nil && super.Cluster() != nil {
+			q.store = newClusterStore(super.Cluster())
+		} else {
+			q.store = newMemoryStore()
+		}
+		q.consumers = &consumers{m: map[string]*consumer{}}
+	}
+
+	q.done = make(chan struct{})
+	go q.run()
+}
+
+func (q *Quota) sameLimits(prev *Spec) bool {
+	return prev.Timezone == q.spec.Timezone &&
+		prev.Grace == q.spec.Grace &&
+		prev.BlockSize == q.spec.BlockSize &&
+		reflect.DeepEqual(prev.Limits, q.spec.Limits) &&
+		reflect.DeepEqual(prev.Consumers, q.spec.Consumers)
+}
+
+func (q *Quota) run() {
+	ticker := time.NewTicker(cleanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.done:
+			return
+		case now := <-ticker.C:
+			q.consumers.clean(now, q.store)
+		}
+	}
+}
+
+// clean removes the idle consumers, and the shared counters of their
+// windows which have ended, which are removed on the rollover if the
+// consumers are active. The counters of the current windows may still be
+// used by other members, they are removed by the cluster when their
+// leases expire.
+func (cs *consumers) clean(now time.Time, s store) {
+	var keys []string
+
+	cs.mutex.Lock()
+	for name, c := range cs.m {
+		c.mutex.Lock()
+		idle := now.Sub(c.lastUsed) > idleTimeout
+		if idle {
+			for _, ctr := range c.counters {
+				if ctr.key != "" && !now.Before(ctr.end) {
+					keys = append(keys, ctr.key)
+				}
+			}
+		}
+		c.mutex.Unlock()
+		if idle {
+			delete(cs.m, name)
+		}
+	}
+	cs.mutex.Unlock()
+
+	for _, key := range keys {
+		s.remove(key)
+	}
+}
+
+// consumerOf returns the consumer of the request, the requests whose
+// consumer is not identified are counted by the real IP if ConsumerByIP
+// is true, or as the anonymous consumer.
+func (q *Quota) consumerOf(ctx *context.Context, req *httpprot.Request) string {
+	if name := tenantmanager.ConsumerOf(ctx, req, q.spec.ConsumerHeader); name != "" {
+		return name
+	}
+	if q.spec.ConsumerByIP {
+		return req.RealIP()
+	}
+	return anonymous
+}
+
+func (q *Quota) getConsumer(name string, limits []*LimitSpec) *consumer {
+	q.consumers.mutex.Lock()
+	defer q.consumers.mutex.Unlock()
+
+	c := q.consumers.m[name]
+	if c == nil {
+		c = &consumer{}
+		for _, l := range limits {
+			hard := q.spec.hardLimit(l)
+			c.counters = append(c.counters, &counter{
+				limit: l,
+				hard:  hard,
+				block: q.spec.blockSize(hard),
+			})
+		}
+		q.consumers.m[name] = c
+	}
+	return c
+}
+
+// admit admits a request of the consumer if none of the hard limits is
+// reached. The request is admitted if the shared counters are not
+// accessible, so the quota never makes the service unavailable.
+func (q *Quota) admit(name string, c *consumer, now time.Time) *decision {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.lastUsed = now
+	for _, ctr := range c.counters {
+		if now.Before(ctr.end) {
+			continue
+		}
+		if ctr.key != "" {
+			// the counter of the previous window is no longer needed.
+			q.store.remove(ctr.key)
+		}
+		ctr.start, ctr.end = windowOf(ctr.limit.Window, now, q.loc)
+		ctr.key = q.counterKey(windowID(ctr.limit.Window, ctr.start), name)
+		ctr.local, ctr.total = 0, 0
+	}
+
+	d := &decision{}
+	for _, ctr := range c.counters {
+		ok, err := ctr.ensure(q.store)
+		if err != nil {
+			logger.Errorf("%s: reserve requests of consumer %s failed: %v", q.spec.Name(), name, err)
+			return d
+		}
+		if !ok {
+			d.exceeded = ctr
+			return d
+		}
+	}
+
+	for _, ctr := range c.counters {
+		ctr.local--
+		if ctr.used() > ctr.limit.Limit {
+			d.grace = true
+		}
+		if d.tightest == nil || ctr.remaining() < d.tightest.remaining() {
+			d.tightest = ctr
+		}
+	}
+	return d
+}
+
+func (q *Quota) counterKey(window, consumer string) string {
+	super := q.spec.Super()
+	if super == nil || super.Cluster() == nil {
+		return window + "/" + consumer
+	}
+	return super.Cluster().Layout().QuotaCounterKey(q.spec.Pipeline(), q.spec.Name(), window, consumer)
+}
+
+// Handle handles HTTP request.
+func (q *Quota) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	name := q.consumerOf(ctx, req)
+	limits := q.spec.limitsOf(name)
+	if len(limits) == 0 {
+		return ""
+	}
+
+	now := time.Now()
+	d := q.admit(name, q.getConsumer(name, limits), now)
+
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+		ctx.SetOutputResponse(resp)
+	}
+
+	ctr := d.tightest
+	if d.exceeded != nil {
+		ctr = d.exceeded
+	}
+	if ctr != nil {
+		setHeaders(resp.HTTPHeader(), ctr, d.exceeded != nil, now)
+	}
+
+	if d.exceeded != nil {
+		atomic.AddUint64(&q.exceeded, 1)
+		ctx.AddTag(fmt.Sprintf("quota: %s limit of %s exceeded", d.exceeded.limit.Window, name))
+		resp.SetStatusCode(http.StatusTooManyRequests)
+		return resultQuotaExceeded
+	}
+	atomic.AddUint64(&q.admitted, 1)
+	if d.grace {
+		atomic.AddUint64(&q.grace, 1)
+		ctx.AddTag("quota: " + name + " in grace")
+		resp.HTTPHeader().Set("X-EG-Quota", "grace")
+	}
+	return ""
+}
+
+// setHeaders sets the headers reporting the limit, the remaining requests
+// and the seconds until the window resets.
+func setHeaders(h http.Header, ctr *counter, exceeded bool, now time.Time) {
+	// round up, so the client never retries too early.
+	reset := strconv.FormatInt(int64((ctr.end.Sub(now)+time.Second-1)/time.Second), 10)
+	remaining := ctr.remaining()
+	if exceeded {
+		remaining = 0
+		h.Set("Retry-After", reset)
+	}
+	h.Set("X-RateLimit-Limit", strconv.FormatInt(ctr.limit.Limit, 10))
+	h.Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+	h.Set("X-RateLimit-Reset", reset)
+	h.Set("X-RateLimit-Window", ctr.limit.Window)
+}
+
+// NeedPayload returns false for both payloads, the quota keys come from
+// the metadata of the requests, it implements context.PayloadNeeder.
+func (q *Quota) NeedPayload() (request, response bool) {
+	return false, false
+}
+
+// Status returns Status generated by Runtime.
+func (q *Quota) Status() interface{} {
+	q.consumers.mutex.Lock()
+	consumers := len(q.consumers.m)
+	q.consumers.mutex.Unlock()
+
+	return &Status{
+		Consumers: consumers,
+		Admitted:  atomic.LoadUint64(&q.admitted),
+		Grace:     atomic.LoadUint64(&q.grace),
+		Exceeded:  atomic.LoadUint64(&q.exceeded),
+	}
+}
+
+// Close closes Quota.
+func (q *Quota) Close() {
+	close(q.done)
+}
@@ -0,0 +1,294 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package quota
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/object/tenantmanager"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func newQuota(t *testing.T, yamlConfig string) *Quota {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	q := kind.CreateInstance(spec).(*Quota)
+	q.Init()
+	return q
+}
+
+func newContext(t *testing.T, apiKey string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	stdr.Header.Set("X-API-Key", apiKey)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		Timezone: "Asia/Shanghai",
+		Limits:   []*LimitSpec{{Window: "hour", Limit: 100}, {Window: "month", Limit: 10000}},
+		Consumers: []*ConsumerSpec{
+			{Name: "vip", Limits: []*LimitSpec{{Window: "day", Limit: 1000}}},
+		},
+	}
+	assert.NoError(spec.Validate())
+
+	assert.Error((&Spec{Timezone: "Mars/Olympus"}).Validate())
+	assert.Error((&Spec{Limits: []*LimitSpec{{Window: "week", Limit: 1}}}).Validate())
+	assert.Error((&Spec{Limits: []*LimitSpec{{Window: "day", Limit: 1}, {Window: "day", Limit: 2}}}).Validate())
+	assert.Error((&Spec{Consumers: []*ConsumerSpec{{Name: "a"}}}).Validate())
+	assert.Error((&Spec{Consumers: []*ConsumerSpec{
+		{Name: "a", Limits: []*LimitSpec{{Window: "day", Limit: 1}}},
+		{Name: "a", Limits: []*LimitSpec{{Window: "hour", Limit: 1}}},
+	}}).Validate())
+
+	assert.Equal(int64(12), (&Spec{Grace: 20}).hardLimit(&LimitSpec{Limit: 10}))
+	assert.Equal(int64(1), (&Spec{}).blockSize(10))
+	assert.Equal(int64(50), (&Spec{}).blockSize(5000))
+	assert.Equal(int64(maxDefaultBlockSize), (&Spec{}).blockSize(1e9))
+	assert.Equal(int64(7), (&Spec{BlockSize: 7}).blockSize(1e9))
+}
+
+func TestWindowOf(t *testing.T) {
+	assert := assert.New(t)
+
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	now := time.Date(2026, 12, 31, 23, 30, 0, 0, time.UTC) // 2027-01-01 07:30 in Shanghai
+
+	start, end := windowOf(windowHour, now, time.UTC)
+	assert.Equal(time.Date(2026, 12, 31, 23, 0, 0, 0, time.UTC), start)
+	assert.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), end)
+
+	start, end = windowOf(windowDay, now, time.UTC)
+	assert.Equal(time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), end)
+
+	start, end = windowOf(windowMonth, now, time.UTC)
+	assert.Equal(time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), start)
+	assert.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), end)
+
+	start, end = windowOf(windowDay, now, loc)
+	assert.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, loc), start)
+	assert.Equal(time.Date(2027, 1, 2, 0, 0, 0, 0, loc), end)
+
+	start, end = windowOf(windowMonth, now, loc)
+	assert.Equal(time.Date(2027, 1, 1, 0, 0, 0, 0, loc), start)
+	assert.Equal(time.Date(2027, 2, 1, 0, 0, 0, 0, loc), end)
+
+	assert.Equal("day-1798761600", windowID(windowDay, time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestQuota(t *testing.T) {
+	assert := assert.New(t)
+
+	q := newQuota(t, `
+kind: Quota
+name: quota
+consumerHeader: X-API-Key
+grace: 20
+blockSize: 3
+limits:
+- window: month
+  limit: 10
+consumers:
+- name: vip
+  limits:
+  - window: month
+    limit: 100
+`)
+	defer q.Close()
+
+	for i := 0; i < 10; i++ {
+		ctx := newContext(t, "alice")
+		assert.Equal("", q.Handle(ctx))
+		h := ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader()
+		assert.Equal("10", h.Get("X-RateLimit-Limit"))
+		assert.Equal(strconv.Itoa(9-i), h.Get("X-RateLimit-Remaining"))
+		assert.Equal("month", h.Get("X-RateLimit-Window"))
+		assert.NotEmpty(h.Get("X-RateLimit-Reset"))
+		assert.Empty(h.Get("X-EG-Quota"))
+	}
+
+	// admitted in the grace.
+	for i := 0; i < 2; i++ {
+		ctx := newContext(t, "alice")
+		assert.Equal("", q.Handle(ctx))
+		h := ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader()
+		assert.Equal("0", h.Get("X-RateLimit-Remaining"))
+		assert.Equal("grace", h.Get("X-EG-Quota"))
+	}
+
+	ctx := newContext(t, "alice")
+	assert.Equal(resultQuotaExceeded, q.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusTooManyRequests, resp.StatusCode())
+	assert.Equal("0", resp.HTTPHeader().Get("X-RateLimit-Remaining"))
+	assert.Equal(resp.HTTPHeader().Get("X-RateLimit-Reset"), resp.HTTPHeader().Get("Retry-After"))
+
+	// other consumers are not affected.
+	ctx = newContext(t, "bob")
+	assert.Equal("", q.Handle(ctx))
+	ctx = newContext(t, "vip")
+	assert.Equal("", q.Handle(ctx))
+	assert.Equal("100", ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader().Get("X-RateLimit-Limit"))
+
+	// the consumer identified by a TenantLimiter goes first.
+	ctx = newContext(t, "alice")
+	tenantmanager.ConsumerDataKey.Set(ctx, "vip")
+	assert.Equal("", q.Handle(ctx))
+
+	assert.Equal(&Status{Consumers: 3, Admitted: 15, Grace: 2, Exceeded: 1}, q.Status())
+
+	// the consumers are kept by the next generation.
+	q2 := kind.CreateInstance(q.spec).(*Quota)
+	q2.Inherit(q)
+	defer q2.Close()
+	assert.Equal(resultQuotaExceeded, q2.Handle(newContext(t, "alice")))
+}
+
+func TestQuotaWindows(t *testing.T) {
+	assert := assert.New(t)
+
+	q := newQuota(t, `
+kind: Quota
+name: quota
+consumerHeader: X-API-Key
+limits:
+- window: hour
+  limit: 2
+- window: day
+  limit: 3
+`)
+	defer q.Close()
+
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	c := q.getConsumer("alice", q.spec.Limits)
+
+	d := q.admit("alice", c, now)
+	assert.Nil(d.exceeded)
+	assert.Equal(windowHour, d.tightest.limit.Window)
+	assert.Nil(q.admit("alice", c, now).exceeded)
+	d = q.admit("alice", c, now)
+	assert.Equal(windowHour, d.exceeded.limit.Window)
+
+	// the hourly limit resets in the next hour, but the daily one does not.
+	now = now.Add(time.Hour)
+	d = q.admit("alice", c, now)
+	assert.Nil(d.exceeded)
+	assert.Equal(windowDay, d.tightest.limit.Window)
+	assert.Equal(int64(0), d.tightest.remaining())
+	d = q.admit("alice", c, now)
+	assert.Equal(windowDay, d.exceeded.limit.Window)
+
+	// the counters of the previous hour are removed.
+	_, exists := q.store.(*memoryStore).counters[windowID(windowHour, now.Add(-time.Hour))+"/alice"]
+	assert.False(exists)
+
+	now = now.Add(24 * time.Hour)
+	assert.Nil(q.admit("alice", c, now).exceeded)
+
+	// idle consumers are forgotten, with the counters of the windows
+	// ended, while the counters of the current windows are kept.
+	q.consumers.clean(now.Add(idleTimeout+time.Second), q.store)
+	assert.Empty(q.consumers.m)
+	counters := q.store.(*memoryStore).counters
+	hourStart, _ := windowOf(windowHour, now, time.UTC)
+	dayStart, _ := windowOf(windowDay, now, time.UTC)
+	assert.NotContains(counters, windowID(windowHour, hourStart)+"/alice")
+	assert.Contains(counters, windowID(windowDay, dayStart)+"/alice")
+}
+
+func TestQuotaAnonymous(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+kind: Quota
+name: quota
+consumerHeader: X-API-Key
+limits:
+- window: day
+  limit: 2
+`
+	q := newQuota(t, yamlConfig)
+	defer q.Close()
+
+	// the requests not identified share the anonymous consumer.
+	ctx := newContext(t, "")
+	assert.Equal("", q.Handle(ctx))
+	assert.Equal("", q.Handle(newContext(t, "")))
+	assert.Equal(resultQuotaExceeded, q.Handle(newContext(t, "")))
+	assert.Len(q.consumers.m, 1)
+	assert.NotNil(q.consumers.m[anonymous])
+
+	q2 := newQuota(t, yamlConfig+"consumerByIP: true\n")
+	defer q2.Close()
+	ctx = newContext(t, "")
+	assert.Equal("", q2.Handle(ctx))
+	assert.NotNil(q2.consumers.m[ctx.GetInputRequest().(*httpprot.Request).RealIP()])
+}
+
+func TestQuotaCluster(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+kind: Quota
+name: quota
+blockSize: 4
+limits:
+- window: day
+  limit: 10
+`
+	q1, q2 := newQuota(t, yamlConfig), newQuota(t, yamlConfig)
+	defer q1.Close()
+	defer q2.Close()
+
+	// the members share the counters.
+	q2.store = q1.store
+
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	c1, c2 := q1.getConsumer("alice", q1.spec.Limits), q2.getConsumer("alice", q2.spec.Limits)
+	admitted := 0
+	for i := 0; i < 10; i++ {
+		for _, m := range []struct {
+			q *Quota
+			c *consumer
+		}{{q1, c1}, {q2, c2}} {
+			if m.q.admit("alice", m.c, now).exceeded == nil {
+				admitted++
+			}
+		}
+	}
+	assert.Equal(10, admitted)
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"sync/atomic"
 	"time"
 
 	"github.com/megaease/easegress/v2/pkg/context"
@@ -42,6 +43,10 @@ var kind = &filters.Kind{
 	Name:        Kind,
 	Description: "RateLimiter implements a rate limiter for http request.",
 	Results:     []string{resultRateLimited},
+	Indicators: []*filters.Indicator{
+		{Name: "limited", Description: "Number of the requests rejected for too many requests", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "delayed", Description: "Number of the requests delayed until they are permitted", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+	},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{}
 	},
@@ -86,6 +91,18 @@ type (
 	// RateLimiter defines the rate limiter
 	RateLimiter struct {
 		spec *Spec
+
+		limited uint64
+		delayed uint64
+	}
+
+	// Status is the status of RateLimiter.
+	Status struct {
+		// Limited is the number of the requests rejected.
+		Limited uint64 `json:"limited"`
+		// Delayed is the number of the requests delayed until they are
+		// permitted.
+		Delayed uint64 `json:"delayed"`
 	}
 )
 
@@ -256,6 +273,7 @@ func (rl *RateLimiter) Handle(ctx *context.Context) string {
 
 		permitted, d := u.rl.AcquirePermission()
 		if !permitted {
+			atomic.AddUint64(&rl.limited, 1)
 			ctx.AddTag("rateLimiter: too many requests")
 
 			resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
@@ -274,6 +292,7 @@ func (rl *RateLimiter) Handle(ctx *context.Context) string {
 			break
 		}
 
+		atomic.AddUint64(&rl.delayed, 1)
 		timer := time.NewTimer(d)
 		select {
 		case <-req.Context().Done():
@@ -287,9 +306,18 @@ func (rl *RateLimiter) Handle(ctx *context.Context) string {
 	return ""
 }
 
+// NeedPayload returns false for both payloads, the requests are limited
+// without reading their bodies, it implements context.PayloadNeeder.
+func (rl *RateLimiter) NeedPayload() (request, response bool) {
+	return false, false
+}
+
 // Status returns Status generated by Runtime.
 func (rl *RateLimiter) Status() interface{} {
-	return nil
+	return &Status{
+		Limited: atomic.LoadUint64(&rl.limited),
+		Delayed: atomic.LoadUint64(&rl.delayed),
+	}
 }
 
 // Close closes RateLimiter.
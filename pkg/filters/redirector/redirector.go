@@ -21,11 +21,14 @@ package redirector
 import (
 	"errors"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/inlinetemplate"
 	"github.com/megaease/easegress/v2/pkg/util/stringtool"
 )
 
@@ -73,8 +76,9 @@ func init() {
 type (
 	// Redirector is filter to redirect HTTP requests.
 	Redirector struct {
-		spec *Spec
-		re   *regexp.Regexp
+		spec     *Spec
+		re       *regexp.Regexp
+		renderer *inlinetemplate.Renderer
 	}
 
 	// Spec describes the Redirector.
@@ -83,11 +87,24 @@ type (
 
 		Match       string `json:"match" jsonschema:"required"`
 		MatchPart   string `json:"matchPart,omitempty" jsonschema:"enum=uri,enum=path,enum=full"` // default uri
-		Replacement string `json:"replacement" jsonschema:"required"`
+		Replacement string `json:"replacement,omitempty"`
 		StatusCode  int    `json:"statusCode,omitempty"` // default 301
+
+		// LocationTemplate is an inline template of the new location, the
+		// submatches of Match are available as vars, like vars.1 and
+		// vars.name. It is mutually exclusive with Replacement.
+		LocationTemplate *inlinetemplate.Spec `json:"locationTemplate,omitempty"`
 	}
 )
 
+// TemplateReferences returns the shared template of the location template.
+func (s *Spec) TemplateReferences() []string {
+	if s.LocationTemplate == nil {
+		return nil
+	}
+	return []string{s.LocationTemplate.Ref}
+}
+
 // Validate validates the spec.
 func (s *Spec) Validate() error {
 	if _, ok := statusCodeMap[s.StatusCode]; !ok {
@@ -97,7 +114,17 @@ func (s *Spec) Validate() error {
 	if !stringtool.StrInSlice(s.MatchPart, []string{matchPartURI, matchPartFull, matchPartPath}) {
 		return errors.New("invalid match part of Redirector, only uri, full and path are supported")
 	}
-	if s.Match == "" || s.Replacement == "" {
+	if s.LocationTemplate != nil {
+		if s.Replacement != "" {
+			return errors.New("replacement and locationTemplate of Redirector are mutually exclusive")
+		}
+		if err := s.LocationTemplate.Validate(); err != nil {
+			return err
+		}
+	} else if s.Replacement == "" {
+		return errors.New("match and replacement of Redirector can't be empty")
+	}
+	if s.Match == "" {
 		return errors.New("match and replacement of Redirector can't be empty")
 	}
 	_, err := regexp.Compile(s.Match)
@@ -134,6 +161,9 @@ func (r *Redirector) Inherit(previousGeneration filters.Filter) {
 
 func (r *Redirector) reload() {
 	r.re = regexp.MustCompile(r.spec.Match)
+	if r.spec.LocationTemplate != nil {
+		r.renderer = inlinetemplate.NewRenderer(r.spec.LocationTemplate)
+	}
 }
 
 func (r *Redirector) getMatchInput(req *httpprot.Request) string {
@@ -158,6 +188,9 @@ func (r *Redirector) updateResponse(resp *httpprot.Response, newLocation string)
 func (r *Redirector) Handle(ctx *context.Context) string {
 	req := ctx.GetInputRequest().(*httpprot.Request)
 	matchInput := r.getMatchInput(req)
+	if r.renderer != nil {
+		return r.handleTemplate(ctx, matchInput)
+	}
 	newLocation := r.re.ReplaceAllString(matchInput, r.spec.Replacement)
 
 	// if matchInput is not matched, newLocation will be the same as matchInput
@@ -175,6 +208,40 @@ func (r *Redirector) Handle(ctx *context.Context) string {
 	return resultRedirected
 }
 
+// handleTemplate redirects the request to the location rendered by the
+// location template, if the match input is matched.
+func (r *Redirector) handleTemplate(ctx *context.Context, matchInput string) string {
+	submatches := r.re.FindStringSubmatch(matchInput)
+	if submatches == nil {
+		return ""
+	}
+
+	vars := inlinetemplate.Vars{}
+	for i, name := range r.re.SubexpNames() {
+		vars[strconv.Itoa(i)] = submatches[i]
+		if name != "" {
+			vars[name] = submatches[i]
+		}
+	}
+
+	newLocation, err := r.renderer.Render(inlinetemplate.NewContextValues(ctx, vars))
+	if err != nil {
+		logger.Errorf("%s: render location failed: %v", r.spec.Name(), err)
+		return ""
+	}
+
+	resp, _ := httpprot.NewResponse(nil)
+	r.updateResponse(resp, newLocation)
+	ctx.SetOutputResponse(resp)
+	return resultRedirected
+}
+
+// NeedPayload returns false for both payloads, the redirection depends on
+// the URL only, it implements context.PayloadNeeder.
+func (r *Redirector) NeedPayload() (request, response bool) {
+	return false, false
+}
+
 // Status returns status.
 func (r *Redirector) Status() interface{} {
 	return nil
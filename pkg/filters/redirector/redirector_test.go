@@ -28,6 +28,7 @@ import (
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/inlinetemplate"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -225,6 +226,39 @@ func TestRedirector(t *testing.T) {
 	}
 }
 
+func TestRedirectorLocationTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := getSpec(`^/users/(?P<id>\d+)/(\w+)$`, "path", "", 302)
+	spec.LocationTemplate = &inlinetemplate.Spec{
+		Text: "https://${req.host}/v2/${vars.2}?id=${vars.id}&from=${req.path | urlquery}",
+	}
+	assert.NoError(spec.Validate())
+	r := &Redirector{spec: spec}
+	r.Init()
+
+	handle := func(url string) (string, *context.Context) {
+		stdr, _ := http.NewRequest(http.MethodGet, url, nil)
+		req, _ := httpprot.NewRequest(stdr)
+		ctx := context.New(nil)
+		ctx.SetInputRequest(req)
+		return r.Handle(ctx), ctx
+	}
+
+	result, ctx := handle("http://example.com/users/42/profile")
+	assert.Equal(resultRedirected, result)
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(302, resp.StatusCode())
+	assert.Equal("https://example.com/v2/profile?id=42&from=%2Fusers%2F42%2Fprofile", resp.Header().Get("Location"))
+
+	result, ctx = handle("http://example.com/groups/42")
+	assert.Equal("", result)
+	assert.Nil(ctx.GetOutputResponse())
+
+	spec.Replacement = "/new"
+	assert.Error(spec.Validate())
+}
+
 func TestSpecValidate(t *testing.T) {
 	assert := assert.New(t)
 	{
@@ -235,6 +235,12 @@ func (r *Redirector) subPrefix(path, prefix, replacePrefixMatch string) string {
 	return path
 }
 
+// NeedPayload returns false for both payloads, the redirection depends on
+// the URL only, it implements context.PayloadNeeder.
+func (r *Redirector) NeedPayload() (request, response bool) {
+	return false, false
+}
+
 // Status returns status.
 func (r *Redirector) Status() interface{} {
 	return nil
@@ -47,6 +47,21 @@ func Register(k *Kind) {
 		resultMap[result] = struct{}{}
 	}
 
+	// Checking indicators.
+	indicatorMap := map[string]struct{}{}
+	for _, ind := range k.Indicators {
+		if _, ok := indicatorMap[ind.Name]; ok {
+			panic(fmt.Errorf("duplicated indicator: %s", ind.Name))
+		}
+		indicatorMap[ind.Name] = struct{}{}
+
+		switch ind.Type {
+		case IndicatorTypeInteger, IndicatorTypeNumber, IndicatorTypeString, IndicatorTypeBoolean:
+		default:
+			panic(fmt.Errorf("indicator %s: invalid type %s", ind.Name, ind.Type))
+		}
+	}
+
 	kinds[k.Name] = k
 }
 
@@ -32,6 +32,25 @@ var duplicatedResult = &Kind{
 	CreateInstance: func(spec Spec) Filter { return nil },
 }
 
+var duplicatedIndicator = &Kind{
+	Name:        "DuplicatedIndicator",
+	Description: "none",
+	Indicators: []*Indicator{
+		{Name: "requests", Type: IndicatorTypeInteger},
+		{Name: "requests", Type: IndicatorTypeInteger},
+	},
+	DefaultSpec:    func() Spec { return &mockSpec{} },
+	CreateInstance: func(spec Spec) Filter { return nil },
+}
+
+var invalidIndicatorType = &Kind{
+	Name:           "InvalidIndicatorType",
+	Description:    "none",
+	Indicators:     []*Indicator{{Name: "requests", Type: "int"}},
+	DefaultSpec:    func() Spec { return &mockSpec{} },
+	CreateInstance: func(spec Spec) Filter { return nil },
+}
+
 func TestRegister(t *testing.T) {
 	assert := assert.New(t)
 
@@ -51,6 +70,8 @@ func TestRegister(t *testing.T) {
 	Register(mockKind)
 	assert.Panics(func() { Register(mockKind) })
 	assert.Panics(func() { Register(duplicatedResult) })
+	assert.Panics(func() { Register(duplicatedIndicator) })
+	assert.Panics(func() { Register(invalidIndicatorType) })
 
 	baseSpec := &BaseSpec{
 		MetaSpec: supervisor.MetaSpec{
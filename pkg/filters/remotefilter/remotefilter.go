@@ -268,6 +268,12 @@ func (rf *RemoteFilter) Handle(ctx *context.Context) (result string) {
 	return ""
 }
 
+// NeedPayload returns true for both payloads, which are sent to the remote
+// endpoint, it implements context.PayloadNeeder.
+func (rf *RemoteFilter) NeedPayload() (request, response bool) {
+	return true, true
+}
+
 // Status returns status.
 func (rf *RemoteFilter) Status() interface{} { return nil }
 
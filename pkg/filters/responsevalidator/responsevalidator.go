@@ -0,0 +1,349 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package responsevalidator implements a filter to validate the responses
+// of the upstreams.
+package responsevalidator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/xeipuuv/gojsonschema"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/dynamicobject"
+)
+
+const (
+	// Kind is the kind of ResponseValidator.
+	Kind = "ResponseValidator"
+
+	resultInvalid          = "invalidResponse"
+	resultFallback         = "fallback"
+	resultResponseNotFound = "responseNotFound"
+
+	violationStatusCode     = "statusCode"
+	violationSchema         = "schema"
+	violationRequiredFields = "requiredFields"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ResponseValidator validates the responses of the upstreams, and substitutes a fallback response for the invalid ones.",
+	Results:     []string{resultInvalid, resultFallback, resultResponseNotFound},
+	Indicators: []*filters.Indicator{
+		{Name: "validated", Description: "Number of the validated responses", Type: filters.IndicatorTypeInteger, Unit: "responses"},
+		{Name: "invalid", Description: "Number of the invalid responses", Type: filters.IndicatorTypeInteger, Unit: "responses"},
+		{Name: "substituted", Description: "Number of the invalid responses substituted by the fallback response", Type: filters.IndicatorTypeInteger, Unit: "responses"},
+		{Name: "violations.*", Description: "Number of the invalid responses by the violation, statusCode, schema or requiredFields", Type: filters.IndicatorTypeInteger, Unit: "responses"},
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ResponseValidator{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ResponseValidator is the filter to validate the responses of the
+	// upstreams.
+	ResponseValidator struct {
+		spec    *Spec
+		codes   map[int]bool
+		classes map[int]bool // status code / 100
+		schema  *gojsonschema.Schema
+		paths   [][]string
+
+		fallbackBody []byte
+
+		validated   uint64
+		invalid     uint64
+		substituted uint64
+		violations  map[string]*uint64
+	}
+
+	// Spec is the spec of ResponseValidator.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// StatusCodes are the valid status codes, like 200, or the classes
+		// of the status codes, like 2xx. All status codes are valid if it
+		// is empty.
+		StatusCodes []string `json:"statusCodes,omitempty"`
+		// JSONSchema is the JSON schema of the response bodies.
+		JSONSchema dynamicobject.DynamicObject `json:"jsonSchema,omitempty"`
+		// RequiredFields are the dotted paths of the fields required in
+		// the JSON response bodies, like data.id. A path through an array
+		// requires the field in every element.
+		RequiredFields []string `json:"requiredFields,omitempty"`
+		// Fallback is the response substituted for the invalid ones. If it
+		// is nil, the filter returns the invalidResponse result, so the
+		// request could be sent to a secondary upstream by jumpIf.
+		Fallback *FallbackSpec `json:"fallback,omitempty"`
+	}
+
+	// FallbackSpec is the spec of the fallback response.
+	FallbackSpec struct {
+		StatusCode int               `json:"statusCode" jsonschema:"required,format=httpcode"`
+		Headers    map[string]string `json:"headers,omitempty"`
+		Body       string            `json:"body,omitempty"`
+	}
+
+	// Status is the status of ResponseValidator.
+	Status struct {
+		// Validated is the number of the validated responses.
+		Validated uint64 `json:"validated"`
+		// Invalid is the number of the invalid responses.
+		Invalid uint64 `json:"invalid"`
+		// Substituted is the number of the invalid responses substituted
+		// by the fallback response, the others are left to the flow.
+		Substituted uint64 `json:"substituted"`
+		// Violations are the numbers of the invalid responses by the
+		// violations, which are statusCode, schema and requiredFields.
+		Violations map[string]uint64 `json:"violations"`
+	}
+)
+
+// parseStatusCode parses a status code or a class of the status codes,
+// class is true for the latter, and the code is the first digit.
+func parseStatusCode(s string) (code int, class bool, err error) {
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") {
+		code, err = strconv.Atoi(s[:1])
+		if err != nil || code < 1 || code > 5 {
+			return 0, false, fmt.Errorf("invalid status code class %s", s)
+		}
+		return code, true, nil
+	}
+
+	code, err = strconv.Atoi(s)
+	if err != nil || code < 100 || code > 599 {
+		return 0, false, fmt.Errorf("invalid status code %s", s)
+	}
+	return code, false, nil
+}
+
+// Validate validates the spec of ResponseValidator.
+func (s *Spec) Validate() error {
+	if len(s.StatusCodes) == 0 && len(s.JSONSchema) == 0 && len(s.RequiredFields) == 0 {
+		return fmt.Errorf("none of statusCodes, jsonSchema and requiredFields is specified")
+	}
+	for _, c := range s.StatusCodes {
+		if _, _, err := parseStatusCode(c); err != nil {
+			return err
+		}
+	}
+	if len(s.JSONSchema) > 0 {
+		if _, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(s.JSONSchema)); err != nil {
+			return fmt.Errorf("invalid jsonSchema: %v", err)
+		}
+	}
+	for _, f := range s.RequiredFields {
+		if f == "" || strings.HasPrefix(f, ".") || strings.HasSuffix(f, ".") || strings.Contains(f, "..") {
+			return fmt.Errorf("invalid required field %q", f)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the ResponseValidator filter instance.
+func (rv *ResponseValidator) Name() string {
+	return rv.spec.Name()
+}
+
+// Kind returns the kind of ResponseValidator.
+func (rv *ResponseValidator) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ResponseValidator.
+func (rv *ResponseValidator) Spec() filters.Spec {
+	return rv.spec
+}
+
+// Init initializes ResponseValidator.
+func (rv *ResponseValidator) Init() {
+	rv.reload()
+}
+
+// Inherit inherits previous generation of ResponseValidator.
+func (rv *ResponseValidator) Inherit(previousGeneration filters.Filter) {
+	rv.reload()
+}
+
+func (rv *ResponseValidator) reload() {
+	rv.codes = map[int]bool{}
+	rv.classes = map[int]bool{}
+	for _, c := range rv.spec.StatusCodes {
+		code, class, _ := parseStatusCode(c)
+		if class {
+			rv.classes[code] = true
+		} else {
+			rv.codes[code] = true
+		}
+	}
+
+	// the spec has been validated, so the error is impossible.
+	if len(rv.spec.JSONSchema) > 0 {
+		rv.schema, _ = gojsonschema.NewSchema(gojsonschema.NewGoLoader(rv.spec.JSONSchema))
+	}
+
+	for _, f := range rv.spec.RequiredFields {
+		rv.paths = append(rv.paths, strings.Split(f, "."))
+	}
+
+	if rv.spec.Fallback != nil {
+		rv.fallbackBody = []byte(rv.spec.Fallback.Body)
+	}
+
+	rv.violations = map[string]*uint64{
+		violationStatusCode:     new(uint64),
+		violationSchema:         new(uint64),
+		violationRequiredFields: new(uint64),
+	}
+}
+
+// NeedPayload returns true for the response payload if the body is
+// validated, it implements context.PayloadNeeder.
+func (rv *ResponseValidator) NeedPayload() (request, response bool) {
+	return false, len(rv.spec.JSONSchema) > 0 || len(rv.spec.RequiredFields) > 0
+}
+
+// Handle validates the response, the bodies of the streams are not
+// validated.
+func (rv *ResponseValidator) Handle(ctx *context.Context) string {
+	resp, ok := ctx.GetInputResponse().(*httpprot.Response)
+	if !ok {
+		return resultResponseNotFound
+	}
+
+	atomic.AddUint64(&rv.validated, 1)
+	violation := rv.validate(resp)
+	if violation == "" {
+		return ""
+	}
+
+	atomic.AddUint64(&rv.invalid, 1)
+	atomic.AddUint64(rv.violations[violation], 1)
+	ctx.AddTag(fmt.Sprintf("responseValidator: invalid %s", violation))
+
+	if rv.spec.Fallback == nil {
+		return resultInvalid
+	}
+	rv.fallback(ctx, violation)
+	atomic.AddUint64(&rv.substituted, 1)
+	return resultFallback
+}
+
+// validate returns the violation of the response, or an empty string if it
+// is valid.
+func (rv *ResponseValidator) validate(resp *httpprot.Response) string {
+	if len(rv.codes) > 0 || len(rv.classes) > 0 {
+		code := resp.StatusCode()
+		if !rv.codes[code] && !rv.classes[code/100] {
+			return violationStatusCode
+		}
+	}
+
+	if (rv.schema == nil && len(rv.paths) == 0) || resp.IsStream() {
+		return ""
+	}
+
+	// the payload is parsed once for all the filters reading it as JSON.
+	body, err := resp.JSONPayload()
+	if err != nil {
+		if rv.schema != nil {
+			return violationSchema
+		}
+		return violationRequiredFields
+	}
+
+	if rv.schema != nil {
+		res, err := rv.schema.Validate(gojsonschema.NewGoLoader(body))
+		if err != nil || !res.Valid() {
+			return violationSchema
+		}
+	}
+
+	for _, path := range rv.paths {
+		if !hasField(body, path) {
+			return violationRequiredFields
+		}
+	}
+	return ""
+}
+
+// hasField reports whether v has the field of the path, a path through an
+// array requires the field in every element.
+func hasField(v interface{}, path []string) bool {
+	if len(path) == 0 {
+		return true
+	}
+	switch x := v.(type) {
+	case map[string]interface{}:
+		fv, ok := x[path[0]]
+		return ok && hasField(fv, path[1:])
+	case []interface{}:
+		for _, ev := range x {
+			if !hasField(ev, path) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// fallback substitutes the fallback response for the invalid one, which
+// is closed by the context.
+func (rv *ResponseValidator) fallback(ctx *context.Context, violation string) {
+	fb, _ := httpprot.NewResponse(nil)
+	fb.SetStatusCode(rv.spec.Fallback.StatusCode)
+	for key, value := range rv.spec.Fallback.Headers {
+		fb.HTTPHeader().Set(key, value)
+	}
+	fb.HTTPHeader().Set("X-EG-Response-Validator", violation)
+	fb.SetPayload(rv.fallbackBody)
+	ctx.SetOutputResponse(fb)
+}
+
+// Status returns Status generated by Runtime.
+func (rv *ResponseValidator) Status() interface{} {
+	s := &Status{
+		Validated:   atomic.LoadUint64(&rv.validated),
+		Invalid:     atomic.LoadUint64(&rv.invalid),
+		Substituted: atomic.LoadUint64(&rv.substituted),
+		Violations:  map[string]uint64{},
+	}
+	for k, v := range rv.violations {
+		s.Violations[k] = atomic.LoadUint64(v)
+	}
+	return s
+}
+
+// Close closes ResponseValidator.
+func (rv *ResponseValidator) Close() {
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package responsevalidator
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func newResponseValidator(t *testing.T, yamlConfig string) *ResponseValidator {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	rv := kind.CreateInstance(spec).(*ResponseValidator)
+	rv.Init()
+	return rv
+}
+
+func newContext(statusCode int, body string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	ctx.SetInputRequest(req)
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(statusCode)
+	resp.SetPayload([]byte(body))
+	ctx.SetOutputResponse(resp)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{StatusCodes: []string{"2xx", "404"}}).Validate())
+	assert.NoError((&Spec{RequiredFields: []string{"data.id"}}).Validate())
+	assert.Error((&Spec{}).Validate())
+	assert.Error((&Spec{StatusCodes: []string{"6xx"}}).Validate())
+	assert.Error((&Spec{StatusCodes: []string{"20"}}).Validate())
+	assert.Error((&Spec{RequiredFields: []string{"data..id"}}).Validate())
+	assert.Error((&Spec{JSONSchema: map[string]interface{}{"type": 1}}).Validate())
+}
+
+func TestHasField(t *testing.T) {
+	assert := assert.New(t)
+
+	var v interface{}
+	codectool.MustUnmarshalJSON([]byte(`{"data":{"id":1,"items":[{"name":"a"},{"name":"b"}]}}`), &v)
+	assert.True(hasField(v, []string{"data", "id"}))
+	assert.True(hasField(v, []string{"data", "items", "name"}))
+	assert.False(hasField(v, []string{"data", "items", "price"}))
+	assert.False(hasField(v, []string{"data", "id", "x"}))
+	assert.False(hasField(v, []string{"error"}))
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	rv := newResponseValidator(t, `
+kind: ResponseValidator
+name: rv
+statusCodes: ["2xx"]
+requiredFields: [data.id]
+jsonSchema:
+  type: object
+  properties:
+    data:
+      type: object
+`)
+
+	ctx := newContext(http.StatusOK, `{"data":{"id":1}}`)
+	assert.Equal("", rv.Handle(ctx))
+
+	ctx = newContext(http.StatusBadGateway, `{"data":{"id":1}}`)
+	assert.Equal(resultInvalid, rv.Handle(ctx))
+
+	ctx = newContext(http.StatusOK, `{"data":[]}`)
+	assert.Equal(resultInvalid, rv.Handle(ctx))
+
+	ctx = newContext(http.StatusOK, `{"data":{}}`)
+	assert.Equal(resultInvalid, rv.Handle(ctx))
+
+	ctx = newContext(http.StatusOK, `not json`)
+	assert.Equal(resultInvalid, rv.Handle(ctx))
+
+	status := rv.Status().(*Status)
+	assert.Equal(uint64(5), status.Validated)
+	assert.Equal(uint64(4), status.Invalid)
+	assert.Equal(uint64(0), status.Substituted)
+	assert.Equal(uint64(1), status.Violations[violationStatusCode])
+	assert.Equal(uint64(2), status.Violations[violationSchema])
+	assert.Equal(uint64(1), status.Violations[violationRequiredFields])
+
+	req, resp := rv.NeedPayload()
+	assert.False(req)
+	assert.True(resp)
+
+	rv = newResponseValidator(t, `
+kind: ResponseValidator
+name: rv
+statusCodes: ["2xx"]
+`)
+	req, resp = rv.NeedPayload()
+	assert.False(req)
+	assert.False(resp)
+}
+
+func TestFallback(t *testing.T) {
+	assert := assert.New(t)
+
+	rv := newResponseValidator(t, `
+kind: ResponseValidator
+name: rv
+statusCodes: ["2xx", "404"]
+fallback:
+  statusCode: 200
+  headers:
+    Content-Type: application/json
+  body: '{"items":[]}'
+`)
+
+	ctx := newContext(http.StatusNotFound, "")
+	assert.Equal("", rv.Handle(ctx))
+
+	ctx = newContext(http.StatusServiceUnavailable, "")
+	assert.Equal(resultFallback, rv.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("application/json", resp.HTTPHeader().Get("Content-Type"))
+	assert.Equal(violationStatusCode, resp.HTTPHeader().Get("X-EG-Response-Validator"))
+	assert.Equal(`{"items":[]}`, string(resp.RawPayload()))
+
+	assert.Equal(uint64(1), rv.Status().(*Status).Substituted)
+
+	ctx = context.New(nil)
+	assert.Equal(resultResponseNotFound, rv.Handle(ctx))
+}
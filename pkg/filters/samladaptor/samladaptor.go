@@ -0,0 +1,558 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package samladaptor implements SAML 2.0 service provider for the browser
+// facing pipelines.
+package samladaptor
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/google/uuid"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/session"
+)
+
+const (
+	// Kind is the kind of SAMLAdaptor.
+	Kind = "SAMLAdaptor"
+
+	resultFiltered = "samlFiltered"
+
+	bindingPost = "post"
+
+	defaultCookieName = "EG_SAML_SESSION"
+	defaultSessionTTL = 8 * time.Hour
+
+	// the user may spend some time to login in the IdP.
+	requestTimeout = 10 * time.Minute
+	maxACSPayload  = 1024 * 1024
+)
+
+var httpCli = &http.Client{Timeout: 10 * time.Second}
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "SAMLAdaptor implements SAML 2.0 service provider for the browser facing pipelines",
+	Results:     []string{resultFiltered},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &SAMLAdaptor{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// SAMLAdaptor is the filter for SAML 2.0 single sign-on.
+	SAMLAdaptor struct {
+		spec  *Spec
+		store store
+
+		metadataPath string
+		acsPath      string
+		secureCookie bool
+		sessionTTL   time.Duration
+
+		mutex sync.Mutex
+		sp    *saml.ServiceProvider
+
+		sessions *session.Manager
+	}
+
+	// Spec is the spec of SAMLAdaptor.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// EntityID is the entity ID of the service provider, default is
+		// MetadataURL.
+		EntityID string `json:"entityID,omitempty"`
+		// MetadataURL is the URL of the service provider metadata, which
+		// is served by the filter.
+		MetadataURL string `json:"metadataURL" jsonschema:"required,format=uri"`
+		// ACSURL is the URL of the assertion consumer service, which is
+		// served by the filter.
+		ACSURL string `json:"acsURL" jsonschema:"required,format=uri"`
+
+		// IDPMetadata is the metadata XML of the identity provider.
+		IDPMetadata string `json:"idpMetadata,omitempty"`
+		// IDPMetadataURL is the URL to fetch the metadata of the identity
+		// provider.
+		IDPMetadataURL string `json:"idpMetadataURL,omitempty" jsonschema:"format=uri"`
+
+		// CertBase64 and KeyBase64 are the base64 encoded PEM certificate
+		// and private key of the service provider, to sign the
+		// authentication requests and decrypt the encrypted assertions.
+		CertBase64  string `json:"certBase64,omitempty" jsonschema:"format=base64"`
+		KeyBase64   string `json:"keyBase64,omitempty" jsonschema:"format=base64"`
+		SignRequest bool   `json:"signRequest,omitempty"`
+
+		// Binding is the binding to send the authentication requests,
+		// redirect or post, default is redirect.
+		Binding string `json:"binding,omitempty" jsonschema:"enum=,enum=redirect,enum=post"`
+		// AllowIDPInitiated allows the logins started from the identity
+		// provider, the users are redirected to DefaultRedirectURL.
+		AllowIDPInitiated  bool   `json:"allowIDPInitiated,omitempty"`
+		DefaultRedirectURL string `json:"defaultRedirectURL,omitempty"`
+
+		// CookieName, SessionTTL and SessionSecret are the settings of the
+		// signed session cookies.
+		CookieName    string `json:"cookieName,omitempty"`
+		SessionTTL    string `json:"sessionTTL,omitempty" jsonschema:"format=duration"`
+		SessionSecret string `json:"sessionSecret,omitempty" jsonschema:"minLength=16"`
+
+		// Session enables the server side sessions instead of the signed
+		// session cookies, so that the sessions could be invalidated.
+		Session *session.Spec `json:"session,omitempty"`
+	}
+
+	// trackedRequest is an authentication request waiting for the
+	// response of the identity provider.
+	trackedRequest struct {
+		ID  string `json:"id"`
+		URL string `json:"url"`
+	}
+
+	store interface {
+		put(key, value string, timeout time.Duration) error
+		get(key string) string
+		del(key string)
+	}
+
+	clusterStore struct {
+		cls cluster.Cluster
+	}
+)
+
+// Validate validates the spec of SAMLAdaptor.
+func (spec *Spec) Validate() error {
+	if (spec.IDPMetadata == "") == (spec.IDPMetadataURL == "") {
+		return fmt.Errorf("exactly one of idpMetadata and idpMetadataURL is required")
+	}
+	if spec.IDPMetadata != "" {
+		if _, err := parseMetadata([]byte(spec.IDPMetadata)); err != nil {
+			return fmt.Errorf("invalid idpMetadata: %v", err)
+		}
+	}
+
+	if (spec.CertBase64 == "") != (spec.KeyBase64 == "") {
+		return fmt.Errorf("certBase64 and keyBase64 must be specified together")
+	}
+	if spec.CertBase64 != "" {
+		if _, _, err := spec.keyPair(); err != nil {
+			return err
+		}
+	} else if spec.SignRequest {
+		return fmt.Errorf("signRequest requires certBase64 and keyBase64")
+	}
+
+	if spec.Session == nil && spec.SessionSecret == "" {
+		return fmt.Errorf("sessionSecret is required if session is not specified")
+	}
+	if spec.SessionTTL != "" {
+		if d, err := time.ParseDuration(spec.SessionTTL); err != nil || d <= 0 {
+			return fmt.Errorf("invalid sessionTTL %s", spec.SessionTTL)
+		}
+	}
+
+	return nil
+}
+
+func (spec *Spec) keyPair() (*x509.Certificate, *rsa.PrivateKey, error) {
+	certPem, _ := base64.StdEncoding.DecodeString(spec.CertBase64)
+	keyPem, _ := base64.StdEncoding.DecodeString(spec.KeyBase64)
+	pair, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid key pair: %v", err)
+	}
+
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("the private key must be an RSA key")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid certificate: %v", err)
+	}
+	return cert, key, nil
+}
+
+// parseMetadata parses the metadata of the identity provider, which is an
+// EntityDescriptor, or an EntitiesDescriptor containing an identity
+// provider.
+func parseMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	ed := &saml.EntityDescriptor{}
+	err := xml.Unmarshal(data, ed)
+	if err == nil {
+		if len(ed.IDPSSODescriptors) == 0 {
+			return nil, fmt.Errorf("no IDPSSODescriptor")
+		}
+		return ed, nil
+	}
+
+	eds := &saml.EntitiesDescriptor{}
+	if xml.Unmarshal(data, eds) != nil {
+		return nil, err
+	}
+	for i := range eds.EntityDescriptors {
+		if len(eds.EntityDescriptors[i].IDPSSODescriptors) > 0 {
+			return &eds.EntityDescriptors[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no IDPSSODescriptor")
+}
+
+func fetchMetadata(metadataURL string) (*saml.EntityDescriptor, error) {
+	resp, err := httpCli.Get(metadataURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return parseMetadata(data)
+}
+
+// Name returns the name of the SAMLAdaptor filter instance.
+func (sa *SAMLAdaptor) Name() string {
+	return sa.spec.Name()
+}
+
+// Kind returns the kind of SAMLAdaptor.
+func (sa *SAMLAdaptor) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the SAMLAdaptor.
+func (sa *SAMLAdaptor) Spec() filters.Spec {
+	return sa.spec
+}
+
+// Init initializes SAMLAdaptor.
+func (sa *SAMLAdaptor) Init() {
+	sa.reload(nil)
+}
+
+// Inherit inherits previous generation of SAMLAdaptor.
+func (sa *SAMLAdaptor) Inherit(previousGeneration filters.Filter) {
+	sa.reload(previousGeneration.(*SAMLAdaptor))
+}
+
+func (sa *SAMLAdaptor) reload(previousGeneration *SAMLAdaptor) {
+	if sa.store == nil {
+		sa.store = &clusterStore{cls: sa.spec.Super().Cluster()}
+	}
+
+	if sa.spec.Session != nil {
+		var prev *session.Manager
+		if previousGeneration != nil {
+			prev = previousGeneration.sessions
+		}
+		sa.sessions = session.Inherit(sa.spec.Session, prev)
+	}
+
+	// the URLs have been validated by the JSON schema.
+	metadataURL, _ := url.Parse(sa.spec.MetadataURL)
+	acsURL, _ := url.Parse(sa.spec.ACSURL)
+	sa.metadataPath = metadataURL.Path
+	sa.acsPath = acsURL.Path
+	sa.secureCookie = acsURL.Scheme == "https"
+
+	sa.sessionTTL = defaultSessionTTL
+	if sa.spec.SessionTTL != "" {
+		sa.sessionTTL, _ = time.ParseDuration(sa.spec.SessionTTL)
+	}
+
+	var ed *saml.EntityDescriptor
+	if sa.spec.IDPMetadata != "" {
+		ed, _ = parseMetadata([]byte(sa.spec.IDPMetadata))
+	} else {
+		// the identity provider may be unavailable now, the metadata is
+		// fetched again on the next request if it fails.
+		var err error
+		ed, err = fetchMetadata(sa.spec.IDPMetadataURL)
+		if err != nil {
+			logger.Errorf("fetch idp metadata from %s failed: %v", sa.spec.IDPMetadataURL, err)
+			return
+		}
+	}
+	sa.sp = sa.newServiceProvider(ed)
+}
+
+func (sa *SAMLAdaptor) newServiceProvider(ed *saml.EntityDescriptor) *saml.ServiceProvider {
+	metadataURL, _ := url.Parse(sa.spec.MetadataURL)
+	acsURL, _ := url.Parse(sa.spec.ACSURL)
+	sp := &saml.ServiceProvider{
+		EntityID:          sa.spec.EntityID,
+		MetadataURL:       *metadataURL,
+		AcsURL:            *acsURL,
+		HTTPClient:        httpCli,
+		IDPMetadata:       ed,
+		AllowIDPInitiated: sa.spec.AllowIDPInitiated,
+	}
+	if sa.spec.CertBase64 != "" {
+		sp.Certificate, sp.Key, _ = sa.spec.keyPair()
+		if sa.spec.SignRequest {
+			sp.SignatureMethod = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+		}
+	}
+	return sp
+}
+
+// serviceProvider returns the service provider, it is nil if the metadata
+// of the identity provider is not available.
+func (sa *SAMLAdaptor) serviceProvider() *saml.ServiceProvider {
+	sa.mutex.Lock()
+	defer sa.mutex.Unlock()
+
+	if sa.sp != nil {
+		return sa.sp
+	}
+
+	ed, err := fetchMetadata(sa.spec.IDPMetadataURL)
+	if err != nil {
+		logger.Errorf("fetch idp metadata from %s failed: %v", sa.spec.IDPMetadataURL, err)
+		return nil
+	}
+	sa.sp = sa.newServiceProvider(ed)
+	return sa.sp
+}
+
+// Handle serves the metadata and the assertion consumer service, and
+// redirects the requests without a valid session to the identity provider.
+func (sa *SAMLAdaptor) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	sp := sa.serviceProvider()
+	if sp == nil {
+		return sa.respond(ctx, http.StatusServiceUnavailable, "identity provider unavailable")
+	}
+
+	switch {
+	case req.Path() == sa.metadataPath && req.Method() == http.MethodGet:
+		return sa.handleMetadata(ctx, sp)
+	case req.Path() == sa.acsPath && req.Method() == http.MethodPost:
+		return sa.handleACS(ctx, sp)
+	}
+
+	if u := sa.getUser(req); u != nil {
+		u.setHeaders(req)
+		return ""
+	}
+
+	return sa.startLogin(ctx, sp)
+}
+
+func (sa *SAMLAdaptor) respond(ctx *context.Context, statusCode int, body string) string {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(statusCode)
+	resp.SetPayload([]byte(body))
+	ctx.SetOutputResponse(resp)
+	ctx.AddTag("samlAdaptor: " + body)
+	return resultFiltered
+}
+
+func (sa *SAMLAdaptor) redirect(ctx *context.Context, location string, cookie *http.Cookie) string {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusFound)
+	resp.HTTPHeader().Set("Location", location)
+	if cookie != nil {
+		resp.SetCookie(cookie)
+	}
+	ctx.SetOutputResponse(resp)
+	return resultFiltered
+}
+
+func (sa *SAMLAdaptor) handleMetadata(ctx *context.Context, sp *saml.ServiceProvider) string {
+	data, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		logger.Errorf("marshal saml metadata failed: %v", err)
+		return sa.respond(ctx, http.StatusInternalServerError, "marshal metadata failed")
+	}
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.HTTPHeader().Set("Content-Type", "application/samlmetadata+xml")
+	resp.SetPayload(data)
+	ctx.SetOutputResponse(resp)
+	return resultFiltered
+}
+
+// startLogin sends an authentication request to the identity provider, and
+// tracks it by the relay state, so that the response of the identity
+// provider could be validated against it.
+func (sa *SAMLAdaptor) startLogin(ctx *context.Context, sp *saml.ServiceProvider) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	binding := saml.HTTPRedirectBinding
+	if sa.spec.Binding == bindingPost {
+		binding = saml.HTTPPostBinding
+	}
+	authnReq, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(binding), binding, saml.HTTPPostBinding)
+	if err != nil {
+		logger.Errorf("make saml authentication request failed: %v", err)
+		return sa.respond(ctx, http.StatusInternalServerError, "make authentication request failed")
+	}
+
+	relayState := strings.ReplaceAll(uuid.New().String(), "-", "")
+	tr := &trackedRequest{ID: authnReq.ID, URL: req.Std().URL.RequestURI()}
+	data, _ := json.Marshal(tr)
+	if err = sa.store.put(storeKey(relayState), string(data), requestTimeout); err != nil {
+		logger.Errorf("put saml request failed: %v", err)
+		return sa.respond(ctx, http.StatusInternalServerError, "track authentication request failed")
+	}
+
+	if binding == saml.HTTPPostBinding {
+		resp, _ := httpprot.NewResponse(nil)
+		resp.HTTPHeader().Set("Content-Type", "text/html")
+		resp.SetPayload(authnReq.Post(relayState))
+		ctx.SetOutputResponse(resp)
+		return resultFiltered
+	}
+
+	location, err := authnReq.Redirect(relayState, sp)
+	if err != nil {
+		logger.Errorf("make saml redirect url failed: %v", err)
+		return sa.respond(ctx, http.StatusInternalServerError, "make authentication request failed")
+	}
+	return sa.redirect(ctx, location.String(), nil)
+}
+
+// handleACS validates the response of the identity provider, and
+// establishes the session.
+func (sa *SAMLAdaptor) handleACS(ctx *context.Context, sp *saml.ServiceProvider) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	body, err := io.ReadAll(io.LimitReader(req.GetPayload(), maxACSPayload))
+	if err != nil {
+		return sa.respond(ctx, http.StatusBadRequest, "read saml response failed")
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return sa.respond(ctx, http.StatusBadRequest, "invalid saml response")
+	}
+
+	var possibleRequestIDs []string
+	redirectURL := sa.spec.DefaultRedirectURL
+	if relayState := form.Get("RelayState"); relayState != "" {
+		if data := sa.store.get(storeKey(relayState)); data != "" {
+			// a request is only used once to prevent the replay attacks.
+			sa.store.del(storeKey(relayState))
+			tr := &trackedRequest{}
+			if json.Unmarshal([]byte(data), tr) == nil {
+				possibleRequestIDs = append(possibleRequestIDs, tr.ID)
+				redirectURL = tr.URL
+			}
+		}
+	}
+	if possibleRequestIDs == nil && !sa.spec.AllowIDPInitiated {
+		return sa.respond(ctx, http.StatusForbidden, "unknown authentication request")
+	}
+	if redirectURL == "" {
+		redirectURL = "/"
+	}
+
+	xmlResponse, err := base64.StdEncoding.DecodeString(form.Get("SAMLResponse"))
+	if err != nil {
+		return sa.respond(ctx, http.StatusBadRequest, "invalid saml response")
+	}
+	assertion, err := sp.ParseXMLResponse(xmlResponse, possibleRequestIDs)
+	if err != nil {
+		if ire, ok := err.(*saml.InvalidResponseError); ok {
+			err = ire.PrivateErr
+		}
+		logger.Warnf("invalid saml response: %v", err)
+		return sa.respond(ctx, http.StatusForbidden, "authentication failed")
+	}
+
+	cookie, err := sa.newSessionCookie(assertion)
+	if err != nil {
+		logger.Errorf("create saml session failed: %v", err)
+		return sa.respond(ctx, http.StatusInternalServerError, "create session failed")
+	}
+	return sa.redirect(ctx, redirectURL, cookie)
+}
+
+// Status returns Status generated by Runtime.
+func (sa *SAMLAdaptor) Status() interface{} {
+	return nil
+}
+
+// SessionManager returns the manager of the server side sessions, it is nil
+// if the server side sessions are not enabled.
+func (sa *SAMLAdaptor) SessionManager() *session.Manager {
+	return sa.sessions
+}
+
+// Close closes SAMLAdaptor.
+func (sa *SAMLAdaptor) Close() {
+	if sa.sessions != nil {
+		sa.sessions.Close()
+	}
+}
+
+func storeKey(relayState string) string {
+	return "eg_saml_request_" + relayState
+}
+
+func (cs *clusterStore) put(key, value string, timeout time.Duration) error {
+	return cs.cls.PutUnderTimeout(key, value, timeout)
+}
+
+func (cs *clusterStore) get(key string) string {
+	value, err := cs.cls.Get(key)
+	if err != nil {
+		logger.Errorf("get value by key %s failed: %v", key, err)
+	}
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func (cs *clusterStore) del(key string) {
+	if err := cs.cls.Delete(key); err != nil {
+		logger.Errorf("delete key %s failed: %v", key, err)
+	}
+}
@@ -0,0 +1,397 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package samladaptor
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/session"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+type mockStore struct {
+	sync.Mutex
+	m map[string]string
+}
+
+func (ms *mockStore) put(key, value string, timeout time.Duration) error {
+	ms.Lock()
+	defer ms.Unlock()
+	ms.m[key] = value
+	return nil
+}
+
+func (ms *mockStore) get(key string) string {
+	ms.Lock()
+	defer ms.Unlock()
+	return ms.m[key]
+}
+
+func (ms *mockStore) del(key string) {
+	ms.Lock()
+	defer ms.Unlock()
+	delete(ms.m, key)
+}
+
+type mockSPProvider struct {
+	sp *saml.ServiceProvider
+}
+
+func (p *mockSPProvider) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	return p.sp.Metadata(), nil
+}
+
+func newKeyPair(t *testing.T, cn string) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert, key
+}
+
+func pemBase64(typ string, der []byte) string {
+	data := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func newIDP(t *testing.T) *saml.IdentityProvider {
+	cert, key := newKeyPair(t, "idp.example.com")
+	metadataURL, _ := url.Parse("https://idp.example.com/metadata")
+	ssoURL, _ := url.Parse("https://idp.example.com/sso")
+	return &saml.IdentityProvider{
+		Key:         key,
+		Certificate: cert,
+		MetadataURL: *metadataURL,
+		SSOURL:      *ssoURL,
+	}
+}
+
+func newSAMLAdaptor(t *testing.T, rawSpec map[string]interface{}) *SAMLAdaptor {
+	rawSpec["kind"] = Kind
+	rawSpec["name"] = "saml"
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	sa := kind.CreateInstance(spec).(*SAMLAdaptor)
+	sa.store = &mockStore{m: map[string]string{}}
+	sa.Init()
+	return sa
+}
+
+func newBaseSpec(t *testing.T, idp *saml.IdentityProvider) map[string]interface{} {
+	idpMetadata, err := xml.Marshal(idp.Metadata())
+	assert.NoError(t, err)
+
+	return map[string]interface{}{
+		"metadataURL":   "https://sp.example.com/saml/metadata",
+		"acsURL":        "https://sp.example.com/saml/acs",
+		"idpMetadata":   string(idpMetadata),
+		"sessionSecret": "0123456789abcdef",
+	}
+}
+
+func newContext(t *testing.T, method, target string, body string, cookies ...*http.Cookie) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		stdr.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for _, c := range cookies {
+		stdr.AddCookie(c)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	assert.NoError(t, req.FetchPayload(0))
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+// idpLogin sends the request to the service provider, logins the user to the
+// identity provider, and returns the body posted to the ACS endpoint.
+func idpLogin(t *testing.T, idp *saml.IdentityProvider, sa *SAMLAdaptor, target string) string {
+	assert := assert.New(t)
+
+	// redirected to the identity provider.
+	ctx := newContext(t, http.MethodGet, target, "")
+	assert.Equal(resultFiltered, sa.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusFound, resp.StatusCode())
+	location := resp.Std().Header.Get("Location")
+	assert.True(strings.HasPrefix(location, "https://idp.example.com/sso?"))
+
+	// the identity provider authenticates the user, and the response is
+	// encrypted with the certificate of the service provider.
+	idpReq, _ := http.NewRequest(http.MethodGet, location, nil)
+	authnReq, err := saml.NewIdpAuthnRequest(idp, idpReq)
+	assert.NoError(err)
+	assert.NoError(authnReq.Validate())
+	err = saml.DefaultAssertionMaker{}.MakeAssertion(authnReq, &saml.Session{
+		ID:         "session1",
+		CreateTime: time.Now(),
+		ExpireTime: time.Now().Add(time.Hour),
+		NameID:     "alice",
+		UserEmail:  "alice@example.com",
+	})
+	assert.NoError(err)
+	form, err := authnReq.PostBinding()
+	assert.NoError(err)
+	assert.Equal("https://sp.example.com/saml/acs", form.URL)
+
+	return url.Values{
+		"SAMLResponse": {form.SAMLResponse},
+		"RelayState":   {form.RelayState},
+	}.Encode()
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	idp := newIDP(t)
+	idpMetadata, _ := xml.Marshal(idp.Metadata())
+	cert, key := newKeyPair(t, "sp.example.com")
+	certBase64 := pemBase64("CERTIFICATE", cert.Raw)
+	keyBase64 := pemBase64("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+
+	secret := "0123456789abcdef"
+
+	spec := &Spec{IDPMetadata: string(idpMetadata), SessionSecret: secret}
+	assert.NoError(spec.Validate())
+
+	spec = &Spec{IDPMetadataURL: "https://idp.example.com/metadata", SessionSecret: secret}
+	assert.NoError(spec.Validate())
+
+	spec = &Spec{IDPMetadataURL: "https://idp.example.com/metadata", Session: &session.Spec{}}
+	assert.NoError(spec.Validate())
+
+	spec = &Spec{IDPMetadataURL: "https://idp.example.com/metadata"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{IDPMetadata: string(idpMetadata), IDPMetadataURL: "https://idp.example.com/metadata"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{IDPMetadata: "<bad"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{IDPMetadata: string(idpMetadata), CertBase64: certBase64, KeyBase64: keyBase64, SignRequest: true, SessionSecret: secret}
+	assert.NoError(spec.Validate())
+
+	spec = &Spec{IDPMetadata: string(idpMetadata), CertBase64: certBase64}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{IDPMetadata: string(idpMetadata), SignRequest: true}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{IDPMetadata: string(idpMetadata), SessionTTL: "0s", SessionSecret: secret}
+	assert.Error(spec.Validate())
+}
+
+func TestMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	sa := newSAMLAdaptor(t, newBaseSpec(t, newIDP(t)))
+	assert.Equal(Kind, sa.Kind().Name)
+	assert.Equal("saml", sa.Name())
+
+	ctx := newContext(t, http.MethodGet, "https://sp.example.com/saml/metadata", "")
+	assert.Equal(resultFiltered, sa.Handle(ctx))
+
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	ed := &saml.EntityDescriptor{}
+	assert.NoError(xml.Unmarshal(resp.RawPayload(), ed))
+	assert.Equal("https://sp.example.com/saml/metadata", ed.EntityID)
+	assert.Len(ed.SPSSODescriptors, 1)
+}
+
+func TestLogin(t *testing.T) {
+	assert := assert.New(t)
+
+	idp := newIDP(t)
+	rawSpec := newBaseSpec(t, idp)
+	cert, key := newKeyPair(t, "sp.example.com")
+	rawSpec["certBase64"] = pemBase64("CERTIFICATE", cert.Raw)
+	rawSpec["keyBase64"] = pemBase64("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+	sa := newSAMLAdaptor(t, rawSpec)
+	idp.ServiceProviderProvider = &mockSPProvider{sp: sa.sp}
+
+	body := idpLogin(t, idp, sa, "https://sp.example.com/app?x=1")
+
+	// the session is established.
+	ctx := newContext(t, http.MethodPost, "https://sp.example.com/saml/acs", body)
+	assert.Equal(resultFiltered, sa.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusFound, resp.StatusCode())
+	assert.Equal("/app?x=1", resp.Std().Header.Get("Location"))
+	cookies := (&http.Response{Header: resp.Std().Header}).Cookies()
+	assert.Len(cookies, 1)
+	assert.Equal(defaultCookieName, cookies[0].Name)
+	assert.True(cookies[0].Secure)
+	assert.True(cookies[0].HttpOnly)
+
+	// the response can not be replayed.
+	ctx = newContext(t, http.MethodPost, "https://sp.example.com/saml/acs", body)
+	assert.Equal(resultFiltered, sa.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusForbidden, resp.StatusCode())
+
+	// the requests with the session are allowed.
+	ctx = newContext(t, http.MethodGet, "https://sp.example.com/app", "", cookies[0])
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	req.HTTPHeader().Set("X-Authenticated-Userid", "mallory")
+	assert.Empty(sa.Handle(ctx))
+	assert.Equal("alice", req.HTTPHeader().Get("X-Authenticated-Userid"))
+	info, err := base64.StdEncoding.DecodeString(req.HTTPHeader().Get("X-User-Info"))
+	assert.NoError(err)
+	assert.Contains(string(info), "alice@example.com")
+
+	// the tampered session is rejected.
+	cookies[0].Value += "x"
+	ctx = newContext(t, http.MethodGet, "https://sp.example.com/app", "", cookies[0])
+	assert.Equal(resultFiltered, sa.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusFound, resp.StatusCode())
+}
+
+func TestServerSideSession(t *testing.T) {
+	assert := assert.New(t)
+
+	idp := newIDP(t)
+	rawSpec := newBaseSpec(t, idp)
+	delete(rawSpec, "sessionSecret")
+	cert, key := newKeyPair(t, "sp.example.com")
+	rawSpec["certBase64"] = pemBase64("CERTIFICATE", cert.Raw)
+	rawSpec["keyBase64"] = pemBase64("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+	rawSpec["session"] = map[string]interface{}{"ttl": "1h"}
+	sa := newSAMLAdaptor(t, rawSpec)
+	idp.ServiceProviderProvider = &mockSPProvider{sp: sa.sp}
+
+	body := idpLogin(t, idp, sa, "https://sp.example.com/app")
+	ctx := newContext(t, http.MethodPost, "https://sp.example.com/saml/acs", body)
+	assert.Equal(resultFiltered, sa.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusFound, resp.StatusCode())
+	cookies := (&http.Response{Header: resp.Std().Header}).Cookies()
+	assert.Len(cookies, 1)
+	assert.Equal(sa.SessionManager().CookieName(), cookies[0].Name)
+
+	ctx = newContext(t, http.MethodGet, "https://sp.example.com/app", "", cookies[0])
+	assert.Empty(sa.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("alice", req.HTTPHeader().Get("X-Authenticated-Userid"))
+	info, err := base64.StdEncoding.DecodeString(req.HTTPHeader().Get("X-User-Info"))
+	assert.NoError(err)
+	assert.Contains(string(info), "alice@example.com")
+
+	// the sessions are kept by the next generation.
+	next := kind.CreateInstance(sa.spec).(*SAMLAdaptor)
+	next.store = sa.store
+	next.Inherit(sa)
+	sa.Close()
+	assert.Same(sa.SessionManager(), next.SessionManager())
+	ctx = newContext(t, http.MethodGet, "https://sp.example.com/app", "", cookies[0])
+	assert.Empty(next.Handle(ctx))
+
+	// the invalidated sessions are rejected.
+	n, err := next.SessionManager().DeleteSubject("alice")
+	assert.NoError(err)
+	assert.Equal(1, n)
+	ctx = newContext(t, http.MethodGet, "https://sp.example.com/app", "", cookies[0])
+	assert.Equal(resultFiltered, next.Handle(ctx))
+
+	next.Close()
+}
+
+func TestInvalidResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	sa := newSAMLAdaptor(t, newBaseSpec(t, newIDP(t)))
+
+	// unknown relay state.
+	body := url.Values{"SAMLResponse": {"x"}, "RelayState": {"unknown"}}.Encode()
+	ctx := newContext(t, http.MethodPost, "https://sp.example.com/saml/acs", body)
+	assert.Equal(resultFiltered, sa.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusForbidden, resp.StatusCode())
+
+	// a response not signed by the identity provider.
+	ctx = newContext(t, http.MethodGet, "https://sp.example.com/app", "")
+	sa.Handle(ctx)
+	location, _ := url.Parse(ctx.GetOutputResponse().(*httpprot.Response).Std().Header.Get("Location"))
+	relayState := location.Query().Get("RelayState")
+	assert.NotEmpty(relayState)
+
+	fake := base64.StdEncoding.EncodeToString([]byte(`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol"></samlp:Response>`))
+	body = url.Values{"SAMLResponse": {fake}, "RelayState": {relayState}}.Encode()
+	ctx = newContext(t, http.MethodPost, "https://sp.example.com/saml/acs", body)
+	assert.Equal(resultFiltered, sa.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusForbidden, resp.StatusCode())
+}
+
+func TestPostBinding(t *testing.T) {
+	assert := assert.New(t)
+
+	rawSpec := newBaseSpec(t, newIDP(t))
+	rawSpec["binding"] = "post"
+	sa := newSAMLAdaptor(t, rawSpec)
+
+	ctx := newContext(t, http.MethodGet, "https://sp.example.com/app", "")
+	assert.Equal(resultFiltered, sa.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("text/html", resp.Std().Header.Get("Content-Type"))
+	assert.Contains(string(resp.RawPayload()), `name="SAMLRequest"`)
+	assert.Len(sa.store.(*mockStore).m, 1)
+
+	sa.Close()
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package samladaptor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const userInfoKey = "userInfo"
+
+type (
+	// user is the authenticated user of a request.
+	user struct {
+		subject string
+		// info is the base64 encoded JSON of the name ID and the
+		// attributes of the user.
+		info string
+	}
+
+	// signedSession is the session kept in a cookie signed by the session
+	// secret, it is used if the server side sessions are not enabled.
+	signedSession struct {
+		jwt.RegisteredClaims
+		Attributes map[string][]string `json:"attrs,omitempty"`
+	}
+)
+
+func newUser(subject string, attributes map[string][]string) *user {
+	info := map[string]interface{}{
+		"sub":        subject,
+		"attributes": attributes,
+	}
+	data, _ := json.Marshal(info)
+	return &user{subject: subject, info: base64.StdEncoding.EncodeToString(data)}
+}
+
+// setHeaders sets the user to the request headers, which overwrites the
+// headers from the client.
+func (u *user) setHeaders(req *httpprot.Request) {
+	h := req.HTTPHeader()
+	h.Set("X-Authenticated-Userid", u.subject)
+	h.Set("X-User-Info", u.info)
+}
+
+// sessionDeadline returns the time the session of the assertion expires.
+func sessionDeadline(assertion *saml.Assertion, ttl time.Duration) time.Time {
+	deadline := time.Now().Add(ttl)
+	for _, as := range assertion.AuthnStatements {
+		if as.SessionNotOnOrAfter != nil && as.SessionNotOnOrAfter.Before(deadline) {
+			deadline = *as.SessionNotOnOrAfter
+		}
+	}
+	return deadline
+}
+
+func assertionUser(assertion *saml.Assertion) (string, map[string][]string) {
+	subject := ""
+	if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		subject = assertion.Subject.NameID.Value
+	}
+
+	attributes := map[string][]string{}
+	for _, stmt := range assertion.AttributeStatements {
+		for _, attr := range stmt.Attributes {
+			name := attr.FriendlyName
+			if name == "" {
+				name = attr.Name
+			}
+			for _, v := range attr.Values {
+				attributes[name] = append(attributes[name], v.Value)
+			}
+		}
+	}
+	return subject, attributes
+}
+
+func (sa *SAMLAdaptor) cookieName() string {
+	if sa.spec.CookieName != "" {
+		return sa.spec.CookieName
+	}
+	return defaultCookieName
+}
+
+// newSessionCookie establishes the session of the assertion, and returns
+// the cookie of it.
+func (sa *SAMLAdaptor) newSessionCookie(assertion *saml.Assertion) (*http.Cookie, error) {
+	subject, attributes := assertionUser(assertion)
+
+	if sa.sessions != nil {
+		u := newUser(subject, attributes)
+		s, err := sa.sessions.Create(subject, map[string]string{userInfoKey: u.info})
+		if err != nil {
+			return nil, err
+		}
+		return sa.sessions.Cookie(s), nil
+	}
+
+	now := time.Now()
+	s := &signedSession{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(sessionDeadline(assertion, sa.sessionTTL)),
+		},
+		Attributes: attributes,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, s)
+	value, err := token.SignedString([]byte(sa.spec.SessionSecret))
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Cookie{
+		Name:     sa.cookieName(),
+		Value:    value,
+		Path:     "/",
+		Expires:  s.ExpiresAt.Time,
+		Secure:   sa.secureCookie,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}, nil
+}
+
+// getUser returns the user of the request, it is nil if the request has no
+// valid session.
+func (sa *SAMLAdaptor) getUser(req *httpprot.Request) *user {
+	if sa.sessions != nil {
+		s := sa.sessions.Get(req.Std())
+		if s == nil {
+			return nil
+		}
+		return &user{subject: s.Subject, info: s.Values[userInfoKey]}
+	}
+
+	cookie, err := req.Cookie(sa.cookieName())
+	if err != nil {
+		return nil
+	}
+
+	s := &signedSession{}
+	_, err = jwt.ParseWithClaims(cookie.Value, s, func(token *jwt.Token) (interface{}, error) {
+		if alg := token.Method.Alg(); alg != jwt.SigningMethodHS256.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", alg)
+		}
+		return []byte(sa.spec.SessionSecret), nil
+	})
+	if err != nil {
+		return nil
+	}
+	return newUser(s.Subject, s.Attributes)
+}
@@ -0,0 +1,417 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package scattergather implements a filter to call several upstreams in
+// parallel and merge their responses into one.
+package scattergather
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	sprig "github.com/go-task/slim-sprig"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of ScatterGather.
+	Kind = "ScatterGather"
+
+	resultTargetFailed = "targetFailed"
+	resultBuildErr     = "buildErr"
+
+	defaultTimeout = 5 * time.Second
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ScatterGather calls several upstreams in parallel and merges their JSON responses into one.",
+	Results:     []string{resultTargetFailed, resultBuildErr},
+	Indicators: []*filters.Indicator{
+		{Name: "targets.*.requests", Description: "Number of the calls to the target", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "targets.*.failures", Description: "Number of the calls to the target failed or responded with a non-2xx status code", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ScatterGather{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+// All ScatterGather instances use one client to reuse the keepalive
+// connections.
+var globalClient = &http.Client{
+	// the timeout is controlled by the context of the requests.
+	Timeout: 0,
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		MaxIdleConns:          10240,
+		MaxIdleConnsPerHost:   512,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+}
+
+type (
+	// ScatterGather is the filter to call several upstreams in parallel
+	// and merge their responses.
+	ScatterGather struct {
+		spec     *Spec
+		client   *http.Client
+		timeout  time.Duration
+		targets  []*target
+		template *template.Template
+	}
+
+	// Spec is the spec of ScatterGather.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Timeout is the timeout of the calls to the targets, default is
+		// 5s.
+		Timeout string `json:"timeout,omitempty" jsonschema:"format=duration"`
+		// MaxBodySize is the max size of the response bodies of the
+		// targets, default is 4MB. The bodies are merged, so they can't
+		// be streams.
+		MaxBodySize int64 `json:"maxBodySize,omitempty" jsonschema:"minimum=0"`
+		// Targets are the upstreams to call.
+		Targets []*TargetSpec `json:"targets" jsonschema:"required,minItems=1"`
+		// Template is the Go template building the JSON body of the merged
+		// response, the responses of the targets are referenced as
+		// .responses.<name>. By default, the response is a JSON object
+		// with the JSON bodies of the targets keyed by their names.
+		Template string `json:"template,omitempty"`
+	}
+
+	// TargetSpec is the spec of a target.
+	TargetSpec struct {
+		Name string `json:"name" jsonschema:"required"`
+		// URL is the Go template of the URL of the target, the request is
+		// referenced as .req, like
+		// http://127.0.0.1:9095/users/{{.req.URL.Query.Get "id"}}.
+		URL    string `json:"url" jsonschema:"required"`
+		Method string `json:"method,omitempty" jsonschema:"format=httpmethod"`
+		// Headers are the headers set to the request to the target.
+		Headers map[string]string `json:"headers,omitempty"`
+		// ForwardHeaders are the headers copied from the request.
+		ForwardHeaders []string `json:"forwardHeaders,omitempty"`
+		// ForwardBody sends the body of the request to the target.
+		ForwardBody bool `json:"forwardBody,omitempty"`
+		// Optional targets do not fail the request, their errors are
+		// referenced as .errors.<name> in the template.
+		Optional bool `json:"optional,omitempty"`
+	}
+
+	// Status is the status of ScatterGather.
+	Status struct {
+		Targets map[string]*TargetStatus `json:"targets"`
+	}
+
+	// TargetStatus is the status of a target.
+	TargetStatus struct {
+		Requests uint64 `json:"requests"`
+		// Failures are the requests failed, or with a non-2xx status code.
+		Failures uint64 `json:"failures"`
+	}
+
+	target struct {
+		spec     *TargetSpec
+		url      *template.Template
+		requests uint64
+		failures uint64
+	}
+
+	// gathered is the result of a call to a target.
+	gathered struct {
+		resp *httpprot.Response
+		err  error
+	}
+)
+
+func newTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(sprig.TxtFuncMap()).Parse(text)
+}
+
+// Validate validates the spec of ScatterGather.
+func (s *Spec) Validate() error {
+	if s.MaxBodySize < 0 {
+		return fmt.Errorf("maxBodySize can't be negative")
+	}
+	names := map[string]bool{}
+	for _, t := range s.Targets {
+		if names[t.Name] {
+			return fmt.Errorf("duplicated target %s", t.Name)
+		}
+		names[t.Name] = true
+		if _, err := newTemplate(t.Name, t.URL); err != nil {
+			return fmt.Errorf("target %s: invalid url template: %v", t.Name, err)
+		}
+	}
+	if s.Template != "" {
+		if _, err := newTemplate("", s.Template); err != nil {
+			return fmt.Errorf("invalid template: %v", err)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the ScatterGather filter instance.
+func (sg *ScatterGather) Name() string {
+	return sg.spec.Name()
+}
+
+// Kind returns the kind of ScatterGather.
+func (sg *ScatterGather) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ScatterGather.
+func (sg *ScatterGather) Spec() filters.Spec {
+	return sg.spec
+}
+
+// Init initializes ScatterGather.
+func (sg *ScatterGather) Init() {
+	sg.reload()
+}
+
+// Inherit inherits previous generation of ScatterGather.
+func (sg *ScatterGather) Inherit(previousGeneration filters.Filter) {
+	sg.reload()
+}
+
+func (sg *ScatterGather) reload() {
+	if sg.client == nil {
+		sg.client = globalClient
+	}
+
+	sg.timeout = defaultTimeout
+	if sg.spec.Timeout != "" {
+		sg.timeout, _ = time.ParseDuration(sg.spec.Timeout)
+	}
+
+	// the spec has been validated, so the errors are impossible.
+	for _, spec := range sg.spec.Targets {
+		t := &target{spec: spec}
+		t.url, _ = newTemplate(spec.Name, spec.URL)
+		sg.targets = append(sg.targets, t)
+	}
+	if sg.spec.Template != "" {
+		sg.template, _ = newTemplate("", sg.spec.Template)
+	}
+}
+
+// NeedPayload returns whether the payload of the request is needed, it
+// implements context.PayloadNeeder.
+func (sg *ScatterGather) NeedPayload() (request, response bool) {
+	for _, t := range sg.spec.Targets {
+		if t.ForwardBody || strings.Contains(t.URL, "Body") {
+			return true, false
+		}
+	}
+	return strings.Contains(sg.spec.Template, ".req"), false
+}
+
+// Handle calls the targets in parallel, and merges their responses into
+// the response of the request.
+func (sg *ScatterGather) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	data := map[string]interface{}{
+		"req": req.ToBuilderRequest(ctx.Namespace()),
+	}
+
+	// the urls are built before the calls, as the templates are not safe
+	// to execute concurrently on the same request.
+	results := make([]gathered, len(sg.targets))
+	urls := make([]string, len(sg.targets))
+	for i, t := range sg.targets {
+		var url bytes.Buffer
+		if err := t.url.Execute(&url, data); err != nil {
+			results[i].err = fmt.Errorf("build url: %v", err)
+		}
+		urls[i] = url.String()
+	}
+
+	stdctx, cancel := stdcontext.WithTimeout(req.Context(), sg.timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i, t := range sg.targets {
+		if results[i].err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, t *target) {
+			defer wg.Done()
+			results[i].resp, results[i].err = sg.call(stdctx, t, urls[i], req)
+		}(i, t)
+	}
+	wg.Wait()
+
+	for i, t := range sg.targets {
+		atomic.AddUint64(&t.requests, 1)
+		if results[i].err != nil {
+			atomic.AddUint64(&t.failures, 1)
+		}
+	}
+
+	responses := map[string]interface{}{}
+	errs := map[string]string{}
+	for i, t := range sg.targets {
+		r := &results[i]
+		if r.err != nil {
+			errs[t.spec.Name] = r.err.Error()
+			if !t.spec.Optional {
+				logger.Warnf("ScatterGather(%s): target %s failed: %v", sg.Name(), t.spec.Name, r.err)
+				sg.fail(ctx, t.spec.Name)
+				return resultTargetFailed
+			}
+			continue
+		}
+		responses[t.spec.Name] = r.resp.ToBuilderResponse(t.spec.Name)
+	}
+	data["responses"] = responses
+	data["errors"] = errs
+
+	body, err := sg.merge(data, results)
+	if err != nil {
+		logger.Warnf("ScatterGather(%s): failed to merge responses: %v", sg.Name(), err)
+		return resultBuildErr
+	}
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusOK)
+	resp.HTTPHeader().Set("Content-Type", "application/json")
+	resp.SetPayload(body)
+	ctx.SetOutputResponse(resp)
+	return ""
+}
+
+// call calls a target, a response with a non-2xx status code is an error.
+func (sg *ScatterGather) call(stdctx stdcontext.Context, t *target, url string, req *httpprot.Request) (*httpprot.Response, error) {
+	method := t.spec.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body *bytes.Reader
+	if t.spec.ForwardBody && !req.IsStream() {
+		body = bytes.NewReader(req.RawPayload())
+	} else {
+		body = bytes.NewReader(nil)
+	}
+
+	stdr, err := http.NewRequestWithContext(stdctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range t.spec.ForwardHeaders {
+		if values := req.HTTPHeader().Values(h); len(values) > 0 {
+			stdr.Header[http.CanonicalHeaderKey(h)] = append([]string(nil), values...)
+		}
+	}
+	for k, v := range t.spec.Headers {
+		stdr.Header.Set(k, v)
+	}
+
+	stdresp, err := sg.client.Do(stdr)
+	if err != nil {
+		return nil, err
+	}
+	defer stdresp.Body.Close()
+
+	resp, err := httpprot.NewResponse(stdresp)
+	if err != nil {
+		return nil, err
+	}
+	if err = resp.FetchPayload(sg.spec.MaxBodySize); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() < 200 || resp.StatusCode() > 299 {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode())
+	}
+	return resp, nil
+}
+
+// merge builds the body of the merged response.
+func (sg *ScatterGather) merge(data map[string]interface{}, results []gathered) ([]byte, error) {
+	if sg.template == nil {
+		merged := map[string]json.RawMessage{}
+		for i, t := range sg.targets {
+			r := &results[i]
+			if r.err != nil {
+				continue
+			}
+			payload := r.resp.RawPayload()
+			if !json.Valid(payload) {
+				return nil, fmt.Errorf("the response of target %s is not JSON", t.spec.Name)
+			}
+			merged[t.spec.Name] = payload
+		}
+		return json.Marshal(merged)
+	}
+
+	var buf bytes.Buffer
+	if err := sg.template.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("the result of the template is not JSON: %s", buf.String())
+	}
+	return buf.Bytes(), nil
+}
+
+// fail sets a 502 response for the failure of the target.
+func (sg *ScatterGather) fail(ctx *context.Context, name string) {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusBadGateway)
+	resp.HTTPHeader().Set("X-EG-Scatter-Gather", "target "+name+" failed")
+	ctx.SetOutputResponse(resp)
+}
+
+// Status returns Status generated by Runtime.
+func (sg *ScatterGather) Status() interface{} {
+	s := &Status{Targets: map[string]*TargetStatus{}}
+	for _, t := range sg.targets {
+		s.Targets[t.spec.Name] = &TargetStatus{
+			Requests: atomic.LoadUint64(&t.requests),
+			Failures: atomic.LoadUint64(&t.failures),
+		}
+	}
+	return s
+}
+
+// Close closes ScatterGather.
+func (sg *ScatterGather) Close() {
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scattergather
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newScatterGather(t *testing.T, yamlConfig string) *ScatterGather {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	sg := kind.CreateInstance(spec).(*ScatterGather)
+	sg.Init()
+	return sg
+}
+
+func newContext(t *testing.T) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/profile?id=42", nil)
+	stdr.Header.Set("Authorization", "Bearer token")
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func newServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/users/42":
+			fmt.Fprintf(w, `{"id":42,"name":"alice","auth":%q}`, r.Header.Get("Authorization"))
+		case "/orders":
+			fmt.Fprintf(w, `[{"id":1,"user":%q}]`, r.URL.Query().Get("user"))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{Targets: []*TargetSpec{{Name: "a", URL: "http://a"}}}).Validate())
+	assert.Error((&Spec{Targets: []*TargetSpec{{Name: "a", URL: "http://a"}, {Name: "a", URL: "http://b"}}}).Validate())
+	assert.Error((&Spec{Targets: []*TargetSpec{{Name: "a", URL: "http://{{"}}}).Validate())
+	assert.Error((&Spec{Targets: []*TargetSpec{{Name: "a", URL: "http://a"}}, Template: "{{"}).Validate())
+	assert.Error((&Spec{Targets: []*TargetSpec{{Name: "a", URL: "http://a"}}, MaxBodySize: -1}).Validate())
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newServer()
+	defer server.Close()
+
+	sg := newScatterGather(t, fmt.Sprintf(`
+kind: ScatterGather
+name: sg
+targets:
+- name: user
+  url: %[1]s/users/{{.req.URL.Query.Get "id"}}
+  forwardHeaders: [Authorization]
+- name: orders
+  url: %[1]s/orders?user={{.req.URL.Query.Get "id"}}
+`, server.URL))
+	defer sg.Close()
+
+	ctx := newContext(t)
+	assert.Equal("", sg.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.JSONEq(`{"user":{"id":42,"name":"alice","auth":"Bearer token"},"orders":[{"id":1,"user":"42"}]}`, string(resp.RawPayload()))
+}
+
+func TestTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newServer()
+	defer server.Close()
+
+	sg := newScatterGather(t, fmt.Sprintf(`
+kind: ScatterGather
+name: sg
+targets:
+- name: user
+  url: %[1]s/users/42
+- name: recommendations
+  url: %[1]s/recommendations
+  optional: true
+template: |
+  {
+    "name": {{.responses.user.JSONBody.name | toJson}},
+    "recommendations": {{if .errors.recommendations}}[]{{else}}{{.responses.recommendations.Body}}{{end}}
+  }
+`, server.URL))
+	defer sg.Close()
+
+	ctx := newContext(t)
+	assert.Equal("", sg.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.JSONEq(`{"name":"alice","recommendations":[]}`, string(resp.RawPayload()))
+
+	status := sg.Status().(*Status)
+	assert.Equal(&TargetStatus{Requests: 1, Failures: 0}, status.Targets["user"])
+	assert.Equal(&TargetStatus{Requests: 1, Failures: 1}, status.Targets["recommendations"])
+}
+
+func TestTargetFailed(t *testing.T) {
+	assert := assert.New(t)
+
+	server := newServer()
+	defer server.Close()
+
+	sg := newScatterGather(t, fmt.Sprintf(`
+kind: ScatterGather
+name: sg
+targets:
+- name: user
+  url: %[1]s/users/42
+- name: broken
+  url: %[1]s/broken
+`, server.URL))
+	defer sg.Close()
+
+	ctx := newContext(t)
+	assert.Equal(resultTargetFailed, sg.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusBadGateway, resp.StatusCode())
+	assert.Equal("target broken failed", resp.HTTPHeader().Get("X-EG-Scatter-Gather"))
+}
@@ -0,0 +1,706 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package soapadaptor implements a filter to bridge SOAP clients to REST
+// services.
+package soapadaptor
+
+import (
+	"bytes"
+	stdcontext "context"
+	"crypto/tls"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const (
+	// Kind is the kind of SOAPAdaptor.
+	Kind = "SOAPAdaptor"
+
+	resultClientError = "clientError"
+	resultServerError = "serverError"
+
+	soap11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+
+	soap11ContentType = "text/xml; charset=utf-8"
+	soap12ContentType = "application/soap+xml; charset=utf-8"
+
+	paramInPath   = "path"
+	paramInQuery  = "query"
+	paramInBody   = "body"
+	paramInHeader = "header"
+
+	// 4MB
+	maxUpstreamBodyBytes = 4 * 1024 * 1024
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "SOAPAdaptor converts SOAP requests to REST calls and wraps the responses back into SOAP.",
+	Results:     []string{resultClientError, resultServerError},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &SOAPAdaptor{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+// All SOAPAdaptor instances use the global clients in order to reuse
+// keepalive connections to the REST services, insecureClient is used by
+// the instances which don't verify the certificates of the services.
+var (
+	globalClient   = newHTTPClient(false)
+	insecureClient = newHTTPClient(true)
+)
+
+var fnSendRequest = func(client *http.Client, r *http.Request) (*http.Response, error) {
+	return client.Do(r)
+}
+
+func newHTTPClient(insecureSkipVerify bool) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 60 * time.Second,
+			}).DialContext,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: insecureSkipVerify,
+			},
+			MaxIdleConns:          10240,
+			MaxIdleConnsPerHost:   512,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+	}
+}
+
+type (
+	// SOAPAdaptor is the filter to bridge SOAP clients to REST services.
+	SOAPAdaptor struct {
+		spec *Spec
+
+		timeout    time.Duration
+		client     *http.Client
+		operations []*operation
+	}
+
+	// Spec describes the SOAPAdaptor.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Endpoint is the base URL of the REST service.
+		Endpoint string `json:"endpoint" jsonschema:"required,format=url"`
+		Timeout  string `json:"timeout,omitempty" jsonschema:"format=duration"`
+		// Namespace is the namespace of the response element, defaults to
+		// the namespace of the operation element in the request.
+		Namespace  string           `json:"namespace,omitempty"`
+		Operations []*OperationSpec `json:"operations" jsonschema:"required"`
+		// InsecureSkipVerify disables verifying the certificate of the
+		// REST service, it should only be used for testing.
+		InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+	}
+
+	// OperationSpec describes how to convert a SOAP operation to a REST call.
+	OperationSpec struct {
+		// Name is the local name of the operation element in the SOAP body.
+		Name string `json:"name" jsonschema:"required"`
+		// SOAPAction is used to match the operation when it is not empty
+		// and the request carries a SOAPAction.
+		SOAPAction string `json:"soapAction,omitempty"`
+		Method     string `json:"method,omitempty" jsonschema:"format=httpmethod"`
+		// Path is the path of the REST call, it could contain parameters
+		// in the form of {name}.
+		Path string `json:"path" jsonschema:"required,pattern=^/"`
+		// ResponseElement is the local name of the response element,
+		// defaults to Name + "Response".
+		ResponseElement string       `json:"responseElement,omitempty"`
+		Params          []*ParamSpec `json:"params,omitempty"`
+	}
+
+	// ParamSpec describes a parameter extracted from the SOAP request.
+	ParamSpec struct {
+		Name string `json:"name" jsonschema:"required"`
+		// XPath is evaluated with the operation element being the context
+		// node if it is relative, or the document if it is absolute.
+		XPath string `json:"xpath" jsonschema:"required"`
+		// In is the location of the parameter in the REST call, the default
+		// value is 'path' if the path contains the parameter, 'query' for
+		// GET, HEAD and DELETE requests, and 'body' for others.
+		In string `json:"in,omitempty" jsonschema:"enum=,enum=path,enum=query,enum=body,enum=header"`
+	}
+
+	// operation is the runtime of an OperationSpec, with the defaults of
+	// the spec resolved.
+	operation struct {
+		spec            *OperationSpec
+		method          string
+		responseElement string
+		params          []*param
+	}
+
+	param struct {
+		spec  *ParamSpec
+		xpath *xpath
+		in    string
+	}
+
+	envelope struct {
+		namespace string
+		operation *node
+	}
+
+	soapError struct {
+		client bool
+		msg    string
+	}
+)
+
+var _ filters.Filter = (*SOAPAdaptor)(nil)
+
+// Error implements error.
+func (e *soapError) Error() string {
+	return e.msg
+}
+
+// Validate validates the spec.
+func (s *Spec) Validate() error {
+	if len(s.Operations) == 0 {
+		return fmt.Errorf("no operation is defined")
+	}
+
+	names := map[string]struct{}{}
+	for _, op := range s.Operations {
+		if _, ok := names[op.Name]; ok {
+			return fmt.Errorf("duplicated operation: %s", op.Name)
+		}
+		names[op.Name] = struct{}{}
+
+		for _, p := range op.Params {
+			if _, err := compileXPath(p.XPath); err != nil {
+				return fmt.Errorf("operation %s, param %s: %v", op.Name, p.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Name returns the name of the SOAPAdaptor filter instance.
+func (sa *SOAPAdaptor) Name() string {
+	return sa.spec.Name()
+}
+
+// Kind returns the kind of SOAPAdaptor.
+func (sa *SOAPAdaptor) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the SOAPAdaptor
+func (sa *SOAPAdaptor) Spec() filters.Spec {
+	return sa.spec
+}
+
+// Init initializes SOAPAdaptor.
+func (sa *SOAPAdaptor) Init() {
+	sa.reload()
+}
+
+// Inherit inherits previous generation of SOAPAdaptor.
+func (sa *SOAPAdaptor) Inherit(previousGeneration filters.Filter) {
+	sa.Init()
+}
+
+func (sa *SOAPAdaptor) reload() {
+	if sa.spec.Timeout != "" {
+		sa.timeout, _ = time.ParseDuration(sa.spec.Timeout)
+	}
+
+	sa.client = globalClient
+	if sa.spec.InsecureSkipVerify {
+		sa.client = insecureClient
+		logger.Warnf("%s: insecureSkipVerify is enabled, certificates of the REST service are NOT verified, "+
+			"connections are vulnerable to man-in-the-middle attacks", sa.Name())
+	}
+
+	sa.operations = nil
+	for _, opSpec := range sa.spec.Operations {
+		op := &operation{
+			spec:            opSpec,
+			method:          opSpec.Method,
+			responseElement: opSpec.ResponseElement,
+		}
+		if op.method == "" {
+			op.method = http.MethodPost
+		}
+		if op.responseElement == "" {
+			op.responseElement = opSpec.Name + "Response"
+		}
+
+		for _, pSpec := range opSpec.Params {
+			// the xpath is validated in Validate, the error is impossible.
+			xp, _ := compileXPath(pSpec.XPath)
+			op.params = append(op.params, &param{
+				spec:  pSpec,
+				xpath: xp,
+				in:    op.paramLocation(pSpec),
+			})
+		}
+		sa.operations = append(sa.operations, op)
+	}
+}
+
+func (op *operation) paramLocation(p *ParamSpec) string {
+	if p.In != "" {
+		return p.In
+	}
+
+	if strings.Contains(op.spec.Path, "{"+p.Name+"}") {
+		return paramInPath
+	}
+
+	switch op.method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		return paramInQuery
+	}
+
+	return paramInBody
+}
+
+func parseEnvelope(data []byte) (*envelope, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if root.Local != "Envelope" {
+		return nil, fmt.Errorf("root element is %s, not Envelope", root.Local)
+	}
+
+	switch root.Space {
+	case soap11Namespace, soap12Namespace:
+	default:
+		return nil, fmt.Errorf("unknown SOAP envelope namespace: %q", root.Space)
+	}
+
+	body := root.child("Body")
+	if body == nil {
+		return nil, fmt.Errorf("no Body in envelope")
+	}
+
+	op := body.firstChild()
+	if op == nil {
+		return nil, fmt.Errorf("no operation in Body")
+	}
+
+	return &envelope{namespace: root.Space, operation: op}, nil
+}
+
+func (sa *SOAPAdaptor) findOperation(env *envelope, soapAction string) *operation {
+	soapAction = strings.Trim(soapAction, `"`)
+
+	for _, op := range sa.operations {
+		if op.spec.SOAPAction != "" && soapAction != "" {
+			if op.spec.SOAPAction == soapAction {
+				return op
+			}
+			continue
+		}
+		if op.spec.Name == env.operation.Local {
+			return op
+		}
+	}
+
+	return nil
+}
+
+func getSOAPAction(req *httpprot.Request) string {
+	if action := req.HTTPHeader().Get("SOAPAction"); action != "" {
+		return action
+	}
+
+	// SOAP 1.2 carries the action in the content type.
+	ct := req.HTTPHeader().Get("Content-Type")
+	for _, part := range strings.Split(ct, ";") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "action=") {
+			return strings.Trim(part[len("action="):], `"`)
+		}
+	}
+
+	return ""
+}
+
+func stringify(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return string(codectool.MustMarshalJSON(v))
+	}
+}
+
+func (sa *SOAPAdaptor) buildRESTRequest(ctx stdcontext.Context, op *operation, env *envelope) (*http.Request, error) {
+	path := op.spec.Path
+	query := url.Values{}
+	header := http.Header{}
+	body := map[string]interface{}{}
+
+	for _, p := range op.params {
+		v := p.xpath.evaluate(env.operation)
+
+		switch p.in {
+		case paramInPath:
+			path = strings.ReplaceAll(path, "{"+p.spec.Name+"}", url.PathEscape(stringify(v)))
+		case paramInQuery:
+			if arr, ok := v.([]interface{}); ok {
+				for _, item := range arr {
+					query.Add(p.spec.Name, stringify(item))
+				}
+			} else if v != nil {
+				query.Add(p.spec.Name, stringify(v))
+			}
+		case paramInHeader:
+			if v != nil {
+				header.Set(p.spec.Name, stringify(v))
+			}
+		default:
+			body[p.spec.Name] = v
+		}
+	}
+
+	u := strings.TrimSuffix(sa.spec.Endpoint, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var payload io.Reader
+	if len(body) > 0 {
+		data, err := codectool.MarshalJSON(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = bytes.NewReader(data)
+	}
+
+	stdr, err := http.NewRequestWithContext(ctx, op.method, u, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	stdr.Header = header
+	stdr.Header.Set("Accept", "application/json")
+	if payload != nil {
+		stdr.Header.Set("Content-Type", "application/json")
+	}
+
+	return stdr, nil
+}
+
+func (sa *SOAPAdaptor) callREST(ctx stdcontext.Context, op *operation, env *envelope) (interface{}, error) {
+	if sa.timeout > 0 {
+		var cancel stdcontext.CancelFunc
+		ctx, cancel = stdcontext.WithTimeout(ctx, sa.timeout)
+		defer cancel()
+	}
+
+	stdr, err := sa.buildRESTRequest(ctx, op, env)
+	if err != nil {
+		return nil, &soapError{msg: fmt.Sprintf("build REST request: %v", err)}
+	}
+
+	resp, err := fnSendRequest(sa.client, stdr)
+	if err != nil {
+		return nil, &soapError{msg: fmt.Sprintf("call REST service: %v", err)}
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamBodyBytes+1))
+	if err != nil {
+		return nil, &soapError{msg: fmt.Sprintf("read REST response: %v", err)}
+	}
+	if len(data) > maxUpstreamBodyBytes {
+		return nil, &soapError{msg: fmt.Sprintf("REST response is larger than %dB", maxUpstreamBodyBytes)}
+	}
+
+	if resp.StatusCode >= 300 {
+		msg := fmt.Sprintf("REST service returns status code %d", resp.StatusCode)
+		return nil, &soapError{client: resp.StatusCode < 500, msg: msg}
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	var result interface{}
+	if err = codectool.UnmarshalJSON(data, &result); err != nil {
+		// not a JSON response, use it as a text value.
+		return string(data), nil
+	}
+	return result, nil
+}
+
+// Handle converts the SOAP request to a REST call and wraps the REST
+// response into a SOAP response.
+func (sa *SOAPAdaptor) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	env, err := parseEnvelope(req.RawPayload())
+	if err != nil {
+		ctx.AddTag(fmt.Sprintf("soapAdaptor: invalid envelope: %v", err))
+		sa.buildFault(ctx, soap11Namespace, &soapError{client: true, msg: err.Error()})
+		return resultClientError
+	}
+
+	op := sa.findOperation(env, getSOAPAction(req))
+	if op == nil {
+		msg := fmt.Sprintf("unknown operation %s", env.operation.Local)
+		ctx.AddTag("soapAdaptor: " + msg)
+		sa.buildFault(ctx, env.namespace, &soapError{client: true, msg: msg})
+		return resultClientError
+	}
+
+	result, err := sa.callREST(req.Context(), op, env)
+	if err != nil {
+		logger.Errorf("%s: operation %s failed: %v", sa.Name(), op.spec.Name, err)
+		ctx.AddTag(fmt.Sprintf("soapAdaptor: %v", err))
+		se := err.(*soapError)
+		sa.buildFault(ctx, env.namespace, se)
+		if se.client {
+			return resultClientError
+		}
+		return resultServerError
+	}
+
+	ns := sa.spec.Namespace
+	if ns == "" {
+		ns = env.operation.Space
+	}
+
+	var buf bytes.Buffer
+	w := newEnvelopeWriter(&buf, env.namespace)
+	w.start(xml.Name{Local: "m:" + op.responseElement}, xml.Attr{Name: xml.Name{Local: "xmlns:m"}, Value: ns})
+	w.writeValue(result, "item")
+	w.end(xml.Name{Local: "m:" + op.responseElement})
+	if err = w.close(); err != nil {
+		logger.Errorf("%s: operation %s failed to convert the REST response: %v", sa.Name(), op.spec.Name, err)
+		ctx.AddTag(fmt.Sprintf("soapAdaptor: invalid REST response: %v", err))
+		sa.buildFault(ctx, env.namespace, &soapError{msg: fmt.Sprintf("convert REST response: %v", err)})
+		return resultServerError
+	}
+
+	sa.setResponse(ctx, env.namespace, http.StatusOK, buf.Bytes())
+	return ""
+}
+
+func (sa *SOAPAdaptor) buildFault(ctx *context.Context, soapNamespace string, e *soapError) {
+	var buf bytes.Buffer
+	w := newEnvelopeWriter(&buf, soapNamespace)
+	w.start(xml.Name{Local: "soap:Fault"})
+
+	if soapNamespace == soap12Namespace {
+		code := "soap:Receiver"
+		if e.client {
+			code = "soap:Sender"
+		}
+		w.start(xml.Name{Local: "soap:Code"})
+		w.element("soap:Value", code)
+		w.end(xml.Name{Local: "soap:Code"})
+		w.start(xml.Name{Local: "soap:Reason"})
+		w.element("soap:Text", e.msg)
+		w.end(xml.Name{Local: "soap:Reason"})
+	} else {
+		code := "soap:Server"
+		if e.client {
+			code = "soap:Client"
+		}
+		w.element("faultcode", code)
+		w.element("faultstring", e.msg)
+	}
+
+	w.end(xml.Name{Local: "soap:Fault"})
+
+	statusCode := http.StatusInternalServerError
+	if err := w.close(); err != nil {
+		// the fault has fixed element names, it never happens in theory.
+		logger.Errorf("%s: failed to build SOAP fault: %v", sa.Name(), err)
+		sa.setResponse(ctx, soapNamespace, statusCode, nil)
+		return
+	}
+	if e.client && soapNamespace == soap12Namespace {
+		statusCode = http.StatusBadRequest
+	}
+	sa.setResponse(ctx, soapNamespace, statusCode, buf.Bytes())
+}
+
+func (sa *SOAPAdaptor) setResponse(ctx *context.Context, soapNamespace string, statusCode int, body []byte) {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+
+	contentType := soap11ContentType
+	if soapNamespace == soap12Namespace {
+		contentType = soap12ContentType
+	}
+
+	resp.SetStatusCode(statusCode)
+	resp.Std().Header.Set("Content-Type", contentType)
+	resp.SetPayload(body)
+	ctx.SetOutputResponse(resp)
+}
+
+// NeedPayload returns true for the request payload, which is the SOAP
+// envelope, it implements context.PayloadNeeder.
+func (sa *SOAPAdaptor) NeedPayload() (request, response bool) {
+	return true, false
+}
+
+// Status returns status.
+func (sa *SOAPAdaptor) Status() interface{} {
+	return nil
+}
+
+// Close closes SOAPAdaptor.
+func (sa *SOAPAdaptor) Close() {
+}
+
+// envelopeWriter writes a SOAP envelope, it stops at the first error,
+// which is reported by close.
+type envelopeWriter struct {
+	enc *xml.Encoder
+	err error
+}
+
+func newEnvelopeWriter(w io.Writer, soapNamespace string) *envelopeWriter {
+	ew := &envelopeWriter{enc: xml.NewEncoder(w)}
+	ew.encode(xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0" encoding="UTF-8"`)})
+	ew.start(xml.Name{Local: "soap:Envelope"}, xml.Attr{Name: xml.Name{Local: "xmlns:soap"}, Value: soapNamespace})
+	ew.start(xml.Name{Local: "soap:Body"})
+	return ew
+}
+
+func (ew *envelopeWriter) encode(t xml.Token) {
+	if ew.err == nil {
+		ew.err = ew.enc.EncodeToken(t)
+	}
+}
+
+func (ew *envelopeWriter) start(name xml.Name, attrs ...xml.Attr) {
+	ew.encode(xml.StartElement{Name: name, Attr: attrs})
+}
+
+func (ew *envelopeWriter) end(name xml.Name) {
+	ew.encode(xml.EndElement{Name: name})
+}
+
+func (ew *envelopeWriter) element(name, text string) {
+	ew.start(xml.Name{Local: name})
+	ew.encode(xml.CharData(text))
+	ew.end(xml.Name{Local: name})
+}
+
+// writeValue writes a value decoded from JSON as XML content, itemName is
+// used as the element name of array items which are not in an object.
+func (ew *envelopeWriter) writeValue(v interface{}, itemName string) {
+	switch v := v.(type) {
+	case nil:
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if arr, ok := v[k].([]interface{}); ok {
+				for _, item := range arr {
+					ew.writeElement(k, item)
+				}
+			} else {
+				ew.writeElement(k, v[k])
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			ew.writeElement(itemName, item)
+		}
+	default:
+		ew.encode(xml.CharData(stringify(v)))
+	}
+}
+
+// writeElement writes an element whose name is a key of a JSON object, the
+// encoder doesn't validate the names, so it is checked here.
+func (ew *envelopeWriter) writeElement(name string, v interface{}) {
+	if ew.err == nil && !isXMLName(name) {
+		ew.err = fmt.Errorf("%q is not a valid XML element name", name)
+	}
+	ew.start(xml.Name{Local: name})
+	ew.writeValue(v, "item")
+	ew.end(xml.Name{Local: name})
+}
+
+func (ew *envelopeWriter) close() error {
+	ew.end(xml.Name{Local: "soap:Body"})
+	ew.end(xml.Name{Local: "soap:Envelope"})
+	if ew.err == nil {
+		ew.err = ew.enc.Flush()
+	}
+	return ew.err
+}
+
+// isXMLName reports whether name is a valid XML element name without a
+// namespace prefix.
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r)):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,267 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package soapadaptor
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+const getUserEnvelope = `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <m:GetUser xmlns:m="http://example.com/user">
+      <m:ID>1001</m:ID>
+      <m:Fields><m:Field>name</m:Field><m:Field>email</m:Field></m:Fields>
+    </m:GetUser>
+  </soap:Body>
+</soap:Envelope>`
+
+func createSOAPAdaptor(t *testing.T, yamlSpec string) *SOAPAdaptor {
+	rawSpec := map[string]interface{}{}
+	codectool.MustUnmarshal([]byte(yamlSpec), &rawSpec)
+
+	spec, err := filters.NewSpec(nil, "pipeline-demo", rawSpec)
+	assert.NoError(t, err)
+
+	sa := kind.CreateInstance(spec).(*SOAPAdaptor)
+	sa.Init()
+	return sa
+}
+
+func newContext(t *testing.T, body string, header http.Header) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/soap", strings.NewReader(body))
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	assert.NoError(t, req.FetchPayload(0))
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestXPath(t *testing.T) {
+	assert := assert.New(t)
+
+	root, err := parseXML([]byte(getUserEnvelope))
+	assert.NoError(err)
+	op := root.child("Body").firstChild()
+	assert.Equal("GetUser", op.Local)
+
+	cases := []struct {
+		expr   string
+		result interface{}
+	}{
+		{"ID", "1001"},
+		{"m:ID/text()", "1001"},
+		{"Fields/Field", []interface{}{"name", "email"}},
+		{"Fields/Field[2]", "email"},
+		{"//Field[1]", "name"},
+		{"/Envelope/Body/GetUser/ID", "1001"},
+		{"Fields", map[string]interface{}{"Field": []interface{}{"name", "email"}}},
+		{"NotExist", nil},
+	}
+
+	for _, c := range cases {
+		xp, err := compileXPath(c.expr)
+		assert.NoError(err, c.expr)
+		assert.Equal(c.result, xp.evaluate(op), c.expr)
+	}
+
+	for _, expr := range []string{"", "a//", "@id/a", "a[0]", "a[x]", "a[1"} {
+		_, err := compileXPath(expr)
+		assert.Error(err, expr)
+	}
+
+	_, err = parseXML([]byte("<a><b></a>"))
+	assert.Error(err)
+}
+
+func TestSOAPAdaptor(t *testing.T) {
+	assert := assert.New(t)
+
+	var gotPath, gotQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+		if r.URL.Path == "/users/404" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodPost {
+			body, _ := io.ReadAll(r.Body)
+			w.Write(body)
+			return
+		}
+		w.Write([]byte(`{"id": 1001, "name": "megaease", "tags": ["a", "b"]}`))
+	}))
+	defer server.Close()
+
+	sa := createSOAPAdaptor(t, `
+kind: SOAPAdaptor
+name: soap
+endpoint: `+server.URL+`
+operations:
+- name: GetUser
+  method: GET
+  path: /users/{id}
+  params:
+  - name: id
+    xpath: ID
+  - name: field
+    xpath: Fields/Field
+- name: CreateUser
+  soapAction: urn:CreateUser
+  path: /users
+  params:
+  - name: name
+    xpath: Name
+`)
+	assert.Equal("soap", sa.Name())
+	assert.Equal(kind, sa.Kind())
+	assert.Nil(sa.Status())
+
+	// the defaults are resolved without modifying the spec.
+	assert.Equal(http.MethodPost, sa.operations[1].method)
+	assert.Equal("CreateUserResponse", sa.operations[1].responseElement)
+	assert.Empty(sa.spec.Operations[1].Method)
+	assert.Empty(sa.spec.Operations[1].ResponseElement)
+
+	ctx := newContext(t, getUserEnvelope, nil)
+	assert.Equal("", sa.Handle(ctx))
+	assert.Equal("/users/1001", gotPath)
+	assert.Equal("field=name&field=email", gotQuery)
+
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal(soap11ContentType, resp.HTTPHeader().Get("Content-Type"))
+	body := string(resp.RawPayload())
+	assert.Contains(body, `<m:GetUserResponse xmlns:m="http://example.com/user">`)
+	assert.Contains(body, "<id>1001</id><name>megaease</name><tags>a</tags><tags>b</tags>")
+
+	// SOAP 1.2 with the action in the content type.
+	ctx = newContext(t, `<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope">
+<Body><Create xmlns="http://example.com/user"><Name>easegress</Name></Create></Body>
+</Envelope>`, http.Header{"Content-Type": []string{`application/soap+xml; action="urn:CreateUser"`}})
+	assert.Equal("", sa.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(soap12ContentType, resp.HTTPHeader().Get("Content-Type"))
+	assert.Contains(string(resp.RawPayload()), "<m:CreateUserResponse")
+	assert.Contains(string(resp.RawPayload()), "<name>easegress</name>")
+
+	// upstream returns 404
+	ctx = newContext(t, strings.Replace(getUserEnvelope, "1001", "404", 1), nil)
+	assert.Equal(resultClientError, sa.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode())
+	assert.Contains(string(resp.RawPayload()), "<faultcode>soap:Client</faultcode>")
+
+	// the keys of the REST response are not valid XML names.
+	for _, key := range []string{"", "1st", "a b", "<a>"} {
+		ctx = newContext(t, `<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope">
+<Body><CreateUser xmlns="http://example.com/user"><Name>easegress</Name></CreateUser></Body>
+</Envelope>`, nil)
+		sa.spec.Operations[1].Params[0].Name = key
+		sa.Init()
+		assert.Equal(resultServerError, sa.Handle(ctx), key)
+		resp = ctx.GetOutputResponse().(*httpprot.Response)
+		assert.Equal(http.StatusInternalServerError, resp.StatusCode(), key)
+		assert.Contains(string(resp.RawPayload()), "<soap:Value>soap:Receiver</soap:Value>", key)
+	}
+	sa.spec.Operations[1].Params[0].Name = "name"
+	sa.Init()
+
+	// invalid envelope
+	ctx = newContext(t, "<a></a>", nil)
+	assert.Equal(resultClientError, sa.Handle(ctx))
+
+	// unknown operation
+	ctx = newContext(t, strings.ReplaceAll(getUserEnvelope, "GetUser", "DeleteUser"), nil)
+	assert.Equal(resultClientError, sa.Handle(ctx))
+
+	// upstream is down
+	server.Close()
+	ctx = newContext(t, getUserEnvelope, nil)
+	assert.Equal(resultServerError, sa.Handle(ctx))
+	assert.Contains(string(ctx.GetOutputResponse().(*httpprot.Response).RawPayload()), "<faultcode>soap:Server</faultcode>")
+
+	sa.Inherit(sa)
+	sa.Close()
+}
+
+func TestTLS(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 1001}`))
+	}))
+	defer server.Close()
+
+	yamlSpec := `
+kind: SOAPAdaptor
+name: soap
+endpoint: ` + server.URL + `
+operations:
+- name: GetUser
+  method: GET
+  path: /users/{id}
+  params:
+  - name: id
+    xpath: ID
+`
+
+	// the certificate of the test server is not trusted.
+	sa := createSOAPAdaptor(t, yamlSpec)
+	assert.Equal(resultServerError, sa.Handle(newContext(t, getUserEnvelope, nil)))
+
+	sa = createSOAPAdaptor(t, yamlSpec+"insecureSkipVerify: true\n")
+	assert.Equal("", sa.Handle(newContext(t, getUserEnvelope, nil)))
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{}
+	assert.Error(spec.Validate())
+
+	spec.Operations = []*OperationSpec{{Name: "a", Path: "/a"}, {Name: "a", Path: "/b"}}
+	assert.Error(spec.Validate())
+
+	spec.Operations = []*OperationSpec{{Name: "a", Path: "/a", Params: []*ParamSpec{{Name: "x", XPath: "a//"}}}}
+	assert.Error(spec.Validate())
+
+	spec.Operations[0].Params[0].XPath = "a//b"
+	assert.NoError(spec.Validate())
+}
@@ -0,0 +1,361 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package soapadaptor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type (
+	// node is a simplified XML element.
+	node struct {
+		Space    string
+		Local    string
+		Attrs    []xml.Attr
+		Text     string
+		Children []*node
+		Parent   *node
+	}
+
+	// xpath is a compiled XPath expression, only a subset of XPath 1.0
+	// is supported:
+	//
+	//   - absolute(/a/b) and relative(a/b) location paths
+	//   - descendant-or-self steps(//b, a//b)
+	//   - the wildcard name test(*)
+	//   - positional predicates([1])
+	//   - the attribute axis(@name) and text() as the last step
+	//
+	// Names are matched against the local name of elements, namespace
+	// prefixes in the expression are ignored.
+	xpath struct {
+		expr     string
+		absolute bool
+		steps    []*xpathStep
+		attr     string
+		text     bool
+	}
+
+	xpathStep struct {
+		descendant bool
+		name       string
+		index      int
+	}
+)
+
+// parseXML parses data into a tree of nodes and returns the root element.
+func parseXML(data []byte) (*node, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	var root, current *node
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &node{
+				Space:  t.Name.Space,
+				Local:  t.Name.Local,
+				Attrs:  t.Copy().Attr,
+				Parent: current,
+			}
+			if current == nil {
+				if root != nil {
+					return nil, fmt.Errorf("multiple root elements")
+				}
+				root = n
+			} else {
+				current.Children = append(current.Children, n)
+			}
+			current = n
+		case xml.EndElement:
+			if current == nil {
+				return nil, fmt.Errorf("unexpected end element %s", t.Name.Local)
+			}
+			current.Text = strings.TrimSpace(current.Text)
+			current = current.Parent
+		case xml.CharData:
+			if current != nil {
+				current.Text += string(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("no root element")
+	}
+	if current != nil {
+		return nil, fmt.Errorf("element %s is not closed", current.Local)
+	}
+
+	return root, nil
+}
+
+// child returns the first child element whose local name is local.
+func (n *node) child(local string) *node {
+	for _, c := range n.Children {
+		if c.Local == local {
+			return c
+		}
+	}
+	return nil
+}
+
+// firstChild returns the first child element.
+func (n *node) firstChild() *node {
+	if len(n.Children) == 0 {
+		return nil
+	}
+	return n.Children[0]
+}
+
+// attr returns the value of the attribute whose local name is local.
+func (n *node) attr(local string) (string, bool) {
+	for _, a := range n.Attrs {
+		if a.Name.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// toValue converts the node to a value which can be marshaled to JSON.
+// Leaf elements are converted to strings, elements with children are
+// converted to maps, and children with the same name are grouped into
+// arrays.
+func (n *node) toValue() interface{} {
+	if len(n.Children) == 0 {
+		return n.Text
+	}
+
+	m := map[string]interface{}{}
+	for _, c := range n.Children {
+		v := c.toValue()
+		old, ok := m[c.Local]
+		if !ok {
+			m[c.Local] = v
+			continue
+		}
+		if arr, ok := old.([]interface{}); ok {
+			m[c.Local] = append(arr, v)
+		} else {
+			m[c.Local] = []interface{}{old, v}
+		}
+	}
+	return m
+}
+
+func localName(name string) string {
+	if i := strings.IndexByte(name, ':'); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+// compileXPath compiles expr into an xpath.
+func compileXPath(expr string) (*xpath, error) {
+	xp := &xpath{expr: expr}
+
+	s := strings.TrimSpace(expr)
+	if s == "" {
+		return nil, fmt.Errorf("empty xpath")
+	}
+
+	// both "/a" and "//a" are evaluated from the document node.
+	if strings.HasPrefix(s, "/") {
+		xp.absolute = true
+		if !strings.HasPrefix(s, "//") {
+			s = s[1:]
+		}
+	}
+
+	descendant := false
+	for len(s) > 0 {
+		if strings.HasPrefix(s, "//") {
+			descendant = true
+			s = s[2:]
+			continue
+		}
+		if s[0] == '/' {
+			s = s[1:]
+			continue
+		}
+
+		var part string
+		if i := strings.IndexByte(s, '/'); i >= 0 {
+			part, s = s[:i], s[i:]
+		} else {
+			part, s = s, ""
+		}
+
+		if xp.attr != "" || xp.text {
+			return nil, fmt.Errorf("%s: @attr and text() must be the last step", expr)
+		}
+
+		switch {
+		case strings.HasPrefix(part, "@"):
+			xp.attr = localName(part[1:])
+			if xp.attr == "" {
+				return nil, fmt.Errorf("%s: empty attribute name", expr)
+			}
+			if descendant {
+				xp.steps = append(xp.steps, &xpathStep{descendant: true, name: "*"})
+			}
+		case part == "text()":
+			xp.text = true
+		default:
+			step, err := parseXPathStep(part)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", expr, err)
+			}
+			step.descendant = descendant
+			xp.steps = append(xp.steps, step)
+		}
+		descendant = false
+	}
+
+	if descendant {
+		return nil, fmt.Errorf("%s: ends with //", expr)
+	}
+
+	if len(xp.steps) == 0 && xp.attr == "" && !xp.text {
+		return nil, fmt.Errorf("%s: no location step", expr)
+	}
+
+	return xp, nil
+}
+
+func parseXPathStep(part string) (*xpathStep, error) {
+	step := &xpathStep{}
+
+	name := part
+	if i := strings.IndexByte(part, '['); i >= 0 {
+		if !strings.HasSuffix(part, "]") {
+			return nil, fmt.Errorf("invalid predicate in %s", part)
+		}
+		index, err := strconv.Atoi(part[i+1 : len(part)-1])
+		if err != nil || index < 1 {
+			return nil, fmt.Errorf("only positive positional predicates are supported: %s", part)
+		}
+		step.index = index
+		name = part[:i]
+	}
+
+	step.name = localName(name)
+	if step.name == "" {
+		return nil, fmt.Errorf("empty name test")
+	}
+	return step, nil
+}
+
+func (s *xpathStep) match(n *node) bool {
+	return s.name == "*" || s.name == n.Local
+}
+
+func descendants(n *node, fn func(*node)) {
+	for _, c := range n.Children {
+		fn(c)
+		descendants(c, fn)
+	}
+}
+
+// selectNodes evaluates the location steps with ctx being the context node.
+func (xp *xpath) selectNodes(ctx *node) []*node {
+	current := []*node{ctx}
+
+	if xp.absolute {
+		// the document node is the virtual parent of the root element.
+		root := ctx
+		for root.Parent != nil {
+			root = root.Parent
+		}
+		current = []*node{{Children: []*node{root}}}
+	}
+
+	for _, step := range xp.steps {
+		var next []*node
+		for _, n := range current {
+			var matched []*node
+			collect := func(c *node) {
+				if step.match(c) {
+					matched = append(matched, c)
+				}
+			}
+			if step.descendant {
+				descendants(n, collect)
+			} else {
+				for _, c := range n.Children {
+					collect(c)
+				}
+			}
+
+			if step.index > 0 {
+				if step.index <= len(matched) {
+					next = append(next, matched[step.index-1])
+				}
+			} else {
+				next = append(next, matched...)
+			}
+		}
+		current = next
+	}
+
+	return current
+}
+
+// evaluate evaluates the xpath with ctx being the context node. Leaf
+// elements, attributes and text() are evaluated to strings, and elements
+// having children are evaluated to maps. It returns nil if nothing is
+// selected, the value of the item if only one item is selected, or an
+// array of the values of all selected items.
+func (xp *xpath) evaluate(ctx *node) interface{} {
+	var values []interface{}
+
+	for _, n := range xp.selectNodes(ctx) {
+		switch {
+		case xp.attr != "":
+			if v, ok := n.attr(xp.attr); ok {
+				values = append(values, v)
+			}
+		case xp.text:
+			values = append(values, n.Text)
+		default:
+			values = append(values, n.toValue())
+		}
+	}
+
+	switch len(values) {
+	case 0:
+		return nil
+	case 1:
+		return values[0]
+	default:
+		return values
+	}
+}
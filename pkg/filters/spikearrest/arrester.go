@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spikearrest
+
+import (
+	"sync"
+	"time"
+)
+
+// arrester schedules the requests of every key at least an interval apart,
+// it is shared by the generations of the filter.
+type arrester struct {
+	mutex sync.Mutex
+	// next is the earliest time the next request of a key is admitted.
+	next map[string]time.Time
+}
+
+func newArrester() *arrester {
+	return &arrester{next: map[string]time.Time{}}
+}
+
+// reserve reserves a slot for a request of the key arriving at now, it
+// returns the time to wait for the slot, and false if the wait is longer
+// than maxWait, in which case the slot is not reserved and the returned
+// duration is the time until the next free slot.
+func (a *arrester) reserve(key string, now time.Time, interval, maxWait time.Duration) (time.Duration, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	slot := now
+	if next, ok := a.next[key]; ok && next.After(now) {
+		slot = next
+	}
+	wait := slot.Sub(now)
+	if wait > maxWait {
+		return wait, false
+	}
+	a.next[key] = slot.Add(interval)
+	return wait, true
+}
+
+// sweep removes the keys which are free at now, so the map does not grow
+// with the keys seen once.
+func (a *arrester) sweep(now time.Time) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for key, next := range a.next {
+		if !next.After(now) {
+			delete(a.next, key)
+		}
+	}
+}
+
+func (a *arrester) keys() int {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return len(a.next)
+}
@@ -0,0 +1,266 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package spikearrest implements a filter to smooth the bursts of requests
+// by enforcing a minimum interval between the requests of a key.
+package spikearrest
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/object/tenantmanager"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of SpikeArrest.
+	Kind = "SpikeArrest"
+
+	resultSpikeArrested = "spikeArrested"
+
+	sweepInterval = time.Minute
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "SpikeArrest smooths the bursts of requests by enforcing a minimum interval between the requests of a key.",
+	Results:     []string{resultSpikeArrested},
+	Indicators: []*filters.Indicator{
+		{Name: "keys", Description: "Number of the keys being arrested", Type: filters.IndicatorTypeInteger},
+		{Name: "admitted", Description: "Number of the admitted requests, including the delayed ones", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "delayed", Description: "Number of the requests delayed for their slots", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "rejected", Description: "Number of the rejected requests", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &SpikeArrest{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// SpikeArrest is the filter to smooth the bursts of requests.
+	SpikeArrest struct {
+		spec     *Spec
+		interval time.Duration
+		maxWait  time.Duration
+		arrester *arrester
+		done     chan struct{}
+
+		admitted uint64
+		delayed  uint64
+		rejected uint64
+	}
+
+	// Spec is the spec of SpikeArrest.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Interval is the minimum interval between the requests of a key.
+		Interval string `json:"interval" jsonschema:"required,format=duration"`
+		// MaxWait is the max duration an early request waits for its slot,
+		// the early requests are rejected at once if it is empty.
+		MaxWait string `json:"maxWait,omitempty" jsonschema:"format=duration"`
+		// KeyHeader is the header carrying the key of a request, used
+		// when the consumer is not identified by a TenantLimiter.
+		KeyHeader string `json:"keyHeader,omitempty"`
+		// Global uses one key for all requests, which protects the
+		// upstreams instead of sharing them fairly among the clients.
+		Global bool `json:"global,omitempty"`
+	}
+
+	// Status is the status of SpikeArrest.
+	Status struct {
+		// Keys is the number of the keys being arrested.
+		Keys int `json:"keys"`
+		// Admitted includes the requests delayed for their slots.
+		Admitted uint64 `json:"admitted"`
+		Delayed  uint64 `json:"delayed"`
+		Rejected uint64 `json:"rejected"`
+	}
+)
+
+// Validate validates the spec of SpikeArrest.
+func (s *Spec) Validate() error {
+	if d, err := time.ParseDuration(s.Interval); err != nil || d <= 0 {
+		return fmt.Errorf("invalid interval %s", s.Interval)
+	}
+	if s.MaxWait != "" {
+		if d, err := time.ParseDuration(s.MaxWait); err != nil || d < 0 {
+			return fmt.Errorf("invalid maxWait %s", s.MaxWait)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the SpikeArrest filter instance.
+func (sa *SpikeArrest) Name() string {
+	return sa.spec.Name()
+}
+
+// Kind returns the kind of SpikeArrest.
+func (sa *SpikeArrest) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the SpikeArrest.
+func (sa *SpikeArrest) Spec() filters.Spec {
+	return sa.spec
+}
+
+// Init initializes SpikeArrest.
+func (sa *SpikeArrest) Init() {
+	sa.reload(nil)
+}
+
+// Inherit inherits previous generation of SpikeArrest, the slots reserved
+// by the previous generation are kept.
+func (sa *SpikeArrest) Inherit(previousGeneration filters.Filter) {
+	sa.reload(previousGeneration.(*SpikeArrest))
+}
+
+func (sa *SpikeArrest) reload(prev *SpikeArrest) {
+	sa.interval, _ = time.ParseDuration(sa.spec.Interval)
+	if sa.spec.MaxWait != "" {
+		sa.maxWait, _ = time.ParseDuration(sa.spec.MaxWait)
+	}
+
+	if prev != nil {
+		sa.arrester = prev.arrester
+	} else {
+		sa.arrester = newArrester()
+	}
+
+	sa.done = make(chan struct{})
+	go sa.run()
+}
+
+func (sa *SpikeArrest) run() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sa.done:
+			return
+		case now := <-ticker.C:
+			sa.arrester.sweep(now)
+		}
+	}
+}
+
+// keyOf returns the key of the request, which is the consumer identified
+// by a TenantLimiter before the SpikeArrest, or the value of the key
+// header, or the real IP.
+func (sa *SpikeArrest) keyOf(ctx *context.Context, req *httpprot.Request) string {
+	if sa.spec.Global {
+		return ""
+	}
+	if name, ok := tenantmanager.ConsumerDataKey.Get(ctx); ok && name != "" {
+		return name
+	}
+	if sa.spec.KeyHeader != "" {
+		if key := req.HTTPHeader().Get(sa.spec.KeyHeader); key != "" {
+			return key
+		}
+	}
+	return req.RealIP()
+}
+
+// Handle admits the request if the interval since the previous request of
+// its key has passed, or delays it for its slot up to maxWait.
+func (sa *SpikeArrest) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	key := sa.keyOf(ctx, req)
+
+	wait, ok := sa.arrester.reserve(key, time.Now(), sa.interval, sa.maxWait)
+	if !ok {
+		atomic.AddUint64(&sa.rejected, 1)
+		ctx.AddTag(fmt.Sprintf("spikeArrest: too frequent requests of %s", key))
+		return sa.reject(ctx, "too-frequent", wait)
+	}
+
+	if wait > 0 {
+		atomic.AddUint64(&sa.delayed, 1)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			ctx.AddTag(fmt.Sprintf("spikeArrest: waiting duration: %s", wait))
+		case <-req.Context().Done():
+			// the slot is not released, which only delays the next request
+			// of the key, and the client has gone anyway.
+			timer.Stop()
+			atomic.AddUint64(&sa.rejected, 1)
+			ctx.AddTag(fmt.Sprintf("spikeArrest: client of %s went away while waiting", key))
+			return sa.reject(ctx, "client-canceled", 0)
+		}
+	}
+
+	atomic.AddUint64(&sa.admitted, 1)
+	return ""
+}
+
+// reject builds the rejected response, Retry-After is set if wait is not
+// zero.
+func (sa *SpikeArrest) reject(ctx *context.Context, reason string, wait time.Duration) string {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+
+	resp.SetStatusCode(http.StatusTooManyRequests)
+	resp.HTTPHeader().Set("X-EG-Spike-Arrest", reason)
+	if wait > 0 {
+		resp.HTTPHeader().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	}
+
+	ctx.SetOutputResponse(resp)
+	return resultSpikeArrested
+}
+
+// NeedPayload returns false for both payloads, it implements
+// context.PayloadNeeder.
+func (sa *SpikeArrest) NeedPayload() (request, response bool) {
+	return false, false
+}
+
+// Status returns Status generated by Runtime.
+func (sa *SpikeArrest) Status() interface{} {
+	return &Status{
+		Keys:     sa.arrester.keys(),
+		Admitted: atomic.LoadUint64(&sa.admitted),
+		Delayed:  atomic.LoadUint64(&sa.delayed),
+		Rejected: atomic.LoadUint64(&sa.rejected),
+	}
+}
+
+// Close closes SpikeArrest.
+func (sa *SpikeArrest) Close() {
+	close(sa.done)
+}
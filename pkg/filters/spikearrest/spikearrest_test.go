@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package spikearrest
+
+import (
+	stdcontext "context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func newSpikeArrest(t *testing.T, yamlConfig string) *SpikeArrest {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	sa := kind.CreateInstance(spec).(*SpikeArrest)
+	sa.Init()
+	return sa
+}
+
+func newContext(t *testing.T, key string) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	stdr.Header.Set("X-Key", key)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{Interval: "100ms"}).Validate())
+	assert.NoError((&Spec{Interval: "100ms", MaxWait: "1s"}).Validate())
+	assert.Error((&Spec{}).Validate())
+	assert.Error((&Spec{Interval: "0s"}).Validate())
+	assert.Error((&Spec{Interval: "100ms", MaxWait: "x"}).Validate())
+}
+
+func TestArrester(t *testing.T) {
+	assert := assert.New(t)
+
+	a := newArrester()
+	now := time.Now()
+	interval := 100 * time.Millisecond
+
+	wait, ok := a.reserve("a", now, interval, 0)
+	assert.True(ok)
+	assert.Zero(wait)
+
+	// too early without waiting.
+	wait, ok = a.reserve("a", now.Add(30*time.Millisecond), interval, 0)
+	assert.False(ok)
+	assert.Equal(70*time.Millisecond, wait)
+
+	// the keys are independent.
+	_, ok = a.reserve("b", now, interval, 0)
+	assert.True(ok)
+
+	// the early requests are scheduled an interval apart.
+	wait, ok = a.reserve("a", now.Add(30*time.Millisecond), interval, 200*time.Millisecond)
+	assert.True(ok)
+	assert.Equal(70*time.Millisecond, wait)
+	wait, ok = a.reserve("a", now.Add(30*time.Millisecond), interval, 200*time.Millisecond)
+	assert.True(ok)
+	assert.Equal(170*time.Millisecond, wait)
+	_, ok = a.reserve("a", now.Add(30*time.Millisecond), interval, 200*time.Millisecond)
+	assert.False(ok)
+
+	assert.Equal(2, a.keys())
+	a.sweep(now.Add(150 * time.Millisecond))
+	assert.Equal(1, a.keys())
+	a.sweep(now.Add(time.Second))
+	assert.Equal(0, a.keys())
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	sa := newSpikeArrest(t, `
+kind: SpikeArrest
+name: sa
+interval: 1h
+keyHeader: X-Key
+`)
+	defer sa.Close()
+
+	assert.Equal("", sa.Handle(newContext(t, "alice")))
+	assert.Equal("", sa.Handle(newContext(t, "bob")))
+
+	ctx := newContext(t, "alice")
+	assert.Equal(resultSpikeArrested, sa.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusTooManyRequests, resp.StatusCode())
+	assert.Equal("3600", resp.HTTPHeader().Get("Retry-After"))
+
+	// the slots are kept by the next generation.
+	next := kind.CreateInstance(sa.spec).(*SpikeArrest)
+	next.Inherit(sa)
+	defer next.Close()
+	assert.Equal(resultSpikeArrested, next.Handle(newContext(t, "bob")))
+
+	assert.Equal(&Status{Keys: 2, Admitted: 2, Rejected: 1}, sa.Status())
+}
+
+func TestDelay(t *testing.T) {
+	assert := assert.New(t)
+
+	sa := newSpikeArrest(t, `
+kind: SpikeArrest
+name: sa
+interval: 50ms
+maxWait: 1s
+global: true
+`)
+	defer sa.Close()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.Equal("", sa.Handle(newContext(t, "alice")))
+	}
+	assert.GreaterOrEqual(time.Since(start), 100*time.Millisecond)
+	assert.Equal(uint64(2), sa.Status().(*Status).Delayed)
+
+	// the client goes away while waiting.
+	ctx := newContext(t, "alice")
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	stdctx, cancel := stdcontext.WithCancel(req.Context())
+	cancel()
+	req.SetContext(stdctx)
+	assert.Equal(resultSpikeArrested, sa.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("client-canceled", resp.HTTPHeader().Get("X-EG-Spike-Arrest"))
+	assert.Empty(resp.HTTPHeader().Get("Retry-After"))
+	assert.Equal(uint64(1), sa.Status().(*Status).Rejected)
+}
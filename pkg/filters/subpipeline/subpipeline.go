@@ -0,0 +1,251 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package subpipeline implements a filter to call another pipeline as a
+// sub-routine of the current pipeline.
+package subpipeline
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/pipeline"
+	"github.com/megaease/easegress/v2/pkg/object/rawconfigtrafficcontroller"
+)
+
+const (
+	// Kind is the kind of SubPipeline.
+	Kind = "SubPipeline"
+
+	resultPipelineNotFound = "pipelineNotFound"
+	resultFailed           = "failed"
+
+	defaultMaxDepth = 8
+)
+
+// depthKey is the key of the task value to record the depth of the nested
+// calls.
+var depthKey = context.NewDataKey[int](Kind, "depth")
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "SubPipeline calls another pipeline as a sub-routine.",
+	Results:     []string{resultPipelineNotFound, resultFailed},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &SubPipeline{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// SubPipeline is filter SubPipeline.
+	SubPipeline struct {
+		spec *Spec
+
+		// getHandler gets the pipeline by name, it is a field for testing.
+		getHandler func(name string) (context.Handler, bool)
+	}
+
+	// Spec describes the SubPipeline.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Pipeline is the name of the pipeline to call, the pipeline
+		// shares the requests, responses and task values with the caller.
+		Pipeline string `json:"pipeline" jsonschema:"required,format=urlname"`
+		// Inputs copies task values before calling the pipeline, the key
+		// is the name used by the pipeline and the value is the name used
+		// by the caller.
+		Inputs map[string]string `json:"inputs,omitempty"`
+		// Outputs copies task values after calling the pipeline, the key
+		// is the name used by the caller and the value is the name used by
+		// the pipeline.
+		Outputs map[string]string `json:"outputs,omitempty"`
+		// MaxDepth is the max depth of nested calls, the calls exceeding
+		// it fail, which prevents pipelines from calling each other
+		// endlessly. Default is 8.
+		MaxDepth int `json:"maxDepth,omitempty" jsonschema:"minimum=1"`
+	}
+)
+
+var _ filters.Filter = (*SubPipeline)(nil)
+
+// Validate validates the spec.
+func (s *Spec) Validate() error {
+	for k, v := range s.Inputs {
+		if k == "" || v == "" {
+			return fmt.Errorf("inputs: empty task value name")
+		}
+	}
+	for k, v := range s.Outputs {
+		if k == "" || v == "" {
+			return fmt.Errorf("outputs: empty task value name")
+		}
+	}
+	return nil
+}
+
+// References returns the pipeline called by the filter.
+func (s *Spec) References() []string {
+	return []string{s.Pipeline}
+}
+
+// DataInputs returns the task values copied to the pipeline.
+func (s *Spec) DataInputs() []context.DataDecl {
+	return anyData(s.Inputs, false)
+}
+
+// DataOutputs returns the task values copied from the pipeline.
+func (s *Spec) DataOutputs() []context.DataDecl {
+	return anyData(s.Outputs, true)
+}
+
+// anyData returns the declarations of the keys or the values of m in order.
+func anyData(m map[string]string, keys bool) []context.DataDecl {
+	names := make([]string, 0, len(m))
+	for k, v := range m {
+		if keys {
+			names = append(names, k)
+		} else {
+			names = append(names, v)
+		}
+	}
+	sort.Strings(names)
+
+	decls := make([]context.DataDecl, 0, len(names))
+	for _, name := range names {
+		decls = append(decls, context.AnyData(name))
+	}
+	return decls
+}
+
+// Name returns the name of the SubPipeline filter instance.
+func (sp *SubPipeline) Name() string {
+	return sp.spec.Name()
+}
+
+// Kind returns the kind of SubPipeline.
+func (sp *SubPipeline) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the SubPipeline.
+func (sp *SubPipeline) Spec() filters.Spec {
+	return sp.spec
+}
+
+// Init initializes SubPipeline.
+func (sp *SubPipeline) Init() {
+	sp.reload()
+}
+
+// Inherit inherits previous generation of SubPipeline.
+func (sp *SubPipeline) Inherit(previousGeneration filters.Filter) {
+	sp.Init()
+}
+
+func (sp *SubPipeline) reload() {
+	if sp.spec.MaxDepth == 0 {
+		sp.spec.MaxDepth = defaultMaxDepth
+	}
+	sp.getHandler = sp.getPipeline
+}
+
+// getPipeline gets the pipeline from the default namespace, the pipeline is
+// got for every call, so the caller always sees its latest generation.
+func (sp *SubPipeline) getPipeline(name string) (context.Handler, bool) {
+	super := sp.spec.Super()
+	if super == nil {
+		return nil, false
+	}
+
+	entity, exists := super.GetSystemController(rawconfigtrafficcontroller.Kind)
+	if !exists {
+		return nil, false
+	}
+
+	tc, ok := entity.Instance().(*rawconfigtrafficcontroller.RawConfigTrafficController)
+	if !ok {
+		return nil, false
+	}
+	return tc.GetPipeline(name)
+}
+
+// Handle calls the pipeline.
+func (sp *SubPipeline) Handle(ctx *context.Context) string {
+	handler, ok := sp.getHandler(sp.spec.Pipeline)
+	if !ok {
+		logger.Errorf("%s: pipeline %s not found", sp.Name(), sp.spec.Pipeline)
+		return resultPipelineNotFound
+	}
+
+	depth, _ := depthKey.Get(ctx)
+	if depth >= sp.spec.MaxDepth {
+		ctx.AddTag(fmt.Sprintf("%s: max depth %d exceeded", sp.Name(), sp.spec.MaxDepth))
+		return resultFailed
+	}
+
+	for k, v := range sp.spec.Inputs {
+		ctx.SetData(k, ctx.GetData(v))
+	}
+
+	// the pipeline replaces the data of the caller, restore it after the
+	// call. The namespace needn't be restored, because the caller sets it
+	// before calling every filter.
+	pipelineData, hasData := pipeline.DataKey.Get(ctx)
+	depthKey.Set(ctx, depth+1)
+	result := handler.Handle(ctx)
+	depthKey.Set(ctx, depth)
+	if hasData {
+		pipeline.DataKey.Set(ctx, pipelineData)
+	}
+
+	for k, v := range sp.spec.Outputs {
+		ctx.SetData(k, ctx.GetData(v))
+	}
+
+	if result != "" {
+		ctx.AddTag(fmt.Sprintf("%s: pipeline %s returns %s", sp.Name(), sp.spec.Pipeline, result))
+		return resultFailed
+	}
+	return ""
+}
+
+// NeedPayload returns true for both payloads, because the called pipeline
+// could be replaced at any time, or even call the caller recursively, it
+// implements context.PayloadNeeder.
+func (sp *SubPipeline) NeedPayload() (request, response bool) {
+	return true, true
+}
+
+// Status returns status.
+func (sp *SubPipeline) Status() interface{} {
+	return nil
+}
+
+// Close closes SubPipeline.
+func (sp *SubPipeline) Close() {
+}
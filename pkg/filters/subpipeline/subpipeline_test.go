@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package subpipeline
+
+import (
+	"testing"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/pipeline"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+type handlerFunc func(ctx *context.Context) string
+
+func (f handlerFunc) Handle(ctx *context.Context) string {
+	return f(ctx)
+}
+
+func createSubPipeline(t *testing.T, yamlConfig string, handlers map[string]context.Handler) *SubPipeline {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+	sp := kind.CreateInstance(spec).(*SubPipeline)
+	sp.Init()
+	sp.getHandler = func(name string) (context.Handler, bool) {
+		h, ok := handlers[name]
+		return h, ok
+	}
+	return sp
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, yamlConfig := range []string{
+		`
+kind: SubPipeline
+name: sp
+`, `
+kind: SubPipeline
+name: sp
+pipeline: auth
+inputs:
+  token: ""
+`, `
+kind: SubPipeline
+name: sp
+pipeline: auth
+outputs:
+  "": user
+`,
+	} {
+		rawSpec := make(map[string]interface{})
+		codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+		_, err := filters.NewSpec(nil, "", rawSpec)
+		assert.Error(err, yamlConfig)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	auth := handlerFunc(func(ctx *context.Context) string {
+		pipeline.DataKey.Set(ctx, map[string]interface{}{"name": "auth"})
+		if ctx.GetData("token") != "secret" {
+			return "invalid"
+		}
+		ctx.SetData("user", "alice")
+		return ""
+	})
+	handlers := map[string]context.Handler{"auth": auth}
+
+	sp := createSubPipeline(t, `
+kind: SubPipeline
+name: sp
+pipeline: auth
+inputs:
+  token: authToken
+outputs:
+  userName: user
+`, handlers)
+
+	ctx := context.New(nil)
+	pipeline.DataKey.Set(ctx, map[string]interface{}{"name": "caller"})
+	ctx.SetData("authToken", "secret")
+	assert.Equal("", sp.Handle(ctx))
+	assert.Equal("alice", ctx.GetData("userName"))
+	data, _ := pipeline.DataKey.Get(ctx)
+	assert.Equal("caller", data["name"])
+	depth, _ := depthKey.Get(ctx)
+	assert.Equal(0, depth)
+
+	ctx = context.New(nil)
+	ctx.SetData("authToken", "wrong")
+	assert.Equal(resultFailed, sp.Handle(ctx))
+	assert.Nil(ctx.GetData("userName"))
+
+	sp = createSubPipeline(t, `
+kind: SubPipeline
+name: sp
+pipeline: notExist
+`, handlers)
+	assert.Equal(resultPipelineNotFound, sp.Handle(context.New(nil)))
+}
+
+func TestMaxDepth(t *testing.T) {
+	assert := assert.New(t)
+
+	handlers := map[string]context.Handler{}
+	sp := createSubPipeline(t, `
+kind: SubPipeline
+name: sp
+pipeline: loop
+maxDepth: 3
+`, handlers)
+
+	calls := 0
+	handlers["loop"] = handlerFunc(func(ctx *context.Context) string {
+		calls++
+		return sp.Handle(ctx)
+	})
+
+	assert.Equal(resultFailed, sp.Handle(context.New(nil)))
+	assert.Equal(3, calls)
+}
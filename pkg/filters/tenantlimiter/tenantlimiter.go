@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tenantlimiter implements a filter to enforce the limits of the
+// tenants managed by a TenantManager.
+package tenantlimiter
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/object/tenantmanager"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of TenantLimiter.
+	Kind = "TenantLimiter"
+
+	resultManagerNotFound = "managerNotFound"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "TenantLimiter identifies the consumer and enforces the limits of its tenant.",
+	Results: []string{
+		resultManagerNotFound,
+		tenantmanager.ResultUnknownConsumer,
+		tenantmanager.ResultRateLimited,
+		tenantmanager.ResultQuotaExceeded,
+	},
+	Indicators: []*filters.Indicator{
+		{Name: "admitted", Description: "Number of the admitted requests", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "rejected.*", Description: "Number of the rejected requests by the result, like rateLimited and quotaExceeded", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &TenantLimiter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// TenantLimiter is the filter to enforce the limits of the tenants.
+	TenantLimiter struct {
+		spec *Spec
+
+		admitted uint64
+		// rejected are the numbers of the rejected requests by the
+		// results, it is read only after Init.
+		rejected map[string]*uint64
+	}
+
+	// Status is the status of TenantLimiter.
+	Status struct {
+		Admitted uint64            `json:"admitted"`
+		Rejected map[string]uint64 `json:"rejected"`
+	}
+
+	// Spec is the spec of TenantLimiter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// TenantManager is the name of the TenantManager.
+		TenantManager string `json:"tenantManager" jsonschema:"required"`
+		// TenantHeader is the request header to pass the tenant to the
+		// backend, the tenant is not passed if it is empty.
+		TenantHeader string `json:"tenantHeader,omitempty"`
+	}
+)
+
+// References returns the TenantManager.
+func (s *Spec) References() []string {
+	return []string{s.TenantManager}
+}
+
+// DataInputs returns the data read by TenantLimiter.
+func (s *Spec) DataInputs() []context.DataDecl {
+	return nil
+}
+
+// DataOutputs returns the data written by TenantLimiter.
+func (s *Spec) DataOutputs() []context.DataDecl {
+	return []context.DataDecl{tenantmanager.ConsumerDataKey.Decl(), tenantmanager.TenantDataKey.Decl()}
+}
+
+// Name returns the name of the TenantLimiter filter instance.
+func (tl *TenantLimiter) Name() string {
+	return tl.spec.Name()
+}
+
+// Kind returns the kind of TenantLimiter.
+func (tl *TenantLimiter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the TenantLimiter.
+func (tl *TenantLimiter) Spec() filters.Spec {
+	return tl.spec
+}
+
+// Init initializes TenantLimiter.
+func (tl *TenantLimiter) Init() {
+	tl.rejected = map[string]*uint64{}
+	for _, result := range kind.Results {
+		tl.rejected[result] = new(uint64)
+	}
+}
+
+// Inherit inherits previous generation of TenantLimiter.
+func (tl *TenantLimiter) Inherit(previousGeneration filters.Filter) {
+	tl.Init()
+}
+
+// getManager returns the TenantManager, it is looked up on every request,
+// so the latest generation of the TenantManager is always used.
+func (tl *TenantLimiter) getManager() *tenantmanager.TenantManager {
+	entity, exists := tl.spec.Super().GetBusinessController(tl.spec.TenantManager)
+	if !exists {
+		return nil
+	}
+	tm, _ := entity.Instance().(*tenantmanager.TenantManager)
+	return tm
+}
+
+// Handle handles HTTP request.
+func (tl *TenantLimiter) Handle(ctx *context.Context) string {
+	tm := tl.getManager()
+	if tm == nil {
+		ctx.AddTag("tenantLimiter: tenant manager " + tl.spec.TenantManager + " not found")
+		tl.reject(ctx, http.StatusServiceUnavailable, nil)
+		atomic.AddUint64(tl.rejected[resultManagerNotFound], 1)
+		return resultManagerNotFound
+	}
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	a := tm.Admit(req)
+
+	switch a.Result {
+	case "":
+	case tenantmanager.ResultUnknownConsumer:
+		tl.reject(ctx, http.StatusUnauthorized, a)
+		return a.Result
+	default:
+		tl.reject(ctx, http.StatusTooManyRequests, a)
+		return a.Result
+	}
+	atomic.AddUint64(&tl.admitted, 1)
+
+	tenantmanager.ConsumerDataKey.Set(ctx, a.Consumer)
+	tenantmanager.TenantDataKey.Set(ctx, a.Tenant)
+	if tl.spec.TenantHeader != "" {
+		req.HTTPHeader().Set(tl.spec.TenantHeader, a.Tenant)
+	}
+	return ""
+}
+
+func (tl *TenantLimiter) reject(ctx *context.Context, code int, a *tenantmanager.Admission) {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(code)
+
+	if a != nil {
+		if counter := tl.rejected[a.Result]; counter != nil {
+			atomic.AddUint64(counter, 1)
+		}
+		ctx.AddTag("tenantLimiter: " + a.Result)
+		resp.HTTPHeader().Set("X-EG-Tenant-Limiter", a.Result)
+		if a.RetryAfter > 0 {
+			// round up, so the client never retries too early.
+			seconds := int64((a.RetryAfter + time.Second - 1) / time.Second)
+			resp.HTTPHeader().Set("Retry-After", strconv.FormatInt(seconds, 10))
+		}
+	}
+
+	ctx.SetOutputResponse(resp)
+}
+
+// NeedPayload returns false for both payloads, the tenants are identified
+// by the headers, it implements context.PayloadNeeder.
+func (tl *TenantLimiter) NeedPayload() (request, response bool) {
+	return false, false
+}
+
+// Status returns Status generated by Runtime.
+func (tl *TenantLimiter) Status() interface{} {
+	s := &Status{
+		Admitted: atomic.LoadUint64(&tl.admitted),
+		Rejected: map[string]uint64{},
+	}
+	for result, counter := range tl.rejected {
+		s.Rejected[result] = atomic.LoadUint64(counter)
+	}
+	return s
+}
+
+// Close closes TenantLimiter.
+func (tl *TenantLimiter) Close() {
+}
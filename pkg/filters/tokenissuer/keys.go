@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tokenissuer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const (
+	// maxKeys is the number of signing keys kept, the newest one signs
+	// the new tokens, and all of them verify the tokens. The TTL of the
+	// tokens is not longer than the rotation interval, so the tokens
+	// signed by a retired key are still valid.
+	maxKeys = 3
+
+	// minSyncInterval is the min interval to sync the keys from the
+	// cluster when a token is signed by an unknown key.
+	minSyncInterval = time.Second
+)
+
+// keyCheckInterval is the max interval to check whether the signing key
+// should be rotated, it is a variable for testing.
+var keyCheckInterval = time.Minute
+
+type (
+	// signingKey is a HMAC key stored in the cluster.
+	signingKey struct {
+		ID        string `json:"id"`
+		Key       []byte `json:"key"`
+		CreatedAt int64  `json:"createdAt"`
+	}
+
+	// keyManager rotates the signing keys. If the keys are in the
+	// cluster, they are shared by all members, so a token issued by a
+	// member can be verified by another one.
+	keyManager struct {
+		name     string
+		cls      cluster.Cluster
+		clsKey   string
+		interval time.Duration
+
+		mutex    sync.RWMutex
+		keys     []*signingKey // the newest first
+		lastMiss int64
+
+		done chan struct{}
+	}
+)
+
+// newKeyManager creates a manager, cls is nil if the keys are kept in
+// memory, and keys are the keys of the previous generation in this case.
+func newKeyManager(name string, interval time.Duration, cls cluster.Cluster, clsKey string, keys []*signingKey) *keyManager {
+	m := &keyManager{
+		name:     name,
+		cls:      cls,
+		clsKey:   clsKey,
+		interval: interval,
+		keys:     keys,
+		done:     make(chan struct{}),
+	}
+
+	m.rotate()
+	go m.run()
+	return m
+}
+
+func (m *keyManager) run() {
+	checkInterval := keyCheckInterval
+	if m.interval/2 < checkInterval {
+		checkInterval = m.interval / 2
+	}
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.rotate()
+		}
+	}
+}
+
+// rotateKeys prepends a new key to keys if the newest one is older than the
+// rotation interval, it returns nil if the keys are not changed.
+func (m *keyManager) rotateKeys(keys []*signingKey, now time.Time) ([]*signingKey, error) {
+	if len(keys) > 0 && now.Sub(time.Unix(keys[0].CreatedAt, 0)) < m.interval {
+		return nil, nil
+	}
+
+	key := &signingKey{Key: make([]byte, 32), CreatedAt: now.Unix()}
+	if _, err := rand.Read(key.Key); err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	key.ID = hex.EncodeToString(id)
+
+	keys = append([]*signingKey{key}, keys...)
+	if len(keys) > maxKeys {
+		keys = keys[:maxKeys]
+	}
+	return keys, nil
+}
+
+// rotate rotates the keys if required. If the keys are in the cluster, the
+// keys are rotated by the first member finding them expired, and the other
+// members pick them up.
+func (m *keyManager) rotate() {
+	now := time.Now()
+
+	if m.cls == nil {
+		m.mutex.Lock()
+		keys, err := m.rotateKeys(m.keys, now)
+		if err != nil {
+			logger.Errorf("%s: rotate signing key failed: %v", m.name, err)
+		} else if keys != nil {
+			m.keys = keys
+		}
+		m.mutex.Unlock()
+		return
+	}
+
+	var keys []*signingKey
+	err := m.cls.STM(func(stm concurrency.STM) error {
+		keys = nil
+		if value := stm.Get(m.clsKey); value != "" {
+			if err := codectool.UnmarshalJSON([]byte(value), &keys); err != nil {
+				logger.Warnf("%s: bad signing keys in cluster, regenerate them: %v", m.name, err)
+				keys = nil
+			}
+		}
+
+		rotated, err := m.rotateKeys(keys, now)
+		if err != nil || rotated == nil {
+			return err
+		}
+		keys = rotated
+		data, err := codectool.MarshalJSON(keys)
+		if err != nil {
+			return err
+		}
+		stm.Put(m.clsKey, string(data))
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("%s: sync signing keys failed, keep using the old ones: %v", m.name, err)
+		return
+	}
+
+	m.mutex.Lock()
+	m.keys = keys
+	m.mutex.Unlock()
+}
+
+// current returns the key to sign the new tokens, it is nil if there is no
+// key available.
+func (m *keyManager) current() *signingKey {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if len(m.keys) == 0 {
+		return nil
+	}
+	return m.keys[0]
+}
+
+func (m *keyManager) find(id string) *signingKey {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, k := range m.keys {
+		if k.ID == id {
+			return k
+		}
+	}
+	return nil
+}
+
+// lookup returns the key of the id. If it is not found, the keys may be
+// rotated by another member, so they are synced from the cluster, but not
+// more often than minSyncInterval.
+func (m *keyManager) lookup(id string) *signingKey {
+	if k := m.find(id); k != nil || m.cls == nil {
+		return k
+	}
+
+	last := atomic.LoadInt64(&m.lastMiss)
+	if time.Since(time.Unix(0, last)) < minSyncInterval {
+		return nil
+	}
+	if !atomic.CompareAndSwapInt64(&m.lastMiss, last, time.Now().UnixNano()) {
+		return nil
+	}
+	m.rotate()
+	return m.find(id)
+}
+
+// allKeys returns the keys, the newest first.
+func (m *keyManager) allKeys() []*signingKey {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.keys
+}
+
+func (m *keyManager) close() {
+	close(m.done)
+}
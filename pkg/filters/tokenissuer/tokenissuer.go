@@ -0,0 +1,384 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tokenissuer implements a filter which issues short-lived signed
+// tokens after a successful authentication, so the following requests skip
+// the expensive authentication.
+package tokenissuer
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of TokenIssuer.
+	Kind = "TokenIssuer"
+
+	resultVerified = "tokenVerified"
+
+	defaultTTL                 = 10 * time.Minute
+	defaultKeyRotationInterval = 24 * time.Hour
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "TokenIssuer issues short-lived signed tokens after the authentication, and verifies them in the following requests",
+	Results:     []string{resultVerified},
+	Indicators: []*filters.Indicator{
+		{Name: "verified", Description: "Number of the requests with a valid token", Type: filters.IndicatorTypeInteger, Unit: "requests"},
+		{Name: "issued", Description: "Number of the issued tokens", Type: filters.IndicatorTypeInteger, Unit: "tokens"},
+		{Name: "keys", Description: "Number of the signing keys", Type: filters.IndicatorTypeInteger},
+	},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &TokenIssuer{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// TokenIssuer is the filter issuing and verifying signed tokens. It is
+	// placed in the flow twice: before the authentication to verify the
+	// tokens, and after the backend to issue the tokens.
+	TokenIssuer struct {
+		spec *Spec
+
+		method jwt.SigningMethod
+		ttl    time.Duration
+		keys   *keyManager
+
+		verified uint64
+		issued   uint64
+	}
+
+	// Spec is the spec of TokenIssuer.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		// Algorithm is the HMAC algorithm to sign the tokens, default is
+		// HS256.
+		Algorithm string `json:"algorithm,omitempty" jsonschema:"enum=,enum=HS256,enum=HS384,enum=HS512"`
+		Issuer    string `json:"issuer,omitempty"`
+		// TTL is the lifetime of the tokens, default is 10m. It must not
+		// be longer than KeyRotationInterval.
+		TTL string `json:"ttl,omitempty" jsonschema:"format=duration"`
+		// KeyRotationInterval is the interval to rotate the signing key,
+		// default is 24h. The keys are shared by all members.
+		KeyRotationInterval string `json:"keyRotationInterval,omitempty" jsonschema:"format=duration"`
+
+		// SubjectHeader is the request header of the authenticated user,
+		// set by the authentication filter. ClaimHeaders are the other
+		// request headers kept in the tokens. They are restored from the
+		// tokens when the tokens are verified.
+		SubjectHeader string   `json:"subjectHeader" jsonschema:"required"`
+		ClaimHeaders  []string `json:"claimHeaders,omitempty"`
+
+		// CookieName is the name of the cookie carrying the tokens, and
+		// HeaderName is the name of the header carrying the tokens, at
+		// least one of them is required.
+		CookieName   string `json:"cookieName,omitempty"`
+		CookieSecure bool   `json:"cookieSecure,omitempty"`
+		HeaderName   string `json:"headerName,omitempty"`
+	}
+
+	// Status is the status of TokenIssuer.
+	Status struct {
+		Verified uint64 `json:"verified"`
+		Issued   uint64 `json:"issued"`
+		Keys     int    `json:"keys"`
+	}
+
+	// claims is the claims of the tokens.
+	claims struct {
+		jwt.RegisteredClaims
+		Headers map[string]string `json:"hdrs,omitempty"`
+	}
+
+	// passState is the state of the request kept in the context between
+	// the two passes of the filter.
+	passState struct {
+		claims *claims
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.CookieName == "" && spec.HeaderName == "" {
+		return fmt.Errorf("at least one of cookieName and headerName is required")
+	}
+
+	ttl := defaultTTL
+	if spec.TTL != "" {
+		d, err := time.ParseDuration(spec.TTL)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid ttl %s", spec.TTL)
+		}
+		ttl = d
+	}
+
+	interval := defaultKeyRotationInterval
+	if spec.KeyRotationInterval != "" {
+		d, err := time.ParseDuration(spec.KeyRotationInterval)
+		if err != nil || d < time.Minute {
+			return fmt.Errorf("invalid keyRotationInterval %s, it must be at least 1m", spec.KeyRotationInterval)
+		}
+		interval = d
+	}
+
+	if ttl > interval {
+		return fmt.Errorf("ttl %s is longer than keyRotationInterval %s", ttl, interval)
+	}
+	return nil
+}
+
+// Name returns the name of the TokenIssuer filter instance.
+func (ti *TokenIssuer) Name() string {
+	return ti.spec.Name()
+}
+
+// Kind returns the kind of TokenIssuer.
+func (ti *TokenIssuer) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the TokenIssuer
+func (ti *TokenIssuer) Spec() filters.Spec {
+	return ti.spec
+}
+
+// Init initializes TokenIssuer.
+func (ti *TokenIssuer) Init() {
+	ti.reload(nil)
+}
+
+// Inherit inherits previous generation of TokenIssuer.
+func (ti *TokenIssuer) Inherit(previousGeneration filters.Filter) {
+	ti.reload(previousGeneration.(*TokenIssuer))
+}
+
+func (ti *TokenIssuer) reload(previousGeneration *TokenIssuer) {
+	ti.method = jwt.SigningMethodHS256
+	if ti.spec.Algorithm != "" {
+		ti.method = jwt.GetSigningMethod(ti.spec.Algorithm)
+	}
+
+	ti.ttl = defaultTTL
+	if ti.spec.TTL != "" {
+		ti.ttl, _ = time.ParseDuration(ti.spec.TTL)
+	}
+
+	interval := defaultKeyRotationInterval
+	if ti.spec.KeyRotationInterval != "" {
+		interval, _ = time.ParseDuration(ti.spec.KeyRotationInterval)
+	}
+
+	name := fmt.Sprintf("%s/%s", ti.spec.Pipeline(), ti.spec.Name())
+
+	// the keys are kept in the cluster if it is available, otherwise they
+	// are inherited from the previous generation.
+	var cls cluster.Cluster
+	var clsKey string
+	var keys []*signingKey
+	if super := ti.spec.Super(); super != nil && super.Cluster() != nil {
+		cls = super.Cluster()
+		clsKey = cls.Layout().TokenIssuerKeysKey(ti.spec.Pipeline(), ti.spec.Name())
+	} else if previousGeneration != nil {
+		keys = previousGeneration.keys.allKeys()
+	}
+	ti.keys = newKeyManager(name, interval, cls, clsKey, keys)
+}
+
+func (ti *TokenIssuer) dataKey() string {
+	return "tokenIssuer/" + ti.spec.Name()
+}
+
+// Handle verifies the token of the request in the first pass, and issues a
+// token in the second pass if the request has no valid token.
+func (ti *TokenIssuer) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	if v := ctx.GetData(ti.dataKey()); v != nil {
+		ti.issue(ctx, req, v.(*passState))
+		return ""
+	}
+
+	c := ti.verify(req)
+	ctx.SetData(ti.dataKey(), &passState{claims: c})
+
+	h := req.HTTPHeader()
+	if c == nil {
+		// only the authentication filter could set these headers.
+		h.Del(ti.spec.SubjectHeader)
+		for _, name := range ti.spec.ClaimHeaders {
+			h.Del(name)
+		}
+		return ""
+	}
+
+	h.Set(ti.spec.SubjectHeader, c.Subject)
+	for _, name := range ti.spec.ClaimHeaders {
+		if v, ok := c.Headers[name]; ok {
+			h.Set(name, v)
+		} else {
+			h.Del(name)
+		}
+	}
+	atomic.AddUint64(&ti.verified, 1)
+	return resultVerified
+}
+
+// getToken returns the token carried by the request.
+func (ti *TokenIssuer) getToken(req *httpprot.Request) string {
+	if ti.spec.CookieName != "" {
+		if cookie, err := req.Cookie(ti.spec.CookieName); err == nil {
+			return cookie.Value
+		}
+	}
+	if ti.spec.HeaderName != "" {
+		token := req.HTTPHeader().Get(ti.spec.HeaderName)
+		return strings.TrimPrefix(token, "Bearer ")
+	}
+	return ""
+}
+
+// verify returns the claims of the token of the request, it is nil if the
+// request has no valid token.
+func (ti *TokenIssuer) verify(req *httpprot.Request) *claims {
+	token := ti.getToken(req)
+	if token == "" {
+		return nil
+	}
+
+	c := &claims{}
+	keyFunc := func(t *jwt.Token) (interface{}, error) {
+		id, _ := t.Header["kid"].(string)
+		key := ti.keys.lookup(id)
+		if key == nil {
+			return nil, fmt.Errorf("unknown key %s", id)
+		}
+		return key.Key, nil
+	}
+	_, err := jwt.ParseWithClaims(token, c, keyFunc, jwt.WithValidMethods([]string{ti.method.Alg()}))
+	if err != nil {
+		return nil
+	}
+	if ti.spec.Issuer != "" && !c.VerifyIssuer(ti.spec.Issuer, true) {
+		return nil
+	}
+	if c.Subject == "" {
+		return nil
+	}
+	return c
+}
+
+// issue issues a token if the request is authenticated and the response is
+// successful.
+func (ti *TokenIssuer) issue(ctx *context.Context, req *httpprot.Request, state *passState) {
+	if state.claims != nil {
+		return
+	}
+
+	h := req.HTTPHeader()
+	subject := h.Get(ti.spec.SubjectHeader)
+	if subject == "" {
+		return
+	}
+
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil || resp.StatusCode() >= 400 {
+		return
+	}
+
+	key := ti.keys.current()
+	if key == nil {
+		logger.Errorf("%s: no signing key to issue tokens", ti.spec.Name())
+		return
+	}
+
+	now := time.Now()
+	c := &claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    ti.spec.Issuer,
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ti.ttl)),
+		},
+	}
+	for _, name := range ti.spec.ClaimHeaders {
+		if v := h.Get(name); v != "" {
+			if c.Headers == nil {
+				c.Headers = map[string]string{}
+			}
+			c.Headers[name] = v
+		}
+	}
+
+	t := jwt.NewWithClaims(ti.method, c)
+	t.Header["kid"] = key.ID
+	token, err := t.SignedString(key.Key)
+	if err != nil {
+		logger.Errorf("%s: sign token failed: %v", ti.spec.Name(), err)
+		return
+	}
+
+	if ti.spec.CookieName != "" {
+		resp.SetCookie(&http.Cookie{
+			Name:     ti.spec.CookieName,
+			Value:    token,
+			Path:     "/",
+			Expires:  c.ExpiresAt.Time,
+			Secure:   ti.spec.CookieSecure,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	if ti.spec.HeaderName != "" {
+		resp.HTTPHeader().Set(ti.spec.HeaderName, token)
+	}
+	atomic.AddUint64(&ti.issued, 1)
+}
+
+// Status returns the status of TokenIssuer.
+func (ti *TokenIssuer) Status() interface{} {
+	return &Status{
+		Verified: atomic.LoadUint64(&ti.verified),
+		Issued:   atomic.LoadUint64(&ti.issued),
+		Keys:     len(ti.keys.allKeys()),
+	}
+}
+
+// Close closes TokenIssuer.
+func (ti *TokenIssuer) Close() {
+	ti.keys.close()
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tokenissuer
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+func newTokenIssuer(t *testing.T, yamlConfig string) *TokenIssuer {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	ti := kind.CreateInstance(spec).(*TokenIssuer)
+	ti.Init()
+	return ti
+}
+
+func newContext(t *testing.T, cookies ...*http.Cookie) *context.Context {
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	for _, c := range cookies {
+		stdr.AddCookie(c)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+// setResponse simulates the backend.
+func setResponse(t *testing.T, ctx *context.Context, statusCode int) *httpprot.Response {
+	resp, err := httpprot.NewResponse(nil)
+	assert.NoError(t, err)
+	resp.SetStatusCode(statusCode)
+	ctx.SetOutputResponse(resp)
+	return resp
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{CookieName: "token"}).Validate())
+	assert.NoError((&Spec{HeaderName: "X-Token", TTL: "1h", KeyRotationInterval: "1h"}).Validate())
+	assert.Error((&Spec{}).Validate())
+	assert.Error((&Spec{CookieName: "token", TTL: "0s"}).Validate())
+	assert.Error((&Spec{CookieName: "token", KeyRotationInterval: "10s"}).Validate())
+	assert.Error((&Spec{CookieName: "token", TTL: "2h", KeyRotationInterval: "1h"}).Validate())
+}
+
+func TestRotateKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &keyManager{interval: time.Hour}
+	now := time.Now()
+
+	keys, err := m.rotateKeys(nil, now)
+	assert.NoError(err)
+	assert.Len(keys, 1)
+	assert.Len(keys[0].Key, 32)
+	assert.NotEmpty(keys[0].ID)
+
+	rotated, err := m.rotateKeys(keys, now.Add(time.Minute))
+	assert.NoError(err)
+	assert.Nil(rotated)
+
+	for i := 1; i <= 5; i++ {
+		rotated, err = m.rotateKeys(keys, now.Add(time.Duration(i)*time.Hour))
+		assert.NoError(err)
+		assert.Equal(keys[0], rotated[1])
+		keys = rotated
+	}
+	assert.Len(keys, maxKeys)
+}
+
+func TestSharedKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	var mutex sync.Mutex
+	store := map[string]string{}
+	cls := clustertest.NewMockedCluster()
+	cls.MockedLayout = func() *cluster.Layout { return &cluster.Layout{} }
+	cls.MockedSTM = func(apply func(concurrency.STM) error) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return apply(&clustertest.MockedSTM{
+			MockedGet: func(key ...string) string { return store[key[0]] },
+			MockedPut: func(key, val string, opts ...clientv3.OpOption) { store[key] = val },
+		})
+	}
+
+	m1 := newKeyManager("m1", time.Hour, cls, "keys", nil)
+	defer m1.close()
+	m2 := newKeyManager("m2", time.Hour, cls, "keys", nil)
+	defer m2.close()
+	assert.Equal(m1.current().ID, m2.current().ID)
+
+	// the key is rotated by another member.
+	keys, err := m1.rotateKeys(m1.allKeys(), time.Now().Add(time.Hour))
+	assert.NoError(err)
+	data, err := codectool.MarshalJSON(keys)
+	assert.NoError(err)
+	mutex.Lock()
+	store["keys"] = string(data)
+	mutex.Unlock()
+
+	assert.NotNil(m2.lookup(keys[0].ID))
+	assert.Equal(keys[0].ID, m2.current().ID)
+	// the unknown keys are not synced too often.
+	assert.Nil(m2.lookup("unknown"))
+}
+
+func TestIssueAndVerify(t *testing.T) {
+	assert := assert.New(t)
+
+	ti := newTokenIssuer(t, `
+kind: TokenIssuer
+name: token
+issuer: easegress
+subjectHeader: X-User
+claimHeaders: [X-Role]
+cookieName: token
+headerName: X-Token
+`)
+	defer ti.Close()
+
+	// no token, the headers forged by the client are removed.
+	ctx := newContext(t)
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	req.HTTPHeader().Set("X-User", "mallory")
+	assert.Equal("", ti.Handle(ctx))
+	assert.Empty(req.HTTPHeader().Get("X-User"))
+
+	// the authentication filter sets the headers, and the backend fails.
+	req.HTTPHeader().Set("X-User", "alice")
+	req.HTTPHeader().Set("X-Role", "admin")
+	resp := setResponse(t, ctx, http.StatusInternalServerError)
+	assert.Equal("", ti.Handle(ctx))
+	assert.Empty(resp.HTTPHeader().Get("X-Token"))
+
+	// the token is issued after a successful response.
+	ctx = newContext(t)
+	ti.Handle(ctx)
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	req.HTTPHeader().Set("X-User", "alice")
+	req.HTTPHeader().Set("X-Role", "admin")
+	resp = setResponse(t, ctx, http.StatusOK)
+	assert.Equal("", ti.Handle(ctx))
+	assert.NotEmpty(resp.HTTPHeader().Get("X-Token"))
+	cookies := (&http.Response{Header: resp.Std().Header}).Cookies()
+	assert.Len(cookies, 1)
+	assert.True(cookies[0].HttpOnly)
+
+	// the token is verified, and the headers are restored.
+	ctx = newContext(t, cookies[0])
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	req.HTTPHeader().Set("X-Role", "root")
+	assert.Equal(resultVerified, ti.Handle(ctx))
+	assert.Equal("alice", req.HTTPHeader().Get("X-User"))
+	assert.Equal("admin", req.HTTPHeader().Get("X-Role"))
+	// no new token for the verified request.
+	resp = setResponse(t, ctx, http.StatusOK)
+	assert.Equal("", ti.Handle(ctx))
+	assert.Empty(resp.HTTPHeader().Get("X-Token"))
+
+	// the header works too.
+	ctx = newContext(t)
+	req = ctx.GetInputRequest().(*httpprot.Request)
+	req.HTTPHeader().Set("X-Token", "Bearer "+cookies[0].Value)
+	assert.Equal(resultVerified, ti.Handle(ctx))
+
+	// the tampered token is rejected.
+	cookies[0].Value += "x"
+	assert.Equal("", ti.Handle(newContext(t, cookies[0])))
+	cookies[0].Value = cookies[0].Value[:len(cookies[0].Value)-1]
+
+	// the keys are kept by the next generation.
+	next := kind.CreateInstance(ti.spec).(*TokenIssuer)
+	next.Inherit(ti)
+	defer next.Close()
+	assert.Equal(resultVerified, next.Handle(newContext(t, cookies[0])))
+
+	assert.Equal(&Status{Verified: 2, Issued: 1, Keys: 1}, ti.Status())
+}
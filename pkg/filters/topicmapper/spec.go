@@ -17,7 +17,10 @@
 
 package topicmapper
 
-import "github.com/megaease/easegress/v2/pkg/filters"
+import (
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+)
 
 type (
 	// Spec is spec of Kafka
@@ -56,3 +59,24 @@ type (
 		Exprs []string `json:"exprs" jsonschema:"required"`
 	}
 )
+
+func (s *SetKV) topicKey() context.DataKey[string] {
+	return context.NewUserDataKey[string](s.Topic)
+}
+
+func (s *SetKV) headersKey() context.DataKey[map[string]string] {
+	return context.NewUserDataKey[map[string]string](s.Headers)
+}
+
+// DataInputs returns the data read by TopicMapper.
+func (s *Spec) DataInputs() []context.DataDecl {
+	return nil
+}
+
+// DataOutputs returns the data written by TopicMapper.
+func (s *Spec) DataOutputs() []context.DataDecl {
+	if s.SetKV == nil {
+		return nil
+	}
+	return []context.DataDecl{s.SetKV.topicKey().Decl(), s.SetKV.headersKey().Decl()}
+}
@@ -109,7 +109,7 @@ func (k *TopicMapper) Handle(ctx *context.Context) string {
 
 		return resultMQTTTopicMapFailed
 	}
-	ctx.SetData(k.spec.SetKV.Topic, topic)
-	ctx.SetData(k.spec.SetKV.Headers, headers)
+	k.spec.SetKV.topicKey().Set(ctx, topic)
+	k.spec.SetKV.headersKey().Set(ctx, headers)
 	return ""
 }
@@ -37,6 +37,7 @@ import (
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot/httpheader"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/authcache"
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
 )
 
@@ -92,6 +93,7 @@ type (
 	ldapUserCache struct {
 		spec   *ldapSpec
 		client *ldap.LDAPClient
+		cache  *authcache.Cache
 	}
 
 	// ldapSpec defines the configuration of LDAP authentication
@@ -107,6 +109,10 @@ type (
 		CertBase64   string `json:"certBase64,omitempty" jsonschema:"format=base64"`
 		KeyBase64    string `json:"keyBase64,omitempty" jsonschema:"format=base64"`
 		certificates []tls.Certificate
+
+		// Cache caches the successful authentications, so that the LDAP
+		// server is not hit for every request.
+		Cache *authcache.Spec `json:"cache,omitempty"`
 	}
 
 	// BasicAuthValidator defines the Basic Auth validator
@@ -335,7 +341,7 @@ func (euc *etcdUserCache) Match(username string, password string) bool {
 	return euc.userFileObject.Match(username, password)
 }
 
-func newLDAPUserCache(spec *ldapSpec) *ldapUserCache {
+func newLDAPUserCache(spec *ldapSpec, cls cluster.Cluster) *ldapUserCache {
 	if spec.CertBase64 != "" && spec.KeyBase64 != "" {
 		certPem, _ := base64.StdEncoding.DecodeString(spec.CertBase64)
 		keyPem, _ := base64.StdEncoding.DecodeString(spec.KeyBase64)
@@ -355,10 +361,14 @@ func newLDAPUserCache(spec *ldapSpec) *ldapUserCache {
 		ServerName:         spec.ServerName,
 		ClientCertificates: spec.certificates,
 	}
-	return &ldapUserCache{
+	luc := &ldapUserCache{
 		spec:   spec,
 		client: client,
 	}
+	if spec.Cache != nil {
+		luc.cache = authcache.New(spec.Cache, cls)
+	}
+	return luc
 }
 
 // make it mockable
@@ -378,7 +388,20 @@ var fnAuthLDAP = func(luc *ldapUserCache, username, password string) bool {
 }
 
 func (luc *ldapUserCache) Match(username, password string) bool {
-	return fnAuthLDAP(luc, username, password)
+	if luc.cache == nil {
+		return fnAuthLDAP(luc, username, password)
+	}
+
+	key := fmt.Sprintf("%s:%d\n%s\n%s\n%s", luc.spec.Host, luc.spec.Port, luc.spec.BaseDN, username, password)
+	// only the successful results are cached, because a failure may be
+	// caused by the unavailable LDAP server.
+	_, err := luc.cache.Get(key, func() ([]byte, time.Duration, error) {
+		if !fnAuthLDAP(luc, username, password) {
+			return nil, 0, fmt.Errorf("authentication failed")
+		}
+		return []byte{}, 0, nil
+	})
+	return err == nil
 }
 
 func (luc *ldapUserCache) WatchChanges() {
@@ -388,6 +411,9 @@ func (luc *ldapUserCache) Close() {
 	if luc.client != nil {
 		luc.client.Close()
 	}
+	if luc.cache != nil {
+		luc.cache.Close()
+	}
 }
 
 // NewBasicAuthValidator creates a new Basic Auth validator
@@ -403,7 +429,11 @@ func NewBasicAuthValidator(spec *BasicAuthValidatorSpec, supervisor *supervisor.
 	case "FILE":
 		cache = newHtpasswdUserCache(spec.UserFile, 1*time.Minute)
 	case "LDAP":
-		cache = newLDAPUserCache(spec.LDAP)
+		var cls cluster.Cluster
+		if supervisor != nil {
+			cls = supervisor.Cluster()
+		}
+		cache = newLDAPUserCache(spec.LDAP, cls)
 	default:
 		logger.Errorf("BasicAuth validator spec unvalid.")
 		return nil
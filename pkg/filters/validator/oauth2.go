@@ -24,10 +24,14 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt"
 
+	"github.com/megaease/easegress/v2/pkg/cluster"
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/authcache"
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
 )
 
@@ -39,6 +43,9 @@ type (
 		ClientID     string `json:"clientId,omitempty"`
 		ClientSecret string `json:"clientSecret,omitempty"`
 		InsecureTLS  bool   `json:"insecureTls,omitempty"`
+		// Cache caches the introspection results, the results are cached
+		// until the tokens expire, but not longer than the TTL of the cache.
+		Cache *authcache.Spec `json:"cache,omitempty"`
 	}
 
 	// OAuth2JWT defines the validator configuration for OAuth2 self encoded access token
@@ -59,6 +66,7 @@ type (
 	OAuth2Validator struct {
 		spec   *OAuth2ValidatorSpec
 		client *http.Client
+		cache  *authcache.Cache
 	}
 
 	tokenInfo struct {
@@ -77,7 +85,7 @@ type (
 )
 
 // NewOAuth2Validator creates a new OAuth2 validator
-func NewOAuth2Validator(spec *OAuth2ValidatorSpec) *OAuth2Validator {
+func NewOAuth2Validator(spec *OAuth2ValidatorSpec, supervisor *supervisor.Supervisor) *OAuth2Validator {
 	if spec.JWT != nil {
 		spec.JWT.secretBytes, _ = hex.DecodeString(spec.JWT.Secret)
 	}
@@ -89,16 +97,64 @@ func NewOAuth2Validator(spec *OAuth2ValidatorSpec) *OAuth2Validator {
 		} else {
 			v.client = http.DefaultClient
 		}
+		if spec.TokenIntrospect.Cache != nil {
+			var cls cluster.Cluster
+			if supervisor != nil {
+				cls = supervisor.Cluster()
+			}
+			v.cache = authcache.New(spec.TokenIntrospect.Cache, cls)
+		}
 	}
 	return v
 }
 
+// Close closes the OAuth2 validator.
+func (v *OAuth2Validator) Close() {
+	if v.cache != nil {
+		v.cache.Close()
+	}
+}
+
 // make it mockable
 var fnSendRequest = func(client *http.Client, r *http.Request) (*http.Response, error) {
 	return client.Do(r)
 }
 
 func (v *OAuth2Validator) introspectToken(tokenStr string) (*tokenInfo, error) {
+	if v.cache == nil {
+		return v.doIntrospectToken(tokenStr)
+	}
+
+	key := v.spec.TokenIntrospect.EndPoint + "\n" + tokenStr
+	data, err := v.cache.Get(key, func() ([]byte, time.Duration, error) {
+		ti, err := v.doIntrospectToken(tokenStr)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var ttl time.Duration
+		if ti.ExpiresAt > 0 {
+			ttl = time.Until(time.Unix(ti.ExpiresAt, 0))
+			if ttl <= 0 {
+				ttl = -1
+			}
+		}
+
+		data, err := codectool.MarshalJSON(ti)
+		return data, ttl, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ti := &tokenInfo{}
+	if err = codectool.UnmarshalJSON(data, ti); err != nil {
+		return nil, err
+	}
+	return ti, nil
+}
+
+func (v *OAuth2Validator) doIntrospectToken(tokenStr string) (*tokenInfo, error) {
 	var body bytes.Buffer
 	body.WriteString("token=")
 	body.WriteString(tokenStr)
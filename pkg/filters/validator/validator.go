@@ -122,7 +122,7 @@ func (v *Validator) reload() {
 		v.signer = signer.CreateFromSpec(v.spec.Signature)
 	}
 	if v.spec.OAuth2 != nil {
-		v.oauth2 = NewOAuth2Validator(v.spec.OAuth2)
+		v.oauth2 = NewOAuth2Validator(v.spec.OAuth2, v.spec.Super())
 	}
 	if v.spec.BasicAuth != nil {
 		v.basicAuth = NewBasicAuthValidator(v.spec.BasicAuth, v.spec.Super())
@@ -182,11 +182,23 @@ func (v *Validator) Handle(ctx *context.Context) string {
 	return ""
 }
 
+// NeedPayload returns whether the request payload is needed, which is true
+// if the signature covers the body, it implements context.PayloadNeeder.
+func (v *Validator) NeedPayload() (request, response bool) {
+	if s := v.spec.Signature; s != nil && !s.ExcludeBody {
+		return true, false
+	}
+	return false, false
+}
+
 // Status returns status.
 func (v *Validator) Status() interface{} { return nil }
 
 // Close closes validations.
 func (v *Validator) Close() {
+	if v.oauth2 != nil {
+		v.oauth2.Close()
+	}
 	if v.basicAuth != nil {
 		v.basicAuth.Close()
 	}
@@ -350,6 +350,64 @@ oauth2:
 	}
 }
 
+func TestOAuth2TokenIntrospectCache(t *testing.T) {
+	assert := assert.New(t)
+	yamlConfig := `
+kind: Validator
+name: validator
+oauth2:
+  tokenIntrospect:
+    endPoint: http://oauth2.megaease.com/
+    clientId: megaease
+    clientSecret: secret
+    cache:
+      ttl: 1m
+`
+	v := createValidator(yamlConfig, nil, nil)
+	defer v.Close()
+
+	requests := 0
+	active := true
+	fnSendRequest = func(client *http.Client, r *http.Request) (*http.Response, error) {
+		requests++
+		body := fmt.Sprintf(`{"sub": "megaease.com", "active": %v}`, active)
+		return &http.Response{
+			Body: io.NopCloser(strings.NewReader(body)),
+		}, nil
+	}
+
+	handle := func(token string) string {
+		ctx := context.New(nil)
+		req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		assert.Nil(err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		setRequest(t, ctx, req)
+		return v.Handle(ctx)
+	}
+
+	assert.NotEqual(resultInvalid, handle("token1"))
+	assert.NotEqual(resultInvalid, handle("token1"))
+	assert.Equal(1, requests)
+
+	// the inactive results are cached too.
+	active = false
+	assert.Equal(resultInvalid, handle("token2"))
+	assert.Equal(resultInvalid, handle("token2"))
+	assert.Equal(2, requests)
+
+	// the results of the expired tokens are not cached.
+	fnSendRequest = func(client *http.Client, r *http.Request) (*http.Response, error) {
+		requests++
+		body := `{"sub": "megaease.com", "active": true, "exp": 1}`
+		return &http.Response{
+			Body: io.NopCloser(strings.NewReader(body)),
+		}, nil
+	}
+	handle("token3")
+	handle("token3")
+	assert.Equal(4, requests)
+}
+
 func TestSignature(t *testing.T) {
 	// This test is almost covered by signer
 
@@ -614,4 +672,51 @@ basicAuth:
 
 		v.Close()
 	})
+
+	t.Run("credentials from LDAP with cache", func(t *testing.T) {
+		assert := assert.New(t)
+
+		yamlConfig := `
+kind: Validator
+name: validator
+basicAuth:
+  mode: LDAP
+  ldap:
+    host: localhost
+    port: 3893
+    baseDN: ou=superheros,dc=glauth,dc=com
+    uid: cn
+    skipTLS: true
+    cache:
+      ttl: 1m
+`
+		// mock
+		binds := 0
+		fnAuthLDAP = func(luc *ldapUserCache, username, password string) bool {
+			binds++
+			return password == passwords[0]
+		}
+
+		v := createValidator(yamlConfig, nil, nil)
+		for i := 0; i < 2; i++ {
+			ctx, header := prepareCtxAndHeader()
+			b64creds := base64.StdEncoding.EncodeToString([]byte(userIds[0] + ":" + passwords[0]))
+			header.Set("Authorization", "Basic "+b64creds)
+			result := v.Handle(ctx)
+			assert.True(result != resultInvalid)
+		}
+		assert.Equal(1, binds)
+
+		// the failures are not cached.
+		for i := 0; i < 2; i++ {
+			ctx, header := prepareCtxAndHeader()
+			b64creds := base64.StdEncoding.EncodeToString([]byte(userIds[0] + ":wrong"))
+			header.Set("Authorization", "Basic "+b64creds)
+			result := v.Handle(ctx)
+			assert.True(result == resultInvalid)
+		}
+		assert.Equal(3, binds)
+
+		v.Close()
+	})
 }
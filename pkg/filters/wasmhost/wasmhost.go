@@ -377,6 +377,12 @@ func (wh *WasmHost) Handle(ctx *context.Context) (result string) {
 	return wasmResultToFilterResult(n)
 }
 
+// NeedPayload returns true for both payloads, because the wasm code could
+// read any of them, it implements context.PayloadNeeder.
+func (wh *WasmHost) NeedPayload() (request, response bool) {
+	return true, true
+}
+
 // Status returns Status generated by the filter.
 func (wh *WasmHost) Status() interface{} {
 	p := wh.vmPool.Load()
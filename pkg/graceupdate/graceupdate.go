@@ -20,18 +20,23 @@ package graceupdate
 
 import (
 	"os"
+	"sync/atomic"
 
 	"github.com/megaease/grace/gracenet"
 
 	"github.com/megaease/easegress/v2/pkg/common"
 	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/systemd"
 )
 
 var (
-	// Global is gracenet Net struct
-	Global     = &gracenet.Net{}
-	didInherit = os.Getenv("LISTEN_FDS") != ""
+	// Global is gracenet Net struct, it also takes over the listeners
+	// passed by the socket activation of systemd.
+	Global = &gracenet.Net{}
+	// the listeners passed by systemd do not make a child process.
+	didInherit = os.Getenv("LISTEN_FDS") != "" && !systemd.IsSocketActivated()
 	ppid       = os.Getppid()
+	upgrading  atomic.Bool
 )
 
 // IsInherit returns if I am the child process
@@ -40,6 +45,12 @@ func IsInherit() bool {
 	return didInherit
 }
 
+// IsUpgrading returns if a child process is started to take over,
+// the process exits without stopping the service in this case.
+func IsUpgrading() bool {
+	return upgrading.Load()
+}
+
 // CallOriProcessTerm notifies parent process to exist.
 func CallOriProcessTerm(done chan struct{}) bool {
 	if didInherit && ppid != 1 {
@@ -71,7 +82,9 @@ func NotifySigUsr2(closeCls func(), restartCls func()) error {
 			// Reset signal usr2 notify
 			NotifySigUsr2(closeCls, restartCls)
 		} else {
+			upgrading.Store(true)
 			go func() {
+				defer upgrading.Store(false)
 				process, err := os.FindProcess(pid)
 				if err != nil {
 					restartCls()
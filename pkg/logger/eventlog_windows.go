@@ -0,0 +1,68 @@
+//go:build windows
+// +build windows
+
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// EventLogSource is the source of the logs written to the Windows event
+// log, it should be registered when installing the service.
+const EventLogSource = "Easegress"
+
+// eventLogWriter writes every log as an event of the same type.
+type eventLogWriter func(eid uint32, msg string) error
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	if err := w(1, string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// newEventLogCore creates the core writing the warnings and errors to the
+// Windows event log, which is used only when running as a Windows service,
+// since the standard outputs are discarded in that case.
+func newEventLogCore() zapcore.Core {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return nil
+	}
+
+	elog, err := eventlog.Open(EventLogSource)
+	if err != nil {
+		return nil
+	}
+
+	encoder := zapcore.NewConsoleEncoder(jsonEncoderConfig())
+	warnCore := zapcore.NewCore(encoder, zapcore.AddSync(eventLogWriter(elog.Warning)),
+		zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+			return l == zapcore.WarnLevel && coreLogLevel.Enabled(l)
+		}))
+	errorCore := zapcore.NewCore(encoder.Clone(), zapcore.AddSync(eventLogWriter(elog.Error)),
+		zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+			return l >= zapcore.ErrorLevel
+		}))
+	return zapcore.NewTee(warnCore, errorCore)
+}
@@ -46,22 +46,34 @@ func (llb lazyLogBuilder) String() string {
 
 // Debugf is the wrapper of default logger Debugf.
 func Debugf(template string, args ...interface{}) {
+	if !globalLogLevel.Enabled(zap.DebugLevel) {
+		return
+	}
 	defaultLogger.Debugf(template, args...)
 }
 
 // LazyDebug logs debug log in lazy mode. if debug log is disabled by configuration,
 // it skips the the built of log message to improve performance
 func LazyDebug(fn func() string) {
+	if !globalLogLevel.Enabled(zap.DebugLevel) {
+		return
+	}
 	defaultLogger.Debug(lazyLogBuilder{fn})
 }
 
 // Infof is the wrapper of default logger Infof.
 func Infof(template string, args ...interface{}) {
+	if !globalLogLevel.Enabled(zap.InfoLevel) {
+		return
+	}
 	defaultLogger.Infof(template, args...)
 }
 
 // Warnf is the wrapper of default logger Warnf.
 func Warnf(template string, args ...interface{}) {
+	if !globalLogLevel.Enabled(zap.WarnLevel) {
+		return
+	}
 	defaultLogger.Warnf(template, args...)
 }
 
@@ -165,6 +177,9 @@ func getSpanTemplate(context *model.SpanContext, template string) string {
 
 // SpanDebugf is the wrapper of default logger Debugf to log tracing message
 func SpanDebugf(context *model.SpanContext, template string, args ...interface{}) {
+	if !globalLogLevel.Enabled(zap.DebugLevel) {
+		return
+	}
 	temp := getSpanTemplate(context, template)
 	defaultLogger.Debugf(temp, args...)
 }
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import "go.uber.org/zap/zapcore"
+
+const (
+	// FieldModule is the field of the module writing the log.
+	FieldModule = "module"
+	// FieldNode is the field of the name of the Easegress member.
+	FieldNode = "node"
+	// FieldGroup is the field of the name of the cluster.
+	FieldGroup = "group"
+	// FieldPipeline is the field of the pipeline handling the request.
+	FieldPipeline = "pipeline"
+	// FieldRequestID is the field of the ID of the request.
+	FieldRequestID = "requestID"
+)
+
+// Logger is a logger with structured fields. The fields are keys of the
+// object in the json format, and are appended to the message in the text
+// format. The logs of a module logger are filtered by the log level of the
+// module if it is set, or the global log level otherwise.
+type Logger struct {
+	module string
+	fields []interface{}
+}
+
+// With returns a logger with the fields, keysAndValues are pairs of keys
+// and values. The default logger is looked up for every log, so it is safe
+// to create a logger before the logger package is initialized.
+func With(keysAndValues ...interface{}) *Logger {
+	return &Logger{fields: keysAndValues}
+}
+
+// Module returns a logger of the module, with the module field.
+func Module(name string) *Logger {
+	return &Logger{module: name, fields: []interface{}{FieldModule, name}}
+}
+
+// With returns a new logger with the fields of l and keysAndValues.
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keysAndValues))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keysAndValues...)
+	return &Logger{module: l.module, fields: fields}
+}
+
+// Debugf is the wrapper of default logger Debugf with fields.
+func (l *Logger) Debugf(template string, args ...interface{}) {
+	if moduleEnabled(l.module, zapcore.DebugLevel) {
+		defaultLogger.With(l.fields...).Debugf(template, args...)
+	}
+}
+
+// Infof is the wrapper of default logger Infof with fields.
+func (l *Logger) Infof(template string, args ...interface{}) {
+	if moduleEnabled(l.module, zapcore.InfoLevel) {
+		defaultLogger.With(l.fields...).Infof(template, args...)
+	}
+}
+
+// Warnf is the wrapper of default logger Warnf with fields.
+func (l *Logger) Warnf(template string, args ...interface{}) {
+	if moduleEnabled(l.module, zapcore.WarnLevel) {
+		defaultLogger.With(l.fields...).Warnf(template, args...)
+	}
+}
+
+// Errorf is the wrapper of default logger Errorf with fields.
+func (l *Logger) Errorf(template string, args ...interface{}) {
+	if moduleEnabled(l.module, zapcore.ErrorLevel) {
+		defaultLogger.With(l.fields...).Errorf(template, args...)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// The cores of the system loggers accept the lowest level of the global
+// level and the module levels, so the logs are filtered by the global level
+// or the level of their modules before they reach the cores.
+
+var (
+	moduleLogLevels   = map[string]zapcore.Level{}
+	moduleLogLevelsMu sync.RWMutex
+)
+
+// ParseLevel parses the log level, only debug, info, warn and error are
+// supported.
+func ParseLevel(level string) (zapcore.Level, error) {
+	switch level {
+	case "debug", "DEBUG":
+		return zapcore.DebugLevel, nil
+	case "info", "INFO":
+		return zapcore.InfoLevel, nil
+	case "warn", "WARN":
+		return zapcore.WarnLevel, nil
+	case "error", "ERROR":
+		return zapcore.ErrorLevel, nil
+	}
+	return zapcore.InfoLevel, fmt.Errorf("invalid log level %s, supported levels are debug, info, warn and error", level)
+}
+
+// SetModuleLogLevel sets the log level of a module, which overrides the
+// global log level for the logs of the module.
+func SetModuleLogLevel(module string, level zapcore.Level) {
+	moduleLogLevelsMu.Lock()
+	moduleLogLevels[module] = level
+	moduleLogLevelsMu.Unlock()
+
+	updateCoreLogLevel()
+}
+
+// ResetModuleLogLevel resets the log level of a module to the global log
+// level.
+func ResetModuleLogLevel(module string) {
+	moduleLogLevelsMu.Lock()
+	delete(moduleLogLevels, module)
+	moduleLogLevelsMu.Unlock()
+
+	updateCoreLogLevel()
+}
+
+// SetLogLevels sets the global log level and replaces the log levels of
+// all modules.
+func SetLogLevels(level zapcore.Level, modules map[string]zapcore.Level) {
+	moduleLogLevelsMu.Lock()
+	moduleLogLevels = make(map[string]zapcore.Level, len(modules))
+	for module, l := range modules {
+		moduleLogLevels[module] = l
+	}
+	moduleLogLevelsMu.Unlock()
+
+	SetLogLevel(level)
+}
+
+// GetModuleLogLevels returns the log levels of the modules.
+func GetModuleLogLevels() map[string]string {
+	moduleLogLevelsMu.RLock()
+	defer moduleLogLevelsMu.RUnlock()
+
+	levels := make(map[string]string, len(moduleLogLevels))
+	for module, l := range moduleLogLevels {
+		levels[module] = l.String()
+	}
+	return levels
+}
+
+// moduleEnabled reports whether the logs of the level are enabled for the
+// module.
+func moduleEnabled(module string, level zapcore.Level) bool {
+	if module != "" {
+		moduleLogLevelsMu.RLock()
+		l, ok := moduleLogLevels[module]
+		moduleLogLevelsMu.RUnlock()
+		if ok {
+			return l.Enabled(level)
+		}
+	}
+	return globalLogLevel.Enabled(level)
+}
+
+func updateCoreLogLevel() {
+	moduleLogLevelsMu.RLock()
+	defer moduleLogLevelsMu.RUnlock()
+
+	level := globalLogLevel.Level()
+	for _, l := range moduleLogLevels {
+		if l < level {
+			level = l
+		}
+	}
+	coreLogLevel.SetLevel(level)
+}
@@ -37,9 +37,10 @@ type (
 	// 1. Reopen the file after receiving SIGHUP, for log rotate.
 	// 2. Reduce execution time of callers by asynchronous log(return after only memory copy).
 	// 3. Batch write logs by cache them with timeout.
+	// 4. Rotate the file by size or time, compress and clean up the rotated files.
 	logFile struct {
 		filename string
-		file     *os.File
+		file     *RotateFile
 
 		logChan       chan []byte
 		syncEventChan chan *syncEvent
@@ -55,48 +56,31 @@ type (
 )
 
 // newLogFile can not open /dev/stderr, it will cause dead lock.
-func newLogFile(filename string, maxCacheCount uint32) (*logFile, error) {
+// The file is not rotated if rotation is the zero value.
+func newLogFile(filename string, maxCacheCount uint32, rotation RotateOptions) (*logFile, error) {
+	file, err := OpenRotateFile(filename, 0o640, rotation)
+	if err != nil {
+		return nil, err
+	}
+
 	lf := &logFile{
 		filename:      filename,
+		file:          file,
 		logChan:       make(chan []byte, logChanSize),
 		syncEventChan: make(chan *syncEvent),
 		maxCacheCount: maxCacheCount,
 		cache:         bytes.NewBuffer(nil),
 	}
 
-	err := lf.openFile()
-	if err != nil {
-		return nil, err
-	}
-
 	go lf.run()
 
 	return lf, nil
 }
 
-func (lf *logFile) openFile() error {
-	file, err := os.OpenFile(lf.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
-	if err != nil {
-		return err
-	}
-
-	lf.file = file
-	return nil
-}
-
-func (lf *logFile) closeFile() {
-	err := lf.file.Close()
-	if err != nil {
-		stderrLogger.Errorf("close %s failed: %v", lf.filename, err)
-	}
-}
-
 func (lf *logFile) reopenFile() {
-	lf.closeFile()
-	err := lf.openFile()
+	err := lf.file.Reopen()
 	if err != nil {
 		stderrLogger.Errorf("open %s failed: %v", lf.filename, err)
-		return
 	}
 }
 
@@ -119,6 +103,7 @@ func (lf *logFile) run() {
 			}
 		case <-time.After(cacheTimeout):
 			lf.flush()
+			lf.file.RotateIfDue()
 		}
 	}
 }
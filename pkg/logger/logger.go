@@ -39,12 +39,14 @@ import (
 func init() {
 	globalLogLevel = zap.NewAtomicLevel()
 	globalLogLevel.SetLevel(zap.InfoLevel)
+	coreLogLevel = zap.NewAtomicLevel()
+	coreLogLevel.SetLevel(zap.InfoLevel)
 }
 
 // Init initializes logger.
 func Init(opt *option.Options) {
 	if opt.Debug {
-		globalLogLevel.SetLevel(zap.DebugLevel)
+		SetLogLevel(zap.DebugLevel)
 	}
 
 	initDefault(opt)
@@ -93,6 +95,11 @@ const (
 	// NOTE: Under some pressure, it's easy to produce more than 1024 log entries
 	// within cacheTimeout(2s), so it's reasonable to flush them at this moment.
 	trafficLogMaxCacheCount = 1024
+
+	// FormatText is the log format of human-readable text.
+	FormatText = "text"
+	// FormatJSON is the log format of structured JSON, one object per line.
+	FormatJSON = "json"
 )
 
 var (
@@ -103,13 +110,17 @@ var (
 	httpFilterDumpLogger   *zap.SugaredLogger
 	restAPILogger          *zap.SugaredLogger
 	globalLogLevel         zap.AtomicLevel
+	// coreLogLevel is the level of the cores of the system loggers, it is
+	// the lowest one of the global level and the module levels.
+	coreLogLevel zap.AtomicLevel
 
 	stdoutLogPath string
 )
 
-// SetLogLevel sets log level. Only support debug and info.
+// SetLogLevel sets the global log level.
 func SetLogLevel(level zapcore.Level) {
 	globalLogLevel.SetLevel(level)
+	updateCoreLogLevel()
 }
 
 // GetLogLevel returns log level.
@@ -126,9 +137,15 @@ func GetLogPath() string {
 func EtcdClientLoggerConfig(opt *option.Options, filename string) *zap.Config {
 	encoderConfig := defaultEncoderConfig()
 
+	encoding := "console"
+	if opt.LogFormat == FormatJSON {
+		encoderConfig = jsonEncoderConfig()
+		encoding = "json"
+	}
+
 	cfg := &zap.Config{
 		Level:            globalLogLevel,
-		Encoding:         "console",
+		Encoding:         encoding,
 		EncoderConfig:    encoderConfig,
 		OutputPaths:      []string{"stdout"},
 		ErrorOutputPaths: []string{"stderr"},
@@ -160,13 +177,34 @@ func defaultEncoderConfig() zapcore.EncoderConfig {
 	}
 }
 
-func initDefault(opt *option.Options) {
+// jsonEncoderConfig is the encoder config of the json format, the level is
+// not colored so that the logs could be parsed by log systems.
+func jsonEncoderConfig() zapcore.EncoderConfig {
 	encoderConfig := defaultEncoderConfig()
+	encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	return encoderConfig
+}
+
+// newEncoder creates the encoder of the system logs according to the log
+// format, the node and group fields are added to every log in the json
+// format.
+func newEncoder(opt *option.Options) zapcore.Encoder {
+	if opt.LogFormat != FormatJSON {
+		return zapcore.NewConsoleEncoder(defaultEncoderConfig())
+	}
+
+	enc := zapcore.NewJSONEncoder(jsonEncoderConfig())
+	enc.AddString(FieldNode, opt.Name)
+	enc.AddString(FieldGroup, opt.ClusterName)
+	return enc
+}
+
+func initDefault(opt *option.Options) {
 
 	var err error
 	var gressLF io.Writer = os.Stdout
 	if opt.AbsLogDir != "" {
-		gressLF, err = newLogFile(filepath.Join(opt.AbsLogDir, stdoutFilename), systemLogMaxCacheCount)
+		gressLF, err = newLogFile(filepath.Join(opt.AbsLogDir, stdoutFilename), systemLogMaxCacheCount, newRotateOptions(opt))
 		if err != nil {
 			common.Exit(1, err.Error())
 		}
@@ -176,18 +214,21 @@ func initDefault(opt *option.Options) {
 	opts := []zap.Option{zap.AddCaller(), zap.AddCallerSkip(1)}
 
 	stderrSyncer := zapcore.AddSync(os.Stderr)
-	stderrCore := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), stderrSyncer, globalLogLevel)
+	stderrCore := zapcore.NewCore(newEncoder(opt), stderrSyncer, coreLogLevel)
 	stderrLogger = zap.New(stderrCore, opts...).Sugar()
 
 	gressSyncer := zapcore.AddSync(gressLF)
-	gressCore := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), gressSyncer, globalLogLevel)
+	gressCore := zapcore.NewCore(newEncoder(opt), gressSyncer, coreLogLevel)
 	gressLogger = zap.New(gressCore, opts...).Sugar()
 
 	defaultCore := gressCore
 	if gressLF != os.Stdout && gressLF != os.Stderr {
 		defaultCore = zapcore.NewTee(gressCore, stderrCore)
 	}
-	defaultLogger = zap.New(defaultCore, opts...).Sugar()
+	if eventLogCore := newEventLogCore(); eventLogCore != nil {
+		defaultCore = zapcore.NewTee(defaultCore, eventLogCore)
+	}
+	defaultLogger = zap.New(defaultCore, append(opts, zap.Hooks(recordError))...).Sugar()
 }
 
 func initHTTPFilter(opt *option.Options) {
@@ -222,7 +263,7 @@ func newPlainLogger(opt *option.Options, filename string, maxCacheCount uint32)
 	var err error
 	var fr io.Writer = os.Stdout
 	if opt.AbsLogDir != "" {
-		fr, err = newLogFile(filepath.Join(opt.AbsLogDir, filename), maxCacheCount)
+		fr, err = newLogFile(filepath.Join(opt.AbsLogDir, filename), maxCacheCount, newRotateOptions(opt))
 		if err != nil {
 			common.Exit(1, err.Error())
 		}
@@ -248,7 +289,7 @@ func mustNewPlainLogger(opt *option.Options, filename string, maxCacheCount uint
 	var err error
 	var fr io.Writer = os.Stdout
 	if opt.AbsLogDir != "" {
-		fr, err = newLogFile(filepath.Join(opt.AbsLogDir, filename), maxCacheCount)
+		fr, err = newLogFile(filepath.Join(opt.AbsLogDir, filename), maxCacheCount, newRotateOptions(opt))
 		if err != nil {
 			panic(fmt.Errorf("new log file %s failed: %w", filename, err))
 		}
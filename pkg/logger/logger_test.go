@@ -18,8 +18,19 @@
 package logger
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	"github.com/megaease/easegress/v2/pkg/option"
 )
@@ -77,3 +88,186 @@ func TestMustPlainLoggerWrite(t *testing.T) {
 	l.Sync()
 	t.Logf("mustPlainLogger() success")
 }
+
+func TestJSONFormat(t *testing.T) {
+	opt := &option.Options{Name: "eg-1", ClusterName: "eg-cluster", LogFormat: FormatJSON}
+
+	var buf bytes.Buffer
+	core := zapcore.NewCore(newEncoder(opt), zapcore.AddSync(&buf), zap.DebugLevel)
+	old := defaultLogger
+	defaultLogger = zap.New(core).Sugar()
+	defer func() { defaultLogger = old }()
+
+	Module("HTTPServer").With(FieldPipeline, "pipeline-demo", FieldRequestID, "req-1").Errorf("failed: %d", 1)
+
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("log is not json: %v, %s", err, buf.String())
+	}
+	expected := map[string]interface{}{
+		"level":     "ERROR",
+		"message":   "failed: 1",
+		"node":      "eg-1",
+		"group":     "eg-cluster",
+		"module":    "HTTPServer",
+		"pipeline":  "pipeline-demo",
+		"requestID": "req-1",
+	}
+	for k, v := range expected {
+		if m[k] != v {
+			t.Errorf("expect %s to be %v, got %v", k, v, m[k])
+		}
+	}
+}
+
+func TestModuleLogLevels(t *testing.T) {
+	var buf bytes.Buffer
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(jsonEncoderConfig()), zapcore.AddSync(&buf), coreLogLevel)
+	old := defaultLogger
+	defaultLogger = zap.New(core).Sugar()
+	defer func() {
+		defaultLogger = old
+		SetLogLevels(zap.InfoLevel, nil)
+	}()
+
+	SetLogLevels(zap.InfoLevel, map[string]zapcore.Level{"cluster": zap.DebugLevel, "HTTPServer": zap.ErrorLevel})
+	if coreLogLevel.Level() != zap.DebugLevel {
+		t.Errorf("core log level should be debug, got %s", coreLogLevel.Level())
+	}
+
+	Debugf("global debug")
+	Module("cluster").Debugf("cluster debug")
+	Module("HTTPServer").Warnf("httpserver warn")
+	Module("HTTPServer").Errorf("httpserver error")
+	Module("pipeline").Debugf("pipeline debug")
+	Module("pipeline").Infof("pipeline info")
+
+	logs := buf.String()
+	for _, msg := range []string{"cluster debug", "httpserver error", "pipeline info"} {
+		if !strings.Contains(logs, msg) {
+			t.Errorf("%q should be logged", msg)
+		}
+	}
+	for _, msg := range []string{"global debug", "httpserver warn", "pipeline debug"} {
+		if strings.Contains(logs, msg) {
+			t.Errorf("%q should not be logged", msg)
+		}
+	}
+
+	ResetModuleLogLevel("cluster")
+	if coreLogLevel.Level() != zap.InfoLevel {
+		t.Errorf("core log level should be info, got %s", coreLogLevel.Level())
+	}
+	if levels := GetModuleLogLevels(); len(levels) != 1 || levels["HTTPServer"] != "error" {
+		t.Errorf("unexpected module log levels: %v", levels)
+	}
+
+	if _, err := ParseLevel("trace"); err == nil {
+		t.Errorf("trace should be invalid")
+	}
+}
+
+func TestRotateFile(t *testing.T) {
+	// the errors of the background jobs are logged.
+	InitNop()
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.log")
+	rf, err := OpenRotateFile(filename, 0o640, RotateOptions{MaxSize: 100, MaxFiles: 2, Compress: true})
+	if err != nil {
+		t.Fatalf("open file failed: %v", err)
+	}
+	defer rf.Close()
+
+	line := []byte(strings.Repeat("a", 59) + "\n")
+	for i := 0; i < 5; i++ {
+		rf.Write(line)
+	}
+
+	// the file is rotated before every write except the first one.
+	data, _ := os.ReadFile(filename)
+	if !bytes.Equal(data, line) {
+		t.Errorf("unexpected content of the log file: %q", data)
+	}
+
+	// wait for the background compression and clean up.
+	var backups []string
+	for i := 0; i < 100; i++ {
+		rf.bgMu.Lock()
+		backups = rf.backups()
+		rf.bgMu.Unlock()
+		if len(backups) == 2 && strings.HasSuffix(backups[0], compressSuffix) && strings.HasSuffix(backups[1], compressSuffix) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %v", backups)
+	}
+	for _, backup := range backups {
+		if !strings.HasSuffix(backup, compressSuffix) {
+			t.Fatalf("backup %s is not compressed", backup)
+		}
+		f, err := os.Open(backup)
+		if err != nil {
+			t.Fatalf("open %s failed: %v", backup, err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("read %s failed: %v", backup, err)
+		}
+		data, _ := io.ReadAll(zr)
+		f.Close()
+		if !bytes.Equal(data, line) {
+			t.Errorf("unexpected content of %s: %q", backup, data)
+		}
+	}
+}
+
+func TestRemoveBackupsByAge(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "test.log")
+	rf := &RotateFile{
+		filename: filename,
+		opts:     RotateOptions{MaxAge: time.Hour},
+	}
+
+	now := time.Now()
+	old := filename + "." + now.Add(-2*time.Hour).Format(backupTimeFormat)
+	recent := filename + "." + now.Format(backupTimeFormat) + compressSuffix
+	other := filename + ".bak"
+	for _, name := range []string{old, recent, other} {
+		os.WriteFile(name, []byte("log"), 0o640)
+	}
+	os.Chtimes(old, now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+
+	rf.removeBackups(rf.backups())
+	if fileExists(old) {
+		t.Errorf("expired backup %s is not removed", old)
+	}
+	if !fileExists(recent) || !fileExists(other) {
+		t.Errorf("unexpected removal of files")
+	}
+}
+
+func TestRecentErrors(t *testing.T) {
+	r := &errorRing{}
+	for i := 0; i < maxRecentErrors+10; i++ {
+		r.add(fmt.Sprint(i))
+	}
+
+	logs := r.list()
+	if len(logs) != maxRecentErrors {
+		t.Fatalf("expected %d logs, got %d", maxRecentErrors, len(logs))
+	}
+	if logs[0] != "10" || logs[maxRecentErrors-1] != fmt.Sprint(maxRecentErrors+9) {
+		t.Errorf("unexpected logs: %s ... %s", logs[0], logs[maxRecentErrors-1])
+	}
+
+	recordError(zapcore.Entry{Level: zapcore.InfoLevel, Message: "info"})
+	recordError(zapcore.Entry{Level: zapcore.ErrorLevel, Message: "error"})
+	logs = RecentErrors()
+	if len(logs) == 0 || !strings.HasSuffix(logs[len(logs)-1], "\terror") {
+		t.Errorf("unexpected recent errors: %v", logs)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
+)
+
+// maxRecentErrors is the max number of the recent error logs to keep.
+const maxRecentErrors = 100
+
+var recentErrors = &errorRing{}
+
+// errorRing keeps the recent error logs of the default logger in memory for
+// troubleshooting.
+type errorRing struct {
+	mu    sync.Mutex
+	logs  [maxRecentErrors]string
+	next  int
+	count int
+}
+
+func (r *errorRing) add(log string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.logs[r.next] = log
+	r.next = (r.next + 1) % maxRecentErrors
+	if r.count < maxRecentErrors {
+		r.count++
+	}
+}
+
+func (r *errorRing) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	logs := make([]string, 0, r.count)
+	start := (r.next - r.count + maxRecentErrors) % maxRecentErrors
+	for i := 0; i < r.count; i++ {
+		logs = append(logs, r.logs[(start+i)%maxRecentErrors])
+	}
+	return logs
+}
+
+// recordError is the hook of the default logger to record the error logs.
+func recordError(entry zapcore.Entry) error {
+	if entry.Level < zapcore.ErrorLevel {
+		return nil
+	}
+	recentErrors.add(fmt.Sprintf("%s\t%s\t%s\t%s",
+		fasttime.Format(entry.Time, fasttime.RFC3339Milli), entry.Level.CapitalString(),
+		entry.Caller.TrimmedPath(), entry.Message))
+	return nil
+}
+
+// RecentErrors returns the recent error logs, the oldest first.
+func RecentErrors() []string {
+	return recentErrors.list()
+}
@@ -0,0 +1,346 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/option"
+)
+
+const (
+	// backupTimeFormat is the time format in the names of the rotated
+	// files, which keeps the files in time order when sorted by name.
+	backupTimeFormat = "20060102-150405.000"
+
+	compressSuffix = ".gz"
+)
+
+type (
+	// RotateOptions are the options to rotate a file, the zero value
+	// disables rotation.
+	RotateOptions struct {
+		// MaxSize is the max size of a file in bytes.
+		MaxSize int64
+		// Interval is the max time a file is written.
+		Interval time.Duration
+		// MaxAge is the max time to keep the rotated files.
+		MaxAge time.Duration
+		// MaxFiles is the max number of the rotated files to keep.
+		MaxFiles int
+		// Compress compresses the rotated files with gzip.
+		Compress bool
+	}
+
+	// RotateFile is a file opened for appending, which is rotated by size
+	// or time. A rotated file is renamed with the time of the rotation in
+	// its name, like access.log.20240102-150405.000, and it is compressed
+	// and cleaned up in background. RotateFile is not safe for concurrent
+	// use.
+	RotateFile struct {
+		filename string
+		perm     os.FileMode
+		opts     RotateOptions
+
+		file     *os.File
+		size     int64
+		rotateAt time.Time
+
+		// bgMu prevents the background jobs of the rotations from
+		// overlapping, the rotations of a file are rare.
+		bgMu sync.Mutex
+	}
+)
+
+func newRotateOptions(opt *option.Options) RotateOptions {
+	ro := RotateOptions{
+		MaxSize:  int64(opt.LogMaxSize) * 1024 * 1024,
+		MaxFiles: opt.LogMaxFiles,
+		Compress: opt.LogCompress,
+	}
+	// the durations are validated by option.
+	if opt.LogRotateInterval != "" {
+		ro.Interval, _ = time.ParseDuration(opt.LogRotateInterval)
+	}
+	if opt.LogMaxAge != "" {
+		ro.MaxAge, _ = time.ParseDuration(opt.LogMaxAge)
+	}
+	return ro
+}
+
+func (ro *RotateOptions) enabled() bool {
+	return ro.MaxSize > 0 || ro.Interval > 0
+}
+
+// OpenRotateFile opens the file for appending, it is created with perm if
+// it does not exist.
+func OpenRotateFile(filename string, perm os.FileMode, opts RotateOptions) (*RotateFile, error) {
+	rf := &RotateFile{filename: filename, perm: perm, opts: opts}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotateFile) open() error {
+	file, err := os.OpenFile(rf.filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, rf.perm)
+	if err != nil {
+		return err
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	rf.file = file
+	rf.size = fi.Size()
+	if rf.opts.Interval > 0 {
+		rf.rotateAt = time.Now().Add(rf.opts.Interval)
+	}
+	return nil
+}
+
+func (rf *RotateFile) close() error {
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
+
+// Name returns the name of the file.
+func (rf *RotateFile) Name() string {
+	return rf.filename
+}
+
+// Write writes p to the file, the file is rotated before writing if
+// necessary.
+func (rf *RotateFile) Write(p []byte) (int, error) {
+	if rf.shouldRotate(len(p)) {
+		rf.rotate()
+	}
+
+	// the file could not be opened after the last rotation.
+	if rf.file == nil {
+		if err := rf.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// RotateIfDue rotates the file if it has been written longer than the
+// rotate interval, it is called periodically for the files which may not
+// be written for a long time.
+func (rf *RotateFile) RotateIfDue() {
+	if rf.shouldRotate(0) {
+		rf.rotate()
+	}
+}
+
+// Reopen closes and opens the file again, like after the file is rotated
+// by an external tool.
+func (rf *RotateFile) Reopen() error {
+	if err := rf.close(); err != nil {
+		stderrLogger.Errorf("close %s failed: %v", rf.filename, err)
+	}
+	return rf.open()
+}
+
+// Sync commits the content of the file to the disk.
+func (rf *RotateFile) Sync() error {
+	if rf.file == nil {
+		return nil
+	}
+	return rf.file.Sync()
+}
+
+// Close closes the file.
+func (rf *RotateFile) Close() error {
+	return rf.close()
+}
+
+// shouldRotate reports whether the file should be rotated before writing n
+// bytes to it.
+func (rf *RotateFile) shouldRotate(n int) bool {
+	ro := &rf.opts
+	if !ro.enabled() || rf.file == nil {
+		return false
+	}
+	if ro.MaxSize > 0 && rf.size > 0 && rf.size+int64(n) > ro.MaxSize {
+		return true
+	}
+	return ro.Interval > 0 && !time.Now().Before(rf.rotateAt)
+}
+
+// rotate renames the file to a backup file with the current time in its
+// name, and opens a new file. The backup files are compressed and cleaned
+// up in background.
+func (rf *RotateFile) rotate() {
+	if err := rf.close(); err != nil {
+		stderrLogger.Errorf("close %s failed: %v", rf.filename, err)
+	}
+
+	now := time.Now()
+	backup := rf.filename + "." + now.Format(backupTimeFormat)
+	// the file may be rotated more than once in a millisecond if it is
+	// written heavily.
+	for fileExists(backup) || fileExists(backup+compressSuffix) {
+		now = now.Add(time.Millisecond)
+		backup = rf.filename + "." + now.Format(backupTimeFormat)
+	}
+	if err := os.Rename(rf.filename, backup); err != nil {
+		stderrLogger.Errorf("rename %s to %s failed: %v", rf.filename, backup, err)
+		backup = ""
+	}
+
+	if err := rf.open(); err != nil {
+		stderrLogger.Errorf("open %s failed: %v", rf.filename, err)
+	}
+
+	go func() {
+		rf.bgMu.Lock()
+		defer rf.bgMu.Unlock()
+		rf.cleanBackups()
+	}()
+}
+
+// cleanBackups compresses the rotated files and removes the ones exceeding
+// the limits in a single pass, so a backup is never removed while it is
+// waiting to be compressed by the job of a later rotation.
+func (rf *RotateFile) cleanBackups() {
+	backups := rf.backups()
+	if rf.opts.Compress {
+		for i, backup := range backups {
+			if strings.HasSuffix(backup, compressSuffix) {
+				continue
+			}
+			if err := compressFile(backup, rf.perm); err != nil {
+				stderrLogger.Errorf("compress %s failed: %v", backup, err)
+				continue
+			}
+			backups[i] = backup + compressSuffix
+		}
+	}
+	rf.removeBackups(backups)
+}
+
+// backups returns the rotated files, the oldest first.
+func (rf *RotateFile) backups() []string {
+	dir, base := filepath.Split(rf.filename)
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		stderrLogger.Errorf("read dir %s failed: %v", dir, err)
+		return nil
+	}
+
+	prefix := base + "."
+	var backups []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimPrefix(name, prefix), compressSuffix)
+		if _, err := time.Parse(backupTimeFormat, ts); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, name))
+	}
+	sort.Strings(backups)
+	return backups
+}
+
+// removeBackups removes the rotated files exceeding the max age or the max
+// number of files, the backups are sorted with the oldest first.
+func (rf *RotateFile) removeBackups(backups []string) {
+	ro := &rf.opts
+	if ro.MaxAge <= 0 && ro.MaxFiles <= 0 {
+		return
+	}
+
+	remove := 0
+	if ro.MaxFiles > 0 && len(backups) > ro.MaxFiles {
+		remove = len(backups) - ro.MaxFiles
+	}
+	if ro.MaxAge > 0 {
+		deadline := time.Now().Add(-ro.MaxAge)
+		for remove < len(backups) {
+			fi, err := os.Stat(backups[remove])
+			if err != nil || fi.ModTime().After(deadline) {
+				break
+			}
+			remove++
+		}
+	}
+
+	for _, backup := range backups[:remove] {
+		if err := os.Remove(backup); err != nil {
+			stderrLogger.Errorf("remove %s failed: %v", backup, err)
+		}
+	}
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+// compressFile compresses the file with gzip and removes it.
+func compressFile(filename string, perm os.FileMode) error {
+	src, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(filename+compressSuffix, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename + compressSuffix)
+		return err
+	}
+
+	return os.Remove(filename)
+}
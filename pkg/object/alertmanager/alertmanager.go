@@ -0,0 +1,321 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package alertmanager provides AlertManager to evaluate alerting rules over
+// the statuses of the objects and send notifications.
+package alertmanager
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const (
+	// Category is the category of AlertManager.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of AlertManager.
+	Kind = "AlertManager"
+
+	defaultEvaluationInterval = 15 * time.Second
+)
+
+var aliases = []string{
+	"alertmanagers",
+	"alert",
+	"alerts",
+}
+
+func init() {
+	supervisor.Register(&AlertManager{})
+	api.RegisterObject(&api.APIResource{
+		Category: Category,
+		Kind:     Kind,
+		Name:     strings.ToLower(Kind),
+		Aliases:  aliases,
+	})
+}
+
+type (
+	// AlertManager evaluates the alerting rules periodically on the leader
+	// of the cluster, and sends notifications to the sinks when the alerts
+	// fire or resolve.
+	AlertManager struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		mutex sync.Mutex
+		rules []*rule
+		sinks map[string]sink
+
+		done chan struct{}
+	}
+
+	// Spec describes AlertManager.
+	Spec struct {
+		// EvaluationInterval is the interval to evaluate the rules,
+		// default is 15s.
+		EvaluationInterval string      `json:"evaluationInterval,omitempty" jsonschema:"format=duration"`
+		Rules              []*RuleSpec `json:"rules" jsonschema:"required"`
+		Sinks              []*SinkSpec `json:"sinks" jsonschema:"required"`
+	}
+
+	// Status is the status of AlertManager.
+	Status struct {
+		// Leader is true if the member evaluates the rules, the alerts of
+		// other members are always inactive.
+		Leader bool           `json:"leader"`
+		Alerts []*AlertStatus `json:"alerts"`
+	}
+)
+
+// Validate validates the spec of AlertManager.
+func (spec *Spec) Validate() error {
+	if spec.EvaluationInterval != "" {
+		if d, err := time.ParseDuration(spec.EvaluationInterval); err != nil || d <= 0 {
+			return fmt.Errorf("invalid evaluationInterval %s", spec.EvaluationInterval)
+		}
+	}
+
+	sinks := map[string]bool{}
+	for _, s := range spec.Sinks {
+		if sinks[s.Name] {
+			return fmt.Errorf("duplicated sink %s", s.Name)
+		}
+		sinks[s.Name] = true
+		if err := s.Validate(); err != nil {
+			return fmt.Errorf("sink %s: %v", s.Name, err)
+		}
+	}
+
+	rules := map[string]bool{}
+	for _, r := range spec.Rules {
+		if rules[r.Name] {
+			return fmt.Errorf("duplicated rule %s", r.Name)
+		}
+		rules[r.Name] = true
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("rule %s: %v", r.Name, err)
+		}
+		for _, name := range r.Sinks {
+			if !sinks[name] {
+				return fmt.Errorf("rule %s: sink %s not found", r.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Category returns the category of AlertManager.
+func (am *AlertManager) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of AlertManager.
+func (am *AlertManager) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of AlertManager.
+func (am *AlertManager) DefaultSpec() interface{} {
+	return &Spec{
+		EvaluationInterval: defaultEvaluationInterval.String(),
+	}
+}
+
+// Init initializes AlertManager.
+func (am *AlertManager) Init(superSpec *supervisor.Spec) {
+	am.superSpec = superSpec
+	am.spec = superSpec.ObjectSpec().(*Spec)
+	am.super = superSpec.Super()
+
+	am.reload(nil)
+}
+
+// Inherit inherits previous generation of AlertManager, the states of the
+// rules with the same names are kept, so the firing alerts are not notified
+// again.
+func (am *AlertManager) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	am.superSpec = superSpec
+	am.spec = superSpec.ObjectSpec().(*Spec)
+	am.super = superSpec.Super()
+
+	prev := previousGeneration.(*AlertManager)
+	prev.Close()
+	am.reload(prev)
+}
+
+func (am *AlertManager) reload(prev *AlertManager) {
+	am.sinks = map[string]sink{}
+	for _, spec := range am.spec.Sinks {
+		am.sinks[spec.Name] = newSink(spec)
+	}
+
+	prevRules := map[string]*rule{}
+	if prev != nil {
+		prev.mutex.Lock()
+		for _, r := range prev.rules {
+			prevRules[r.spec.Name] = r
+		}
+		prev.mutex.Unlock()
+	}
+
+	for _, spec := range am.spec.Rules {
+		r := newRule(spec)
+		if p := prevRules[spec.Name]; p != nil {
+			r.inherit(p)
+		}
+		am.rules = append(am.rules, r)
+	}
+
+	am.done = make(chan struct{})
+	go am.run()
+}
+
+func (am *AlertManager) run() {
+	interval := defaultEvaluationInterval
+	if am.spec.EvaluationInterval != "" {
+		interval, _ = time.ParseDuration(am.spec.EvaluationInterval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-am.done:
+			return
+		case <-ticker.C:
+			am.evaluate(time.Now())
+		}
+	}
+}
+
+// evaluate evaluates all rules and sends the notifications. The rules are
+// evaluated on the leader only, which aggregates the statuses of all
+// members, to avoid duplicated notifications.
+func (am *AlertManager) evaluate(now time.Time) {
+	if !am.super.Cluster().IsLeader() {
+		am.mutex.Lock()
+		for _, r := range am.rules {
+			r.reset()
+		}
+		am.mutex.Unlock()
+		return
+	}
+
+	for _, r := range am.rules {
+		value, err := am.indicatorValue(r.spec)
+
+		am.mutex.Lock()
+		alert := r.evaluate(value, err, now)
+		am.mutex.Unlock()
+
+		if alert != nil {
+			alert.ClusterName = am.super.Options().ClusterName
+			am.notify(r.spec, alert)
+		}
+	}
+}
+
+// notify sends the alert to the sinks of the rule asynchronously.
+func (am *AlertManager) notify(spec *RuleSpec, alert *Alert) {
+	names := spec.Sinks
+	if len(names) == 0 {
+		for _, s := range am.spec.Sinks {
+			names = append(names, s.Name)
+		}
+	}
+
+	logger.Infof("alert %s is %s, value: %g", alert.Rule, alert.State, alert.Value)
+	for _, name := range names {
+		s := am.sinks[name]
+		go func(name string) {
+			if err := s.send(alert); err != nil {
+				logger.Errorf("send alert %s to sink %s failed: %v", alert.Rule, name, err)
+			}
+		}(name)
+	}
+}
+
+// statusPrefix returns the prefix of the statuses of the object in the
+// cluster, and whether it is a traffic object. The object is a controller
+// if its namespace is empty and there is a controller with the name,
+// otherwise it is a traffic object.
+func (am *AlertManager) statusPrefix(spec *RuleSpec) (string, bool) {
+	layout := am.super.Cluster().Layout()
+	if spec.Namespace == "" {
+		_, isSystem := am.super.GetSystemController(spec.Object)
+		_, isBusiness := am.super.GetBusinessController(spec.Object)
+		if isSystem || isBusiness {
+			return layout.StatusObjectPrefix(cluster.NamespaceDefault, spec.Object), false
+		}
+		return layout.StatusObjectPrefix(cluster.TrafficNamespace(cluster.NamespaceDefault), spec.Object), true
+	}
+	return layout.StatusObjectPrefix(cluster.TrafficNamespace(spec.Namespace), spec.Object), true
+}
+
+// indicatorValue aggregates the indicator of the rule in the statuses of
+// the object of all members.
+func (am *AlertManager) indicatorValue(spec *RuleSpec) (float64, error) {
+	prefix, isTraffic := am.statusPrefix(spec)
+	kvs, err := am.super.Cluster().GetPrefix(prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	statuses := make([]map[string]interface{}, 0, len(kvs))
+	for k, v := range kvs {
+		m := map[string]interface{}{}
+		if err := codectool.Unmarshal([]byte(v), &m); err != nil {
+			return 0, fmt.Errorf("unmarshal status %s failed: %v", k, err)
+		}
+		// the status of a traffic object is stored with its spec, the
+		// indicators are relative to the status.
+		if isTraffic {
+			m, _ = m["status"].(map[string]interface{})
+		}
+		statuses = append(statuses, m)
+	}
+	return aggregate(spec, statuses)
+}
+
+// Status returns the status of AlertManager.
+func (am *AlertManager) Status() *supervisor.Status {
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	status := &Status{Leader: am.super.Cluster().IsLeader()}
+	for _, r := range am.rules {
+		status.Alerts = append(status.Alerts, r.status())
+	}
+	return &supervisor.Status{ObjectStatus: status}
+}
+
+// Close closes AlertManager.
+func (am *AlertManager) Close() {
+	close(am.done)
+}
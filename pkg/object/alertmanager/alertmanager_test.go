@@ -0,0 +1,187 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package alertmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		Rules: []*RuleSpec{{Name: "r1", Object: "server", Indicator: "m1", Operator: ">", Sinks: []string{"hook"}}},
+		Sinks: []*SinkSpec{{Name: "hook", Kind: SinkWebhook, URL: "http://127.0.0.1/alerts"}},
+	}
+	assert.NoError(spec.Validate())
+
+	spec.Rules[0].Sinks = []string{"slack"}
+	assert.Error(spec.Validate())
+	spec.Rules[0].Sinks = nil
+
+	spec.Rules[0].Operator = "=>"
+	assert.Error(spec.Validate())
+	spec.Rules[0].Operator = ">"
+
+	spec.Rules[0].For = "2x"
+	assert.Error(spec.Validate())
+	spec.Rules[0].For = "2m"
+
+	spec.Sinks = append(spec.Sinks, &SinkSpec{Name: "pd", Kind: SinkPagerDuty})
+	assert.Error(spec.Validate())
+	spec.Sinks[1].RoutingKey = "key"
+	assert.NoError(spec.Validate())
+}
+
+func TestAggregate(t *testing.T) {
+	assert := assert.New(t)
+
+	statuses := []map[string]interface{}{
+		{"m1": 10.0, "m1Err": 1.0, "process": map[string]interface{}{"cpuPercent": 20.0}},
+		{"m1": 30.0, "m1Err": 3.0, "process": map[string]interface{}{"cpuPercent": 60.0}},
+		{"other": "value"},
+	}
+
+	v, err := aggregate(&RuleSpec{Indicator: "process.cpuPercent"}, statuses)
+	assert.NoError(err)
+	assert.Equal(40.0, v)
+
+	v, _ = aggregate(&RuleSpec{Indicator: "process.cpuPercent", Aggregate: "max"}, statuses)
+	assert.Equal(60.0, v)
+	v, _ = aggregate(&RuleSpec{Indicator: "m1", Aggregate: "min"}, statuses)
+	assert.Equal(10.0, v)
+	v, _ = aggregate(&RuleSpec{Indicator: "m1", Aggregate: "sum"}, statuses)
+	assert.Equal(40.0, v)
+
+	v, err = aggregate(&RuleSpec{Indicator: "m1Err", Per: "m1"}, statuses)
+	assert.NoError(err)
+	assert.Equal(10.0, v)
+
+	_, err = aggregate(&RuleSpec{Indicator: "m5"}, statuses)
+	assert.Error(err)
+	_, err = aggregate(&RuleSpec{Indicator: "other"}, statuses)
+	assert.Error(err)
+}
+
+func TestRuleEvaluate(t *testing.T) {
+	assert := assert.New(t)
+
+	r := newRule(&RuleSpec{
+		Name: "error-rate", Object: "server", Indicator: "m1ErrPercent",
+		Operator: ">", Threshold: 5, For: "2m", RepeatInterval: "10m",
+	})
+	now := time.Now()
+
+	assert.Nil(r.evaluate(1, nil, now))
+	assert.Equal(StateInactive, r.state)
+
+	assert.Nil(r.evaluate(6, nil, now.Add(time.Minute)))
+	assert.Equal(StatePending, r.state)
+
+	alert := r.evaluate(7, nil, now.Add(3*time.Minute))
+	assert.NotNil(alert)
+	assert.Equal(StateFiring, alert.State)
+	assert.Equal("warning", alert.Severity)
+	assert.Equal(7.0, alert.Value)
+	assert.Equal(now.Add(time.Minute), alert.ActiveAt)
+
+	assert.Nil(r.evaluate(7, nil, now.Add(5*time.Minute)))
+	assert.NotNil(r.evaluate(7, nil, now.Add(13*time.Minute)))
+
+	// an unavailable value resolves the alert.
+	alert = r.evaluate(0, fmt.Errorf("no value"), now.Add(14*time.Minute))
+	assert.NotNil(alert)
+	assert.Equal(StateResolved, alert.State)
+	assert.NotNil(alert.ResolvedAt)
+	assert.Equal(StateInactive, r.state)
+	assert.Equal("no value", r.status().Error)
+
+	// pending goes back to inactive without notification.
+	assert.Nil(r.evaluate(6, nil, now.Add(15*time.Minute)))
+	assert.Nil(r.evaluate(4, nil, now.Add(16*time.Minute)))
+	assert.Equal(StateInactive, r.state)
+
+	// the alert fires immediately if for is empty.
+	r = newRule(&RuleSpec{Name: "down", Object: "server", Indicator: "m1", Operator: "==", Threshold: 0})
+	alert = r.evaluate(0, nil, now)
+	assert.NotNil(alert)
+	assert.Equal(StateFiring, r.state)
+
+	next := newRule(r.spec)
+	next.inherit(r)
+	assert.Nil(next.evaluate(0, nil, now.Add(time.Minute)))
+	assert.Equal(StateFiring, next.status().State)
+}
+
+func TestSinks(t *testing.T) {
+	assert := assert.New(t)
+
+	var bodies []map[string]interface{}
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		m := map[string]interface{}{}
+		json.Unmarshal(data, &m)
+		bodies = append(bodies, m)
+		headers = append(headers, r.Header)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	alert := &Alert{
+		ClusterName: "eg-cluster",
+		Rule:        "error-rate",
+		State:       StateFiring,
+		Severity:    "critical",
+		Summary:     "error rate is high",
+		FiredAt:     time.Now(),
+	}
+
+	s := newSink(&SinkSpec{Name: "hook", Kind: SinkWebhook, URL: server.URL, Headers: map[string]string{"X-Token": "abc"}})
+	assert.NoError(s.send(alert))
+	assert.Equal("error-rate", bodies[0]["rule"])
+	assert.Equal("abc", headers[0].Get("X-Token"))
+
+	s = newSink(&SinkSpec{Name: "slack", Kind: SinkSlack, URL: server.URL})
+	assert.NoError(s.send(alert))
+	assert.Contains(bodies[1]["text"], "[FIRING] error-rate: error rate is high")
+
+	s = newSink(&SinkSpec{Name: "pd", Kind: SinkPagerDuty, URL: server.URL, RoutingKey: "key"})
+	assert.NoError(s.send(alert))
+	assert.Equal("trigger", bodies[2]["event_action"])
+	assert.Equal("eg-cluster/error-rate", bodies[2]["dedup_key"])
+	assert.Equal("critical", bodies[2]["payload"].(map[string]interface{})["severity"])
+
+	alert.State = StateResolved
+	assert.NoError(s.send(alert))
+	assert.Equal("resolve", bodies[3]["event_action"])
+	assert.Nil(bodies[3]["payload"])
+
+	s = newSink(&SinkSpec{Name: "fail", Kind: SinkWebhook, URL: server.URL + "/fail"})
+	assert.Error(s.send(alert))
+}
@@ -0,0 +1,354 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package alertmanager
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// StateInactive means the condition of the rule is not met.
+	StateInactive = "inactive"
+	// StatePending means the condition of the rule is met, but not for
+	// long enough.
+	StatePending = "pending"
+	// StateFiring means the condition of the rule has been met for long
+	// enough, and the alert is notified.
+	StateFiring = "firing"
+	// StateResolved is the state of the alert notified when a firing
+	// alert goes back to inactive.
+	StateResolved = "resolved"
+)
+
+type (
+	// RuleSpec describes an alerting rule, which compares an indicator in
+	// the statuses of an object, aggregated over all members, with a
+	// threshold.
+	RuleSpec struct {
+		Name string `json:"name" jsonschema:"required"`
+		// Object is the name of the object whose status has the indicator,
+		// Namespace is the namespace of a traffic object.
+		Object    string `json:"object" jsonschema:"required"`
+		Namespace string `json:"namespace,omitempty"`
+		// Indicator is the path of a numeric field in the status of the
+		// object, separated by dots, like m1ErrPercent or process.cpuPercent.
+		Indicator string `json:"indicator" jsonschema:"required"`
+		// Per is the path of another indicator. If it is specified, the
+		// value of the rule is the sum of the indicator divided by the sum
+		// of Per in percent, like the error rate of the cluster by m1Err
+		// and m1, and Aggregate is ignored.
+		Per string `json:"per,omitempty"`
+		// Aggregate is how the indicators of the members are aggregated,
+		// default is avg.
+		Aggregate string  `json:"aggregate,omitempty" jsonschema:"enum=,enum=sum,enum=avg,enum=max,enum=min"`
+		Operator  string  `json:"operator" jsonschema:"required,enum=>,enum=>=,enum=<,enum=<=,enum===,enum=!="`
+		Threshold float64 `json:"threshold"`
+		// For is how long the condition must be met before the alert
+		// fires, the alert fires on the first met evaluation if it is empty.
+		For      string `json:"for,omitempty" jsonschema:"format=duration"`
+		Severity string `json:"severity,omitempty" jsonschema:"enum=,enum=critical,enum=error,enum=warning,enum=info"`
+		Summary  string `json:"summary,omitempty"`
+		// Sinks are the names of the sinks to notify, all sinks are
+		// notified if it is empty.
+		Sinks []string `json:"sinks,omitempty"`
+		// RepeatInterval is the interval to notify a firing alert again,
+		// it is notified only once if it is empty.
+		RepeatInterval string `json:"repeatInterval,omitempty" jsonschema:"format=duration"`
+	}
+
+	// Alert is the notification sent to the sinks.
+	Alert struct {
+		ClusterName string    `json:"clusterName"`
+		Rule        string    `json:"rule"`
+		State       string    `json:"state"`
+		Severity    string    `json:"severity"`
+		Summary     string    `json:"summary"`
+		Object      string    `json:"object"`
+		Indicator   string    `json:"indicator"`
+		Value       float64   `json:"value"`
+		Operator    string    `json:"operator"`
+		Threshold   float64   `json:"threshold"`
+		ActiveAt    time.Time `json:"activeAt"`
+		FiredAt     time.Time `json:"firedAt"`
+		// ResolvedAt is set only if the state is resolved.
+		ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+	}
+
+	// AlertStatus is the status of the alert of a rule.
+	AlertStatus struct {
+		Rule           string     `json:"rule"`
+		State          string     `json:"state"`
+		Value          float64    `json:"value"`
+		ActiveAt       *time.Time `json:"activeAt,omitempty"`
+		FiredAt        *time.Time `json:"firedAt,omitempty"`
+		LastEvaluation *time.Time `json:"lastEvaluation,omitempty"`
+		Error          string     `json:"error,omitempty"`
+	}
+
+	// rule is the runtime of a rule, its state changes from inactive to
+	// pending when the condition is met, and to firing when the condition
+	// has been met for long enough.
+	rule struct {
+		spec           *RuleSpec
+		forDuration    time.Duration
+		repeatInterval time.Duration
+
+		state          string
+		value          float64
+		activeAt       time.Time
+		firedAt        time.Time
+		notifiedAt     time.Time
+		lastEvaluation time.Time
+		err            error
+	}
+)
+
+// Validate validates RuleSpec.
+func (spec *RuleSpec) Validate() error {
+	for _, d := range []string{spec.For, spec.RepeatInterval} {
+		if d == "" {
+			continue
+		}
+		if v, err := time.ParseDuration(d); err != nil || v < 0 {
+			return fmt.Errorf("invalid duration %s", d)
+		}
+	}
+	if _, err := compare(spec.Operator, 0, 0); err != nil {
+		return err
+	}
+	return nil
+}
+
+func newRule(spec *RuleSpec) *rule {
+	r := &rule{spec: spec, state: StateInactive}
+	r.forDuration, _ = time.ParseDuration(spec.For)
+	r.repeatInterval, _ = time.ParseDuration(spec.RepeatInterval)
+	return r
+}
+
+// inherit keeps the state of the rule of the previous generation.
+func (r *rule) inherit(prev *rule) {
+	r.state, r.value = prev.state, prev.value
+	r.activeAt, r.firedAt, r.notifiedAt = prev.activeAt, prev.firedAt, prev.notifiedAt
+	r.lastEvaluation, r.err = prev.lastEvaluation, prev.err
+}
+
+// reset resets the rule to inactive without notification, it is called on
+// the members other than the leader.
+func (r *rule) reset() {
+	r.state, r.value, r.err = StateInactive, 0, nil
+	r.activeAt, r.firedAt, r.notifiedAt, r.lastEvaluation = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+}
+
+// evaluate updates the state of the rule by the value of the indicator, and
+// returns the alert to notify, or nil if there is nothing to notify. The
+// condition is regarded as not met if the value is unavailable.
+func (r *rule) evaluate(value float64, err error, now time.Time) *Alert {
+	r.lastEvaluation, r.value, r.err = now, value, err
+
+	met := false
+	if err == nil {
+		// the operator is validated, so the error is ignored.
+		met, _ = compare(r.spec.Operator, value, r.spec.Threshold)
+	}
+
+	if !met {
+		var alert *Alert
+		if r.state == StateFiring {
+			alert = r.alert(StateResolved)
+			alert.ResolvedAt = &now
+		}
+		r.state, r.activeAt, r.firedAt = StateInactive, time.Time{}, time.Time{}
+		return alert
+	}
+
+	switch r.state {
+	case StateInactive:
+		r.state, r.activeAt = StatePending, now
+		if r.forDuration > 0 {
+			return nil
+		}
+		fallthrough
+	case StatePending:
+		if now.Sub(r.activeAt) < r.forDuration {
+			return nil
+		}
+		r.state, r.firedAt, r.notifiedAt = StateFiring, now, now
+		return r.alert(StateFiring)
+	default: // StateFiring
+		if r.repeatInterval > 0 && now.Sub(r.notifiedAt) >= r.repeatInterval {
+			r.notifiedAt = now
+			return r.alert(StateFiring)
+		}
+		return nil
+	}
+}
+
+func (r *rule) alert(state string) *Alert {
+	severity := r.spec.Severity
+	if severity == "" {
+		severity = "warning"
+	}
+	summary := r.spec.Summary
+	if summary == "" {
+		summary = fmt.Sprintf("%s of %s is %g, %s %g", r.spec.Indicator, r.spec.Object,
+			r.value, r.spec.Operator, r.spec.Threshold)
+	}
+	return &Alert{
+		Rule:      r.spec.Name,
+		State:     state,
+		Severity:  severity,
+		Summary:   summary,
+		Object:    r.spec.Object,
+		Indicator: r.spec.Indicator,
+		Value:     r.value,
+		Operator:  r.spec.Operator,
+		Threshold: r.spec.Threshold,
+		ActiveAt:  r.activeAt,
+		FiredAt:   r.firedAt,
+	}
+}
+
+func (r *rule) status() *AlertStatus {
+	timePtr := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+
+	s := &AlertStatus{
+		Rule:           r.spec.Name,
+		State:          r.state,
+		Value:          r.value,
+		ActiveAt:       timePtr(r.activeAt),
+		FiredAt:        timePtr(r.firedAt),
+		LastEvaluation: timePtr(r.lastEvaluation),
+	}
+	if r.err != nil {
+		s.Error = r.err.Error()
+	}
+	return s
+}
+
+func compare(operator string, value, threshold float64) (bool, error) {
+	switch operator {
+	case ">":
+		return value > threshold, nil
+	case ">=":
+		return value >= threshold, nil
+	case "<":
+		return value < threshold, nil
+	case "<=":
+		return value <= threshold, nil
+	case "==":
+		return value == threshold, nil
+	case "!=":
+		return value != threshold, nil
+	default:
+		return false, fmt.Errorf("invalid operator %s", operator)
+	}
+}
+
+// lookupIndicator returns the numeric value of the indicator in the status.
+func lookupIndicator(status map[string]interface{}, indicator string) (float64, bool) {
+	var v interface{} = status
+	for _, key := range strings.Split(indicator, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return 0, false
+		}
+		if v, ok = m[key]; !ok {
+			return 0, false
+		}
+	}
+
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// aggregate aggregates the indicator of the rule in the statuses of the
+// members.
+func aggregate(spec *RuleSpec, statuses []map[string]interface{}) (float64, error) {
+	var values, pers []float64
+	for _, status := range statuses {
+		v, ok := lookupIndicator(status, spec.Indicator)
+		if !ok {
+			continue
+		}
+		if spec.Per != "" {
+			p, ok := lookupIndicator(status, spec.Per)
+			if !ok {
+				continue
+			}
+			pers = append(pers, p)
+		}
+		values = append(values, v)
+	}
+	if len(values) == 0 {
+		return 0, fmt.Errorf("no value of indicator %s of %s", spec.Indicator, spec.Object)
+	}
+
+	sum := func(values []float64) float64 {
+		total := 0.0
+		for _, v := range values {
+			total += v
+		}
+		return total
+	}
+
+	if spec.Per != "" {
+		per := sum(pers)
+		if per == 0 {
+			return 0, nil
+		}
+		return sum(values) / per * 100, nil
+	}
+
+	switch spec.Aggregate {
+	case "sum":
+		return sum(values), nil
+	case "max", "min":
+		result := values[0]
+		for _, v := range values[1:] {
+			if (spec.Aggregate == "max" && v > result) || (spec.Aggregate == "min" && v < result) {
+				result = v
+			}
+		}
+		return result, nil
+	default:
+		return sum(values) / float64(len(values)), nil
+	}
+}
@@ -0,0 +1,206 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package alertmanager
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const (
+	// SinkWebhook posts the alerts in JSON to a URL.
+	SinkWebhook = "Webhook"
+	// SinkSlack posts the alerts to a Slack incoming webhook.
+	SinkSlack = "Slack"
+	// SinkPagerDuty sends the alerts to PagerDuty by the Events API v2.
+	SinkPagerDuty = "PagerDuty"
+
+	defaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+	defaultSinkTimeout  = 10 * time.Second
+)
+
+type (
+	// SinkSpec describes a target of the notifications.
+	SinkSpec struct {
+		Name string `json:"name" jsonschema:"required"`
+		Kind string `json:"kind" jsonschema:"required,enum=Webhook,enum=Slack,enum=PagerDuty"`
+		// URL is the URL of the webhook, or the Slack incoming webhook. It
+		// is the Events API URL for PagerDuty, which has a default value.
+		URL string `json:"url,omitempty" jsonschema:"format=uri"`
+		// Headers are the extra headers of the webhook requests.
+		Headers map[string]string `json:"headers,omitempty"`
+		// RoutingKey is the integration key of the PagerDuty service.
+		RoutingKey string `json:"routingKey,omitempty"`
+		// Timeout is the timeout of a request, default is 10s.
+		Timeout string `json:"timeout,omitempty" jsonschema:"format=duration"`
+	}
+
+	sink interface {
+		send(alert *Alert) error
+	}
+
+	httpSink struct {
+		spec   *SinkSpec
+		url    string
+		client *http.Client
+		encode func(alert *Alert) interface{}
+	}
+
+	slackMessage struct {
+		Text string `json:"text"`
+	}
+
+	pagerDutyEvent struct {
+		RoutingKey  string            `json:"routing_key"`
+		EventAction string            `json:"event_action"`
+		DedupKey    string            `json:"dedup_key"`
+		Payload     *pagerDutyPayload `json:"payload,omitempty"`
+	}
+
+	pagerDutyPayload struct {
+		Summary       string `json:"summary"`
+		Source        string `json:"source"`
+		Severity      string `json:"severity"`
+		Timestamp     string `json:"timestamp,omitempty"`
+		CustomDetails *Alert `json:"custom_details,omitempty"`
+	}
+)
+
+// Validate validates SinkSpec.
+func (spec *SinkSpec) Validate() error {
+	switch spec.Kind {
+	case SinkWebhook, SinkSlack:
+		if spec.URL == "" {
+			return fmt.Errorf("url is required")
+		}
+	case SinkPagerDuty:
+		if spec.RoutingKey == "" {
+			return fmt.Errorf("routingKey is required")
+		}
+	default:
+		return fmt.Errorf("invalid kind %s", spec.Kind)
+	}
+
+	if spec.URL != "" {
+		if _, err := url.Parse(spec.URL); err != nil {
+			return fmt.Errorf("invalid url %s: %v", spec.URL, err)
+		}
+	}
+	if spec.Timeout != "" {
+		if d, err := time.ParseDuration(spec.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %s", spec.Timeout)
+		}
+	}
+	return nil
+}
+
+func newSink(spec *SinkSpec) sink {
+	timeout := defaultSinkTimeout
+	if spec.Timeout != "" {
+		timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+
+	s := &httpSink{
+		spec:   spec,
+		url:    spec.URL,
+		client: &http.Client{Timeout: timeout},
+	}
+
+	switch spec.Kind {
+	case SinkSlack:
+		s.encode = encodeSlack
+	case SinkPagerDuty:
+		if s.url == "" {
+			s.url = defaultPagerDutyURL
+		}
+		s.encode = func(alert *Alert) interface{} {
+			return encodePagerDuty(spec.RoutingKey, alert)
+		}
+	default:
+		s.encode = func(alert *Alert) interface{} { return alert }
+	}
+	return s
+}
+
+func (s *httpSink) send(alert *Alert) error {
+	body, err := codectool.MarshalJSON(s.encode(alert))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.spec.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func encodeSlack(alert *Alert) interface{} {
+	return &slackMessage{
+		Text: fmt.Sprintf("[%s] %s: %s (cluster: %s, severity: %s)",
+			strings.ToUpper(alert.State), alert.Rule, alert.Summary, alert.ClusterName, alert.Severity),
+	}
+}
+
+func encodePagerDuty(routingKey string, alert *Alert) interface{} {
+	event := &pagerDutyEvent{
+		RoutingKey: routingKey,
+		// the alerts of a rule are grouped into one incident.
+		DedupKey: alert.ClusterName + "/" + alert.Rule,
+	}
+	if alert.State == StateResolved {
+		event.EventAction = "resolve"
+		return event
+	}
+
+	source := alert.ClusterName
+	if source == "" {
+		source = "easegress"
+	}
+	event.EventAction = "trigger"
+	event.Payload = &pagerDutyPayload{
+		Summary:       alert.Summary,
+		Source:        source,
+		Severity:      alert.Severity,
+		Timestamp:     alert.FiredAt.Format(time.RFC3339),
+		CustomDetails: alert,
+	}
+	return event
+}
@@ -0,0 +1,453 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package anomalydetector provides AnomalyDetector to detect the anomalies
+// of the throughput and latency of the pipelines.
+package anomalydetector
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/pipeline"
+	"github.com/megaease/easegress/v2/pkg/object/trafficcontroller"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+const (
+	// Category is the category of AnomalyDetector.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of AnomalyDetector.
+	Kind = "AnomalyDetector"
+
+	// IndicatorThroughput is the number of requests per second.
+	IndicatorThroughput = "throughput"
+	// IndicatorLatency is the mean duration of the requests in
+	// milliseconds.
+	IndicatorLatency = "latency"
+
+	defaultInterval    = time.Minute
+	defaultSensitivity = 3
+	defaultMinChange   = 20
+	defaultAlpha       = 0.1
+	defaultWarmup      = 30
+)
+
+var aliases = []string{
+	"anomalydetectors",
+	"anomaly",
+}
+
+func init() {
+	supervisor.Register(&AnomalyDetector{})
+	api.RegisterObject(&api.APIResource{
+		Category: Category,
+		Kind:     Kind,
+		Name:     strings.ToLower(Kind),
+		Aliases:  aliases,
+	})
+}
+
+type (
+	// AnomalyDetector learns the baselines of the throughput and latency
+	// of the pipelines, and flags the significant deviations as events.
+	AnomalyDetector struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		interval  time.Duration
+		detectors map[string]*pipelineDetector
+		events    *eventHub
+
+		// mutex protects closed and the statuses of the detectors.
+		mutex  sync.Mutex
+		closed bool
+		done   chan struct{}
+	}
+
+	// Spec describes AnomalyDetector.
+	Spec struct {
+		Pipelines []string `json:"pipelines" jsonschema:"required,minItems=1,uniqueItems=true"`
+		// Namespace is the namespace of the pipelines, default is default.
+		Namespace string `json:"namespace,omitempty"`
+		// Interval is the interval of the samples, default is 1m.
+		Interval string `json:"interval,omitempty" jsonschema:"format=duration"`
+		// Indicators are the indicators to detect, default is both
+		// throughput and latency.
+		Indicators []string `json:"indicators,omitempty" jsonschema:"uniqueItems=true"`
+		// Sensitivity is the number of standard deviations from the
+		// baseline to be an anomaly, default is 3.
+		Sensitivity float64 `json:"sensitivity,omitempty" jsonschema:"minimum=0"`
+		// MinChange is the minimal relative change from the baseline in
+		// percent to be an anomaly, default is 20.
+		MinChange float64 `json:"minChange,omitempty" jsonschema:"minimum=0"`
+		// Alpha is the smoothing factor of the moving average, a larger
+		// alpha adapts to changes faster, default is 0.1.
+		Alpha float64 `json:"alpha,omitempty" jsonschema:"minimum=0,maximum=1"`
+		// Season learns a baseline for each hour of the day or the week,
+		// so the daily or weekly patterns are not flagged.
+		Season string `json:"season,omitempty" jsonschema:"enum=,enum=hourOfDay,enum=hourOfWeek"`
+		// Warmup is the number of samples a baseline learns before
+		// detecting, default is 30.
+		Warmup int `json:"warmup,omitempty" jsonschema:"minimum=1"`
+	}
+
+	// Status is the status of AnomalyDetector, the key of Pipelines is the
+	// pipeline name, and the key of its value is the indicator.
+	Status struct {
+		Pipelines map[string]map[string]*IndicatorStatus `json:"pipelines"`
+		// Events is the number of the events ever detected.
+		Events uint64 `json:"events"`
+	}
+
+	// IndicatorStatus is the status of an indicator of a pipeline.
+	IndicatorStatus struct {
+		Value    float64 `json:"value"`
+		Baseline float64 `json:"baseline"`
+		Stddev   float64 `json:"stddev"`
+		// Ready is false if the baseline is warming up.
+		Ready bool `json:"ready"`
+		// Anomalous is true if the last sample is an anomaly.
+		Anomalous bool `json:"anomalous"`
+		// Anomalies is the number of the anomalies ever detected.
+		Anomalies uint64 `json:"anomalies"`
+	}
+
+	pipelineDetector struct {
+		name string
+
+		// count and duration are the number and the total duration in
+		// nanoseconds of the requests in the current interval.
+		count    uint64
+		duration int64
+
+		baselines map[string]*baseline
+		statuses  map[string]*IndicatorStatus
+	}
+)
+
+// Validate validates the spec of AnomalyDetector.
+func (spec *Spec) Validate() error {
+	if spec.Interval != "" {
+		if d, err := time.ParseDuration(spec.Interval); err != nil || d < time.Second {
+			return fmt.Errorf("invalid interval %s, it must be at least 1s", spec.Interval)
+		}
+	}
+	for _, indicator := range spec.Indicators {
+		if indicator != IndicatorThroughput && indicator != IndicatorLatency {
+			return fmt.Errorf("invalid indicator %s", indicator)
+		}
+	}
+	return nil
+}
+
+func (spec *Spec) namespace() string {
+	if spec.Namespace == "" {
+		return cluster.NamespaceDefault
+	}
+	return spec.Namespace
+}
+
+func (spec *Spec) indicators() []string {
+	if len(spec.Indicators) == 0 {
+		return []string{IndicatorThroughput, IndicatorLatency}
+	}
+	return spec.Indicators
+}
+
+func (spec *Spec) alpha() float64 {
+	if spec.Alpha == 0 {
+		return defaultAlpha
+	}
+	return spec.Alpha
+}
+
+// Category returns the category of AnomalyDetector.
+func (ad *AnomalyDetector) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of AnomalyDetector.
+func (ad *AnomalyDetector) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of AnomalyDetector.
+func (ad *AnomalyDetector) DefaultSpec() interface{} {
+	return &Spec{
+		Interval:    defaultInterval.String(),
+		Sensitivity: defaultSensitivity,
+		MinChange:   defaultMinChange,
+		Alpha:       defaultAlpha,
+		Warmup:      defaultWarmup,
+	}
+}
+
+// Init initializes AnomalyDetector.
+func (ad *AnomalyDetector) Init(superSpec *supervisor.Spec) {
+	ad.superSpec = superSpec
+	ad.spec = superSpec.ObjectSpec().(*Spec)
+	ad.super = superSpec.Super()
+
+	ad.reload(nil)
+}
+
+// Inherit inherits previous generation of AnomalyDetector, the learned
+// baselines are kept if the interval, alpha and season are not changed.
+func (ad *AnomalyDetector) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	ad.superSpec = superSpec
+	ad.spec = superSpec.ObjectSpec().(*Spec)
+	ad.super = superSpec.Super()
+
+	prev := previousGeneration.(*AnomalyDetector)
+	prev.Close()
+	ad.reload(prev)
+}
+
+func (ad *AnomalyDetector) reload(prev *AnomalyDetector) {
+	ad.interval = defaultInterval
+	if ad.spec.Interval != "" {
+		ad.interval, _ = time.ParseDuration(ad.spec.Interval)
+	}
+
+	keepBaselines := prev != nil && prev.interval == ad.interval &&
+		prev.spec.alpha() == ad.spec.alpha() && prev.spec.Season == ad.spec.Season &&
+		prev.spec.namespace() == ad.spec.namespace()
+
+	if prev != nil {
+		ad.events = prev.events
+	} else {
+		ad.events = newEventHub()
+	}
+
+	ad.detectors = map[string]*pipelineDetector{}
+	for _, name := range ad.spec.Pipelines {
+		d := &pipelineDetector{
+			name:      name,
+			baselines: map[string]*baseline{},
+			statuses:  map[string]*IndicatorStatus{},
+		}
+		for _, indicator := range ad.spec.indicators() {
+			d.baselines[indicator] = newBaseline(ad.spec.alpha(), ad.spec.Season)
+			d.statuses[indicator] = &IndicatorStatus{}
+		}
+
+		if keepBaselines && prev.detectors[name] != nil {
+			pd := prev.detectors[name]
+			for indicator := range d.baselines {
+				if b := pd.baselines[indicator]; b != nil {
+					d.baselines[indicator] = b
+					d.statuses[indicator] = pd.statuses[indicator]
+				}
+			}
+		}
+		ad.detectors[name] = d
+	}
+
+	ad.done = make(chan struct{})
+	go ad.run()
+}
+
+func (ad *AnomalyDetector) run() {
+	ad.attach()
+
+	ticker := time.NewTicker(ad.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ad.done:
+			return
+		case now := <-ticker.C:
+			ad.detect(now)
+			// attach again in case the pipelines are recreated.
+			ad.attach()
+		}
+	}
+}
+
+func (ad *AnomalyDetector) getPipeline(name string) *pipeline.Pipeline {
+	entity, exists := ad.super.GetSystemController(trafficcontroller.Kind)
+	if !exists {
+		return nil
+	}
+	tc, ok := entity.Instance().(*trafficcontroller.TrafficController)
+	if !ok {
+		return nil
+	}
+
+	entity, exists = tc.GetPipeline(ad.spec.namespace(), name)
+	if !exists {
+		return nil
+	}
+	p, _ := entity.Instance().(*pipeline.Pipeline)
+	return p
+}
+
+func (ad *AnomalyDetector) observerKey() string {
+	return Kind + "/" + ad.superSpec.Name()
+}
+
+func (ad *AnomalyDetector) attach() {
+	ad.mutex.Lock()
+	defer ad.mutex.Unlock()
+
+	if ad.closed {
+		return
+	}
+	for name, d := range ad.detectors {
+		if p := ad.getPipeline(name); p != nil {
+			p.AddTaskObserver(ad.observerKey(), d.observe)
+		}
+	}
+}
+
+func (d *pipelineDetector) observe(ctx *context.Context, result string, duration time.Duration) {
+	atomic.AddUint64(&d.count, 1)
+	atomic.AddInt64(&d.duration, int64(duration))
+}
+
+// detect samples the indicators of the pipelines in the last interval, and
+// compares them with the baselines.
+func (ad *AnomalyDetector) detect(now time.Time) {
+	ad.mutex.Lock()
+	defer ad.mutex.Unlock()
+
+	for _, d := range ad.detectors {
+		count := atomic.SwapUint64(&d.count, 0)
+		duration := atomic.SwapInt64(&d.duration, 0)
+
+		values := map[string]float64{
+			IndicatorThroughput: float64(count) / ad.interval.Seconds(),
+		}
+		// the latency is unknown if there is no request.
+		if count > 0 {
+			values[IndicatorLatency] = float64(duration) / float64(count) / float64(time.Millisecond)
+		}
+
+		for indicator, b := range d.baselines {
+			value, ok := values[indicator]
+			if !ok {
+				continue
+			}
+			if e := ad.check(d, indicator, b, value, now); e != nil {
+				logger.Warnf("anomaly detector %s: %s", ad.superSpec.Name(), e.Message)
+				ad.events.publish(e)
+			}
+		}
+	}
+}
+
+// check compares the value with the baseline, updates the status of the
+// indicator, and returns the event if the value is an anomaly.
+func (ad *AnomalyDetector) check(d *pipelineDetector, indicator string, b *baseline, value float64, now time.Time) *Event {
+	sensitivity := ad.spec.Sensitivity
+	if sensitivity == 0 {
+		sensitivity = defaultSensitivity
+	}
+	minChange := ad.spec.MinChange
+	if minChange == 0 {
+		minChange = defaultMinChange
+	}
+	warmup := ad.spec.Warmup
+	if warmup == 0 {
+		warmup = defaultWarmup
+	}
+
+	dev := b.observe(now, value, warmup)
+	anomalous := dev.isAnomaly(sensitivity, minChange)
+
+	status := d.statuses[indicator]
+	status.Value, status.Baseline, status.Stddev = value, dev.mean, dev.stddev
+	status.Ready, status.Anomalous = dev.ready, anomalous
+	if !anomalous {
+		return nil
+	}
+	status.Anomalies++
+
+	typ := "spike"
+	if dev.score < 0 {
+		typ = "drop"
+	}
+	return &Event{
+		Time:      now,
+		Pipeline:  d.name,
+		Indicator: indicator,
+		Type:      typ,
+		Value:     value,
+		Baseline:  dev.mean,
+		Score:     dev.score,
+		Change:    dev.change,
+		Message: fmt.Sprintf("%s %s of pipeline %s: %.2f, baseline %.2f, change %.1f%%",
+			indicator, typ, d.name, value, dev.mean, dev.change),
+	}
+}
+
+// Events returns the recent events, the oldest first.
+func (ad *AnomalyDetector) Events() interface{} {
+	return ad.events.list()
+}
+
+// SubscribeEvents returns a channel of the new events, and a function to
+// cancel the subscription.
+func (ad *AnomalyDetector) SubscribeEvents() (<-chan interface{}, func()) {
+	return ad.events.subscribe()
+}
+
+// Status returns the status of AnomalyDetector.
+func (ad *AnomalyDetector) Status() *supervisor.Status {
+	ad.mutex.Lock()
+	defer ad.mutex.Unlock()
+
+	status := &Status{
+		Pipelines: map[string]map[string]*IndicatorStatus{},
+		Events:    ad.events.totalEvents(),
+	}
+	for name, d := range ad.detectors {
+		indicators := map[string]*IndicatorStatus{}
+		for indicator, s := range d.statuses {
+			copied := *s
+			indicators[indicator] = &copied
+		}
+		status.Pipelines[name] = indicators
+	}
+	return &supervisor.Status{ObjectStatus: status}
+}
+
+// Close closes AnomalyDetector, the observers are removed from the
+// pipelines before it returns.
+func (ad *AnomalyDetector) Close() {
+	ad.mutex.Lock()
+	ad.closed = true
+	for name := range ad.detectors {
+		if p := ad.getPipeline(name); p != nil {
+			p.RemoveTaskObserver(ad.observerKey())
+		}
+	}
+	ad.mutex.Unlock()
+
+	close(ad.done)
+}
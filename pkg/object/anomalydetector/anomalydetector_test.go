@@ -0,0 +1,147 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anomalydetector
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{Pipelines: []string{"p"}}).Validate())
+	assert.NoError((&Spec{Pipelines: []string{"p"}, Interval: "10s", Indicators: []string{"latency"}}).Validate())
+
+	assert.Error((&Spec{Pipelines: []string{"p"}, Interval: "10ms"}).Validate())
+	assert.Error((&Spec{Pipelines: []string{"p"}, Interval: "soon"}).Validate())
+	assert.Error((&Spec{Pipelines: []string{"p"}, Indicators: []string{"errors"}}).Validate())
+}
+
+func TestBaseline(t *testing.T) {
+	assert := assert.New(t)
+
+	b := newBaseline(0.1, SeasonNone)
+	now := time.Unix(1700000000, 0)
+
+	for i := 0; i < 20; i++ {
+		value := 100.0
+		if i%2 == 0 {
+			value = 110
+		}
+		d := b.observe(now, value, 10)
+		assert.Equal(i >= 10, d.ready)
+		assert.False(d.isAnomaly(3, 20))
+	}
+
+	d := b.observe(now, 300, 10)
+	assert.True(d.ready)
+	assert.True(d.score > 3)
+	assert.True(d.change > 100)
+	assert.True(d.isAnomaly(3, 20))
+
+	// a small change is not an anomaly even if it is many deviations away.
+	assert.False(d.isAnomaly(3, 500))
+
+	// a constant baseline flags any significant change.
+	b = newBaseline(0.1, SeasonNone)
+	for i := 0; i < 5; i++ {
+		b.observe(now, 50, 5)
+	}
+	d = b.observe(now, 10, 5)
+	assert.True(d.isAnomaly(3, 20))
+	assert.True(d.score < 0)
+	assert.InDelta(-80.0, d.change, 1e-9)
+}
+
+func TestBaselineSeason(t *testing.T) {
+	assert := assert.New(t)
+
+	b := newBaseline(0.5, SeasonHourOfDay)
+	day := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	// the traffic is high at noon and low at midnight.
+	for i := 0; i < 10; i++ {
+		t := day.AddDate(0, 0, i)
+		b.observe(t, 10, 5)
+		b.observe(t.Add(12*time.Hour), 1000, 5)
+	}
+
+	t12 := day.AddDate(0, 0, 10).Add(12 * time.Hour)
+	assert.False(b.observe(t12, 1000, 5).isAnomaly(3, 20))
+	assert.True(b.observe(day.AddDate(0, 0, 10), 1000, 5).isAnomaly(3, 20))
+
+	assert.Len(newBaseline(0.1, SeasonHourOfWeek).slots, 24*7)
+}
+
+func TestCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	ad := &AnomalyDetector{spec: &Spec{Warmup: 3}}
+	d := &pipelineDetector{
+		name:     "p",
+		statuses: map[string]*IndicatorStatus{IndicatorThroughput: {}},
+	}
+	b := newBaseline(0.1, SeasonNone)
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(ad.check(d, IndicatorThroughput, b, 100, now))
+	}
+	assert.False(d.statuses[IndicatorThroughput].Ready)
+
+	e := ad.check(d, IndicatorThroughput, b, 10, now)
+	assert.NotNil(e)
+	assert.Equal("drop", e.Type)
+	assert.Equal("p", e.Pipeline)
+	assert.Equal(100.0, e.Baseline)
+
+	status := d.statuses[IndicatorThroughput]
+	assert.True(status.Ready)
+	assert.True(status.Anomalous)
+	assert.Equal(uint64(1), status.Anomalies)
+	assert.Equal(10.0, status.Value)
+}
+
+func TestEventHub(t *testing.T) {
+	assert := assert.New(t)
+
+	h := newEventHub()
+	ch, cancel := h.subscribe()
+
+	for i := 0; i < maxEvents+10; i++ {
+		h.publish(&Event{Pipeline: fmt.Sprintf("p%d", i)})
+	}
+
+	events := h.list()
+	assert.Len(events, maxEvents)
+	assert.Equal("p10", events[0].Pipeline)
+	assert.Equal(fmt.Sprintf("p%d", maxEvents+9), events[maxEvents-1].Pipeline)
+	assert.Equal(uint64(maxEvents+10), h.totalEvents())
+
+	// the slow subscriber receives the events fit in its buffer only.
+	assert.Len(ch, subscriberBufferSize)
+	assert.Equal("p0", (<-ch).(*Event).Pipeline)
+
+	cancel()
+	h.publish(&Event{})
+	assert.Len(ch, subscriberBufferSize-1)
+}
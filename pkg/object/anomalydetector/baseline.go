@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anomalydetector
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// SeasonNone learns one baseline for all time.
+	SeasonNone = ""
+	// SeasonHourOfDay learns a baseline for each hour of the day.
+	SeasonHourOfDay = "hourOfDay"
+	// SeasonHourOfWeek learns a baseline for each hour of the week.
+	SeasonHourOfWeek = "hourOfWeek"
+)
+
+type (
+	// baseline learns the expected value of an indicator by the
+	// exponentially weighted moving average and variance, for each slot of
+	// the season.
+	baseline struct {
+		alpha  float64
+		season string
+		slots  []ewma
+	}
+
+	ewma struct {
+		samples  int
+		mean     float64
+		variance float64
+	}
+
+	// deviation is the result of comparing a sample with the baseline.
+	deviation struct {
+		// ready is false if the baseline has not learned enough samples.
+		ready  bool
+		mean   float64
+		stddev float64
+		// score is the number of standard deviations between the sample
+		// and the mean.
+		score float64
+		// change is the relative change of the sample to the mean in
+		// percent.
+		change float64
+	}
+)
+
+func newBaseline(alpha float64, season string) *baseline {
+	n := 1
+	switch season {
+	case SeasonHourOfDay:
+		n = 24
+	case SeasonHourOfWeek:
+		n = 24 * 7
+	}
+	return &baseline{alpha: alpha, season: season, slots: make([]ewma, n)}
+}
+
+func (b *baseline) slot(t time.Time) *ewma {
+	switch b.season {
+	case SeasonHourOfDay:
+		return &b.slots[t.Hour()]
+	case SeasonHourOfWeek:
+		return &b.slots[int(t.Weekday())*24+t.Hour()]
+	default:
+		return &b.slots[0]
+	}
+}
+
+// observe compares the sample with the baseline of its slot, then learns
+// the sample. The baseline is ready after it learns warmup samples.
+func (b *baseline) observe(t time.Time, value float64, warmup int) *deviation {
+	e := b.slot(t)
+
+	d := &deviation{
+		ready:  e.samples >= warmup,
+		mean:   e.mean,
+		stddev: math.Sqrt(e.variance),
+	}
+	// a constant baseline has no deviation, so any change is infinitely
+	// significant, and the relative change decides.
+	diff := value - e.mean
+	switch {
+	case d.stddev > 0:
+		d.score = diff / d.stddev
+	case diff != 0:
+		d.score = math.Inf(int(math.Copysign(1, diff)))
+	}
+	if e.mean != 0 {
+		d.change = diff / math.Abs(e.mean) * 100
+	} else if diff != 0 {
+		d.change = math.Inf(int(math.Copysign(1, diff)))
+	}
+
+	if e.samples == 0 {
+		e.mean = value
+	} else {
+		incr := b.alpha * diff
+		e.mean += incr
+		e.variance = (1 - b.alpha) * (e.variance + diff*incr)
+	}
+	e.samples++
+
+	return d
+}
+
+// isAnomaly reports whether the deviation is significant, which is more
+// than sensitivity standard deviations and minChange percent from the
+// mean.
+func (d *deviation) isAnomaly(sensitivity, minChange float64) bool {
+	if !d.ready {
+		return false
+	}
+	return math.Abs(d.score) >= sensitivity && math.Abs(d.change) >= minChange
+}
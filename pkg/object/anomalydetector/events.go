@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package anomalydetector
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// maxEvents is the number of the recent events kept in memory.
+	maxEvents = 100
+	// subscriberBufferSize is the buffer size of the channel of a
+	// subscriber, the events are dropped for a slow subscriber.
+	subscriberBufferSize = 16
+)
+
+type (
+	// Event is an anomaly detected.
+	Event struct {
+		Time      time.Time `json:"time"`
+		Pipeline  string    `json:"pipeline"`
+		Indicator string    `json:"indicator"`
+		// Type is spike or drop.
+		Type     string  `json:"type"`
+		Value    float64 `json:"value"`
+		Baseline float64 `json:"baseline"`
+		// Score is the number of standard deviations between the value and
+		// the baseline, and Change is the relative change in percent.
+		Score   float64 `json:"score"`
+		Change  float64 `json:"change"`
+		Message string  `json:"message"`
+	}
+
+	// eventHub keeps the recent events and publishes the new events to the
+	// subscribers, it is shared by the generations of the detector.
+	eventHub struct {
+		mutex       sync.Mutex
+		events      [maxEvents]*Event
+		next        int
+		count       int
+		total       uint64
+		subscribers map[chan interface{}]struct{}
+	}
+)
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: map[chan interface{}]struct{}{}}
+}
+
+func (h *eventHub) publish(e *Event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.events[h.next] = e
+	h.next = (h.next + 1) % maxEvents
+	if h.count < maxEvents {
+		h.count++
+	}
+	h.total++
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// list returns the recent events, the oldest first.
+func (h *eventHub) list() []*Event {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	events := make([]*Event, 0, h.count)
+	start := (h.next - h.count + maxEvents) % maxEvents
+	for i := 0; i < h.count; i++ {
+		events = append(events, h.events[(start+i)%maxEvents])
+	}
+	return events
+}
+
+func (h *eventHub) totalEvents() uint64 {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.total
+}
+
+// subscribe returns a channel of the new events, and a function to cancel
+// the subscription.
+func (h *eventHub) subscribe() (<-chan interface{}, func()) {
+	ch := make(chan interface{}, subscriberBufferSize)
+
+	h.mutex.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mutex.Unlock()
+
+	return ch, func() {
+		h.mutex.Lock()
+		delete(h.subscribers, ch)
+		h.mutex.Unlock()
+	}
+}
@@ -315,16 +315,35 @@ func (acm *AutoCertManager) renew() bool {
 	return allSucc
 }
 
+// accountKey loads the ACME account key from the cluster, or generates and
+// saves a new one if it does not exist. Reusing the account key avoids
+// registering a new account on every start, which is rate limited by CAs.
+// A key is generated only if it definitely does not exist, failures of
+// reading the cluster or decoding the key are returned to retry later.
+func (acm *AutoCertManager) accountKey() (*ecdsa.PrivateKey, error) {
+	key, err := acm.storage.getAccountKey(acm.spec.DirectoryURL, acm.spec.Email)
+	if err != nil || key != nil {
+		return key, err
+	}
+
+	key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return acm.storage.createAccountKey(acm.spec.DirectoryURL, acm.spec.Email, key)
+}
+
 func (acm *AutoCertManager) createAcmeClient() error {
-	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	key, err := acm.accountKey()
 	if err != nil {
-		logger.Errorf("failed to generate new account: %v", err)
+		logger.Errorf("failed to get account key: %v", err)
 		return err
 	}
 
 	cl := &acme.Client{Key: key, DirectoryURL: acm.spec.DirectoryURL}
 	acct := &acme.Account{Contact: []string{"mailto:" + acm.spec.Email}}
-	if _, err := cl.Register(acm.stopCtx, acct, acme.AcceptTOS); err != nil {
+	_, err = cl.Register(acm.stopCtx, acct, acme.AcceptTOS)
+	if err != nil && err != acme.ErrAccountAlreadyExists {
 		logger.Errorf("failed to register: %v", err)
 		return err
 	}
@@ -560,6 +560,11 @@ directoryURL: ` + url
 	acmWg.Wait()
 	time.Sleep(1 * time.Second)
 
+	savedKey, err := acm.storage.getAccountKey(url, "someone@megaease.com")
+	if err != nil || savedKey == nil {
+		t.Errorf("account key should be saved: %v", err)
+	}
+
 	if _, err := acm.GetCertificate(helloInfo(""), false); err == nil {
 		t.Errorf("GetCertificate should fail")
 	}
@@ -645,8 +650,17 @@ directoryURL: ` + url
 	// Test inherit
 	acm = &AutoCertManager{}
 	acm.Inherit(spec, acm)
+	if key, err := acm.accountKey(); err != nil || !key.Equal(savedKey) {
+		t.Errorf("account key should be reused")
+	}
 	acm.Close()
 
+	// a bad account key is reported instead of being replaced
+	cls.Put(accountKey(url, "someone@megaease.com"), "bad key")
+	if _, err := acm.accountKey(); err == nil {
+		t.Errorf("bad account key should fail")
+	}
+
 	closeWG := &sync.WaitGroup{}
 	closeWG.Add(1)
 	cls.CloseServer(closeWG)
@@ -23,8 +23,10 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
 	"strings"
@@ -33,6 +35,7 @@ import (
 	"github.com/megaease/easegress/v2/pkg/cluster"
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/client/v3/concurrency"
 )
 
 const (
@@ -40,6 +43,7 @@ const (
 	autoCertManagerCert        = "autocert/cert/%s"
 	autoCertManagerHTTPToken   = "autocert/http/%s/%s"
 	autoCertManagerTLSALPNCert = "autocert/tlsalpn/%s"
+	autoCertManagerAccountKey  = "autocert/account/%s"
 )
 
 type storage struct {
@@ -58,6 +62,13 @@ func domainTLSALPNCert(name string) string {
 	return fmt.Sprintf(autoCertManagerTLSALPNCert, name)
 }
 
+// accountKey returns the storage key of the ACME account key, the account
+// is identified by the directory URL and the email.
+func accountKey(directoryURL, email string) string {
+	sum := sha256.Sum256([]byte(directoryURL + "\n" + email))
+	return fmt.Sprintf(autoCertManagerAccountKey, hex.EncodeToString(sum[:16]))
+}
+
 func encodeCertificate(cert *tls.Certificate) ([]byte, error) {
 	// contains PEM-encoded data
 	var buf bytes.Buffer
@@ -289,6 +300,56 @@ func (s *storage) deleteTLSALPNCert(domain string) error {
 	return s.cls.Delete(key)
 }
 
+// getAccountKey returns the account key, it returns nil without an error
+// only if the key does not exist.
+func (s *storage) getAccountKey(directoryURL, email string) (*ecdsa.PrivateKey, error) {
+	key := accountKey(directoryURL, email)
+	kv, err := s.cls.GetRaw(key)
+	if err != nil {
+		return nil, err
+	}
+	if kv == nil {
+		return nil, nil
+	}
+	return decodeAccountKey(kv.Value)
+}
+
+// createAccountKey saves the account key if there is no account key, and
+// returns the saved one, which is the existing key if another member saved
+// it first.
+func (s *storage) createAccountKey(directoryURL, email string, privKey *ecdsa.PrivateKey) (*ecdsa.PrivateKey, error) {
+	b, err := x509.MarshalECPrivateKey(privKey)
+	if err != nil {
+		return nil, err
+	}
+	value := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b})
+
+	key := accountKey(directoryURL, email)
+	var existing string
+	err = s.cls.STM(func(stm concurrency.STM) error {
+		existing = stm.Get(key)
+		if existing == "" {
+			stm.Put(key, string(value))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if existing != "" {
+		return decodeAccountKey([]byte(existing))
+	}
+	return privKey, nil
+}
+
+func decodeAccountKey(value []byte) (*ecdsa.PrivateKey, error) {
+	b, _ := pem.Decode(value)
+	if b == nil || b.Type != "EC PRIVATE KEY" {
+		return nil, fmt.Errorf("bad account key")
+	}
+	return x509.ParseECPrivateKey(b.Bytes)
+}
+
 func (s *storage) watchCertificate(ctx context.Context, onChange func(domain string, cert *tls.Certificate)) {
 	var (
 		syncer cluster.Syncer
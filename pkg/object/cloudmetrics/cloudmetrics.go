@@ -0,0 +1,373 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package cloudmetrics provides the exporters to publish the metrics to the
+// monitoring services of the cloud providers, like AWS CloudWatch and Google
+// Cloud Monitoring (Stackdriver).
+package cloudmetrics
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+const (
+	defaultInterval = time.Minute
+	// minInterval is limited by Google Cloud Monitoring, which rejects
+	// the points written more often than once every 5 seconds.
+	minInterval    = 10 * time.Second
+	defaultTimeout = 10 * time.Second
+)
+
+type (
+	// CommonSpec is the spec shared by the exporters.
+	CommonSpec struct {
+		// Interval is the interval to publish the samples, default is 1m.
+		Interval string `json:"interval,omitempty" jsonschema:"format=duration"`
+		// Timeout is the timeout of a request, default is 10s.
+		Timeout string `json:"timeout,omitempty" jsonschema:"format=duration"`
+		// Include are the regular expressions of the names of the metrics
+		// to publish, all metrics are published if it is empty.
+		Include []string `json:"include,omitempty"`
+		// Dimensions maps the labels of the metrics to the dimensions, only
+		// the mapped labels are published if it is not empty, otherwise all
+		// labels are published with their own names.
+		Dimensions map[string]string `json:"dimensions,omitempty"`
+		// StaticDimensions are added to all samples, but never override the
+		// dimensions mapped from the labels.
+		StaticDimensions map[string]string `json:"staticDimensions,omitempty"`
+	}
+
+	// Status is the status of the exporters.
+	Status struct {
+		Publishes uint64 `json:"publishes"`
+		Failures  uint64 `json:"failures"`
+		// Samples is the number of the samples of the last publish.
+		Samples     int       `json:"samples"`
+		LastError   string    `json:"lastError,omitempty"`
+		LastPublish time.Time `json:"lastPublish,omitempty"`
+	}
+
+	dimension struct {
+		name  string
+		value string
+	}
+
+	sample struct {
+		name       string
+		dimensions []dimension
+		value      float64
+	}
+
+	// publisher publishes the samples to a monitoring service.
+	publisher interface {
+		// publish publishes a batch of samples.
+		publish(samples []*sample, now time.Time) error
+		// target returns the description of the service for logging.
+		target() string
+	}
+
+	// limits are the limits of a monitoring service.
+	limits struct {
+		// maxBatch is the max number of the samples in a request.
+		maxBatch int
+		// maxDimensions is the max number of the dimensions of a sample,
+		// the extra dimensions are dropped.
+		maxDimensions int
+	}
+
+	// exporter gathers the metrics and publishes them periodically.
+	exporter struct {
+		name      string
+		spec      *CommonSpec
+		limits    limits
+		gatherer  prometheus.Gatherer
+		include   []*regexp.Regexp
+		publisher publisher
+
+		mutex  sync.Mutex
+		status *Status
+
+		done chan struct{}
+	}
+)
+
+func (spec *CommonSpec) validate(maxDimensions int) error {
+	if spec.Interval != "" {
+		d, err := time.ParseDuration(spec.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid interval %s: %v", spec.Interval, err)
+		}
+		if d < minInterval {
+			return fmt.Errorf("interval must not be less than %v", minInterval)
+		}
+	}
+
+	if spec.Timeout != "" {
+		d, err := time.ParseDuration(spec.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %s", spec.Timeout)
+		}
+	}
+
+	for _, s := range spec.Include {
+		if _, err := regexp.Compile(s); err != nil {
+			return fmt.Errorf("invalid include %s: %v", s, err)
+		}
+	}
+
+	for label, name := range spec.Dimensions {
+		if name == "" {
+			return fmt.Errorf("empty dimension name for label %s", label)
+		}
+	}
+	if len(spec.StaticDimensions) > maxDimensions {
+		return fmt.Errorf("at most %d static dimensions could be specified", maxDimensions)
+	}
+	for name, value := range spec.StaticDimensions {
+		if name == "" || value == "" {
+			return fmt.Errorf("static dimensions must have non-empty names and values")
+		}
+	}
+	return nil
+}
+
+func (spec *CommonSpec) interval() time.Duration {
+	if spec.Interval == "" {
+		return defaultInterval
+	}
+	d, _ := time.ParseDuration(spec.Interval)
+	return d
+}
+
+func (spec *CommonSpec) timeout() time.Duration {
+	if spec.Timeout == "" {
+		return defaultTimeout
+	}
+	d, _ := time.ParseDuration(spec.Timeout)
+	return d
+}
+
+func (spec *CommonSpec) httpClient() *http.Client {
+	return &http.Client{Timeout: spec.timeout()}
+}
+
+// collect converts the metric families to the samples. The counters,
+// gauges and untyped metrics are converted to a sample each, and the
+// summaries and histograms are converted to the samples of their sums and
+// counts. The values of the samples with the same name and dimensions after
+// the mapping are summed up.
+func collect(mfs []*dto.MetricFamily, spec *CommonSpec, include []*regexp.Regexp, maxDimensions int) []*sample {
+	var samples []*sample
+	index := map[string]int{}
+
+	add := func(name string, labels []*dto.LabelPair, value float64) {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return
+		}
+
+		s := &sample{name: name, value: value}
+		seen := map[string]bool{}
+		for _, l := range labels {
+			dn := l.GetName()
+			if len(spec.Dimensions) > 0 {
+				mapped, ok := spec.Dimensions[dn]
+				if !ok {
+					continue
+				}
+				dn = mapped
+			}
+			if l.GetValue() == "" || seen[dn] {
+				continue
+			}
+			seen[dn] = true
+			s.dimensions = append(s.dimensions, dimension{name: dn, value: l.GetValue()})
+		}
+		for dn, value := range spec.StaticDimensions {
+			if !seen[dn] {
+				s.dimensions = append(s.dimensions, dimension{name: dn, value: value})
+			}
+		}
+
+		sort.Slice(s.dimensions, func(i, j int) bool {
+			return s.dimensions[i].name < s.dimensions[j].name
+		})
+		if len(s.dimensions) > maxDimensions {
+			s.dimensions = s.dimensions[:maxDimensions]
+		}
+
+		key := s.key()
+		if i, ok := index[key]; ok {
+			samples[i].value += s.value
+			return
+		}
+		index[key] = len(samples)
+		samples = append(samples, s)
+	}
+
+	for _, mf := range mfs {
+		name := mf.GetName()
+		if !included(name, include) {
+			continue
+		}
+
+		for _, m := range mf.Metric {
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.Label, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m.Label, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m.Label, m.GetUntyped().GetValue())
+			case dto.MetricType_SUMMARY:
+				add(name+"_sum", m.Label, m.GetSummary().GetSampleSum())
+				add(name+"_count", m.Label, float64(m.GetSummary().GetSampleCount()))
+			case dto.MetricType_HISTOGRAM:
+				add(name+"_sum", m.Label, m.GetHistogram().GetSampleSum())
+				add(name+"_count", m.Label, float64(m.GetHistogram().GetSampleCount()))
+			}
+		}
+	}
+
+	return samples
+}
+
+func included(name string, include []*regexp.Regexp) bool {
+	if len(include) == 0 {
+		return true
+	}
+	for _, re := range include {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *sample) key() string {
+	var sb strings.Builder
+	sb.WriteString(s.name)
+	for _, d := range s.dimensions {
+		sb.WriteByte(0)
+		sb.WriteString(d.name)
+		sb.WriteByte(0)
+		sb.WriteString(d.value)
+	}
+	return sb.String()
+}
+
+func newExporter(name string, spec *CommonSpec, limits limits, gatherer prometheus.Gatherer, p publisher) *exporter {
+	e := &exporter{
+		name:      name,
+		spec:      spec,
+		limits:    limits,
+		gatherer:  gatherer,
+		publisher: p,
+		status:    &Status{},
+	}
+	for _, s := range spec.Include {
+		e.include = append(e.include, regexp.MustCompile(s))
+	}
+	return e
+}
+
+// inherit keeps the counters of the status of the previous exporter.
+func (e *exporter) inherit(prev *exporter) {
+	prev.mutex.Lock()
+	*e.status = *prev.status
+	prev.mutex.Unlock()
+}
+
+func (e *exporter) start() {
+	e.done = make(chan struct{})
+	go e.run()
+}
+
+func (e *exporter) run() {
+	ticker := time.NewTicker(e.spec.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case now := <-ticker.C:
+			e.publish(now)
+		}
+	}
+}
+
+// publish gathers the metrics and publishes them in batches.
+func (e *exporter) publish(now time.Time) {
+	n, err := e.doPublish(now)
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.status.Samples = n
+	e.status.LastPublish = now
+	if err != nil {
+		logger.Errorf("%s: publish metrics to %s failed: %v", e.name, e.publisher.target(), err)
+		e.status.Failures++
+		e.status.LastError = err.Error()
+		return
+	}
+	e.status.Publishes++
+	e.status.LastError = ""
+}
+
+func (e *exporter) doPublish(now time.Time) (int, error) {
+	mfs, err := e.gatherer.Gather()
+	if err != nil && len(mfs) == 0 {
+		return 0, fmt.Errorf("gather metrics failed: %v", err)
+	}
+
+	samples := collect(mfs, e.spec, e.include, e.limits.maxDimensions)
+	for start := 0; start < len(samples); start += e.limits.maxBatch {
+		end := start + e.limits.maxBatch
+		if end > len(samples) {
+			end = len(samples)
+		}
+		if err := e.publisher.publish(samples[start:end], now); err != nil {
+			return start, err
+		}
+	}
+	return len(samples), nil
+}
+
+func (e *exporter) getStatus() *Status {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	s := *e.status
+	return &s
+}
+
+func (e *exporter) stop() {
+	close(e.done)
+}
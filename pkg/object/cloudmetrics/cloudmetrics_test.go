@@ -0,0 +1,258 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cloudmetrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+func newRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+	}, []string{"pipeline", "code"})
+	counter.WithLabelValues("demo", "200").Add(3)
+	counter.WithLabelValues("demo", "500").Add(1)
+
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "inflight"})
+	gauge.Set(2)
+
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "duration_seconds",
+		Buckets: []float64{0.1, 1},
+	}, []string{"pipeline"})
+	histogram.WithLabelValues("demo").Observe(0.5)
+
+	registry.MustRegister(counter, gauge, histogram)
+	return registry
+}
+
+func findSample(samples []*sample, name string, dimensions ...string) *sample {
+	for _, s := range samples {
+		if s.name != name || len(s.dimensions)*2 != len(dimensions) {
+			continue
+		}
+		match := true
+		for i, d := range s.dimensions {
+			if d.name != dimensions[i*2] || d.value != dimensions[i*2+1] {
+				match = false
+			}
+		}
+		if match {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	cw := &CloudWatchSpec{Region: "us-east-1"}
+	assert.NoError(cw.Validate())
+	cw.Interval = "1s"
+	assert.Error(cw.Validate())
+	cw.Interval = "1m"
+	cw.AccessKeyID = "id"
+	assert.Error(cw.Validate())
+	cw.SecretAccessKey = "secret"
+	assert.NoError(cw.Validate())
+	cw.Namespace = "AWS/EC2"
+	assert.Error(cw.Validate())
+	assert.Error((&CloudWatchSpec{}).Validate())
+
+	sd := &StackdriverSpec{ProjectID: "demo"}
+	assert.NoError(sd.Validate())
+	sd.MetricPrefix = "prometheus.googleapis.com/x"
+	assert.Error(sd.Validate())
+	sd.MetricPrefix = "external.googleapis.com/easegress"
+	assert.NoError(sd.Validate())
+	sd.Include = []string{"("}
+	assert.Error(sd.Validate())
+	sd.Include = nil
+	sd.Resource = &MonitoredResource{}
+	assert.Error(sd.Validate())
+	sd.Resource = nil
+	sd.StaticDimensions = map[string]string{"region": ""}
+	assert.Error(sd.Validate())
+	assert.Error((&StackdriverSpec{}).Validate())
+}
+
+func TestCollect(t *testing.T) {
+	assert := assert.New(t)
+
+	mfs, err := newRegistry().Gather()
+	assert.NoError(err)
+
+	// all labels are kept without the dimension mapping.
+	spec := &CommonSpec{StaticDimensions: map[string]string{"region": "us", "code": "x"}}
+	samples := collect(mfs, spec, nil, 30)
+	assert.Len(samples, 5)
+	assert.Equal(3.0, findSample(samples, "http_requests_total", "code", "200", "pipeline", "demo", "region", "us").value)
+	assert.Equal(2.0, findSample(samples, "inflight", "code", "x", "region", "us").value)
+	assert.Equal(0.5, findSample(samples, "duration_seconds_sum", "code", "x", "pipeline", "demo", "region", "us").value)
+	assert.Equal(1.0, findSample(samples, "duration_seconds_count", "code", "x", "pipeline", "demo", "region", "us").value)
+
+	// only the mapped labels are kept, and the merged samples are summed up.
+	spec = &CommonSpec{Dimensions: map[string]string{"pipeline": "Pipeline"}}
+	include := []*regexp.Regexp{regexp.MustCompile("^http_")}
+	samples = collect(mfs, spec, include, 30)
+	assert.Len(samples, 1)
+	assert.Equal(4.0, findSample(samples, "http_requests_total", "Pipeline", "demo").value)
+
+	// the extra dimensions are dropped.
+	samples = collect(mfs, &CommonSpec{}, include, 1)
+	assert.Len(samples, 2)
+	assert.Equal(1.0, findSample(samples, "http_requests_total", "code", "500").value)
+}
+
+func TestSignV4(t *testing.T) {
+	assert := assert.New(t)
+
+	// the get-vanilla case of the AWS Signature Version 4 test suite.
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	creds := &awsCredentials{
+		accessKeyID:     "AKIDEXAMPLE",
+		secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	assert.NoError(signV4(req, nil, creds, "us-east-1", "service", now))
+
+	assert.Equal("20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal("AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, "+
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestCloudWatch(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests []url.Values
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		values, err := url.ParseQuery(string(body))
+		assert.NoError(err)
+		requests = append(requests, values)
+		if values.Get("Namespace") == "fail" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	spec := &CloudWatchSpec{
+		CommonSpec: CommonSpec{
+			Dimensions: map[string]string{"pipeline": "Pipeline"},
+		},
+		Region:          "us-east-1",
+		Endpoint:        server.URL,
+		AccessKeyID:     "id",
+		SecretAccessKey: "secret",
+	}
+	limits := limits{maxBatch: 2, maxDimensions: 30}
+	e := newExporter("cw", &spec.CommonSpec, limits, newRegistry(), newCloudWatchPublisher(spec))
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	e.publish(now)
+	status := e.getStatus()
+	assert.Equal(uint64(1), status.Publishes)
+	assert.Equal(4, status.Samples)
+	assert.Len(requests, 2)
+	assert.True(strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=id/20240102/us-east-1/monitoring/aws4_request"))
+
+	values := requests[0]
+	assert.Equal("PutMetricData", values.Get("Action"))
+	assert.Equal("Easegress", values.Get("Namespace"))
+	names := map[string]bool{}
+	for _, values := range requests {
+		for i := 1; values.Get(fmt.Sprintf("MetricData.member.%d.MetricName", i)) != ""; i++ {
+			prefix := fmt.Sprintf("MetricData.member.%d.", i)
+			names[values.Get(prefix+"MetricName")] = true
+			assert.Equal("2024-01-02T03:04:05Z", values.Get(prefix+"Timestamp"))
+			if values.Get(prefix+"MetricName") == "http_requests_total" {
+				assert.Equal("Pipeline", values.Get(prefix+"Dimensions.member.1.Name"))
+				assert.Equal("demo", values.Get(prefix+"Dimensions.member.1.Value"))
+				assert.Equal("4", values.Get(prefix+"Value"))
+			}
+		}
+	}
+	assert.Len(names, 4)
+
+	spec.Namespace = "fail"
+	e.publish(now)
+	status = e.getStatus()
+	assert.Equal(uint64(1), status.Failures)
+	assert.Contains(status.LastError, "400")
+}
+
+func TestStackdriver(t *testing.T) {
+	assert := assert.New(t)
+
+	var cr gcmCreateTimeSeriesRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/v3/projects/demo/timeSeries", r.URL.Path)
+		assert.Equal("Bearer token", r.Header.Get("Authorization"))
+		assert.NoError(json.NewDecoder(r.Body).Decode(&cr))
+	}))
+	defer server.Close()
+
+	spec := &StackdriverSpec{
+		CommonSpec: CommonSpec{
+			Include: []string{"^inflight$"},
+		},
+		ProjectID: "demo",
+		Endpoint:  server.URL,
+	}
+	p := newStackdriverPublisher(spec)
+	p.source = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	e := newExporter("sd", &spec.CommonSpec, stackdriverLimits, newRegistry(), p)
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	e.publish(now)
+	assert.Equal(uint64(1), e.getStatus().Publishes)
+
+	assert.Len(cr.TimeSeries, 1)
+	ts := cr.TimeSeries[0]
+	assert.Equal("custom.googleapis.com/easegress/inflight", ts.Metric.Type)
+	assert.Equal("global", ts.Resource.Type)
+	assert.Equal("demo", ts.Resource.Labels["project_id"])
+	assert.Equal("2024-01-02T03:04:05Z", ts.Points[0].Interval.EndTime)
+	assert.Equal(2.0, ts.Points[0].Value.DoubleValue)
+}
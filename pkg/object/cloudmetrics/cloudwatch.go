@@ -0,0 +1,268 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cloudmetrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+const (
+	// CloudWatchCategory is the category of CloudWatchExporter.
+	CloudWatchCategory = supervisor.CategoryBusinessController
+
+	// CloudWatchKind is the kind of CloudWatchExporter.
+	CloudWatchKind = "CloudWatchExporter"
+
+	defaultCloudWatchNamespace = "Easegress"
+)
+
+// cloudWatchLimits are the limits of the PutMetricData API.
+var cloudWatchLimits = limits{
+	maxBatch:      1000,
+	maxDimensions: 30,
+}
+
+var cloudWatchAliases = []string{
+	"cloudwatch",
+}
+
+func init() {
+	supervisor.Register(&CloudWatchExporter{})
+	api.RegisterObject(&api.APIResource{
+		Category: CloudWatchCategory,
+		Kind:     CloudWatchKind,
+		Name:     strings.ToLower(CloudWatchKind),
+		Aliases:  cloudWatchAliases,
+	})
+}
+
+type (
+	// CloudWatchExporter publishes the metrics of the member to AWS
+	// CloudWatch.
+	CloudWatchExporter struct {
+		superSpec *supervisor.Spec
+		spec      *CloudWatchSpec
+		exporter  *exporter
+	}
+
+	// CloudWatchSpec describes CloudWatchExporter.
+	CloudWatchSpec struct {
+		CommonSpec `json:",inline"`
+
+		Region string `json:"region" jsonschema:"required"`
+		// Namespace is the namespace of the metrics, default is Easegress.
+		Namespace string `json:"namespace,omitempty"`
+		// Endpoint overrides the endpoint of CloudWatch, which is
+		// https://monitoring.{region}.amazonaws.com by default.
+		Endpoint string `json:"endpoint,omitempty" jsonschema:"format=uri"`
+
+		// The credentials are read from the environment variables
+		// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+		// if they are not specified.
+		AccessKeyID     string `json:"accessKeyID,omitempty"`
+		SecretAccessKey string `json:"secretAccessKey,omitempty"`
+		SessionToken    string `json:"sessionToken,omitempty"`
+	}
+
+	// cloudWatchPublisher publishes the samples with the PutMetricData API.
+	cloudWatchPublisher struct {
+		spec     *CloudWatchSpec
+		client   *http.Client
+		endpoint string
+	}
+)
+
+// Validate validates the spec of CloudWatchExporter.
+func (spec *CloudWatchSpec) Validate() error {
+	if err := spec.CommonSpec.validate(cloudWatchLimits.maxDimensions); err != nil {
+		return err
+	}
+	if spec.Region == "" {
+		return fmt.Errorf("region is required")
+	}
+	if strings.HasPrefix(spec.Namespace, "AWS/") {
+		return fmt.Errorf("namespace must not start with AWS/")
+	}
+	if (spec.AccessKeyID == "") != (spec.SecretAccessKey == "") {
+		return fmt.Errorf("accessKeyID and secretAccessKey must be specified together")
+	}
+	return nil
+}
+
+func newCloudWatchPublisher(spec *CloudWatchSpec) *cloudWatchPublisher {
+	endpoint := spec.Endpoint
+	if endpoint == "" {
+		endpoint = "https://monitoring." + spec.Region + ".amazonaws.com/"
+	}
+	return &cloudWatchPublisher{
+		spec:     spec,
+		client:   spec.httpClient(),
+		endpoint: endpoint,
+	}
+}
+
+func (p *cloudWatchPublisher) target() string {
+	return p.endpoint
+}
+
+func (p *cloudWatchPublisher) credentials() (*awsCredentials, error) {
+	if p.spec.AccessKeyID != "" {
+		return &awsCredentials{
+			accessKeyID:     p.spec.AccessKeyID,
+			secretAccessKey: p.spec.SecretAccessKey,
+			sessionToken:    p.spec.SessionToken,
+		}, nil
+	}
+
+	creds := &awsCredentials{
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.accessKeyID == "" || creds.secretAccessKey == "" {
+		return nil, fmt.Errorf("no AWS credentials in the spec or the environment variables")
+	}
+	return creds, nil
+}
+
+func (p *cloudWatchPublisher) publish(samples []*sample, now time.Time) error {
+	creds, err := p.credentials()
+	if err != nil {
+		return err
+	}
+
+	namespace := p.spec.Namespace
+	if namespace == "" {
+		namespace = defaultCloudWatchNamespace
+	}
+	timestamp := now.UTC().Format(time.RFC3339)
+
+	var form strings.Builder
+	form.WriteString("Action=PutMetricData&Version=2010-08-01&Namespace=")
+	form.WriteString(queryEscape(namespace))
+	for i, s := range samples {
+		prefix := "&MetricData.member." + strconv.Itoa(i+1) + "."
+		form.WriteString(prefix + "MetricName=" + queryEscape(s.name))
+		form.WriteString(prefix + "Value=" + strconv.FormatFloat(s.value, 'g', -1, 64))
+		form.WriteString(prefix + "Timestamp=" + queryEscape(timestamp))
+		for j, d := range s.dimensions {
+			dp := prefix + "Dimensions.member." + strconv.Itoa(j+1) + "."
+			form.WriteString(dp + "Name=" + queryEscape(d.name))
+			form.WriteString(dp + "Value=" + queryEscape(d.value))
+		}
+	}
+	body := []byte(form.String())
+
+	req, err := http.NewRequest(http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	req.Header.Set("User-Agent", "Easegress")
+	if err = signV4(req, body, creds, p.spec.Region, "monitoring", now); err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, msg)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// queryEscape escapes s as AWS requires, spaces are escaped as %20.
+func queryEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+// Category returns the category of CloudWatchExporter.
+func (cwe *CloudWatchExporter) Category() supervisor.ObjectCategory {
+	return CloudWatchCategory
+}
+
+// Kind returns the kind of CloudWatchExporter.
+func (cwe *CloudWatchExporter) Kind() string {
+	return CloudWatchKind
+}
+
+// DefaultSpec returns the default spec of CloudWatchExporter.
+func (cwe *CloudWatchExporter) DefaultSpec() interface{} {
+	return &CloudWatchSpec{
+		CommonSpec: CommonSpec{
+			Interval: defaultInterval.String(),
+		},
+		Namespace: defaultCloudWatchNamespace,
+	}
+}
+
+// Init initializes CloudWatchExporter.
+func (cwe *CloudWatchExporter) Init(superSpec *supervisor.Spec) {
+	cwe.superSpec = superSpec
+	cwe.spec = superSpec.ObjectSpec().(*CloudWatchSpec)
+	cwe.reload(nil)
+}
+
+// Inherit inherits previous generation of CloudWatchExporter, the counters
+// of the status are kept.
+func (cwe *CloudWatchExporter) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	cwe.superSpec = superSpec
+	cwe.spec = superSpec.ObjectSpec().(*CloudWatchSpec)
+
+	prev := previousGeneration.(*CloudWatchExporter)
+	prev.Close()
+	cwe.reload(prev)
+}
+
+func (cwe *CloudWatchExporter) reload(prev *CloudWatchExporter) {
+	p := newCloudWatchPublisher(cwe.spec)
+	cwe.exporter = newExporter(cwe.superSpec.Name(), &cwe.spec.CommonSpec, cloudWatchLimits, prometheus.DefaultGatherer, p)
+	if prev != nil {
+		cwe.exporter.inherit(prev.exporter)
+	}
+	cwe.exporter.start()
+}
+
+// Status returns the status of CloudWatchExporter.
+func (cwe *CloudWatchExporter) Status() *supervisor.Status {
+	return &supervisor.Status{ObjectStatus: cwe.exporter.getStatus()}
+}
+
+// Close closes CloudWatchExporter.
+func (cwe *CloudWatchExporter) Close() {
+	cwe.exporter.stop()
+}
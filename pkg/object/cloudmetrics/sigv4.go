@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cloudmetrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/util/signer"
+)
+
+// awsCredentials are the credentials to sign the requests to AWS.
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// signV4 signs the request with AWS Signature Version 4, all the headers
+// except the user agent are signed.
+func signV4(req *http.Request, body []byte, creds *awsCredentials, region, service string, now time.Time) error {
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	s := signer.New()
+	s.SetLiteral(signer.AWSLiteral)
+	s.SetCredential(creds.accessKeyID, creds.secretAccessKey)
+	ctx := s.NewSigningContext(now, region, service)
+	return ctx.Sign(req, func() io.Reader { return bytes.NewReader(body) })
+}
@@ -0,0 +1,341 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cloudmetrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+const (
+	// StackdriverCategory is the category of StackdriverExporter.
+	StackdriverCategory = supervisor.CategoryBusinessController
+
+	// StackdriverKind is the kind of StackdriverExporter.
+	StackdriverKind = "StackdriverExporter"
+
+	defaultStackdriverEndpoint = "https://monitoring.googleapis.com"
+	defaultMetricPrefix        = "custom.googleapis.com/easegress"
+	stackdriverScope           = "https://www.googleapis.com/auth/monitoring.write"
+)
+
+// stackdriverLimits are the limits of the timeSeries.create API.
+var stackdriverLimits = limits{
+	maxBatch:      200,
+	maxDimensions: 30,
+}
+
+var stackdriverAliases = []string{
+	"stackdriver",
+	"cloudmonitoring",
+}
+
+func init() {
+	supervisor.Register(&StackdriverExporter{})
+	api.RegisterObject(&api.APIResource{
+		Category: StackdriverCategory,
+		Kind:     StackdriverKind,
+		Name:     strings.ToLower(StackdriverKind),
+		Aliases:  stackdriverAliases,
+	})
+}
+
+type (
+	// StackdriverExporter publishes the metrics of the member to Google
+	// Cloud Monitoring, formerly known as Stackdriver.
+	StackdriverExporter struct {
+		superSpec *supervisor.Spec
+		spec      *StackdriverSpec
+		exporter  *exporter
+	}
+
+	// StackdriverSpec describes StackdriverExporter.
+	StackdriverSpec struct {
+		CommonSpec `json:",inline"`
+
+		ProjectID string `json:"projectID" jsonschema:"required"`
+		// MetricPrefix is the prefix of the metric types, default is
+		// custom.googleapis.com/easegress.
+		MetricPrefix string `json:"metricPrefix,omitempty"`
+		// Resource is the monitored resource of the time series, default
+		// is the global resource of the project.
+		Resource *MonitoredResource `json:"resource,omitempty"`
+		// CredentialsFile is the path of the credentials file, like the
+		// key file of a service account, the application default
+		// credentials are used if it is empty.
+		CredentialsFile string `json:"credentialsFile,omitempty"`
+		// Endpoint overrides the endpoint of Cloud Monitoring.
+		Endpoint string `json:"endpoint,omitempty" jsonschema:"format=uri"`
+	}
+
+	// MonitoredResource is the monitored resource of the time series.
+	MonitoredResource struct {
+		Type   string            `json:"type" jsonschema:"required"`
+		Labels map[string]string `json:"labels,omitempty"`
+	}
+
+	// stackdriverPublisher publishes the samples with the timeSeries.create
+	// API.
+	stackdriverPublisher struct {
+		spec     *StackdriverSpec
+		timeout  time.Duration
+		endpoint string
+		resource *MonitoredResource
+
+		// source is the source of the access tokens, it is created from
+		// the credentials at the first publish if it is nil.
+		source oauth2.TokenSource
+		client *http.Client
+	}
+
+	gcmCreateTimeSeriesRequest struct {
+		TimeSeries []*gcmTimeSeries `json:"timeSeries"`
+	}
+
+	gcmTimeSeries struct {
+		Metric   gcmMetric          `json:"metric"`
+		Resource *MonitoredResource `json:"resource"`
+		Points   []gcmPoint         `json:"points"`
+	}
+
+	gcmMetric struct {
+		Type   string            `json:"type"`
+		Labels map[string]string `json:"labels,omitempty"`
+	}
+
+	gcmPoint struct {
+		Interval gcmInterval `json:"interval"`
+		Value    gcmValue    `json:"value"`
+	}
+
+	gcmInterval struct {
+		EndTime string `json:"endTime"`
+	}
+
+	gcmValue struct {
+		DoubleValue float64 `json:"doubleValue"`
+	}
+)
+
+// Validate validates the spec of StackdriverExporter.
+func (spec *StackdriverSpec) Validate() error {
+	if err := spec.CommonSpec.validate(stackdriverLimits.maxDimensions); err != nil {
+		return err
+	}
+	if spec.ProjectID == "" {
+		return fmt.Errorf("projectID is required")
+	}
+	if spec.MetricPrefix != "" &&
+		!strings.HasPrefix(spec.MetricPrefix, "custom.googleapis.com/") &&
+		!strings.HasPrefix(spec.MetricPrefix, "external.googleapis.com/") {
+		return fmt.Errorf("metricPrefix must start with custom.googleapis.com/ or external.googleapis.com/")
+	}
+	if spec.Resource != nil && spec.Resource.Type == "" {
+		return fmt.Errorf("type of resource is required")
+	}
+	return nil
+}
+
+func newStackdriverPublisher(spec *StackdriverSpec) *stackdriverPublisher {
+	p := &stackdriverPublisher{
+		spec:     spec,
+		timeout:  spec.timeout(),
+		endpoint: strings.TrimSuffix(spec.Endpoint, "/"),
+		resource: spec.Resource,
+	}
+	if p.endpoint == "" {
+		p.endpoint = defaultStackdriverEndpoint
+	}
+	if p.resource == nil {
+		p.resource = &MonitoredResource{
+			Type:   "global",
+			Labels: map[string]string{"project_id": spec.ProjectID},
+		}
+	}
+	return p
+}
+
+func (p *stackdriverPublisher) target() string {
+	return p.endpoint
+}
+
+func (p *stackdriverPublisher) tokenSource() (oauth2.TokenSource, error) {
+	ctx := context.Background()
+	if p.spec.CredentialsFile == "" {
+		return google.DefaultTokenSource(ctx, stackdriverScope)
+	}
+
+	data, err := os.ReadFile(p.spec.CredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read credentials file failed: %v", err)
+	}
+	creds, err := google.CredentialsFromJSON(ctx, data, stackdriverScope)
+	if err != nil {
+		return nil, fmt.Errorf("parse credentials file failed: %v", err)
+	}
+	return creds.TokenSource, nil
+}
+
+func (p *stackdriverPublisher) httpClient() (*http.Client, error) {
+	if p.client != nil {
+		return p.client, nil
+	}
+
+	if p.source == nil {
+		source, err := p.tokenSource()
+		if err != nil {
+			return nil, err
+		}
+		p.source = source
+	}
+	p.client = &http.Client{
+		Transport: &oauth2.Transport{Source: p.source, Base: http.DefaultTransport},
+		Timeout:   p.timeout,
+	}
+	return p.client, nil
+}
+
+func (p *stackdriverPublisher) publish(samples []*sample, now time.Time) error {
+	client, err := p.httpClient()
+	if err != nil {
+		return err
+	}
+
+	prefix := p.spec.MetricPrefix
+	if prefix == "" {
+		prefix = defaultMetricPrefix
+	}
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+	endTime := now.UTC().Format(time.RFC3339Nano)
+
+	cr := &gcmCreateTimeSeriesRequest{}
+	for _, s := range samples {
+		ts := &gcmTimeSeries{
+			Metric:   gcmMetric{Type: prefix + s.name},
+			Resource: p.resource,
+			Points: []gcmPoint{{
+				Interval: gcmInterval{EndTime: endTime},
+				Value:    gcmValue{DoubleValue: s.value},
+			}},
+		}
+		if len(s.dimensions) > 0 {
+			ts.Metric.Labels = make(map[string]string, len(s.dimensions))
+			for _, d := range s.dimensions {
+				ts.Metric.Labels[d.name] = d.value
+			}
+		}
+		cr.TimeSeries = append(cr.TimeSeries, ts)
+	}
+
+	body, err := json.Marshal(cr)
+	if err != nil {
+		return err
+	}
+
+	addr := p.endpoint + "/v3/projects/" + p.spec.ProjectID + "/timeSeries"
+	req, err := http.NewRequest(http.MethodPost, addr, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Easegress")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, msg)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Category returns the category of StackdriverExporter.
+func (sde *StackdriverExporter) Category() supervisor.ObjectCategory {
+	return StackdriverCategory
+}
+
+// Kind returns the kind of StackdriverExporter.
+func (sde *StackdriverExporter) Kind() string {
+	return StackdriverKind
+}
+
+// DefaultSpec returns the default spec of StackdriverExporter.
+func (sde *StackdriverExporter) DefaultSpec() interface{} {
+	return &StackdriverSpec{
+		CommonSpec: CommonSpec{
+			Interval: defaultInterval.String(),
+		},
+		MetricPrefix: defaultMetricPrefix,
+	}
+}
+
+// Init initializes StackdriverExporter.
+func (sde *StackdriverExporter) Init(superSpec *supervisor.Spec) {
+	sde.superSpec = superSpec
+	sde.spec = superSpec.ObjectSpec().(*StackdriverSpec)
+	sde.reload(nil)
+}
+
+// Inherit inherits previous generation of StackdriverExporter, the
+// counters of the status are kept.
+func (sde *StackdriverExporter) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	sde.superSpec = superSpec
+	sde.spec = superSpec.ObjectSpec().(*StackdriverSpec)
+
+	prev := previousGeneration.(*StackdriverExporter)
+	prev.Close()
+	sde.reload(prev)
+}
+
+func (sde *StackdriverExporter) reload(prev *StackdriverExporter) {
+	p := newStackdriverPublisher(sde.spec)
+	sde.exporter = newExporter(sde.superSpec.Name(), &sde.spec.CommonSpec, stackdriverLimits, prometheus.DefaultGatherer, p)
+	if prev != nil {
+		sde.exporter.inherit(prev.exporter)
+	}
+	sde.exporter.start()
+}
+
+// Status returns the status of StackdriverExporter.
+func (sde *StackdriverExporter) Status() *supervisor.Status {
+	return &supervisor.Status{ObjectStatus: sde.exporter.getStatus()}
+}
+
+// Close closes StackdriverExporter.
+func (sde *StackdriverExporter) Close() {
+	sde.exporter.stop()
+}
@@ -18,7 +18,9 @@
 package consulserviceregistry
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/hashicorp/consul/api"
 )
@@ -30,16 +32,21 @@ type (
 		ServiceDeregister(instanceID string) error
 		ListServiceInstances(serviceName string) ([]*api.CatalogService, error)
 		ListAllServiceInstances() ([]*api.CatalogService, error)
+		// WaitForChange blocks until the catalog index differs from
+		// lastIndex or waitTime elapses, and returns the latest index.
+		WaitForChange(ctx context.Context, lastIndex uint64, waitTime time.Duration) (uint64, error)
 	}
 
 	consulAPIClient struct {
-		client *api.Client
+		client      *api.Client
+		healthyOnly bool
 	}
 )
 
-func newConsulAPIClient(client *api.Client) *consulAPIClient {
+func newConsulAPIClient(client *api.Client, healthyOnly bool) *consulAPIClient {
 	return &consulAPIClient{
-		client: client,
+		client:      client,
+		healthyOnly: healthyOnly,
 	}
 }
 
@@ -52,6 +59,10 @@ func (c *consulAPIClient) ServiceDeregister(instanceID string) error {
 }
 
 func (c *consulAPIClient) ListServiceInstances(serviceName string) ([]*api.CatalogService, error) {
+	if c.healthyOnly {
+		return c.listHealthyServiceInstances(serviceName)
+	}
+
 	resp, _, err := c.client.Catalog().Service(serviceName, "", &api.QueryOptions{})
 	if err != nil {
 		return nil, err
@@ -59,6 +70,35 @@ func (c *consulAPIClient) ListServiceInstances(serviceName string) ([]*api.Catal
 	return resp, nil
 }
 
+// listHealthyServiceInstances lists the instances passing all of their
+// health checks, converted to catalog services for the callers.
+func (c *consulAPIClient) listHealthyServiceInstances(serviceName string) ([]*api.CatalogService, error) {
+	entries, _, err := c.client.Health().Service(serviceName, "", true, &api.QueryOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]*api.CatalogService, 0, len(entries))
+	for _, entry := range entries {
+		service := &api.CatalogService{
+			ServiceID:      entry.Service.ID,
+			ServiceName:    entry.Service.Service,
+			ServiceAddress: entry.Service.Address,
+			ServicePort:    entry.Service.Port,
+			ServiceTags:    entry.Service.Tags,
+			ServiceMeta:    entry.Service.Meta,
+		}
+		if entry.Node != nil {
+			service.Node = entry.Node.Node
+			service.Address = entry.Node.Address
+			service.Datacenter = entry.Node.Datacenter
+		}
+		services = append(services, service)
+	}
+
+	return services, nil
+}
+
 func (c *consulAPIClient) ListAllServiceInstances() ([]*api.CatalogService, error) {
 	resp, _, err := c.client.Catalog().Services(&api.QueryOptions{})
 	if err != nil {
@@ -67,7 +107,7 @@ func (c *consulAPIClient) ListAllServiceInstances() ([]*api.CatalogService, erro
 
 	catalogServices := []*api.CatalogService{}
 	for serviceName := range resp {
-		services, _, err := c.client.Catalog().Service(serviceName, "", &api.QueryOptions{})
+		services, err := c.ListServiceInstances(serviceName)
 		if err != nil {
 			return nil, fmt.Errorf("pull catalog service %s failed: %v", serviceName, err)
 		}
@@ -77,3 +117,26 @@ func (c *consulAPIClient) ListAllServiceInstances() ([]*api.CatalogService, erro
 
 	return catalogServices, nil
 }
+
+func (c *consulAPIClient) WaitForChange(ctx context.Context, lastIndex uint64, waitTime time.Duration) (uint64, error) {
+	opts := &api.QueryOptions{
+		WaitIndex: lastIndex,
+		WaitTime:  waitTime,
+	}
+
+	// Registrations and deregistrations change the catalog index, but
+	// health transitions only change the index of the health checks.
+	if c.healthyOnly {
+		_, meta, err := c.client.Health().State(api.HealthAny, opts.WithContext(ctx))
+		if err != nil {
+			return 0, err
+		}
+		return meta.LastIndex, nil
+	}
+
+	_, meta, err := c.client.Catalog().Services(opts.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	return meta.LastIndex, nil
+}
@@ -19,6 +19,7 @@
 package consulserviceregistry
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
@@ -86,6 +87,8 @@ type (
 		Namespace    string   `json:"namespace,omitempty"`
 		SyncInterval string   `json:"syncInterval" jsonschema:"required,format=duration"`
 		ServiceTags  []string `json:"serviceTags,omitempty"`
+		HealthyOnly  bool     `json:"healthyOnly,omitempty"`
+		WaitTime     string   `json:"waitTime,omitempty" jsonschema:"format=duration"`
 	}
 
 	// Status is the status of ConsulServiceRegistry.
@@ -168,17 +171,17 @@ func (c *ConsulServiceRegistry) buildClient() (consulClient, error) {
 
 	config := api.DefaultConfig()
 	config.Address = c.spec.Address
-	if config.Scheme != "" {
+	if c.spec.Scheme != "" {
 		config.Scheme = c.spec.Scheme
 	}
-	if config.Datacenter != "" {
+	if c.spec.Datacenter != "" {
 		config.Datacenter = c.spec.Datacenter
 	}
-	if config.Token != "" {
+	if c.spec.Token != "" {
 		config.Token = c.spec.Token
 	}
 
-	if config.Namespace != "" {
+	if c.spec.Namespace != "" {
 		config.Namespace = c.spec.Namespace
 	}
 
@@ -187,7 +190,7 @@ func (c *ConsulServiceRegistry) buildClient() (consulClient, error) {
 		return nil, err
 	}
 
-	c.client = newConsulAPIClient(client)
+	c.client = newConsulAPIClient(client, c.spec.HealthyOnly)
 
 	return c.client, nil
 }
@@ -215,16 +218,78 @@ func (c *ConsulServiceRegistry) run() {
 
 	c.update()
 
+	var changed <-chan struct{}
+	if c.spec.WaitTime != "" {
+		waitTime, err := time.ParseDuration(c.spec.WaitTime)
+		if err != nil {
+			logger.Errorf("BUG: parse duration %s failed: %v",
+				c.spec.WaitTime, err)
+			return
+		}
+		changed = c.watch(waitTime, syncInterval)
+	}
+
 	for {
 		select {
 		case <-c.done:
 			return
 		case <-time.After(syncInterval):
 			c.update()
+		case <-changed:
+			c.update()
 		}
 	}
 }
 
+// watch issues blocking queries in the background and notifies the
+// returned channel when the index of Consul changes.
+func (c *ConsulServiceRegistry) watch(waitTime, retryInterval time.Duration) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		<-c.done
+		cancel()
+	}()
+
+	go func() {
+		var lastIndex uint64
+		for ctx.Err() == nil {
+			client, err := c.getClient()
+			if err == nil {
+				var index uint64
+				index, err = client.WaitForChange(ctx, lastIndex, waitTime)
+				if err == nil {
+					// the index may go backwards, e.g. the consul server
+					// restarted, reset it to avoid blocking forever.
+					if index < lastIndex {
+						index = 0
+					}
+					if lastIndex != 0 && index != lastIndex {
+						select {
+						case changed <- struct{}{}:
+						default:
+						}
+					}
+					lastIndex = index
+					continue
+				}
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Errorf("%s blocking query failed: %v", c.superSpec.Name(), err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryInterval):
+			}
+		}
+	}()
+
+	return changed
+}
+
 func (c *ConsulServiceRegistry) update() {
 	instances, err := c.ListAllServiceInstances()
 	if err != nil {
@@ -0,0 +1,528 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package dnsserviceregistry provides DNSServiceRegistry.
+package dnsserviceregistry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/serviceregistry"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/v"
+)
+
+const (
+	// Category is the category of DNSServiceRegistry.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of DNSServiceRegistry.
+	Kind = "DNSServiceRegistry"
+
+	// RecordTypeA resolves the IPv4 addresses of the domain.
+	RecordTypeA = "A"
+	// RecordTypeAAAA resolves the IPv6 addresses of the domain.
+	RecordTypeAAAA = "AAAA"
+	// RecordTypeSRV resolves the targets and ports of the domain.
+	RecordTypeSRV = "SRV"
+
+	// maxWeight is the maximum weight of a server in the proxy.
+	maxWeight = 100
+)
+
+func init() {
+	supervisor.Register(&DNSServiceRegistry{})
+	api.RegisterObject(&api.APIResource{
+		Category: Category,
+		Kind:     Kind,
+		Name:     strings.ToLower(Kind),
+		Aliases:  []string{"dns"},
+	})
+}
+
+type (
+	// DNSServiceRegistry is Object DNSServiceRegistry.
+	DNSServiceRegistry struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		serviceRegistry *serviceregistry.ServiceRegistry
+		firstDone       bool
+		instances       map[string]*serviceregistry.ServiceInstanceSpec
+		notify          chan *serviceregistry.RegistryEvent
+
+		resolver           resolver
+		minRefreshInterval time.Duration
+		maxRefreshInterval time.Duration
+
+		// the resolved instances and the next time to resolve of every
+		// service, they are only accessed in the run goroutine.
+		resolved    map[string]map[string]*serviceregistry.ServiceInstanceSpec
+		nextResolve map[string]time.Time
+
+		statusMutex  sync.Mutex
+		instancesNum map[string]int
+		errors       map[string]string
+
+		done chan struct{}
+	}
+
+	// Spec describes the DNSServiceRegistry.
+	Spec struct {
+		Nameservers        []string       `json:"nameservers,omitempty"`
+		MinRefreshInterval string         `json:"minRefreshInterval,omitempty" jsonschema:"format=duration"`
+		MaxRefreshInterval string         `json:"maxRefreshInterval,omitempty" jsonschema:"format=duration"`
+		Services           []*ServiceSpec `json:"services" jsonschema:"required"`
+	}
+
+	// ServiceSpec describes a service resolved from DNS.
+	ServiceSpec struct {
+		Name       string `json:"name" jsonschema:"required"`
+		Domain     string `json:"domain" jsonschema:"required"`
+		RecordType string `json:"recordType,omitempty" jsonschema:"enum=A,enum=AAAA,enum=SRV"`
+		Port       uint16 `json:"port,omitempty"`
+		Scheme     string `json:"scheme,omitempty" jsonschema:"enum=http,enum=https"`
+	}
+
+	// Status is the status of DNSServiceRegistry.
+	Status struct {
+		Health              string            `json:"health"`
+		ServiceInstancesNum map[string]int    `json:"instancesNum"`
+		Errors              map[string]string `json:"errors,omitempty"`
+	}
+)
+
+var _ v.Validator = Spec{}
+
+// Validate validates Spec.
+func (spec Spec) Validate() error {
+	if len(spec.Services) == 0 {
+		return fmt.Errorf("zero service config")
+	}
+
+	names := map[string]bool{}
+	for _, s := range spec.Services {
+		if names[s.Name] {
+			return fmt.Errorf("duplicated service name %s", s.Name)
+		}
+		names[s.Name] = true
+
+		if s.RecordType != RecordTypeSRV && s.Port == 0 {
+			return fmt.Errorf("service %s: port is required for record type %s", s.Name, s.recordType())
+		}
+	}
+
+	minInterval, maxInterval := spec.refreshIntervals()
+	if minInterval > maxInterval {
+		return fmt.Errorf("minRefreshInterval is greater than maxRefreshInterval")
+	}
+
+	return nil
+}
+
+func (spec *Spec) refreshIntervals() (time.Duration, time.Duration) {
+	minInterval, maxInterval := 5*time.Second, 5*time.Minute
+	if d, err := time.ParseDuration(spec.MinRefreshInterval); err == nil {
+		minInterval = d
+	}
+	if d, err := time.ParseDuration(spec.MaxRefreshInterval); err == nil {
+		maxInterval = d
+	}
+	return minInterval, maxInterval
+}
+
+func (s *ServiceSpec) recordType() string {
+	if s.RecordType == "" {
+		return RecordTypeA
+	}
+	return s.RecordType
+}
+
+// Category returns the category of DNSServiceRegistry.
+func (d *DNSServiceRegistry) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of DNSServiceRegistry.
+func (d *DNSServiceRegistry) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of DNSServiceRegistry.
+func (d *DNSServiceRegistry) DefaultSpec() interface{} {
+	return &Spec{
+		MinRefreshInterval: "5s",
+		MaxRefreshInterval: "5m",
+	}
+}
+
+// Init initializes DNSServiceRegistry.
+func (d *DNSServiceRegistry) Init(superSpec *supervisor.Spec) {
+	d.superSpec, d.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	d.reload()
+}
+
+// Inherit inherits previous generation of DNSServiceRegistry.
+func (d *DNSServiceRegistry) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	d.Init(superSpec)
+}
+
+func (d *DNSServiceRegistry) reload() {
+	d.serviceRegistry = d.superSpec.Super().MustGetSystemController(serviceregistry.Kind).
+		Instance().(*serviceregistry.ServiceRegistry)
+	d.firstDone = false
+	d.notify = make(chan *serviceregistry.RegistryEvent, 10)
+
+	d.minRefreshInterval, d.maxRefreshInterval = d.spec.refreshIntervals()
+	d.resolved = map[string]map[string]*serviceregistry.ServiceInstanceSpec{}
+	d.nextResolve = map[string]time.Time{}
+
+	d.instancesNum = map[string]int{}
+	d.errors = map[string]string{}
+	d.done = make(chan struct{})
+
+	r, err := newDNSResolver(d.spec.Nameservers)
+	if err != nil {
+		logger.Errorf("%s create dns resolver failed: %v", d.superSpec.Name(), err)
+	} else {
+		d.resolver = r
+	}
+
+	d.serviceRegistry.RegisterRegistry(d)
+
+	go d.run()
+}
+
+func (d *DNSServiceRegistry) run() {
+	if d.resolver == nil {
+		return
+	}
+
+	for {
+		next := d.update()
+
+		select {
+		case <-d.done:
+			return
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
+
+// update resolves the services which are due, notifies the changes and
+// returns the time of the next resolution.
+func (d *DNSServiceRegistry) update() time.Time {
+	now := time.Now()
+	next := now.Add(d.maxRefreshInterval)
+
+	for _, s := range d.spec.Services {
+		if t, ok := d.nextResolve[s.Name]; ok && t.After(now) {
+			if t.Before(next) {
+				next = t
+			}
+			continue
+		}
+
+		instances, ttl, err := d.resolve(s)
+		if err != nil {
+			// keep the previous instances on failure, a transient DNS
+			// error should not take the whole service down.
+			logger.Errorf("%s resolve %s failed: %v", d.superSpec.Name(), s.Domain, err)
+			ttl = d.minRefreshInterval
+		} else {
+			d.resolved[s.Name] = instances
+		}
+		d.setError(s.Name, err)
+
+		t := now.Add(d.clampTTL(ttl))
+		d.nextResolve[s.Name] = t
+		if t.Before(next) {
+			next = t
+		}
+	}
+
+	instances := map[string]*serviceregistry.ServiceInstanceSpec{}
+	instancesNum := map[string]int{}
+	for name, resolved := range d.resolved {
+		for k, instance := range resolved {
+			instances[k] = instance
+		}
+		instancesNum[name] = len(resolved)
+	}
+
+	var event *serviceregistry.RegistryEvent
+	if !d.firstDone {
+		d.firstDone = true
+		event = &serviceregistry.RegistryEvent{
+			SourceRegistryName: d.Name(),
+			UseReplace:         true,
+			Replace:            instances,
+		}
+	} else {
+		event = serviceregistry.NewRegistryEventFromDiff(d.Name(), d.instances, instances)
+	}
+
+	if event.Empty() {
+		return next
+	}
+
+	d.notify <- event
+	d.instances = instances
+
+	d.statusMutex.Lock()
+	d.instancesNum = instancesNum
+	d.statusMutex.Unlock()
+
+	return next
+}
+
+func (d *DNSServiceRegistry) setError(name string, err error) {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+
+	if err != nil {
+		d.errors[name] = err.Error()
+	} else {
+		delete(d.errors, name)
+	}
+}
+
+func (d *DNSServiceRegistry) clampTTL(ttl time.Duration) time.Duration {
+	if ttl < d.minRefreshInterval {
+		return d.minRefreshInterval
+	}
+	if ttl > d.maxRefreshInterval {
+		return d.maxRefreshInterval
+	}
+	return ttl
+}
+
+// resolve resolves the instances of the service, it also returns the
+// minimum TTL of the records.
+func (d *DNSServiceRegistry) resolve(s *ServiceSpec) (map[string]*serviceregistry.ServiceInstanceSpec, time.Duration, error) {
+	var qtype uint16
+	switch s.recordType() {
+	case RecordTypeA:
+		qtype = dns.TypeA
+	case RecordTypeAAAA:
+		qtype = dns.TypeAAAA
+	case RecordTypeSRV:
+		qtype = dns.TypeSRV
+	}
+
+	records, err := d.resolver.lookup(s.Domain, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return recordsToInstances(d.Name(), s, records)
+}
+
+func recordsToInstances(registryName string, s *ServiceSpec, records []dns.RR) (map[string]*serviceregistry.ServiceInstanceSpec, time.Duration, error) {
+	var ttl uint32
+	observeTTL := func(rr dns.RR) {
+		if ttl == 0 || rr.Header().Ttl < ttl {
+			ttl = rr.Header().Ttl
+		}
+	}
+
+	instances := map[string]*serviceregistry.ServiceInstanceSpec{}
+	add := func(address string, port uint16, weight int) {
+		instance := &serviceregistry.ServiceInstanceSpec{
+			RegistryName: registryName,
+			ServiceName:  s.Name,
+			InstanceID:   address + ":" + strconv.Itoa(int(port)),
+			Address:      address,
+			Port:         port,
+			Scheme:       s.Scheme,
+			Weight:       weight,
+		}
+		instances[instance.Key()] = instance
+	}
+
+	if s.recordType() != RecordTypeSRV {
+		for _, rr := range records {
+			switch r := rr.(type) {
+			case *dns.A:
+				add(r.A.String(), s.Port, 0)
+				observeTTL(rr)
+			case *dns.AAAA:
+				add(r.AAAA.String(), s.Port, 0)
+				observeTTL(rr)
+			}
+		}
+	} else {
+		// only the targets with the lowest priority are used, the others
+		// are backups according to RFC 2782.
+		var srvs []*dns.SRV
+		for _, rr := range records {
+			r, ok := rr.(*dns.SRV)
+			if !ok || r.Target == "." {
+				continue
+			}
+			observeTTL(rr)
+			if len(srvs) > 0 && r.Priority > srvs[0].Priority {
+				continue
+			}
+			if len(srvs) > 0 && r.Priority < srvs[0].Priority {
+				srvs = srvs[:0]
+			}
+			srvs = append(srvs, r)
+		}
+
+		var max uint16
+		for _, r := range srvs {
+			if r.Weight > max {
+				max = r.Weight
+			}
+		}
+
+		for _, r := range srvs {
+			// scale the weight into the range the proxy accepts, a zero
+			// weight still gets a small chance to be chosen.
+			weight := 1
+			if max > 0 {
+				weight = int(r.Weight) * maxWeight / int(max)
+				if weight == 0 {
+					weight = 1
+				}
+			}
+			add(strings.TrimSuffix(r.Target, "."), r.Port, weight)
+		}
+	}
+
+	if len(instances) == 0 {
+		return nil, 0, fmt.Errorf("no %s record of %s", s.recordType(), s.Domain)
+	}
+
+	return instances, time.Duration(ttl) * time.Second, nil
+}
+
+// Status returns status of DNSServiceRegistry.
+func (d *DNSServiceRegistry) Status() *supervisor.Status {
+	s := &Status{}
+
+	if d.resolver == nil {
+		s.Health = "no dns resolver"
+	} else {
+		s.Health = "ready"
+	}
+
+	d.statusMutex.Lock()
+	s.ServiceInstancesNum = d.instancesNum
+	if len(d.errors) > 0 {
+		s.Errors = make(map[string]string, len(d.errors))
+		for k, v := range d.errors {
+			s.Errors[k] = v
+		}
+	}
+	d.statusMutex.Unlock()
+
+	return &supervisor.Status{
+		ObjectStatus: s,
+	}
+}
+
+// Close closes DNSServiceRegistry.
+func (d *DNSServiceRegistry) Close() {
+	d.serviceRegistry.DeregisterRegistry(d.Name())
+
+	close(d.done)
+}
+
+// Name returns name.
+func (d *DNSServiceRegistry) Name() string {
+	return d.superSpec.Name()
+}
+
+// Notify returns notify channel.
+func (d *DNSServiceRegistry) Notify() <-chan *serviceregistry.RegistryEvent {
+	return d.notify
+}
+
+// ApplyServiceInstances applies service instances to the registry.
+// The records are managed by the DNS server, so it always fails.
+func (d *DNSServiceRegistry) ApplyServiceInstances(instances map[string]*serviceregistry.ServiceInstanceSpec) error {
+	return fmt.Errorf("%s is read-only", d.superSpec.Name())
+}
+
+// DeleteServiceInstances deletes service instances from the registry.
+// The records are managed by the DNS server, so it always fails.
+func (d *DNSServiceRegistry) DeleteServiceInstances(instances map[string]*serviceregistry.ServiceInstanceSpec) error {
+	return fmt.Errorf("%s is read-only", d.superSpec.Name())
+}
+
+// GetServiceInstance get service instance from the registry.
+func (d *DNSServiceRegistry) GetServiceInstance(serviceName, instanceID string) (*serviceregistry.ServiceInstanceSpec, error) {
+	instances, err := d.ListServiceInstances(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, instance := range instances {
+		if instance.InstanceID == instanceID {
+			return instance, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s/%s not found", serviceName, instanceID)
+}
+
+// ListServiceInstances list service instances of one service from the registry.
+func (d *DNSServiceRegistry) ListServiceInstances(serviceName string) (map[string]*serviceregistry.ServiceInstanceSpec, error) {
+	if d.resolver == nil {
+		return nil, fmt.Errorf("%s has no dns resolver", d.superSpec.Name())
+	}
+
+	for _, s := range d.spec.Services {
+		if s.Name == serviceName {
+			instances, _, err := d.resolve(s)
+			return instances, err
+		}
+	}
+
+	return nil, fmt.Errorf("service %s not found", serviceName)
+}
+
+// ListAllServiceInstances list all service instances from the registry.
+func (d *DNSServiceRegistry) ListAllServiceInstances() (map[string]*serviceregistry.ServiceInstanceSpec, error) {
+	if d.resolver == nil {
+		return nil, fmt.Errorf("%s has no dns resolver", d.superSpec.Name())
+	}
+
+	instances := map[string]*serviceregistry.ServiceInstanceSpec{}
+	for _, s := range d.spec.Services {
+		resolved, _, err := d.resolve(s)
+		if err != nil {
+			return nil, err
+		}
+		for k, instance := range resolved {
+			instances[k] = instance
+		}
+	}
+
+	return instances, nil
+}
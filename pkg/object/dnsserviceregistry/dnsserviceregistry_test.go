@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnsserviceregistry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func mustRR(t *testing.T, s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := Spec{}
+	assert.Error(spec.Validate())
+
+	spec.Services = []*ServiceSpec{{Name: "backend", Domain: "backend.local"}}
+	assert.Error(spec.Validate(), "port is required for A records")
+
+	spec.Services[0].Port = 8080
+	assert.NoError(spec.Validate())
+
+	spec.Services = append(spec.Services, &ServiceSpec{Name: "backend", Domain: "other.local", RecordType: RecordTypeSRV})
+	assert.Error(spec.Validate(), "duplicated name")
+
+	spec.Services[1].Name = "other"
+	assert.NoError(spec.Validate())
+
+	spec.MinRefreshInterval = "10m"
+	assert.Error(spec.Validate())
+}
+
+func TestAddressRecordsToInstances(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &ServiceSpec{Name: "backend", Domain: "backend.local", Port: 8080}
+	records := []dns.RR{
+		mustRR(t, "backend.local. 60 IN CNAME web.local."),
+		mustRR(t, "web.local. 30 IN A 10.0.0.1"),
+		mustRR(t, "web.local. 45 IN A 10.0.0.2"),
+	}
+
+	instances, ttl, err := recordsToInstances("dns", s, records)
+	assert.NoError(err)
+	assert.Equal(30*time.Second, ttl)
+	assert.Len(instances, 2)
+
+	instance := instances["dns/backend/10.0.0.1:8080"]
+	assert.NotNil(instance)
+	assert.Equal("10.0.0.1", instance.Address)
+	assert.Equal(uint16(8080), instance.Port)
+	assert.NoError(instance.Validate())
+
+	_, _, err = recordsToInstances("dns", s, records[:1])
+	assert.Error(err)
+}
+
+func TestSRVRecordsToInstances(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &ServiceSpec{Name: "backend", Domain: "_http._tcp.backend.local", RecordType: RecordTypeSRV}
+	records := []dns.RR{
+		mustRR(t, "_http._tcp.backend.local. 60 IN SRV 10 60 8080 a.backend.local."),
+		mustRR(t, "_http._tcp.backend.local. 60 IN SRV 10 20 8081 b.backend.local."),
+		mustRR(t, "_http._tcp.backend.local. 60 IN SRV 10 0 8082 c.backend.local."),
+		mustRR(t, "_http._tcp.backend.local. 30 IN SRV 20 100 8080 backup.backend.local."),
+	}
+
+	instances, ttl, err := recordsToInstances("dns", s, records)
+	assert.NoError(err)
+	assert.Equal(30*time.Second, ttl)
+	assert.Len(instances, 3)
+
+	assert.Equal(100, instances["dns/backend/a.backend.local:8080"].Weight)
+	assert.Equal(33, instances["dns/backend/b.backend.local:8081"].Weight)
+	assert.Equal(1, instances["dns/backend/c.backend.local:8082"].Weight)
+	assert.Nil(instances["dns/backend/backup.backend.local:8080"])
+}
+
+func TestClampTTL(t *testing.T) {
+	assert := assert.New(t)
+
+	d := &DNSServiceRegistry{
+		minRefreshInterval: 5 * time.Second,
+		maxRefreshInterval: time.Minute,
+	}
+	assert.Equal(5*time.Second, d.clampTTL(0))
+	assert.Equal(30*time.Second, d.clampTTL(30*time.Second))
+	assert.Equal(time.Minute, d.clampTTL(time.Hour))
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnsserviceregistry
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	resolvConf     = "/etc/resolv.conf"
+	defaultTimeout = 5 * time.Second
+)
+
+type (
+	// resolver looks up the records of a domain, the standard library
+	// is not used because it hides the TTL of the records.
+	resolver interface {
+		lookup(domain string, qtype uint16) ([]dns.RR, error)
+	}
+
+	dnsResolver struct {
+		client      *dns.Client
+		nameservers []string
+	}
+)
+
+func newDNSResolver(nameservers []string) (*dnsResolver, error) {
+	if len(nameservers) == 0 {
+		cfg, err := dns.ClientConfigFromFile(resolvConf)
+		if err != nil {
+			return nil, fmt.Errorf("read %s failed: %v", resolvConf, err)
+		}
+		for _, server := range cfg.Servers {
+			nameservers = append(nameservers, net.JoinHostPort(server, cfg.Port))
+		}
+	}
+
+	if len(nameservers) == 0 {
+		return nil, fmt.Errorf("no nameserver")
+	}
+
+	return &dnsResolver{
+		client:      &dns.Client{Timeout: defaultTimeout},
+		nameservers: nameservers,
+	}, nil
+}
+
+// lookup tries the nameservers in order until one of them answers.
+func (r *dnsResolver) lookup(domain string, qtype uint16) ([]dns.RR, error) {
+	msg := &dns.Msg{}
+	msg.SetQuestion(dns.Fqdn(domain), qtype)
+	msg.RecursionDesired = true
+
+	var err error
+	for _, server := range r.nameservers {
+		var resp *dns.Msg
+		resp, _, err = r.client.Exchange(msg, server)
+		if err != nil {
+			continue
+		}
+
+		switch resp.Rcode {
+		case dns.RcodeSuccess:
+			return resp.Answer, nil
+		case dns.RcodeNameError:
+			return nil, fmt.Errorf("domain %s not found", domain)
+		default:
+			err = fmt.Errorf("query %s from %s failed: %s",
+				domain, server, dns.RcodeToString[resp.Rcode])
+		}
+	}
+
+	return nil, err
+}
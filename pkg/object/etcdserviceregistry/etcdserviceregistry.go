@@ -32,6 +32,7 @@ import (
 	"github.com/megaease/easegress/v2/pkg/supervisor"
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
 
+	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
@@ -205,16 +206,62 @@ func (e *EtcdServiceRegistry) run() {
 
 	e.update()
 
+	changed := e.watch()
+
 	for {
 		select {
 		case <-e.done:
 			return
 		case <-time.After(cacheTimeout):
 			e.update()
+		case <-changed:
+			e.update()
 		}
 	}
 }
 
+// watch watches the prefix in the background and notifies the returned
+// channel on changes, so registrations are picked up without waiting
+// for the next synchronization.
+func (e *EtcdServiceRegistry) watch() <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		<-e.done
+		cancel()
+	}()
+
+	go func() {
+		for ctx.Err() == nil {
+			client, err := e.getClient()
+			if err == nil {
+				wch := client.Watch(clientv3.WithRequireLeader(ctx), e.spec.Prefix, clientv3.WithPrefix())
+				for resp := range wch {
+					if err = resp.Err(); err != nil {
+						break
+					}
+					select {
+					case changed <- struct{}{}:
+					default:
+					}
+				}
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Errorf("%s watch %s failed: %v", e.superSpec.Name(), e.spec.Prefix, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(requestTimeout):
+			}
+		}
+	}()
+
+	return changed
+}
+
 func (e *EtcdServiceRegistry) update() {
 	instances, err := e.ListAllServiceInstances()
 	if err != nil {
@@ -357,6 +404,7 @@ func (e *EtcdServiceRegistry) GetServiceInstance(serviceName, instanceID string)
 		return nil, fmt.Errorf("unmarshal %s to json failed: %v", resp.Kvs[0].Value, err)
 	}
 
+	e.completeInstance(string(resp.Kvs[0].Key), instance)
 	err = instance.Validate()
 	if err != nil {
 		return nil, fmt.Errorf("%+v is invalid: %v", instance, err)
@@ -385,23 +433,7 @@ func (e *EtcdServiceRegistry) ListServiceInstances(serviceName string) (map[stri
 		return nil, err
 	}
 
-	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
-	for _, kv := range resp.Kvs {
-		instance := &serviceregistry.ServiceInstanceSpec{}
-		err = codectool.Unmarshal(kv.Value, instance)
-		if err != nil {
-			return nil, fmt.Errorf("unmarshal %s to json failed: %v", kv.Value, err)
-		}
-
-		err = instance.Validate()
-		if err != nil {
-			return nil, fmt.Errorf("%+v is invalid: %v", instance, err)
-		}
-
-		instances[instance.Key()] = instance
-	}
-
-	return instances, nil
+	return e.kvsToInstances(resp.Kvs), nil
 }
 
 // ListAllServiceInstances list all service instances from the registry.
@@ -411,23 +443,52 @@ func (e *EtcdServiceRegistry) ListAllServiceInstances() (map[string]*serviceregi
 		return nil, err
 	}
 
+	return e.kvsToInstances(resp.Kvs), nil
+}
+
+// kvsToInstances decodes the service instances, the invalid ones are
+// skipped, so that a broken registration can't affect the others.
+func (e *EtcdServiceRegistry) kvsToInstances(kvs []*mvccpb.KeyValue) map[string]*serviceregistry.ServiceInstanceSpec {
 	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
-	for _, kv := range resp.Kvs {
+	for _, kv := range kvs {
 		instance := &serviceregistry.ServiceInstanceSpec{}
-		err = codectool.Unmarshal(kv.Value, instance)
+		err := codectool.Unmarshal(kv.Value, instance)
 		if err != nil {
-			return nil, fmt.Errorf("unmarshal %s to codectool failed: %v", kv.Value, err)
+			logger.Warnf("%s unmarshal %s failed: %v", e.superSpec.Name(), kv.Key, err)
+			continue
 		}
 
+		e.completeInstance(string(kv.Key), instance)
 		err = instance.Validate()
 		if err != nil {
-			return nil, fmt.Errorf("%+v is invalid: %v", instance, err)
+			logger.Warnf("%s %s is invalid: %v", e.superSpec.Name(), kv.Key, err)
+			continue
 		}
 
 		instances[instance.Key()] = instance
 	}
 
-	return instances, nil
+	return instances
+}
+
+// completeInstance fills the missing fields from the key in the form of
+// prefix/serviceName/instanceID, so self-registering services only need
+// to write the address and the port.
+func (e *EtcdServiceRegistry) completeInstance(key string, instance *serviceregistry.ServiceInstanceSpec) {
+	if instance.RegistryName == "" {
+		instance.RegistryName = e.Name()
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(key, e.spec.Prefix), "/"), "/")
+	if len(parts) != 2 {
+		return
+	}
+	if instance.ServiceName == "" {
+		instance.ServiceName = parts[0]
+	}
+	if instance.InstanceID == "" {
+		instance.InstanceID = parts[1]
+	}
 }
 
 func (e *EtcdServiceRegistry) serviceEtcdPrefix(serviceName string) string {
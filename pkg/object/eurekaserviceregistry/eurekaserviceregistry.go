@@ -393,6 +393,12 @@ func (e *EurekaServiceRegistry) ListAllServiceInstances() (map[string]*servicere
 func (e *EurekaServiceRegistry) instanceInfoToServiceInstances(info *eurekaapi.InstanceInfo) []*serviceregistry.ServiceInstanceSpec {
 	var instances []*serviceregistry.ServiceInstanceSpec
 
+	// instances which are starting, down or out of service must not
+	// receive traffic.
+	if info.Status != "" && info.Status != eurekaapi.UP {
+		return nil
+	}
+
 	registryName := e.Name()
 	if info.Metadata != nil && info.Metadata.Map != nil &&
 		info.Metadata.Map[MetaKeyRegistryName] != "" {
@@ -438,6 +444,7 @@ func (e *EurekaServiceRegistry) serviceInstanceToInstanceInfo(serviceInstance *s
 		App:        serviceInstance.ServiceName,
 		InstanceID: serviceInstance.InstanceID,
 		IpAddr:     serviceInstance.Address,
+		Status:     eurekaapi.UP,
 	}
 
 	switch serviceInstance.Scheme {
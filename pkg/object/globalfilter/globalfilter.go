@@ -83,6 +83,32 @@ type (
 	}
 )
 
+// References returns the objects referenced by the filters of the before
+// and after pipelines.
+func (s *Spec) References() []string {
+	var names []string
+	if s.BeforePipeline != nil {
+		names = append(names, s.BeforePipeline.References()...)
+	}
+	if s.AfterPipeline != nil {
+		names = append(names, s.AfterPipeline.References()...)
+	}
+	return names
+}
+
+// TemplateReferences returns the shared templates referenced by the
+// filters of the before and after pipelines.
+func (s *Spec) TemplateReferences() []string {
+	var names []string
+	if s.BeforePipeline != nil {
+		names = append(names, s.BeforePipeline.TemplateReferences()...)
+	}
+	if s.AfterPipeline != nil {
+		names = append(names, s.AfterPipeline.TemplateReferences()...)
+	}
+	return names
+}
+
 // Validate validates Spec.
 func (s *Spec) Validate() (err error) {
 	bothNil := true
@@ -211,6 +237,19 @@ func (gf *GlobalFilter) Handle(ctx *context.Context, handler context.Handler) {
 	p.HandleWithBeforeAfter(ctx, before, after, option)
 }
 
+// NeedPayload reports whether the before or the after pipeline needs the
+// whole payload of the request or the response.
+func (gf *GlobalFilter) NeedPayload() (request, response bool) {
+	for _, v := range []*atomic.Value{&gf.beforePipeline, &gf.afterPipeline} {
+		if p, _ := v.Load().(*pipeline.Pipeline); p != nil {
+			req, resp := p.NeedPayload()
+			request = request || req
+			response = response || resp
+		}
+	}
+	return request, response
+}
+
 // Close closes GlobalFilter itself.
 func (gf *GlobalFilter) Close() {
 }
@@ -69,6 +69,12 @@ func (g *GRPCServer) DefaultSpec() interface{} {
 	}
 }
 
+// OverridableFields returns the fields of GrpcServer overridable on a member,
+// the port and the limits of the host.
+func (g *GRPCServer) OverridableFields() []string {
+	return []string{"port", "maxConnections", "cacheSize"}
+}
+
 // Init first create GrpcServer by Spec.name
 func (g *GRPCServer) Init(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
 	g.runtime = newRuntime(superSpec, muxMapper)
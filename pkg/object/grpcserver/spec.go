@@ -94,6 +94,17 @@ func (h *Header) initHeaderRoute() {
 	h.headerRE = regexp.MustCompile(h.Regexp)
 }
 
+// References returns the pipelines in the rules and the global filter.
+func (s *Spec) References() []string {
+	names := []string{s.GlobalFilter}
+	for _, rule := range s.Rules {
+		for _, method := range rule.Methods {
+			names = append(names, method.Backend)
+		}
+	}
+	return names
+}
+
 // Validate validates Method.
 func (m *Method) Validate() error {
 	return nil
@@ -0,0 +1,246 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+// certFileCheckInterval is the interval to check the modification of the
+// certificate files, it is a variable for testing.
+var certFileCheckInterval = 10 * time.Second
+
+type (
+	// CertFileSpec describes a certificate loaded from files.
+	CertFileSpec struct {
+		// ServerNames are the SNI names to select this certificate, wildcard
+		// names like '*.example.com' are supported. The DNS names in the
+		// certificate are used if it is empty.
+		ServerNames []string `json:"serverNames,omitempty"`
+		CertFile    string   `json:"certFile" jsonschema:"required"`
+		KeyFile     string   `json:"keyFile" jsonschema:"required"`
+	}
+
+	// certFileManager manages the certificates loaded from files, selects
+	// certificates by SNI, and reloads the files when they are modified.
+	certFileManager struct {
+		name    string
+		entries []*certFileEntry
+		publish func(*CertificateEvent)
+
+		mutex  sync.RWMutex
+		byName map[string]*tls.Certificate
+
+		done chan struct{}
+	}
+
+	certFileEntry struct {
+		spec        *CertFileSpec
+		cert        *tls.Certificate
+		certModTime time.Time
+		keyModTime  time.Time
+		// failed is true if the last reload failed, to publish the
+		// failure only once.
+		failed bool
+	}
+)
+
+func modTime(path string) (time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fi.ModTime(), nil
+}
+
+// load loads the certificate and key files of the entry.
+func (e *certFileEntry) load() error {
+	certModTime, err := modTime(e.spec.CertFile)
+	if err != nil {
+		return err
+	}
+	keyModTime, err := modTime(e.spec.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(e.spec.CertFile, e.spec.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair %s, %s failed: %v", e.spec.CertFile, e.spec.KeyFile, err)
+	}
+
+	e.cert, e.certModTime, e.keyModTime = &cert, certModTime, keyModTime
+	return nil
+}
+
+// modified returns whether the files are modified since last load.
+func (e *certFileEntry) modified() bool {
+	certModTime, err := modTime(e.spec.CertFile)
+	if err != nil {
+		return false
+	}
+	keyModTime, err := modTime(e.spec.KeyFile)
+	if err != nil {
+		return false
+	}
+	return !certModTime.Equal(e.certModTime) || !keyModTime.Equal(e.keyModTime)
+}
+
+func (e *certFileEntry) leaf() *x509.Certificate {
+	if e.cert.Leaf != nil {
+		return e.cert.Leaf
+	}
+	leaf, _ := x509.ParseCertificate(e.cert.Certificate[0])
+	return leaf
+}
+
+func (e *certFileEntry) serverNames() []string {
+	if len(e.spec.ServerNames) > 0 {
+		return e.spec.ServerNames
+	}
+
+	leaf := e.leaf()
+	if leaf == nil {
+		return nil
+	}
+	if len(leaf.DNSNames) > 0 {
+		return leaf.DNSNames
+	}
+	if leaf.Subject.CommonName != "" {
+		return []string{leaf.Subject.CommonName}
+	}
+	return nil
+}
+
+// newCertFileManager creates a manager, publish is called when a
+// certificate is reloaded or fails to reload.
+func newCertFileManager(name string, specs []*CertFileSpec, publish func(*CertificateEvent)) (*certFileManager, error) {
+	m := &certFileManager{
+		name:    name,
+		publish: publish,
+		done:    make(chan struct{}),
+	}
+
+	for _, spec := range specs {
+		e := &certFileEntry{spec: spec}
+		if err := e.load(); err != nil {
+			return nil, err
+		}
+		m.entries = append(m.entries, e)
+	}
+	m.buildIndex()
+
+	go m.run()
+	return m, nil
+}
+
+func (m *certFileManager) buildIndex() {
+	byName := map[string]*tls.Certificate{}
+	for _, e := range m.entries {
+		for _, name := range e.serverNames() {
+			name = strings.ToLower(name)
+			if _, ok := byName[name]; !ok {
+				byName[name] = e.cert
+			}
+		}
+	}
+
+	m.mutex.Lock()
+	m.byName = byName
+	m.mutex.Unlock()
+}
+
+func (m *certFileManager) run() {
+	ticker := time.NewTicker(certFileCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.reload()
+		}
+	}
+}
+
+func (m *certFileManager) reload() {
+	changed := false
+	for _, e := range m.entries {
+		if !e.modified() {
+			continue
+		}
+		if err := e.load(); err != nil {
+			logger.Errorf("httpserver %s: reload certificate failed, keep using the old one: %v", m.name, err)
+			if !e.failed {
+				e.failed = true
+				m.publish(&CertificateEvent{Type: CertificateFailed, Source: e.spec.CertFile, Message: err.Error()})
+			}
+			continue
+		}
+		logger.Infof("httpserver %s: certificate %s reloaded", m.name, e.spec.CertFile)
+		e.failed = false
+		changed = true
+
+		event := &CertificateEvent{Type: CertificateReloaded, Source: e.spec.CertFile, ServerNames: e.serverNames()}
+		if leaf := e.leaf(); leaf != nil {
+			event.NotAfter = leaf.NotAfter
+		}
+		m.publish(event)
+	}
+
+	if changed {
+		m.buildIndex()
+	}
+}
+
+// getCertificate returns the certificate for the server name, it returns
+// nil if there's no matching certificate.
+func (m *certFileManager) getCertificate(serverName string) *tls.Certificate {
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if name == "" {
+		return nil
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if cert, ok := m.byName[name]; ok {
+		return cert
+	}
+
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		if cert, ok := m.byName["*"+name[i:]]; ok {
+			return cert
+		}
+	}
+
+	return nil
+}
+
+func (m *certFileManager) close() {
+	close(m.done)
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context/contexttest"
+	"github.com/megaease/easegress/v2/pkg/option"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeCertFiles(t *testing.T, dir, name string, dnsNames ...string) *CertFileSpec {
+	certPem, keyPem := generateCert(t, dnsNames...)
+	spec := &CertFileSpec{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+	}
+	assert.NoError(t, os.WriteFile(spec.CertFile, certPem, 0o600))
+	assert.NoError(t, os.WriteFile(spec.KeyFile, keyPem, 0o600))
+	return spec
+}
+
+func leafOf(t *testing.T, cert *tls.Certificate) *x509.Certificate {
+	if cert == nil {
+		return nil
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.NoError(t, err)
+	return leaf
+}
+
+func TestCertFileManager(t *testing.T) {
+	assert := assert.New(t)
+
+	old := certFileCheckInterval
+	certFileCheckInterval = 50 * time.Millisecond
+	defer func() { certFileCheckInterval = old }()
+
+	dir := t.TempDir()
+	specA := writeCertFiles(t, dir, "a", "a.example.com")
+	specB := writeCertFiles(t, dir, "b", "b.example.com")
+	specB.ServerNames = []string{"*.example.org"}
+
+	hub := newCertEventHub()
+	_, err := newCertFileManager("test", []*CertFileSpec{{CertFile: "not-exist.crt", KeyFile: "not-exist.key"}}, hub.publish)
+	assert.Error(err)
+
+	m, err := newCertFileManager("test", []*CertFileSpec{specA, specB}, hub.publish)
+	assert.NoError(err)
+	defer m.close()
+
+	assert.Equal([]string{"a.example.com"}, leafOf(t, m.getCertificate("A.example.com.")).DNSNames)
+	assert.Equal([]string{"b.example.com"}, leafOf(t, m.getCertificate("www.example.org")).DNSNames)
+	assert.Nil(m.getCertificate("b.example.com"))
+	assert.Nil(m.getCertificate("example.org"))
+	assert.Nil(m.getCertificate(""))
+
+	// the certificate files are modified.
+	time.Sleep(10 * time.Millisecond)
+	oldSerial := leafOf(t, m.getCertificate("a.example.com")).SerialNumber
+	writeCertFiles(t, dir, "a", "a.example.com")
+	assert.Eventually(func() bool {
+		return leafOf(t, m.getCertificate("a.example.com")).SerialNumber.Cmp(oldSerial) != 0
+	}, 2*time.Second, 50*time.Millisecond)
+	events := hub.list()
+	assert.Len(events, 1)
+	assert.Equal(CertificateReloaded, events[0].Type)
+	assert.Equal(specA.CertFile, events[0].Source)
+	assert.Equal([]string{"a.example.com"}, events[0].ServerNames)
+	assert.False(events[0].NotAfter.IsZero())
+
+	// invalid files are ignored.
+	oldSerial = leafOf(t, m.getCertificate("a.example.com")).SerialNumber
+	os.WriteFile(specA.CertFile, []byte("invalid"), 0o600)
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(oldSerial, leafOf(t, m.getCertificate("a.example.com")).SerialNumber)
+
+	// the failure is published only once.
+	events = hub.list()
+	assert.Len(events, 2)
+	assert.Equal(CertificateFailed, events[1].Type)
+}
+
+func TestSNICertificates(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	specA := writeCertFiles(t, dir, "a", "a.example.com")
+	specB := writeCertFiles(t, dir, "b", "b.example.com")
+
+	yamlConfig := fmt.Sprintf(`
+kind: HTTPServer
+name: test
+port: 38085
+keepAlive: true
+https: true
+certFiles:
+- certFile: %s
+  keyFile: %s
+- certFile: %s
+  keyFile: %s
+`, specA.CertFile, specA.KeyFile, specB.CertFile, specB.KeyFile)
+	super := supervisor.NewMock(option.New(), nil, nil,
+		nil, false, nil, nil)
+	superSpec, err := super.NewSpec(yamlConfig)
+	assert.NoError(err)
+
+	r := newRuntime(superSpec, &contexttest.MockedMuxMapper{})
+	r.reload(superSpec, &contexttest.MockedMuxMapper{})
+	defer r.Close()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(stateRunning, r.getState())
+
+	get := func(serverName string) (*http.Response, error) {
+		client := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					ServerName:         serverName,
+					InsecureSkipVerify: true,
+				},
+			},
+		}
+		return client.Get("https://127.0.0.1:38085/")
+	}
+
+	for _, name := range []string{"a.example.com", "b.example.com"} {
+		resp, err := get(name)
+		assert.NoError(err)
+		assert.Equal([]string{name}, resp.TLS.PeerCertificates[0].DNSNames)
+		resp.Body.Close()
+	}
+
+	_, err = get("c.example.com")
+	assert.Error(err)
+	counter := r.metrics.TLSHandshakeFailures.WithLabelValues("c.example.com")
+	assert.Eventually(func() bool {
+		return testutil.ToFloat64(counter) == 1
+	}, time.Second, 10*time.Millisecond)
+}
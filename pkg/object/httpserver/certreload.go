@@ -0,0 +1,184 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// CertificateReloaded means a certificate file is reloaded.
+	CertificateReloaded = "reloaded"
+	// CertificateUpdated means the certificates in the spec are updated.
+	CertificateUpdated = "updated"
+	// CertificateFailed means the new certificates fail to load, and the
+	// old ones are kept in use.
+	CertificateFailed = "failed"
+
+	// certEventSourceSpec is the source of the events of the certificates
+	// in the spec.
+	certEventSourceSpec = "spec"
+
+	// maxCertEvents is the number of the recent events kept in memory.
+	maxCertEvents = 50
+	// certEventBufferSize is the buffer size of the channel of a
+	// subscriber, the events are dropped for a slow subscriber.
+	certEventBufferSize = 16
+)
+
+type (
+	// CertificateEvent is the event of the rotation of the certificates.
+	CertificateEvent struct {
+		Time time.Time `json:"time"`
+		// Type is reloaded, updated or failed.
+		Type string `json:"type"`
+		// Source is the certificate file, or spec for the certificates in
+		// the spec.
+		Source      string    `json:"source"`
+		ServerNames []string  `json:"serverNames,omitempty"`
+		NotAfter    time.Time `json:"notAfter,omitempty"`
+		Message     string    `json:"message,omitempty"`
+	}
+
+	// certEventHub keeps the recent certificate events and publishes the
+	// new events to the subscribers.
+	certEventHub struct {
+		mutex       sync.Mutex
+		events      []*CertificateEvent
+		subscribers map[chan interface{}]struct{}
+	}
+
+	// certSelector selects the certificates for the TLS handshakes, the
+	// certificates are swapped when they are updated, so the server needn't
+	// restart and the existing connections are kept.
+	certSelector struct {
+		current atomic.Pointer[certSource]
+	}
+
+	// certSource is the certificates of a version of the spec.
+	certSource struct {
+		// tlsConfig is generated from the spec, only its certificates
+		// are used.
+		tlsConfig *tls.Config
+		certFiles *certFileManager
+	}
+)
+
+func newCertEventHub() *certEventHub {
+	return &certEventHub{subscribers: map[chan interface{}]struct{}{}}
+}
+
+func (h *certEventHub) publish(e *CertificateEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.events = append(h.events, e)
+	if len(h.events) > maxCertEvents {
+		h.events = h.events[len(h.events)-maxCertEvents:]
+	}
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// list returns the recent events, the oldest first.
+func (h *certEventHub) list() []*CertificateEvent {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return append([]*CertificateEvent(nil), h.events...)
+}
+
+// subscribe returns a channel of the new events, and a function to cancel
+// the subscription.
+func (h *certEventHub) subscribe() (<-chan interface{}, func()) {
+	ch := make(chan interface{}, certEventBufferSize)
+
+	h.mutex.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mutex.Unlock()
+
+	return ch, func() {
+		h.mutex.Lock()
+		delete(h.subscribers, ch)
+		h.mutex.Unlock()
+	}
+}
+
+func (s *certSelector) set(tlsConfig *tls.Config, certFiles *certFileManager) {
+	s.current.Store(&certSource{tlsConfig: tlsConfig, certFiles: certFiles})
+}
+
+// getCertificate selects the certificate in the same order as the TLS
+// config generated from the spec: the certificate files, AutoCert, and
+// then the certificates in the spec.
+func (s *certSelector) getCertificate(chi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	src := s.current.Load()
+	if src == nil {
+		return nil, fmt.Errorf("no certificates configured")
+	}
+
+	// leave the TLS-ALPN-01 challenges to AutoCertManager.
+	isChallenge := len(chi.SupportedProtos) == 1 && chi.SupportedProtos[0] == "acme-tls/1"
+	if src.certFiles != nil && !isChallenge {
+		if cert := src.certFiles.getCertificate(chi.ServerName); cert != nil {
+			return cert, nil
+		}
+	}
+
+	c := src.tlsConfig
+	if c.GetCertificate != nil && (len(c.Certificates) == 0 || chi.ServerName != "") {
+		cert, err := c.GetCertificate(chi)
+		if cert != nil || err != nil {
+			return cert, err
+		}
+	}
+
+	switch len(c.Certificates) {
+	case 0:
+		return nil, fmt.Errorf("no certificates configured")
+	case 1:
+		return &c.Certificates[0], nil
+	}
+	for i := range c.Certificates {
+		if chi.SupportsCertificate(&c.Certificates[i]) == nil {
+			return &c.Certificates[i], nil
+		}
+	}
+	return &c.Certificates[0], nil
+}
+
+// certificatesChanged returns whether the certificates of the specs are
+// different.
+func certificatesChanged(x, y *Spec) bool {
+	return x.CertBase64 != y.CertBase64 || x.KeyBase64 != y.KeyBase64 ||
+		!reflect.DeepEqual(x.Certs, y.Certs) || !reflect.DeepEqual(x.Keys, y.Keys) ||
+		!reflect.DeepEqual(x.CertFiles, y.CertFiles)
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context/contexttest"
+	"github.com/megaease/easegress/v2/pkg/option"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCertEventHub(t *testing.T) {
+	assert := assert.New(t)
+
+	h := newCertEventHub()
+	ch, cancel := h.subscribe()
+	for i := 0; i < maxCertEvents+1; i++ {
+		h.publish(&CertificateEvent{Type: CertificateUpdated, Message: fmt.Sprint(i)})
+	}
+
+	events := h.list()
+	assert.Len(events, maxCertEvents)
+	assert.Equal("1", events[0].Message)
+	assert.False(events[0].Time.IsZero())
+
+	// the events are dropped for a slow subscriber.
+	assert.Len(ch, certEventBufferSize)
+	e := (<-ch).(*CertificateEvent)
+	assert.Equal("0", e.Message)
+
+	cancel()
+	h.publish(&CertificateEvent{})
+	assert.Len(ch, certEventBufferSize-1)
+}
+
+func TestCertSelector(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &certSelector{}
+	_, err := s.getCertificate(&tls.ClientHelloInfo{})
+	assert.Error(err)
+
+	certs := map[string]tls.Certificate{}
+	for _, name := range []string{"a.example.com", "b.example.com"} {
+		certPem, keyPem := generateCert(t, name)
+		cert, err := tls.X509KeyPair(certPem, keyPem)
+		assert.NoError(err)
+		certs[name] = cert
+	}
+
+	s.set(&tls.Config{Certificates: []tls.Certificate{certs["a.example.com"], certs["b.example.com"]}}, nil)
+	for _, name := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		cert, err := s.getCertificate(&tls.ClientHelloInfo{
+			ServerName:        name,
+			SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+			SupportedVersions: []uint16{tls.VersionTLS13},
+		})
+		assert.NoError(err)
+		expected := name
+		if name == "c.example.com" {
+			expected = "a.example.com"
+		}
+		assert.Equal([]string{expected}, leafOf(t, cert).DNSNames)
+	}
+
+	s.set(&tls.Config{}, nil)
+	_, err = s.getCertificate(&tls.ClientHelloInfo{ServerName: "a.example.com"})
+	assert.Error(err)
+}
+
+func TestCertificatesHotSwap(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlConfig := func(dnsName string) string {
+		certPem, keyPem := generateCert(t, dnsName)
+		return fmt.Sprintf(`
+kind: HTTPServer
+name: test
+port: 38086
+keepAlive: true
+https: true
+certBase64: %s
+keyBase64: %s
+`, base64.StdEncoding.EncodeToString(certPem), base64.StdEncoding.EncodeToString(keyPem))
+	}
+
+	super := supervisor.NewMock(option.New(), nil, nil,
+		nil, false, nil, nil)
+	superSpec, err := super.NewSpec(yamlConfig("a.example.com"))
+	assert.NoError(err)
+
+	r := newRuntime(superSpec, &contexttest.MockedMuxMapper{})
+	r.reload(superSpec, &contexttest.MockedMuxMapper{})
+	defer r.Close()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(stateRunning, r.getState())
+
+	// the connection established before the update is kept.
+	var conns []net.Conn
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			DialContext: func(ctx stdcontext.Context, network, addr string) (net.Conn, error) {
+				conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+				if err == nil {
+					conns = append(conns, conn)
+				}
+				return conn, err
+			},
+		},
+	}
+	get := func() []string {
+		resp, err := client.Get("https://127.0.0.1:38086/")
+		assert.NoError(err)
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].DNSNames
+	}
+	assert.Equal([]string{"a.example.com"}, get())
+
+	superSpec, err = super.NewSpec(yamlConfig("b.example.com"))
+	assert.NoError(err)
+	roundNum := r.roundNum
+	r.reload(superSpec, &contexttest.MockedMuxMapper{})
+	assert.Equal(roundNum, r.roundNum)
+
+	assert.Equal([]string{"a.example.com"}, get())
+	assert.Len(conns, 1)
+
+	client.CloseIdleConnections()
+	assert.Equal([]string{"b.example.com"}, get())
+	assert.Len(conns, 2)
+
+	events := r.certEvents.list()
+	assert.Len(events, 1)
+	assert.Equal(CertificateUpdated, events[0].Type)
+	assert.Equal(certEventSourceSpec, events[0].Source)
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/inlinetemplate"
+)
+
+// defaultErrorPageContentType is the default content type of the error
+// pages.
+const defaultErrorPageContentType = "text/html; charset=utf-8"
+
+type (
+	// ErrorPageSpec describes a custom page of the error responses.
+	ErrorPageSpec struct {
+		// Codes are the status codes of the page, like 404, or the classes
+		// of the status codes, like 4xx and 5xx. An exact code takes
+		// precedence over a class.
+		Codes       []string `json:"codes" jsonschema:"required"`
+		ContentType string   `json:"contentType,omitempty"`
+		// Template is the Go template of the page, which is rendered with
+		// the data of ErrorPage. It is an html/template if the content
+		// type is HTML, so the data is escaped by the context.
+		Template string `json:"template,omitempty"`
+		// InlineTemplate is an inline template of the page, which is
+		// rendered with the request and vars.statusCode and
+		// vars.statusText, it is mutually exclusive with Template. The
+		// values are HTML-escaped if the content type is HTML.
+		InlineTemplate *inlinetemplate.Spec `json:"inlineTemplate,omitempty"`
+	}
+
+	// ErrorPage is the data to render the template of an error page.
+	ErrorPage struct {
+		StatusCode int
+		StatusText string
+		Method     string
+		Host       string
+		Path       string
+	}
+
+	// errorPages are the compiled error pages of the HTTPServer.
+	errorPages struct {
+		codes   map[int]*errorPage
+		classes map[int]*errorPage // status code / 100 -> page
+	}
+
+	errorPage struct {
+		contentType string
+		html        bool
+		template    executor
+		renderer    *inlinetemplate.Renderer
+	}
+
+	// executor is a text/template or an html/template.
+	executor interface {
+		Execute(w io.Writer, data interface{}) error
+	}
+)
+
+// isHTML returns whether the content type is HTML.
+func isHTML(contentType string) bool {
+	return strings.Contains(strings.ToLower(contentType), "html")
+}
+
+// parseErrorPageCode parses a status code or a class of the status codes,
+// class is true for the latter, and the code is the first digit.
+func parseErrorPageCode(s string) (code int, class bool, err error) {
+	if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") {
+		code, err = strconv.Atoi(s[:1])
+		if err != nil || code < 4 || code > 5 {
+			return 0, false, fmt.Errorf("invalid status code class %s", s)
+		}
+		return code, true, nil
+	}
+
+	code, err = strconv.Atoi(s)
+	if err != nil || code < 400 || code > 599 {
+		return 0, false, fmt.Errorf("invalid status code %s", s)
+	}
+	return code, false, nil
+}
+
+// Validate validates ErrorPageSpec.
+func (spec *ErrorPageSpec) Validate() error {
+	if len(spec.Codes) == 0 {
+		return fmt.Errorf("codes is empty")
+	}
+	for _, c := range spec.Codes {
+		if _, _, err := parseErrorPageCode(c); err != nil {
+			return err
+		}
+	}
+	if spec.InlineTemplate != nil {
+		if spec.Template != "" {
+			return fmt.Errorf("template and inlineTemplate are mutually exclusive")
+		}
+		return spec.InlineTemplate.Validate()
+	}
+	if spec.Template == "" {
+		return fmt.Errorf("template or inlineTemplate is required")
+	}
+	if _, err := template.New("errorPage").Parse(spec.Template); err != nil {
+		return fmt.Errorf("invalid template: %v", err)
+	}
+	return nil
+}
+
+// newErrorPages compiles the error pages, it returns nil if there is no
+// error page. The specs have been validated.
+func newErrorPages(specs []*ErrorPageSpec) *errorPages {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	ep := &errorPages{
+		codes:   map[int]*errorPage{},
+		classes: map[int]*errorPage{},
+	}
+	for _, spec := range specs {
+		page := &errorPage{contentType: spec.ContentType}
+		if page.contentType == "" {
+			page.contentType = defaultErrorPageContentType
+		}
+		page.html = isHTML(page.contentType)
+
+		switch {
+		case spec.InlineTemplate != nil:
+			page.renderer = inlinetemplate.NewRenderer(spec.InlineTemplate)
+		case page.html:
+			page.template = htmltemplate.Must(htmltemplate.New("errorPage").Parse(spec.Template))
+		default:
+			page.template = template.Must(template.New("errorPage").Parse(spec.Template))
+		}
+		for _, c := range spec.Codes {
+			code, class, _ := parseErrorPageCode(c)
+			if class {
+				ep.classes[code] = page
+			} else {
+				ep.codes[code] = page
+			}
+		}
+	}
+	return ep
+}
+
+func (ep *errorPages) find(code int) *errorPage {
+	if page := ep.codes[code]; page != nil {
+		return page
+	}
+	return ep.classes[code/100]
+}
+
+// generated returns whether the response is built by Easegress, like the
+// ones of the requests not matching any route or rejected by the filters.
+// The responses of the upstreams keep the requests sent to them.
+func generated(resp *httpprot.Response) bool {
+	return resp.Std().Request == nil
+}
+
+// render renders the error page of the response if it is an error
+// response without a body built by Easegress, the error responses of the
+// upstreams and the responses of the HEAD requests are kept as they are.
+func (ep *errorPages) render(ctx *context.Context, resp *httpprot.Response) {
+	if ep == nil || resp.StatusCode() < 400 || resp.IsStream() || resp.PayloadSize() > 0 {
+		return
+	}
+	if !generated(resp) {
+		return
+	}
+	req, _ := ctx.GetRequest(context.DefaultNamespace).(*httpprot.Request)
+	if req != nil && req.Method() == http.MethodHead {
+		return
+	}
+	page := ep.find(resp.StatusCode())
+	if page == nil {
+		return
+	}
+
+	data := &ErrorPage{
+		StatusCode: resp.StatusCode(),
+		StatusText: http.StatusText(resp.StatusCode()),
+	}
+
+	var buf bytes.Buffer
+	if page.renderer != nil {
+		// the pipeline is done, render with the request of the server.
+		ctx.UseNamespace(context.DefaultNamespace)
+		vars := inlinetemplate.Vars{
+			"statusCode": strconv.Itoa(data.StatusCode),
+			"statusText": data.StatusText,
+		}
+		values := inlinetemplate.NewContextValues(ctx, vars)
+		render := page.renderer.Render
+		if page.html {
+			render = page.renderer.RenderHTML
+		}
+		body, err := render(values)
+		if err != nil {
+			logger.Errorf("render error page of status code %d failed: %v", data.StatusCode, err)
+			return
+		}
+		buf.WriteString(body)
+	} else {
+		if req != nil {
+			data.Method, data.Host, data.Path = req.Method(), req.Host(), req.Path()
+		}
+		if err := page.template.Execute(&buf, data); err != nil {
+			logger.Errorf("render error page of status code %d failed: %v", data.StatusCode, err)
+			return
+		}
+	}
+	resp.HTTPHeader().Set("Content-Type", page.contentType)
+	resp.SetPayload(buf.Bytes())
+}
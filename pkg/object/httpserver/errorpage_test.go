@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/inlinetemplate"
+)
+
+func TestErrorPageSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&ErrorPageSpec{Codes: []string{"404", "5xx", "4XX"}, Template: "{{.StatusCode}}"}).Validate())
+	assert.Error((&ErrorPageSpec{Template: "error"}).Validate())
+	assert.Error((&ErrorPageSpec{Codes: []string{"200"}, Template: "error"}).Validate())
+	assert.Error((&ErrorPageSpec{Codes: []string{"3xx"}, Template: "error"}).Validate())
+	assert.Error((&ErrorPageSpec{Codes: []string{"abc"}, Template: "error"}).Validate())
+	assert.Error((&ErrorPageSpec{Codes: []string{"404"}, Template: "{{.Path"}).Validate())
+	assert.Error((&ErrorPageSpec{Codes: []string{"404"}}).Validate())
+	assert.NoError((&ErrorPageSpec{Codes: []string{"404"}, InlineTemplate: &inlinetemplate.Spec{Ref: "page"}}).Validate())
+	assert.Error((&ErrorPageSpec{Codes: []string{"404"}, Template: "a", InlineTemplate: &inlinetemplate.Spec{Text: "b"}}).Validate())
+
+	spec := &Spec{ErrorPages: []*ErrorPageSpec{{Codes: []string{"600"}, Template: "error"}}}
+	assert.Error(spec.Validate())
+}
+
+func TestErrorPages(t *testing.T) {
+	assert := assert.New(t)
+
+	ep := newErrorPages([]*ErrorPageSpec{
+		{Codes: []string{"5xx", "404"}, Template: "<h1>{{.StatusCode}} {{.StatusText}}</h1><p>{{.Path | html}}</p>"},
+		{Codes: []string{"503"}, ContentType: "application/json", Template: `{"code":{{.StatusCode}}}`},
+		{Codes: []string{"401"}, InlineTemplate: &inlinetemplate.Spec{Text: "${vars.statusCode} ${vars.statusText}: ${req.path | html}"}},
+		{Codes: []string{"402"}, InlineTemplate: &inlinetemplate.Spec{Text: "<p>${req.path}</p>"}},
+		{Codes: []string{"429"}, ContentType: "text/plain", Template: "{{.Path}}"},
+	})
+
+	newContext := func(method string) *context.Context {
+		ctx := context.New(nil)
+		stdr, _ := http.NewRequest(method, "http://127.0.0.1/<a>", nil)
+		req, _ := httpprot.NewRequest(stdr)
+		ctx.SetRequest(context.DefaultNamespace, req)
+		return ctx
+	}
+
+	render := func(code int, body string) *httpprot.Response {
+		ctx := newContext(http.MethodGet)
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(code)
+		if body != "" {
+			resp.SetPayload(body)
+		}
+		ep.render(ctx, resp)
+		return resp
+	}
+
+	resp := render(http.StatusNotFound, "")
+	assert.Equal("<h1>404 Not Found</h1><p>/&lt;a&gt;</p>", string(resp.RawPayload()))
+	assert.Equal(defaultErrorPageContentType, resp.HTTPHeader().Get("Content-Type"))
+
+	resp = render(http.StatusBadGateway, "")
+	assert.Equal("<h1>502 Bad Gateway</h1><p>/&lt;a&gt;</p>", string(resp.RawPayload()))
+
+	// the exact code takes precedence over the class.
+	resp = render(http.StatusServiceUnavailable, "")
+	assert.Equal(`{"code":503}`, string(resp.RawPayload()))
+	assert.Equal("application/json", resp.HTTPHeader().Get("Content-Type"))
+
+	// the inline template.
+	resp = render(http.StatusUnauthorized, "")
+	assert.Equal("401 Unauthorized: /&lt;a&gt;", string(resp.RawPayload()))
+
+	// the values are escaped in HTML by default, but not in the others.
+	resp = render(http.StatusPaymentRequired, "")
+	assert.Equal("<p>/&lt;a&gt;</p>", string(resp.RawPayload()))
+	resp = render(http.StatusTooManyRequests, "")
+	assert.Equal("/<a>", string(resp.RawPayload()))
+
+	// the error responses of the upstreams are kept.
+	ctx := newContext(http.MethodGet)
+	resp, _ = httpprot.NewResponse(&http.Response{
+		StatusCode: http.StatusNotFound,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    ctx.GetRequest(context.DefaultNamespace).(*httpprot.Request).Std(),
+	})
+	ep.render(ctx, resp)
+	assert.Empty(resp.RawPayload())
+
+	// the responses of the HEAD requests are kept.
+	ctx = newContext(http.MethodHead)
+	resp, _ = httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusNotFound)
+	ep.render(ctx, resp)
+	assert.Empty(resp.RawPayload())
+
+	// the responses with a body and the codes without a page are kept.
+	resp = render(http.StatusInternalServerError, "upstream error")
+	assert.Equal("upstream error", string(resp.RawPayload()))
+
+	resp = render(http.StatusForbidden, "")
+	assert.Empty(resp.RawPayload())
+	resp = render(http.StatusOK, "")
+	assert.Empty(resp.RawPayload())
+
+	// no error pages.
+	var nilPages *errorPages
+	nilPages.render(context.New(nil), resp)
+	assert.Nil(newErrorPages(nil))
+}
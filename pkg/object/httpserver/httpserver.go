@@ -23,6 +23,7 @@ import (
 
 	"github.com/megaease/easegress/v2/pkg/api"
 	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
 )
 
@@ -35,6 +36,8 @@ const (
 )
 
 func init() {
+	context.RegisterRuntimeData(httpprot.ResponseWriterDataKey.Decl())
+	context.RegisterRuntimeData(httpprot.RouteCapturesDataKey.Decl())
 	supervisor.Register(&HTTPServer{})
 	api.RegisterObject(&api.APIResource{
 		Category: Category,
@@ -70,6 +73,15 @@ func (hs *HTTPServer) DefaultSpec() interface{} {
 	}
 }
 
+// OverridableFields returns the fields of HTTPServer overridable on a member,
+// the listening address, the certificate files and the limits of the host.
+func (hs *HTTPServer) OverridableFields() []string {
+	return []string{
+		"address", "port", "unixSocket", "certFiles",
+		"maxConnections", "maxConnectionsPerIP", "clientMaxBodySize", "cacheSize",
+	}
+}
+
 // Init initializes HTTPServer.
 func (hs *HTTPServer) Init(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
 	hs.runtime = newRuntime(superSpec, muxMapper)
@@ -97,6 +109,31 @@ func (hs *HTTPServer) Status() *supervisor.Status {
 	}
 }
 
+// SlowRequests returns the captured slow requests, the most recent first.
+func (hs *HTTPServer) SlowRequests() interface{} {
+	return hs.runtime.mux.slowLog.requests()
+}
+
+// ClearSlowRequests removes the captured slow requests.
+func (hs *HTTPServer) ClearSlowRequests() {
+	hs.runtime.mux.slowLog.clear()
+}
+
+// Events returns the recent certificate events, the *CertificateEvent of
+// the certificates reloaded, updated or failed to load, the oldest first.
+// It is served by the events API of the objects.
+func (hs *HTTPServer) Events() interface{} {
+	return hs.runtime.certEvents.list()
+}
+
+// SubscribeEvents returns a channel of the new certificate events, and a
+// function to cancel the subscription, which must be called when the
+// subscriber stops reading the channel. The events are dropped if the
+// subscriber falls behind.
+func (hs *HTTPServer) SubscribeEvents() (<-chan interface{}, func()) {
+	return hs.runtime.certEvents.subscribe()
+}
+
 // Close closes HTTPServer.
 func (hs *HTTPServer) Close() {
 	hs.runtime.Close()
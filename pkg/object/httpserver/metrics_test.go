@@ -44,6 +44,18 @@ func newMockMetrics() *metrics {
 			"mock_httpserver_total_error_requests",
 			"the total count of http error requests",
 			mockLabels).MustCurryWith(commonLabels),
+		TotalProtocolRequests: prometheushelper.NewCounter(
+			"mock_httpserver_total_protocol_requests",
+			"the total count of http requests of each protocol",
+			append(mockLabels[:2:2], "protocol")).MustCurryWith(commonLabels),
+		TLSHandshakeFailures: prometheushelper.NewCounter(
+			"mock_httpserver_tls_handshake_failures",
+			"the total count of failed TLS handshakes of each server name",
+			append(mockLabels[:2:2], "serverName")).MustCurryWith(commonLabels),
+		RejectedConnections: prometheushelper.NewCounter(
+			"mock_httpserver_rejected_connections",
+			"the total count of rejected connections of each reason",
+			append(mockLabels[:2:2], "reason")).MustCurryWith(commonLabels),
 		RequestsDuration: prometheushelper.NewHistogram(
 			prometheus.HistogramOpts{
 				Name:    "mock_httpserver_requests_duration",
@@ -86,5 +98,30 @@ func newMockMetrics() *metrics {
 				Objectives: prometheushelper.DefaultObjectives(),
 			},
 			mockLabels).MustCurryWith(commonLabels),
+		RouteTotalRequests: prometheushelper.NewCounter(
+			"mock_httpserver_route_total_requests",
+			"the total count of http requests of a route of each status class",
+			append(mockLabels[:2:2], "route", "backend", "statusClass")).MustCurryWith(commonLabels),
+		RouteRequestsDuration: prometheushelper.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "mock_httpserver_route_requests_duration",
+				Help:    "request processing duration histogram of a route",
+				Buckets: prometheushelper.DefaultDurationBuckets(),
+			},
+			append(mockLabels[:2:2], "route", "backend")).MustCurryWith(commonLabels),
+		RouteRequestSizeBytes: prometheushelper.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "mock_httpserver_route_requests_size_bytes",
+				Help:    "a histogram of the total size of the request of a route. Includes body",
+				Buckets: prometheushelper.DefaultBodySizeBuckets(),
+			},
+			append(mockLabels[:2:2], "route", "backend")).MustCurryWith(commonLabels),
+		RouteResponseSizeBytes: prometheushelper.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "mock_httpserver_route_responses_size_bytes",
+				Help:    "a histogram of the total size of the returned response body of a route",
+				Buckets: prometheushelper.DefaultBodySizeBuckets(),
+			},
+			append(mockLabels[:2:2], "route", "backend")).MustCurryWith(commonLabels),
 	}
 }
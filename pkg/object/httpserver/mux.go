@@ -19,12 +19,14 @@ package httpserver
 
 import (
 	"bytes"
+	stdcontext "context"
 	"fmt"
 	"io"
 	"mime"
 	"net/http"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"text/template"
@@ -50,15 +52,24 @@ import (
 )
 
 const (
+	backpressureCheckInterval = 10 * time.Millisecond
+
 	defaultAccessLogFormat = "[{{Time}}] [{{RemoteAddr}} {{RealIP}} {{Method}} {{URI}} {{Proto}} {{StatusCode}}] [{{Duration}} rx:{{ReqSize}}B tx:{{RespSize}}B] [{{Tags}}]"
 )
 
 type (
 	mux struct {
-		httpStat *httpstat.HTTPStat
-		topN     *httpstat.TopN
+		httpStat   *httpstat.HTTPStat
+		topN       *httpstat.TopN
+		routeStats *routeStats
+		slowLog    *slowLog
+		observers  *requestObservers
 
 		inst atomic.Value // *muxInstance
+
+		// backpressureRejected is the number of requests rejected because
+		// of backpressure.
+		backpressureRejected uint64
 	}
 
 	muxInstance struct {
@@ -66,8 +77,12 @@ type (
 		spec               *Spec
 		httpStat           *httpstat.HTTPStat
 		topN               *httpstat.TopN
+		routeStats         *routeStats
+		slowLog            *slowLog
+		observers          *requestObservers
 		metrics            *metrics
 		accessLogFormatter *accessLogFormatter
+		errorPages         *errorPages
 
 		muxMapper context.MuxMapper
 
@@ -77,11 +92,14 @@ type (
 		ipFilter *ipfilter.IPFilter
 
 		router routers.Router
+
+		backpressureRejected *uint64
 	}
 
 	cachedRoute struct {
-		code  int
-		route routers.Route
+		code   int
+		route  routers.Route
+		params routers.Params
 	}
 
 	accessLogFormatter struct {
@@ -133,17 +151,25 @@ func newMux(httpStat *httpstat.HTTPStat, topN *httpstat.TopN,
 	metrics *metrics, mapper context.MuxMapper,
 ) *mux {
 	m := &mux{
-		httpStat: httpStat,
-		topN:     topN,
+		httpStat:   httpStat,
+		topN:       topN,
+		routeStats: &routeStats{},
+		slowLog:    &slowLog{},
+		observers:  &requestObservers{},
 	}
 
 	m.inst.Store(&muxInstance{
-		spec:      &Spec{},
-		tracer:    tracing.NoopTracer,
-		muxMapper: mapper,
-		httpStat:  httpStat,
-		topN:      topN,
-		metrics:   metrics,
+		spec:       &Spec{},
+		tracer:     tracing.NoopTracer,
+		muxMapper:  mapper,
+		httpStat:   httpStat,
+		topN:       topN,
+		routeStats: m.routeStats,
+		slowLog:    m.slowLog,
+		observers:  m.observers,
+		metrics:    metrics,
+
+		backpressureRejected: &m.backpressureRejected,
 	})
 
 	return m
@@ -182,13 +208,23 @@ func (m *mux) reload(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
 		muxMapper:          muxMapper,
 		httpStat:           m.httpStat,
 		topN:               m.topN,
+		routeStats:         m.routeStats,
+		slowLog:            m.slowLog,
+		observers:          m.observers,
 		metrics:            oldInst.metrics,
 		ipFilter:           ipfilter.New(spec.IPFilter),
 		tracer:             tracer,
 		accessLogFormatter: newAccessLogFormatter(spec.AccessLogFormat),
+		errorPages:         newErrorPages(spec.ErrorPages),
+
+		backpressureRejected: &m.backpressureRejected,
 	}
 	spec.Rules.Init()
 	inst.router = routers.Create(routerKind, spec.Rules)
+	if !spec.RouteMetrics {
+		m.routeStats.reset()
+	}
+	m.slowLog.configure(spec.SlowLog)
 
 	if spec.CacheSize > 0 {
 		arc, err := lru.NewARC(int(spec.CacheSize))
@@ -229,17 +265,30 @@ func buildFailureResponse(ctx *context.Context, statusCode int) *httpprot.Respon
 	return resp
 }
 
+// deadlineExceeded reports whether the deadline of the request, which is
+// set by the pipeline timeout, is exceeded.
+func deadlineExceeded(ctx *context.Context) bool {
+	req, ok := ctx.GetRequest(context.DefaultNamespace).(*httpprot.Request)
+	return ok && req.Context().Err() == stdcontext.DeadlineExceeded
+}
+
 func (mi *muxInstance) sendResponse(ctx *context.Context, stdw http.ResponseWriter) (int, uint64, http.Header) {
 	var resp *httpprot.Response
 	if v := ctx.GetResponse(context.DefaultNamespace); v == nil {
-		logger.Errorf("%s: response is nil", mi.superSpec.Name())
-		resp = buildFailureResponse(ctx, http.StatusServiceUnavailable)
+		if deadlineExceeded(ctx) {
+			logger.Errorf("%s: deadline exceeded before the response is built", mi.superSpec.Name())
+			resp = buildFailureResponse(ctx, http.StatusGatewayTimeout)
+		} else {
+			logger.Errorf("%s: response is nil", mi.superSpec.Name())
+			resp = buildFailureResponse(ctx, http.StatusServiceUnavailable)
+		}
 	} else if r, ok := v.(*httpprot.Response); !ok {
 		logger.Errorf("%s: expect an HTTP response", mi.superSpec.Name())
 		resp = buildFailureResponse(ctx, http.StatusServiceUnavailable)
 	} else {
 		resp = r
 	}
+	mi.errorPages.render(ctx, resp)
 
 	// Send the response
 	header := stdw.Header()
@@ -254,7 +303,7 @@ func (mi *muxInstance) sendResponse(ctx *context.Context, stdw http.ResponseWrit
 	} else {
 		writer = stdw
 	}
-	respBodySize, _ := io.Copy(writer, resp.GetPayload())
+	respBodySize, _ := readers.Copy(writer, resp.GetPayload())
 
 	return resp.StatusCode(), uint64(respBodySize) + uint64(resp.MetaSize()), header
 }
@@ -309,8 +358,8 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 
 	span := mi.tracer.NewSpanForHTTP(stdr.Context(), mi.superSpec.Name(), stdr)
 
-	ctx := context.New(span)
-	ctx.SetData("HTTP_RESPONSE_WRITER", stdw)
+	ctx := context.Acquire(span)
+	httpprot.ResponseWriterDataKey.Set(ctx, stdw)
 
 	// httpprot.NewRequest never returns an error.
 	req, _ := httpprot.NewRequest(stdr)
@@ -325,13 +374,20 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	routeCtx := routers.NewContext(req)
 	route := mi.search(routeCtx)
 	ctx.SetRoute(route.route)
+	if len(routeCtx.Params.Keys) > 0 {
+		httpprot.RouteCapturesDataKey.Set(ctx, routeCtx.GetCaptures())
+	}
 
 	var respHeader http.Header
 
 	defer func() {
-		metric, _ := ctx.GetData("HTTP_METRIC").(*httpstat.Metric)
+		metric, _ := httpstat.MetricDataKey.Get(ctx)
 
+		// the context of a hijacked connection could still be referenced
+		// by the goroutines serving the connection, so it is not released.
+		release := metric == nil
 		if metric == nil {
+			firstByte := fasttime.Since(startAt)
 			statusCode, respSize, header := mi.sendResponse(ctx, stdw)
 			ctx.Finish()
 
@@ -341,6 +397,7 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 
 			metric = &httpstat.Metric{
 				StatusCode: statusCode,
+				FirstByte:  firstByte,
 				ReqSize:    uint64(reqMetaSize) + uint64(body.BytesRead()),
 				RespSize:   respSize,
 			}
@@ -352,8 +409,18 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 		metric.Duration = fasttime.Since(startAt)
 		topN.Stat(metric)
 		mi.httpStat.Stat(metric)
+		mi.metrics.TotalProtocolRequests.WithLabelValues(stdr.Proto).Inc()
 		if route.code == 0 {
 			mi.exportPrometheusMetrics(metric, route.route.GetBackend())
+			path, backend := routePath(route.route), route.route.GetBackend()
+			if mi.spec.RouteMetrics {
+				mi.routeStats.stat(path, backend, metric)
+				mi.exportRouteMetrics(metric, path, backend)
+			}
+			mi.observers.observe(ctx, path, backend, metric)
+		}
+		if mi.slowLog.isSlow(metric.Duration) {
+			mi.captureSlowRequest(ctx, stdr, req, route, metric, respHeader, startAt)
 		}
 
 		span.End()
@@ -377,10 +444,14 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 			}
 			return mi.accessLogFormatter.format(log)
 		})
+
+		if release {
+			ctx.Release()
+		}
 	}()
 
 	if route.code != 0 {
-		logger.Errorf("%s: status code of result route for [%s %s]: %d", mi.superSpec.Name(), req.Method(), req.RequestURI, route.code)
+		mi.requestLogger(req, "").Errorf("%s: status code of result route for [%s %s]: %d", mi.superSpec.Name(), req.Method(), req.RequestURI, route.code)
 		buildFailureResponse(ctx, route.code)
 		return
 	}
@@ -388,35 +459,55 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	backend := route.route.GetBackend()
 	handler, ok := mi.muxMapper.GetHandler(backend)
 	if !ok {
-		logger.Errorf("%s: backend(Pipeline) %q for [%s %s] not found", mi.superSpec.Name(), req.Method(), req.RequestURI, backend)
+		mi.requestLogger(req, backend).Errorf("%s: backend(Pipeline) %q for [%s %s] not found", mi.superSpec.Name(), req.Method(), req.RequestURI, backend)
 		buildFailureResponse(ctx, http.StatusServiceUnavailable)
 		return
 	}
 	logger.Debugf("%s: the matched backend(Pipeline) for [%s %s] is %q", mi.superSpec.Name(), req.Method(), req.RequestURI, backend)
 
+	if !mi.waitBackpressure(stdr, handler) {
+		mi.requestLogger(req, backend).Warnf("%s: backend(Pipeline) %q for [%s %s] is under backpressure", mi.superSpec.Name(), backend, req.Method(), req.RequestURI)
+		atomic.AddUint64(mi.backpressureRejected, 1)
+		resp := buildFailureResponse(ctx, http.StatusServiceUnavailable)
+		if ra := mi.spec.Backpressure.RetryAfter; ra > 0 {
+			resp.HTTPHeader().Set("Retry-After", strconv.Itoa(ra))
+		}
+		return
+	}
+
 	route.route.Rewrite(routeCtx)
 	if mi.spec.XForwardedFor {
 		appendXForwardedFor(req)
 	}
 
+	globalFilter := mi.getGlobalFilter()
+
 	maxBodySize := route.route.GetClientMaxBodySize()
 	if maxBodySize == 0 {
 		maxBodySize = mi.spec.ClientMaxBodySize
 	}
-	err := req.FetchPayload(maxBodySize)
+	streamRequest, streamResponse := mi.streamPayload(handler, globalFilter)
+	if streamResponse {
+		httpprot.StreamResponseDataKey.Set(ctx, true)
+	}
+	var err error
+	if streamRequest {
+		err = req.FetchStreamPayload(maxBodySize)
+	} else {
+		err = req.FetchPayload(maxBodySize)
+	}
 	if err == httpprot.ErrRequestEntityTooLarge {
-		logger.Errorf("%s: %s, you may need to increase 'clientMaxBodySize' or set it to -1", mi.superSpec.Name(), err.Error())
+		mi.requestLogger(req, backend).Errorf("%s: %s, you may need to increase 'clientMaxBodySize' or set it to -1", mi.superSpec.Name(), err.Error())
 		buildFailureResponse(ctx, http.StatusRequestEntityTooLarge)
 		return
 	}
 	if err != nil {
-		logger.Errorf("%s: failed to read request body: %v", mi.superSpec.Name(), err)
+		mi.requestLogger(req, backend).Errorf("%s: failed to read request body: %v", mi.superSpec.Name(), err)
 		buildFailureResponse(ctx, http.StatusBadRequest)
 		return
 	}
 
 	// global filter
-	globalFilter := mi.getGlobalFilter()
 	if globalFilter == nil {
 		handler.Handle(ctx)
 	} else {
@@ -424,6 +515,75 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	}
 }
 
+// streamPayload returns whether to stream the payloads of the request and
+// the response, which is true if StreamBody is enabled and no filter of the
+// handler or the global filter needs the whole payload.
+func (mi *muxInstance) streamPayload(handler context.Handler, globalFilter *globalfilter.GlobalFilter) (request, response bool) {
+	if !mi.spec.StreamBody {
+		return false, false
+	}
+
+	needRequest, needResponse := true, true
+	if pn, ok := handler.(context.PayloadNeeder); ok {
+		needRequest, needResponse = pn.NeedPayload()
+	}
+	if globalFilter != nil {
+		req, resp := globalFilter.NeedPayload()
+		needRequest = needRequest || req
+		needResponse = needResponse || resp
+	}
+	return !needRequest, !needResponse
+}
+
+// requestLogger returns a logger with the fields of the request, so that the
+// logs of a request could be correlated in the json format.
+func (mi *muxInstance) requestLogger(req *httpprot.Request, backend string) *logger.Logger {
+	var fields []interface{}
+	if backend != "" {
+		fields = append(fields, logger.FieldPipeline, backend)
+	}
+	if id := req.HTTPHeader().Get("X-Request-Id"); id != "" {
+		fields = append(fields, logger.FieldRequestID, id)
+	}
+	return logger.Module(Kind).With(fields...)
+}
+
+// waitBackpressure waits for the backpressure of the handler to go away, it
+// returns false if the backpressure lasts longer than the max wait time or
+// the client gives up.
+func (mi *muxInstance) waitBackpressure(stdr *http.Request, handler context.Handler) bool {
+	if mi.spec.Backpressure == nil {
+		return true
+	}
+	bp, ok := handler.(context.Backpressurer)
+	if !ok || !bp.Backpressure() {
+		return true
+	}
+
+	maxWait, _ := time.ParseDuration(mi.spec.Backpressure.MaxWait)
+	if maxWait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+	ticker := time.NewTicker(backpressureCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			return !bp.Backpressure()
+		case <-stdr.Context().Done():
+			return false
+		case <-ticker.C:
+			if !bp.Backpressure() {
+				return true
+			}
+		}
+	}
+}
+
 func (mi *muxInstance) search(context *routers.RouteContext) *cachedRoute {
 	req := context.Request
 	ip := req.RealIP()
@@ -437,13 +597,14 @@ func (mi *muxInstance) search(context *routers.RouteContext) *cachedRoute {
 	// headers, any queries, and any ipFilters.
 	r := mi.getRouteFromCache(req)
 	if r != nil {
+		context.Params = r.params
 		return r
 	}
 
 	mi.router.Search(context)
 
 	if route := context.Route; context.Route != nil {
-		cr := &cachedRoute{code: 0, route: route}
+		cr := &cachedRoute{code: 0, route: route, params: context.Params}
 		if context.Cacheable {
 			mi.putRouteToCache(req, cr)
 		}
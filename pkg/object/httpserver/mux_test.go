@@ -24,8 +24,10 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"testing/iotest"
+	"time"
 
 	"github.com/megaease/easegress/v2/pkg/cluster"
 	"github.com/megaease/easegress/v2/pkg/logger"
@@ -227,6 +229,196 @@ rules:
 	assert.Equal(http.StatusBadRequest, stdw.Code)
 }
 
+func TestRequestObserver(t *testing.T) {
+	assert := assert.New(t)
+
+	mm := &contexttest.MockedMuxMapper{}
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), newMockMetrics(), mm)
+	hs := &HTTPServer{runtime: &runtime{mux: m}}
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 8080
+rules:
+- paths:
+  - pathPrefix: /abc
+    backend: abc-pipeline
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	m.reload(superSpec, mm)
+
+	var paths []string
+	var metric *httpstat.Metric
+	hs.AddRequestObserver("test", func(ctx *context.Context, path, backend string, mt *httpstat.Metric) {
+		paths = append(paths, path+" "+backend)
+		metric = mt
+	})
+
+	// the requests not matching a route are not observed.
+	stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/xyz", http.NoBody)
+	m.ServeHTTP(httptest.NewRecorder(), stdr)
+	assert.Empty(paths)
+
+	stdr, _ = http.NewRequest(http.MethodPost, "http://www.megaease.com/abc/1", strings.NewReader("hello"))
+	m.ServeHTTP(httptest.NewRecorder(), stdr)
+	assert.Equal([]string{"/abc abc-pipeline"}, paths)
+	assert.Equal(http.StatusServiceUnavailable, metric.StatusCode)
+	assert.Greater(metric.ReqSize, uint64(len("hello")))
+
+	// the observers survive the reloads.
+	m.reload(superSpec, mm)
+	m.ServeHTTP(httptest.NewRecorder(), stdr)
+	assert.Len(paths, 2)
+
+	hs.RemoveRequestObserver("test")
+	m.ServeHTTP(httptest.NewRecorder(), stdr)
+	assert.Len(paths, 2)
+	m.close()
+}
+
+type backpressureHandler struct {
+	contexttest.MockedHandler
+	backpressure atomic.Bool
+}
+
+func (h *backpressureHandler) Backpressure() bool {
+	return h.backpressure.Load()
+}
+
+func TestServeHTTPBackpressure(t *testing.T) {
+	assert := assert.New(t)
+
+	mm := &contexttest.MockedMuxMapper{}
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), newMockMetrics(), mm)
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+backpressure:
+  maxWait: 50ms
+  retryAfter: 5
+rules:
+- paths:
+  - path: /abc
+    backend: abc-pipeline
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	assert.NotPanics(func() { m.reload(superSpec, mm) })
+
+	handler := &backpressureHandler{}
+	handler.MockedHandle = func(ctx *context.Context) string {
+		resp, _ := httpprot.NewResponse(nil)
+		ctx.SetResponse(context.DefaultNamespace, resp)
+		return ""
+	}
+	mm.MockedGetHandler = func(name string) (context.Handler, bool) {
+		return handler, true
+	}
+
+	serve := func() *httptest.ResponseRecorder {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/abc", http.NoBody)
+		stdw := httptest.NewRecorder()
+		m.ServeHTTP(stdw, stdr)
+		return stdw
+	}
+
+	// no backpressure
+	assert.Equal(http.StatusOK, serve().Code)
+
+	// backpressure lasts longer than maxWait
+	handler.backpressure.Store(true)
+	stdw := serve()
+	assert.Equal(http.StatusServiceUnavailable, stdw.Code)
+	assert.Equal("5", stdw.Header().Get("Retry-After"))
+	assert.Equal(uint64(1), atomic.LoadUint64(&m.backpressureRejected))
+
+	// backpressure goes away while waiting
+	time.AfterFunc(10*time.Millisecond, func() { handler.backpressure.Store(false) })
+	assert.Equal(http.StatusOK, serve().Code)
+	assert.Equal(uint64(1), atomic.LoadUint64(&m.backpressureRejected))
+	m.close()
+}
+
+type payloadNeederHandler struct {
+	contexttest.MockedHandler
+	request, response bool
+}
+
+func (h *payloadNeederHandler) NeedPayload() (bool, bool) {
+	return h.request, h.response
+}
+
+func TestServeHTTPStreamBody(t *testing.T) {
+	assert := assert.New(t)
+
+	mm := &contexttest.MockedMuxMapper{}
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), newMockMetrics(), mm)
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+streamBody: true
+clientMaxBodySize: 4
+rules:
+- paths:
+  - path: /abc
+    backend: abc-pipeline
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	assert.NotPanics(func() { m.reload(superSpec, mm) })
+
+	var isStream, streamResponse bool
+	handler := &payloadNeederHandler{}
+	handler.MockedHandle = func(ctx *context.Context) string {
+		req := ctx.GetInputRequest().(*httpprot.Request)
+		isStream = req.IsStream()
+		streamResponse, _ = httpprot.StreamResponseDataKey.Get(ctx)
+		resp, _ := httpprot.NewResponse(nil)
+		ctx.SetResponse(context.DefaultNamespace, resp)
+		return ""
+	}
+	mm.MockedGetHandler = func(name string) (context.Handler, bool) {
+		return handler, true
+	}
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		stdr, _ := http.NewRequest(http.MethodPost, "http://www.megaease.com/abc", strings.NewReader(body))
+		stdw := httptest.NewRecorder()
+		m.ServeHTTP(stdw, stdr)
+		return stdw
+	}
+
+	// no filter needs the payloads.
+	assert.Equal(http.StatusOK, serve("123").Code)
+	assert.True(isStream)
+	assert.True(streamResponse)
+
+	// the size of a streamed body is still limited.
+	assert.Equal(http.StatusRequestEntityTooLarge, serve("123456").Code)
+
+	// a filter needs the request payload.
+	handler.request = true
+	assert.Equal(http.StatusOK, serve("123").Code)
+	assert.False(isStream)
+	assert.True(streamResponse)
+
+	handler.request, handler.response = false, true
+	assert.Equal(http.StatusOK, serve("123").Code)
+	assert.True(isStream)
+	assert.False(streamResponse)
+	m.close()
+}
+
 func TestMuxInstanceSearch(t *testing.T) {
 	assert := assert.New(t)
 
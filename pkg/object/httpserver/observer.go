@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"sync"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot/httpstat"
+)
+
+type (
+	// RequestObserver is called after the HTTPServer sends the response
+	// of a request matching a route, with the path and the backend of the
+	// route, and the final metric of the request, including the sizes of
+	// the request and the response.
+	RequestObserver func(ctx *context.Context, path, backend string, metric *httpstat.Metric)
+
+	// requestObservers are the observers of an HTTPServer, they are kept
+	// in the mux, so they survive the reloads.
+	requestObservers struct {
+		m sync.Map // key -> RequestObserver
+	}
+)
+
+// AddRequestObserver adds an observer of the requests handled by the
+// HTTPServer, the observer with the same key is replaced.
+func (hs *HTTPServer) AddRequestObserver(key string, observer RequestObserver) {
+	hs.runtime.mux.observers.m.Store(key, observer)
+}
+
+// RemoveRequestObserver removes the observer of the key.
+func (hs *HTTPServer) RemoveRequestObserver(key string) {
+	hs.runtime.mux.observers.m.Delete(key)
+}
+
+func (o *requestObservers) observe(ctx *context.Context, path, backend string, metric *httpstat.Metric) {
+	o.m.Range(func(k, v interface{}) bool {
+		v.(RequestObserver)(ctx, path, backend, metric)
+		return true
+	})
+}
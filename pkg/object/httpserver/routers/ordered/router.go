@@ -20,6 +20,7 @@ package ordered
 
 import (
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/megaease/easegress/v2/pkg/logger"
@@ -47,10 +48,11 @@ var kind = &routers.Kind{
 	Description: "Ordered",
 
 	CreateInstance: func(rules routers.Rules) routers.Router {
+		rules = rules.SortByPriority()
 		muxRules := make([]*muxRule, len(rules))
 		for i, rule := range rules {
 			paths := make([]*muxPath, len(rule.Paths))
-			for j, path := range rule.Paths {
+			for j, path := range rule.Paths.SortByPriority() {
 				paths[j] = newMuxPath(path)
 			}
 
@@ -108,6 +110,25 @@ func (mp *muxPath) matchPath(path string) bool {
 	return false
 }
 
+// setParams sets the capture groups of the path regexp to the context, the
+// key of an unnamed group is its index.
+func (mp *muxPath) setParams(context *routers.RouteContext) {
+	names := mp.pathRE.SubexpNames()
+	if len(names) <= 1 {
+		return
+	}
+
+	matches := mp.pathRE.FindStringSubmatch(context.Path)
+	for i := 1; i < len(matches); i++ {
+		key := names[i]
+		if key == "" {
+			key = strconv.Itoa(i)
+		}
+		context.Params.Keys = append(context.Params.Keys, key)
+		context.Params.Values = append(context.Params.Values, matches[i])
+	}
+}
+
 func (mp *muxPath) Rewrite(context *routers.RouteContext) {
 	if mp.RewriteTarget == "" {
 		return
@@ -153,6 +174,9 @@ func (r *orderedRouter) Search(context *routers.RouteContext) {
 
 			if mp.Match(context) {
 				context.Route = mp
+				if mp.pathRE != nil {
+					mp.setParams(context)
+				}
 				return
 			}
 		}
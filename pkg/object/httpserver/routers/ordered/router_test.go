@@ -278,3 +278,43 @@ func TestRewrite(t *testing.T) {
 		assert.Equal("/bafo", req.Path())
 	})
 }
+
+func TestSearchPriority(t *testing.T) {
+	assert := assert.New(t)
+
+	rules := routers.Rules{
+		&routers.Rule{
+			Paths: []*routers.Path{
+				{Path: "/api/test", Methods: []string{http.MethodGet}},
+			},
+		},
+		&routers.Rule{
+			Priority: 10,
+			Paths: []*routers.Path{
+				{PathPrefix: "/api"},
+				{PathRegexp: `^/users/(?P<id>\d+)/(\w+)$`, Priority: 1},
+			},
+		},
+	}
+
+	rules.Init()
+	router := kind.CreateInstance(rules).(*orderedRouter)
+
+	search := func(path string) *routers.RouteContext {
+		stdr, _ := http.NewRequest(http.MethodGet, path, nil)
+		req, _ := httpprot.NewRequest(stdr)
+		ctx := routers.NewContext(req)
+		router.Search(ctx)
+		return ctx
+	}
+
+	ctx := search("/api/test")
+	assert.Equal("/api", ctx.Route.(*muxPath).PathPrefix)
+
+	ctx = search("/users/123/profile")
+	assert.Equal(1, ctx.Route.(*muxPath).Priority)
+	assert.Equal(map[string]string{"id": "123", "2": "profile"}, ctx.GetCaptures())
+
+	// the original order of the rules is not changed.
+	assert.Equal(0, rules[0].Priority)
+}
@@ -112,7 +112,7 @@ var kind = &routers.Kind{
 			rules: make([]*muxRule, len(rules)),
 		}
 
-		for i, rule := range rules {
+		for i, rule := range rules.SortByPriority() {
 			mr := newMuxRule(rule)
 			router.rules[i] = mr
 		}
@@ -513,7 +513,7 @@ func newMuxRule(rule *routers.Rule) *muxRule {
 		pathCache: make(map[string]paths),
 	}
 
-	for _, path := range rule.Paths {
+	for _, path := range rule.Paths.SortByPriority() {
 		seg := patNextSegment(path.Path)
 
 		if seg.nodeType == ntStatic {
@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/megaease/easegress/v2/pkg/logger"
@@ -58,6 +59,9 @@ type Rule struct {
 	HostRegexp   string         `json:"hostRegexp,omitempty" jsonschema:"format=regexp"`
 	Hosts        []Host         `json:"hosts,omitempty"`
 	Paths        Paths          `json:"paths,omitempty"`
+	// Priority of the rule, rules with higher priority are matched first,
+	// and rules with the same priority are matched in order.
+	Priority int `json:"priority,omitempty"`
 
 	ipFilter *ipfilter.IPFilter
 }
@@ -76,6 +80,10 @@ type Path struct {
 	Queries           Queries        `json:"queries,omitempty"`
 	MatchAllHeader    bool           `json:"matchAllHeader,omitempty"`
 	MatchAllQuery     bool           `json:"matchAllQuery,omitempty"`
+	// Priority of the path in the rule, paths with higher priority are
+	// matched first, and paths with the same priority are matched in the
+	// order of the router.
+	Priority int `json:"priority,omitempty"`
 
 	ipFilter             *ipfilter.IPFilter
 	method               MethodType
@@ -95,6 +103,8 @@ type Header struct {
 	Key    string   `json:"key" jsonschema:"required"`
 	Values []string `json:"values,omitempty" jsonschema:"uniqueItems=true"`
 	Regexp string   `json:"regexp,omitempty" jsonschema:"format=regexp"`
+	// Present requires the key to be present if true, or absent if false.
+	Present *bool `json:"present,omitempty"`
 
 	re *regexp.Regexp
 }
@@ -104,6 +114,8 @@ type Query struct {
 	Key    string   `json:"key" jsonschema:"required"`
 	Values []string `json:"values,omitempty" jsonschema:"uniqueItems=true"`
 	Regexp string   `json:"regexp,omitempty" jsonschema:"format=regexp"`
+	// Present requires the key to be present if true, or absent if false.
+	Present *bool `json:"present,omitempty"`
 
 	re *regexp.Regexp
 }
@@ -115,6 +127,26 @@ func (rules Rules) Init() {
 	}
 }
 
+// SortByPriority returns a copy of the rules sorted by priority in
+// descending order, the order of rules with the same priority is kept.
+func (rules Rules) SortByPriority() Rules {
+	sorted := append(Rules(nil), rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+	return sorted
+}
+
+// SortByPriority returns a copy of the paths sorted by priority in
+// descending order, the order of paths with the same priority is kept.
+func (paths Paths) SortByPriority() Paths {
+	sorted := append(Paths(nil), paths...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+	return sorted
+}
+
 // Init is the initialization portal for Rule.
 func (rule *Rule) Init() {
 	if len(rule.Host) > 0 {
@@ -301,8 +333,14 @@ func (hs Headers) init() {
 // Validate validates Headers.
 func (hs Headers) Validate() error {
 	for _, h := range hs {
+		if h.Present != nil {
+			if !*h.Present && (len(h.Values) > 0 || h.Regexp != "") {
+				return fmt.Errorf("values or regexp are specified for absent key: %s", h.Key)
+			}
+			continue
+		}
 		if len(h.Values) == 0 && h.Regexp == "" {
-			return fmt.Errorf("both of values and regexp are empty for key: %s", h.Key)
+			return fmt.Errorf("all of values, regexp and present are empty for key: %s", h.Key)
 		}
 	}
 	return nil
@@ -316,6 +354,10 @@ func (hs Headers) Match(headers http.Header, matchAll bool) bool {
 
 	if matchAll {
 		for _, h := range hs {
+			if h.Present != nil && *h.Present != hasHeader(headers, h.Key) {
+				return false
+			}
+
 			v := headers.Get(h.Key)
 			if len(h.Values) > 0 && !stringtool.StrInSlice(v, h.Values) {
 				return false
@@ -327,6 +369,15 @@ func (hs Headers) Match(headers http.Header, matchAll bool) bool {
 		}
 	} else {
 		for _, h := range hs {
+			if h.Present != nil {
+				if *h.Present != hasHeader(headers, h.Key) {
+					continue
+				}
+				if len(h.Values) == 0 && h.Regexp == "" {
+					return true
+				}
+			}
+
 			v := headers.Get(h.Key)
 			if stringtool.StrInSlice(v, h.Values) {
 				return true
@@ -341,6 +392,10 @@ func (hs Headers) Match(headers http.Header, matchAll bool) bool {
 	return matchAll
 }
 
+func hasHeader(headers http.Header, key string) bool {
+	return len(headers.Values(key)) > 0
+}
+
 func (qs Queries) init() {
 	for _, q := range qs {
 		if q.Regexp != "" {
@@ -352,8 +407,14 @@ func (qs Queries) init() {
 // Validate validates Queries.
 func (qs Queries) Validate() error {
 	for _, q := range qs {
+		if q.Present != nil {
+			if !*q.Present && (len(q.Values) > 0 || q.Regexp != "") {
+				return fmt.Errorf("values or regexp are specified for absent key: %s", q.Key)
+			}
+			continue
+		}
 		if len(q.Values) == 0 && q.Regexp == "" {
-			return fmt.Errorf("both of values and regexp are empty for key: %s", q.Key)
+			return fmt.Errorf("all of values, regexp and present are empty for key: %s", q.Key)
 		}
 	}
 	return nil
@@ -367,6 +428,10 @@ func (qs Queries) Match(query url.Values, matchAll bool) bool {
 
 	if matchAll {
 		for _, q := range qs {
+			if q.Present != nil && *q.Present != query.Has(q.Key) {
+				return false
+			}
+
 			v := query.Get(q.Key)
 			if len(q.Values) > 0 && !stringtool.StrInSlice(v, q.Values) {
 				return false
@@ -378,6 +443,15 @@ func (qs Queries) Match(query url.Values, matchAll bool) bool {
 		}
 	} else {
 		for _, q := range qs {
+			if q.Present != nil {
+				if *q.Present != query.Has(q.Key) {
+					continue
+				}
+				if len(q.Values) == 0 && q.Regexp == "" {
+					return true
+				}
+			}
+
 			v := query.Get(q.Key)
 			if stringtool.StrInSlice(v, q.Values) {
 				return true
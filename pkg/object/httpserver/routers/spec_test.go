@@ -19,6 +19,7 @@ package routers
 
 import (
 	"net/http"
+	"net/url"
 	"os"
 	"testing"
 
@@ -741,3 +742,64 @@ func TestQueriesMatch(t *testing.T) {
 		assert.Equal(test.result, result)
 	}
 }
+
+func TestSortByPriority(t *testing.T) {
+	assert := assert.New(t)
+
+	rules := Rules{{Host: "a"}, {Host: "b", Priority: 1}, {Host: "c"}, {Host: "d", Priority: 1}}
+	sorted := rules.SortByPriority()
+	hosts := []string{}
+	for _, r := range sorted {
+		hosts = append(hosts, r.Host)
+	}
+	assert.Equal([]string{"b", "d", "a", "c"}, hosts)
+	assert.Equal("a", rules[0].Host)
+
+	paths := Paths{{Path: "/a", Priority: -1}, {Path: "/b"}, {Path: "/c", Priority: 2}}
+	sortedPaths := paths.SortByPriority()
+	assert.Equal("/c", sortedPaths[0].Path)
+	assert.Equal("/b", sortedPaths[1].Path)
+	assert.Equal("/a", sortedPaths[2].Path)
+}
+
+func TestPresenceMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	present, absent := true, false
+
+	headers := Headers{
+		{Key: "X-Api-Version", Present: &present},
+		{Key: "X-Debug", Present: &absent},
+	}
+	assert.NoError(headers.Validate())
+	headers.init()
+
+	assert.True(headers.Match(http.Header{"X-Api-Version": {""}}, true))
+	assert.False(headers.Match(http.Header{"X-Api-Version": {"v2"}, "X-Debug": {"1"}}, true))
+	assert.False(headers.Match(http.Header{}, true))
+	assert.True(headers.Match(http.Header{}, false))
+	assert.False(headers.Match(http.Header{"X-Debug": {"1"}}, false))
+
+	headers = Headers{{Key: "X-Api-Version", Present: &present, Values: []string{"v2"}}}
+	assert.NoError(headers.Validate())
+	assert.True(headers.Match(http.Header{"X-Api-Version": {"v2"}}, true))
+	assert.False(headers.Match(http.Header{"X-Api-Version": {"v1"}}, false))
+
+	headers = Headers{{Key: "X-Debug", Present: &absent, Values: []string{"1"}}}
+	assert.Error(headers.Validate())
+
+	queries := Queries{
+		{Key: "debug", Present: &present},
+		{Key: "version", Present: &absent},
+	}
+	assert.NoError(queries.Validate())
+	queries.init()
+
+	assert.True(queries.Match(url.Values{"debug": {""}}, true))
+	assert.False(queries.Match(url.Values{"debug": {""}, "version": {"v2"}}, true))
+	assert.True(queries.Match(url.Values{}, false))
+	assert.False(queries.Match(url.Values{"version": {"v2"}}, false))
+
+	queries = Queries{{Key: "version", Present: &absent, Regexp: "^v"}}
+	assert.Error(queries.Validate())
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/v2/pkg/object/httpserver/routers"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot/httpstat"
+)
+
+type (
+	// routeStats is the statistics of the routes. A route is identified by
+	// its path and backend, so its statistics survive the reloads of the
+	// HTTPServer.
+	routeStats struct {
+		m sync.Map // routeKey -> *httpstat.HTTPStat
+	}
+
+	routeKey struct {
+		path    string
+		backend string
+	}
+
+	// RouteStatus is the status of a route.
+	RouteStatus struct {
+		Path    string `json:"path"`
+		Backend string `json:"backend"`
+		*httpstat.Status
+		// StatusClasses is the count of the responses of each status class
+		// like 2xx and 5xx in the statistic window.
+		StatusClasses map[string]uint64 `json:"statusClasses"`
+	}
+)
+
+// routePath returns the path of the route, which is its exact path, path
+// prefix or path regexp, or * if the route matches all paths.
+func routePath(route routers.Route) string {
+	if p := route.GetExactPath(); p != "" {
+		return p
+	}
+	if p := route.GetPathPrefix(); p != "" {
+		return p
+	}
+	if p := route.GetPathRegexp(); p != "" {
+		return p
+	}
+	return "*"
+}
+
+// statusClass returns the class of the status code, e.g. 2xx.
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+func (rs *routeStats) stat(path, backend string, metric *httpstat.Metric) {
+	key := routeKey{path: path, backend: backend}
+
+	var hs *httpstat.HTTPStat
+	if v, loaded := rs.m.Load(key); loaded {
+		hs = v.(*httpstat.HTTPStat)
+	} else {
+		v, _ = rs.m.LoadOrStore(key, httpstat.New())
+		hs = v.(*httpstat.HTTPStat)
+	}
+	hs.Stat(metric)
+}
+
+// reset removes the statistics of all routes.
+func (rs *routeStats) reset() {
+	rs.m.Range(func(k, v interface{}) bool {
+		rs.m.Delete(k)
+		return true
+	})
+}
+
+// status returns the status of the routes, sorted by path and backend.
+func (rs *routeStats) status() []*RouteStatus {
+	var statuses []*RouteStatus
+	rs.m.Range(func(k, v interface{}) bool {
+		key := k.(routeKey)
+		status := v.(*httpstat.HTTPStat).Status()
+
+		classes := map[string]uint64{}
+		for code, count := range status.Codes {
+			classes[statusClass(code)] += count
+		}
+
+		statuses = append(statuses, &RouteStatus{
+			Path:          key.path,
+			Backend:       key.backend,
+			Status:        status,
+			StatusClasses: classes,
+		})
+		return true
+	})
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Path != statuses[j].Path {
+			return statuses[i].Path < statuses[j].Path
+		}
+		return statuses[i].Backend < statuses[j].Backend
+	})
+	return statuses
+}
+
+func (mi *muxInstance) exportRouteMetrics(stat *httpstat.Metric, path, backend string) {
+	labels := prometheus.Labels{
+		"route":   path,
+		"backend": backend,
+	}
+	mi.metrics.RouteRequestsDuration.With(labels).Observe(float64(stat.Duration.Milliseconds()))
+	mi.metrics.RouteRequestSizeBytes.With(labels).Observe(float64(stat.ReqSize))
+	mi.metrics.RouteResponseSizeBytes.With(labels).Observe(float64(stat.RespSize))
+
+	labels["statusClass"] = statusClass(stat.StatusCode)
+	mi.metrics.RouteTotalRequests.With(labels).Inc()
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot/httpstat"
+)
+
+func TestStatusClass(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("2xx", statusClass(http.StatusOK))
+	assert.Equal("4xx", statusClass(http.StatusNotFound))
+	assert.Equal("5xx", statusClass(http.StatusBadGateway))
+	assert.Equal("unknown", statusClass(0))
+}
+
+func TestRouteStats(t *testing.T) {
+	assert := assert.New(t)
+
+	rs := &routeStats{}
+	rs.stat("/api", "pipeline-api", &httpstat.Metric{StatusCode: 200, Duration: 10 * time.Millisecond, ReqSize: 10, RespSize: 20})
+	rs.stat("/api", "pipeline-api", &httpstat.Metric{StatusCode: 503, Duration: 30 * time.Millisecond, ReqSize: 10, RespSize: 5})
+	rs.stat("/", "pipeline-default", &httpstat.Metric{StatusCode: 404, Duration: time.Millisecond})
+
+	statuses := rs.status()
+	assert.Len(statuses, 2)
+
+	assert.Equal("/", statuses[0].Path)
+	assert.Equal("pipeline-default", statuses[0].Backend)
+	assert.Equal(uint64(1), statuses[0].Count)
+	assert.Equal(map[string]uint64{"4xx": 1}, statuses[0].StatusClasses)
+
+	assert.Equal("/api", statuses[1].Path)
+	assert.Equal(uint64(2), statuses[1].Count)
+	assert.Equal(uint64(1), statuses[1].ErrCount)
+	assert.Equal(uint64(30), statuses[1].Max)
+	assert.Equal(uint64(20), statuses[1].ReqSize)
+	assert.Equal(map[string]uint64{"2xx": 1, "5xx": 1}, statuses[1].StatusClasses)
+}
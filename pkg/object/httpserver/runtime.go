@@ -20,17 +20,23 @@ package httpserver
 import (
 	"bytes"
 	stdcontext "context"
+	"crypto/tls"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"reflect"
+	"strconv"
 	"sync/atomic"
 	"time"
 
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
+	"github.com/megaease/easegress/v2/pkg/cluster"
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/graceupdate"
 	"github.com/megaease/easegress/v2/pkg/logger"
@@ -40,11 +46,13 @@ import (
 	"github.com/megaease/easegress/v2/pkg/util/filterwriter"
 	"github.com/megaease/easegress/v2/pkg/util/limitlistener"
 	"github.com/megaease/easegress/v2/pkg/util/prometheushelper"
+	"github.com/megaease/easegress/v2/pkg/util/proxyprotocol"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
 	defaultKeepAliveTimeout = 60 * time.Second
+	defaultDrainTimeout     = 30 * time.Second
 
 	checkFailedTimeout = 10 * time.Second
 
@@ -80,10 +88,17 @@ type (
 		spec      *Spec
 		server    *http.Server
 		server3   *http3.Server
+		quicTr    *quic.Transport
+		certFiles *certFileManager
 		mux       *mux
 		roundNum  uint64
 		eventChan chan interface{}
 
+		sessionTickets *sessionTicketManager
+		handshakes     *handshakeStat
+		certs          certSelector
+		certEvents     *certEventHub
+
 		// status
 		state atomic.Value // stateType
 		err   atomic.Value // error
@@ -104,6 +119,18 @@ type (
 
 		*httpstat.Status
 		TopN []*httpstat.Item `json:"topN"`
+		// Routes is the status of the routes if routeMetrics is enabled.
+		Routes []*RouteStatus `json:"routes,omitempty"`
+
+		// BackpressureRejected is the number of requests rejected because
+		// the pipelines are under backpressure.
+		BackpressureRejected uint64 `json:"backpressureRejected,omitempty"`
+		// SlowRequests is the number of the slow requests ever captured if
+		// slowLog is enabled.
+		SlowRequests uint64 `json:"slowRequests,omitempty"`
+		// TLS is the status of the TLS handshakes, it is nil if there's
+		// no handshake.
+		TLS *TLSStatus `json:"tls,omitempty"`
 	}
 )
 
@@ -116,6 +143,8 @@ func newRuntime(superSpec *supervisor.Spec, muxMapper context.MuxMapper) *runtim
 	}
 
 	r.metrics = r.newMetrics(r.superSpec.Name())
+	r.handshakes = &handshakeStat{export: r.exportTLSHandshake}
+	r.certEvents = newCertEventHub()
 	r.mux = newMux(r.httpStat, r.topN, r.metrics, muxMapper)
 	r.setState(stateNil)
 	r.setError(errNil)
@@ -145,6 +174,11 @@ func (r *runtime) Status() *Status {
 		Error:  r.getError().Error(),
 		Status: status,
 		TopN:   r.topN.Status(),
+		Routes: r.mux.routeStats.status(),
+
+		BackpressureRejected: atomic.LoadUint64(&r.mux.backpressureRejected),
+		SlowRequests:         r.mux.slowLog.totalCaptured(),
+		TLS:                  r.handshakes.status(),
 	}
 }
 
@@ -200,7 +234,11 @@ func (r *runtime) reload(nextSuperSpec *supervisor.Spec, muxMapper context.MuxMa
 			r.closeServer()
 			r.startServer()
 		} else {
+			changed := r.spec.HTTPS && certificatesChanged(r.spec, nextSpec)
 			r.spec = nextSpec
+			if changed {
+				r.reloadCertificates()
+			}
 		}
 	}
 }
@@ -243,6 +281,15 @@ func (r *runtime) needRestartServer(nextSpec *Spec) bool {
 	x.IPFilter, y.IPFilter = nil, nil
 	x.Rules, y.Rules = nil, nil
 
+	// The certificates are swapped without restarting the HTTPS server.
+	if x.HTTPS && y.HTTPS {
+		x.CertBase64, y.CertBase64 = "", ""
+		x.KeyBase64, y.KeyBase64 = "", ""
+		x.Certs, y.Certs = nil, nil
+		x.Keys, y.Keys = nil, nil
+		x.CertFiles, y.CertFiles = nil, nil
+	}
+
 	// The update of rules need not to shutdown server.
 	return !reflect.DeepEqual(x, y)
 }
@@ -252,23 +299,64 @@ func (r *runtime) startServer() {
 	r.setState(stateRunning)
 	r.setError(nil)
 
-	if r.spec.HTTP3 {
-		r.startHTTP3Server()
-	} else {
+	if r.spec.HTTPS && len(r.spec.CertFiles) > 0 {
+		certFiles, err := newCertFileManager(r.superSpec.Name(), r.spec.CertFiles, r.certEvents.publish)
+		if err != nil {
+			logger.Errorf("httpserver %s failed to load certificate files: %v", r.superSpec.Name(), err)
+			r.setState(stateFailed)
+			r.setError(err)
+			return
+		}
+		r.certFiles = certFiles
+	}
+
+	if st := r.spec.SessionTickets; r.spec.HTTPS && st != nil && !st.Disabled {
+		var cls cluster.Cluster
+		if st.Shared {
+			cls = r.superSpec.Super().Cluster()
+		}
+		r.sessionTickets = newSessionTicketManager(r.superSpec.Name(), st, cls)
+	}
+
+	if !r.spec.HTTP3 {
+		r.startHTTP1And2Server()
+		return
+	}
+
+	r.startHTTP3Server()
+	if r.spec.HTTP3Options != nil && r.spec.HTTP3Options.AltSvc && r.getState() == stateRunning {
 		r.startHTTP1And2Server()
 	}
 }
 
+// tlsConfig returns the TLS config of the server, it must be called after
+// the spec is validated.
+func (r *runtime) tlsConfig() *tls.Config {
+	certs, _ := r.spec.tlsConfig()
+	r.certs.set(certs, r.certFiles)
+
+	tlsConfig := certs.Clone()
+	tlsConfig.Certificates = nil
+	tlsConfig.GetCertificate = r.certs.getCertificate
+	if r.sessionTickets != nil {
+		r.sessionTickets.wrapTLSConfig(tlsConfig)
+	}
+	r.handshakes.wrapTLSConfig(tlsConfig)
+	return tlsConfig
+}
+
 func (r *runtime) startHTTP3Server() {
-	tlsConfig, _ := r.spec.tlsConfig()
+	tlsConfig := r.tlsConfig()
 
 	keepAliveTimeout := defaultKeepAliveTimeout
 	if r.spec.KeepAliveTimeout != "" {
 		keepAliveTimeout, _ = time.ParseDuration(r.spec.KeepAliveTimeout)
 	}
 
+	addr := fmt.Sprintf("%s:%d", r.spec.Address, r.spec.Port)
 	r.server3 = &http3.Server{
-		Addr:      fmt.Sprintf("%s:%d", r.spec.Address, r.spec.Port),
+		Addr:      addr,
+		Port:      int(r.spec.Port),
 		Handler:   r.mux,
 		TLSConfig: tlsConfig,
 		QuicConfig: &quic.Config{
@@ -279,12 +367,27 @@ func (r *runtime) startHTTP3Server() {
 		r.server3.QuicConfig.KeepAlivePeriod = keepAliveTimeout
 	}
 
+	tr := &quic.Transport{}
+	if opts := r.spec.HTTP3Options; opts != nil {
+		r.server3.QuicConfig.Allow0RTT = opts.Allow0RTT
+		tr.ConnectionIDLength = opts.ConnectionIDLength
+	}
+
+	ln, err := listenQUIC(tr, addr, tlsConfig, r.server3.QuicConfig)
+	if err != nil {
+		logger.Errorf("httpserver %s failed to listen: %v", r.superSpec.Name(), err)
+		r.setState(stateFailed)
+		r.setError(err)
+		return
+	}
+	r.quicTr = tr
+
 	// to avoid data race
 	roundNum := r.roundNum
 	srv := r.server3
 
 	go func() {
-		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		if err := srv.ServeListener(ln); err != http.ErrServerClosed {
 			r.eventChan <- &eventServeFailed{
 				err:      err,
 				roundNum: roundNum,
@@ -293,6 +396,48 @@ func (r *runtime) startHTTP3Server() {
 	}()
 }
 
+func listenQUIC(tr *quic.Transport, addr string, tlsConfig *tls.Config, quicConfig *quic.Config) (*quic.EarlyListener, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	tr.Conn = conn
+	ln, err := tr.ListenEarly(http3.ConfigureTLSConfig(tlsConfig), quicConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ln, nil
+}
+
+// reloadCertificates swaps the certificates of the running server with
+// the ones in the spec, the old ones are kept if the new ones fail to load.
+func (r *runtime) reloadCertificates() {
+	name := r.superSpec.Name()
+
+	certs, err := r.spec.tlsConfig()
+	var certFiles *certFileManager
+	if err == nil && len(r.spec.CertFiles) > 0 {
+		certFiles, err = newCertFileManager(name, r.spec.CertFiles, r.certEvents.publish)
+	}
+	if err != nil {
+		logger.Errorf("httpserver %s: update certificates failed, keep using the old ones: %v", name, err)
+		r.certEvents.publish(&CertificateEvent{Type: CertificateFailed, Source: certEventSourceSpec, Message: err.Error()})
+		return
+	}
+
+	if r.certFiles != nil {
+		r.certFiles.close()
+	}
+	r.certFiles = certFiles
+	r.certs.set(certs, certFiles)
+
+	logger.Infof("httpserver %s: certificates updated", name)
+	r.certEvents.publish(&CertificateEvent{Type: CertificateUpdated, Source: certEventSourceSpec})
+}
+
 func (r *runtime) startHTTP1And2Server() {
 	keepAliveTimeout := defaultKeepAliveTimeout
 	if r.spec.KeepAliveTimeout != "" {
@@ -308,7 +453,37 @@ func (r *runtime) startHTTP1And2Server() {
 		IdleTimeout: keepAliveTimeout,
 		ErrorLog:    log.New(fw, "", log.LstdFlags),
 	}
+	// the timeouts are validated, an empty one is parsed to 0, which
+	// means no timeout.
+	r.server.ReadTimeout, _ = time.ParseDuration(r.spec.ReadTimeout)
+	r.server.ReadHeaderTimeout, _ = time.ParseDuration(r.spec.ReadHeaderTimeout)
+	r.server.WriteTimeout, _ = time.ParseDuration(r.spec.WriteTimeout)
 	r.server.SetKeepAlivesEnabled(r.spec.KeepAlive)
+	if r.spec.HTTPS {
+		r.server.ConnState = r.exportTLSHandshakeFailure
+	}
+
+	if n := r.spec.MaxRequestsPerConnection; n > 0 {
+		r.server.ConnContext = func(ctx stdcontext.Context, c net.Conn) stdcontext.Context {
+			return stdcontext.WithValue(ctx, connRequestsKey{}, new(uint32))
+		}
+		r.server.Handler = limitRequestsPerConn(r.server.Handler, n)
+	}
+
+	if r.spec.HTTP3 {
+		// advertise the HTTP/3 server in responses.
+		srv3 := r.server3
+		next := r.server.Handler
+		r.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			srv3.SetQuicHeaders(w.Header())
+			next.ServeHTTP(w, req)
+		})
+	}
+
+	h2s := r.http2Server(keepAliveTimeout)
+	if r.spec.HTTP2 != nil && r.spec.HTTP2.H2C {
+		r.server.Handler = h2c.NewHandler(r.server.Handler, h2s)
+	}
 
 	listener, err := gnet.Listen("tcp", fmt.Sprintf("%s:%d", r.spec.Address, r.spec.Port))
 	if err != nil {
@@ -317,30 +492,86 @@ func (r *runtime) startHTTP1And2Server() {
 		r.setError(err)
 		return
 	}
+	if r.spec.ProxyProtocol {
+		listener = proxyprotocol.NewListener(listener, proxyprotocol.DefaultReadHeaderTimeout)
+	}
+	if r.spec.MaxConnectionsPerIP > 0 {
+		listener = limitlistener.NewPerIPLimitListener(listener, r.spec.MaxConnectionsPerIP, func(string) {
+			r.metrics.RejectedConnections.WithLabelValues("maxConnectionsPerIP").Inc()
+		})
+	}
+
 	limitListener := limitlistener.NewLimitListener(listener, r.spec.MaxConnections)
 	r.limitListener = limitListener
+	listeners := []net.Listener{limitListener}
+
+	if r.spec.UnixSocket != nil {
+		unixListener, err := r.listenUnix(r.spec.UnixSocket)
+		if err != nil {
+			limitListener.Close()
+			logger.Errorf("httpserver %s failed to listen on unix socket: %v", r.superSpec.Name(), err)
+			r.setState(stateFailed)
+			r.setError(err)
+			return
+		}
+		listeners = append(listeners, unixListener)
+	}
 
-	// to avoid data race
-	spec := r.spec
-	roundNum := r.roundNum
 	srv := r.server
+	if r.spec.HTTPS {
+		srv.TLSConfig = r.tlsConfig()
+		// ConfigureServer never fails here, as the TLS config
+		// generated by Easegress always has a valid cipher suite.
+		http2.ConfigureServer(srv, h2s)
+	}
 
-	go func() {
-		var err error
-		if spec.HTTPS {
-			tlsConfig, _ := spec.tlsConfig()
-			srv.TLSConfig = tlsConfig
-			err = srv.ServeTLS(limitListener, "", "")
-		} else {
-			err = srv.Serve(limitListener)
+	for _, l := range listeners {
+		go r.serve(srv, l, r.spec.HTTPS, r.roundNum)
+	}
+}
+
+func (r *runtime) serve(srv *http.Server, listener net.Listener, https bool, roundNum uint64) {
+	var err error
+	if https {
+		err = srv.ServeTLS(listener, "", "")
+	} else {
+		err = srv.Serve(listener)
+	}
+	if err != http.ErrServerClosed {
+		r.eventChan <- &eventServeFailed{
+			err:      err,
+			roundNum: roundNum,
 		}
-		if err != http.ErrServerClosed {
-			r.eventChan <- &eventServeFailed{
-				err:      err,
-				roundNum: roundNum,
+	}
+}
+
+type connRequestsKey struct{}
+
+// limitRequestsPerConn closes the connections after they serve n requests,
+// by the 'Connection: close' header for HTTP/1.1, and GOAWAY for HTTP/2.
+func limitRequestsPerConn(next http.Handler, n uint32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if count, ok := req.Context().Value(connRequestsKey{}).(*uint32); ok {
+			if atomic.AddUint32(count, 1) >= n {
+				w.Header().Set("Connection", "close")
 			}
 		}
-	}()
+		next.ServeHTTP(w, req)
+	})
+}
+
+// http2Server creates the HTTP/2 server, which is used for both h2 and h2c.
+func (r *runtime) http2Server(idleTimeout time.Duration) *http2.Server {
+	h2s := &http2.Server{IdleTimeout: idleTimeout}
+
+	if spec := r.spec.HTTP2; spec != nil {
+		h2s.MaxConcurrentStreams = spec.MaxConcurrentStreams
+		h2s.MaxReadFrameSize = spec.MaxReadFrameSize
+		h2s.MaxUploadBufferPerConnection = spec.MaxUploadBufferPerConnection
+		h2s.MaxUploadBufferPerStream = spec.MaxUploadBufferPerStream
+	}
+
+	return h2s
 }
 
 func (r *runtime) closeServer() {
@@ -349,18 +580,42 @@ func (r *runtime) closeServer() {
 		if err != nil {
 			logger.Warnf("shutdown http3 server %s failed: %v", r.superSpec.Name(), err)
 		}
-		return
+		if r.quicTr != nil {
+			r.quicTr.Close()
+		}
+		r.server3, r.quicTr = nil, nil
 	}
 
 	if r.server != nil {
+		drainTimeout := defaultDrainTimeout
+		if r.spec != nil && r.spec.DrainTimeout != "" {
+			drainTimeout, _ = time.ParseDuration(r.spec.DrainTimeout)
+		}
+
+		// Shutdown stops accepting new connections, closes idle connections,
+		// sends 'Connection: close' or GOAWAY on active connections, and waits
+		// for the in-flight requests until the drain timeout.
 		// NOTE: It's safe to shutdown serve failed server.
-		ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 30*time.Second)
+		ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), drainTimeout)
 		defer cancel()
 		err := r.server.Shutdown(ctx)
 		if err != nil {
 			logger.Warnf("shutdown http1/2 server %s failed: %v",
 				r.superSpec.Name(), err)
+			// tear down the connections still active after draining.
+			r.server.Close()
 		}
+		r.server = nil
+	}
+
+	if r.certFiles != nil {
+		r.certFiles.close()
+		r.certFiles = nil
+	}
+
+	if r.sessionTickets != nil {
+		r.sessionTickets.close()
+		r.sessionTickets = nil
 	}
 }
 
@@ -379,6 +634,9 @@ func (r *runtime) checkFailed(timeout time.Duration) {
 
 func (r *runtime) handleEventCheckFailed(e *eventCheckFailed) {
 	if r.getState() == stateFailed {
+		// close the servers which have started successfully, as we are
+		// going to start all of them again.
+		r.closeServer()
 		r.startServer()
 	}
 }
@@ -423,6 +681,15 @@ func (s *Status) ToMetrics(service string) []*easemonitor.Metrics {
 		results = append(results, metrics...)
 	}
 
+	for _, route := range s.Routes {
+		metrics := route.ToMetrics(service)
+		for _, m := range metrics {
+			m.Resource = "SERVER_ROUTE"
+			m.URL = route.Path
+		}
+		results = append(results, metrics...)
+	}
+
 	return results
 }
 
@@ -432,6 +699,11 @@ type (
 		TotalRequests               *prometheus.CounterVec
 		TotalResponses              *prometheus.CounterVec
 		TotalErrorRequests          *prometheus.CounterVec
+		TotalProtocolRequests       *prometheus.CounterVec
+		TLSHandshakeFailures        *prometheus.CounterVec
+		TLSHandshakes               *prometheus.CounterVec
+		TLSHandshakeDuration        prometheus.ObserverVec
+		RejectedConnections         *prometheus.CounterVec
 		RequestsDuration            prometheus.ObserverVec
 		RequestSizeBytes            prometheus.ObserverVec
 		ResponseSizeBytes           prometheus.ObserverVec
@@ -439,6 +711,11 @@ type (
 		RequestSizeBytesPercentage  prometheus.ObserverVec
 		ResponseSizeBytesPercentage prometheus.ObserverVec
 
+		RouteTotalRequests     *prometheus.CounterVec
+		RouteRequestsDuration  prometheus.ObserverVec
+		RouteRequestSizeBytes  prometheus.ObserverVec
+		RouteResponseSizeBytes prometheus.ObserverVec
+
 		M1            *prometheus.GaugeVec
 		M5            *prometheus.GaugeVec
 		M15           *prometheus.GaugeVec
@@ -493,6 +770,29 @@ func (r *runtime) newMetrics(name string) *metrics {
 			"httpserver_total_error_requests",
 			"the total count of http error requests",
 			httpserverLabels).MustCurryWith(commonLabels),
+		TotalProtocolRequests: prometheushelper.NewCounter(
+			"httpserver_total_protocol_requests",
+			"the total count of http requests of each protocol",
+			append(httpserverLabels[:5:5], "protocol")).MustCurryWith(commonLabels),
+		TLSHandshakeFailures: prometheushelper.NewCounter(
+			"httpserver_tls_handshake_failures",
+			"the total count of failed TLS handshakes of each server name",
+			append(httpserverLabels[:5:5], "serverName")).MustCurryWith(commonLabels),
+		TLSHandshakes: prometheushelper.NewCounter(
+			"httpserver_tls_handshakes",
+			"the total count of completed TLS handshakes, resumed or not",
+			append(httpserverLabels[:5:5], "resumed")).MustCurryWith(commonLabels),
+		TLSHandshakeDuration: prometheushelper.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "httpserver_tls_handshake_duration",
+				Help:    "TLS handshake duration histogram in milliseconds",
+				Buckets: []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000},
+			},
+			append(httpserverLabels[:5:5], "resumed")).MustCurryWith(commonLabels),
+		RejectedConnections: prometheushelper.NewCounter(
+			"httpserver_rejected_connections",
+			"the total count of rejected connections of each reason",
+			append(httpserverLabels[:5:5], "reason")).MustCurryWith(commonLabels),
 		RequestsDuration: prometheushelper.NewHistogram(
 			prometheus.HistogramOpts{
 				Name:    "httpserver_requests_duration",
@@ -535,6 +835,31 @@ func (r *runtime) newMetrics(name string) *metrics {
 				Objectives: prometheushelper.DefaultObjectives(),
 			},
 			httpserverLabels).MustCurryWith(commonLabels),
+		RouteTotalRequests: prometheushelper.NewCounter(
+			"httpserver_route_total_requests",
+			"the total count of http requests of a route of each status class",
+			append(httpserverLabels[:5:5], "route", "backend", "statusClass")).MustCurryWith(commonLabels),
+		RouteRequestsDuration: prometheushelper.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "httpserver_route_requests_duration",
+				Help:    "request processing duration histogram of a route",
+				Buckets: prometheushelper.DefaultDurationBuckets(),
+			},
+			append(httpserverLabels[:5:5], "route", "backend")).MustCurryWith(commonLabels),
+		RouteRequestSizeBytes: prometheushelper.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "httpserver_route_requests_size_bytes",
+				Help:    "a histogram of the total size of the request of a route. Includes body",
+				Buckets: prometheushelper.DefaultBodySizeBuckets(),
+			},
+			append(httpserverLabels[:5:5], "route", "backend")).MustCurryWith(commonLabels),
+		RouteResponseSizeBytes: prometheushelper.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "httpserver_route_responses_size_bytes",
+				Help:    "a histogram of the total size of the returned response body of a route",
+				Buckets: prometheushelper.DefaultBodySizeBuckets(),
+			},
+			append(httpserverLabels[:5:5], "route", "backend")).MustCurryWith(commonLabels),
 		M1: prometheushelper.NewGauge(
 			"httpserver_m1",
 			"QPS (exponentially-weighted moving average) in last 1 minute",
@@ -622,6 +947,31 @@ func (r *runtime) newMetrics(name string) *metrics {
 	}
 }
 
+// exportTLSHandshakeFailure is the ConnState hook of the HTTPS server, it
+// counts the connections closed before the TLS handshake completes.
+func (r *runtime) exportTLSHandshakeFailure(conn net.Conn, state http.ConnState) {
+	if state != http.StateClosed {
+		return
+	}
+
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return
+	}
+
+	cs := tlsConn.ConnectionState()
+	if !cs.HandshakeComplete {
+		r.metrics.TLSHandshakeFailures.WithLabelValues(cs.ServerName).Inc()
+	}
+}
+
+// exportTLSHandshake exports a completed TLS handshake which takes d.
+func (r *runtime) exportTLSHandshake(d time.Duration, resumed bool) {
+	label := strconv.FormatBool(resumed)
+	r.metrics.TLSHandshakes.WithLabelValues(label).Inc()
+	r.metrics.TLSHandshakeDuration.WithLabelValues(label).Observe(float64(d) / float64(time.Millisecond))
+}
+
 func (r *runtime) exportState(state stateType) {
 	if state == stateRunning {
 		r.metrics.Health.WithLabelValues().Set(1)
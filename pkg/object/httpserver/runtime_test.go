@@ -18,13 +18,34 @@
 package httpserver
 
 import (
+	"bufio"
+	stdcontext "context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/context/contexttest"
 	"github.com/megaease/easegress/v2/pkg/option"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/quic-go/quic-go/http3"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
 )
 
 func TestNewRuntim(t *testing.T) {
@@ -98,3 +119,357 @@ https: false
 
 	//
 }
+
+func TestH2C(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 38083
+keepAlive: true
+https: false
+http2:
+  h2c: true
+  maxConcurrentStreams: 10
+`
+	super := supervisor.NewMock(option.New(), nil, nil,
+		nil, false, nil, nil)
+	superSpec, err := super.NewSpec(yamlConfig)
+	assert.NoError(err)
+
+	r := newRuntime(superSpec, &contexttest.MockedMuxMapper{})
+	r.reload(superSpec, &contexttest.MockedMuxMapper{})
+	defer r.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(uint32(10), r.http2Server(time.Second).MaxConcurrentStreams)
+
+	// HTTP/2 with prior knowledge
+	client := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx stdcontext.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+	resp, err := client.Get("http://127.0.0.1:38083/")
+	assert.NoError(err)
+	assert.Equal(2, resp.ProtoMajor)
+	resp.Body.Close()
+
+	// HTTP/1.1 still works
+	resp, err = http.Get("http://127.0.0.1:38083/")
+	assert.NoError(err)
+	assert.Equal(1, resp.ProtoMajor)
+	resp.Body.Close()
+}
+
+// generateCert generates a self-signed certificate for 127.0.0.1 and
+// dnsNames, and returns the certificate and key in PEM format.
+func generateCert(t *testing.T, dnsNames ...string) (certPem, keyPem []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     dnsNames,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certPem = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return certPem, keyPem
+}
+
+func TestHTTP3AltSvc(t *testing.T) {
+	assert := assert.New(t)
+
+	certPem, keyPem := generateCert(t)
+	cert := base64.StdEncoding.EncodeToString(certPem)
+	key := base64.StdEncoding.EncodeToString(keyPem)
+	yamlConfig := fmt.Sprintf(`
+kind: HTTPServer
+name: test
+port: 38084
+keepAlive: true
+https: true
+http3: true
+http3Options:
+  altSvc: true
+  allow0RTT: true
+  connectionIDLength: 8
+certBase64: %s
+keyBase64: %s
+`, cert, key)
+	super := supervisor.NewMock(option.New(), nil, nil,
+		nil, false, nil, nil)
+	superSpec, err := super.NewSpec(yamlConfig)
+	assert.NoError(err)
+
+	r := newRuntime(superSpec, &contexttest.MockedMuxMapper{})
+	r.reload(superSpec, &contexttest.MockedMuxMapper{})
+	defer r.Close()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(stateRunning, r.getState())
+	assert.True(r.server3.QuicConfig.Allow0RTT)
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := client.Get("https://127.0.0.1:38084/")
+	assert.NoError(err)
+	assert.Contains(resp.Header.Get("Alt-Svc"), `h3=":38084"`)
+	resp.Body.Close()
+
+	rt := &http3.RoundTripper{TLSClientConfig: tlsConfig}
+	defer rt.Close()
+	client = &http.Client{Transport: rt}
+	resp, err = client.Get("https://127.0.0.1:38084/")
+	assert.NoError(err)
+	assert.Equal(3, resp.ProtoMajor)
+	resp.Body.Close()
+}
+
+func TestProxyProtocol(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 38086
+keepAlive: true
+https: false
+proxyProtocol: true
+ipFilter:
+  blockByDefault: true
+  allowIPs: [1.1.1.1]
+`
+	super := supervisor.NewMock(option.New(), nil, nil,
+		nil, false, nil, nil)
+	superSpec, err := super.NewSpec(yamlConfig)
+	assert.NoError(err)
+
+	r := newRuntime(superSpec, &contexttest.MockedMuxMapper{})
+	r.reload(superSpec, &contexttest.MockedMuxMapper{})
+	defer r.Close()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(stateRunning, r.getState())
+
+	get := func(clientIP string) int {
+		conn, err := net.Dial("tcp", "127.0.0.1:38086")
+		assert.NoError(err)
+		defer conn.Close()
+
+		fmt.Fprintf(conn, "PROXY TCP4 %s 127.0.0.1 12345 38086\r\n", clientIP)
+		fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		assert.NoError(err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// there's no rule, so a not found is returned if the IP is allowed.
+	assert.Equal(http.StatusNotFound, get("1.1.1.1"))
+	assert.Equal(http.StatusForbidden, get("2.2.2.2"))
+
+	// connections without the header are rejected.
+	resp, err := http.Get("http://127.0.0.1:38086/")
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestUnixSocket(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "easegress.sock")
+	// a stale socket file should be removed.
+	l, err := net.Listen("unix", path)
+	assert.NoError(err)
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	yamlConfig := fmt.Sprintf(`
+kind: HTTPServer
+name: test
+port: 38087
+keepAlive: true
+https: false
+unixSocket:
+  path: %s
+  mode: "0600"
+`, path)
+	super := supervisor.NewMock(option.New(), nil, nil,
+		nil, false, nil, nil)
+	superSpec, err := super.NewSpec(yamlConfig)
+	assert.NoError(err)
+
+	r := newRuntime(superSpec, &contexttest.MockedMuxMapper{})
+	r.reload(superSpec, &contexttest.MockedMuxMapper{})
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(stateRunning, r.getState(), r.getError())
+
+	fi, err := os.Stat(path)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0o600), fi.Mode().Perm())
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx stdcontext.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+	}
+	for _, url := range []string{"http://unix/", "http://127.0.0.1:38087/"} {
+		resp, err := client.Get(url)
+		assert.NoError(err)
+		resp.Body.Close()
+		assert.Equal(http.StatusNotFound, resp.StatusCode)
+	}
+
+	r.Close()
+	time.Sleep(100 * time.Millisecond)
+	_, err = os.Stat(path)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestConnectionLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 38088
+keepAlive: true
+https: false
+readHeaderTimeout: 200ms
+maxConnectionsPerIP: 2
+maxRequestsPerConnection: 2
+`
+	super := supervisor.NewMock(option.New(), nil, nil,
+		nil, false, nil, nil)
+	superSpec, err := super.NewSpec(yamlConfig)
+	assert.NoError(err)
+
+	r := newRuntime(superSpec, &contexttest.MockedMuxMapper{})
+	r.reload(superSpec, &contexttest.MockedMuxMapper{})
+	defer r.Close()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(stateRunning, r.getState())
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", "127.0.0.1:38088")
+		assert.NoError(err)
+		return conn
+	}
+	get := func(conn net.Conn) (*http.Response, error) {
+		fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	// the connection is closed after serving 2 requests.
+	conn := dial()
+	resp, err := get(conn)
+	assert.NoError(err)
+	assert.False(resp.Close)
+	resp, err = get(conn)
+	assert.NoError(err)
+	assert.True(resp.Close)
+	conn.Close()
+
+	// one of the three connections is rejected.
+	conns := []net.Conn{}
+	for i := 0; i < 3; i++ {
+		conn := dial()
+		defer conn.Close()
+		if _, err = get(conn); err == nil {
+			conns = append(conns, conn)
+		}
+	}
+	assert.Len(conns, 2)
+	assert.Equal(1.0, testutil.ToFloat64(r.metrics.RejectedConnections.WithLabelValues("maxConnectionsPerIP")))
+
+	// slow clients are closed after readHeaderTimeout.
+	conn2 := conns[1]
+	conn2.Write([]byte("GET / HTTP/1.1\r\n"))
+	conn2.SetReadDeadline(time.Now().Add(time.Second))
+	// ReadAll returns nil error if the connection is closed by the server,
+	// and a timeout error otherwise.
+	_, err = io.ReadAll(conn2)
+	assert.NoError(err)
+}
+
+func TestDrainTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 38089
+keepAlive: true
+https: false
+drainTimeout: 200ms
+rules:
+- paths:
+  - pathPrefix: /
+    backend: slow
+`
+	super := supervisor.NewMock(option.New(), nil, nil,
+		nil, false, nil, nil)
+	superSpec, err := super.NewSpec(yamlConfig)
+	assert.NoError(err)
+
+	mm := &contexttest.MockedMuxMapper{}
+	mm.MockedGetHandler = func(name string) (context.Handler, bool) {
+		return &contexttest.MockedHandler{
+			MockedHandle: func(ctx *context.Context) string {
+				delay, _ := time.ParseDuration(ctx.GetInputRequest().(*httpprot.Request).Path()[1:])
+				time.Sleep(delay)
+				return ""
+			},
+		}, true
+	}
+
+	r := newRuntime(superSpec, mm)
+	r.reload(superSpec, mm)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(stateRunning, r.getState())
+
+	results := make(chan error, 2)
+	for _, delay := range []string{"100ms", "1s"} {
+		go func(delay string) {
+			resp, err := http.Get("http://127.0.0.1:38089/" + delay)
+			if err == nil {
+				resp.Body.Close()
+				if !resp.Close {
+					err = fmt.Errorf("connection is not closed")
+				}
+			}
+			results <- err
+		}(delay)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	r.Close()
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(elapsed, 200*time.Millisecond)
+	assert.Less(elapsed, time.Second)
+
+	// the fast request completes, and the slow one is broken after the
+	// drain timeout.
+	assert.NoError(<-results)
+	assert.Error(<-results)
+}
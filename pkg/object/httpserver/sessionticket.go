@@ -0,0 +1,317 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
+)
+
+const (
+	defaultSessionTicketRotationInterval = 24 * time.Hour
+	// maxSessionTicketKeys is the number of ticket keys kept, the newest
+	// one encrypts the new tickets, and all of them decrypt the tickets,
+	// so a ticket is valid for at most maxSessionTicketKeys intervals.
+	maxSessionTicketKeys = 3
+)
+
+// sessionTicketCheckInterval is the max interval to check whether the
+// ticket key should be rotated, it is a variable for testing.
+var sessionTicketCheckInterval = time.Minute
+
+type (
+	// SessionTicketSpec describes the TLS session tickets of the HTTPServer.
+	// Without it, the tickets are enabled with keys generated and rotated
+	// by every member independently.
+	SessionTicketSpec struct {
+		// Disabled disables the session tickets, every connection takes a
+		// full handshake.
+		Disabled bool `json:"disabled,omitempty"`
+		// RotationInterval is the interval to rotate the ticket key,
+		// default is 24h.
+		RotationInterval string `json:"rotationInterval,omitempty" jsonschema:"format=duration"`
+		// Shared shares the ticket keys among the members of the cluster,
+		// so a session established with a member can be resumed with
+		// another one behind an L4 load balancer.
+		Shared bool `json:"shared,omitempty"`
+	}
+
+	// sessionTicketKey is a ticket key stored in the cluster.
+	sessionTicketKey struct {
+		Key       []byte `json:"key"`
+		CreatedAt int64  `json:"createdAt"`
+	}
+
+	// sessionTicketManager rotates the ticket keys and applies them to the
+	// TLS configs of the server.
+	sessionTicketManager struct {
+		name     string
+		cls      cluster.Cluster
+		interval time.Duration
+
+		mutex   sync.Mutex
+		keys    []*sessionTicketKey // the newest first
+		configs []*tls.Config
+
+		done chan struct{}
+	}
+
+	// handshakeStat records the TLS handshakes of the server.
+	handshakeStat struct {
+		handshakes uint64
+		resumed    uint64
+		duration   int64 // in nanoseconds
+
+		export func(d time.Duration, resumed bool)
+	}
+
+	// TLSStatus is the status of the TLS handshakes of the HTTPServer.
+	TLSStatus struct {
+		Handshakes uint64 `json:"handshakes"`
+		Resumed    uint64 `json:"resumed"`
+		// ResumptionRate is the percentage of the resumed handshakes.
+		ResumptionRate float64 `json:"resumptionRate"`
+		// AvgHandshakeTime is in milliseconds.
+		AvgHandshakeTime float64 `json:"avgHandshakeTime"`
+	}
+)
+
+// Validate validates SessionTicketSpec.
+func (s *SessionTicketSpec) Validate() error {
+	if s.RotationInterval == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(s.RotationInterval)
+	if err != nil || d < time.Minute {
+		return fmt.Errorf("invalid rotationInterval %s, it must be at least 1m", s.RotationInterval)
+	}
+	return nil
+}
+
+// newSessionTicketManager creates a manager, cls is nil if the keys are not
+// shared.
+func newSessionTicketManager(name string, spec *SessionTicketSpec, cls cluster.Cluster) *sessionTicketManager {
+	m := &sessionTicketManager{
+		name:     name,
+		cls:      cls,
+		interval: defaultSessionTicketRotationInterval,
+		done:     make(chan struct{}),
+	}
+	if spec.RotationInterval != "" {
+		m.interval, _ = time.ParseDuration(spec.RotationInterval)
+	}
+
+	m.rotate()
+	go m.run()
+	return m
+}
+
+func (m *sessionTicketManager) run() {
+	checkInterval := sessionTicketCheckInterval
+	if m.interval/2 < checkInterval {
+		checkInterval = m.interval / 2
+	}
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.rotate()
+		}
+	}
+}
+
+// rotateKeys prepends a new key to keys if the newest one is older than the
+// rotation interval, it returns nil if the keys are not changed.
+func (m *sessionTicketManager) rotateKeys(keys []*sessionTicketKey, now time.Time) ([]*sessionTicketKey, error) {
+	if len(keys) > 0 && now.Sub(time.Unix(keys[0].CreatedAt, 0)) < m.interval {
+		return nil, nil
+	}
+
+	key := &sessionTicketKey{Key: make([]byte, 32), CreatedAt: now.Unix()}
+	if _, err := rand.Read(key.Key); err != nil {
+		return nil, err
+	}
+
+	keys = append([]*sessionTicketKey{key}, keys...)
+	if len(keys) > maxSessionTicketKeys {
+		keys = keys[:maxSessionTicketKeys]
+	}
+	return keys, nil
+}
+
+// rotate rotates the keys if required. If the keys are shared, the keys in
+// the cluster are rotated by the first member finding them expired, and
+// the other members pick them up.
+func (m *sessionTicketManager) rotate() {
+	now := time.Now()
+
+	if m.cls == nil {
+		m.mutex.Lock()
+		keys, err := m.rotateKeys(m.keys, now)
+		m.mutex.Unlock()
+		if err != nil {
+			logger.Errorf("httpserver %s: rotate session ticket key failed: %v", m.name, err)
+		} else if keys != nil {
+			m.setKeys(keys)
+		}
+		return
+	}
+
+	var keys []*sessionTicketKey
+	key := m.cls.Layout().SessionTicketKeysKey(m.name)
+	err := m.cls.STM(func(stm concurrency.STM) error {
+		keys = nil
+		if value := stm.Get(key); value != "" {
+			if err := codectool.UnmarshalJSON([]byte(value), &keys); err != nil {
+				logger.Warnf("httpserver %s: bad session ticket keys in cluster, regenerate them: %v", m.name, err)
+				keys = nil
+			}
+		}
+
+		rotated, err := m.rotateKeys(keys, now)
+		if err != nil || rotated == nil {
+			return err
+		}
+		keys = rotated
+		data, err := codectool.MarshalJSON(keys)
+		if err != nil {
+			return err
+		}
+		stm.Put(key, string(data))
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("httpserver %s: sync session ticket keys failed, keep using the old ones: %v", m.name, err)
+		return
+	}
+	m.setKeys(keys)
+}
+
+// setKeys applies the keys to the TLS configs if they are changed.
+func (m *sessionTicketManager) setKeys(keys []*sessionTicketKey) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(keys) == len(m.keys) && (len(keys) == 0 || keys[0].CreatedAt == m.keys[0].CreatedAt) {
+		return
+	}
+	m.keys = keys
+	for _, c := range m.configs {
+		m.applyKeys(c)
+	}
+}
+
+// applyKeys sets the keys of tlsConfig, the caller must hold the mutex.
+func (m *sessionTicketManager) applyKeys(tlsConfig *tls.Config) {
+	if len(m.keys) == 0 {
+		return
+	}
+	keys := make([][32]byte, len(m.keys))
+	for i, k := range m.keys {
+		copy(keys[i][:], k.Key)
+	}
+	tlsConfig.SetSessionTicketKeys(keys)
+}
+
+// wrapTLSConfig makes tlsConfig use the ticket keys of the manager.
+func (m *sessionTicketManager) wrapTLSConfig(tlsConfig *tls.Config) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.configs = append(m.configs, tlsConfig)
+	m.applyKeys(tlsConfig)
+}
+
+func (m *sessionTicketManager) close() {
+	close(m.done)
+}
+
+// wrapTLSConfig makes tlsConfig record the handshakes. Every handshake gets
+// a clone of the config to measure its duration, which is cheap compared
+// to the handshake itself.
+func (hs *handshakeStat) wrapTLSConfig(tlsConfig *tls.Config) {
+	next := tlsConfig.GetConfigForClient
+	tlsConfig.GetConfigForClient = func(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+		start := fasttime.Now()
+
+		config := tlsConfig
+		if next != nil {
+			c, err := next(chi)
+			if err != nil {
+				return nil, err
+			}
+			if c != nil {
+				config = c
+			}
+		}
+
+		config = config.Clone()
+		verify := config.VerifyConnection
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if verify != nil {
+				if err := verify(cs); err != nil {
+					return err
+				}
+			}
+			hs.observe(fasttime.Since(start), cs.DidResume)
+			return nil
+		}
+		return config, nil
+	}
+}
+
+func (hs *handshakeStat) observe(d time.Duration, resumed bool) {
+	atomic.AddUint64(&hs.handshakes, 1)
+	atomic.AddInt64(&hs.duration, int64(d))
+	if resumed {
+		atomic.AddUint64(&hs.resumed, 1)
+	}
+	if hs.export != nil {
+		hs.export(d, resumed)
+	}
+}
+
+// status returns the status, it returns nil if there's no handshake.
+func (hs *handshakeStat) status() *TLSStatus {
+	s := &TLSStatus{
+		Handshakes: atomic.LoadUint64(&hs.handshakes),
+		Resumed:    atomic.LoadUint64(&hs.resumed),
+	}
+	if s.Handshakes == 0 {
+		return nil
+	}
+	s.ResumptionRate = float64(s.Resumed) * 100 / float64(s.Handshakes)
+	s.AvgHandshakeTime = float64(atomic.LoadInt64(&hs.duration)) / float64(s.Handshakes) / float64(time.Millisecond)
+	return s
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionTicketSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&SessionTicketSpec{}).Validate())
+	assert.NoError((&SessionTicketSpec{RotationInterval: "1h"}).Validate())
+	assert.Error((&SessionTicketSpec{RotationInterval: "10s"}).Validate())
+	assert.Error((&SessionTicketSpec{RotationInterval: "abc"}).Validate())
+}
+
+func TestSessionTicketRotateKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &sessionTicketManager{interval: time.Hour}
+	now := time.Now()
+
+	keys, err := m.rotateKeys(nil, now)
+	assert.NoError(err)
+	assert.Len(keys, 1)
+	assert.Len(keys[0].Key, 32)
+
+	rotated, err := m.rotateKeys(keys, now.Add(time.Minute))
+	assert.NoError(err)
+	assert.Nil(rotated)
+
+	for i := 1; i <= 5; i++ {
+		rotated, err = m.rotateKeys(keys, now.Add(time.Duration(i)*time.Hour))
+		assert.NoError(err)
+		assert.NotNil(rotated)
+		assert.Equal(keys[0], rotated[1])
+		keys = rotated
+	}
+	assert.Len(keys, maxSessionTicketKeys)
+	assert.Equal(now.Add(5*time.Hour).Unix(), keys[0].CreatedAt)
+}
+
+func TestSessionTicketResumption(t *testing.T) {
+	assert := assert.New(t)
+
+	certPem, keyPem := generateCert(t)
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	assert.NoError(err)
+
+	m := newSessionTicketManager("test", &SessionTicketSpec{}, nil)
+	defer m.close()
+	assert.Len(m.keys, 1)
+
+	hs := &handshakeStat{}
+	assert.Nil(hs.status())
+
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+	m.wrapTLSConfig(tlsConfig)
+	hs.wrapTLSConfig(tlsConfig)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})}
+	go srv.Serve(tls.NewListener(l, tlsConfig))
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPem)
+	client := &http.Client{Transport: &http.Transport{
+		DisableKeepAlives: true,
+		TLSClientConfig: &tls.Config{
+			RootCAs:            pool,
+			ClientSessionCache: tls.NewLRUClientSessionCache(8),
+		},
+	}}
+
+	get := func() {
+		resp, err := client.Get("https://" + l.Addr().String())
+		assert.NoError(err)
+		resp.Body.Close()
+	}
+
+	get()
+	get()
+	s := hs.status()
+	assert.Equal(uint64(2), s.Handshakes)
+	assert.Equal(uint64(1), s.Resumed)
+	assert.Equal(50.0, s.ResumptionRate)
+
+	// the tickets issued with the old key are still accepted after a
+	// rotation.
+	keys, err := (&sessionTicketManager{}).rotateKeys(m.keys, time.Now().Add(time.Second))
+	assert.NoError(err)
+	m.setKeys(keys)
+	assert.Len(m.keys, 2)
+	get()
+	assert.Equal(uint64(2), hs.status().Resumed)
+}
@@ -0,0 +1,274 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/object/pipeline"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot/httpstat"
+)
+
+// defaultSlowLogMaxEntries is the default number of the slow requests kept.
+const defaultSlowLogMaxEntries = 100
+
+type (
+	// SlowLogSpec describes how the HTTPServer captures the slow requests.
+	SlowLogSpec struct {
+		// Threshold is the latency of a request to be captured.
+		Threshold string `json:"threshold" jsonschema:"required,format=duration"`
+		// MaxEntries is the number of the most recent slow requests kept in
+		// memory, default is 100.
+		MaxEntries int `json:"maxEntries,omitempty" jsonschema:"minimum=1"`
+		// CaptureHeaders captures the request and response headers of the
+		// slow requests, with the credential headers redacted,
+		// HeaderSampleRate is the ratio of the slow requests whose headers
+		// are captured, default is 1.
+		CaptureHeaders   bool    `json:"captureHeaders,omitempty"`
+		HeaderSampleRate float64 `json:"headerSampleRate,omitempty" jsonschema:"minimum=0,maximum=1"`
+	}
+
+	// SlowRequest is a captured slow request.
+	SlowRequest struct {
+		Time       time.Time `json:"time"`
+		RealIP     string    `json:"realIP"`
+		Method     string    `json:"method"`
+		URI        string    `json:"uri"`
+		Proto      string    `json:"proto"`
+		Route      string    `json:"route,omitempty"`
+		Backend    string    `json:"backend,omitempty"`
+		StatusCode int       `json:"statusCode"`
+		Duration   string    `json:"duration"`
+		// Filters is the timing breakdown of the filters of the pipeline.
+		Filters         []*SlowFilterStat `json:"filters,omitempty"`
+		RequestHeaders  http.Header       `json:"requestHeaders,omitempty"`
+		ResponseHeaders http.Header       `json:"responseHeaders,omitempty"`
+	}
+
+	// SlowFilterStat is the result and the duration of a filter handling a
+	// slow request.
+	SlowFilterStat struct {
+		Name     string `json:"name"`
+		Kind     string `json:"kind"`
+		Result   string `json:"result,omitempty"`
+		Duration string `json:"duration"`
+	}
+
+	// slowLog is a ring buffer of the most recent slow requests, it is
+	// shared by the instances of the mux, so the captured requests survive
+	// the reloads of the HTTPServer.
+	//
+	// The threshold and the sample rate are checked for every request, so
+	// they are atomics, the mutex only guards the ring buffer, which is
+	// written by the slow requests only.
+	slowLog struct {
+		// threshold is the threshold in nanoseconds, zero disables the
+		// slow log.
+		threshold atomic.Int64
+		// headerRate is the bits of the sample rate of the headers, zero
+		// means the headers are not captured.
+		headerRate atomic.Uint64
+
+		mutex   sync.Mutex
+		entries []*SlowRequest
+		next    int
+		count   int
+		// total is the number of the slow requests ever captured.
+		total uint64
+	}
+)
+
+// Validate validates SlowLogSpec.
+func (spec *SlowLogSpec) Validate() error {
+	d, err := time.ParseDuration(spec.Threshold)
+	if err != nil {
+		return fmt.Errorf("invalid slowLog threshold %s: %v", spec.Threshold, err)
+	}
+	if d <= 0 {
+		return fmt.Errorf("slowLog threshold must be positive")
+	}
+	return nil
+}
+
+// configure applies the spec to the slow log, the slow log is disabled if
+// the spec is nil. The captured requests are kept as many as possible.
+func (sl *slowLog) configure(spec *SlowLogSpec) {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+
+	if spec == nil {
+		sl.threshold.Store(0)
+		sl.headerRate.Store(0)
+		sl.entries, sl.next, sl.count = nil, 0, 0
+		return
+	}
+
+	// the spec is validated, so the error is ignored.
+	threshold, _ := time.ParseDuration(spec.Threshold)
+	sl.threshold.Store(int64(threshold))
+	sampleRate := 0.0
+	if spec.CaptureHeaders {
+		sampleRate = spec.HeaderSampleRate
+		if sampleRate == 0 {
+			sampleRate = 1
+		}
+	}
+	sl.headerRate.Store(math.Float64bits(sampleRate))
+
+	maxEntries := spec.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultSlowLogMaxEntries
+	}
+	if maxEntries == len(sl.entries) {
+		return
+	}
+
+	entries := sl.list()
+	if len(entries) > maxEntries {
+		entries = entries[len(entries)-maxEntries:]
+	}
+	sl.entries = make([]*SlowRequest, maxEntries)
+	sl.count = copy(sl.entries, entries)
+	sl.next = sl.count % maxEntries
+}
+
+// isSlow returns whether a request with the duration should be captured.
+func (sl *slowLog) isSlow(d time.Duration) bool {
+	threshold := time.Duration(sl.threshold.Load())
+	return threshold > 0 && d >= threshold
+}
+
+// shouldCaptureHeaders returns whether the headers of a slow request should
+// be captured, according to the sample rate.
+func (sl *slowLog) shouldCaptureHeaders() bool {
+	rate := math.Float64frombits(sl.headerRate.Load())
+	return rate > 0 && (rate >= 1 || rand.Float64() < rate)
+}
+
+func (sl *slowLog) add(sr *SlowRequest) {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+
+	if len(sl.entries) == 0 {
+		return
+	}
+	sl.entries[sl.next] = sr
+	sl.next = (sl.next + 1) % len(sl.entries)
+	if sl.count < len(sl.entries) {
+		sl.count++
+	}
+	sl.total++
+}
+
+// list returns the captured requests, the oldest first, the caller must
+// hold the mutex.
+func (sl *slowLog) list() []*SlowRequest {
+	entries := make([]*SlowRequest, 0, sl.count)
+	if sl.count == 0 {
+		return entries
+	}
+	size := len(sl.entries)
+	start := (sl.next - sl.count + size) % size
+	for i := 0; i < sl.count; i++ {
+		entries = append(entries, sl.entries[(start+i)%size])
+	}
+	return entries
+}
+
+// requests returns the captured requests, the most recent first.
+func (sl *slowLog) requests() []*SlowRequest {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+
+	entries := sl.list()
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries
+}
+
+// clear removes the captured requests.
+func (sl *slowLog) clear() {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+
+	for i := range sl.entries {
+		sl.entries[i] = nil
+	}
+	sl.next, sl.count = 0, 0
+}
+
+func (sl *slowLog) totalCaptured() uint64 {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+	return sl.total
+}
+
+// captureSlowRequest captures a slow request with the timing breakdown of
+// the filters, and its headers with the credentials redacted if they are
+// sampled.
+func (mi *muxInstance) captureSlowRequest(ctx *context.Context, stdr *http.Request,
+	req *httpprot.Request, route *cachedRoute, metric *httpstat.Metric,
+	respHeader http.Header, startAt time.Time,
+) {
+	sr := &SlowRequest{
+		Time:       startAt,
+		RealIP:     req.RealIP(),
+		Method:     stdr.Method,
+		URI:        stdr.RequestURI,
+		Proto:      stdr.Proto,
+		StatusCode: metric.StatusCode,
+		Duration:   metric.Duration.String(),
+	}
+	if route.code == 0 {
+		sr.Route, sr.Backend = routePath(route.route), route.route.GetBackend()
+	}
+	if stats, ok := pipeline.StatsDataKey.Get(ctx); ok {
+		sr.Filters = slowFilterStats(stats)
+	}
+	if mi.slowLog.shouldCaptureHeaders() {
+		sr.RequestHeaders = pipeline.RedactHeader(stdr.Header)
+		sr.ResponseHeaders = pipeline.RedactHeader(respHeader)
+	}
+	mi.slowLog.add(sr)
+}
+
+// slowFilterStats converts the stats of the pipeline filters.
+func slowFilterStats(stats []pipeline.FilterStat) []*SlowFilterStat {
+	if len(stats) == 0 {
+		return nil
+	}
+	result := make([]*SlowFilterStat, 0, len(stats))
+	for _, s := range stats {
+		result = append(result, &SlowFilterStat{
+			Name:     s.Name,
+			Kind:     s.Kind,
+			Result:   s.Result,
+			Duration: s.Duration.String(),
+		})
+	}
+	return result
+}
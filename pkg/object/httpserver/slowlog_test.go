@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowLogSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&SlowLogSpec{Threshold: "500ms"}).Validate())
+	assert.Error((&SlowLogSpec{}).Validate())
+	assert.Error((&SlowLogSpec{Threshold: "0s"}).Validate())
+}
+
+func TestSlowLog(t *testing.T) {
+	assert := assert.New(t)
+
+	sl := &slowLog{}
+	assert.False(sl.isSlow(time.Hour))
+	sl.add(&SlowRequest{URI: "/0"})
+	assert.Empty(sl.requests())
+
+	sl.configure(&SlowLogSpec{Threshold: "100ms", MaxEntries: 3})
+	assert.False(sl.isSlow(99 * time.Millisecond))
+	assert.True(sl.isSlow(100 * time.Millisecond))
+	assert.False(sl.shouldCaptureHeaders())
+
+	for _, uri := range []string{"/1", "/2", "/3", "/4"} {
+		sl.add(&SlowRequest{URI: uri})
+	}
+	uris := func() []string {
+		var result []string
+		for _, sr := range sl.requests() {
+			result = append(result, sr.URI)
+		}
+		return result
+	}
+	assert.Equal([]string{"/4", "/3", "/2"}, uris())
+	assert.Equal(uint64(4), sl.totalCaptured())
+
+	// the most recent requests are kept when the buffer shrinks.
+	sl.configure(&SlowLogSpec{Threshold: "100ms", MaxEntries: 2, CaptureHeaders: true})
+	assert.Equal([]string{"/4", "/3"}, uris())
+	assert.True(sl.shouldCaptureHeaders())
+
+	sl.configure(&SlowLogSpec{Threshold: "100ms", MaxEntries: 2, HeaderSampleRate: 1})
+	assert.False(sl.shouldCaptureHeaders())
+
+	sl.configure(&SlowLogSpec{Threshold: "100ms", MaxEntries: 5})
+	sl.add(&SlowRequest{URI: "/5"})
+	assert.Equal([]string{"/5", "/4", "/3"}, uris())
+
+	sl.clear()
+	assert.Empty(sl.requests())
+	assert.Equal(uint64(5), sl.totalCaptured())
+
+	sl.configure(nil)
+	assert.False(sl.isSlow(time.Hour))
+}
@@ -33,6 +33,8 @@ type (
 	// Spec describes the HTTPServer.
 	Spec struct {
 		HTTP3             bool          `json:"http3,omitempty"`
+		HTTP3Options      *HTTP3Spec    `json:"http3Options,omitempty"`
+		HTTP2             *HTTP2Spec    `json:"http2,omitempty"`
 		KeepAlive         bool          `json:"keepAlive" jsonschema:"required"`
 		HTTPS             bool          `json:"https" jsonschema:"required"`
 		AutoCert          bool          `json:"autoCert,omitempty"`
@@ -42,10 +44,30 @@ type (
 		ClientMaxBodySize int64         `json:"clientMaxBodySize,omitempty"`
 		KeepAliveTimeout  string        `json:"keepAliveTimeout,omitempty" jsonschema:"format=duration"`
 		MaxConnections    uint32        `json:"maxConnections,omitempty" jsonschema:"minimum=1"`
+		ReadTimeout       string        `json:"readTimeout,omitempty" jsonschema:"format=duration"`
+		ReadHeaderTimeout string        `json:"readHeaderTimeout,omitempty" jsonschema:"format=duration"`
+		WriteTimeout      string        `json:"writeTimeout,omitempty" jsonschema:"format=duration"`
+		DrainTimeout      string        `json:"drainTimeout,omitempty" jsonschema:"format=duration"`
 		CacheSize         uint32        `json:"cacheSize,omitempty"`
 		Tracing           *tracing.Spec `json:"tracing,omitempty"`
 		CaCertBase64      string        `json:"caCertBase64,omitempty" jsonschema:"format=base64"`
 
+		// ProxyProtocol requires the TCP connections to start with a PROXY
+		// protocol (v1 or v2) header, which carries the client address when
+		// the server is behind an L4 load balancer.
+		ProxyProtocol bool `json:"proxyProtocol,omitempty"`
+
+		// MaxConnectionsPerIP limits the concurrent connections of each
+		// client IP, the connections exceeding the limit are closed.
+		MaxConnectionsPerIP uint32 `json:"maxConnectionsPerIP,omitempty" jsonschema:"minimum=1"`
+		// MaxRequestsPerConnection closes a keep-alive connection after it
+		// serves this number of requests.
+		MaxRequestsPerConnection uint32 `json:"maxRequestsPerConnection,omitempty"`
+
+		// UnixSocket is the Unix domain socket to listen on in addition to
+		// the TCP port, for clients on the same host to avoid the TCP stack.
+		UnixSocket *UnixSocketSpec `json:"unixSocket,omitempty"`
+
 		// Support multiple certs, preserve the certbase64 and keybase64
 		// for backward compatibility
 		CertBase64 string `json:"certBase64,omitempty" jsonschema:"format=base64"`
@@ -56,6 +78,14 @@ type (
 		// Keys saved as map, key is domain name, value is secret
 		Keys map[string]string `json:"keys,omitempty"`
 
+		// CertFiles are certificates loaded from files and selected by SNI,
+		// they take precedence over the above certificates.
+		CertFiles []*CertFileSpec `json:"certFiles,omitempty"`
+
+		// SessionTickets configures the TLS session tickets, which let the
+		// clients resume the sessions with abbreviated handshakes.
+		SessionTickets *SessionTicketSpec `json:"sessionTickets,omitempty"`
+
 		RouterKind string `json:"routerKind,omitempty" jsonschema:"enum=,enum=Ordered,enum=RadixTree"`
 
 		IPFilter *ipfilter.Spec `json:"ipFilter,omitempty"`
@@ -63,12 +93,137 @@ type (
 
 		GlobalFilter string `json:"globalFilter,omitempty"`
 
+		// Backpressure slows down the intake of the requests to a pipeline
+		// while the pipeline signals backpressure.
+		Backpressure *BackpressureSpec `json:"backpressure,omitempty"`
+
 		AccessLogFormat string `json:"accessLogFormat,omitempty"`
+
+		// RouteMetrics records the statistics of every route in addition
+		// to the whole server, they are reported in the status and exported
+		// to Prometheus with the route label.
+		RouteMetrics bool `json:"routeMetrics,omitempty"`
+
+		// StreamBody streams the request bodies to the pipelines whose
+		// filters don't need the whole bodies instead of buffering them,
+		// and lets the proxies of these pipelines stream the responses
+		// back. The streamed bodies are still limited by clientMaxBodySize
+		// and serverMaxBodySize of the proxies.
+		StreamBody bool `json:"streamBody,omitempty"`
+
+		// SlowLog captures the requests exceeding a latency threshold for
+		// diagnosing tail latency, they are retrieved by the admin API.
+		SlowLog *SlowLogSpec `json:"slowLog,omitempty"`
+
+		// ErrorPages are the custom pages of the error responses built by
+		// Easegress, the error responses of the upstreams are not changed.
+		ErrorPages []*ErrorPageSpec `json:"errorPages,omitempty"`
+	}
+
+	// HTTP2Spec describes the HTTP/2 options of the HTTPServer. HTTP/2 is
+	// always available over TLS, and HTTP/2 over cleartext TCP (h2c) is
+	// available when H2C is true.
+	HTTP2Spec struct {
+		H2C bool `json:"h2c,omitempty"`
+		// MaxConcurrentStreams limits the number of concurrent streams of
+		// each client connection, default is 250.
+		MaxConcurrentStreams         uint32 `json:"maxConcurrentStreams,omitempty"`
+		MaxReadFrameSize             uint32 `json:"maxReadFrameSize,omitempty" jsonschema:"minimum=16384,maximum=16777215"`
+		MaxUploadBufferPerConnection int32  `json:"maxUploadBufferPerConnection,omitempty" jsonschema:"minimum=65535"`
+		MaxUploadBufferPerStream     int32  `json:"maxUploadBufferPerStream,omitempty" jsonschema:"minimum=1"`
+	}
+
+	// HTTP3Spec describes the HTTP/3 options of the HTTPServer.
+	HTTP3Spec struct {
+		// AltSvc starts an HTTP/1.1 and HTTP/2 server on the TCP port with
+		// the same number, and advertises the HTTP/3 server to clients with
+		// the Alt-Svc header in its responses.
+		AltSvc bool `json:"altSvc,omitempty"`
+		// Allow0RTT accepts 0-RTT data from clients, note that 0-RTT data
+		// could be replayed by attackers.
+		Allow0RTT bool `json:"allow0RTT,omitempty"`
+		// ConnectionIDLength is the length of the connection IDs issued by
+		// the server, default is 4. Connections are identified by their IDs
+		// instead of client addresses, so they survive the client address
+		// changes, and a QUIC aware load balancer could route packets of
+		// these connections by the IDs.
+		ConnectionIDLength int `json:"connectionIDLength,omitempty" jsonschema:"minimum=4,maximum=18"`
+	}
+
+	// BackpressureSpec describes how the HTTPServer handles the requests
+	// to a pipeline under backpressure.
+	BackpressureSpec struct {
+		// MaxWait is the max time a request waits for the backpressure to
+		// go away, the request is rejected with 503 after it. The request
+		// is rejected immediately if it is empty.
+		MaxWait string `json:"maxWait,omitempty" jsonschema:"format=duration"`
+		// RetryAfter is the value of the Retry-After header in seconds of
+		// the rejected responses, the header is not set if it is zero.
+		RetryAfter int `json:"retryAfter,omitempty" jsonschema:"minimum=0"`
 	}
 )
 
+// References returns the pipelines in the rules and the global filter.
+func (spec *Spec) References() []string {
+	names := []string{spec.GlobalFilter}
+	for _, rule := range spec.Rules {
+		for _, path := range rule.Paths {
+			names = append(names, path.Backend)
+		}
+	}
+	return names
+}
+
+// KindReferences returns the AutoCertManager if autoCert is enabled.
+func (spec *Spec) KindReferences() []string {
+	if spec.AutoCert {
+		return []string{autocertmanager.Kind}
+	}
+	return nil
+}
+
+// TemplateReferences returns the shared templates of the error pages.
+func (spec *Spec) TemplateReferences() []string {
+	var names []string
+	for _, ep := range spec.ErrorPages {
+		if ep.InlineTemplate != nil {
+			names = append(names, ep.InlineTemplate.Ref)
+		}
+	}
+	return names
+}
+
 // Validate validates HTTPServerSpec.
 func (spec *Spec) Validate() error {
+	if spec.HTTP2 != nil && spec.HTTP2.H2C && spec.HTTPS {
+		return fmt.Errorf("h2c is enabled when https enabled")
+	}
+
+	if spec.HTTP3Options != nil && !spec.HTTP3 {
+		return fmt.Errorf("http3Options is specified when http3 disabled")
+	}
+
+	if spec.SlowLog != nil {
+		if err := spec.SlowLog.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if spec.UnixSocket != nil {
+		if spec.HTTP3 && (spec.HTTP3Options == nil || !spec.HTTP3Options.AltSvc) {
+			return fmt.Errorf("unixSocket is specified when only http3 enabled")
+		}
+		if err := spec.UnixSocket.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for i, ep := range spec.ErrorPages {
+		if err := ep.Validate(); err != nil {
+			return fmt.Errorf("errorPages[%d]: %v", i, err)
+		}
+	}
+
 	if !spec.HTTPS {
 		if spec.HTTP3 {
 			return fmt.Errorf("https is disabled when http3 enabled")
@@ -76,9 +231,17 @@ func (spec *Spec) Validate() error {
 		return nil
 	}
 
-	if spec.CertBase64 == "" && spec.KeyBase64 == "" && len(spec.Certs) == 0 && len(spec.Keys) == 0 && !spec.AutoCert {
-		return fmt.Errorf("certBase64/keyBase64, certs/keys are both empty and autocert is disabled when https enabled")
+	if spec.SessionTickets != nil {
+		if err := spec.SessionTickets.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if spec.CertBase64 == "" && spec.KeyBase64 == "" && len(spec.Certs) == 0 && len(spec.Keys) == 0 && len(spec.CertFiles) == 0 && !spec.AutoCert {
+		return fmt.Errorf("certBase64/keyBase64, certs/keys, certFiles are all empty and autocert is disabled when https enabled")
 	}
+	// the certificate files are local to the members, so they are loaded
+	// by the members running the server instead of validated here.
 	_, err := spec.tlsConfig()
 	return err
 }
@@ -123,7 +286,7 @@ func (spec *Spec) tlsConfig() (*tls.Config, error) {
 		certificates = append(certificates, cert)
 	}
 
-	if len(certificates) == 0 && !spec.AutoCert {
+	if len(certificates) == 0 && len(spec.CertFiles) == 0 && !spec.AutoCert {
 		return nil, fmt.Errorf("none valid certs and secret")
 	}
 
@@ -160,5 +323,9 @@ func (spec *Spec) tlsConfig() (*tls.Config, error) {
 		tlsConf.ClientCAs = certPool
 	}
 
+	if spec.SessionTickets != nil && spec.SessionTickets.Disabled {
+		tlsConf.SessionTicketsDisabled = true
+	}
+
 	return tlsConf, nil
 }
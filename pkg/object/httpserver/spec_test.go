@@ -26,6 +26,7 @@ import (
 
 	"github.com/megaease/easegress/v2/pkg/cluster"
 	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/autocertmanager"
 	"github.com/megaease/easegress/v2/pkg/option"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
 
@@ -72,6 +73,43 @@ rules:
 name: http-server-test
 kind: HTTPServer
 port: 10080
+http3Options:
+  altSvc: true
+`
+
+	_, err = supervisor.NewSpec(yamlConfig)
+	assert.Error(err)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+port: 10080
+https: true
+certBase64: abc
+keyBase64: abc
+http2:
+  h2c: true
+`
+
+	_, err = supervisor.NewSpec(yamlConfig)
+	assert.Error(err)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+port: 10080
+unixSocket:
+  path: "@easegress"
+  mode: "0660"
+`
+
+	_, err = supervisor.NewSpec(yamlConfig)
+	assert.Error(err)
+
+	yamlConfig = `
+name: http-server-test
+kind: HTTPServer
+port: 10080
 cacheSize: 200
 rules:
   - paths:
@@ -257,3 +295,42 @@ rules: []`, validSpec: true, mTLSExpected: true,
 		})
 	}
 }
+
+func TestSpecReferences(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlConfig := `
+name: http-server-test
+kind: HTTPServer
+port: 10080
+keepAlive: true
+https: false
+globalFilter: global-filter
+rules:
+  - paths:
+    - pathPrefix: /api
+      backend: pipeline-api
+    - pathPrefix: /
+      backend: pipeline-default
+  - host: www.megaease.com
+    paths:
+    - pathPrefix: /api
+      backend: pipeline-api
+errorPages:
+  - codes: ["404"]
+    inlineTemplate:
+      ref: not-found
+  - codes: ["5xx"]
+    inlineTemplate:
+      text: server error
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	assert.Equal([]string{"global-filter", "pipeline-api", "pipeline-default"}, superSpec.References())
+	assert.Empty(superSpec.KindReferences())
+	assert.Equal([]string{"not-found"}, superSpec.TemplateReferences())
+
+	spec := superSpec.ObjectSpec().(*Spec)
+	spec.AutoCert = true
+	assert.Equal([]string{autocertmanager.Kind}, spec.KindReferences())
+}
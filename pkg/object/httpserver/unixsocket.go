@@ -0,0 +1,100 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpserver
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UnixSocketSpec describes the Unix domain socket the HTTPServer listens on
+// in addition to the TCP port.
+type UnixSocketSpec struct {
+	// Path is the path of the socket file, a path starts with '@' is an
+	// abstract socket, which has no file and is only available on Linux.
+	Path string `json:"path" jsonschema:"required"`
+	// Mode is the permission of the socket file in octal, like '0660'.
+	Mode string `json:"mode,omitempty" jsonschema:"pattern=^0?[0-7]{3}$"`
+}
+
+func (spec *UnixSocketSpec) isAbstract() bool {
+	return strings.HasPrefix(spec.Path, "@")
+}
+
+func (spec *UnixSocketSpec) fileMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(spec.Mode, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	return os.FileMode(mode), nil
+}
+
+// Validate validates the UnixSocketSpec.
+func (spec *UnixSocketSpec) Validate() error {
+	if spec.Mode == "" {
+		return nil
+	}
+	if spec.isAbstract() {
+		return fmt.Errorf("mode is specified for abstract socket %s", spec.Path)
+	}
+	if _, err := spec.fileMode(); err != nil {
+		return fmt.Errorf("invalid mode %s: %v", spec.Mode, err)
+	}
+	return nil
+}
+
+// removeStaleSocket removes the socket file left by a crashed process, the
+// file is kept if it is being listened on.
+func (spec *UnixSocketSpec) removeStaleSocket() {
+	fi, err := os.Stat(spec.Path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return
+	}
+
+	conn, err := net.DialTimeout("unix", spec.Path, time.Second)
+	if err == nil {
+		conn.Close()
+		return
+	}
+	os.Remove(spec.Path)
+}
+
+func (r *runtime) listenUnix(spec *UnixSocketSpec) (net.Listener, error) {
+	if !spec.isAbstract() {
+		spec.removeStaleSocket()
+	}
+
+	listener, err := gnet.Listen("unix", spec.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if spec.Mode != "" {
+		mode, _ := spec.fileMode()
+		if err = os.Chmod(spec.Path, mode); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	return listener, nil
+}
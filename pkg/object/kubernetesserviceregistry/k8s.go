@@ -0,0 +1,229 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetesserviceregistry
+
+import (
+	"fmt"
+	"time"
+
+	apidiscoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/megaease/easegress/v2/pkg/object/serviceregistry"
+)
+
+const (
+	resyncPeriod     = 10 * time.Minute
+	cacheSyncTimeout = 30 * time.Second
+)
+
+type k8sClient struct {
+	clientset *kubernetes.Clientset
+	listers   []discoverylisters.EndpointSliceLister
+	eventCh   chan struct{}
+	stopCh    chan struct{}
+}
+
+func newK8sClient(masterURL string, kubeConfig string) (*k8sClient, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("build kubeconfig failed: %v", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("build kubernetes clientset failed: %v", err)
+	}
+
+	return &k8sClient{
+		clientset: clientset,
+		eventCh:   make(chan struct{}, 1),
+		stopCh:    make(chan struct{}),
+	}, nil
+}
+
+// OnAdd is called on Resource Add Events.
+func (c *k8sClient) OnAdd(obj interface{}, isInInitialList bool) {
+	c.notify()
+}
+
+// OnUpdate is called on Resource Update Events.
+func (c *k8sClient) OnUpdate(oldObj, newObj interface{}) {
+	if oldObj.(metav1.Object).GetResourceVersion() == newObj.(metav1.Object).GetResourceVersion() {
+		return
+	}
+	c.notify()
+}
+
+// OnDelete is called on Resource Delete Events.
+func (c *k8sClient) OnDelete(obj interface{}) {
+	c.notify()
+}
+
+// notify discards the event if there's one in the channel already,
+// this is fine because the registry always reloads everything.
+func (c *k8sClient) notify() {
+	select {
+	case c.eventCh <- struct{}{}:
+	default:
+	}
+}
+
+func (c *k8sClient) event() <-chan struct{} {
+	return c.eventCh
+}
+
+func (c *k8sClient) watch(namespaces []string) error {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	var factories []informers.SharedInformerFactory
+	for _, ns := range namespaces {
+		factory := informers.NewSharedInformerFactoryWithOptions(c.clientset,
+			resyncPeriod, informers.WithNamespace(ns))
+		endpointSlices := factory.Discovery().V1().EndpointSlices()
+		endpointSlices.Informer().AddEventHandler(c)
+		c.listers = append(c.listers, endpointSlices.Lister())
+		factories = append(factories, factory)
+	}
+
+	waitCh := make(chan struct{})
+	timer := time.AfterFunc(cacheSyncTimeout, func() { close(waitCh) })
+	defer timer.Stop()
+
+	for _, factory := range factories {
+		factory.Start(c.stopCh)
+		for typ, ok := range factory.WaitForCacheSync(waitCh) {
+			if !ok {
+				c.close()
+				return fmt.Errorf("timed out waiting for caches to sync %s", typ)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *k8sClient) close() {
+	close(c.stopCh)
+}
+
+func (c *k8sClient) listEndpointSlices(namespace, serviceName string) ([]*apidiscoveryv1.EndpointSlice, error) {
+	selector := labels.SelectorFromSet(labels.Set{apidiscoveryv1.LabelServiceName: serviceName})
+
+	var result []*apidiscoveryv1.EndpointSlice
+	for _, lister := range c.listers {
+		slices, err := lister.EndpointSlices(namespace).List(selector)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, slices...)
+	}
+
+	return result, nil
+}
+
+func (c *k8sClient) listAllEndpointSlices() ([]*apidiscoveryv1.EndpointSlice, error) {
+	var result []*apidiscoveryv1.EndpointSlice
+	for _, lister := range c.listers {
+		slices, err := lister.List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, slices...)
+	}
+
+	return result, nil
+}
+
+// endpointSlicePort returns the port to use for the endpoint slice, it is
+// the port with the given name, or the first port if name is empty.
+func endpointSlicePort(slice *apidiscoveryv1.EndpointSlice, name string) *apidiscoveryv1.EndpointPort {
+	for i := range slice.Ports {
+		port := &slice.Ports[i]
+		if port.Port == nil {
+			continue
+		}
+		if name == "" || (port.Name != nil && *port.Name == name) {
+			return port
+		}
+	}
+	return nil
+}
+
+// endpointReady reports whether the endpoint is ready to receive traffic,
+// the readiness of a pod already takes its readiness gates into account.
+func endpointReady(endpoint *apidiscoveryv1.Endpoint) bool {
+	if endpoint.Conditions.Terminating != nil && *endpoint.Conditions.Terminating {
+		return false
+	}
+	// nil should be interpreted as ready according to the API.
+	return endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+}
+
+func endpointSlicesToInstances(registryName, portName string, slices []*apidiscoveryv1.EndpointSlice) map[string]*serviceregistry.ServiceInstanceSpec {
+	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
+
+	for _, slice := range slices {
+		serviceName := slice.Labels[apidiscoveryv1.LabelServiceName]
+		if serviceName == "" {
+			continue
+		}
+
+		port := endpointSlicePort(slice, portName)
+		if port == nil {
+			continue
+		}
+
+		scheme := "http"
+		if (port.AppProtocol != nil && *port.AppProtocol == "https") ||
+			(port.Name != nil && *port.Name == "https") {
+			scheme = "https"
+		}
+
+		for i := range slice.Endpoints {
+			endpoint := &slice.Endpoints[i]
+			if len(endpoint.Addresses) == 0 || !endpointReady(endpoint) {
+				continue
+			}
+
+			instanceID := endpoint.Addresses[0]
+			if endpoint.TargetRef != nil && endpoint.TargetRef.Name != "" {
+				instanceID = endpoint.TargetRef.Name
+			}
+
+			instance := &serviceregistry.ServiceInstanceSpec{
+				RegistryName: registryName,
+				ServiceName:  serviceName + "." + slice.Namespace,
+				InstanceID:   instanceID,
+				Address:      endpoint.Addresses[0],
+				Port:         uint16(*port.Port),
+				Scheme:       scheme,
+			}
+			instances[instance.Key()] = instance
+		}
+	}
+
+	return instances
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetesserviceregistry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apicorev1 "k8s.io/api/core/v1"
+	apidiscoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestEndpointSlicesToInstances(t *testing.T) {
+	assert := assert.New(t)
+
+	slice := &apidiscoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Labels:    map[string]string{apidiscoveryv1.LabelServiceName: "backend"},
+		},
+		Ports: []apidiscoveryv1.EndpointPort{
+			{Name: ptr("metrics"), Port: ptr(int32(9090))},
+			{Name: ptr("https"), Port: ptr(int32(8443))},
+		},
+		Endpoints: []apidiscoveryv1.Endpoint{
+			{
+				Addresses:  []string{"10.0.0.1"},
+				Conditions: apidiscoveryv1.EndpointConditions{Ready: ptr(true)},
+				TargetRef:  &apicorev1.ObjectReference{Kind: "Pod", Name: "backend-1"},
+			},
+			{
+				Addresses:  []string{"10.0.0.2"},
+				Conditions: apidiscoveryv1.EndpointConditions{Ready: ptr(false)},
+			},
+			{
+				Addresses: []string{"10.0.0.3"},
+				Conditions: apidiscoveryv1.EndpointConditions{
+					Ready:       ptr(true),
+					Terminating: ptr(true),
+				},
+			},
+			{
+				Addresses: []string{"10.0.0.4"},
+			},
+		},
+	}
+	other := &apidiscoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default"},
+		Ports:      []apidiscoveryv1.EndpointPort{{Port: ptr(int32(80))}},
+		Endpoints:  []apidiscoveryv1.Endpoint{{Addresses: []string{"10.0.0.5"}}},
+	}
+	slices := []*apidiscoveryv1.EndpointSlice{slice, other}
+
+	instances := endpointSlicesToInstances("k8s", "https", slices)
+	assert.Len(instances, 2)
+
+	instance := instances["k8s/backend.default/backend-1"]
+	assert.NotNil(instance)
+	assert.Equal("10.0.0.1", instance.Address)
+	assert.Equal(uint16(8443), instance.Port)
+	assert.Equal("https", instance.Scheme)
+	assert.NoError(instance.Validate())
+
+	instance = instances["k8s/backend.default/10.0.0.4"]
+	assert.NotNil(instance)
+
+	// the first port is used if the port name is empty.
+	instances = endpointSlicesToInstances("k8s", "", slices)
+	assert.Equal(uint16(9090), instances["k8s/backend.default/backend-1"].Port)
+	assert.Equal("http", instances["k8s/backend.default/backend-1"].Scheme)
+
+	instances = endpointSlicesToInstances("k8s", "grpc", slices)
+	assert.Empty(instances)
+}
@@ -0,0 +1,330 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package kubernetesserviceregistry provides KubernetesServiceRegistry.
+package kubernetesserviceregistry
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/serviceregistry"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+const (
+	// Category is the category of KubernetesServiceRegistry.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of KubernetesServiceRegistry.
+	Kind = "KubernetesServiceRegistry"
+
+	retryInterval = 10 * time.Second
+)
+
+var aliases = []string{"k8sregistry", "kubernetesserviceregistries"}
+
+func init() {
+	supervisor.Register(&KubernetesServiceRegistry{})
+	api.RegisterObject(&api.APIResource{
+		Category: Category,
+		Kind:     Kind,
+		Name:     strings.ToLower(Kind),
+		Aliases:  aliases,
+	})
+}
+
+type (
+	// KubernetesServiceRegistry is Object KubernetesServiceRegistry.
+	KubernetesServiceRegistry struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		serviceRegistry *serviceregistry.ServiceRegistry
+		firstDone       bool
+		instances       map[string]*serviceregistry.ServiceInstanceSpec
+		notify          chan *serviceregistry.RegistryEvent
+
+		clientMutex sync.RWMutex
+		client      *k8sClient
+		clientErr   error
+
+		statusMutex  sync.Mutex
+		instancesNum map[string]int
+
+		done chan struct{}
+	}
+
+	// Spec describes the KubernetesServiceRegistry.
+	Spec struct {
+		KubeConfig string   `json:"kubeConfig,omitempty"`
+		MasterURL  string   `json:"masterURL,omitempty"`
+		Namespaces []string `json:"namespaces,omitempty"`
+		PortName   string   `json:"portName,omitempty"`
+	}
+
+	// Status is the status of KubernetesServiceRegistry.
+	Status struct {
+		Health              string         `json:"health"`
+		ServiceInstancesNum map[string]int `json:"instancesNum"`
+	}
+)
+
+// Category returns the category of KubernetesServiceRegistry.
+func (k *KubernetesServiceRegistry) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of KubernetesServiceRegistry.
+func (k *KubernetesServiceRegistry) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of KubernetesServiceRegistry.
+func (k *KubernetesServiceRegistry) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes KubernetesServiceRegistry.
+func (k *KubernetesServiceRegistry) Init(superSpec *supervisor.Spec) {
+	k.superSpec, k.spec = superSpec, superSpec.ObjectSpec().(*Spec)
+	k.reload()
+}
+
+// Inherit inherits previous generation of KubernetesServiceRegistry.
+func (k *KubernetesServiceRegistry) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	previousGeneration.Close()
+	k.Init(superSpec)
+}
+
+func (k *KubernetesServiceRegistry) reload() {
+	k.serviceRegistry = k.superSpec.Super().MustGetSystemController(serviceregistry.Kind).
+		Instance().(*serviceregistry.ServiceRegistry)
+	k.firstDone = false
+	k.notify = make(chan *serviceregistry.RegistryEvent, 10)
+
+	k.instancesNum = map[string]int{}
+	k.done = make(chan struct{})
+
+	k.serviceRegistry.RegisterRegistry(k)
+
+	go k.run()
+}
+
+// connect creates the client and waits for the caches to be synced,
+// it retries until succeeded or the registry is closed.
+func (k *KubernetesServiceRegistry) connect() *k8sClient {
+	for {
+		client, err := newK8sClient(k.spec.MasterURL, k.spec.KubeConfig)
+		if err == nil {
+			err = client.watch(k.spec.Namespaces)
+		}
+
+		k.clientMutex.Lock()
+		k.clientErr = err
+		if err == nil {
+			k.client = client
+		}
+		k.clientMutex.Unlock()
+
+		if err == nil {
+			return client
+		}
+
+		logger.Errorf("%s connect to kubernetes failed: %v", k.superSpec.Name(), err)
+		select {
+		case <-k.done:
+			return nil
+		case <-time.After(retryInterval):
+		}
+	}
+}
+
+func (k *KubernetesServiceRegistry) getClient() (*k8sClient, error) {
+	k.clientMutex.RLock()
+	defer k.clientMutex.RUnlock()
+
+	if k.client != nil {
+		return k.client, nil
+	}
+	if k.clientErr != nil {
+		return nil, k.clientErr
+	}
+	return nil, fmt.Errorf("connecting to kubernetes")
+}
+
+func (k *KubernetesServiceRegistry) run() {
+	client := k.connect()
+	if client == nil {
+		return
+	}
+	defer client.close()
+
+	k.update()
+
+	for {
+		select {
+		case <-k.done:
+			return
+		case <-client.event():
+			k.update()
+		}
+	}
+}
+
+func (k *KubernetesServiceRegistry) update() {
+	instances, err := k.ListAllServiceInstances()
+	if err != nil {
+		logger.Errorf("list all service instances failed: %v", err)
+		return
+	}
+
+	instancesNum := make(map[string]int)
+	for _, instance := range instances {
+		instancesNum[instance.ServiceName]++
+	}
+
+	var event *serviceregistry.RegistryEvent
+	if !k.firstDone {
+		k.firstDone = true
+		event = &serviceregistry.RegistryEvent{
+			SourceRegistryName: k.Name(),
+			UseReplace:         true,
+			Replace:            instances,
+		}
+	} else {
+		event = serviceregistry.NewRegistryEventFromDiff(k.Name(), k.instances, instances)
+	}
+
+	if event.Empty() {
+		return
+	}
+
+	k.notify <- event
+	k.instances = instances
+
+	k.statusMutex.Lock()
+	k.instancesNum = instancesNum
+	k.statusMutex.Unlock()
+}
+
+// Status returns status of KubernetesServiceRegistry.
+func (k *KubernetesServiceRegistry) Status() *supervisor.Status {
+	s := &Status{}
+
+	_, err := k.getClient()
+	if err != nil {
+		s.Health = err.Error()
+	} else {
+		s.Health = "ready"
+	}
+
+	k.statusMutex.Lock()
+	instancesNum := k.instancesNum
+	k.statusMutex.Unlock()
+
+	s.ServiceInstancesNum = instancesNum
+
+	return &supervisor.Status{
+		ObjectStatus: s,
+	}
+}
+
+// Close closes KubernetesServiceRegistry.
+func (k *KubernetesServiceRegistry) Close() {
+	k.serviceRegistry.DeregisterRegistry(k.Name())
+
+	close(k.done)
+}
+
+// Name returns name.
+func (k *KubernetesServiceRegistry) Name() string {
+	return k.superSpec.Name()
+}
+
+// Notify returns notify channel.
+func (k *KubernetesServiceRegistry) Notify() <-chan *serviceregistry.RegistryEvent {
+	return k.notify
+}
+
+// ApplyServiceInstances applies service instances to the registry.
+// The endpoints are managed by Kubernetes, so it always fails.
+func (k *KubernetesServiceRegistry) ApplyServiceInstances(instances map[string]*serviceregistry.ServiceInstanceSpec) error {
+	return fmt.Errorf("%s is read-only", k.superSpec.Name())
+}
+
+// DeleteServiceInstances deletes service instances from the registry.
+// The endpoints are managed by Kubernetes, so it always fails.
+func (k *KubernetesServiceRegistry) DeleteServiceInstances(instances map[string]*serviceregistry.ServiceInstanceSpec) error {
+	return fmt.Errorf("%s is read-only", k.superSpec.Name())
+}
+
+// GetServiceInstance get service instance from the registry.
+func (k *KubernetesServiceRegistry) GetServiceInstance(serviceName, instanceID string) (*serviceregistry.ServiceInstanceSpec, error) {
+	instances, err := k.ListServiceInstances(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, instance := range instances {
+		if instance.InstanceID == instanceID {
+			return instance, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s/%s not found", serviceName, instanceID)
+}
+
+// ListServiceInstances list service instances of one service from the registry.
+// The service name is in the form of name.namespace, e.g. backend.default.
+func (k *KubernetesServiceRegistry) ListServiceInstances(serviceName string) (map[string]*serviceregistry.ServiceInstanceSpec, error) {
+	client, err := k.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	name, namespace, ok := strings.Cut(serviceName, ".")
+	if !ok {
+		return nil, fmt.Errorf("invalid service name %s, the format is name.namespace", serviceName)
+	}
+
+	slices, err := client.listEndpointSlices(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return endpointSlicesToInstances(k.Name(), k.spec.PortName, slices), nil
+}
+
+// ListAllServiceInstances list all service instances from the registry.
+func (k *KubernetesServiceRegistry) ListAllServiceInstances() (map[string]*serviceregistry.ServiceInstanceSpec, error) {
+	client, err := k.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	slices, err := client.listAllEndpointSlices()
+	if err != nil {
+		return nil, err
+	}
+
+	return endpointSlicesToInstances(k.Name(), k.spec.PortName, slices), nil
+}
@@ -0,0 +1,417 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package localqueue implements the LocalQueue, a disk-backed queue which
+// accepts requests from the pipelines and drains them to a pipeline, so the
+// requests are delivered even across restarts.
+package localqueue
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/tracing"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/diskqueue"
+)
+
+const (
+	// Category is the category of LocalQueue.
+	Category = supervisor.CategoryTrafficGate
+
+	// Kind is the kind of LocalQueue.
+	Kind = "LocalQueue"
+
+	defaultRetryInterval = 5 * time.Second
+	retainInterval       = time.Minute
+)
+
+// EnqueueTimeDataKey is the key of the task data where the LocalQueue
+// stores the time the request was enqueued.
+var EnqueueTimeDataKey = context.NewDataKey[time.Time]("", "LOCAL_QUEUE_ENQUEUE_TIME")
+
+// queues are the running LocalQueues by name.
+var queues sync.Map
+
+var _ supervisor.TrafficObject = (*LocalQueue)(nil)
+
+func init() {
+	context.RegisterRuntimeData(EnqueueTimeDataKey.Decl())
+	supervisor.Register(&LocalQueue{})
+	api.RegisterObject(&api.APIResource{
+		Category: Category,
+		Kind:     Kind,
+		Name:     strings.ToLower(Kind),
+		Aliases:  []string{"localqueues", "lq"},
+	})
+}
+
+type (
+	// LocalQueue is a disk-backed queue of requests, which are drained
+	// to a pipeline in order.
+	LocalQueue struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+		muxMapper context.MuxMapper
+		queue     *diskqueue.Queue
+
+		retryInterval time.Duration
+
+		done chan struct{}
+		wg   sync.WaitGroup
+
+		lock   sync.Mutex
+		status Status
+	}
+
+	// Spec describes the LocalQueue.
+	Spec struct {
+		// Pipeline is the pipeline draining the queue.
+		Pipeline string `json:"pipeline" jsonschema:"required"`
+		// Dir is the directory of the queue, default is localqueue/<name>
+		// in the data directory.
+		Dir         string `json:"dir,omitempty"`
+		SegmentSize int64  `json:"segmentSize,omitempty" jsonschema:"minimum=1"`
+		MaxSize     int64  `json:"maxSize,omitempty" jsonschema:"minimum=0"`
+		MaxAge      string `json:"maxAge,omitempty" jsonschema:"format=duration"`
+		Sync        bool   `json:"sync,omitempty"`
+		// RetryInterval is the interval to retry a request failed by the
+		// pipeline, default is 5s.
+		RetryInterval string `json:"retryInterval,omitempty" jsonschema:"format=duration"`
+		// MaxRetries is the max retries of a request, the request is
+		// discarded after that, zero means retrying until it succeeds.
+		MaxRetries int `json:"maxRetries,omitempty" jsonschema:"minimum=0"`
+	}
+
+	// Status is the status of LocalQueue on this member.
+	Status struct {
+		diskqueue.Stats `json:",inline"`
+
+		Enqueued uint64 `json:"enqueued"`
+		Drained  uint64 `json:"drained"`
+		// Failed is the number of the failed attempts to drain a request,
+		// and Discarded is the number of the requests discarded after
+		// the max retries, or because they are invalid.
+		Failed    uint64 `json:"failed"`
+		Discarded uint64 `json:"discarded"`
+		LastError string `json:"lastError,omitempty"`
+	}
+
+	// record is a request in the queue.
+	record struct {
+		Method string      `json:"method"`
+		URI    string      `json:"uri"`
+		Header http.Header `json:"header,omitempty"`
+		Body   []byte      `json:"body,omitempty"`
+		Time   time.Time   `json:"time"`
+	}
+)
+
+// Get returns the running LocalQueue of the name.
+func Get(name string) (*LocalQueue, bool) {
+	v, ok := queues.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return v.(*LocalQueue), true
+}
+
+// References returns the pipeline draining the LocalQueue.
+func (s *Spec) References() []string {
+	return []string{s.Pipeline}
+}
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	for _, d := range []string{s.MaxAge, s.RetryInterval} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d); err != nil {
+			return fmt.Errorf("invalid duration %q: %v", d, err)
+		}
+	}
+	return nil
+}
+
+// Category returns the category of LocalQueue.
+func (lq *LocalQueue) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of LocalQueue.
+func (lq *LocalQueue) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of LocalQueue.
+func (lq *LocalQueue) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// OverridableFields returns the fields of LocalQueue overridable on a member,
+// the directory and the disk usage of the host.
+func (lq *LocalQueue) OverridableFields() []string {
+	return []string{"dir", "segmentSize", "maxSize", "sync"}
+}
+
+// Init initializes LocalQueue.
+func (lq *LocalQueue) Init(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
+	lq.superSpec, lq.spec, lq.muxMapper = superSpec, superSpec.ObjectSpec().(*Spec), muxMapper
+	lq.reload(nil)
+}
+
+// Inherit inherits previous generation of LocalQueue, and the statistics
+// are kept. The new generation takes over the queue if the directory is
+// not changed, otherwise it opens the queue in the new directory before
+// the previous one is closed, so the requests are accepted all the time.
+func (lq *LocalQueue) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object, muxMapper context.MuxMapper) {
+	prev := previousGeneration.(*LocalQueue)
+
+	// only the drainer of the previous generation is stopped, its queue
+	// accepts the requests until the new generation replaces it.
+	close(prev.done)
+	prev.wg.Wait()
+
+	prev.lock.Lock()
+	lq.status = prev.status
+	prev.lock.Unlock()
+	lq.status.LastError = ""
+
+	lq.superSpec, lq.spec, lq.muxMapper = superSpec, superSpec.ObjectSpec().(*Spec), muxMapper
+	lq.reload(prev.queue)
+	if prev.queue != nil && prev.queue != lq.queue {
+		prev.queue.Close()
+	}
+}
+
+func (lq *LocalQueue) dir() string {
+	if lq.spec.Dir != "" {
+		return lq.spec.Dir
+	}
+	dataDir := ""
+	if super := lq.superSpec.Super(); super != nil {
+		dataDir = super.Options().AbsDataDir
+	}
+	return filepath.Join(dataDir, "localqueue", lq.superSpec.Name())
+}
+
+// reload opens the queue and starts draining it, the queue of the previous
+// generation is reused if it is in the same directory.
+func (lq *LocalQueue) reload(prev *diskqueue.Queue) {
+	lq.retryInterval = defaultRetryInterval
+	if lq.spec.RetryInterval != "" {
+		lq.retryInterval, _ = time.ParseDuration(lq.spec.RetryInterval)
+	}
+	opts := &diskqueue.Options{
+		Dir:         lq.dir(),
+		SegmentSize: lq.spec.SegmentSize,
+		MaxSize:     lq.spec.MaxSize,
+		Sync:        lq.spec.Sync,
+	}
+	if lq.spec.MaxAge != "" {
+		opts.MaxAge, _ = time.ParseDuration(lq.spec.MaxAge)
+	}
+
+	lq.done = make(chan struct{})
+	var err error
+	queue := prev
+	if queue != nil && queue.Dir() == opts.Dir {
+		err = queue.SetOptions(opts)
+	} else {
+		queue, err = diskqueue.Open(opts)
+	}
+	if err != nil {
+		logger.Errorf("%s: open queue in %s failed: %v", lq.superSpec.Name(), opts.Dir, err)
+		lq.status.LastError = err.Error()
+	} else {
+		lq.queue = queue
+		lq.wg.Add(1)
+		go lq.run()
+	}
+	queues.Store(lq.superSpec.Name(), lq)
+}
+
+// Enqueue appends the request to the queue, the payload of the request
+// must have been fetched.
+func (lq *LocalQueue) Enqueue(req *httpprot.Request) error {
+	if lq.queue == nil {
+		return fmt.Errorf("queue %s is not open", lq.superSpec.Name())
+	}
+	if req.IsStream() {
+		return fmt.Errorf("the payload is too large to enqueue")
+	}
+
+	rec := &record{
+		Method: req.Method(),
+		URI:    req.URL().RequestURI(),
+		Header: req.HTTPHeader(),
+		Body:   req.RawPayload(),
+		Time:   time.Now(),
+	}
+	data, err := codectool.MarshalJSON(rec)
+	if err != nil {
+		return err
+	}
+	if err = lq.queue.Append(data); err != nil {
+		return err
+	}
+
+	lq.lock.Lock()
+	lq.status.Enqueued++
+	lq.lock.Unlock()
+	return nil
+}
+
+// run drains the queue to the pipeline in order, a failed request is
+// retried before the following ones.
+func (lq *LocalQueue) run() {
+	defer lq.wg.Done()
+
+	ticker := time.NewTicker(retainInterval)
+	defer ticker.Stop()
+
+	retries := 0
+	for {
+		data, err := lq.queue.Peek()
+		if err == diskqueue.ErrEmpty {
+			select {
+			case <-lq.done:
+				return
+			case <-lq.queue.Notify():
+			case <-ticker.C:
+				lq.queue.Retain()
+			}
+			continue
+		}
+
+		if err == nil {
+			err = lq.drain(data)
+			if err == nil {
+				retries = 0
+				lq.queue.Commit()
+				continue
+			}
+		}
+
+		retries++
+		discard := lq.spec.MaxRetries > 0 && retries > lq.spec.MaxRetries
+		lq.lock.Lock()
+		lq.status.Failed++
+		lq.status.LastError = err.Error()
+		if discard {
+			lq.status.Discarded++
+		}
+		lq.lock.Unlock()
+
+		if discard {
+			logger.Errorf("%s: discard request after %d retries: %v", lq.superSpec.Name(), lq.spec.MaxRetries, err)
+			retries = 0
+			lq.queue.Commit()
+			continue
+		}
+
+		timer := time.NewTimer(lq.retryInterval)
+		select {
+		case <-lq.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// drain calls the pipeline with the request of the record.
+func (lq *LocalQueue) drain(data []byte) error {
+	rec := &record{}
+	if err := codectool.UnmarshalJSON(data, rec); err != nil {
+		// retrying doesn't help, so the record is discarded.
+		logger.Errorf("%s: discard invalid record: %v", lq.superSpec.Name(), err)
+		lq.lock.Lock()
+		lq.status.Discarded++
+		lq.lock.Unlock()
+		return nil
+	}
+
+	handler, ok := lq.muxMapper.GetHandler(lq.spec.Pipeline)
+	if !ok {
+		return fmt.Errorf("pipeline %s not found", lq.spec.Pipeline)
+	}
+
+	stdr, err := http.NewRequest(rec.Method, "http://"+lq.superSpec.Name()+rec.URI, bytes.NewReader(rec.Body))
+	if err != nil {
+		return err
+	}
+	stdr.Header = rec.Header
+	if stdr.Header == nil {
+		stdr.Header = http.Header{}
+	}
+	// httpprot.NewRequest never returns an error.
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+
+	ctx := context.New(tracing.NoopSpan)
+	defer ctx.Finish()
+	EnqueueTimeDataKey.Set(ctx, rec.Time)
+	ctx.SetRequest(context.DefaultNamespace, req)
+
+	result := handler.Handle(ctx)
+	statusCode := 0
+	if resp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response); ok {
+		statusCode = resp.StatusCode()
+	}
+	if result != "" || statusCode >= http.StatusBadRequest {
+		return fmt.Errorf("pipeline %s returns result %q, status code %d", lq.spec.Pipeline, result, statusCode)
+	}
+
+	lq.lock.Lock()
+	lq.status.Drained++
+	lq.lock.Unlock()
+	return nil
+}
+
+// Status returns the status of LocalQueue.
+func (lq *LocalQueue) Status() *supervisor.Status {
+	lq.lock.Lock()
+	status := lq.status
+	lq.lock.Unlock()
+
+	if lq.queue != nil {
+		status.Stats = lq.queue.Stats()
+	}
+	return &supervisor.Status{ObjectStatus: &status}
+}
+
+// Close closes LocalQueue.
+func (lq *LocalQueue) Close() {
+	queues.CompareAndDelete(lq.superSpec.Name(), lq)
+	close(lq.done)
+	lq.wg.Wait()
+	if lq.queue != nil {
+		lq.queue.Close()
+	}
+}
@@ -0,0 +1,244 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package localqueue
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/context/contexttest"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/diskqueue"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+type handlerFunc func(ctx *context.Context) string
+
+func (f handlerFunc) Handle(ctx *context.Context) string {
+	return f(ctx)
+}
+
+func newLocalQueue(t *testing.T, yamlConfig string, handlers map[string]context.Handler) *LocalQueue {
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(t, err)
+
+	mapper := &contexttest.MockedMuxMapper{
+		MockedGetHandler: func(name string) (context.Handler, bool) {
+			h, ok := handlers[name]
+			return h, ok
+		},
+	}
+	lq := &LocalQueue{}
+	lq.Init(superSpec, mapper)
+	return lq
+}
+
+func newRequest(t *testing.T, body string) *httpprot.Request {
+	stdr, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/events?source=test", strings.NewReader(body))
+	stdr.Header.Set("X-Event", body)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	req.FetchPayload(0)
+	return req
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Pipeline: "pipeline", MaxAge: "24h", RetryInterval: "1s"}
+	assert.NoError(spec.Validate())
+	spec.MaxAge = "1d"
+	assert.Error(spec.Validate())
+}
+
+func TestDrain(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlConfig := fmt.Sprintf(`
+name: queue
+kind: LocalQueue
+pipeline: pipeline
+dir: %s
+retryInterval: 10ms
+`, t.TempDir())
+
+	var lock sync.Mutex
+	var drained []string
+	failures := 1
+	handlers := map[string]context.Handler{
+		"pipeline": handlerFunc(func(ctx *context.Context) string {
+			req := ctx.GetRequest(context.DefaultNamespace).(*httpprot.Request)
+			assert.Equal("/events?source=test", req.URL().RequestURI())
+			_, ok := EnqueueTimeDataKey.Get(ctx)
+			assert.True(ok)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if string(req.RawPayload()) == "event-1" && failures > 0 {
+				failures--
+				return "failed"
+			}
+			drained = append(drained, req.HTTPHeader().Get("X-Event"))
+			return ""
+		}),
+	}
+
+	lq := newLocalQueue(t, yamlConfig, handlers)
+	got, ok := Get("queue")
+	assert.True(ok)
+	assert.Equal(lq, got)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(lq.Enqueue(newRequest(t, fmt.Sprintf("event-%d", i))))
+	}
+
+	assert.Eventually(func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(drained) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal([]string{"event-0", "event-1", "event-2"}, drained)
+
+	status := lq.Status().ObjectStatus.(*Status)
+	assert.Equal(uint64(3), status.Enqueued)
+	assert.Equal(uint64(3), status.Drained)
+	assert.Equal(uint64(1), status.Failed)
+	assert.Zero(status.Pending)
+
+	lq.Close()
+	_, ok = Get("queue")
+	assert.False(ok)
+}
+
+func TestRestart(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlConfig := fmt.Sprintf(`
+name: queue
+kind: LocalQueue
+pipeline: pipeline
+dir: %s
+retryInterval: 10ms
+`, t.TempDir())
+
+	// the pipeline is not ready, the requests are kept in the queue.
+	lq := newLocalQueue(t, yamlConfig, nil)
+	assert.NoError(lq.Enqueue(newRequest(t, "event-0")))
+	assert.NoError(lq.Enqueue(newRequest(t, "event-1")))
+	assert.Eventually(func() bool {
+		return lq.Status().ObjectStatus.(*Status).Failed > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	lq.Close()
+
+	drained := make(chan string, 2)
+	handlers := map[string]context.Handler{
+		"pipeline": handlerFunc(func(ctx *context.Context) string {
+			req := ctx.GetRequest(context.DefaultNamespace).(*httpprot.Request)
+			drained <- string(req.RawPayload())
+			return ""
+		}),
+	}
+	lq = newLocalQueue(t, yamlConfig, handlers)
+	defer lq.Close()
+	assert.Equal("event-0", <-drained)
+	assert.Equal("event-1", <-drained)
+}
+
+func TestMaxRetries(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlConfig := fmt.Sprintf(`
+name: queue
+kind: LocalQueue
+pipeline: pipeline
+dir: %s
+retryInterval: 10ms
+maxRetries: 2
+`, t.TempDir())
+
+	handlers := map[string]context.Handler{
+		"pipeline": handlerFunc(func(ctx *context.Context) string {
+			resp, _ := httpprot.NewResponse(nil)
+			resp.SetStatusCode(http.StatusBadRequest)
+			ctx.SetResponse(context.DefaultNamespace, resp)
+			return ""
+		}),
+	}
+	lq := newLocalQueue(t, yamlConfig, handlers)
+	defer lq.Close()
+
+	assert.NoError(lq.Enqueue(newRequest(t, "event-0")))
+	assert.Eventually(func() bool {
+		return lq.Status().ObjectStatus.(*Status).Discarded == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status := lq.Status().ObjectStatus.(*Status)
+	assert.Equal(uint64(3), status.Failed)
+	assert.Contains(status.LastError, "status code 400")
+}
+
+func TestInherit(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+name: queue
+kind: LocalQueue
+pipeline: pipeline
+dir: %s
+retryInterval: %s
+`
+	dir := t.TempDir()
+
+	// the pipeline is not ready, the request is kept in the queue.
+	lq := newLocalQueue(t, fmt.Sprintf(yamlConfig, dir, "10ms"), nil)
+	assert.NoError(lq.Enqueue(newRequest(t, "event-0")))
+
+	// the queue in the same directory is taken over.
+	superSpec, err := supervisor.NewSpec(fmt.Sprintf(yamlConfig, dir, "20ms"))
+	assert.NoError(err)
+	lq2 := &LocalQueue{}
+	lq2.Inherit(superSpec, lq, lq.muxMapper)
+	assert.Same(lq.queue, lq2.queue)
+	assert.Equal(uint64(1), lq2.Status().ObjectStatus.(*Status).Enqueued)
+	got, ok := Get("queue")
+	assert.True(ok)
+	assert.Equal(lq2, got)
+
+	// the queue in another directory is opened before the previous one is
+	// closed.
+	superSpec, err = supervisor.NewSpec(fmt.Sprintf(yamlConfig, t.TempDir(), "20ms"))
+	assert.NoError(err)
+	lq3 := &LocalQueue{}
+	lq3.Inherit(superSpec, lq2, lq2.muxMapper)
+	defer lq3.Close()
+	assert.NotSame(lq2.queue, lq3.queue)
+	assert.Equal(diskqueue.ErrClosed, lq2.queue.Append([]byte("event-1")))
+	assert.NoError(lq3.Enqueue(newRequest(t, "event-1")))
+}
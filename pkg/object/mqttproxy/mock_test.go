@@ -51,6 +51,7 @@ func (m *mockCluster) GetRawPrefix(prefix string) (map[string]*mvccpb.KeyValue,
 }
 func (m *mockCluster) PutUnderLease(key, value string) error                          { return nil }
 func (m *mockCluster) PutUnderTimeout(key, value string, timeout time.Duration) error { return nil }
+func (m *mockCluster) GrantLease(ttl time.Duration) (clientv3.LeaseID, error)         { return 0, nil }
 func (m *mockCluster) PutAndDelete(map[string]*string) error                          { return nil }
 func (m *mockCluster) PutAndDeleteUnderLease(map[string]*string) error                { return nil }
 func (m *mockCluster) DeletePrefix(prefix string) error                               { return nil }
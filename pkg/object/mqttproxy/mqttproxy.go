@@ -76,6 +76,12 @@ func (mp *MQTTProxy) DefaultSpec() interface{} {
 	return &Spec{}
 }
 
+// OverridableFields returns the fields of MQTTProxy overridable on a member,
+// the port and the limits of the host.
+func (mp *MQTTProxy) OverridableFields() []string {
+	return []string{"port", "maxAllowedConnection", "topicCacheSize"}
+}
+
 // Status returns the Status of MQTTProxy.
 func (mp *MQTTProxy) Status() *supervisor.Status {
 	return &supervisor.Status{}
@@ -122,6 +122,15 @@ func (spec *Spec) tlsConfig() (*tls.Config, error) {
 	return &tls.Config{Certificates: certificates}, nil
 }
 
+// References returns the pipelines in the rules.
+func (spec *Spec) References() []string {
+	var names []string
+	for _, rule := range spec.Rules {
+		names = append(names, rule.Pipeline)
+	}
+	return names
+}
+
 func sessionStoreKey(clientID string) string {
 	return fmt.Sprintf(sessionPrefix, clientID)
 }
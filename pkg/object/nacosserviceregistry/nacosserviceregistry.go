@@ -89,6 +89,7 @@ type (
 		Namespace    string        `json:"namespace,omitempty"`
 		Username     string        `json:"username,omitempty"`
 		Password     string        `json:"password,omitempty"`
+		GroupName    string        `json:"groupName,omitempty"`
 	}
 
 	// ServerSpec is the server config of Nacos.
@@ -406,6 +407,7 @@ func (n *NacosServiceRegistry) ListServiceInstances(serviceName string) (map[str
 
 	service, err := client.GetService(vo.GetServiceParam{
 		ServiceName: serviceName,
+		GroupName:   n.spec.GroupName,
 	})
 	if err != nil {
 		return nil, err
@@ -413,6 +415,10 @@ func (n *NacosServiceRegistry) ListServiceInstances(serviceName string) (map[str
 
 	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
 	for _, nacosInstance := range service.Hosts {
+		if !nacosInstance.Enable || !nacosInstance.Healthy {
+			continue
+		}
+
 		serviceInstance := n.nacosInstanceToServiceInstance(&nacosInstance)
 		err := serviceInstance.Validate()
 		if err != nil {
@@ -438,8 +444,9 @@ func (n *NacosServiceRegistry) ListAllServiceInstances() (map[string]*servicereg
 	var pageSize uint32 = 1000
 	for {
 		services, err := client.GetAllServicesInfo(vo.GetAllServiceInfoParam{
-			PageNo:   pageNo,
-			PageSize: pageSize,
+			PageNo:    pageNo,
+			PageSize:  pageSize,
+			GroupName: n.spec.GroupName,
 		})
 		if err != nil {
 			return nil, fmt.Errorf("%s pull services failed: %v",
@@ -458,12 +465,17 @@ func (n *NacosServiceRegistry) ListAllServiceInstances() (map[string]*servicereg
 	for _, serviceName := range serviceNames {
 		service, err := client.GetService(vo.GetServiceParam{
 			ServiceName: serviceName,
+			GroupName:   n.spec.GroupName,
 		})
 		if err != nil {
 			return nil, err
 		}
 
 		for _, nacosInstance := range service.Hosts {
+			if !nacosInstance.Enable || !nacosInstance.Healthy {
+				continue
+			}
+
 			serviceInstance := n.nacosInstanceToServiceInstance(&nacosInstance)
 			err := serviceInstance.Validate()
 			if err != nil {
@@ -484,6 +496,7 @@ func (n *NacosServiceRegistry) serviceInstanceToRegisterInstance(instance *servi
 			MetaKeyInstanceID:   instance.InstanceID,
 		},
 		ServiceName: instance.ServiceName,
+		GroupName:   n.spec.GroupName,
 
 		Ip:      instance.Address,
 		Port:    uint64(instance.Port),
@@ -496,6 +509,7 @@ func (n *NacosServiceRegistry) serviceInstanceToRegisterInstance(instance *servi
 func (n *NacosServiceRegistry) serviceInstanceToDeregisterInstance(instance *serviceregistry.ServiceInstanceSpec) *vo.DeregisterInstanceParam {
 	return &vo.DeregisterInstanceParam{
 		ServiceName: instance.ServiceName,
+		GroupName:   n.spec.GroupName,
 		Ip:          instance.Address,
 		Port:        uint64(instance.Port),
 	}
@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	// AdaptiveAlgorithmAIMD increases the limit by one if the latency is
+	// below the threshold, and decreases it by the backoff ratio otherwise.
+	AdaptiveAlgorithmAIMD = "aimd"
+	// AdaptiveAlgorithmGradient adjusts the limit by the gradient of the
+	// long-term average latency to the current latency.
+	AdaptiveAlgorithmGradient = "gradient"
+
+	defaultAdaptiveMinLimit     = 1
+	defaultAdaptiveMaxLimit     = 1000
+	defaultAdaptiveBackoffRatio = 0.9
+	defaultAdaptiveTolerance    = 1.5
+	defaultAdaptiveSmoothing    = 0.2
+
+	// gradientLongWindow is the number of samples of the long-term average
+	// latency of the gradient algorithm.
+	gradientLongWindow = 600
+)
+
+type (
+	// AdaptiveConcurrencySpec describes how to adjust the concurrency limit
+	// by the latency of the tasks.
+	AdaptiveConcurrencySpec struct {
+		Algorithm string `json:"algorithm" jsonschema:"required,enum=aimd,enum=gradient"`
+		MinLimit  int    `json:"minLimit,omitempty" jsonschema:"minimum=1"`
+		MaxLimit  int    `json:"maxLimit,omitempty" jsonschema:"minimum=1"`
+
+		// LatencyThreshold is required by AIMD, a task taking longer than
+		// it is regarded as a sign of overload.
+		LatencyThreshold string `json:"latencyThreshold,omitempty" jsonschema:"format=duration"`
+		// BackoffRatio is used by AIMD to decrease the limit, default is 0.9.
+		BackoffRatio float64 `json:"backoffRatio,omitempty" jsonschema:"exclusiveMinimum=0,exclusiveMaximum=1"`
+
+		// Tolerance is used by the gradient algorithm, the limit is not
+		// decreased until the current latency exceeds the long-term
+		// average latency by this ratio, default is 1.5.
+		Tolerance float64 `json:"tolerance,omitempty" jsonschema:"minimum=1"`
+		// Smoothing is used by the gradient algorithm, a smaller value
+		// makes the limit change slower, default is 0.2.
+		Smoothing float64 `json:"smoothing,omitempty" jsonschema:"exclusiveMinimum=0,maximum=1"`
+	}
+
+	// limitAlgorithm calculates the new limit when a task completes.
+	limitAlgorithm interface {
+		update(limit float64, latency time.Duration, inflight int) float64
+	}
+
+	aimdAlgorithm struct {
+		spec      *AdaptiveConcurrencySpec
+		threshold time.Duration
+	}
+
+	gradientAlgorithm struct {
+		spec *AdaptiveConcurrencySpec
+		// longLatency is the exponential moving average of the latency in
+		// nanoseconds.
+		longLatency float64
+		samples     int
+	}
+)
+
+// Validate validates AdaptiveConcurrencySpec.
+func (s *AdaptiveConcurrencySpec) Validate() error {
+	switch s.Algorithm {
+	case AdaptiveAlgorithmAIMD:
+		d, err := time.ParseDuration(s.LatencyThreshold)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid latencyThreshold %q", s.LatencyThreshold)
+		}
+		if s.BackoffRatio < 0 || s.BackoffRatio >= 1 {
+			return fmt.Errorf("backoffRatio must be in (0, 1)")
+		}
+	case AdaptiveAlgorithmGradient:
+		if s.Tolerance != 0 && s.Tolerance < 1 {
+			return fmt.Errorf("tolerance must not be less than 1")
+		}
+		if s.Smoothing < 0 || s.Smoothing > 1 {
+			return fmt.Errorf("smoothing must be in (0, 1]")
+		}
+	default:
+		return fmt.Errorf("invalid algorithm %q", s.Algorithm)
+	}
+
+	if s.MinLimit < 0 || s.MaxLimit < 0 {
+		return fmt.Errorf("minLimit and maxLimit must not be negative")
+	}
+	if s.MaxLimit != 0 && s.MinLimit > s.MaxLimit {
+		return fmt.Errorf("minLimit is greater than maxLimit")
+	}
+	return nil
+}
+
+func newLimitAlgorithm(spec *AdaptiveConcurrencySpec) limitAlgorithm {
+	s := *spec
+	if s.MinLimit == 0 {
+		s.MinLimit = defaultAdaptiveMinLimit
+	}
+	if s.MaxLimit == 0 {
+		s.MaxLimit = defaultAdaptiveMaxLimit
+	}
+
+	switch s.Algorithm {
+	case AdaptiveAlgorithmAIMD:
+		if s.BackoffRatio == 0 {
+			s.BackoffRatio = defaultAdaptiveBackoffRatio
+		}
+		threshold, _ := time.ParseDuration(s.LatencyThreshold)
+		return &aimdAlgorithm{spec: &s, threshold: threshold}
+	default:
+		if s.Tolerance == 0 {
+			s.Tolerance = defaultAdaptiveTolerance
+		}
+		if s.Smoothing == 0 {
+			s.Smoothing = defaultAdaptiveSmoothing
+		}
+		return &gradientAlgorithm{spec: &s}
+	}
+}
+
+func clampLimit(spec *AdaptiveConcurrencySpec, limit float64) float64 {
+	return math.Min(math.Max(limit, float64(spec.MinLimit)), float64(spec.MaxLimit))
+}
+
+func (a *aimdAlgorithm) update(limit float64, latency time.Duration, inflight int) float64 {
+	if latency > a.threshold {
+		limit *= a.spec.BackoffRatio
+	} else if float64(inflight) >= limit/2 {
+		// only increase the limit if it is really used, otherwise it grows
+		// endlessly under light load.
+		limit++
+	}
+	return clampLimit(a.spec, limit)
+}
+
+func (g *gradientAlgorithm) update(limit float64, latency time.Duration, inflight int) float64 {
+	short := float64(latency)
+	if short <= 0 {
+		return limit
+	}
+
+	if g.samples < gradientLongWindow {
+		g.samples++
+	}
+	g.longLatency += (short - g.longLatency) / float64(g.samples)
+
+	// the long-term average drifts up during a long overload, pull it
+	// back so the limit could recover.
+	if g.longLatency/short > 2 {
+		g.longLatency *= 0.95
+	}
+
+	if float64(inflight) < limit/2 {
+		return limit
+	}
+
+	gradient := math.Max(0.5, math.Min(1, g.spec.Tolerance*g.longLatency/short))
+	// the queue size allows the limit to grow when the latency is stable.
+	newLimit := limit*gradient + math.Sqrt(limit)
+	newLimit = limit*(1-g.spec.Smoothing) + newLimit*g.spec.Smoothing
+	return clampLimit(g.spec, newLimit)
+}
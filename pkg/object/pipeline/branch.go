@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/invopop/jsonschema"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+)
+
+type (
+	// FlowBranch is a branch of a flow node, the flow of the first branch
+	// whose condition matches is executed.
+	FlowBranch struct {
+		// When is the condition of the branch, a branch without condition
+		// always matches, so it should be the last one.
+		When *BranchCondition `json:"when,omitempty"`
+		Flow []FlowNode       `json:"flow" jsonschema:"required"`
+	}
+
+	// BranchCondition is the condition of a branch, it matches only if all
+	// of its fields match.
+	BranchCondition struct {
+		// Namespace is the namespace of the request and response to match,
+		// default is the default namespace.
+		Namespace string `json:"namespace,omitempty"`
+		// Headers matches the headers of the request.
+		Headers map[string]*stringtool.StringMatcher `json:"headers,omitempty"`
+		// StatusCodes matches the status code of the response.
+		StatusCodes []int `json:"statusCodes,omitempty" jsonschema:"uniqueItems=true"`
+		// Results matches the results of the filters executed before, the
+		// keys are the names or aliases of the filters. An empty string
+		// stands for a successful result.
+		Results map[string][]string `json:"results,omitempty"`
+	}
+)
+
+// JSONSchema returns the JSON schema of FlowBranch. The schema can't be
+// generated by reflection as FlowBranch and FlowNode refer to each other,
+// the nodes of the flow are checked by validateFlow instead.
+func (FlowBranch) JSONSchema() *jsonschema.Schema {
+	props := jsonschema.NewProperties()
+	props.Set("when", &jsonschema.Schema{Type: "object"})
+	props.Set("flow", &jsonschema.Schema{
+		Type:  "array",
+		Items: &jsonschema.Schema{Type: "object"},
+	})
+	return &jsonschema.Schema{
+		Type:       "object",
+		Properties: props,
+		Required:   []string{"flow"},
+	}
+}
+
+// Validate validates BranchCondition.
+func (c *BranchCondition) Validate() error {
+	for k, m := range c.Headers {
+		if m == nil {
+			return fmt.Errorf("header %s: matcher is empty", k)
+		}
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("header %s: %v", k, err)
+		}
+	}
+	for k, v := range c.Results {
+		if len(v) == 0 {
+			return fmt.Errorf("results of filter %s are empty", k)
+		}
+	}
+	return nil
+}
+
+func (c *BranchCondition) init() {
+	for _, m := range c.Headers {
+		m.Init()
+	}
+}
+
+func (c *BranchCondition) match(ctx *context.Context, stats []FilterStat) bool {
+	ns := c.Namespace
+	if ns == "" {
+		ns = context.DefaultNamespace
+	}
+
+	if len(c.Headers) > 0 {
+		req := ctx.GetRequest(ns)
+		if req == nil {
+			return false
+		}
+		h := req.Header()
+		for k, m := range c.Headers {
+			switch v := h.Get(k).(type) {
+			case string:
+				if !m.Match(v) {
+					return false
+				}
+			case []string:
+				if !m.MatchAny(v) {
+					return false
+				}
+			default:
+				if !m.Match("") {
+					return false
+				}
+			}
+		}
+	}
+
+	if len(c.StatusCodes) > 0 {
+		resp, ok := ctx.GetResponse(ns).(interface{ StatusCode() int })
+		if !ok {
+			return false
+		}
+		code := resp.StatusCode()
+		found := false
+		for _, sc := range c.StatusCodes {
+			if sc == code {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for name, results := range c.Results {
+		if !matchResult(stats, name, results) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchResult checks the result of the last execution of the filter.
+func matchResult(stats []FilterStat, name string, results []string) bool {
+	for i := len(stats) - 1; i >= 0; i-- {
+		if stats[i].Name != name {
+			continue
+		}
+		return stringtool.StrInSlice(stats[i].Result, results)
+	}
+	return false
+}
+
+// chooseBranch returns the first branch whose condition matches, or nil
+// if none matches.
+func (fn *FlowNode) chooseBranch(ctx *context.Context, stats []FilterStat) *FlowBranch {
+	for _, b := range fn.Branches {
+		if b.When == nil || b.When.match(ctx, stats) {
+			return b
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"container/list"
+	stdcontext "context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// OverflowPolicyReject rejects the new task if the queue is full.
+	OverflowPolicyReject = "reject"
+	// OverflowPolicyShedOldest sheds the oldest task in the queue to make
+	// room for the new task if the queue is full.
+	OverflowPolicyShedOldest = "shedOldest"
+)
+
+type (
+	// ConcurrencySpec limits the number of tasks handled by the pipeline
+	// concurrently, the tasks exceeding the limit wait in a queue.
+	ConcurrencySpec struct {
+		// MaxInflight is the initial limit if Adaptive is set.
+		MaxInflight int `json:"maxInflight" jsonschema:"required,minimum=1"`
+		// MaxQueue is the max number of tasks waiting in the queue, the
+		// tasks are rejected at once if it is zero.
+		MaxQueue int `json:"maxQueue,omitempty" jsonschema:"minimum=0"`
+		// QueueTimeout is the max duration a task waits in the queue,
+		// the task is only limited by the pipeline timeout if it is empty.
+		QueueTimeout   string `json:"queueTimeout,omitempty" jsonschema:"format=duration"`
+		OverflowPolicy string `json:"overflowPolicy,omitempty" jsonschema:"enum=,enum=reject,enum=shedOldest"`
+		// Adaptive adjusts the limit by the latency of the tasks, the
+		// limit is static if it is nil.
+		Adaptive *AdaptiveConcurrencySpec `json:"adaptive,omitempty"`
+	}
+
+	// ConcurrencyStatus is the status of the concurrency limiter.
+	ConcurrencyStatus struct {
+		Limit      int    `json:"limit"`
+		Inflight   int    `json:"inflight"`
+		QueueDepth int    `json:"queueDepth"`
+		Rejected   uint64 `json:"rejected"`
+		Shed       uint64 `json:"shed"`
+		TimedOut   uint64 `json:"timedOut"`
+	}
+
+	concurrencyLimiter struct {
+		spec         *ConcurrencySpec
+		queueTimeout time.Duration
+		algorithm    limitAlgorithm
+
+		lock     sync.Mutex
+		limit    float64
+		inflight int
+		queue    *list.List
+		rejected uint64
+		shed     uint64
+		timedOut uint64
+	}
+
+	// waiter is a task waiting in the queue, true is sent to ready if the
+	// task could run, and false if it is shed.
+	waiter struct {
+		ready chan bool
+	}
+)
+
+// Validate validates ConcurrencySpec.
+func (s *ConcurrencySpec) Validate() error {
+	if s.MaxInflight <= 0 {
+		return fmt.Errorf("maxInflight must be greater than 0")
+	}
+	if s.QueueTimeout != "" {
+		if d, err := time.ParseDuration(s.QueueTimeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid queueTimeout %s", s.QueueTimeout)
+		}
+	}
+	switch s.OverflowPolicy {
+	case "", OverflowPolicyReject, OverflowPolicyShedOldest:
+	default:
+		return fmt.Errorf("invalid overflowPolicy %s", s.OverflowPolicy)
+	}
+	if s.Adaptive != nil {
+		if err := s.Adaptive.Validate(); err != nil {
+			return fmt.Errorf("adaptive: %v", err)
+		}
+	}
+	return nil
+}
+
+func newConcurrencyLimiter(spec *ConcurrencySpec) *concurrencyLimiter {
+	l := &concurrencyLimiter{
+		spec:  spec,
+		queue: list.New(),
+		limit: float64(spec.MaxInflight),
+	}
+	if spec.QueueTimeout != "" {
+		l.queueTimeout, _ = time.ParseDuration(spec.QueueTimeout)
+	}
+	if spec.Adaptive != nil {
+		l.algorithm = newLimitAlgorithm(spec.Adaptive)
+	}
+	return l
+}
+
+// acquire acquires a slot to run a task, it waits in the queue if there is
+// no free slot, and returns false if the task is rejected, shed or timed
+// out. deadline could be nil.
+func (l *concurrencyLimiter) acquire(deadline stdcontext.Context) bool {
+	l.lock.Lock()
+	if l.inflight < int(l.limit) {
+		l.inflight++
+		l.lock.Unlock()
+		return true
+	}
+
+	if l.queue.Len() >= l.spec.MaxQueue {
+		if l.spec.OverflowPolicy != OverflowPolicyShedOldest || l.queue.Len() == 0 {
+			l.rejected++
+			l.lock.Unlock()
+			return false
+		}
+		oldest := l.queue.Remove(l.queue.Front()).(*waiter)
+		oldest.ready <- false
+		l.shed++
+	}
+
+	w := &waiter{ready: make(chan bool, 1)}
+	e := l.queue.PushBack(w)
+	l.lock.Unlock()
+
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var done <-chan struct{}
+	if deadline != nil {
+		done = deadline.Done()
+	}
+
+	select {
+	case ok := <-w.ready:
+		return ok
+	case <-timeout:
+	case <-done:
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	// the waiter has been removed from the queue, it is either ready or
+	// shed when the timer fires.
+	select {
+	case ok := <-w.ready:
+		return ok
+	default:
+	}
+
+	l.queue.Remove(e)
+	l.timedOut++
+	return false
+}
+
+// release releases the slot of a task which takes latency to complete, and
+// hands the free slots over to the tasks in the queue.
+func (l *concurrencyLimiter) release(latency time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.algorithm != nil {
+		l.limit = l.algorithm.update(l.limit, latency, l.inflight)
+	}
+	l.inflight--
+
+	for l.queue.Len() > 0 && l.inflight < int(l.limit) {
+		w := l.queue.Remove(l.queue.Front()).(*waiter)
+		w.ready <- true
+		l.inflight++
+	}
+}
+
+func (l *concurrencyLimiter) status() *ConcurrencyStatus {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return &ConcurrencyStatus{
+		Limit:      int(l.limit),
+		Inflight:   l.inflight,
+		QueueDepth: l.queue.Len(),
+		Rejected:   l.rejected,
+		Shed:       l.shed,
+		TimedOut:   l.timedOut,
+	}
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+)
+
+// validateData checks the task data declared by the filters, the data read
+// by a filter must be written by a filter before it in the flow, provided
+// by the caller or written by the runtime, and the types must match. So a
+// misspelled key fails at config time instead of at runtime. The keys
+// configured by users may be written by the filters not declaring their
+// data, so only their types are checked.
+func (s *Spec) validateData(specs map[string]filters.Spec, names []string) {
+	written := map[string]context.DataDecl{}
+	for _, name := range s.DataInputs {
+		written[name] = context.AnyData(name)
+	}
+
+	if len(s.Flow) == 0 {
+		errorFilters := s.errorFilters()
+		for _, name := range names {
+			if !errorFilters[name] {
+				checkFilterData(specs[name], written)
+			}
+		}
+	} else {
+		checkFlowData(s.Flow, specs, written)
+	}
+
+	// the error flow could start after any filter of the flow, so the data
+	// written by the flow may be missing, but it is the best we could check.
+	if s.OnError != nil {
+		checkFlowData(s.OnError.Flow, specs, written)
+	}
+}
+
+func checkFlowData(flow []FlowNode, specs map[string]filters.Spec, written map[string]context.DataDecl) {
+	for i := range flow {
+		node := &flow[i]
+		if len(node.Branches) == 0 {
+			if node.FilterName != BuiltInFilterEnd {
+				checkFilterData(specs[node.FilterName], written)
+			}
+			continue
+		}
+
+		// the data written by any of the branches is regarded as written
+		// after the branches.
+		merged := map[string]context.DataDecl{}
+		for _, b := range node.Branches {
+			bw := make(map[string]context.DataDecl, len(written))
+			for k, v := range written {
+				bw[k] = v
+			}
+			checkFlowData(b.Flow, specs, bw)
+			for k, v := range bw {
+				merged[k] = v
+			}
+		}
+		for k, v := range merged {
+			written[k] = v
+		}
+	}
+}
+
+func checkFilterData(spec filters.Spec, written map[string]context.DataDecl) {
+	ds, ok := spec.(filters.DataSpec)
+	if !ok {
+		return
+	}
+
+	for _, in := range ds.DataInputs() {
+		w, ok := written[in.Name]
+		if !ok {
+			w, ok = context.GetRuntimeData(in.Name)
+		}
+		if !ok {
+			if in.User {
+				continue
+			}
+			panic(fmt.Errorf("filter %s: data %s is not written before it", spec.Name(), in.Name))
+		}
+		if !in.Accepts(w) {
+			msgFmt := "filter %s: data %s is written as %s, but read as %s"
+			panic(fmt.Errorf(msgFmt, spec.Name(), in.Name, w.Type, in.Type))
+		}
+	}
+
+	for _, out := range ds.DataOutputs() {
+		written[out.Name] = out
+	}
+}
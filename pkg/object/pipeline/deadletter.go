@@ -0,0 +1,394 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/Shopify/sarama"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+)
+
+const (
+	deadLetterQueueSize      = 1024
+	defaultDeadLetterTimeout = 10 * time.Second
+)
+
+type (
+	// DeadLetterSpec describes where to send the failed tasks, only one of
+	// the targets could be specified.
+	DeadLetterSpec struct {
+		// Results are the results of the pipeline regarded as failures,
+		// any non-empty result is a failure if it is empty.
+		Results []string `json:"results,omitempty" jsonschema:"uniqueItems=true"`
+		// StatusCodes are the status codes of the response regarded as
+		// failures.
+		StatusCodes []int `json:"statusCodes,omitempty" jsonschema:"uniqueItems=true"`
+
+		File  *DeadLetterFileSpec  `json:"file,omitempty"`
+		Kafka *DeadLetterKafkaSpec `json:"kafka,omitempty"`
+		HTTP  *DeadLetterHTTPSpec  `json:"http,omitempty"`
+	}
+
+	// DeadLetterFileSpec appends the dead letters to a file, one per line.
+	DeadLetterFileSpec struct {
+		Path string `json:"path" jsonschema:"required"`
+	}
+
+	// DeadLetterKafkaSpec sends the dead letters to a Kafka topic.
+	DeadLetterKafkaSpec struct {
+		Backend []string `json:"backend" jsonschema:"required,uniqueItems=true"`
+		Topic   string   `json:"topic" jsonschema:"required"`
+	}
+
+	// DeadLetterHTTPSpec posts the dead letters to an HTTP endpoint.
+	DeadLetterHTTPSpec struct {
+		URL     string            `json:"url" jsonschema:"required,format=uri"`
+		Headers map[string]string `json:"headers,omitempty"`
+		Timeout string            `json:"timeout,omitempty" jsonschema:"format=duration"`
+	}
+
+	// DeadLetter is a failed task and the metadata of the failure, it
+	// could be replayed later.
+	DeadLetter struct {
+		Pipeline   string             `json:"pipeline"`
+		Time       string             `json:"time"`
+		Result     string             `json:"result,omitempty"`
+		StatusCode int                `json:"statusCode,omitempty"`
+		Stats      string             `json:"stats,omitempty"`
+		Request    *DeadLetterRequest `json:"request,omitempty"`
+	}
+
+	// DeadLetterRequest is the HTTP request of a failed task, as it was
+	// when the task entered the pipeline.
+	DeadLetterRequest struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header,omitempty"`
+		Body   []byte      `json:"body,omitempty"`
+	}
+
+	// DeadLetterStatus is the status of the dead letter queue.
+	DeadLetterStatus struct {
+		Sent    uint64 `json:"sent"`
+		Failed  uint64 `json:"failed"`
+		Dropped uint64 `json:"dropped"`
+	}
+
+	deadLetterSink interface {
+		send(data []byte) error
+		close()
+	}
+
+	// deadLetterQueue sends the dead letters in background, so the tasks
+	// are not blocked by a slow target. The dead letters are dropped if
+	// the queue is full.
+	deadLetterQueue struct {
+		spec *DeadLetterSpec
+		sink deadLetterSink
+		ch   chan []byte
+		done chan struct{}
+
+		sent    uint64
+		failed  uint64
+		dropped uint64
+	}
+
+	fileSink struct {
+		spec *DeadLetterFileSpec
+		f    *os.File
+	}
+
+	kafkaSink struct {
+		name     string
+		spec     *DeadLetterKafkaSpec
+		producer sarama.SyncProducer
+	}
+
+	httpSink struct {
+		spec   *DeadLetterHTTPSpec
+		client *http.Client
+	}
+)
+
+// Validate validates DeadLetterSpec.
+func (s *DeadLetterSpec) Validate() error {
+	targets := 0
+	if s.File != nil {
+		targets++
+	}
+	if s.Kafka != nil {
+		targets++
+	}
+	if s.HTTP != nil {
+		targets++
+		if _, err := url.Parse(s.HTTP.URL); err != nil {
+			return fmt.Errorf("invalid url %s: %v", s.HTTP.URL, err)
+		}
+		if s.HTTP.Timeout != "" {
+			if d, err := time.ParseDuration(s.HTTP.Timeout); err != nil || d <= 0 {
+				return fmt.Errorf("invalid timeout %s", s.HTTP.Timeout)
+			}
+		}
+	}
+	if targets != 1 {
+		return fmt.Errorf("exactly one of file, kafka and http is required")
+	}
+	return nil
+}
+
+// isFailure reports whether a task is failed by its result and the status
+// code of its response.
+func (s *DeadLetterSpec) isFailure(result string, statusCode int) bool {
+	if result != "" && (len(s.Results) == 0 || stringtool.StrInSlice(result, s.Results)) {
+		return true
+	}
+	for _, code := range s.StatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func newDeadLetterQueue(name string, spec *DeadLetterSpec) *deadLetterQueue {
+	q := &deadLetterQueue{
+		spec: spec,
+		ch:   make(chan []byte, deadLetterQueueSize),
+		done: make(chan struct{}),
+	}
+
+	switch {
+	case spec.File != nil:
+		q.sink = &fileSink{spec: spec.File}
+	case spec.Kafka != nil:
+		q.sink = &kafkaSink{name: name, spec: spec.Kafka}
+	default:
+		timeout := defaultDeadLetterTimeout
+		if spec.HTTP.Timeout != "" {
+			timeout, _ = time.ParseDuration(spec.HTTP.Timeout)
+		}
+		q.sink = &httpSink{spec: spec.HTTP, client: &http.Client{Timeout: timeout}}
+	}
+
+	go q.run()
+	return q
+}
+
+func (q *deadLetterQueue) run() {
+	defer q.sink.close()
+
+	for {
+		select {
+		case <-q.done:
+			// send the dead letters already in the queue.
+			for {
+				select {
+				case data := <-q.ch:
+					q.send(data)
+				default:
+					return
+				}
+			}
+		case data := <-q.ch:
+			q.send(data)
+		}
+	}
+}
+
+func (q *deadLetterQueue) send(data []byte) {
+	if err := q.sink.send(data); err != nil {
+		logger.Errorf("send dead letter failed: %v", err)
+		atomic.AddUint64(&q.failed, 1)
+		return
+	}
+	atomic.AddUint64(&q.sent, 1)
+}
+
+func (q *deadLetterQueue) push(dl *DeadLetter) {
+	data, err := codectool.MarshalJSON(dl)
+	if err != nil {
+		logger.Errorf("marshal dead letter failed: %v", err)
+		atomic.AddUint64(&q.failed, 1)
+		return
+	}
+
+	select {
+	case q.ch <- data:
+	default:
+		atomic.AddUint64(&q.dropped, 1)
+	}
+}
+
+func (q *deadLetterQueue) status() *DeadLetterStatus {
+	return &DeadLetterStatus{
+		Sent:    atomic.LoadUint64(&q.sent),
+		Failed:  atomic.LoadUint64(&q.failed),
+		Dropped: atomic.LoadUint64(&q.dropped),
+	}
+}
+
+func (q *deadLetterQueue) close() {
+	close(q.done)
+}
+
+// newDeadLetterRequest copies the HTTP request of the task, it returns nil for
+// the requests of other protocols. The credentials in the headers are
+// redacted, and the payload is shared as the filters replace it instead of
+// modifying it.
+func newDeadLetterRequest(ctx *context.Context) *DeadLetterRequest {
+	req, ok := ctx.GetRequest(context.DefaultNamespace).(*httpprot.Request)
+	if !ok {
+		return nil
+	}
+
+	dlr := &DeadLetterRequest{
+		Method: req.Method(),
+		URL:    req.URL().String(),
+		Header: RedactHeader(req.HTTPHeader()),
+	}
+	if !req.IsStream() {
+		dlr.Body = req.RawPayload()
+	}
+	return dlr
+}
+
+// The sinks create their resources on the first send, so an unavailable
+// target does not prevent the pipeline from starting.
+
+func (s *fileSink) send(data []byte) error {
+	if s.f == nil {
+		// the dead letters contain the bodies of the requests, they are
+		// only readable by the owner.
+		if err := os.MkdirAll(filepath.Dir(s.spec.Path), 0o700); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(s.spec.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		s.f = f
+	}
+	_, err := s.f.Write(append(data, '\n'))
+	return err
+}
+
+func (s *fileSink) close() {
+	if s.f != nil {
+		s.f.Close()
+	}
+}
+
+func (s *kafkaSink) send(data []byte) error {
+	if s.producer == nil {
+		config := sarama.NewConfig()
+		config.ClientID = s.name
+		config.Version = sarama.V1_0_0_0
+		config.Producer.Return.Successes = true
+		producer, err := sarama.NewSyncProducer(s.spec.Backend, config)
+		if err != nil {
+			return err
+		}
+		s.producer = producer
+	}
+
+	_, _, err := s.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: s.spec.Topic,
+		Key:   sarama.StringEncoder(s.name),
+		Value: sarama.ByteEncoder(data),
+	})
+	return err
+}
+
+func (s *kafkaSink) close() {
+	if s.producer != nil {
+		if err := s.producer.Close(); err != nil {
+			logger.Errorf("close kafka producer failed: %v", err)
+		}
+	}
+}
+
+func (s *httpSink) send(data []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.spec.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.spec.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpSink) close() {
+	s.client.CloseIdleConnections()
+}
+
+// snapshotRequest returns the request of the task for the dead letter and
+// the error flow, it returns nil if the pipeline has neither of them.
+func (p *Pipeline) snapshotRequest(ctx *context.Context) *DeadLetterRequest {
+	if p.deadLetter == nil && p.spec.OnError == nil {
+		return nil
+	}
+	return newDeadLetterRequest(ctx)
+}
+
+// pushDeadLetter pushes the task to the dead letter queue if it is failed.
+func (p *Pipeline) pushDeadLetter(ctx *context.Context, req *DeadLetterRequest, result string, stats []FilterStat) {
+	if p.deadLetter == nil {
+		return
+	}
+
+	statusCode := 0
+	if resp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response); ok {
+		statusCode = resp.StatusCode()
+	}
+	if !p.deadLetter.spec.isFailure(result, statusCode) {
+		return
+	}
+
+	p.deadLetter.push(&DeadLetter{
+		Pipeline:   p.superSpec.Name(),
+		Time:       time.Now().Format(time.RFC3339Nano),
+		Result:     result,
+		StatusCode: statusCode,
+		Stats:      p.serializeStats(stats),
+		Request:    req,
+	})
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	stdcontext "context"
+	"fmt"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/util/stringtool"
+)
+
+// ErrorDataKey is the key of the task data where the pipeline stores the
+// failure of the task before running the error flow.
+var ErrorDataKey = context.NewDataKey[*TaskError]("", "PIPELINE_ERROR")
+
+type (
+	// ErrorHandlerSpec describes the flow to run when a task fails, like
+	// building a custom error page or a fallback response, or sending a
+	// notification.
+	ErrorHandlerSpec struct {
+		// Results are the results of the flow regarded as failures, any
+		// non-empty result is a failure if it is empty. A timed-out task
+		// is always a failure.
+		Results []string `json:"results,omitempty" jsonschema:"uniqueItems=true"`
+		// Flow is the error flow, its filters are defined in the filters
+		// of the pipeline, and are excluded from the default flow.
+		Flow []FlowNode `json:"flow" jsonschema:"required"`
+	}
+
+	// TaskError is the failure of a task, the filters in the error flow
+	// could read it from the task data PIPELINE_ERROR.
+	TaskError struct {
+		Pipeline string `json:"pipeline"`
+		// Filter is the name or alias of the last filter run.
+		Filter   string `json:"filter,omitempty"`
+		Result   string `json:"result,omitempty"`
+		TimedOut bool   `json:"timedOut,omitempty"`
+		// Request is the request as it entered the pipeline.
+		Request *DeadLetterRequest `json:"request,omitempty"`
+	}
+)
+
+// validate validates ErrorHandlerSpec, it panics if the spec is invalid.
+func (s *ErrorHandlerSpec) validate(specs map[string]filters.Spec) {
+	if len(s.Flow) == 0 {
+		panic(fmt.Errorf("flow is empty"))
+	}
+	validateFlow(s.Flow, specs)
+}
+
+func (s *ErrorHandlerSpec) isFailure(result string) bool {
+	return result != "" && (len(s.Results) == 0 || stringtool.StrInSlice(result, s.Results))
+}
+
+// flowFilters adds the names of the filters in the flow to names.
+func flowFilters(flow []FlowNode, names map[string]bool) {
+	for i := range flow {
+		node := &flow[i]
+		for _, b := range node.Branches {
+			flowFilters(b.Flow, names)
+		}
+		if node.FilterName != "" && node.FilterName != BuiltInFilterEnd {
+			names[node.FilterName] = true
+		}
+	}
+}
+
+// errorFilters returns the names of the filters in the error flow.
+func (s *Spec) errorFilters() map[string]bool {
+	names := map[string]bool{}
+	if s.OnError != nil {
+		flowFilters(s.OnError.Flow, names)
+	}
+	return names
+}
+
+// handleError runs the error flow if the task fails, req is the request of
+// the task when it entered the pipeline. The result of the error flow is
+// not returned, because the task is still a failure even if the error flow
+// builds a fallback response.
+func (p *Pipeline) handleError(ctx *context.Context, deadline stdcontext.Context, req *DeadLetterRequest, result string, stats []FilterStat) []FilterStat {
+	spec := p.spec.OnError
+	if spec == nil {
+		return stats
+	}
+
+	timedOut := deadline != nil && deadline.Err() != nil
+	if !timedOut && !spec.isFailure(result) {
+		return stats
+	}
+
+	te := &TaskError{
+		Pipeline: p.superSpec.Name(),
+		Result:   result,
+		TimedOut: timedOut,
+		Request:  req,
+	}
+	if n := len(stats); n > 0 {
+		te.Filter = stats[n-1].Name
+	}
+	ErrorDataKey.Set(ctx, te)
+
+	// the deadline is not checked in the error flow, so it could build a
+	// response for a timed-out task.
+	_, stats, _ = p.doHandle(ctx, nil, p.errorFlow, stats)
+	return stats
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+// resultMaintenance is the result of a task rejected because the pipeline
+// is in maintenance.
+const resultMaintenance = "maintenance"
+
+type (
+	// MaintenanceSpec describes the response of the pipeline in
+	// maintenance. A pipeline is in maintenance if it is enabled here or
+	// switched on by the admin API.
+	MaintenanceSpec struct {
+		Enabled bool `json:"enabled,omitempty"`
+		// StatusCode is the status code of the response, default is 503.
+		StatusCode int               `json:"statusCode,omitempty" jsonschema:"minimum=200,maximum=599"`
+		Headers    map[string]string `json:"headers,omitempty"`
+		// Body is the static body of the response.
+		Body string `json:"body,omitempty"`
+		// Template is the Go template of the body, which is rendered with
+		// the data of MaintenancePage, it is mutually exclusive with Body.
+		// It is an html/template unless the Content-Type in Headers is not
+		// HTML.
+		Template string `json:"template,omitempty"`
+		// RetryAfter is the value of the Retry-After header in seconds,
+		// the header is not set if it is zero.
+		RetryAfter int `json:"retryAfter,omitempty" jsonschema:"minimum=0"`
+	}
+
+	// MaintenancePage is the data to render the template of the maintenance
+	// page.
+	MaintenancePage struct {
+		Pipeline string
+		// Message is the message of the maintenance switched on by the
+		// admin API.
+		Message string
+		Since   time.Time
+		Method  string
+		Host    string
+		Path    string
+	}
+
+	// pageTemplate is a text/template or an html/template.
+	pageTemplate interface {
+		Execute(w io.Writer, data interface{}) error
+	}
+)
+
+// Validate validates MaintenanceSpec.
+func (s *MaintenanceSpec) Validate() error {
+	if s.Body != "" && s.Template != "" {
+		return fmt.Errorf("body and template are mutually exclusive")
+	}
+	if s.Template != "" {
+		if _, err := template.New("maintenance").Parse(s.Template); err != nil {
+			return fmt.Errorf("invalid template: %v", err)
+		}
+	}
+	return nil
+}
+
+// compile compiles the template. The page is regarded as HTML if the
+// Content-Type is not set, as a browser may sniff it as HTML, and the
+// message and the request are escaped by the context then.
+func (s *MaintenanceSpec) compile() pageTemplate {
+	contentType := ""
+	for k, v := range s.Headers {
+		if strings.EqualFold(k, "Content-Type") {
+			contentType = v
+		}
+	}
+	if contentType == "" || strings.Contains(strings.ToLower(contentType), "html") {
+		return htmltemplate.Must(htmltemplate.New("maintenance").Parse(s.Template))
+	}
+	return template.Must(template.New("maintenance").Parse(s.Template))
+}
+
+// maintenance returns the maintenance switch of the pipeline, and whether
+// the pipeline is in maintenance.
+func (p *Pipeline) maintenance() (*api.Maintenance, bool) {
+	if m, ok := api.GetMaintenance(p.superSpec.Name()); ok {
+		return m, true
+	}
+	if p.spec.Maintenance != nil && p.spec.Maintenance.Enabled {
+		return &api.Maintenance{}, true
+	}
+	return nil, false
+}
+
+// handleMaintenance builds the response of the maintenance page, the
+// response is not built for the requests other than HTTP.
+func (p *Pipeline) handleMaintenance(ctx *context.Context, m *api.Maintenance) {
+	ctx.AddTag(fmt.Sprintf("pipeline(%s): in maintenance", p.superSpec.Name()))
+
+	req, ok := ctx.GetInputRequest().(*httpprot.Request)
+	if !ok {
+		return
+	}
+
+	spec := p.spec.Maintenance
+	if spec == nil {
+		spec = &MaintenanceSpec{}
+	}
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusServiceUnavailable)
+	if spec.StatusCode != 0 {
+		resp.SetStatusCode(spec.StatusCode)
+	}
+	for k, v := range spec.Headers {
+		resp.HTTPHeader().Set(k, v)
+	}
+	if spec.RetryAfter > 0 {
+		resp.HTTPHeader().Set("Retry-After", strconv.Itoa(spec.RetryAfter))
+	}
+
+	switch {
+	case p.maintenanceTemplate != nil:
+		page := &MaintenancePage{
+			Pipeline: p.superSpec.Name(),
+			Message:  m.Message,
+			Since:    m.Since,
+			Method:   req.Method(),
+			Host:     req.Host(),
+			Path:     req.Path(),
+		}
+		var buf bytes.Buffer
+		if err := p.maintenanceTemplate.Execute(&buf, page); err != nil {
+			logger.Errorf("pipeline %s: render maintenance page failed: %v", p.superSpec.Name(), err)
+		}
+		resp.SetPayload(buf.Bytes())
+	case spec.Body != "":
+		resp.SetPayload(spec.Body)
+	default:
+		body := "service is under maintenance"
+		if m.Message != "" {
+			body += ": " + m.Message
+		}
+		resp.HTTPHeader().Set("Content-Type", "text/plain; charset=utf-8")
+		resp.SetPayload(body + "\n")
+	}
+
+	ctx.SetOutputResponse(resp)
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
+)
+
+type (
+	// TaskObserver is called after the pipeline handles a task, with the
+	// result and the duration of the task, including the time waiting for
+	// the concurrency limiter.
+	TaskObserver func(ctx *context.Context, result string, duration time.Duration)
+
+	// taskObservers are the observers of a pipeline, they are shared by
+	// all generations of the pipeline, so they survive the reloads.
+	taskObservers struct {
+		m sync.Map // key -> TaskObserver
+		// bodyTaps is the number of the taps capturing the bodies, the
+		// payloads are not streamed while it is positive.
+		bodyTaps atomic.Int32
+	}
+)
+
+// AddTaskObserver adds an observer of the tasks handled by the pipeline,
+// the observer with the same key is replaced.
+func (p *Pipeline) AddTaskObserver(key string, observer TaskObserver) {
+	p.observers.m.Store(key, observer)
+}
+
+// RemoveTaskObserver removes the observer of the key.
+func (p *Pipeline) RemoveTaskObserver(key string) {
+	p.observers.m.Delete(key)
+}
+
+func (p *Pipeline) observeTask(ctx *context.Context, result string, startAt time.Time) {
+	if p.observers == nil {
+		return
+	}
+
+	var duration time.Duration
+	p.observers.m.Range(func(k, v interface{}) bool {
+		if duration == 0 {
+			duration = fasttime.Since(startAt)
+		}
+		v.(TaskObserver)(ctx, result, duration)
+		return true
+	})
+}
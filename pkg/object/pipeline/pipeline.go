@@ -19,13 +19,19 @@
 package pipeline
 
 import (
+	stdcontext "context"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/megaease/easegress/v2/pkg/api"
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/filters"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols"
 	"github.com/megaease/easegress/v2/pkg/resilience"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
 	"github.com/megaease/easegress/v2/pkg/util/easemonitor"
@@ -42,9 +48,30 @@ const (
 
 	// BuiltInFilterEnd is the name of the build-in end filter.
 	BuiltInFilterEnd = "END"
+
+	defaultDrainTimeout  = 30 * time.Second
+	defaultWarmupTimeout = 30 * time.Second
+
+	// resultOverloaded is the result of a task rejected by the concurrency
+	// limiter.
+	resultOverloaded = "overloaded"
 )
 
+// DataKey is the key of the task data where the pipeline stores its data.
+var DataKey = context.NewDataKey[map[string]interface{}]("", "PIPELINE")
+
+// StatsDataKey is the key of the task data where the pipeline stores the
+// stats of the filters after the task is handled, it is read by the
+// callbacks run when the task finishes, like the access log.
+var StatsDataKey = context.NewDataKey[[]FilterStat]("", "PIPELINE_STATS")
+
+// drainCheckInterval is the interval to check whether the in-flight tasks
+// complete, it is a variable for testing.
+var drainCheckInterval = 100 * time.Millisecond
+
 func init() {
+	context.RegisterRuntimeData(DataKey.Decl())
+	context.RegisterRuntimeData(ErrorDataKey.Decl())
 	supervisor.Register(&Pipeline{})
 	api.RegisterObject(&api.APIResource{
 		Category: Category,
@@ -66,7 +93,23 @@ type (
 
 		filters    map[string]filters.Filter
 		flow       []FlowNode
+		errorFlow  []FlowNode
 		resilience map[string]resilience.Policy
+
+		// inflight is the number of tasks being handled.
+		inflight int64
+		// next is the next generation of the pipeline, the new tasks are
+		// forwarded to it once it is set.
+		next atomic.Pointer[Pipeline]
+
+		timeout      time.Duration
+		limiter      *concurrencyLimiter
+		deadLetter   *deadLetterQueue
+		warmupErrors map[string]string
+		observers    *taskObservers
+		profiler     *profiler
+
+		maintenanceTemplate pageTemplate
 	}
 
 	// Spec describes the Pipeline.
@@ -75,14 +118,48 @@ type (
 		Filters    []map[string]interface{} `json:"filters" jsonschema:"required"`
 		Resilience []map[string]interface{} `json:"resilience,omitempty"`
 		Data       map[string]interface{}   `json:"data,omitempty"`
+		// DataInputs are the keys of the task data provided by the caller
+		// of the pipeline, like a SubPipeline filter or a GlobalFilter,
+		// the filters of the pipeline could read them.
+		DataInputs []string `json:"dataInputs,omitempty" jsonschema:"uniqueItems=true"`
+		// DrainTimeout is the max duration to wait for the in-flight tasks
+		// before closing the filters when the pipeline is stopped or
+		// replaced by a new generation, default is 30s.
+		DrainTimeout string `json:"drainTimeout,omitempty" jsonschema:"format=duration"`
+		// WarmupTimeout is the max duration to wait for the filters to
+		// warm up before the pipeline receives traffic, default is 30s.
+		WarmupTimeout string `json:"warmupTimeout,omitempty" jsonschema:"format=duration"`
+		// Timeout is the max duration to handle a task, it is applied to
+		// the context of the requests, so the filters and the calls to
+		// the upstreams are cancelled when the deadline is exceeded.
+		Timeout string `json:"timeout,omitempty" jsonschema:"format=duration"`
+		// Concurrency limits the number of tasks handled concurrently,
+		// no limit if it is nil.
+		Concurrency *ConcurrencySpec `json:"concurrency,omitempty"`
+		// DeadLetter sends the failed tasks to a target for later replay.
+		DeadLetter *DeadLetterSpec `json:"deadLetter,omitempty"`
+		// OnError is the flow to run when a task fails.
+		OnError *ErrorHandlerSpec `json:"onError,omitempty"`
+		// Maintenance is the response of the pipeline in maintenance.
+		Maintenance *MaintenanceSpec `json:"maintenance,omitempty"`
 	}
 
-	// FlowNode describes one node of the pipeline flow.
+	// contextSetter is implemented by the requests whose context could be
+	// replaced.
+	contextSetter interface {
+		Context() stdcontext.Context
+		SetContext(ctx stdcontext.Context)
+	}
+
+	// FlowNode describes one node of the pipeline flow, a node is either
+	// a filter or a set of branches, the alias of the latter is the target
+	// of JumpIf.
 	FlowNode struct {
-		FilterName  string            `json:"filter" jsonschema:"required,format=urlname"`
+		FilterName  string            `json:"filter,omitempty" jsonschema:"format=urlname"`
 		FilterAlias string            `json:"alias,omitempty"`
 		Namespace   string            `json:"namespace,omitempty"`
 		JumpIf      map[string]string `json:"jumpIf,omitempty"`
+		Branches    []*FlowBranch     `json:"branches,omitempty"`
 		filter      filters.Filter
 	}
 
@@ -96,8 +173,15 @@ type (
 
 	// Status is the status of Pipeline.
 	Status struct {
-		Health  string                 `json:"health"`
-		Filters map[string]interface{} `json:"filters"`
+		Health      string                 `json:"health"`
+		Filters     map[string]interface{} `json:"filters"`
+		Concurrency *ConcurrencyStatus     `json:"concurrency,omitempty"`
+		DeadLetter  *DeadLetterStatus      `json:"deadLetter,omitempty"`
+		// WarmupErrors are the errors of the filters failed to warm up,
+		// the key is the filter name.
+		WarmupErrors map[string]string `json:"warmupErrors,omitempty"`
+		// Backpressure are the filters signaling backpressure.
+		Backpressure []string `json:"backpressure,omitempty"`
 	}
 )
 
@@ -110,9 +194,26 @@ func (fn *FlowNode) filterAlias() string {
 
 // ValidateJumpIf validates whether the target of JumpIfs are valid or not.
 func (s *Spec) ValidateJumpIf(specs map[string]filters.Spec) {
+	validateFlow(s.Flow, specs)
+}
+
+// validateFlow validates the nodes of a flow, the flow of a branch is
+// validated separately, so a JumpIf can only target a filter in the same
+// flow.
+func validateFlow(flow []FlowNode, specs map[string]filters.Spec) {
 	validTargets := map[string]int{BuiltInFilterEnd: 1}
-	for i := len(s.Flow) - 1; i >= 0; i-- {
-		node := &s.Flow[i]
+	for i := len(flow) - 1; i >= 0; i-- {
+		node := &flow[i]
+		if len(node.Branches) > 0 {
+			validateBranches(node, specs)
+			if node.FilterAlias != "" {
+				validTargets[node.FilterAlias]++
+			}
+			continue
+		}
+		if node.FilterName == "" {
+			panic(fmt.Errorf("one of filter and branches is required"))
+		}
 		if node.FilterName == BuiltInFilterEnd {
 			continue
 		}
@@ -137,6 +238,58 @@ func (s *Spec) ValidateJumpIf(specs map[string]filters.Spec) {
 	}
 }
 
+func validateBranches(node *FlowNode, specs map[string]filters.Spec) {
+	if node.FilterName != "" || len(node.JumpIf) > 0 {
+		panic(fmt.Errorf("filter and jumpIf must be empty if branches is set"))
+	}
+	for i, b := range node.Branches {
+		if b.When != nil {
+			if err := b.When.Validate(); err != nil {
+				panic(fmt.Errorf("branch %d: %v", i, err))
+			}
+		} else if i != len(node.Branches)-1 {
+			panic(fmt.Errorf("branch %d: only the last branch can have no condition", i))
+		}
+		if len(b.Flow) == 0 {
+			panic(fmt.Errorf("branch %d: flow is empty", i))
+		}
+		validateFlow(b.Flow, specs)
+	}
+}
+
+// References returns the objects referenced by the filters, like the
+// service registries of the proxy pools. The invalid filter specs are
+// ignored, as they are reported by Validate.
+func (s *Spec) References() []string {
+	var names []string
+	for _, f := range s.Filters {
+		spec, err := filters.NewSpec(nil, "", f)
+		if err != nil {
+			continue
+		}
+		if rs, ok := spec.(filters.ReferenceSpec); ok {
+			names = append(names, rs.References()...)
+		}
+	}
+	return names
+}
+
+// TemplateReferences returns the shared templates referenced by the
+// filters, like the body templates of the Mock filters.
+func (s *Spec) TemplateReferences() []string {
+	var names []string
+	for _, f := range s.Filters {
+		spec, err := filters.NewSpec(nil, "", f)
+		if err != nil {
+			continue
+		}
+		if ts, ok := spec.(filters.TemplateReferenceSpec); ok {
+			names = append(names, ts.TemplateReferences()...)
+		}
+	}
+	return names
+}
+
 // Validate validates Spec.
 func (s *Spec) Validate() (err error) {
 	errPrefix := "filters"
@@ -147,6 +300,7 @@ func (s *Spec) Validate() (err error) {
 	}()
 
 	specs := map[string]filters.Spec{}
+	names := make([]string, 0, len(s.Filters))
 
 	// 1: validate filter spec
 	for _, f := range s.Filters {
@@ -165,6 +319,7 @@ func (s *Spec) Validate() (err error) {
 		}
 
 		specs[name] = spec
+		names = append(names, name)
 	}
 
 	// 2: validate flow
@@ -179,6 +334,53 @@ func (s *Spec) Validate() (err error) {
 		}
 	}
 
+	// 4: validate timeout
+	errPrefix = "timeout"
+	if s.Timeout != "" {
+		if d, err := time.ParseDuration(s.Timeout); err != nil || d <= 0 {
+			panic(fmt.Errorf("invalid timeout %s", s.Timeout))
+		}
+	}
+	if s.WarmupTimeout != "" {
+		if d, err := time.ParseDuration(s.WarmupTimeout); err != nil || d <= 0 {
+			panic(fmt.Errorf("invalid warmupTimeout %s", s.WarmupTimeout))
+		}
+	}
+
+	// 5: validate concurrency
+	errPrefix = "concurrency"
+	if s.Concurrency != nil {
+		if err := s.Concurrency.Validate(); err != nil {
+			panic(err)
+		}
+	}
+
+	// 6: validate dead letter
+	errPrefix = "deadLetter"
+	if s.DeadLetter != nil {
+		if err := s.DeadLetter.Validate(); err != nil {
+			panic(err)
+		}
+	}
+
+	// 7: validate error handler
+	errPrefix = "onError"
+	if s.OnError != nil {
+		s.OnError.validate(specs)
+	}
+
+	// 8: validate data
+	errPrefix = "data"
+	s.validateData(specs, names)
+
+	// 9: validate maintenance
+	errPrefix = "maintenance"
+	if s.Maintenance != nil {
+		if err := s.Maintenance.Validate(); err != nil {
+			panic(err)
+		}
+	}
+
 	return nil
 }
 
@@ -231,17 +433,49 @@ func (p *Pipeline) Init(superSpec *supervisor.Spec, muxMapper context.MuxMapper)
 	p.reload(nil /*no previous generation*/)
 }
 
-// Inherit inherits previous generation of Pipeline.
+// Inherit inherits previous generation of Pipeline. The previous generation
+// keeps handling the tasks until this generation is ready, then the new
+// tasks are switched to this generation atomically, even if they got the
+// previous generation before the switch, and the tasks in flight complete
+// on the previous generation.
 func (p *Pipeline) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object, muxMapper context.MuxMapper) {
 	p.superSpec, p.spec = superSpec, superSpec.ObjectSpec().(*Spec)
-	p.reload(previousGeneration.(*Pipeline))
-	previousGeneration.Close()
+	prev := previousGeneration.(*Pipeline)
+	p.reload(prev)
+	// a pipeline inheriting itself must not forward the tasks to itself.
+	if prev != p {
+		prev.next.Store(p)
+	}
+	prev.Close()
 }
 
 func (p *Pipeline) reload(previousGeneration *Pipeline) {
 	p.filters = make(map[string]filters.Filter)
 	p.resilience = make(map[string]resilience.Policy)
 
+	if p.spec.Timeout != "" {
+		p.timeout, _ = time.ParseDuration(p.spec.Timeout)
+	}
+
+	// the tasks in flight keep using the limiter of the previous
+	// generation, so the new limit is only applied to the new tasks.
+	if p.spec.Concurrency != nil {
+		p.limiter = newConcurrencyLimiter(p.spec.Concurrency)
+	}
+	if p.spec.DeadLetter != nil {
+		p.deadLetter = newDeadLetterQueue(p.superSpec.Name(), p.spec.DeadLetter)
+	}
+	if m := p.spec.Maintenance; m != nil && m.Template != "" {
+		p.maintenanceTemplate = m.compile()
+	}
+	if previousGeneration != nil {
+		p.observers = previousGeneration.observers
+		p.profiler = previousGeneration.profiler
+	} else {
+		p.observers = &taskObservers{}
+		p.profiler = &profiler{}
+	}
+
 	super := p.superSpec.Super()
 	pipelineName := p.superSpec.Name()
 
@@ -259,6 +493,7 @@ func (p *Pipeline) reload(previousGeneration *Pipeline) {
 	if len(flow) == 0 {
 		flow = make([]FlowNode, 0, len(p.spec.Filters))
 	}
+	errorFilters := p.spec.errorFilters()
 
 	for _, rawSpec := range p.spec.Filters {
 		// build the filter spec.
@@ -288,19 +523,71 @@ func (p *Pipeline) reload(previousGeneration *Pipeline) {
 		}
 
 		// add the filter to pipeline, and if the pipeline does not define a
-		// flow, append it to the flow we just created.
+		// flow, append it to the flow we just created unless it is in the
+		// error flow.
 		p.filters[spec.Name()] = filter
-		if len(p.spec.Flow) == 0 {
+		if len(p.spec.Flow) == 0 && !errorFilters[spec.Name()] {
 			flow = append(flow, FlowNode{FilterName: spec.Name()})
 		}
 	}
 
 	p.flow = flow
 
-	// bind filter instance to flow node.
+	p.bindFlow(flow)
+	if p.spec.OnError != nil {
+		p.errorFlow = p.spec.OnError.Flow
+		p.bindFlow(p.errorFlow)
+	}
+	p.warmup()
+}
+
+// warmup warms up the filters concurrently, it is called in Init and
+// Inherit, so the pipeline doesn't receive traffic before it returns. A
+// filter failed to warm up still works, so the error is only reported.
+func (p *Pipeline) warmup() {
+	timeout := defaultWarmupTimeout
+	if p.spec.WarmupTimeout != "" {
+		timeout, _ = time.ParseDuration(p.spec.WarmupTimeout)
+	}
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	for name, filter := range p.filters {
+		w, ok := filter.(filters.Warmer)
+		if !ok {
+			continue
+		}
+
+		wg.Add(1)
+		go func(name string, w filters.Warmer) {
+			defer wg.Done()
+			if err := w.Warmup(ctx); err != nil {
+				logger.Errorf("pipeline %s: filter %s warm up failed: %v", p.superSpec.Name(), name, err)
+				lock.Lock()
+				if p.warmupErrors == nil {
+					p.warmupErrors = map[string]string{}
+				}
+				p.warmupErrors[name] = err.Error()
+				lock.Unlock()
+			}
+		}(name, w)
+	}
+	wg.Wait()
+}
+
+// bindFlow binds filter instances to the nodes of the flow.
+func (p *Pipeline) bindFlow(flow []FlowNode) {
 	for i := range flow {
 		node := &flow[i]
-		if node.FilterName != BuiltInFilterEnd {
+		for _, b := range node.Branches {
+			if b.When != nil {
+				b.When.init()
+			}
+			p.bindFlow(b.Flow)
+		}
+		if node.FilterName != "" && node.FilterName != BuiltInFilterEnd {
 			node.filter = p.filters[node.FilterName]
 		}
 	}
@@ -310,6 +597,12 @@ func (p *Pipeline) getFilter(name string) filters.Filter {
 	return p.filters[name]
 }
 
+// GetFilter returns the filter of the name in the pipeline.
+func (p *Pipeline) GetFilter(name string) (filters.Filter, bool) {
+	f, ok := p.filters[name]
+	return f, ok
+}
+
 // HandleWithBeforeAfterOption is the option of HandleWithBeforeAfter.
 // FallthroughBefore: if true, the pipeline will be executed even if the before pipeline ends.
 // FallthroughPipeline: if true, the after pipeline will be executed even if the pipeline ends.
@@ -321,9 +614,33 @@ type HandleWithBeforeAfterOption struct {
 // HandleWithBeforeAfter handles the request, with additional flow defined by
 // the before/after pipeline.
 func (p *Pipeline) HandleWithBeforeAfter(ctx *context.Context, before, after *Pipeline, option HandleWithBeforeAfterOption) string {
+	atomic.AddInt64(&p.inflight, 1)
+	if next := p.next.Load(); next != nil {
+		atomic.AddInt64(&p.inflight, -1)
+		return next.HandleWithBeforeAfter(ctx, before, after, option)
+	}
+	defer atomic.AddInt64(&p.inflight, -1)
+
 	if len(p.spec.Data) > 0 {
-		ctx.SetData("PIPELINE", p.spec.Data)
+		DataKey.Set(ctx, p.spec.Data)
+	}
+
+	startAt := fasttime.Now()
+	endSpan := p.startSpan(ctx)
+	if m, ok := p.maintenance(); ok {
+		p.handleMaintenance(ctx, m)
+		endSpan(resultMaintenance)
+		p.observeTask(ctx, resultMaintenance, startAt)
+		return resultMaintenance
+	}
+	deadline := p.setDeadline(ctx)
+	if !p.acquire(ctx, deadline) {
+		endSpan(resultOverloaded)
+		p.observeTask(ctx, resultOverloaded, startAt)
+		return resultOverloaded
 	}
+	defer p.release(fasttime.Now())
+	dlr := p.snapshotRequest(ctx)
 
 	result, sawEnd := "", false
 	flowLen := len(p.flow)
@@ -336,39 +653,137 @@ func (p *Pipeline) HandleWithBeforeAfter(ctx *context.Context, before, after *Pi
 	stats := make([]FilterStat, 0, flowLen)
 
 	if before != nil {
-		result, stats, sawEnd = p.doHandle(ctx, before.flow, stats)
+		result, stats, sawEnd = p.doHandle(ctx, deadline, before.flow, stats)
 	}
 
 	if !sawEnd || option.FallthroughBefore {
-		result, stats, sawEnd = p.doHandle(ctx, p.flow, stats)
+		result, stats, sawEnd = p.doHandle(ctx, deadline, p.flow, stats)
 	}
 
 	if (after != nil) && (!sawEnd || option.FallthroughPipeline) {
-		result, stats, _ = p.doHandle(ctx, after.flow, stats)
+		result, stats, _ = p.doHandle(ctx, deadline, after.flow, stats)
 	}
+	stats = p.handleError(ctx, deadline, dlr, result, stats)
+	p.pushDeadLetter(ctx, dlr, result, stats)
 
+	StatsDataKey.Set(ctx, stats)
 	ctx.LazyAddTag(func() string {
 		return p.serializeStats(stats)
 	})
+	endSpan(result)
+	p.observeTask(ctx, result, startAt)
 	return result
 }
 
 // Handle is the handler to deal with the request.
 func (p *Pipeline) Handle(ctx *context.Context) string {
+	// the task is counted before checking the next generation, and Close
+	// checks the count after the next generation is set, so the filters
+	// are never closed under a task not forwarded.
+	atomic.AddInt64(&p.inflight, 1)
+	if next := p.next.Load(); next != nil {
+		atomic.AddInt64(&p.inflight, -1)
+		return next.Handle(ctx)
+	}
+	defer atomic.AddInt64(&p.inflight, -1)
+
 	if len(p.spec.Data) > 0 {
-		ctx.SetData("PIPELINE", p.spec.Data)
+		DataKey.Set(ctx, p.spec.Data)
+	}
+
+	startAt := fasttime.Now()
+	endSpan := p.startSpan(ctx)
+	if m, ok := p.maintenance(); ok {
+		p.handleMaintenance(ctx, m)
+		endSpan(resultMaintenance)
+		p.observeTask(ctx, resultMaintenance, startAt)
+		return resultMaintenance
+	}
+	deadline := p.setDeadline(ctx)
+	if !p.acquire(ctx, deadline) {
+		endSpan(resultOverloaded)
+		p.observeTask(ctx, resultOverloaded, startAt)
+		return resultOverloaded
 	}
+	defer p.release(fasttime.Now())
+	dlr := p.snapshotRequest(ctx)
 
 	stats := make([]FilterStat, 0, len(p.flow))
-	result, stats, _ := p.doHandle(ctx, p.flow, stats)
+	result, stats, _ := p.doHandle(ctx, deadline, p.flow, stats)
+	stats = p.handleError(ctx, deadline, dlr, result, stats)
+	p.pushDeadLetter(ctx, dlr, result, stats)
 
+	StatsDataKey.Set(ctx, stats)
 	ctx.LazyAddTag(func() string {
 		return p.serializeStats(stats)
 	})
+	endSpan(result)
+	p.observeTask(ctx, result, startAt)
 	return result
 }
 
-func (p *Pipeline) doHandle(ctx *context.Context, flow []FlowNode, stats []FilterStat) (string, []FilterStat, bool) {
+// acquire acquires a slot from the concurrency limiter, the task waits in
+// the queue until a slot is released if the pipeline is busy. No response
+// is built if the task is rejected, so an HTTP server responds
+// 503 Service Unavailable.
+func (p *Pipeline) acquire(ctx *context.Context, deadline stdcontext.Context) bool {
+	if p.limiter == nil {
+		return true
+	}
+	if p.limiter.acquire(deadline) {
+		return true
+	}
+	ctx.AddTag(fmt.Sprintf("pipeline(%s): overloaded", p.superSpec.Name()))
+	return false
+}
+
+// release releases the slot of a task started at start, the latency of the
+// task is used to adjust the limit if the limiter is adaptive.
+func (p *Pipeline) release(start time.Time) {
+	if p.limiter != nil {
+		p.limiter.release(fasttime.Since(start))
+	}
+}
+
+// setDeadline creates a context with the deadline of the pipeline from the
+// context of the input request and applies it to the requests. It returns
+// nil if the pipeline has no timeout.
+//
+// The context is cancelled when ctx finishes instead of when the pipeline
+// returns, because the response body could still be in use.
+func (p *Pipeline) setDeadline(ctx *context.Context) stdcontext.Context {
+	if p.timeout == 0 {
+		return nil
+	}
+
+	req := ctx.GetRequest(context.DefaultNamespace)
+	parent := stdcontext.Background()
+	if r, ok := req.(contextSetter); ok {
+		parent = r.Context()
+	}
+
+	deadline, cancel := stdcontext.WithTimeout(parent, p.timeout)
+	ctx.OnFinish(cancel)
+	bindDeadline(req, deadline)
+	return deadline
+}
+
+// bindDeadline applies the deadline to the request if the request does
+// not have an earlier one.
+func bindDeadline(req protocols.Request, deadline stdcontext.Context) {
+	r, ok := req.(contextSetter)
+	if !ok || r.Context() == deadline {
+		return
+	}
+	if d, ok := r.Context().Deadline(); ok {
+		if d2, _ := deadline.Deadline(); !d.After(d2) {
+			return
+		}
+	}
+	r.SetContext(deadline)
+}
+
+func (p *Pipeline) doHandle(ctx *context.Context, deadline stdcontext.Context, flow []FlowNode, stats []FilterStat) (string, []FilterStat, bool) {
 	result, next, sawEnd := "", "", false
 
 	for i := range flow {
@@ -384,10 +799,35 @@ func (p *Pipeline) doHandle(ctx *context.Context, flow []FlowNode, stats []Filte
 			break
 		}
 
+		// the result of a branch is not used for JumpIf, but the flow ends
+		// if a filter in the branch ends it.
+		if len(node.Branches) > 0 {
+			next = ""
+			b := node.chooseBranch(ctx, stats)
+			if b == nil {
+				continue
+			}
+			result, stats, sawEnd = p.doHandle(ctx, deadline, b.Flow, stats)
+			if sawEnd {
+				break
+			}
+			continue
+		}
+
+		if deadline != nil && deadline.Err() != nil {
+			ctx.AddTag(fmt.Sprintf("pipeline(%s): timed out before %s", p.superSpec.Name(), alias))
+			sawEnd = true
+			break
+		}
+
 		start := fasttime.Now()
 		ctx.UseNamespace(node.Namespace)
+		if deadline != nil {
+			// the request of the namespace may be created by the filters.
+			bindDeadline(ctx.GetInputRequest(), deadline)
+		}
 
-		result = node.filter.Handle(ctx)
+		result = p.profileFilter(ctx, node, alias, start)
 		stats = append(stats, FilterStat{
 			Name:     alias,
 			Kind:     node.filter.Kind().Name,
@@ -409,6 +849,60 @@ func (p *Pipeline) doHandle(ctx *context.Context, flow []FlowNode, stats []Filte
 	return result, stats, sawEnd
 }
 
+// Backpressure reports whether any filter of the pipeline is falling behind,
+// it implements context.Backpressurer.
+func (p *Pipeline) Backpressure() bool {
+	if next := p.next.Load(); next != nil {
+		return next.Backpressure()
+	}
+	for _, filter := range p.filters {
+		if bp, ok := filter.(context.Backpressurer); ok && bp.Backpressure() {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedPayload reports whether any filter of the pipeline needs the whole
+// payload of the request or the response, it implements
+// context.PayloadNeeder. Streaming is opt-in, a filter not implementing
+// context.PayloadNeeder needs both payloads. The dead letters contain the
+// request payload, and a tap capturing the bodies needs both payloads.
+func (p *Pipeline) NeedPayload() (request, response bool) {
+	if next := p.next.Load(); next != nil {
+		return next.NeedPayload()
+	}
+	if p.deadLetter != nil {
+		request = true
+	}
+	if p.observers != nil && p.observers.bodyTaps.Load() > 0 {
+		request, response = true, true
+	}
+	for _, filter := range p.filters {
+		pn, ok := filter.(context.PayloadNeeder)
+		if !ok {
+			return true, true
+		}
+		req, resp := pn.NeedPayload()
+		request = request || req
+		response = response || resp
+	}
+	return request, response
+}
+
+// backpressureFilters returns the names of the filters signaling
+// backpressure.
+func (p *Pipeline) backpressureFilters() []string {
+	var names []string
+	for name, filter := range p.filters {
+		if bp, ok := filter.(context.Backpressurer); ok && bp.Backpressure() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Status returns Status generated by Runtime.
 func (p *Pipeline) Status() *supervisor.Status {
 	s := &Status{
@@ -418,17 +912,66 @@ func (p *Pipeline) Status() *supervisor.Status {
 	for name, filter := range p.filters {
 		s.Filters[name] = filter.Status()
 	}
+	if p.limiter != nil {
+		s.Concurrency = p.limiter.status()
+	}
+	if p.deadLetter != nil {
+		s.DeadLetter = p.deadLetter.status()
+	}
+	s.WarmupErrors = p.warmupErrors
+	s.Backpressure = p.backpressureFilters()
 
 	return &supervisor.Status{
 		ObjectStatus: s,
 	}
 }
 
-// Close closes Pipeline.
+// Close closes Pipeline. If there are in-flight tasks, the filters are
+// closed in background after the tasks complete or the drain timeout
+// expires, so that the tasks are not broken by the closed filters.
 func (p *Pipeline) Close() {
+	if atomic.LoadInt64(&p.inflight) == 0 {
+		p.closeFilters()
+		return
+	}
+
+	go func() {
+		p.drain()
+		p.closeFilters()
+	}()
+}
+
+func (p *Pipeline) drain() {
+	timeout := defaultDrainTimeout
+	if p.spec.DrainTimeout != "" {
+		timeout, _ = time.ParseDuration(p.spec.DrainTimeout)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadInt64(&p.inflight) > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainCheckInterval)
+	}
+
+	if n := atomic.LoadInt64(&p.inflight); n > 0 {
+		logger.Warnf("pipeline %s: close filters with %d tasks in flight after draining for %v",
+			p.superSpec.Name(), n, timeout)
+	}
+}
+
+// closeFilters drains all filters before closing any of them, so a filter
+// could flush its buffered data to the filters after it.
+func (p *Pipeline) closeFilters() {
+	for _, filter := range p.filters {
+		if d, ok := filter.(filters.Drainer); ok {
+			d.Drain()
+		}
+	}
 	for _, filter := range p.filters {
 		filter.Close()
 	}
+	if p.deadLetter != nil {
+		p.deadLetter.close()
+	}
 }
 
 // ToMetrics implements easemonitor.Metricer.
@@ -18,17 +18,24 @@
 package pipeline
 
 import (
+	stdcontext "context"
 	"fmt"
 	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/megaease/easegress/v2/pkg/api"
 	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/filters"
 	"github.com/megaease/easegress/v2/pkg/logger"
 	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/v2/pkg/supervisor"
 	"github.com/megaease/easegress/v2/pkg/tracing"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -282,9 +289,12 @@ filters:
 	if err != nil {
 		t.Errorf("failed to create spec %s", err)
 	}
-	pipeline := Pipeline{nil, nil, map[string]filters.Filter{}, nil, nil}
+	pipeline := Pipeline{filters: map[string]filters.Filter{}}
 	pipeline.Init(superSpec, nil)
 	pipeline.Inherit(superSpec, &pipeline, nil)
+	if pipeline.next.Load() != nil {
+		t.Errorf("should not forward the tasks to itself")
+	}
 
 	status := pipeline.Status()
 	if reflect.TypeOf(status).Kind() == reflect.Struct {
@@ -330,9 +340,12 @@ filters:
 	if err != nil {
 		t.Errorf("failed to create spec %s", err)
 	}
-	pipeline := Pipeline{nil, nil, map[string]filters.Filter{}, nil, nil}
+	pipeline := Pipeline{filters: map[string]filters.Filter{}}
 	pipeline.Init(superSpec, nil)
 	pipeline.Inherit(superSpec, &pipeline, nil)
+	if pipeline.next.Load() != nil {
+		t.Errorf("should not forward the tasks to itself")
+	}
 
 	status := pipeline.Status()
 	if reflect.TypeOf(status).Kind() == reflect.Struct {
@@ -498,3 +511,1430 @@ filters:
 	assert.NotContains(tags, "filter2")
 	assert.NotContains(tags, "filter3")
 }
+
+type blockingFilter struct {
+	MockedFilter
+	release chan struct{}
+	closed  int32
+}
+
+func (f *blockingFilter) Handle(ctx *context.Context) string {
+	<-f.release
+	return ""
+}
+
+func (f *blockingFilter) Close() {
+	atomic.StoreInt32(&f.closed, 1)
+}
+
+func TestDrain(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	old := drainCheckInterval
+	drainCheckInterval = 10 * time.Millisecond
+	defer func() { drainCheckInterval = old }()
+
+	kind := MockFilterKind("Blocking", nil)
+	kind.CreateInstance = func(spec filters.Spec) filters.Filter {
+		return &blockingFilter{
+			MockedFilter: MockedFilter{kind: kind, spec: spec.(*MockedSpec)},
+			release:      make(chan struct{}),
+		}
+	}
+	filters.Register(kind)
+
+	newPipeline := func(drainTimeout string) (*Pipeline, *blockingFilter) {
+		yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+drainTimeout: ` + drainTimeout + `
+filters:
+  - name: filter1
+    kind: Blocking
+`
+		superSpec, err := supervisor.NewSpec(yamlConfig)
+		assert.Nil(err)
+		p := &Pipeline{}
+		p.Init(superSpec, nil)
+		return p, MockGetFilter(p, "filter1").(*blockingFilter)
+	}
+
+	handle := func(p *Pipeline) chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			p.Handle(context.New(tracing.NoopSpan))
+			close(done)
+		}()
+		time.Sleep(20 * time.Millisecond)
+		return done
+	}
+
+	// the filters are closed after the in-flight task completes.
+	p, f := newPipeline("1s")
+	done := handle(p)
+	p.Close()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(int32(0), atomic.LoadInt32(&f.closed))
+	close(f.release)
+	<-done
+	assert.Eventually(func() bool { return atomic.LoadInt32(&f.closed) == 1 }, time.Second, 10*time.Millisecond)
+
+	// the filters are closed after the drain timeout.
+	p, f = newPipeline("50ms")
+	done = handle(p)
+	p.Close()
+	assert.Eventually(func() bool { return atomic.LoadInt32(&f.closed) == 1 }, time.Second, 10*time.Millisecond)
+	close(f.release)
+	<-done
+
+	// the filters are closed immediately if there's no in-flight task.
+	p, f = newPipeline("1s")
+	p.Close()
+	assert.Equal(int32(1), atomic.LoadInt32(&f.closed))
+}
+
+// waitingFilter waits until the request is cancelled.
+type waitingFilter struct {
+	MockedFilter
+}
+
+func (f *waitingFilter) Handle(ctx *context.Context) string {
+	f.count++
+	<-ctx.GetInputRequest().(*httpprot.Request).Context().Done()
+	return ""
+}
+
+func TestTimeout(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	kind := MockFilterKind("Waiting", nil)
+	kind.CreateInstance = func(spec filters.Spec) filters.Filter {
+		return &waitingFilter{MockedFilter{kind: kind, spec: spec.(*MockedSpec)}}
+	}
+	filters.Register(kind)
+	filters.Register(MockFilterKind("Filter1", nil))
+
+	spec := &Spec{
+		Filters: []map[string]interface{}{{"name": "filter1", "kind": "Filter1"}},
+		Timeout: "0s",
+	}
+	assert.Error(spec.Validate())
+	spec.Timeout = "abc"
+	assert.Error(spec.Validate())
+
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+timeout: 50ms
+flow:
+  - filter: filter1
+  - filter: waiting
+  - filter: filter2
+filters:
+  - name: filter1
+    kind: Filter1
+  - name: waiting
+    kind: Waiting
+  - name: filter2
+    kind: Filter1
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+	defer pipeline.Close()
+
+	stdReq, err := http.NewRequest(http.MethodGet, "http://localhost:9095", nil)
+	assert.Nil(err)
+	req, err := httpprot.NewRequest(stdReq)
+	assert.Nil(err)
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetRequest(context.DefaultNamespace, req)
+
+	start := time.Now()
+	pipeline.Handle(ctx)
+	assert.Less(time.Since(start), time.Second)
+
+	// the filters after the deadline are skipped.
+	assert.Equal(stdcontext.DeadlineExceeded, req.Context().Err())
+	assert.Equal(1, MockGetFilter(pipeline, "waiting").(*waitingFilter).count)
+	assert.Equal(0, MockGetFilter(pipeline, "filter2").(*MockedFilter).count)
+	assert.Contains(ctx.Tags(), "timed out before filter2")
+	ctx.Finish()
+
+	// an earlier deadline of the request is kept.
+	parent, cancel := stdcontext.WithTimeout(stdcontext.Background(), 10*time.Millisecond)
+	defer cancel()
+	req.SetContext(parent)
+	ctx = context.New(tracing.NoopSpan)
+	ctx.SetRequest(context.DefaultNamespace, req)
+	pipeline.Handle(ctx)
+	assert.Equal(parent, req.Context())
+	ctx.Finish()
+}
+
+func TestBranches(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	filters.Register(MockFilterKind("Filter1", []string{"invalid"}))
+
+	newSpec := func(flow string) *Spec {
+		spec := &Spec{}
+		yamlConfig := `
+filters:
+- name: filter1
+  kind: Filter1
+- name: filter2
+  kind: Filter1
+flow:
+` + flow
+		assert.NoError(codectool.UnmarshalYAML([]byte(yamlConfig), spec))
+		return spec
+	}
+
+	// filter and branches are set at the same time.
+	spec := newSpec(`
+- filter: filter1
+  branches:
+  - flow:
+    - filter: filter2
+`)
+	assert.Error(spec.Validate())
+
+	// the branch without condition is not the last one.
+	spec = newSpec(`
+- branches:
+  - flow:
+    - filter: filter1
+  - when:
+      statusCodes: [404]
+    flow:
+    - filter: filter2
+`)
+	assert.Error(spec.Validate())
+
+	// the target of jumpIf is out of the branch.
+	spec = newSpec(`
+- branches:
+  - flow:
+    - filter: filter1
+      jumpIf:
+        invalid: filter2
+- filter: filter2
+`)
+	assert.Error(spec.Validate())
+
+	// the alias of branches is the target of jumpIf.
+	spec = newSpec(`
+- filter: filter1
+  jumpIf:
+    invalid: route
+- alias: route
+  branches:
+  - flow:
+    - filter: filter2
+`)
+	assert.NoError(spec.Validate())
+
+	// filter not found.
+	spec = newSpec(`
+- branches:
+  - flow:
+    - filter: filter3
+`)
+	assert.Error(spec.Validate())
+
+	// invalid matcher.
+	spec = newSpec(`
+- branches:
+  - when:
+      headers:
+        X-Test: {}
+    flow:
+    - filter: filter1
+`)
+	assert.Error(spec.Validate())
+
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+flow:
+- filter: filter1
+- branches:
+  - when:
+      headers:
+        X-Test:
+          exact: a
+    flow:
+    - filter: filterA
+  - when:
+      headers:
+        X-Test:
+          exact: b
+      results:
+        filter1: [""]
+    flow:
+    - filter: filterB
+    - filter: END
+  - when:
+      statusCodes: [404]
+    flow:
+    - filter: filterC
+  - flow:
+    - filter: filterD
+- filter: filter2
+filters:
+- name: filter1
+  kind: Filter1
+- name: filter2
+  kind: Filter1
+- name: filterA
+  kind: Filter1
+- name: filterB
+  kind: Filter1
+- name: filterC
+  kind: Filter1
+- name: filterD
+  kind: Filter1
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+	defer pipeline.Close()
+
+	handle := func(header string, statusCode int) http.Header {
+		stdReq, _ := http.NewRequest(http.MethodGet, "http://localhost:9095", nil)
+		if header != "" {
+			stdReq.Header.Set("X-Test", header)
+		}
+		req, _ := httpprot.NewRequest(stdReq)
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetRequest(context.DefaultNamespace, req)
+		if statusCode != 0 {
+			resp, _ := httpprot.NewResponse(nil)
+			resp.SetStatusCode(statusCode)
+			ctx.SetResponse(context.DefaultNamespace, resp)
+		}
+		pipeline.Handle(ctx)
+		return stdReq.Header
+	}
+
+	h := handle("a", 0)
+	assert.Equal("filterA", h.Get("X-Mock-filterA"))
+	assert.Equal("", h.Get("X-Mock-filterD"))
+	assert.Equal("filter2", h.Get("X-Mock-filter2"))
+
+	// END in the branch ends the pipeline.
+	h = handle("b", 0)
+	assert.Equal("filterB", h.Get("X-Mock-filterB"))
+	assert.Equal("", h.Get("X-Mock-filter2"))
+
+	h = handle("", http.StatusNotFound)
+	assert.Equal("filterC", h.Get("X-Mock-filterC"))
+	assert.Equal("filter2", h.Get("X-Mock-filter2"))
+
+	h = handle("c", http.StatusOK)
+	assert.Equal("filterD", h.Get("X-Mock-filterD"))
+	assert.Equal("filter2", h.Get("X-Mock-filter2"))
+}
+
+// invalidFilter always returns "invalid".
+type invalidFilter struct {
+	MockedFilter
+}
+
+func (f *invalidFilter) Handle(ctx *context.Context) string {
+	f.MockedFilter.Handle(ctx)
+	return "invalid"
+}
+
+func TestJumpToBranches(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	kind := MockFilterKind("Invalid", []string{"invalid"})
+	kind.CreateInstance = func(spec filters.Spec) filters.Filter {
+		return &invalidFilter{MockedFilter{kind: kind, spec: spec.(*MockedSpec)}}
+	}
+	filters.Register(kind)
+	filters.Register(MockFilterKind("Filter1", nil))
+
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+flow:
+- filter: validator
+  jumpIf:
+    invalid: route
+- filter: filter1
+- alias: route
+  branches:
+  - when:
+      results:
+        validator: [invalid]
+    flow:
+    - filter: filter2
+- filter: filter3
+filters:
+- name: validator
+  kind: Invalid
+- name: filter1
+  kind: Filter1
+- name: filter2
+  kind: Filter1
+- name: filter3
+  kind: Filter1
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+	defer pipeline.Close()
+
+	stdReq, _ := http.NewRequest(http.MethodGet, "http://localhost:9095", nil)
+	req, _ := httpprot.NewRequest(stdReq)
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetRequest(context.DefaultNamespace, req)
+	pipeline.Handle(ctx)
+
+	assert.Equal("", stdReq.Header.Get("X-Mock-filter1"))
+	assert.Equal("filter2", stdReq.Header.Get("X-Mock-filter2"))
+	assert.Equal("filter3", stdReq.Header.Get("X-Mock-filter3"))
+}
+
+func TestConcurrency(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	filters.Register(MockFilterKind("Filter1", nil))
+	spec := &Spec{
+		Filters:     []map[string]interface{}{{"name": "filter1", "kind": "Filter1"}},
+		Concurrency: &ConcurrencySpec{MaxInflight: 0},
+	}
+	assert.Error(spec.Validate())
+	spec.Concurrency = &ConcurrencySpec{MaxInflight: 1, OverflowPolicy: "dropAll"}
+	assert.Error(spec.Validate())
+	spec.Concurrency = &ConcurrencySpec{MaxInflight: 1, QueueTimeout: "abc"}
+	assert.Error(spec.Validate())
+	spec.Concurrency = &ConcurrencySpec{MaxInflight: 1, MaxQueue: 1, OverflowPolicy: OverflowPolicyShedOldest}
+	assert.NoError(spec.Validate())
+
+	waitAll := func(results []chan bool) []bool {
+		var r []bool
+		for _, c := range results {
+			r = append(r, <-c)
+		}
+		return r
+	}
+	acquire := func(l *concurrencyLimiter) chan bool {
+		c := make(chan bool, 1)
+		go func() { c <- l.acquire(nil) }()
+		time.Sleep(10 * time.Millisecond)
+		return c
+	}
+
+	// reject the new task if the queue is full.
+	l := newConcurrencyLimiter(&ConcurrencySpec{MaxInflight: 1, MaxQueue: 1})
+	assert.True(l.acquire(nil))
+	queued := acquire(l)
+	assert.False(l.acquire(nil))
+	assert.Equal(&ConcurrencyStatus{Inflight: 1, QueueDepth: 1, Rejected: 1}, l.status())
+	l.release(time.Millisecond)
+	assert.Equal([]bool{true}, waitAll([]chan bool{queued}))
+	l.release(time.Millisecond)
+	assert.Equal(0, l.status().Inflight)
+
+	// shed the oldest task if the queue is full.
+	l = newConcurrencyLimiter(&ConcurrencySpec{MaxInflight: 1, MaxQueue: 1, OverflowPolicy: OverflowPolicyShedOldest})
+	assert.True(l.acquire(nil))
+	oldest := acquire(l)
+	newest := acquire(l)
+	l.release(time.Millisecond)
+	assert.Equal([]bool{false, true}, waitAll([]chan bool{oldest, newest}))
+	assert.Equal(uint64(1), l.status().Shed)
+
+	// the task waiting in the queue times out.
+	l = newConcurrencyLimiter(&ConcurrencySpec{MaxInflight: 1, MaxQueue: 1, QueueTimeout: "20ms"})
+	assert.True(l.acquire(nil))
+	assert.False(l.acquire(nil))
+	assert.Equal(&ConcurrencyStatus{Inflight: 1, TimedOut: 1}, l.status())
+
+	// the pipeline rejects the task and reports the status.
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+concurrency:
+  maxInflight: 1
+filters:
+  - name: filter1
+    kind: Filter1
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+	defer pipeline.Close()
+
+	assert.Equal("", pipeline.Handle(context.New(tracing.NoopSpan)))
+	assert.True(pipeline.limiter.acquire(nil))
+	ctx := context.New(tracing.NoopSpan)
+	assert.Equal(resultOverloaded, pipeline.Handle(ctx))
+	assert.Contains(ctx.Tags(), "overloaded")
+	assert.Equal(1, MockGetFilter(pipeline, "filter1").(*MockedFilter).count)
+	status := pipeline.Status().ObjectStatus.(*Status)
+	assert.Equal(uint64(1), status.Concurrency.Rejected)
+}
+
+func TestAdaptiveConcurrency(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, spec := range []*AdaptiveConcurrencySpec{
+		{Algorithm: "vegas"},
+		{Algorithm: AdaptiveAlgorithmAIMD},
+		{Algorithm: AdaptiveAlgorithmAIMD, LatencyThreshold: "1s", BackoffRatio: 1.5},
+		{Algorithm: AdaptiveAlgorithmGradient, Tolerance: 0.5},
+		{Algorithm: AdaptiveAlgorithmGradient, MinLimit: 10, MaxLimit: 5},
+	} {
+		assert.Error(spec.Validate(), "%+v", spec)
+	}
+
+	// AIMD increases the limit when it is used and the latency is low, and
+	// decreases it when the latency is high.
+	l := newConcurrencyLimiter(&ConcurrencySpec{
+		MaxInflight: 10,
+		Adaptive: &AdaptiveConcurrencySpec{
+			Algorithm:        AdaptiveAlgorithmAIMD,
+			LatencyThreshold: "100ms",
+			BackoffRatio:     0.5,
+			MaxLimit:         11,
+		},
+	})
+	for i := 0; i < 5; i++ {
+		assert.True(l.acquire(nil))
+	}
+	l.release(time.Millisecond)
+	assert.Equal(11, l.status().Limit)
+	l.release(time.Millisecond)
+	assert.Equal(11, l.status().Limit)
+	l.release(time.Second)
+	assert.Equal(5, l.status().Limit)
+	l.release(time.Millisecond)
+	l.release(time.Millisecond)
+
+	// the limit is not increased under light load.
+	assert.True(l.acquire(nil))
+	l.release(time.Millisecond)
+	assert.Equal(5, l.status().Limit)
+
+	// the gradient algorithm decreases the limit when the latency grows,
+	// and increases it when the latency is stable.
+	l = newConcurrencyLimiter(&ConcurrencySpec{
+		MaxInflight: 20,
+		Adaptive:    &AdaptiveConcurrencySpec{Algorithm: AdaptiveAlgorithmGradient},
+	})
+	for i := 0; i < 20; i++ {
+		assert.True(l.acquire(nil))
+	}
+	for i := 0; i < 10; i++ {
+		l.release(10 * time.Millisecond)
+		assert.True(l.acquire(nil))
+	}
+	stable := l.status().Limit
+	assert.Greater(stable, 20)
+
+	for i := 0; i < 10; i++ {
+		l.release(100 * time.Millisecond)
+		l.acquire(nil)
+	}
+	assert.Less(l.status().Limit, stable)
+}
+
+// failingFilter always fails.
+type failingFilter struct {
+	MockedFilter
+}
+
+func (f *failingFilter) Handle(ctx *context.Context) string {
+	f.count++
+	return "failed"
+}
+
+func TestDeadLetter(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	kind := MockFilterKind("Failing", []string{"failed"})
+	kind.CreateInstance = func(spec filters.Spec) filters.Filter {
+		return &failingFilter{MockedFilter{kind: kind, spec: spec.(*MockedSpec)}}
+	}
+	filters.Register(kind)
+
+	for _, dl := range []*DeadLetterSpec{
+		{},
+		{File: &DeadLetterFileSpec{Path: "a"}, HTTP: &DeadLetterHTTPSpec{URL: "http://localhost"}},
+		{HTTP: &DeadLetterHTTPSpec{URL: "http://localhost", Timeout: "abc"}},
+	} {
+		spec := &Spec{
+			Filters:    []map[string]interface{}{{"name": "filter1", "kind": "Failing"}},
+			DeadLetter: dl,
+		}
+		assert.Error(spec.Validate())
+	}
+
+	dl := &DeadLetterSpec{Results: []string{"failed"}, StatusCodes: []int{503}}
+	assert.True(dl.isFailure("failed", 200))
+	assert.True(dl.isFailure("", 503))
+	assert.False(dl.isFailure("invalid", 200))
+	assert.False(dl.isFailure("", 200))
+
+	path := filepath.Join(t.TempDir(), "dead-letters", "orders")
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+deadLetter:
+  file:
+    path: ` + path + `
+filters:
+  - name: filter1
+    kind: Failing
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+
+	stdReq, err := http.NewRequest(http.MethodPost, "http://localhost:9095/orders", nil)
+	assert.Nil(err)
+	req, err := httpprot.NewRequest(stdReq)
+	assert.Nil(err)
+	req.SetPayload([]byte("order"))
+	req.HTTPHeader().Set("X-Order", "1")
+	req.HTTPHeader().Set("Authorization", "Bearer secret")
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetRequest(context.DefaultNamespace, req)
+
+	assert.Equal("failed", pipeline.Handle(ctx))
+	pipeline.Close()
+
+	assert.Eventually(func() bool {
+		return pipeline.Status().ObjectStatus.(*Status).DeadLetter.Sent == 1
+	}, time.Second, 10*time.Millisecond)
+	data, err := os.ReadFile(path)
+	assert.Nil(err)
+	fi, err := os.Stat(path)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0o600), fi.Mode().Perm())
+
+	letter := &DeadLetter{}
+	codectool.MustUnmarshal(data, letter)
+	assert.Equal("http-pipeline-test", letter.Pipeline)
+	assert.Equal("failed", letter.Result)
+	assert.Contains(letter.Stats, "filter1(failed")
+	assert.Equal(http.MethodPost, letter.Request.Method)
+	assert.Equal("http://localhost:9095/orders", letter.Request.URL)
+	assert.Equal("1", letter.Request.Header.Get("X-Order"))
+	assert.Equal(redacted, letter.Request.Header.Get("Authorization"))
+	assert.Equal("Bearer secret", req.HTTPHeader().Get("Authorization"))
+	assert.Equal("order", string(letter.Request.Body))
+}
+
+type dataSpec struct {
+	filters.BaseSpec
+	inputs  []context.DataDecl
+	outputs []context.DataDecl
+}
+
+func (s *dataSpec) DataInputs() []context.DataDecl {
+	return s.inputs
+}
+
+func (s *dataSpec) DataOutputs() []context.DataDecl {
+	return s.outputs
+}
+
+func TestValidateData(t *testing.T) {
+	assert := assert.New(t)
+
+	topic := context.NewDataKey[string]("mapper", "topic").Decl()
+	intTopic := context.NewDataKey[int]("mapper", "topic").Decl()
+	userTopic := context.NewUserDataKey[string]("topic").Decl()
+	userIntTopic := context.NewUserDataKey[int]("topic").Decl()
+	newSpec := func(name string, inputs, outputs []context.DataDecl) filters.Spec {
+		s := &dataSpec{inputs: inputs, outputs: outputs}
+		s.BaseSpec.MetaSpec.Name = name
+		return s
+	}
+	specs := map[string]filters.Spec{
+		"writer":    newSpec("writer", nil, []context.DataDecl{topic}),
+		"anyWriter": newSpec("anyWriter", nil, []context.DataDecl{context.AnyData(topic.Name)}),
+		"reader":    newSpec("reader", []context.DataDecl{topic}, nil),
+		"intReader": newSpec("intReader", []context.DataDecl{intTopic}, nil),
+
+		"userWriter":    newSpec("userWriter", nil, []context.DataDecl{userTopic}),
+		"userReader":    newSpec("userReader", []context.DataDecl{userTopic}, nil),
+		"userIntReader": newSpec("userIntReader", []context.DataDecl{userIntTopic}, nil),
+	}
+
+	validate := func(s *Spec, names ...string) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+		s.validateData(specs, names)
+		return nil
+	}
+
+	assert.Equal("mapper.topic", topic.Name)
+	assert.NoError(validate(&Spec{}, "writer", "reader"))
+	assert.Error(validate(&Spec{}, "reader", "writer"))
+	assert.Error(validate(&Spec{}, "writer", "intReader"))
+	assert.NoError(validate(&Spec{}, "anyWriter", "intReader"))
+	assert.NoError(validate(&Spec{DataInputs: []string{topic.Name}}, "reader"))
+
+	// the flow decides the order, and the data written in a branch is
+	// available after the branches.
+	spec := &Spec{Flow: []FlowNode{
+		{Branches: []*FlowBranch{{Flow: []FlowNode{{FilterName: "writer"}}}}},
+		{FilterName: "reader"},
+	}}
+	assert.NoError(validate(spec, "reader", "writer"))
+	spec = &Spec{Flow: []FlowNode{{FilterName: "reader"}, {FilterName: "writer"}}}
+	assert.Error(validate(spec, "writer", "reader"))
+
+	// the keys configured by users may be written by the filters not
+	// declaring their data, but the types are still checked.
+	assert.NoError(validate(&Spec{}, "userReader"))
+	assert.NoError(validate(&Spec{}, "userWriter", "userReader"))
+	assert.Error(validate(&Spec{}, "userWriter", "userIntReader"))
+
+	context.RegisterRuntimeData(topic)
+	assert.NoError(validate(&Spec{}, "reader"))
+
+	assert.NoError(context.ValidateUserDataKey("topic"))
+	assert.Error(context.ValidateUserDataKey(topic.Name))
+	assert.Error(context.ValidateUserDataKey("PIPELINE"))
+}
+
+// lifecycleFilter records the calls of the lifecycle hooks.
+type lifecycleFilter struct {
+	MockedFilter
+	warmupErr error
+	warmed    bool
+	drained   bool
+	closed    bool
+}
+
+func (f *lifecycleFilter) Warmup(ctx stdcontext.Context) error {
+	select {
+	case <-time.After(20 * time.Millisecond):
+		f.warmed = true
+		return f.warmupErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *lifecycleFilter) Drain() {
+	f.drained = !f.closed
+}
+
+func (f *lifecycleFilter) Close() {
+	f.closed = true
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	kind := MockFilterKind("Lifecycle", nil)
+	kind.CreateInstance = func(spec filters.Spec) filters.Filter {
+		f := &lifecycleFilter{MockedFilter: MockedFilter{kind: kind, spec: spec.(*MockedSpec)}}
+		if spec.Name() == "filter2" {
+			f.warmupErr = fmt.Errorf("cache unavailable")
+		}
+		return f
+	}
+	filters.Register(kind)
+
+	newPipeline := func(warmupTimeout string) *Pipeline {
+		yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+warmupTimeout: ` + warmupTimeout + `
+filters:
+  - name: filter1
+    kind: Lifecycle
+  - name: filter2
+    kind: Lifecycle
+`
+		superSpec, err := supervisor.NewSpec(yamlConfig)
+		assert.Nil(err)
+		p := &Pipeline{}
+		p.Init(superSpec, nil)
+		return p
+	}
+
+	p := newPipeline("1s")
+	f1 := MockGetFilter(p, "filter1").(*lifecycleFilter)
+	f2 := MockGetFilter(p, "filter2").(*lifecycleFilter)
+	assert.True(f1.warmed)
+	assert.True(f2.warmed)
+	status := p.Status().ObjectStatus.(*Status)
+	assert.Equal(map[string]string{"filter2": "cache unavailable"}, status.WarmupErrors)
+
+	p.Close()
+	assert.True(f1.drained)
+	assert.True(f1.closed)
+
+	// the warm-up is cancelled when the timeout expires.
+	p = newPipeline("5ms")
+	assert.False(MockGetFilter(p, "filter1").(*lifecycleFilter).warmed)
+	assert.Len(p.Status().ObjectStatus.(*Status).WarmupErrors, 2)
+	p.Close()
+
+	spec := &Spec{
+		Filters:       []map[string]interface{}{{"name": "filter1", "kind": "Lifecycle"}},
+		WarmupTimeout: "abc",
+	}
+	assert.Error(spec.Validate())
+}
+
+func TestInheritForwardsNewTasks(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	filters.Register(MockFilterKind("Mock", nil))
+
+	newSpec := func(filterName string) *supervisor.Spec {
+		superSpec, err := supervisor.NewSpec(`
+name: http-pipeline-test
+kind: Pipeline
+filters:
+  - name: ` + filterName + `
+    kind: Mock
+`)
+		assert.Nil(err)
+		return superSpec
+	}
+
+	p1 := &Pipeline{}
+	p1.Init(newSpec("filter1"), nil)
+	p2 := &Pipeline{}
+	p2.Inherit(newSpec("filter2"), p1, nil)
+	p3 := &Pipeline{}
+	p3.Inherit(newSpec("filter3"), p2, nil)
+
+	// the tasks which got a previous generation are handled by the latest
+	// generation.
+	assert.Equal("", p1.Handle(context.New(tracing.NoopSpan)))
+	assert.Equal("", p2.Handle(context.New(tracing.NoopSpan)))
+	assert.Equal(0, MockGetFilter(p1, "filter1").(*MockedFilter).count)
+	assert.Equal(0, MockGetFilter(p2, "filter2").(*MockedFilter).count)
+	assert.Equal(2, MockGetFilter(p3, "filter3").(*MockedFilter).count)
+	assert.Equal(int64(0), atomic.LoadInt64(&p1.inflight))
+	p3.Close()
+}
+
+func TestTaskObserver(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	filters.Register(MockFilterKind("Mock", nil))
+
+	newSpec := func(filterName string) *supervisor.Spec {
+		superSpec, err := supervisor.NewSpec(`
+name: http-pipeline-test
+kind: Pipeline
+filters:
+  - name: ` + filterName + `
+    kind: Mock
+`)
+		assert.Nil(err)
+		return superSpec
+	}
+
+	var results []string
+	p1 := &Pipeline{}
+	p1.Init(newSpec("filter1"), nil)
+	p1.AddTaskObserver("test", func(ctx *context.Context, result string, duration time.Duration) {
+		results = append(results, result)
+	})
+	assert.Equal("", p1.Handle(context.New(tracing.NoopSpan)))
+
+	// the observers survive the reloads.
+	p2 := &Pipeline{}
+	p2.Inherit(newSpec("filter2"), p1, nil)
+	assert.Equal("", p2.Handle(context.New(tracing.NoopSpan)))
+	assert.Equal([]string{"", ""}, results)
+
+	p2.RemoveTaskObserver("test")
+	p2.Handle(context.New(tracing.NoopSpan))
+	assert.Len(results, 2)
+	p2.Close()
+}
+
+func TestTap(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	filters.Register(MockFilterKind("Mock", nil))
+
+	superSpec, err := supervisor.NewSpec(`
+name: http-pipeline-test
+kind: Pipeline
+filters:
+  - name: filter1
+    kind: Mock
+`)
+	assert.Nil(err)
+	p := &Pipeline{}
+	p.Init(superSpec, nil)
+	defer p.Close()
+
+	newContext := func() *context.Context {
+		stdr, _ := http.NewRequest(http.MethodPost, "http://example.com/orders?token=secret", nil)
+		stdr.Header.Set("Authorization", "Bearer abc")
+		stdr.Header.Set("X-Api-Key", "key")
+		stdr.Header.Set("X-Trace", "trace")
+		req, _ := httpprot.NewRequest(stdr)
+		req.SetPayload([]byte(`{"card":"4111111111111111","amount":100}`))
+
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetRequest(context.DefaultNamespace, req)
+		return ctx
+	}
+
+	_, _, err = p.Tap(&api.TapSpec{Duration: time.Minute, SampleRate: 1, RedactPatterns: []string{"("}})
+	assert.NotNil(err)
+
+	records, cancel, err := p.Tap(&api.TapSpec{
+		Duration:       time.Minute,
+		SampleRate:     1,
+		MaxBodySize:    20,
+		RedactHeaders:  []string{"X-Api-Key"},
+		RedactPatterns: []string{`token=\w+`, `\d{16}`},
+	})
+	assert.Nil(err)
+
+	p.Handle(newContext())
+	record := (<-records).(*TapRecord)
+	assert.Equal(http.MethodPost, record.Request.Method)
+	assert.Equal("http://example.com/orders?[REDACTED]", record.Request.URL)
+	assert.Equal("[REDACTED]", record.Request.Header.Get("Authorization"))
+	assert.Equal("[REDACTED]", record.Request.Header.Get("X-Api-Key"))
+	assert.Equal("trace", record.Request.Header.Get("X-Trace"))
+	assert.Equal(`{"card":"[REDACTED]"`, record.Request.Body)
+	assert.True(record.Request.BodyTruncated)
+	assert.Equal(int64(40), record.Request.BodySize)
+	assert.Len(record.Filters, 1)
+	assert.Equal("filter1", record.Filters[0].Name)
+
+	// the records are dropped if they are not read.
+	for i := 0; i < tapBufferSize+3; i++ {
+		p.Handle(newContext())
+	}
+	assert.Len(records, tapBufferSize)
+
+	cancel()
+	cancel()
+	p.Handle(newContext())
+	n := 0
+	for range records {
+		n++
+	}
+	assert.Equal(tapBufferSize, n)
+
+	// the tap expires automatically.
+	records, _, err = p.Tap(&api.TapSpec{Duration: 10 * time.Millisecond, SampleRate: 1})
+	assert.Nil(err)
+	select {
+	case _, ok := <-records:
+		assert.False(ok)
+	case <-time.After(time.Second):
+		assert.Fail("tap does not expire")
+	}
+}
+
+// busyFilter burns the CPU for a while.
+type busyFilter struct {
+	MockedFilter
+}
+
+func (f *busyFilter) Handle(ctx *context.Context) string {
+	for start := time.Now(); time.Since(start) < 20*time.Millisecond; {
+	}
+	return ""
+}
+
+func TestProfile(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	filters.Register(MockFilterKind("Mock", nil))
+	kind := MockFilterKind("Busy", nil)
+	kind.CreateInstance = func(spec filters.Spec) filters.Filter {
+		return &busyFilter{MockedFilter: MockedFilter{kind: kind, spec: spec.(*MockedSpec)}}
+	}
+	filters.Register(kind)
+
+	superSpec, err := supervisor.NewSpec(`
+name: http-pipeline-test
+kind: Pipeline
+filters:
+  - name: filter1
+    kind: Mock
+  - name: filter2
+    kind: Busy
+`)
+	assert.Nil(err)
+	p := &Pipeline{}
+	p.Init(superSpec, nil)
+	defer p.Close()
+
+	ch := make(chan *api.PipelineProfile)
+	go func() {
+		profile, err := p.Profile(stdcontext.Background(), 500*time.Millisecond, true)
+		assert.Nil(err)
+		ch <- profile
+	}()
+	assert.Eventually(func() bool { return p.profiler.session.Load() != nil }, time.Second, time.Millisecond)
+
+	// only one profile runs at a time.
+	_, err = p.Profile(stdcontext.Background(), time.Second, false)
+	assert.NotNil(err)
+
+	for i := 0; i < 10; i++ {
+		p.Handle(context.New(tracing.NoopSpan))
+	}
+
+	profile := <-ch
+	assert.Equal("http-pipeline-test", profile.Pipeline)
+	assert.Equal(uint64(10), profile.Tasks)
+	assert.Len(profile.Filters, 2)
+	assert.Equal("filter1", profile.Filters[0].Name)
+	assert.Equal(uint64(10), profile.Filters[0].Calls)
+	busy := profile.Filters[1]
+	assert.Equal("Busy", busy.Kind)
+	assert.GreaterOrEqual(busy.WallTime, 200*time.Millisecond)
+	assert.GreaterOrEqual(profile.TaskTime, busy.WallTime)
+	if profile.CPUError == "" {
+		assert.Greater(busy.CPUTime, time.Duration(0))
+	}
+	assert.Contains(profile.Folded(false), "http-pipeline-test;filter2(Busy) ")
+
+	// the profile stops when the context is done.
+	ctx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	cancel()
+	profile, err = p.Profile(ctx, time.Minute, false)
+	assert.Nil(err)
+	assert.Zero(profile.Tasks)
+	assert.Empty(profile.Filters)
+}
+
+// errorHandlingFilter records the task error.
+type errorHandlingFilter struct {
+	MockedFilter
+	taskErr *TaskError
+}
+
+func (f *errorHandlingFilter) Handle(ctx *context.Context) string {
+	f.count++
+	f.taskErr, _ = ErrorDataKey.Get(ctx)
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusOK)
+	ctx.SetResponse(context.DefaultNamespace, resp)
+	return ""
+}
+
+func TestErrorFlow(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	kind := MockFilterKind("Failing", []string{"failed"})
+	kind.CreateInstance = func(spec filters.Spec) filters.Filter {
+		return &failingFilter{MockedFilter{kind: kind, spec: spec.(*MockedSpec)}}
+	}
+	filters.Register(kind)
+	fallbackKind := MockFilterKind("Fallback", nil)
+	fallbackKind.CreateInstance = func(spec filters.Spec) filters.Filter {
+		return &errorHandlingFilter{MockedFilter: MockedFilter{kind: fallbackKind, spec: spec.(*MockedSpec)}}
+	}
+	filters.Register(fallbackKind)
+	filters.Register(MockFilterKind("Mock", nil))
+
+	spec := &Spec{
+		Filters: []map[string]interface{}{{"name": "filter1", "kind": "Mock"}},
+		OnError: &ErrorHandlerSpec{},
+	}
+	assert.Error(spec.Validate())
+	spec.OnError.Flow = []FlowNode{{FilterName: "fallback"}}
+	assert.Error(spec.Validate())
+
+	newPipeline := func(kind string) *Pipeline {
+		superSpec, err := supervisor.NewSpec(`
+name: http-pipeline-test
+kind: Pipeline
+onError:
+  flow:
+  - filter: fallback
+filters:
+  - name: filter1
+    kind: ` + kind + `
+  - name: fallback
+    kind: Fallback
+`)
+		assert.Nil(err)
+		p := &Pipeline{}
+		p.Init(superSpec, nil)
+		return p
+	}
+
+	newContext := func() *context.Context {
+		stdReq, err := http.NewRequest(http.MethodGet, "http://localhost:9095/orders", nil)
+		assert.Nil(err)
+		req, err := httpprot.NewRequest(stdReq)
+		assert.Nil(err)
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetRequest(context.DefaultNamespace, req)
+		return ctx
+	}
+
+	// the fallback filter is not in the default flow.
+	p := newPipeline("Mock")
+	assert.Len(p.flow, 1)
+	assert.Equal("", p.Handle(newContext()))
+	assert.Equal(0, MockGetFilter(p, "fallback").(*errorHandlingFilter).count)
+	p.Close()
+
+	p = newPipeline("Failing")
+	ctx := newContext()
+	assert.Equal("failed", p.Handle(ctx))
+	fallback := MockGetFilter(p, "fallback").(*errorHandlingFilter)
+	assert.Equal(1, fallback.count)
+	assert.Equal("filter1", fallback.taskErr.Filter)
+	assert.Equal("failed", fallback.taskErr.Result)
+	assert.False(fallback.taskErr.TimedOut)
+	assert.Equal("http://localhost:9095/orders", fallback.taskErr.Request.URL)
+	assert.Equal(http.StatusOK, ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response).StatusCode())
+	p.Close()
+}
+
+type backpressureFilter struct {
+	MockedFilter
+	backpressure bool
+}
+
+func (f *backpressureFilter) Backpressure() bool {
+	return f.backpressure
+}
+
+func TestBackpressure(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	kind := MockFilterKind("Backpressure", nil)
+	kind.CreateInstance = func(spec filters.Spec) filters.Filter {
+		return &backpressureFilter{MockedFilter: MockedFilter{kind: kind, spec: spec.(*MockedSpec)}}
+	}
+	filters.Register(kind)
+
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+filters:
+  - name: filter1
+    kind: Backpressure
+  - name: filter2
+    kind: Backpressure
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+	p := &Pipeline{}
+	p.Init(superSpec, nil)
+	defer p.Close()
+
+	assert.False(p.Backpressure())
+	assert.Empty(p.Status().ObjectStatus.(*Status).Backpressure)
+
+	MockGetFilter(p, "filter2").(*backpressureFilter).backpressure = true
+	assert.True(p.Backpressure())
+	assert.Equal([]string{"filter2"}, p.Status().ObjectStatus.(*Status).Backpressure)
+}
+
+type payloadNeederFilter struct {
+	MockedFilter
+	request, response bool
+}
+
+func (f *payloadNeederFilter) NeedPayload() (bool, bool) {
+	return f.request, f.response
+}
+
+func TestNeedPayload(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	kind := MockFilterKind("PayloadNeeder", nil)
+	kind.CreateInstance = func(spec filters.Spec) filters.Filter {
+		return &payloadNeederFilter{MockedFilter: MockedFilter{kind: kind, spec: spec.(*MockedSpec)}}
+	}
+	filters.Register(kind)
+
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+filters:
+  - name: filter1
+    kind: PayloadNeeder
+  - name: filter2
+    kind: PayloadNeeder
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+	p := &Pipeline{}
+	p.Init(superSpec, nil)
+	defer p.Close()
+
+	req, resp := p.NeedPayload()
+	assert.False(req)
+	assert.False(resp)
+
+	// a tap capturing the bodies needs both payloads while it is running.
+	_, cancel, err := p.Tap(&api.TapSpec{Duration: time.Minute, SampleRate: 1})
+	assert.Nil(err)
+	req, resp = p.NeedPayload()
+	assert.False(req)
+	assert.False(resp)
+	cancel()
+	_, cancel, err = p.Tap(&api.TapSpec{Duration: time.Minute, SampleRate: 1, MaxBodySize: 10})
+	assert.Nil(err)
+	req, resp = p.NeedPayload()
+	assert.True(req)
+	assert.True(resp)
+	cancel()
+	req, resp = p.NeedPayload()
+	assert.False(req)
+	assert.False(resp)
+
+	// the dead letters contain the request payload.
+	superSpec, err = supervisor.NewSpec(yamlConfig + fmt.Sprintf(`
+deadLetter:
+  file:
+    path: %s
+`, filepath.Join(t.TempDir(), "deadletters")))
+	assert.Nil(err)
+	p3 := &Pipeline{}
+	p3.Init(superSpec, nil)
+	defer p3.Close()
+	req, resp = p3.NeedPayload()
+	assert.True(req)
+	assert.False(resp)
+
+	MockGetFilter(p, "filter1").(*payloadNeederFilter).request = true
+	MockGetFilter(p, "filter2").(*payloadNeederFilter).response = true
+	req, resp = p.NeedPayload()
+	assert.True(req)
+	assert.True(resp)
+
+	// a filter not declaring whether it needs the payloads needs both.
+	filters.Register(MockFilterKind("Mock", nil))
+	superSpec, err = supervisor.NewSpec(yamlConfig + `
+  - name: filter3
+    kind: Mock
+`)
+	assert.Nil(err)
+	p2 := &Pipeline{}
+	p2.Init(superSpec, nil)
+	defer p2.Close()
+
+	req, resp = p2.NeedPayload()
+	assert.True(req)
+	assert.True(resp)
+}
+
+type referenceSpec struct {
+	filters.BaseSpec `json:",inline"`
+	Registry         string `json:"registry"`
+}
+
+func (s *referenceSpec) References() []string {
+	return []string{s.Registry}
+}
+
+func TestSpecReferences(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	kind := MockFilterKind("Reference", nil)
+	kind.DefaultSpec = func() filters.Spec {
+		return &referenceSpec{}
+	}
+	filters.Register(kind)
+	filters.Register(MockFilterKind("Mock", nil))
+
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+filters:
+  - name: filter1
+    kind: Reference
+    registry: consul
+  - name: filter2
+    kind: Mock
+  - name: filter3
+    kind: Reference
+    registry: eureka
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+	assert.Equal([]string{"consul", "eureka"}, superSpec.References())
+}
+
+type spanFilter struct {
+	MockedFilter
+	span *tracing.Span
+}
+
+func (f *spanFilter) Handle(ctx *context.Context) string {
+	f.span = ctx.Span()
+	return ""
+}
+
+func TestTracingSpans(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	kind := MockFilterKind("Span", nil)
+	kind.CreateInstance = func(spec filters.Spec) filters.Filter {
+		return &spanFilter{MockedFilter: MockedFilter{kind: kind, spec: spec.(*MockedSpec)}}
+	}
+	filters.Register(kind)
+
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+filters:
+  - name: filter1
+    kind: Span
+  - name: filter2
+    kind: Span
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+	p := &Pipeline{}
+	p.Init(superSpec, nil)
+	defer p.Close()
+
+	tracer, err := tracing.New(&tracing.Spec{
+		ServiceName: "test",
+		SampleRate:  1,
+		Exporter: &tracing.ExporterSpec{
+			Zipkin: &tracing.ZipkinSpec{Endpoint: "http://localhost:2181"},
+		},
+	})
+	assert.Nil(err)
+	defer tracer.Close()
+
+	root := tracer.NewSpan(stdcontext.Background(), "root")
+	ctx := context.New(root)
+	p.Handle(ctx)
+	assert.Equal(root, ctx.Span())
+
+	f1 := MockGetFilter(p, "filter1").(*spanFilter)
+	f2 := MockGetFilter(p, "filter2").(*spanFilter)
+	assert.NotEqual(root, f1.span)
+	assert.NotEqual(f1.span, f2.span)
+	traceID := root.SpanContext().TraceID()
+	assert.Equal(traceID, f1.span.SpanContext().TraceID())
+	assert.Equal(traceID, f2.span.SpanContext().TraceID())
+
+	// no spans are created for the noop span.
+	ctx = context.New(tracing.NoopSpan)
+	p.Handle(ctx)
+	assert.Equal(tracing.NoopSpan, f1.span)
+}
+
+func TestMaintenance(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanup()
+
+	filters.Register(MockFilterKind("Mock", nil))
+
+	assert.Error((&MaintenanceSpec{Body: "a", Template: "b"}).Validate())
+	assert.Error((&MaintenanceSpec{Template: "{{.Path"}).Validate())
+
+	superSpec, err := supervisor.NewSpec(`
+name: http-pipeline-test
+kind: Pipeline
+maintenance:
+  enabled: true
+  retryAfter: 600
+  headers:
+    Content-Type: text/html
+  template: "<p>{{.Pipeline}}: {{.Path | html}} is under maintenance</p>"
+filters:
+  - name: filter1
+    kind: Mock
+`)
+	assert.Nil(err)
+	p := &Pipeline{}
+	p.Init(superSpec, nil)
+
+	newContext := func() *context.Context {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/<orders>", nil)
+		req, _ := httpprot.NewRequest(stdr)
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetRequest(context.DefaultNamespace, req)
+		return ctx
+	}
+
+	ctx := newContext()
+	assert.Equal(resultMaintenance, p.Handle(ctx))
+	assert.Equal(0, MockGetFilter(p, "filter1").(*MockedFilter).count)
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode())
+	assert.Equal("600", resp.HTTPHeader().Get("Retry-After"))
+	assert.Equal("text/html", resp.HTTPHeader().Get("Content-Type"))
+	assert.Equal("<p>http-pipeline-test: /&lt;orders&gt; is under maintenance</p>", string(resp.RawPayload()))
+
+	// the request is escaped unless the page is not HTML.
+	p.spec.Maintenance = &MaintenanceSpec{Enabled: true, Template: "{{.Path}}"}
+	p.maintenanceTemplate = p.spec.Maintenance.compile()
+	ctx = newContext()
+	p.handleMaintenance(ctx, &api.Maintenance{})
+	assert.Equal("/&lt;orders&gt;", string(ctx.GetOutputResponse().(*httpprot.Response).RawPayload()))
+
+	p.spec.Maintenance.Headers = map[string]string{"content-type": "text/plain"}
+	p.maintenanceTemplate = p.spec.Maintenance.compile()
+	ctx = newContext()
+	p.handleMaintenance(ctx, &api.Maintenance{})
+	assert.Equal("/<orders>", string(ctx.GetOutputResponse().(*httpprot.Response).RawPayload()))
+
+	// the default page.
+	p.maintenanceTemplate = nil
+	p.spec.Maintenance = &MaintenanceSpec{Enabled: true}
+	ctx = newContext()
+	p.handleMaintenance(ctx, &api.Maintenance{Message: "upgrading"})
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("service is under maintenance: upgrading\n", string(resp.RawPayload()))
+
+	// the tasks are handled after the maintenance.
+	superSpec, err = supervisor.NewSpec(`
+name: http-pipeline-test
+kind: Pipeline
+filters:
+  - name: filter1
+    kind: Mock
+`)
+	assert.Nil(err)
+	p2 := &Pipeline{}
+	p2.Inherit(superSpec, p, nil)
+	defer p2.Close()
+	assert.Equal("", p2.Handle(newContext()))
+	assert.Equal(1, MockGetFilter(p2, "filter1").(*MockedFilter).count)
+}
@@ -0,0 +1,355 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"bytes"
+	"compress/gzip"
+	stdcontext "context"
+	"fmt"
+	"io"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/util/fasttime"
+)
+
+const (
+	// the labels of the CPU samples of the filters.
+	profileLabelID     = "easegress.profile"
+	profileLabelFilter = "easegress.filter"
+)
+
+var (
+	// profileSeq generates the IDs of the profiles.
+	profileSeq uint64
+
+	// cpuProfileLock is held by the profile sampling the CPU, the CPU
+	// profiler of the runtime is global, so only one profile could sample
+	// the CPU at a time.
+	cpuProfileLock sync.Mutex
+)
+
+type (
+	// profiler holds the profile in progress of a pipeline, it is shared by
+	// all generations of the pipeline, so a profile survives the reloads.
+	profiler struct {
+		session atomic.Pointer[profileSession]
+	}
+
+	profileSession struct {
+		id  string
+		cpu bool
+
+		mutex    sync.Mutex
+		tasks    uint64
+		taskTime time.Duration
+		filters  map[string]*api.FilterProfile
+		order    []string
+	}
+)
+
+// Profile records the wall time of the filters for the duration, and the
+// CPU time of the filters sampled by the CPU profiler of the runtime if cpu
+// is true. It returns when the duration elapses or ctx is done, and only
+// one profile runs on a pipeline at a time.
+func (p *Pipeline) Profile(ctx stdcontext.Context, duration time.Duration, cpu bool) (*api.PipelineProfile, error) {
+	s := &profileSession{
+		id:      strconv.FormatUint(atomic.AddUint64(&profileSeq, 1), 10),
+		filters: make(map[string]*api.FilterProfile),
+	}
+	result := &api.PipelineProfile{
+		Pipeline:  p.superSpec.Name(),
+		StartedAt: time.Now(),
+		Duration:  duration.String(),
+	}
+
+	var buf bytes.Buffer
+	if cpu {
+		if err := startCPUProfile(&buf); err != nil {
+			result.CPUError = err.Error()
+		} else {
+			s.cpu = true
+		}
+	}
+
+	if !p.profiler.session.CompareAndSwap(nil, s) {
+		if s.cpu {
+			stopCPUProfile()
+		}
+		return nil, fmt.Errorf("pipeline %s is being profiled", result.Pipeline)
+	}
+
+	key := "profile/" + s.id
+	p.AddTaskObserver(key, s.observeTask)
+
+	timer := time.NewTimer(duration)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		timer.Stop()
+	}
+
+	p.RemoveTaskObserver(key)
+	p.profiler.session.CompareAndSwap(s, nil)
+	result.Duration = time.Since(result.StartedAt).Round(time.Millisecond).String()
+
+	var cpuTime map[string]time.Duration
+	if s.cpu {
+		stopCPUProfile()
+		var err error
+		if cpuTime, err = parseCPUProfile(buf.Bytes(), s.id); err != nil {
+			result.CPUError = err.Error()
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result.Tasks, result.TaskTime = s.tasks, s.taskTime
+	for _, name := range s.order {
+		f := s.filters[name]
+		f.CPUTime = cpuTime[name]
+		result.Filters = append(result.Filters, f)
+	}
+	return result, nil
+}
+
+func startCPUProfile(w io.Writer) error {
+	if !cpuProfileLock.TryLock() {
+		return fmt.Errorf("another profile is sampling the CPU")
+	}
+	if err := pprof.StartCPUProfile(w); err != nil {
+		cpuProfileLock.Unlock()
+		return err
+	}
+	return nil
+}
+
+func stopCPUProfile() {
+	pprof.StopCPUProfile()
+	cpuProfileLock.Unlock()
+}
+
+// profileFilter runs the filter of node, and records the time spent in it
+// if the pipeline is being profiled. The CPU samples of the filter are
+// labelled with the ID of the profile and the alias of the filter.
+func (p *Pipeline) profileFilter(ctx *context.Context, node *FlowNode, alias string, start time.Time) string {
+	var s *profileSession
+	if p.profiler != nil {
+		s = p.profiler.session.Load()
+	}
+	if s == nil {
+		return p.handleFilter(ctx, node, alias, start)
+	}
+
+	var result string
+	if s.cpu {
+		labels := pprof.Labels(profileLabelID, s.id, profileLabelFilter, alias)
+		pprof.Do(stdcontext.Background(), labels, func(stdcontext.Context) {
+			result = p.handleFilter(ctx, node, alias, start)
+		})
+	} else {
+		result = p.handleFilter(ctx, node, alias, start)
+	}
+
+	s.recordFilter(alias, node.filter.Kind().Name, fasttime.Since(start))
+	return result
+}
+
+func (s *profileSession) recordFilter(name, kind string, d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	f := s.filters[name]
+	if f == nil {
+		f = &api.FilterProfile{Name: name, Kind: kind}
+		s.filters[name] = f
+		s.order = append(s.order, name)
+	}
+	f.Calls++
+	f.WallTime += d
+}
+
+func (s *profileSession) observeTask(ctx *context.Context, result string, duration time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.tasks++
+	s.taskTime += duration
+}
+
+// parseCPUProfile parses the CPU profile in the gzipped protobuf format of
+// pprof, and returns the CPU time of the samples labelled with id by the
+// filters.
+func parseCPUProfile(data []byte, id string) (map[string]time.Duration, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CPU profile: %v", err)
+	}
+	data, err = io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CPU profile: %v", err)
+	}
+
+	type sample struct {
+		values []int64
+		labels [][2]int64 // key and value indexes of the string table
+	}
+
+	var (
+		strs        []string
+		sampleTypes []int64
+		samples     []*sample
+	)
+
+	// the field numbers are defined in profile.proto of pprof.
+	err = walkMessage(data, func(num protowire.Number, v uint64, b []byte) error {
+		switch num {
+		case 1: // sample_type
+			return walkMessage(b, func(num protowire.Number, v uint64, b []byte) error {
+				if num == 1 { // type
+					sampleTypes = append(sampleTypes, int64(v))
+				}
+				return nil
+			})
+		case 2: // sample
+			s := &sample{}
+			samples = append(samples, s)
+			return walkMessage(b, func(num protowire.Number, v uint64, b []byte) error {
+				switch num {
+				case 2: // value
+					if b == nil {
+						s.values = append(s.values, int64(v))
+						return nil
+					}
+					for len(b) > 0 {
+						x, n := protowire.ConsumeVarint(b)
+						if n < 0 {
+							return protowire.ParseError(n)
+						}
+						s.values = append(s.values, int64(x))
+						b = b[n:]
+					}
+				case 3: // label
+					var l [2]int64
+					err := walkMessage(b, func(num protowire.Number, v uint64, b []byte) error {
+						if num == 1 || num == 2 { // key or str
+							l[num-1] = int64(v)
+						}
+						return nil
+					})
+					s.labels = append(s.labels, l)
+					return err
+				}
+				return nil
+			})
+		case 6: // string_table
+			strs = append(strs, string(b))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid CPU profile: %v", err)
+	}
+
+	str := func(i int64) string {
+		if i < 0 || i >= int64(len(strs)) {
+			return ""
+		}
+		return strs[i]
+	}
+
+	index := -1
+	for i, t := range sampleTypes {
+		if str(t) == "cpu" {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("no cpu samples in CPU profile")
+	}
+
+	result := make(map[string]time.Duration)
+	for _, s := range samples {
+		if index >= len(s.values) {
+			continue
+		}
+		var profileID, filter string
+		for _, l := range s.labels {
+			switch str(l[0]) {
+			case profileLabelID:
+				profileID = str(l[1])
+			case profileLabelFilter:
+				filter = str(l[1])
+			}
+		}
+		if profileID == id && filter != "" {
+			result[filter] += time.Duration(s.values[index])
+		}
+	}
+	return result, nil
+}
+
+// walkMessage calls fn with the fields of a protobuf message, v is the
+// value of a varint field, and b is the data of a length-delimited field.
+// The fields of the other types are skipped.
+func walkMessage(data []byte, fn func(num protowire.Number, v uint64, b []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := fn(num, v, nil); err != nil {
+				return err
+			}
+			data = data[n:]
+		case protowire.BytesType:
+			b, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			if err := fn(num, 0, b); err != nil {
+				return err
+			}
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return nil
+}
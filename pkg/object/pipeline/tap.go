@@ -0,0 +1,271 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+const (
+	// tapBufferSize is the buffer size of the records of a tap, the
+	// records are dropped if the operator reads them too slowly, so the
+	// tap never blocks the pipeline.
+	tapBufferSize = 64
+
+	redacted = "[REDACTED]"
+)
+
+// defaultRedactHeaders are the headers always redacted by a tap and in the
+// dead letters.
+var defaultRedactHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+}
+
+// tapSeq generates the keys of the task observers of the taps.
+var tapSeq uint64
+
+type (
+	// TapRecord is the summary of a task captured by a tap.
+	TapRecord struct {
+		Time     time.Time       `json:"time"`
+		Result   string          `json:"result,omitempty"`
+		Duration string          `json:"duration"`
+		Request  *TapRequest     `json:"request,omitempty"`
+		Response *TapResponse    `json:"response,omitempty"`
+		Filters  []*TapFilterRun `json:"filters,omitempty"`
+		// Dropped is the number of the records dropped before this one,
+		// because the operator reads them too slowly.
+		Dropped uint64 `json:"dropped,omitempty"`
+	}
+
+	// TapRequest is the summary of the request of a task, as it is at the
+	// end of the pipeline.
+	TapRequest struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header,omitempty"`
+		TapBody
+	}
+
+	// TapResponse is the summary of the response of a task.
+	TapResponse struct {
+		StatusCode int         `json:"statusCode"`
+		Header     http.Header `json:"header,omitempty"`
+		TapBody
+	}
+
+	// TapBody is the body of a request or response, truncated to the max
+	// body size of the tap.
+	TapBody struct {
+		Body          string `json:"body,omitempty"`
+		BodySize      int64  `json:"bodySize"`
+		BodyTruncated bool   `json:"bodyTruncated,omitempty"`
+	}
+
+	// TapFilterRun is the result of a filter in a task.
+	TapFilterRun struct {
+		Name     string `json:"name"`
+		Kind     string `json:"kind"`
+		Result   string `json:"result,omitempty"`
+		Duration string `json:"duration"`
+	}
+
+	tap struct {
+		spec          *api.TapSpec
+		redactHeaders []string
+		patterns      []*regexp.Regexp
+
+		// mutex protects closed and ch, the records are never sent after
+		// ch is closed.
+		mutex   sync.Mutex
+		closed  bool
+		ch      chan interface{}
+		dropped uint64
+	}
+)
+
+// Tap starts a tap on the pipeline, which captures the summaries of the
+// sampled tasks with the sensitive data redacted. It returns a channel of
+// *TapRecord, which is closed when the tap expires, and a function to stop
+// the tap in advance. The tap survives the reloads of the pipeline.
+func (p *Pipeline) Tap(spec *api.TapSpec) (<-chan interface{}, func(), error) {
+	t := &tap{
+		spec:          spec,
+		redactHeaders: append(append([]string{}, defaultRedactHeaders...), spec.RedactHeaders...),
+		ch:            make(chan interface{}, tapBufferSize),
+	}
+	for _, pattern := range spec.RedactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid redact pattern %s: %v", pattern, err)
+		}
+		t.patterns = append(t.patterns, re)
+	}
+
+	// the bodies of the streamed payloads can't be captured, so they are
+	// buffered while the tap is running.
+	captureBody := spec.MaxBodySize > 0
+	if captureBody {
+		p.observers.bodyTaps.Add(1)
+	}
+	key := fmt.Sprintf("tap/%d", atomic.AddUint64(&tapSeq, 1))
+	p.AddTaskObserver(key, t.observe)
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			p.RemoveTaskObserver(key)
+			if captureBody {
+				p.observers.bodyTaps.Add(-1)
+			}
+			t.close()
+		})
+	}
+	timer := time.AfterFunc(spec.Duration, stop)
+
+	return t.ch, func() {
+		timer.Stop()
+		stop()
+	}, nil
+}
+
+func (t *tap) close() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.closed = true
+	close(t.ch)
+}
+
+func (t *tap) observe(ctx *context.Context, result string, duration time.Duration) {
+	if t.spec.SampleRate < 1 && rand.Float64() >= t.spec.SampleRate {
+		return
+	}
+
+	record := t.newRecord(ctx, result, duration)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closed {
+		return
+	}
+	record.Dropped = t.dropped
+	select {
+	case t.ch <- record:
+		t.dropped = 0
+	default:
+		t.dropped++
+	}
+}
+
+func (t *tap) newRecord(ctx *context.Context, result string, duration time.Duration) *TapRecord {
+	record := &TapRecord{
+		Time:     time.Now().Add(-duration),
+		Result:   result,
+		Duration: duration.String(),
+	}
+
+	if req, ok := ctx.GetRequest(context.DefaultNamespace).(*httpprot.Request); ok {
+		record.Request = &TapRequest{
+			Method: req.Method(),
+			URL:    t.redact(req.URL().String()),
+			Header: redactHeader(req.HTTPHeader(), t.redactHeaders),
+		}
+		if !req.IsStream() {
+			record.Request.TapBody = t.body(req.RawPayload())
+		} else {
+			record.Request.BodySize = req.PayloadSize()
+		}
+	}
+
+	if resp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response); ok {
+		record.Response = &TapResponse{
+			StatusCode: resp.StatusCode(),
+			Header:     redactHeader(resp.HTTPHeader(), t.redactHeaders),
+		}
+		if !resp.IsStream() {
+			record.Response.TapBody = t.body(resp.RawPayload())
+		} else {
+			record.Response.BodySize = resp.PayloadSize()
+		}
+	}
+
+	if stats, ok := StatsDataKey.Get(ctx); ok {
+		for _, s := range stats {
+			record.Filters = append(record.Filters, &TapFilterRun{
+				Name:     s.Name,
+				Kind:     s.Kind,
+				Result:   s.Result,
+				Duration: s.Duration.String(),
+			})
+		}
+	}
+
+	return record
+}
+
+// body redacts the body, then truncates it to the max body size. It is
+// redacted first, so a secret across the truncation point is not leaked.
+func (t *tap) body(data []byte) TapBody {
+	b := TapBody{BodySize: int64(len(data))}
+	if t.spec.MaxBodySize == 0 {
+		return b
+	}
+	b.Body = t.redact(string(data))
+	if len(b.Body) > t.spec.MaxBodySize {
+		b.Body, b.BodyTruncated = b.Body[:t.spec.MaxBodySize], true
+	}
+	return b
+}
+
+func (t *tap) redact(s string) string {
+	for _, re := range t.patterns {
+		s = re.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+// RedactHeader returns a copy of the header with the values of the
+// credential headers redacted, like in the taps and the dead letters.
+func RedactHeader(h http.Header) http.Header {
+	return redactHeader(h, defaultRedactHeaders)
+}
+
+// redactHeader returns a copy of the header with the values of the names
+// redacted.
+func redactHeader(h http.Header, names []string) http.Header {
+	h = h.Clone()
+	for _, name := range names {
+		if values := h.Values(name); len(values) > 0 {
+			h.Set(name, redacted)
+		}
+	}
+	return h
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// startSpan starts the span of the pipeline as a child of the span of ctx,
+// the returned function ends it with the result of the pipeline and
+// restores the span of ctx.
+func (p *Pipeline) startSpan(ctx *context.Context) func(result string) {
+	parent := ctx.Span()
+	if parent == nil || parent.IsNoop() {
+		return func(string) {}
+	}
+
+	span := parent.NewChild("pipeline " + p.superSpec.Name())
+	span.SetAttributes(attribute.String("pipeline.name", p.superSpec.Name()))
+	ctx.SetSpan(span)
+
+	return func(result string) {
+		ctx.SetSpan(parent)
+		if result != "" {
+			span.SetAttributes(attribute.String("pipeline.result", result))
+			span.SetStatus(codes.Error, result)
+		}
+		span.End()
+	}
+}
+
+// handleFilter runs the filter of node in its own span, the span of the
+// filter is the parent of the spans created by the filter, like the span
+// of the request to the backend server.
+func (p *Pipeline) handleFilter(ctx *context.Context, node *FlowNode, alias string, start time.Time) string {
+	parent := ctx.Span()
+	if parent == nil || parent.IsNoop() {
+		return node.filter.Handle(ctx)
+	}
+
+	span := parent.NewChildWithStart("filter "+alias, start)
+	span.SetAttributes(
+		attribute.String("filter.name", alias),
+		attribute.String("filter.kind", node.filter.Kind().Name),
+	)
+	ctx.SetSpan(span)
+	result := node.filter.Handle(ctx)
+	ctx.SetSpan(parent)
+
+	if result != "" {
+		span.SetAttributes(attribute.String("filter.result", result))
+		span.SetStatus(codes.Error, result)
+	}
+	span.End()
+	return result
+}
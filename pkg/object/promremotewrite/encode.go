@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package promremotewrite
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type (
+	label struct {
+		name  string
+		value string
+	}
+
+	// timeSeries is a time series with a single sample.
+	timeSeries struct {
+		labels []label
+		value  float64
+		// timestamp is in milliseconds.
+		timestamp int64
+	}
+)
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	if math.IsInf(f, -1) {
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func included(name string, include []*regexp.Regexp) bool {
+	if len(include) == 0 {
+		return true
+	}
+	for _, r := range include {
+		if r.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// collect converts the metric families to the time series. The summaries
+// and the histograms are expanded to the series of their quantiles or
+// buckets, sums and counts, like the text exposition format. The external
+// labels never override the labels of the metrics.
+func collect(mfs []*dto.MetricFamily, externalLabels map[string]string, include []*regexp.Regexp, now int64) []*timeSeries {
+	var result []*timeSeries
+
+	for _, mf := range mfs {
+		name := mf.GetName()
+		if !included(name, include) {
+			continue
+		}
+
+		for _, m := range mf.Metric {
+			labels := make(map[string]string, len(m.Label)+len(externalLabels)+1)
+			for k, v := range externalLabels {
+				labels[k] = v
+			}
+			for _, l := range m.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+
+			ts := now
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+
+			add := func(name string, value float64, extraName, extraValue string) {
+				s := &timeSeries{value: value, timestamp: ts}
+				s.labels = make([]label, 0, len(labels)+2)
+				s.labels = append(s.labels, label{name: "__name__", value: name})
+				for k, v := range labels {
+					s.labels = append(s.labels, label{name: k, value: v})
+				}
+				if extraName != "" {
+					s.labels = append(s.labels, label{name: extraName, value: extraValue})
+				}
+				sort.Slice(s.labels, func(i, j int) bool {
+					return s.labels[i].name < s.labels[j].name
+				})
+				result = append(result, s)
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.GetCounter().GetValue(), "", "")
+			case dto.MetricType_GAUGE:
+				add(name, m.GetGauge().GetValue(), "", "")
+			case dto.MetricType_UNTYPED:
+				add(name, m.GetUntyped().GetValue(), "", "")
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.Quantile {
+					add(name, q.GetValue(), "quantile", formatFloat(q.GetQuantile()))
+				}
+				add(name+"_sum", s.GetSampleSum(), "", "")
+				add(name+"_count", float64(s.GetSampleCount()), "", "")
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				hasInf := false
+				for _, b := range h.Bucket {
+					if math.IsInf(b.GetUpperBound(), 1) {
+						hasInf = true
+					}
+					add(name+"_bucket", float64(b.GetCumulativeCount()), "le", formatFloat(b.GetUpperBound()))
+				}
+				if !hasInf {
+					add(name+"_bucket", float64(h.GetSampleCount()), "le", "+Inf")
+				}
+				add(name+"_sum", h.GetSampleSum(), "", "")
+				add(name+"_count", float64(h.GetSampleCount()), "", "")
+			}
+		}
+	}
+
+	return result
+}
+
+// encodeWriteRequest encodes the time series as a remote write request in
+// protobuf:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []*timeSeries) []byte {
+	var buf, ts, b []byte
+
+	for _, s := range series {
+		ts = ts[:0]
+		for _, l := range s.labels {
+			b = b[:0]
+			b = protowire.AppendTag(b, 1, protowire.BytesType)
+			b = protowire.AppendString(b, l.name)
+			b = protowire.AppendTag(b, 2, protowire.BytesType)
+			b = protowire.AppendString(b, l.value)
+
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, b)
+		}
+
+		b = b[:0]
+		b = protowire.AppendTag(b, 1, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(s.value))
+		b = protowire.AppendTag(b, 2, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(s.timestamp))
+
+		ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+		ts = protowire.AppendBytes(ts, b)
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, ts)
+	}
+
+	return buf
+}
@@ -0,0 +1,333 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package promremotewrite provides PrometheusRemoteWrite to push the
+// metrics to the storages supporting the Prometheus remote write protocol.
+package promremotewrite
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+const (
+	// Category is the category of PrometheusRemoteWrite.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of PrometheusRemoteWrite.
+	Kind = "PrometheusRemoteWrite"
+
+	defaultInterval = 30 * time.Second
+	minInterval     = time.Second
+	defaultTimeout  = 10 * time.Second
+
+	// maxSeriesPerRequest is the max number of the time series in a
+	// request, the samples are split into multiple requests if there
+	// are more.
+	maxSeriesPerRequest = 2000
+)
+
+var aliases = []string{
+	"promremotewrite",
+}
+
+func init() {
+	supervisor.Register(&PrometheusRemoteWrite{})
+	api.RegisterObject(&api.APIResource{
+		Category: Category,
+		Kind:     Kind,
+		Name:     strings.ToLower(Kind),
+		Aliases:  aliases,
+	})
+}
+
+type (
+	// PrometheusRemoteWrite pushes the metrics of the member to the
+	// storages supporting the Prometheus remote write protocol, like
+	// Cortex, Mimir and VictoriaMetrics, for the members could not be
+	// scraped.
+	PrometheusRemoteWrite struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+		writer    *writer
+
+		mutex  sync.Mutex
+		status *Status
+
+		done chan struct{}
+	}
+
+	// Spec describes PrometheusRemoteWrite.
+	Spec struct {
+		URL string `json:"url" jsonschema:"required,format=uri"`
+		// Interval is the interval to push the samples, default is 30s.
+		Interval string `json:"interval,omitempty" jsonschema:"format=duration"`
+		// Timeout is the timeout of a push, default is 10s.
+		Timeout string            `json:"timeout,omitempty" jsonschema:"format=duration"`
+		Headers map[string]string `json:"headers,omitempty"`
+
+		// Username and Password are for the basic authentication, and
+		// BearerToken is for the bearer token authentication.
+		Username    string `json:"username,omitempty"`
+		Password    string `json:"password,omitempty"`
+		BearerToken string `json:"bearerToken,omitempty"`
+
+		// ExternalLabels are added to all time series, but never override
+		// the labels of the metrics.
+		ExternalLabels map[string]string `json:"externalLabels,omitempty"`
+		// Include are the regular expressions of the names of the metrics
+		// to push, all metrics are pushed if it is empty.
+		Include []string `json:"include,omitempty"`
+	}
+
+	// Status is the status of PrometheusRemoteWrite.
+	Status struct {
+		Pushes   uint64 `json:"pushes"`
+		Failures uint64 `json:"failures"`
+		// Series is the number of the time series of the last push.
+		Series    int       `json:"series"`
+		LastError string    `json:"lastError,omitempty"`
+		LastPush  time.Time `json:"lastPush,omitempty"`
+	}
+
+	// writer pushes the samples gathered from the gatherer.
+	writer struct {
+		spec     *Spec
+		client   *http.Client
+		gatherer prometheus.Gatherer
+		include  []*regexp.Regexp
+	}
+)
+
+// Validate validates the spec of PrometheusRemoteWrite.
+func (spec *Spec) Validate() error {
+	if spec.Interval != "" {
+		d, err := time.ParseDuration(spec.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid interval %s: %v", spec.Interval, err)
+		}
+		if d < minInterval {
+			return fmt.Errorf("interval must not be less than %v", minInterval)
+		}
+	}
+
+	if spec.Timeout != "" {
+		d, err := time.ParseDuration(spec.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %s", spec.Timeout)
+		}
+	}
+
+	if spec.BearerToken != "" && spec.Username != "" {
+		return fmt.Errorf("only one of basic authentication and bearer token could be specified")
+	}
+
+	for _, s := range spec.Include {
+		if _, err := regexp.Compile(s); err != nil {
+			return fmt.Errorf("invalid include %s: %v", s, err)
+		}
+	}
+	return nil
+}
+
+func (spec *Spec) interval() time.Duration {
+	if spec.Interval == "" {
+		return defaultInterval
+	}
+	d, _ := time.ParseDuration(spec.Interval)
+	return d
+}
+
+func newWriter(spec *Spec, gatherer prometheus.Gatherer) *writer {
+	timeout := defaultTimeout
+	if spec.Timeout != "" {
+		timeout, _ = time.ParseDuration(spec.Timeout)
+	}
+
+	w := &writer{
+		spec:     spec,
+		client:   &http.Client{Timeout: timeout},
+		gatherer: gatherer,
+	}
+	for _, s := range spec.Include {
+		w.include = append(w.include, regexp.MustCompile(s))
+	}
+	return w
+}
+
+// push gathers the metrics and pushes them, it returns the number of the
+// time series pushed.
+func (w *writer) push(now time.Time) (int, error) {
+	mfs, err := w.gatherer.Gather()
+	if err != nil && len(mfs) == 0 {
+		return 0, fmt.Errorf("gather metrics failed: %v", err)
+	}
+
+	series := collect(mfs, w.spec.ExternalLabels, w.include, now.UnixMilli())
+	for start := 0; start < len(series); start += maxSeriesPerRequest {
+		end := start + maxSeriesPerRequest
+		if end > len(series) {
+			end = len(series)
+		}
+		if err := w.send(encodeWriteRequest(series[start:end])); err != nil {
+			return start, err
+		}
+	}
+	return len(series), nil
+}
+
+func (w *writer) send(data []byte) error {
+	body := snappy.Encode(nil, data)
+	req, err := http.NewRequest(http.MethodPost, w.spec.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	for k, v := range w.spec.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "Easegress")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.spec.Username != "" {
+		req.SetBasicAuth(w.spec.Username, w.spec.Password)
+	} else if w.spec.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+w.spec.BearerToken)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, msg)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Category returns the category of PrometheusRemoteWrite.
+func (prw *PrometheusRemoteWrite) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of PrometheusRemoteWrite.
+func (prw *PrometheusRemoteWrite) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of PrometheusRemoteWrite.
+func (prw *PrometheusRemoteWrite) DefaultSpec() interface{} {
+	return &Spec{
+		Interval: defaultInterval.String(),
+	}
+}
+
+// Init initializes PrometheusRemoteWrite.
+func (prw *PrometheusRemoteWrite) Init(superSpec *supervisor.Spec) {
+	prw.superSpec = superSpec
+	prw.spec = superSpec.ObjectSpec().(*Spec)
+	prw.reload(nil)
+}
+
+// Inherit inherits previous generation of PrometheusRemoteWrite, the
+// counters of the status are kept.
+func (prw *PrometheusRemoteWrite) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	prw.superSpec = superSpec
+	prw.spec = superSpec.ObjectSpec().(*Spec)
+
+	prev := previousGeneration.(*PrometheusRemoteWrite)
+	prev.Close()
+	prw.reload(prev)
+}
+
+func (prw *PrometheusRemoteWrite) reload(prev *PrometheusRemoteWrite) {
+	prw.writer = newWriter(prw.spec, prometheus.DefaultGatherer)
+
+	prw.status = &Status{}
+	if prev != nil {
+		prev.mutex.Lock()
+		*prw.status = *prev.status
+		prev.mutex.Unlock()
+	}
+
+	prw.done = make(chan struct{})
+	go prw.run()
+}
+
+func (prw *PrometheusRemoteWrite) run() {
+	ticker := time.NewTicker(prw.spec.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-prw.done:
+			return
+		case now := <-ticker.C:
+			prw.push(now)
+		}
+	}
+}
+
+func (prw *PrometheusRemoteWrite) push(now time.Time) {
+	n, err := prw.writer.push(now)
+
+	prw.mutex.Lock()
+	defer prw.mutex.Unlock()
+
+	prw.status.Series = n
+	prw.status.LastPush = now
+	if err != nil {
+		logger.Errorf("%s: push metrics to %s failed: %v", prw.superSpec.Name(), prw.spec.URL, err)
+		prw.status.Failures++
+		prw.status.LastError = err.Error()
+		return
+	}
+	prw.status.Pushes++
+	prw.status.LastError = ""
+}
+
+// Status returns the status of PrometheusRemoteWrite.
+func (prw *PrometheusRemoteWrite) Status() *supervisor.Status {
+	prw.mutex.Lock()
+	defer prw.mutex.Unlock()
+
+	s := *prw.status
+	return &supervisor.Status{ObjectStatus: &s}
+}
+
+// Close closes PrometheusRemoteWrite.
+func (prw *PrometheusRemoteWrite) Close() {
+	close(prw.done)
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package promremotewrite
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest decodes the remote write request to a map from the
+// labels of the time series, like `a="1",b="2"`, to their values.
+func decodeWriteRequest(t *testing.T, data []byte) map[string]float64 {
+	result := map[string]float64{}
+
+	consume := func(b []byte, fn func(num protowire.Number, v []byte, u uint64)) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			assert.GreaterOrEqual(t, n, 0)
+			b = b[n:]
+			switch typ {
+			case protowire.BytesType:
+				v, n := protowire.ConsumeBytes(b)
+				fn(num, v, 0)
+				b = b[n:]
+			case protowire.Fixed64Type:
+				v, n := protowire.ConsumeFixed64(b)
+				fn(num, nil, v)
+				b = b[n:]
+			case protowire.VarintType:
+				v, n := protowire.ConsumeVarint(b)
+				fn(num, nil, v)
+				b = b[n:]
+			default:
+				t.Fatalf("unexpected wire type %v", typ)
+			}
+		}
+	}
+
+	consume(data, func(_ protowire.Number, ts []byte, _ uint64) {
+		key, value := "", 0.0
+		consume(ts, func(num protowire.Number, v []byte, _ uint64) {
+			if num == 1 {
+				var name, val string
+				consume(v, func(num protowire.Number, v []byte, _ uint64) {
+					if num == 1 {
+						name = string(v)
+					} else {
+						val = string(v)
+					}
+				})
+				if key != "" {
+					key += ","
+				}
+				key += name + `="` + val + `"`
+				return
+			}
+			consume(v, func(num protowire.Number, _ []byte, u uint64) {
+				if num == 1 {
+					value = math.Float64frombits(u)
+				} else {
+					assert.Equal(t, uint64(1000), u)
+				}
+			})
+		})
+		result[key] = value
+	})
+
+	return result
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{URL: "http://127.0.0.1"}).Validate())
+	assert.NoError((&Spec{Interval: "10s", Timeout: "5s", Include: []string{"^http_"}}).Validate())
+	assert.Error((&Spec{Interval: "10ms"}).Validate())
+	assert.Error((&Spec{Timeout: "x"}).Validate())
+	assert.Error((&Spec{Username: "u", BearerToken: "t"}).Validate())
+	assert.Error((&Spec{Include: []string{"("}}).Validate())
+}
+
+func TestPush(t *testing.T) {
+	assert := assert.New(t)
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "requests_total"}, []string{"code", "env"})
+	counter.WithLabelValues("200", "prod").Add(3)
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "duration", Buckets: []float64{1, 10}})
+	histogram.Observe(5)
+	summary := prometheus.NewSummary(prometheus.SummaryOpts{Name: "size", Objectives: map[float64]float64{0.5: 0.05}})
+	summary.Observe(7)
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "ignored"})
+	registry.MustRegister(counter, histogram, summary, gauge)
+
+	var got map[string]float64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal("application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal("0.1.0", r.Header.Get("X-Prometheus-Remote-Write-Version"))
+		assert.Equal("tenant1", r.Header.Get("X-Scope-OrgID"))
+		assert.Equal("Bearer token", r.Header.Get("Authorization"))
+
+		body, _ := io.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, body)
+		assert.NoError(err)
+		got = decodeWriteRequest(t, data)
+	}))
+	defer server.Close()
+
+	spec := &Spec{
+		URL:            server.URL,
+		Headers:        map[string]string{"X-Scope-OrgID": "tenant1"},
+		BearerToken:    "token",
+		ExternalLabels: map[string]string{"cluster": "eg", "env": "test"},
+		Include:        []string{"^requests_", "^duration$", "^size$"},
+	}
+	w := newWriter(spec, registry)
+
+	n, err := w.push(time.UnixMilli(1000))
+	assert.NoError(err)
+	assert.Equal(9, n)
+	assert.Equal(map[string]float64{
+		`__name__="requests_total",cluster="eg",code="200",env="prod"`: 3,
+		`__name__="duration_bucket",cluster="eg",env="test",le="1"`:    0,
+		`__name__="duration_bucket",cluster="eg",env="test",le="10"`:   1,
+		`__name__="duration_bucket",cluster="eg",env="test",le="+Inf"`: 1,
+		`__name__="duration_sum",cluster="eg",env="test"`:              5,
+		`__name__="duration_count",cluster="eg",env="test"`:            1,
+		`__name__="size",cluster="eg",env="test",quantile="0.5"`:       7,
+		`__name__="size_sum",cluster="eg",env="test"`:                  7,
+		`__name__="size_count",cluster="eg",env="test"`:                1,
+	}, got)
+}
+
+func TestPushFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("out of order sample"))
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "up"}))
+
+	w := newWriter(&Spec{URL: server.URL}, registry)
+	_, err := w.push(time.Now())
+	assert.ErrorContains(err, "out of order sample")
+}
@@ -0,0 +1,320 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package scheduler implements the Scheduler, which triggers a pipeline on
+// a cron schedule.
+package scheduler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/tracing"
+)
+
+const (
+	// Category is the category of Scheduler.
+	Category = supervisor.CategoryTrafficGate
+
+	// Kind is the kind of Scheduler.
+	Kind = "Scheduler"
+)
+
+// FireTimeDataKey is the key of the task data where the Scheduler stores the
+// fire time.
+var FireTimeDataKey = context.NewDataKey[time.Time]("", "SCHEDULER_FIRE_TIME")
+
+var _ supervisor.TrafficObject = (*Scheduler)(nil)
+
+func init() {
+	context.RegisterRuntimeData(FireTimeDataKey.Decl())
+	supervisor.Register(&Scheduler{})
+	api.RegisterObject(&api.APIResource{
+		Category: Category,
+		Kind:     Kind,
+		Name:     strings.ToLower(Kind),
+		Aliases:  []string{"schedulers", "sch"},
+	})
+}
+
+type (
+	// Scheduler triggers a pipeline on a cron schedule.
+	Scheduler struct {
+		superSpec *supervisor.Spec
+		spec      *Spec
+		muxMapper context.MuxMapper
+		cls       cluster.Cluster
+		schedule  cron.Schedule
+
+		done chan struct{}
+		wg   sync.WaitGroup
+
+		lock   sync.Mutex
+		status Status
+	}
+
+	// Spec describes the Scheduler.
+	Spec struct {
+		// Schedule is a standard cron expression with 5 fields, or a
+		// descriptor like @hourly and @every 10m, the time zone could be
+		// specified by a prefix like CRON_TZ=Asia/Shanghai. The fire times
+		// of @every are aligned to the multiples of the interval, so they
+		// are the same on all members.
+		Schedule string       `json:"schedule" jsonschema:"required"`
+		Pipeline string       `json:"pipeline" jsonschema:"required"`
+		Request  *RequestSpec `json:"request,omitempty"`
+		// AllMembers fires the pipeline on all members of the cluster,
+		// otherwise only one member fires it each time.
+		AllMembers bool `json:"allMembers,omitempty"`
+	}
+
+	// RequestSpec describes the HTTP request sent to the pipeline.
+	RequestSpec struct {
+		Method  string            `json:"method,omitempty" jsonschema:"enum=,enum=GET,enum=HEAD,enum=PUT,enum=POST,enum=PATCH,enum=DELETE"`
+		Path    string            `json:"path,omitempty" jsonschema:"pattern=^/"`
+		Headers map[string]string `json:"headers,omitempty"`
+		Body    string            `json:"body,omitempty"`
+	}
+
+	// alignedSchedule is the schedule of @every, it fires at the multiples
+	// of the interval since the zero time instead of counting from the start
+	// of the member, like cron.ConstantDelaySchedule does, so all members
+	// calculate the same fire times and only one of them claims a fire.
+	alignedSchedule struct {
+		delay time.Duration
+	}
+
+	// Status is the status of Scheduler on this member.
+	Status struct {
+		NextFireTime   string `json:"nextFireTime,omitempty"`
+		LastFireTime   string `json:"lastFireTime,omitempty"`
+		LastResult     string `json:"lastResult,omitempty"`
+		LastStatusCode int    `json:"lastStatusCode,omitempty"`
+		// Fired is the number of fires on this member, and Skipped is the
+		// number of fires taken by other members.
+		Fired   uint64 `json:"fired"`
+		Skipped uint64 `json:"skipped"`
+		Failed  uint64 `json:"failed"`
+	}
+)
+
+// References returns the pipeline fired by the Scheduler.
+func (s *Spec) References() []string {
+	return []string{s.Pipeline}
+}
+
+// Validate validates Spec.
+func (s *Spec) Validate() error {
+	if _, err := parseSchedule(s.Schedule); err != nil {
+		return fmt.Errorf("invalid schedule %q: %v", s.Schedule, err)
+	}
+	return nil
+}
+
+// Next returns the next fire time after t.
+func (s alignedSchedule) Next(t time.Time) time.Time {
+	return t.Truncate(s.delay).Add(s.delay)
+}
+
+func parseSchedule(schedule string) (cron.Schedule, error) {
+	sched, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return nil, err
+	}
+	if cds, ok := sched.(cron.ConstantDelaySchedule); ok {
+		return alignedSchedule{delay: cds.Delay}, nil
+	}
+	return sched, nil
+}
+
+// Category returns the category of Scheduler.
+func (s *Scheduler) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of Scheduler.
+func (s *Scheduler) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of Scheduler.
+func (s *Scheduler) DefaultSpec() interface{} {
+	return &Spec{}
+}
+
+// Init initializes Scheduler.
+func (s *Scheduler) Init(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
+	s.superSpec, s.spec, s.muxMapper = superSpec, superSpec.ObjectSpec().(*Spec), muxMapper
+	s.reload()
+}
+
+// Inherit inherits previous generation of Scheduler.
+func (s *Scheduler) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object, muxMapper context.MuxMapper) {
+	previousGeneration.Close()
+	s.Init(superSpec, muxMapper)
+}
+
+func (s *Scheduler) reload() {
+	if super := s.superSpec.Super(); super != nil {
+		s.cls = super.Cluster()
+	}
+	s.schedule, _ = parseSchedule(s.spec.Schedule)
+	s.done = make(chan struct{})
+
+	s.wg.Add(1)
+	go s.run()
+}
+
+// run fires the pipeline on schedule, the pipeline is called in the same
+// goroutine, so the fires during a long run are skipped.
+func (s *Scheduler) run() {
+	defer s.wg.Done()
+
+	for {
+		next := s.schedule.Next(time.Now())
+		s.lock.Lock()
+		s.status.NextFireTime = next.Format(time.RFC3339)
+		s.lock.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if !s.spec.AllMembers && !s.claim(next) {
+			s.lock.Lock()
+			s.status.Skipped++
+			s.lock.Unlock()
+			continue
+		}
+		s.fire(next)
+	}
+}
+
+// claim claims the fire at fireTime for this member, only the first member
+// claiming it wins. All members calculate the same fire time from the
+// schedule, so the clocks of them needn't be exactly the same.
+func (s *Scheduler) claim(fireTime time.Time) bool {
+	if s.cls == nil {
+		return true
+	}
+
+	key := s.cls.Layout().SchedulerFireKey(s.superSpec.Name())
+	claimed := false
+	err := s.cls.STM(func(stm concurrency.STM) error {
+		claimed = false
+		last, _ := strconv.ParseInt(stm.Get(key), 10, 64)
+		if last >= fireTime.Unix() {
+			return nil
+		}
+		stm.Put(key, strconv.FormatInt(fireTime.Unix(), 10))
+		claimed = true
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("%s: claim fire at %v failed: %v", s.superSpec.Name(), fireTime, err)
+		return false
+	}
+	return claimed
+}
+
+func (s *Scheduler) newRequest() *httpprot.Request {
+	method, path, body := http.MethodGet, "/", ""
+	var headers map[string]string
+	if r := s.spec.Request; r != nil {
+		if r.Method != "" {
+			method = r.Method
+		}
+		if r.Path != "" {
+			path = r.Path
+		}
+		body, headers = r.Body, r.Headers
+	}
+
+	stdr, _ := http.NewRequest(method, "http://"+s.superSpec.Name()+path, strings.NewReader(body))
+	for k, v := range headers {
+		stdr.Header.Set(k, v)
+	}
+
+	// httpprot.NewRequest never returns an error.
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	return req
+}
+
+// fire calls the pipeline with the request built from the spec.
+func (s *Scheduler) fire(fireTime time.Time) {
+	var result string
+	statusCode := 0
+
+	handler, ok := s.muxMapper.GetHandler(s.spec.Pipeline)
+	if !ok {
+		logger.Errorf("%s: pipeline %s not found", s.superSpec.Name(), s.spec.Pipeline)
+		result = "pipeline not found"
+	} else {
+		ctx := context.New(tracing.NoopSpan)
+		FireTimeDataKey.Set(ctx, fireTime)
+		ctx.SetRequest(context.DefaultNamespace, s.newRequest())
+
+		result = handler.Handle(ctx)
+		if resp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response); ok {
+			statusCode = resp.StatusCode()
+		}
+		ctx.Finish()
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.status.Fired++
+	s.status.LastFireTime = fireTime.Format(time.RFC3339)
+	s.status.LastResult, s.status.LastStatusCode = result, statusCode
+	if result != "" || statusCode >= http.StatusBadRequest {
+		s.status.Failed++
+	}
+}
+
+// Status returns the status of Scheduler.
+func (s *Scheduler) Status() *supervisor.Status {
+	s.lock.Lock()
+	status := s.status
+	s.lock.Unlock()
+
+	return &supervisor.Status{ObjectStatus: &status}
+}
+
+// Close closes Scheduler.
+func (s *Scheduler) Close() {
+	close(s.done)
+	s.wg.Wait()
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scheduler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/context/contexttest"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+)
+
+func init() {
+	logger.InitNop()
+}
+
+type handlerFunc func(ctx *context.Context) string
+
+func (f handlerFunc) Handle(ctx *context.Context) string {
+	return f(ctx)
+}
+
+func newScheduler(t *testing.T, yamlConfig string, handlers map[string]context.Handler) *Scheduler {
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(t, err)
+
+	mapper := &contexttest.MockedMuxMapper{
+		MockedGetHandler: func(name string) (context.Handler, bool) {
+			h, ok := handlers[name]
+			return h, ok
+		},
+	}
+	return &Scheduler{
+		superSpec: superSpec,
+		spec:      superSpec.ObjectSpec().(*Spec),
+		muxMapper: mapper,
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Schedule: "*/5 * * * *", Pipeline: "pipeline"}
+	assert.NoError(spec.Validate())
+	spec.Schedule = "@every 10m"
+	assert.NoError(spec.Validate())
+	spec.Schedule = "CRON_TZ=Asia/Shanghai 0 3 * * *"
+	assert.NoError(spec.Validate())
+	spec.Schedule = "* * *"
+	assert.Error(spec.Validate())
+}
+
+func TestAlignedSchedule(t *testing.T) {
+	assert := assert.New(t)
+
+	sched, err := parseSchedule("@every 10m")
+	assert.NoError(err)
+
+	// members started at different times fire at the same times.
+	base := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	for _, d := range []time.Duration{0, time.Second, 3 * time.Minute, 9*time.Minute + 59*time.Second} {
+		assert.Equal(base.Add(10*time.Minute), sched.Next(base.Add(d)))
+	}
+	assert.Equal(base.Add(20*time.Minute), sched.Next(base.Add(10*time.Minute)))
+
+	sched, err = parseSchedule("0 3 * * *")
+	assert.NoError(err)
+	_, ok := sched.(alignedSchedule)
+	assert.False(ok)
+}
+
+func TestFire(t *testing.T) {
+	assert := assert.New(t)
+
+	var req *httpprot.Request
+	handlers := map[string]context.Handler{
+		"pipeline-report": handlerFunc(func(ctx *context.Context) string {
+			req = ctx.GetInputRequest().(*httpprot.Request)
+			resp, _ := httpprot.NewResponse(nil)
+			resp.SetStatusCode(http.StatusInternalServerError)
+			ctx.SetOutputResponse(resp)
+			return ""
+		}),
+	}
+
+	s := newScheduler(t, `
+name: report
+kind: Scheduler
+schedule: "@daily"
+pipeline: pipeline-report
+request:
+  method: POST
+  path: /report
+  headers:
+    X-Job: report
+  body: hello
+`, handlers)
+
+	now := time.Now()
+	s.fire(now)
+	assert.Equal(http.MethodPost, req.Method())
+	assert.Equal("/report", req.Path())
+	assert.Equal("report", req.HTTPHeader().Get("X-Job"))
+	assert.Equal("hello", string(req.RawPayload()))
+
+	status := s.Status().ObjectStatus.(*Status)
+	assert.Equal(uint64(1), status.Fired)
+	assert.Equal(uint64(1), status.Failed)
+	assert.Equal(http.StatusInternalServerError, status.LastStatusCode)
+	assert.Equal(now.Format(time.RFC3339), status.LastFireTime)
+
+	s.spec.Pipeline = "not-exist"
+	s.fire(now)
+	status = s.Status().ObjectStatus.(*Status)
+	assert.Equal(uint64(2), status.Failed)
+	assert.NotEmpty(status.LastResult)
+}
+
+func TestClaim(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newScheduler(t, `
+name: report
+kind: Scheduler
+schedule: "@hourly"
+pipeline: pipeline-report
+`, nil)
+
+	// no cluster, always claimed.
+	assert.True(s.claim(time.Now()))
+
+	store := map[string]string{}
+	cls := clustertest.NewMockedCluster()
+	cls.MockedLayout = func() *cluster.Layout { return &cluster.Layout{} }
+	cls.MockedSTM = func(apply func(concurrency.STM) error) error {
+		return apply(&clustertest.MockedSTM{
+			MockedGet: func(key ...string) string { return store[key[0]] },
+			MockedPut: func(key, val string, opts ...clientv3.OpOption) { store[key] = val },
+		})
+	}
+	s.cls = cls
+
+	fireTime := time.Now().Truncate(time.Hour)
+	assert.True(s.claim(fireTime))
+	// the fire is claimed by another member.
+	assert.False(s.claim(fireTime))
+	assert.True(s.claim(fireTime.Add(time.Hour)))
+}
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+
+	fired := make(chan struct{}, 10)
+	handlers := map[string]context.Handler{
+		"pipeline-tick": handlerFunc(func(ctx *context.Context) string {
+			fired <- struct{}{}
+			return ""
+		}),
+	}
+
+	superSpec, err := supervisor.NewSpec(`
+name: tick
+kind: Scheduler
+schedule: "@every 1s"
+pipeline: pipeline-tick
+`)
+	assert.NoError(err)
+
+	s := &Scheduler{}
+	s.Init(superSpec, &contexttest.MockedMuxMapper{
+		MockedGetHandler: func(name string) (context.Handler, bool) {
+			h, ok := handlers[name]
+			return h, ok
+		},
+	})
+
+	select {
+	case <-fired:
+	case <-time.After(3 * time.Second):
+		t.Fatal("scheduler not fired")
+	}
+	s.Close()
+	assert.NotEmpty(s.Status().ObjectStatus.(*Status).NextFireTime)
+}
@@ -0,0 +1,419 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package slo provides SLO to track the service level objectives of the
+// pipelines.
+package slo
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/pipeline"
+	"github.com/megaease/easegress/v2/pkg/object/trafficcontroller"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/prometheushelper"
+)
+
+const (
+	// Category is the category of SLO.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of SLO.
+	Kind = "SLO"
+
+	defaultWindow = 24 * time.Hour
+	minWindow     = time.Minute
+
+	// attachInterval is the interval to attach the SLO to the pipeline,
+	// so the SLO keeps working after the pipeline is recreated.
+	attachInterval = 5 * time.Second
+)
+
+var aliases = []string{
+	"slos",
+}
+
+func init() {
+	supervisor.Register(&SLO{})
+	api.RegisterObject(&api.APIResource{
+		Category: Category,
+		Kind:     Kind,
+		Name:     strings.ToLower(Kind),
+		Aliases:  aliases,
+	})
+}
+
+type (
+	// SLO tracks the availability and latency objectives of a pipeline in
+	// a rolling window, and computes the compliance and the remaining
+	// error budget of the member and the cluster.
+	SLO struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		window           *window
+		latencyThreshold time.Duration
+		metrics          *metrics
+
+		// mutex protects closed, so the observer is never attached after
+		// the SLO is closed.
+		mutex  sync.Mutex
+		closed bool
+		done   chan struct{}
+	}
+
+	// Spec describes SLO.
+	Spec struct {
+		Pipeline string `json:"pipeline" jsonschema:"required"`
+		// Namespace is the namespace of the pipeline, default is default.
+		Namespace string `json:"namespace,omitempty"`
+		// Window is the length of the rolling window, default is 24h.
+		Window string `json:"window,omitempty" jsonschema:"format=duration"`
+		// Availability is the target percentage of the successful requests,
+		// a request fails if the pipeline returns a non-empty result or
+		// the status code of the response is 5xx.
+		Availability float64      `json:"availability,omitempty" jsonschema:"minimum=0,maximum=100"`
+		Latency      *LatencySpec `json:"latency,omitempty"`
+	}
+
+	// LatencySpec is the latency objective.
+	LatencySpec struct {
+		// Threshold is the max duration of a request to be regarded as
+		// fast, and Target is the target percentage of the fast requests.
+		Threshold string  `json:"threshold" jsonschema:"required,format=duration"`
+		Target    float64 `json:"target" jsonschema:"required,minimum=0,maximum=100"`
+	}
+
+	// Status is the status of SLO.
+	Status struct {
+		Pipeline string `json:"pipeline"`
+		Window   string `json:"window"`
+		// Member is the indicators of the member, and Cluster is the
+		// indicators aggregated over all members.
+		Member  *Indicators `json:"member"`
+		Cluster *Indicators `json:"cluster"`
+	}
+
+	// Indicators are the compliance and the remaining error budget of the
+	// objectives, all in percent. The remaining error budget is negative
+	// if the budget is exhausted.
+	Indicators struct {
+		Counts
+		Availability                *float64 `json:"availability,omitempty"`
+		AvailabilityBudgetRemaining *float64 `json:"availabilityBudgetRemaining,omitempty"`
+		LatencyCompliance           *float64 `json:"latencyCompliance,omitempty"`
+		LatencyBudgetRemaining      *float64 `json:"latencyBudgetRemaining,omitempty"`
+	}
+
+	metrics struct {
+		Availability                *prometheus.GaugeVec
+		AvailabilityBudgetRemaining *prometheus.GaugeVec
+		LatencyCompliance           *prometheus.GaugeVec
+		LatencyBudgetRemaining      *prometheus.GaugeVec
+	}
+)
+
+// Validate validates the spec of SLO.
+func (spec *Spec) Validate() error {
+	if spec.Window != "" {
+		d, err := time.ParseDuration(spec.Window)
+		if err != nil {
+			return fmt.Errorf("invalid window %s: %v", spec.Window, err)
+		}
+		if d < minWindow {
+			return fmt.Errorf("window must not be less than %v", minWindow)
+		}
+	}
+
+	if spec.Availability == 0 && spec.Latency == nil {
+		return fmt.Errorf("neither availability nor latency is specified")
+	}
+	if spec.Availability >= 100 {
+		return fmt.Errorf("availability must be less than 100")
+	}
+	if spec.Latency != nil {
+		if d, err := time.ParseDuration(spec.Latency.Threshold); err != nil || d <= 0 {
+			return fmt.Errorf("invalid latency threshold %s", spec.Latency.Threshold)
+		}
+		if spec.Latency.Target <= 0 || spec.Latency.Target >= 100 {
+			return fmt.Errorf("latency target must be in (0, 100)")
+		}
+	}
+	return nil
+}
+
+func (spec *Spec) namespace() string {
+	if spec.Namespace == "" {
+		return cluster.NamespaceDefault
+	}
+	return spec.Namespace
+}
+
+func (spec *Spec) window() time.Duration {
+	if spec.Window == "" {
+		return defaultWindow
+	}
+	d, _ := time.ParseDuration(spec.Window)
+	return d
+}
+
+// Category returns the category of SLO.
+func (slo *SLO) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of SLO.
+func (slo *SLO) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of SLO.
+func (slo *SLO) DefaultSpec() interface{} {
+	return &Spec{
+		Window: defaultWindow.String(),
+	}
+}
+
+// Init initializes SLO.
+func (slo *SLO) Init(superSpec *supervisor.Spec) {
+	slo.superSpec = superSpec
+	slo.spec = superSpec.ObjectSpec().(*Spec)
+	slo.super = superSpec.Super()
+
+	slo.reload(nil)
+}
+
+// Inherit inherits previous generation of SLO, the events in the window
+// are kept if the pipeline, the window and the latency threshold are not
+// changed.
+func (slo *SLO) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	slo.superSpec = superSpec
+	slo.spec = superSpec.ObjectSpec().(*Spec)
+	slo.super = superSpec.Super()
+
+	prev := previousGeneration.(*SLO)
+	prev.Close()
+	slo.reload(prev)
+}
+
+func (slo *SLO) reload(prev *SLO) {
+	if slo.spec.Latency != nil {
+		slo.latencyThreshold, _ = time.ParseDuration(slo.spec.Latency.Threshold)
+	}
+
+	if prev != nil && prev.spec.Pipeline == slo.spec.Pipeline &&
+		prev.spec.namespace() == slo.spec.namespace() &&
+		prev.spec.window() == slo.spec.window() &&
+		prev.latencyThreshold == slo.latencyThreshold {
+		slo.window = prev.window
+	} else {
+		slo.window = newWindow(slo.spec.window())
+	}
+
+	slo.metrics = newMetrics(slo.super)
+	slo.done = make(chan struct{})
+	go slo.run()
+}
+
+func newMetrics(super *supervisor.Supervisor) *metrics {
+	opt := super.Options()
+	commonLabels := prometheus.Labels{
+		"clusterName":  opt.ClusterName,
+		"clusterRole":  opt.ClusterRole,
+		"instanceName": opt.Name,
+	}
+	labels := []string{"clusterName", "clusterRole", "instanceName", "slo", "pipeline"}
+
+	gauge := func(metric, help string) *prometheus.GaugeVec {
+		return prometheushelper.NewGauge(metric, help, labels).MustCurryWith(commonLabels)
+	}
+
+	return &metrics{
+		Availability:                gauge("slo_availability", "the percentage of the successful requests of the SLO in the window"),
+		AvailabilityBudgetRemaining: gauge("slo_availability_budget_remaining", "the percentage of the remaining availability error budget of the SLO"),
+		LatencyCompliance:           gauge("slo_latency_compliance", "the percentage of the requests within the latency threshold of the SLO in the window"),
+		LatencyBudgetRemaining:      gauge("slo_latency_budget_remaining", "the percentage of the remaining latency error budget of the SLO"),
+	}
+}
+
+func (slo *SLO) run() {
+	slo.attach()
+
+	ticker := time.NewTicker(attachInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-slo.done:
+			return
+		case <-ticker.C:
+			slo.attach()
+		}
+	}
+}
+
+func (slo *SLO) getPipeline() *pipeline.Pipeline {
+	entity, exists := slo.super.GetSystemController(trafficcontroller.Kind)
+	if !exists {
+		return nil
+	}
+	tc, ok := entity.Instance().(*trafficcontroller.TrafficController)
+	if !ok {
+		return nil
+	}
+
+	entity, exists = tc.GetPipeline(slo.spec.namespace(), slo.spec.Pipeline)
+	if !exists {
+		return nil
+	}
+	p, _ := entity.Instance().(*pipeline.Pipeline)
+	return p
+}
+
+// attach adds the observer to the pipeline, it replaces the observer of
+// the previous generation.
+func (slo *SLO) attach() {
+	slo.mutex.Lock()
+	defer slo.mutex.Unlock()
+
+	if slo.closed {
+		return
+	}
+	if p := slo.getPipeline(); p != nil {
+		p.AddTaskObserver(slo.observerKey(), slo.observe)
+	}
+}
+
+func (slo *SLO) observerKey() string {
+	return Kind + "/" + slo.superSpec.Name()
+}
+
+func (slo *SLO) observe(ctx *context.Context, result string, duration time.Duration) {
+	failed := result != ""
+	if resp, ok := ctx.GetResponse(context.DefaultNamespace).(*httpprot.Response); ok {
+		failed = failed || resp.StatusCode() >= http.StatusInternalServerError
+	}
+	slow := slo.latencyThreshold > 0 && duration > slo.latencyThreshold
+	slo.window.record(time.Now(), failed, slow)
+}
+
+// indicators computes the indicators of the counts.
+func (spec *Spec) indicators(c *Counts) *Indicators {
+	// compliance returns the percentage of the good events, and the
+	// percentage of the remaining error budget.
+	compliance := func(bad uint64, target float64) (*float64, *float64) {
+		good, remaining := 100.0, 100.0
+		if c.Total > 0 {
+			badRatio := float64(bad) / float64(c.Total)
+			good = (1 - badRatio) * 100
+			remaining = (1 - badRatio/(1-target/100)) * 100
+		}
+		return &good, &remaining
+	}
+
+	ind := &Indicators{Counts: *c}
+	if spec.Availability > 0 {
+		ind.Availability, ind.AvailabilityBudgetRemaining = compliance(c.Errors, spec.Availability)
+	}
+	if spec.Latency != nil {
+		ind.LatencyCompliance, ind.LatencyBudgetRemaining = compliance(c.Slow, spec.Latency.Target)
+	}
+	return ind
+}
+
+// clusterCounts sums the counts of the member and the counts of other
+// members in their synchronized statuses.
+func (slo *SLO) clusterCounts(member *Counts) *Counts {
+	c := &Counts{}
+	c.add(member)
+
+	cls := slo.super.Cluster()
+	prefix := cls.Layout().StatusObjectPrefix(cluster.NamespaceDefault, slo.superSpec.Name())
+	kvs, err := cls.GetPrefix(prefix)
+	if err != nil {
+		logger.Errorf("get statuses of SLO %s failed: %v", slo.superSpec.Name(), err)
+		return c
+	}
+
+	self := cls.Layout().StatusObjectKey(cluster.NamespaceDefault, slo.superSpec.Name())
+	for k, v := range kvs {
+		if k == self {
+			continue
+		}
+		status := &Status{}
+		if err := codectool.Unmarshal([]byte(v), status); err != nil || status.Member == nil {
+			continue
+		}
+		c.add(&status.Member.Counts)
+	}
+	return c
+}
+
+func (slo *SLO) exportPrometheusMetrics(ind *Indicators) {
+	labels := prometheus.Labels{
+		"slo":      slo.superSpec.Name(),
+		"pipeline": slo.spec.Pipeline,
+	}
+	set := func(gauge *prometheus.GaugeVec, v *float64) {
+		if v != nil {
+			gauge.With(labels).Set(*v)
+		}
+	}
+	set(slo.metrics.Availability, ind.Availability)
+	set(slo.metrics.AvailabilityBudgetRemaining, ind.AvailabilityBudgetRemaining)
+	set(slo.metrics.LatencyCompliance, ind.LatencyCompliance)
+	set(slo.metrics.LatencyBudgetRemaining, ind.LatencyBudgetRemaining)
+}
+
+// Status returns the status of SLO.
+func (slo *SLO) Status() *supervisor.Status {
+	member := slo.window.counts(time.Now())
+	status := &Status{
+		Pipeline: slo.spec.Pipeline,
+		Window:   slo.spec.window().String(),
+		Member:   slo.spec.indicators(member),
+		Cluster:  slo.spec.indicators(slo.clusterCounts(member)),
+	}
+	slo.exportPrometheusMetrics(status.Member)
+	return &supervisor.Status{ObjectStatus: status}
+}
+
+// Close closes SLO, the observer is removed from the pipeline before it
+// returns, so the next generation could attach its own observer.
+func (slo *SLO) Close() {
+	slo.mutex.Lock()
+	slo.closed = true
+	if p := slo.getPipeline(); p != nil {
+		p.RemoveTaskObserver(slo.observerKey())
+	}
+	slo.mutex.Unlock()
+
+	close(slo.done)
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package slo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{Pipeline: "p", Availability: 99.9}).Validate())
+	assert.NoError((&Spec{Pipeline: "p", Window: "1h", Latency: &LatencySpec{Threshold: "300ms", Target: 99}}).Validate())
+
+	assert.Error((&Spec{Pipeline: "p"}).Validate())
+	assert.Error((&Spec{Pipeline: "p", Availability: 100}).Validate())
+	assert.Error((&Spec{Pipeline: "p", Availability: 99, Window: "10s"}).Validate())
+	assert.Error((&Spec{Pipeline: "p", Latency: &LatencySpec{Threshold: "300ms"}}).Validate())
+	assert.Error((&Spec{Pipeline: "p", Latency: &LatencySpec{Threshold: "fast", Target: 99}}).Validate())
+}
+
+func TestWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	w := newWindow(time.Hour)
+	now := time.Unix(1700000000, 0)
+
+	w.record(now, false, false)
+	w.record(now, true, false)
+	w.record(now.Add(10*time.Minute), false, true)
+	assert.Equal(&Counts{Total: 3, Errors: 1, Slow: 1}, w.counts(now.Add(10*time.Minute)))
+
+	// the events out of the window are dropped.
+	assert.Equal(&Counts{Total: 1, Slow: 1}, w.counts(now.Add(65*time.Minute)))
+	assert.Equal(&Counts{}, w.counts(now.Add(2*time.Hour)))
+
+	// a slot is reset when it is reused.
+	w.record(now.Add(time.Hour), false, false)
+	assert.Equal(&Counts{Total: 2, Slow: 1}, w.counts(now.Add(time.Hour)))
+}
+
+func TestIndicators(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Availability: 99, Latency: &LatencySpec{Threshold: "100ms", Target: 90}}
+
+	ind := spec.indicators(&Counts{})
+	assert.Equal(100.0, *ind.Availability)
+	assert.Equal(100.0, *ind.AvailabilityBudgetRemaining)
+
+	ind = spec.indicators(&Counts{Total: 1000, Errors: 5, Slow: 200})
+	assert.InDelta(99.5, *ind.Availability, 1e-9)
+	assert.InDelta(50.0, *ind.AvailabilityBudgetRemaining, 1e-9)
+	assert.InDelta(80.0, *ind.LatencyCompliance, 1e-9)
+	assert.InDelta(-100.0, *ind.LatencyBudgetRemaining, 1e-9)
+
+	ind = (&Spec{Availability: 99}).indicators(&Counts{Total: 10})
+	assert.Nil(ind.LatencyCompliance)
+	assert.Nil(ind.LatencyBudgetRemaining)
+}
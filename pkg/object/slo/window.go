@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package slo
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// windowSlots is the number of the slots of a rolling window, the oldest
+// slot is dropped as a whole when the window rolls.
+const windowSlots = 60
+
+type (
+	// window counts the events of an SLO in a rolling window.
+	window struct {
+		slotDuration int64
+		mutex        sync.Mutex
+		slots        [windowSlots]slot
+	}
+
+	slot struct {
+		// epoch is the index of the slot since the unix epoch.
+		epoch  int64
+		total  uint64
+		errors uint64
+		slow   uint64
+	}
+
+	// Counts are the numbers of the events in the window.
+	Counts struct {
+		Total  uint64 `json:"total"`
+		Errors uint64 `json:"errors"`
+		Slow   uint64 `json:"slow"`
+	}
+)
+
+func newWindow(d time.Duration) *window {
+	slotDuration := int64(d) / windowSlots
+	if slotDuration <= 0 {
+		slotDuration = 1
+	}
+	return &window{slotDuration: slotDuration}
+}
+
+// record records an event, which is an error if failed is true, and slow
+// if slow is true.
+func (w *window) record(now time.Time, failed, slow bool) {
+	epoch := now.UnixNano() / w.slotDuration
+	s := &w.slots[epoch%windowSlots]
+
+	if atomic.LoadInt64(&s.epoch) != epoch {
+		w.mutex.Lock()
+		if atomic.LoadInt64(&s.epoch) != epoch {
+			atomic.StoreUint64(&s.total, 0)
+			atomic.StoreUint64(&s.errors, 0)
+			atomic.StoreUint64(&s.slow, 0)
+			atomic.StoreInt64(&s.epoch, epoch)
+		}
+		w.mutex.Unlock()
+	}
+
+	atomic.AddUint64(&s.total, 1)
+	if failed {
+		atomic.AddUint64(&s.errors, 1)
+	}
+	if slow {
+		atomic.AddUint64(&s.slow, 1)
+	}
+}
+
+// counts returns the numbers of the events in the window.
+func (w *window) counts(now time.Time) *Counts {
+	epoch := now.UnixNano() / w.slotDuration
+
+	c := &Counts{}
+	for i := range w.slots {
+		s := &w.slots[i]
+		if e := atomic.LoadInt64(&s.epoch); e <= epoch-windowSlots || e > epoch {
+			continue
+		}
+		c.Total += atomic.LoadUint64(&s.total)
+		c.Errors += atomic.LoadUint64(&s.errors)
+		c.Slow += atomic.LoadUint64(&s.slow)
+	}
+	return c
+}
+
+func (c *Counts) add(other *Counts) {
+	c.Total += other.Total
+	c.Errors += other.Errors
+	c.Slow += other.Slow
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package statussynccontroller
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/v2/pkg/option"
+	"github.com/megaease/easegress/v2/pkg/util/easemonitor"
+	"github.com/megaease/easegress/v2/pkg/util/maxprocs"
+	"github.com/megaease/easegress/v2/pkg/util/prometheushelper"
+)
+
+type (
+	// Status is the status of StatusSyncController, which carries the
+	// indicators of the process, so they are synchronized to the cluster
+	// for every member like the statuses of other objects.
+	Status struct {
+		Process *ProcessStatus `json:"process"`
+	}
+
+	// ProcessStatus contains the indicators of the Go runtime and the
+	// process of the member.
+	ProcessStatus struct {
+		Goroutines  int    `json:"goroutines"`
+		HeapAlloc   uint64 `json:"heapAlloc"`
+		HeapInuse   uint64 `json:"heapInuse"`
+		HeapSys     uint64 `json:"heapSys"`
+		HeapObjects uint64 `json:"heapObjects"`
+		NumGC       uint32 `json:"numGC"`
+		// GCPauseTotal and LastGCPause are in milliseconds.
+		GCPauseTotal float64 `json:"gcPauseTotal"`
+		LastGCPause  float64 `json:"lastGCPause"`
+		// OpenFDs is 0 if it is not supported by the platform.
+		OpenFDs int `json:"openFDs"`
+		// CPUSeconds is the user and system CPU time of the process, and
+		// CPUPercent is the CPU usage since the last collection.
+		CPUSeconds float64 `json:"cpuSeconds"`
+		CPUPercent float64 `json:"cpuPercent"`
+		// GOMAXPROCS is the effective parallelism, and CPUQuota is the
+		// number of CPUs allowed by the CPU quota of the container, it is
+		// 0 if there is no quota.
+		GOMAXPROCS int     `json:"gomaxprocs"`
+		CPUQuota   float64 `json:"cpuQuota"`
+		// Uptime is in seconds.
+		Uptime int64 `json:"uptime"`
+	}
+
+	processCollector struct {
+		mutex       sync.Mutex
+		startTime   time.Time
+		lastTime    time.Time
+		lastCPUTime float64
+
+		metrics *processMetrics
+	}
+
+	processMetrics struct {
+		Goroutines   prometheus.Gauge
+		HeapAlloc    prometheus.Gauge
+		HeapInuse    prometheus.Gauge
+		HeapObjects  prometheus.Gauge
+		GCPauseTotal prometheus.Gauge
+		LastGCPause  prometheus.Gauge
+		OpenFDs      prometheus.Gauge
+		CPUSeconds   prometheus.Gauge
+		CPUPercent   prometheus.Gauge
+		GOMAXPROCS   prometheus.Gauge
+		CPUQuota     prometheus.Gauge
+	}
+)
+
+var _ easemonitor.Metricer = (*Status)(nil)
+
+// processStartTime is the approximate start time of the process.
+var processStartTime = time.Now()
+
+func newProcessCollector(opt *option.Options) *processCollector {
+	return &processCollector{
+		startTime: processStartTime,
+		metrics:   newProcessMetrics(opt),
+	}
+}
+
+func newProcessMetrics(opt *option.Options) *processMetrics {
+	commonLabels := prometheus.Labels{
+		"clusterName":  opt.ClusterName,
+		"clusterRole":  opt.ClusterRole,
+		"instanceName": opt.Name,
+	}
+	labels := []string{"clusterName", "clusterRole", "instanceName"}
+
+	gauge := func(metric, help string) prometheus.Gauge {
+		return prometheushelper.NewGauge(metric, help, labels).With(commonLabels)
+	}
+
+	return &processMetrics{
+		Goroutines:   gauge("member_goroutines", "the number of goroutines of the member"),
+		HeapAlloc:    gauge("member_heap_alloc_bytes", "the bytes of allocated heap objects of the member"),
+		HeapInuse:    gauge("member_heap_inuse_bytes", "the bytes of in-use heap spans of the member"),
+		HeapObjects:  gauge("member_heap_objects", "the number of allocated heap objects of the member"),
+		GCPauseTotal: gauge("member_gc_pause_total_seconds", "the total GC pause time of the member"),
+		LastGCPause:  gauge("member_last_gc_pause_seconds", "the pause time of the last GC of the member"),
+		OpenFDs:      gauge("member_open_fds", "the number of open file descriptors of the member"),
+		CPUSeconds:   gauge("member_cpu_seconds", "the user and system CPU time of the member"),
+		CPUPercent:   gauge("member_cpu_percent", "the CPU usage of the member since the last collection"),
+		GOMAXPROCS:   gauge("member_gomaxprocs", "the max number of CPUs executing Go code simultaneously of the member"),
+		CPUQuota:     gauge("member_cpu_quota", "the number of CPUs allowed by the CPU quota of the member, 0 if there is no quota"),
+	}
+}
+
+// collect collects the indicators of the process, and exports them to
+// Prometheus.
+func (pc *processCollector) collect() *ProcessStatus {
+	ms := &runtime.MemStats{}
+	runtime.ReadMemStats(ms)
+	parallelism := maxprocs.CurrentStatus()
+
+	now := time.Now()
+	cpuTime := processCPUTime()
+
+	pc.mutex.Lock()
+	cpuPercent := 0.0
+	if !pc.lastTime.IsZero() {
+		if elapsed := now.Sub(pc.lastTime).Seconds(); elapsed > 0 {
+			cpuPercent = (cpuTime - pc.lastCPUTime) / elapsed * 100
+		}
+	}
+	pc.lastTime, pc.lastCPUTime = now, cpuTime
+	pc.mutex.Unlock()
+
+	status := &ProcessStatus{
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    ms.HeapAlloc,
+		HeapInuse:    ms.HeapInuse,
+		HeapSys:      ms.HeapSys,
+		HeapObjects:  ms.HeapObjects,
+		NumGC:        ms.NumGC,
+		GCPauseTotal: float64(ms.PauseTotalNs) / float64(time.Millisecond),
+		OpenFDs:      processOpenFDs(),
+		CPUSeconds:   cpuTime,
+		CPUPercent:   cpuPercent,
+		GOMAXPROCS:   parallelism.GOMAXPROCS,
+		CPUQuota:     parallelism.CPUQuota,
+		Uptime:       int64(now.Sub(pc.startTime).Seconds()),
+	}
+	if ms.NumGC > 0 {
+		status.LastGCPause = float64(ms.PauseNs[(ms.NumGC+255)%256]) / float64(time.Millisecond)
+	}
+
+	pc.exportPrometheusMetrics(status)
+
+	return status
+}
+
+func (pc *processCollector) exportPrometheusMetrics(status *ProcessStatus) {
+	m := pc.metrics
+	m.Goroutines.Set(float64(status.Goroutines))
+	m.HeapAlloc.Set(float64(status.HeapAlloc))
+	m.HeapInuse.Set(float64(status.HeapInuse))
+	m.HeapObjects.Set(float64(status.HeapObjects))
+	m.GCPauseTotal.Set(status.GCPauseTotal / 1000)
+	m.LastGCPause.Set(status.LastGCPause / 1000)
+	m.OpenFDs.Set(float64(status.OpenFDs))
+	m.CPUSeconds.Set(status.CPUSeconds)
+	m.CPUPercent.Set(status.CPUPercent)
+	m.GOMAXPROCS.Set(float64(status.GOMAXPROCS))
+	m.CPUQuota.Set(status.CPUQuota)
+}
+
+// ToMetrics implements easemonitor.Metricer.
+func (s *Status) ToMetrics(service string) []*easemonitor.Metrics {
+	if s.Process == nil {
+		return nil
+	}
+
+	return []*easemonitor.Metrics{
+		{
+			CommonFields: easemonitor.CommonFields{
+				Service: service,
+				Type:    "eg-process",
+			},
+			OtherFields: s.Process,
+		},
+	}
+}
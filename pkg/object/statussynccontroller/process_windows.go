@@ -0,0 +1,47 @@
+//go:build windows
+// +build windows
+
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package statussynccontroller
+
+import "syscall"
+
+// processCPUTime returns the user and system CPU time of the process in
+// seconds.
+func processCPUTime() float64 {
+	var creation, exit, kernel, user syscall.Filetime
+	h, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0
+	}
+	if err = syscall.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		return 0
+	}
+	// the Filetime of durations is in 100-nanosecond intervals.
+	ticks := func(ft syscall.Filetime) int64 {
+		return int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime)
+	}
+	return float64(ticks(kernel)+ticks(user)) * 100 / 1e9
+}
+
+// processOpenFDs returns 0 since the open file descriptors are not
+// supported on Windows.
+func processOpenFDs() int {
+	return 0
+}
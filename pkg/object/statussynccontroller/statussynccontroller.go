@@ -60,6 +60,8 @@ type (
 		// statusUpdateMaxBatchSize is maximum statuses to update in one cluster transaction
 		statusUpdateMaxBatchSize int
 
+		process *processCollector
+
 		done chan struct{}
 	}
 
@@ -171,6 +173,8 @@ func (ssc *StatusSyncController) reload() {
 	}
 	logger.Infof("StatusUpdateMaxBatchSize is %d", ssc.statusUpdateMaxBatchSize)
 
+	ssc.process = newProcessCollector(opts)
+
 	go ssc.run()
 }
 
@@ -185,10 +189,11 @@ func (ssc *StatusSyncController) run() {
 	}
 }
 
-// Status returns the status of StatusSyncController.
+// Status returns the status of StatusSyncController, which contains the
+// indicators of the process.
 func (ssc *StatusSyncController) Status() *supervisor.Status {
 	return &supervisor.Status{
-		ObjectStatus: struct{}{},
+		ObjectStatus: &Status{Process: ssc.process.collect()},
 	}
 }
 
@@ -0,0 +1,213 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tenantmanager
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	librl "github.com/megaease/easegress/v2/pkg/util/ratelimiter"
+)
+
+type (
+	// Counts are the numbers of requests of a tenant by the result of
+	// admission.
+	Counts struct {
+		Requests      uint64 `json:"requests"`
+		Admitted      uint64 `json:"admitted"`
+		RateLimited   uint64 `json:"rateLimited"`
+		QuotaExceeded uint64 `json:"quotaExceeded"`
+	}
+
+	// dayCounts are the counts in a day of UTC.
+	dayCounts struct {
+		day           string
+		requests      atomic.Uint64
+		admitted      atomic.Uint64
+		rateLimited   atomic.Uint64
+		quotaExceeded atomic.Uint64
+	}
+
+	// dayCounter switches to new counts when the day changes.
+	dayCounter struct {
+		current atomic.Pointer[dayCounts]
+	}
+
+	// dayTotal is the number of admitted requests in a day.
+	dayTotal struct {
+		day      string
+		admitted uint64
+	}
+
+	tenant struct {
+		spec    *TenantSpec
+		rl      *librl.RateLimiter
+		counter dayCounter
+		// others is the admitted requests of today on other members.
+		others   atomic.Pointer[dayTotal]
+		requests map[string]prometheus.Counter
+	}
+)
+
+func (c *Counts) add(other *Counts) {
+	c.Requests += other.Requests
+	c.Admitted += other.Admitted
+	c.RateLimited += other.RateLimited
+	c.QuotaExceeded += other.QuotaExceeded
+}
+
+// dayOf returns the day of UTC of t.
+func dayOf(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// nextDay returns the duration from t to the next day of UTC.
+func nextDay(t time.Time) time.Duration {
+	t = t.UTC()
+	y, m, d := t.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, time.UTC).Sub(t)
+}
+
+func (dc *dayCounts) add(c *Counts) {
+	dc.requests.Add(c.Requests)
+	dc.admitted.Add(c.Admitted)
+	dc.rateLimited.Add(c.RateLimited)
+	dc.quotaExceeded.Add(c.QuotaExceeded)
+}
+
+func (dc *dayCounts) counts() *Counts {
+	return &Counts{
+		Requests:      dc.requests.Load(),
+		Admitted:      dc.admitted.Load(),
+		RateLimited:   dc.rateLimited.Load(),
+		QuotaExceeded: dc.quotaExceeded.Load(),
+	}
+}
+
+// today returns the counts of the day of now.
+func (c *dayCounter) today(now time.Time) *dayCounts {
+	day := dayOf(now)
+	for {
+		dc := c.current.Load()
+		if dc != nil && dc.day >= day {
+			return dc
+		}
+		next := &dayCounts{day: day}
+		if c.current.CompareAndSwap(dc, next) {
+			return next
+		}
+	}
+}
+
+func (c *dayCounter) inherit(prev *dayCounter) {
+	c.current.Store(prev.current.Load())
+}
+
+func newTenant(spec *TenantSpec) *tenant {
+	t := &tenant{spec: spec}
+	if spec.RateLimit != nil {
+		// the timeout is 0, so the requests over the limit are rejected
+		// at once instead of waiting.
+		t.rl = librl.New(librl.NewPolicy(0, spec.RateLimit.refreshPeriod(), spec.RateLimit.LimitForPeriod))
+	}
+	return t
+}
+
+// othersAdmitted returns the admitted requests of the day on other members.
+func (t *tenant) othersAdmitted(day string) uint64 {
+	if total := t.others.Load(); total != nil && total.day == day {
+		return total.admitted
+	}
+	return 0
+}
+
+func (t *tenant) admit(now time.Time) *Admission {
+	dc := t.counter.today(now)
+	dc.requests.Add(1)
+
+	a := &Admission{Tenant: t.spec.Name, QuotaRemaining: -1}
+
+	var used uint64
+	if t.spec.DailyQuota > 0 {
+		used = dc.admitted.Load() + t.othersAdmitted(dc.day)
+		if used >= uint64(t.spec.DailyQuota) {
+			dc.quotaExceeded.Add(1)
+			t.requests[ResultQuotaExceeded].Inc()
+			a.Result = ResultQuotaExceeded
+			a.QuotaRemaining = 0
+			a.RetryAfter = nextDay(now)
+			return a
+		}
+	}
+
+	if t.rl != nil {
+		if permitted, _ := t.rl.AcquirePermission(); !permitted {
+			dc.rateLimited.Add(1)
+			t.requests[ResultRateLimited].Inc()
+			a.Result = ResultRateLimited
+			a.RetryAfter = t.spec.RateLimit.refreshPeriod()
+			if t.spec.DailyQuota > 0 {
+				a.QuotaRemaining = t.spec.DailyQuota - int64(used)
+			}
+			return a
+		}
+	}
+
+	dc.admitted.Add(1)
+	t.requests["admitted"].Inc()
+	if t.spec.DailyQuota > 0 {
+		a.QuotaRemaining = t.spec.DailyQuota - int64(used) - 1
+	}
+	return a
+}
+
+// consumer returns the consumer of the request, it is the API key, or the
+// claim of the bearer token if there is no API key.
+func (spec *Spec) consumer(req *httpprot.Request) string {
+	if key := req.HTTPHeader().Get(spec.apiKeyHeader()); key != "" {
+		return key
+	}
+	if spec.JWTClaim == "" {
+		return ""
+	}
+
+	auth := req.HTTPHeader().Get("Authorization")
+	const prefix = "Bearer "
+	if len(auth) <= len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return ""
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(auth[len(prefix):], claims); err != nil {
+		return ""
+	}
+	switch v := claims[spec.JWTClaim].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,531 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tenantmanager provides TenantManager to map the consumers to the
+// tenants and enforce the limits of the tenants.
+package tenantmanager
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/prometheushelper"
+)
+
+const (
+	// Category is the category of TenantManager.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of TenantManager.
+	Kind = "TenantManager"
+
+	// ResultUnknownConsumer is the result of the requests whose consumer
+	// is not mapped to any tenant.
+	ResultUnknownConsumer = "unknownConsumer"
+	// ResultRateLimited is the result of the requests rejected by the rate
+	// limit of the tenant.
+	ResultRateLimited = "rateLimited"
+	// ResultQuotaExceeded is the result of the requests rejected because
+	// the daily quota of the tenant is used up.
+	ResultQuotaExceeded = "quotaExceeded"
+
+	defaultAPIKeyHeader       = "X-API-Key"
+	defaultLimitRefreshPeriod = time.Second
+
+	// syncInterval is the interval to read the usage of the tenants on
+	// other members from their synchronized statuses.
+	syncInterval = 5 * time.Second
+)
+
+var aliases = []string{
+	"tenantmanagers",
+	"tenants",
+}
+
+var (
+	// ConsumerDataKey is the key of the task data where the consumer of
+	// the request is stored.
+	ConsumerDataKey = context.NewDataKey[string](Kind, "consumer")
+	// TenantDataKey is the key of the task data where the tenant of the
+	// request is stored.
+	TenantDataKey = context.NewDataKey[string](Kind, "tenant")
+)
+
+// ConsumerOf returns the consumer of the request for the filters limiting
+// or routing by consumers. It is the consumer identified by a TenantLimiter
+// before the filter, or the value of the header if it is not empty. It
+// returns an empty string if the consumer is not identified, the filters
+// regard such requests as from the anonymous consumer.
+func ConsumerOf(ctx *context.Context, req *httpprot.Request, header string) string {
+	if name, ok := ConsumerDataKey.Get(ctx); ok && name != "" {
+		return name
+	}
+	if header != "" {
+		return req.HTTPHeader().Get(header)
+	}
+	return ""
+}
+
+func init() {
+	supervisor.Register(&TenantManager{})
+	api.RegisterObject(&api.APIResource{
+		Category: Category,
+		Kind:     Kind,
+		Name:     strings.ToLower(Kind),
+		Aliases:  aliases,
+	})
+}
+
+type (
+	// TenantManager maps the consumers, identified by API keys or a claim
+	// of JWT, to the tenants, and enforces the rate limits and the daily
+	// quotas of the tenants. The usage of the tenants is aggregated over
+	// all members.
+	TenantManager struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		tenants   []*tenant
+		consumers map[string]*tenant
+		unknown   dayCounter
+		metrics   *metrics
+		// unknownRequests counts the requests of unknown consumers.
+		unknownRequests prometheus.Counter
+
+		// mutex protects others and othersDay, others are the counts of
+		// the tenants on other members in othersDay.
+		mutex     sync.Mutex
+		others    map[string]*Counts
+		othersDay string
+
+		done chan struct{}
+	}
+
+	// Spec describes TenantManager.
+	Spec struct {
+		// APIKeyHeader is the header of the API key, default is X-API-Key.
+		APIKeyHeader string `json:"apiKeyHeader,omitempty"`
+		// JWTClaim is the claim of the bearer token identifying the
+		// consumer, it is used when there is no API key. The token is not
+		// verified by TenantManager, please verify it with a Validator
+		// filter in front.
+		JWTClaim string        `json:"jwtClaim,omitempty"`
+		Tenants  []*TenantSpec `json:"tenants" jsonschema:"required"`
+	}
+
+	// TenantSpec describes a tenant.
+	TenantSpec struct {
+		Name string `json:"name" jsonschema:"required"`
+		// Consumers are the API keys or the claim values of the consumers
+		// belonging to the tenant.
+		Consumers []string       `json:"consumers" jsonschema:"required"`
+		RateLimit *RateLimitSpec `json:"rateLimit,omitempty"`
+		// DailyQuota is the max number of requests of the tenant in a day
+		// of UTC over all members, 0 means no limit.
+		DailyQuota int64 `json:"dailyQuota,omitempty" jsonschema:"minimum=0"`
+	}
+
+	// RateLimitSpec is the rate limit of a tenant on every member.
+	RateLimitSpec struct {
+		LimitForPeriod int `json:"limitForPeriod" jsonschema:"required,minimum=1"`
+		// LimitRefreshPeriod is the period to refresh the limit, default
+		// is 1s.
+		LimitRefreshPeriod string `json:"limitRefreshPeriod,omitempty" jsonschema:"format=duration"`
+	}
+
+	// Status is the status of TenantManager.
+	Status struct {
+		// Day is the day of UTC the counts belong to.
+		Day string `json:"day"`
+		// UnknownConsumers is the number of requests whose consumer is
+		// not mapped to any tenant on the member.
+		UnknownConsumers uint64 `json:"unknownConsumers"`
+		// Member is the counts of the tenants on the member, and Cluster
+		// is the indicators aggregated over all members.
+		Member  map[string]*Counts     `json:"member"`
+		Cluster map[string]*Indicators `json:"cluster"`
+	}
+
+	// Indicators are the counts and the quota usage of a tenant.
+	Indicators struct {
+		Counts
+		DailyQuota int64 `json:"dailyQuota,omitempty"`
+		// QuotaRemaining is the remaining daily quota, it is omitted if
+		// the tenant has no quota.
+		QuotaRemaining *int64 `json:"quotaRemaining,omitempty"`
+	}
+
+	// Admission is the result of admitting a request.
+	Admission struct {
+		Consumer string
+		Tenant   string
+		// Result is empty if the request is admitted, otherwise it is one
+		// of ResultUnknownConsumer, ResultRateLimited and
+		// ResultQuotaExceeded.
+		Result string
+		// QuotaRemaining is the remaining daily quota of the tenant, it is
+		// -1 if the tenant has no quota.
+		QuotaRemaining int64
+		// RetryAfter is the duration to the next day if the quota is
+		// exceeded, or the refresh period of the rate limit.
+		RetryAfter time.Duration
+	}
+
+	metrics struct {
+		Requests *prometheus.CounterVec
+	}
+)
+
+// Validate validates the spec of TenantManager.
+func (spec *Spec) Validate() error {
+	if len(spec.Tenants) == 0 {
+		return fmt.Errorf("no tenant is defined")
+	}
+
+	names := map[string]bool{}
+	consumers := map[string]string{}
+	for _, t := range spec.Tenants {
+		if t.Name == "" {
+			return fmt.Errorf("empty tenant name")
+		}
+		if names[t.Name] {
+			return fmt.Errorf("duplicated tenant %s", t.Name)
+		}
+		names[t.Name] = true
+
+		if len(t.Consumers) == 0 {
+			return fmt.Errorf("tenant %s has no consumer", t.Name)
+		}
+		for _, c := range t.Consumers {
+			if c == "" {
+				return fmt.Errorf("tenant %s has an empty consumer", t.Name)
+			}
+			if other, ok := consumers[c]; ok {
+				return fmt.Errorf("consumer %s belongs to both tenant %s and %s", c, other, t.Name)
+			}
+			consumers[c] = t.Name
+		}
+
+		if rl := t.RateLimit; rl != nil && rl.LimitRefreshPeriod != "" {
+			if d, err := time.ParseDuration(rl.LimitRefreshPeriod); err != nil || d <= 0 {
+				return fmt.Errorf("tenant %s: invalid limitRefreshPeriod %s", t.Name, rl.LimitRefreshPeriod)
+			}
+		}
+	}
+	return nil
+}
+
+func (spec *Spec) apiKeyHeader() string {
+	if spec.APIKeyHeader == "" {
+		return defaultAPIKeyHeader
+	}
+	return spec.APIKeyHeader
+}
+
+func (spec *RateLimitSpec) refreshPeriod() time.Duration {
+	if spec.LimitRefreshPeriod == "" {
+		return defaultLimitRefreshPeriod
+	}
+	d, _ := time.ParseDuration(spec.LimitRefreshPeriod)
+	return d
+}
+
+// Category returns the category of TenantManager.
+func (tm *TenantManager) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of TenantManager.
+func (tm *TenantManager) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of TenantManager.
+func (tm *TenantManager) DefaultSpec() interface{} {
+	return &Spec{
+		APIKeyHeader: defaultAPIKeyHeader,
+	}
+}
+
+// Init initializes TenantManager.
+func (tm *TenantManager) Init(superSpec *supervisor.Spec) {
+	tm.superSpec = superSpec
+	tm.spec = superSpec.ObjectSpec().(*Spec)
+	tm.super = superSpec.Super()
+
+	tm.reload(nil)
+}
+
+// Inherit inherits previous generation of TenantManager, the counts of
+// the tenants are kept, and so are the rate limiters whose limits are not
+// changed.
+func (tm *TenantManager) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	tm.superSpec = superSpec
+	tm.spec = superSpec.ObjectSpec().(*Spec)
+	tm.super = superSpec.Super()
+
+	prev := previousGeneration.(*TenantManager)
+	prev.Close()
+	tm.reload(prev)
+}
+
+func (tm *TenantManager) reload(prev *TenantManager) {
+	tm.metrics = newMetrics(tm.super)
+	tm.unknownRequests = tm.requestsCounter("")[ResultUnknownConsumer]
+	tm.buildTenants(prev)
+
+	if prev != nil {
+		tm.unknown.inherit(&prev.unknown)
+		tm.others, tm.othersDay = prev.others, prev.othersDay
+	} else {
+		tm.restore()
+	}
+
+	tm.done = make(chan struct{})
+	go tm.run()
+}
+
+// buildTenants creates the tenants and the map of the consumers.
+func (tm *TenantManager) buildTenants(prev *TenantManager) {
+	prevTenants := map[string]*tenant{}
+	if prev != nil {
+		for _, t := range prev.tenants {
+			prevTenants[t.spec.Name] = t
+		}
+	}
+
+	tm.tenants = make([]*tenant, 0, len(tm.spec.Tenants))
+	tm.consumers = map[string]*tenant{}
+	for _, spec := range tm.spec.Tenants {
+		t := newTenant(spec)
+		if p := prevTenants[spec.Name]; p != nil {
+			t.counter.inherit(&p.counter)
+			t.others.Store(p.others.Load())
+			if reflect.DeepEqual(spec.RateLimit, p.spec.RateLimit) {
+				t.rl = p.rl
+			}
+		}
+		t.requests = tm.requestsCounter(spec.Name)
+		tm.tenants = append(tm.tenants, t)
+		for _, c := range spec.Consumers {
+			tm.consumers[c] = t
+		}
+	}
+}
+
+// restore restores the counts of today from the status synchronized
+// before the restart of the member.
+func (tm *TenantManager) restore() {
+	cls := tm.super.Cluster()
+	value, err := cls.Get(cls.Layout().StatusObjectKey(cluster.NamespaceDefault, tm.superSpec.Name()))
+	if err != nil || value == nil {
+		return
+	}
+
+	status := &Status{}
+	if err := codectool.Unmarshal([]byte(*value), status); err != nil {
+		return
+	}
+
+	now := time.Now()
+	if status.Day != dayOf(now) {
+		return
+	}
+	tm.unknown.today(now).requests.Add(status.UnknownConsumers)
+	for _, t := range tm.tenants {
+		if c := status.Member[t.spec.Name]; c != nil {
+			t.counter.today(now).add(c)
+		}
+	}
+}
+
+func newMetrics(super *supervisor.Supervisor) *metrics {
+	opt := super.Options()
+	commonLabels := prometheus.Labels{
+		"clusterName":  opt.ClusterName,
+		"clusterRole":  opt.ClusterRole,
+		"instanceName": opt.Name,
+	}
+	labels := []string{"clusterName", "clusterRole", "instanceName", "tenantManager", "tenant", "result"}
+
+	return &metrics{
+		Requests: prometheushelper.NewCounter("tenant_requests_total",
+			"the number of requests of the tenants by the result of admission", labels).MustCurryWith(commonLabels),
+	}
+}
+
+// requestsCounter returns the counters of the requests of the tenant by
+// the result of admission, the admitted requests have result "admitted".
+func (tm *TenantManager) requestsCounter(tenant string) map[string]prometheus.Counter {
+	counters := map[string]prometheus.Counter{}
+	for _, result := range []string{"admitted", ResultRateLimited, ResultQuotaExceeded, ResultUnknownConsumer} {
+		counters[result] = tm.metrics.Requests.With(prometheus.Labels{
+			"tenantManager": tm.superSpec.Name(),
+			"tenant":        tenant,
+			"result":        result,
+		})
+	}
+	return counters
+}
+
+func (tm *TenantManager) run() {
+	tm.syncOthers()
+
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tm.done:
+			return
+		case <-ticker.C:
+			tm.syncOthers()
+		}
+	}
+}
+
+// syncOthers sums the counts of today of the tenants on other members in
+// their synchronized statuses.
+func (tm *TenantManager) syncOthers() {
+	cls := tm.super.Cluster()
+	prefix := cls.Layout().StatusObjectPrefix(cluster.NamespaceDefault, tm.superSpec.Name())
+	kvs, err := cls.GetPrefix(prefix)
+	if err != nil {
+		logger.Errorf("get statuses of TenantManager %s failed: %v", tm.superSpec.Name(), err)
+		return
+	}
+
+	day := dayOf(time.Now())
+	self := cls.Layout().StatusObjectKey(cluster.NamespaceDefault, tm.superSpec.Name())
+	others := map[string]*Counts{}
+	for k, v := range kvs {
+		if k == self {
+			continue
+		}
+		status := &Status{}
+		if err := codectool.Unmarshal([]byte(v), status); err != nil || status.Day != day {
+			continue
+		}
+		for name, c := range status.Member {
+			if others[name] == nil {
+				others[name] = &Counts{}
+			}
+			others[name].add(c)
+		}
+	}
+
+	for _, t := range tm.tenants {
+		admitted := uint64(0)
+		if c := others[t.spec.Name]; c != nil {
+			admitted = c.Admitted
+		}
+		t.others.Store(&dayTotal{day: day, admitted: admitted})
+	}
+
+	tm.mutex.Lock()
+	tm.others, tm.othersDay = others, day
+	tm.mutex.Unlock()
+}
+
+// Tenant returns the tenant of the consumer.
+func (tm *TenantManager) Tenant(consumer string) (string, bool) {
+	t, ok := tm.consumers[consumer]
+	if !ok {
+		return "", false
+	}
+	return t.spec.Name, true
+}
+
+// Admit identifies the consumer of the request, and checks the limits of
+// its tenant.
+func (tm *TenantManager) Admit(req *httpprot.Request) *Admission {
+	now := time.Now()
+	consumer := tm.spec.consumer(req)
+
+	t, ok := tm.consumers[consumer]
+	if !ok {
+		tm.unknown.today(now).requests.Add(1)
+		tm.unknownRequests.Inc()
+		return &Admission{
+			Consumer:       consumer,
+			Result:         ResultUnknownConsumer,
+			QuotaRemaining: -1,
+		}
+	}
+
+	a := t.admit(now)
+	a.Consumer = consumer
+	return a
+}
+
+// Status returns the status of TenantManager.
+func (tm *TenantManager) Status() *supervisor.Status {
+	now := time.Now()
+	day := dayOf(now)
+
+	tm.mutex.Lock()
+	others := tm.others
+	if tm.othersDay != day {
+		others = nil
+	}
+	tm.mutex.Unlock()
+
+	status := &Status{
+		Day:              day,
+		UnknownConsumers: tm.unknown.today(now).requests.Load(),
+		Member:           map[string]*Counts{},
+		Cluster:          map[string]*Indicators{},
+	}
+	for _, t := range tm.tenants {
+		member := t.counter.today(now).counts()
+		status.Member[t.spec.Name] = member
+
+		ind := &Indicators{DailyQuota: t.spec.DailyQuota}
+		ind.add(member)
+		if c := others[t.spec.Name]; c != nil {
+			ind.add(c)
+		}
+		if t.spec.DailyQuota > 0 {
+			remaining := t.spec.DailyQuota - int64(ind.Admitted)
+			if remaining < 0 {
+				remaining = 0
+			}
+			ind.QuotaRemaining = &remaining
+		}
+		status.Cluster[t.spec.Name] = ind
+	}
+
+	return &supervisor.Status{ObjectStatus: status}
+}
+
+// Close closes TenantManager.
+func (tm *TenantManager) Close() {
+	close(tm.done)
+}
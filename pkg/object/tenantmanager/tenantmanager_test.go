@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tenantmanager
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Tenants: []*TenantSpec{
+		{Name: "a", Consumers: []string{"k1", "k2"}, DailyQuota: 100},
+		{Name: "b", Consumers: []string{"k3"}, RateLimit: &RateLimitSpec{LimitForPeriod: 10, LimitRefreshPeriod: "1s"}},
+	}}
+	assert.NoError(spec.Validate())
+
+	assert.Error((&Spec{}).Validate())
+	assert.Error((&Spec{Tenants: []*TenantSpec{{Name: "a"}}}).Validate())
+	assert.Error((&Spec{Tenants: []*TenantSpec{
+		{Name: "a", Consumers: []string{"k1"}},
+		{Name: "a", Consumers: []string{"k2"}},
+	}}).Validate())
+	assert.Error((&Spec{Tenants: []*TenantSpec{
+		{Name: "a", Consumers: []string{"k1"}},
+		{Name: "b", Consumers: []string{"k1"}},
+	}}).Validate())
+	assert.Error((&Spec{Tenants: []*TenantSpec{
+		{Name: "a", Consumers: []string{"k1"}, RateLimit: &RateLimitSpec{LimitForPeriod: 1, LimitRefreshPeriod: "soon"}},
+	}}).Validate())
+}
+
+func TestDayCounter(t *testing.T) {
+	assert := assert.New(t)
+
+	c := &dayCounter{}
+	now := time.Date(2026, 10, 16, 23, 59, 0, 0, time.UTC)
+	c.today(now).requests.Add(2)
+	assert.Equal("2026-10-16", c.today(now).day)
+	assert.Equal(uint64(2), c.today(now).requests.Load())
+
+	// the counts are reset on the next day.
+	next := now.Add(2 * time.Minute)
+	assert.Equal("2026-10-17", c.today(next).day)
+	assert.Equal(uint64(0), c.today(next).requests.Load())
+
+	assert.Equal(time.Minute, nextDay(now))
+}
+
+func newTestTenant(spec *TenantSpec) *tenant {
+	t := newTenant(spec)
+	t.requests = map[string]prometheus.Counter{}
+	for _, result := range []string{"admitted", ResultRateLimited, ResultQuotaExceeded} {
+		t.requests[result] = prometheus.NewCounter(prometheus.CounterOpts{Name: "test"})
+	}
+	return t
+}
+
+func TestAdmit(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+
+	tn := newTestTenant(&TenantSpec{Name: "a", Consumers: []string{"k"}, DailyQuota: 5})
+	tn.others.Store(&dayTotal{day: dayOf(now), admitted: 3})
+
+	a := tn.admit(now)
+	assert.Equal("", a.Result)
+	assert.Equal("a", a.Tenant)
+	assert.Equal(int64(1), a.QuotaRemaining)
+
+	a = tn.admit(now)
+	assert.Equal("", a.Result)
+	assert.Equal(int64(0), a.QuotaRemaining)
+
+	a = tn.admit(now)
+	assert.Equal(ResultQuotaExceeded, a.Result)
+	assert.Equal(nextDay(now), a.RetryAfter)
+	assert.Equal(&Counts{Requests: 3, Admitted: 2, QuotaExceeded: 1}, tn.counter.today(now).counts())
+
+	// the admitted requests of other members in another day are ignored.
+	tn.others.Store(&dayTotal{day: "2000-01-01", admitted: 3})
+	assert.Equal("", tn.admit(now).Result)
+
+	tn = newTestTenant(&TenantSpec{Name: "b", Consumers: []string{"k"}, RateLimit: &RateLimitSpec{LimitForPeriod: 2, LimitRefreshPeriod: "1h"}})
+	assert.Equal("", tn.admit(now).Result)
+	assert.Equal("", tn.admit(now).Result)
+	a = tn.admit(now)
+	assert.Equal(ResultRateLimited, a.Result)
+	assert.Equal(time.Hour, a.RetryAfter)
+	assert.Equal(int64(-1), a.QuotaRemaining)
+	assert.Equal(&Counts{Requests: 3, Admitted: 2, RateLimited: 1}, tn.counter.today(now).counts())
+}
+
+func TestConsumer(t *testing.T) {
+	assert := assert.New(t)
+
+	newRequest := func(header map[string]string) *httpprot.Request {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+		for k, v := range header {
+			stdr.Header.Set(k, v)
+		}
+		req, _ := httpprot.NewRequest(stdr)
+		return req
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "client-1", "uid": 42}).SignedString([]byte("secret"))
+	assert.NoError(err)
+
+	spec := &Spec{}
+	assert.Equal("k1", spec.consumer(newRequest(map[string]string{"X-API-Key": "k1"})))
+	assert.Equal("", spec.consumer(newRequest(map[string]string{"Authorization": "Bearer " + token})))
+
+	spec = &Spec{APIKeyHeader: "X-Key", JWTClaim: "sub"}
+	assert.Equal("k1", spec.consumer(newRequest(map[string]string{"X-Key": "k1", "Authorization": "Bearer " + token})))
+	assert.Equal("client-1", spec.consumer(newRequest(map[string]string{"Authorization": "Bearer " + token})))
+	assert.Equal("", spec.consumer(newRequest(map[string]string{"Authorization": "Bearer bad-token"})))
+	assert.Equal("", spec.consumer(newRequest(map[string]string{"Authorization": "Basic " + token})))
+
+	spec.JWTClaim = "uid"
+	assert.Equal("42", spec.consumer(newRequest(map[string]string{"Authorization": "Bearer " + token})))
+}
+
+func TestConsumerOf(t *testing.T) {
+	assert := assert.New(t)
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	stdr.Header.Set("X-Consumer", "c1")
+	req, _ := httpprot.NewRequest(stdr)
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+
+	assert.Equal("", ConsumerOf(ctx, req, ""))
+	assert.Equal("", ConsumerOf(ctx, req, "X-Other"))
+	assert.Equal("c1", ConsumerOf(ctx, req, "X-Consumer"))
+
+	// the consumer identified by a TenantLimiter takes precedence.
+	ConsumerDataKey.Set(ctx, "c2")
+	assert.Equal("c2", ConsumerOf(ctx, req, "X-Consumer"))
+}
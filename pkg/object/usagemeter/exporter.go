@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package usagemeter
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/util/s3"
+)
+
+const defaultExportTimeout = 30 * time.Second
+
+type (
+	// ExporterSpec describes where to export the usage records, only one
+	// of the targets could be specified.
+	ExporterSpec struct {
+		// Name identifies the exporter, a batch of records is retried on
+		// the exporters failed to export it.
+		Name string `json:"name" jsonschema:"required"`
+		// Format is the format of the exported records, default is json.
+		Format string `json:"format,omitempty" jsonschema:"enum=,enum=csv,enum=json"`
+
+		File *FileExporterSpec `json:"file,omitempty"`
+		HTTP *HTTPExporterSpec `json:"http,omitempty"`
+		S3   *S3ExporterSpec   `json:"s3,omitempty"`
+	}
+
+	// FileExporterSpec writes the records of each period to a file in
+	// the directory.
+	FileExporterSpec struct {
+		Dir string `json:"dir" jsonschema:"required"`
+	}
+
+	// HTTPExporterSpec posts the records of each period to the URL.
+	HTTPExporterSpec struct {
+		URL     string            `json:"url" jsonschema:"required,format=uri"`
+		Headers map[string]string `json:"headers,omitempty"`
+		Timeout string            `json:"timeout,omitempty" jsonschema:"format=duration"`
+	}
+
+	// S3ExporterSpec uploads the records of each period as an object to
+	// an S3 compatible storage. The virtual hosted style URL of AWS is
+	// used if the endpoint is empty, otherwise, the path style URL of the
+	// endpoint is used.
+	S3ExporterSpec struct {
+		Endpoint        string `json:"endpoint,omitempty" jsonschema:"format=uri"`
+		Region          string `json:"region" jsonschema:"required"`
+		Bucket          string `json:"bucket" jsonschema:"required"`
+		Prefix          string `json:"prefix,omitempty"`
+		AccessKeyID     string `json:"accessKeyId" jsonschema:"required"`
+		SecretAccessKey string `json:"secretAccessKey" jsonschema:"required"`
+		Timeout         string `json:"timeout,omitempty" jsonschema:"format=duration"`
+	}
+
+	exporter interface {
+		// export exports the encoded records of the batch, name is the
+		// unique name of the batch.
+		export(name string, data []byte) error
+	}
+
+	fileExporter struct {
+		spec *FileExporterSpec
+	}
+
+	httpExporter struct {
+		spec        *HTTPExporterSpec
+		contentType string
+		client      *http.Client
+	}
+
+	s3Exporter struct {
+		prefix      string
+		contentType string
+		uploader    *s3.Uploader
+	}
+)
+
+// Validate validates ExporterSpec.
+func (spec *ExporterSpec) Validate() error {
+	targets := 0
+	if spec.File != nil {
+		targets++
+	}
+	if spec.HTTP != nil {
+		targets++
+		if _, err := url.Parse(spec.HTTP.URL); err != nil {
+			return fmt.Errorf("invalid url %s: %v", spec.HTTP.URL, err)
+		}
+		if err := validateTimeout(spec.HTTP.Timeout); err != nil {
+			return err
+		}
+	}
+	if spec.S3 != nil {
+		targets++
+		if spec.S3.Endpoint != "" {
+			if _, err := url.Parse(spec.S3.Endpoint); err != nil {
+				return fmt.Errorf("invalid endpoint %s: %v", spec.S3.Endpoint, err)
+			}
+		}
+		if err := validateTimeout(spec.S3.Timeout); err != nil {
+			return err
+		}
+	}
+	if targets != 1 {
+		return fmt.Errorf("exporter %s: exactly one of file, http and s3 is required", spec.Name)
+	}
+	return nil
+}
+
+func validateTimeout(timeout string) error {
+	if timeout == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(timeout); err != nil || d <= 0 {
+		return fmt.Errorf("invalid timeout %s", timeout)
+	}
+	return nil
+}
+
+func parseTimeout(timeout string) time.Duration {
+	if timeout == "" {
+		return defaultExportTimeout
+	}
+	d, _ := time.ParseDuration(timeout)
+	return d
+}
+
+func (spec *ExporterSpec) format() string {
+	if spec.Format == "" {
+		return formatJSON
+	}
+	return spec.Format
+}
+
+func (spec *ExporterSpec) contentType() string {
+	if spec.format() == formatCSV {
+		return "text/csv"
+	}
+	return "application/json"
+}
+
+func newExporter(spec *ExporterSpec) exporter {
+	switch {
+	case spec.File != nil:
+		return &fileExporter{spec: spec.File}
+	case spec.HTTP != nil:
+		return &httpExporter{
+			spec:        spec.HTTP,
+			contentType: spec.contentType(),
+			client:      &http.Client{Timeout: parseTimeout(spec.HTTP.Timeout)},
+		}
+	default:
+		return &s3Exporter{
+			prefix:      spec.S3.Prefix,
+			contentType: spec.contentType(),
+			uploader: s3.NewUploader(&s3.Options{
+				Endpoint:        spec.S3.Endpoint,
+				Region:          spec.S3.Region,
+				Bucket:          spec.S3.Bucket,
+				AccessKeyID:     spec.S3.AccessKeyID,
+				SecretAccessKey: spec.S3.SecretAccessKey,
+				Timeout:         parseTimeout(spec.S3.Timeout),
+			}),
+		}
+	}
+}
+
+// export writes the data to a temporary file and renames it, so a
+// partially written file is never seen by the readers.
+func (e *fileExporter) export(name string, data []byte) error {
+	if err := os.MkdirAll(e.spec.Dir, 0o755); err != nil {
+		return err
+	}
+
+	path := filepath.Join(e.spec.Dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (e *httpExporter) export(name string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.spec.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for k, v := range e.spec.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", e.contentType)
+	req.Header.Set("X-EG-Usage-Batch", name)
+	return doRequest(e.client, req)
+}
+
+func (e *s3Exporter) export(name string, data []byte) error {
+	key := strings.TrimPrefix(e.prefix+name, "/")
+	return e.uploader.Upload(key, e.contentType, data)
+}
+
+func doRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,376 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package usagemeter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	formatCSV  = "csv"
+	formatJSON = "json"
+)
+
+type (
+	// Record is the usage of a consumer on a route of an HTTPServer in a
+	// period, metered by a member. The start, the member, the HTTPServer,
+	// the route and the consumer identify a record, so the duplicated
+	// records of a retried export could be dropped by the receiver.
+	Record struct {
+		Start         time.Time `json:"start"`
+		End           time.Time `json:"end"`
+		Member        string    `json:"member"`
+		HTTPServer    string    `json:"httpServer"`
+		Route         string    `json:"route"`
+		Consumer      string    `json:"consumer"`
+		Requests      uint64    `json:"requests"`
+		RequestBytes  uint64    `json:"requestBytes"`
+		ResponseBytes uint64    `json:"responseBytes"`
+	}
+
+	// Batch is the records of a period waiting to be exported, Exporters
+	// are the names of the exporters which have not exported it yet.
+	Batch struct {
+		Start     time.Time `json:"start"`
+		End       time.Time `json:"end"`
+		Records   []*Record `json:"records"`
+		Exporters []string  `json:"exporters"`
+	}
+
+	// checkpoint is persisted in the cluster, so the usage survives the
+	// restarts of the member.
+	checkpoint struct {
+		Start   time.Time `json:"start"`
+		End     time.Time `json:"end"`
+		Records []*Record `json:"records"`
+		Pending []*Batch  `json:"pending"`
+	}
+
+	usageKey struct {
+		httpServer string
+		route      string
+		consumer   string
+	}
+
+	usage struct {
+		requests      atomic.Uint64
+		requestBytes  atomic.Uint64
+		responseBytes atomic.Uint64
+	}
+
+	// period accumulates the usage in [start, end).
+	period struct {
+		start time.Time
+		end   time.Time
+		m     sync.Map // usageKey -> *usage
+	}
+
+	// meter is the usage of the current period and the batches waiting
+	// to be exported, it is shared by the generations of UsageMeter.
+	meter struct {
+		// rwMutex protects current, the observers hold the read lock
+		// while recording, so the period is not changed by others after
+		// it is replaced.
+		rwMutex sync.RWMutex
+		current *period
+
+		// mutex protects pending.
+		mutex   sync.Mutex
+		pending []*Batch
+
+		// exportMutex ensures only one generation exports the pending
+		// batches at a time.
+		exportMutex sync.Mutex
+	}
+
+	exportTask struct {
+		batch     *Batch
+		exporters []string
+	}
+)
+
+// periodStart returns the start of the period containing t, the periods
+// are aligned to the UTC epoch, so an hourly period starts at the top of
+// an hour and a daily period starts at midnight of UTC.
+func periodStart(t time.Time, interval time.Duration) time.Time {
+	return t.UTC().Truncate(interval)
+}
+
+func newPeriod(t time.Time, interval time.Duration) *period {
+	start := periodStart(t, interval)
+	return &period{start: start, end: start.Add(interval)}
+}
+
+func (p *period) record(key usageKey, reqSize, respSize uint64) {
+	v, ok := p.m.Load(key)
+	if !ok {
+		v, _ = p.m.LoadOrStore(key, &usage{})
+	}
+	u := v.(*usage)
+	u.requests.Add(1)
+	u.requestBytes.Add(reqSize)
+	u.responseBytes.Add(respSize)
+}
+
+// add adds the usage of a record, it is used to restore a checkpoint.
+func (p *period) add(r *Record) {
+	key := usageKey{httpServer: r.HTTPServer, route: r.Route, consumer: r.Consumer}
+	v, _ := p.m.LoadOrStore(key, &usage{})
+	u := v.(*usage)
+	u.requests.Add(r.Requests)
+	u.requestBytes.Add(r.RequestBytes)
+	u.responseBytes.Add(r.ResponseBytes)
+}
+
+// records returns the records of the period sorted by the HTTPServer,
+// the route and the consumer.
+func (p *period) records(member string) []*Record {
+	records := []*Record{}
+	p.m.Range(func(k, v interface{}) bool {
+		key, u := k.(usageKey), v.(*usage)
+		records = append(records, &Record{
+			Start:         p.start,
+			End:           p.end,
+			Member:        member,
+			HTTPServer:    key.httpServer,
+			Route:         key.route,
+			Consumer:      key.consumer,
+			Requests:      u.requests.Load(),
+			RequestBytes:  u.requestBytes.Load(),
+			ResponseBytes: u.responseBytes.Load(),
+		})
+		return true
+	})
+
+	sort.Slice(records, func(i, j int) bool {
+		ri, rj := records[i], records[j]
+		if ri.HTTPServer != rj.HTTPServer {
+			return ri.HTTPServer < rj.HTTPServer
+		}
+		if ri.Route != rj.Route {
+			return ri.Route < rj.Route
+		}
+		return ri.Consumer < rj.Consumer
+	})
+	return records
+}
+
+func newMeter(now time.Time, interval time.Duration) *meter {
+	return &meter{current: newPeriod(now, interval)}
+}
+
+func (m *meter) record(key usageKey, reqSize, respSize uint64) {
+	m.rwMutex.RLock()
+	m.current.record(key, reqSize, respSize)
+	m.rwMutex.RUnlock()
+}
+
+// rotate starts a new period if the current one ends before now, or the
+// interval is changed, the records of the ended period are appended to
+// the pending batches to be exported by the exporters. It returns true
+// if a new period is started.
+func (m *meter) rotate(now time.Time, interval time.Duration, member string, exporters []string) bool {
+	m.rwMutex.Lock()
+	prev := m.current
+	if now.Before(prev.end) && prev.end.Sub(prev.start) == interval {
+		m.rwMutex.Unlock()
+		return false
+	}
+	m.current = newPeriod(now, interval)
+	m.rwMutex.Unlock()
+
+	// the period is cut short if the interval is changed.
+	end := prev.end
+	if now.Before(end) {
+		end = now.UTC()
+	}
+	records := prev.records(member)
+	for _, r := range records {
+		r.End = end
+	}
+	m.addPending(&Batch{Start: prev.start, End: end, Records: records}, exporters)
+	return true
+}
+
+// addPending appends the batch to the pending ones, the oldest ones are
+// dropped if there are more than the max pending batches.
+func (m *meter) addPending(b *Batch, exporters []string) {
+	if len(b.Records) == 0 || len(exporters) == 0 {
+		return
+	}
+	b.Exporters = append([]string(nil), exporters...)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.pending = append(m.pending, b)
+	if n := len(m.pending) - maxPendingBatches; n > 0 {
+		m.pending = append([]*Batch(nil), m.pending[n:]...)
+	}
+}
+
+// pendingBatches returns the copies of the pending batches, the records
+// are shared as they are never changed.
+func (m *meter) pendingBatches() []*Batch {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	batches := make([]*Batch, 0, len(m.pending))
+	for _, b := range m.pending {
+		c := *b
+		c.Exporters = append([]string(nil), b.Exporters...)
+		batches = append(batches, &c)
+	}
+	return batches
+}
+
+// exportTasks returns the pending batches and their exporters.
+func (m *meter) exportTasks() []*exportTask {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	tasks := make([]*exportTask, 0, len(m.pending))
+	for _, b := range m.pending {
+		tasks = append(tasks, &exportTask{
+			batch:     b,
+			exporters: append([]string(nil), b.Exporters...),
+		})
+	}
+	return tasks
+}
+
+// exported removes the exporter from the batch, the batch is removed
+// after it is exported by all exporters.
+func (m *meter) exported(b *Batch, exporter string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	exporters := make([]string, 0, len(b.Exporters))
+	for _, name := range b.Exporters {
+		if name != exporter {
+			exporters = append(exporters, name)
+		}
+	}
+	b.Exporters = exporters
+	if len(exporters) > 0 {
+		return
+	}
+
+	for i, p := range m.pending {
+		if p == b {
+			m.pending = append(m.pending[:i:i], m.pending[i+1:]...)
+			break
+		}
+	}
+}
+
+// retain removes the exporters which no longer exist from the pending
+// batches, and the batches without exporters.
+func (m *meter) retain(exporters []string) {
+	exists := map[string]bool{}
+	for _, name := range exporters {
+		exists[name] = true
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	pending := make([]*Batch, 0, len(m.pending))
+	for _, b := range m.pending {
+		names := make([]string, 0, len(b.Exporters))
+		for _, name := range b.Exporters {
+			if exists[name] {
+				names = append(names, name)
+			}
+		}
+		b.Exporters = names
+		if len(names) > 0 {
+			pending = append(pending, b)
+		}
+	}
+	m.pending = pending
+}
+
+func (m *meter) checkpoint(member string) *checkpoint {
+	m.rwMutex.RLock()
+	p := m.current
+	m.rwMutex.RUnlock()
+
+	return &checkpoint{
+		Start:   p.start,
+		End:     p.end,
+		Records: p.records(member),
+		Pending: m.pendingBatches(),
+	}
+}
+
+// restore restores the usage of the checkpoint, the usage is added to
+// the current period if they are in the same period, otherwise, it is
+// appended to the pending batches.
+func (m *meter) restore(cp *checkpoint, exporters []string) {
+	m.mutex.Lock()
+	m.pending = append(cp.Pending, m.pending...)
+	m.mutex.Unlock()
+
+	m.rwMutex.RLock()
+	current := m.current
+	m.rwMutex.RUnlock()
+
+	if cp.Start.Equal(current.start) && cp.End.Equal(current.end) {
+		for _, r := range cp.Records {
+			current.add(r)
+		}
+		return
+	}
+	m.addPending(&Batch{Start: cp.Start, End: cp.End, Records: cp.Records}, exporters)
+}
+
+// marshal encodes the records in the format.
+func marshal(records []*Record, format string) ([]byte, error) {
+	if format != formatCSV {
+		return json.Marshal(records)
+	}
+
+	buf := bytes.Buffer{}
+	w := csv.NewWriter(&buf)
+	w.Write([]string{
+		"start", "end", "member", "httpServer", "route", "consumer",
+		"requests", "requestBytes", "responseBytes",
+	})
+	for _, r := range records {
+		w.Write([]string{
+			r.Start.Format(time.RFC3339),
+			r.End.Format(time.RFC3339),
+			r.Member,
+			r.HTTPServer,
+			r.Route,
+			r.Consumer,
+			strconv.FormatUint(r.Requests, 10),
+			strconv.FormatUint(r.RequestBytes, 10),
+			strconv.FormatUint(r.ResponseBytes, 10),
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,536 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package usagemeter provides UsageMeter to meter the usage of the
+// consumers on the routes of the HTTPServers and export it for billing.
+package usagemeter
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/megaease/easegress/v2/pkg/api"
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/object/httpserver"
+	"github.com/megaease/easegress/v2/pkg/object/tenantmanager"
+	"github.com/megaease/easegress/v2/pkg/object/trafficcontroller"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot/httpstat"
+	"github.com/megaease/easegress/v2/pkg/supervisor"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+	"github.com/megaease/easegress/v2/pkg/util/prometheushelper"
+)
+
+const (
+	// Category is the category of UsageMeter.
+	Category = supervisor.CategoryBusinessController
+
+	// Kind is the kind of UsageMeter.
+	Kind = "UsageMeter"
+
+	defaultInterval = time.Hour
+	minInterval     = time.Minute
+
+	// anonymous is the consumer of the requests whose consumer is unknown.
+	anonymous = "anonymous"
+
+	// tickInterval is the interval to attach the observers to the
+	// HTTPServers, and to check whether the current period ends.
+	tickInterval       = 5 * time.Second
+	checkpointInterval = 30 * time.Second
+	retryInterval      = time.Minute
+
+	// maxPendingBatches is the max number of batches waiting to be
+	// exported, the oldest ones are dropped if the exporters keep failing.
+	maxPendingBatches = 720
+)
+
+var aliases = []string{
+	"usagemeters",
+}
+
+func init() {
+	supervisor.Register(&UsageMeter{})
+	api.RegisterObject(&api.APIResource{
+		Category: Category,
+		Kind:     Kind,
+		Name:     strings.ToLower(Kind),
+		Aliases:  aliases,
+	})
+}
+
+type (
+	// UsageMeter meters the requests and the bytes of the consumers on
+	// the routes of the HTTPServers in periods, persists the usage in the
+	// cluster, and exports the records of the ended periods.
+	UsageMeter struct {
+		super     *supervisor.Supervisor
+		superSpec *supervisor.Spec
+		spec      *Spec
+
+		interval  time.Duration
+		meter     *meter
+		exporters map[string]exporter
+		metrics   *metrics
+
+		// statusMutex protects exporterStatuses.
+		statusMutex      sync.Mutex
+		exporterStatuses map[string]*ExporterStatus
+
+		// mutex protects closed, so the observers are never attached
+		// after the UsageMeter is closed.
+		mutex  sync.Mutex
+		closed bool
+		done   chan struct{}
+	}
+
+	// Spec describes UsageMeter.
+	Spec struct {
+		HTTPServers []string `json:"httpServers" jsonschema:"required,minItems=1,uniqueItems=true"`
+		// Namespace is the namespace of the HTTPServers, default is default.
+		Namespace string `json:"namespace,omitempty"`
+		// ConsumerHeader is the header to identify the consumer if it is
+		// not identified by a TenantLimiter in the pipeline.
+		ConsumerHeader string `json:"consumerHeader,omitempty"`
+		// Interval is the length of a period, default is 1h.
+		Interval  string          `json:"interval,omitempty" jsonschema:"format=duration"`
+		Exporters []*ExporterSpec `json:"exporters,omitempty"`
+	}
+
+	// Status is the status of UsageMeter.
+	Status struct {
+		Start time.Time `json:"start"`
+		End   time.Time `json:"end"`
+		// Usage is the usage of the current period of the member.
+		Usage          []*Record                  `json:"usage"`
+		PendingBatches int                        `json:"pendingBatches"`
+		Exporters      map[string]*ExporterStatus `json:"exporters,omitempty"`
+	}
+
+	// ExporterStatus is the status of an exporter.
+	ExporterStatus struct {
+		Exported  uint64    `json:"exported"`
+		Failed    uint64    `json:"failed"`
+		LastError string    `json:"lastError,omitempty"`
+		LastTry   time.Time `json:"lastTry,omitempty"`
+	}
+
+	metrics struct {
+		Requests *prometheus.CounterVec
+		Exports  *prometheus.CounterVec
+	}
+)
+
+// Validate validates the spec of UsageMeter.
+func (spec *Spec) Validate() error {
+	if spec.Interval != "" {
+		d, err := time.ParseDuration(spec.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid interval %s: %v", spec.Interval, err)
+		}
+		if d < minInterval {
+			return fmt.Errorf("interval must not be less than %v", minInterval)
+		}
+	}
+
+	names := map[string]bool{}
+	for _, e := range spec.Exporters {
+		if names[e.Name] {
+			return fmt.Errorf("duplicated exporter %s", e.Name)
+		}
+		names[e.Name] = true
+		if err := e.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (spec *Spec) namespace() string {
+	if spec.Namespace == "" {
+		return cluster.NamespaceDefault
+	}
+	return spec.Namespace
+}
+
+func (spec *Spec) interval() time.Duration {
+	if spec.Interval == "" {
+		return defaultInterval
+	}
+	d, _ := time.ParseDuration(spec.Interval)
+	return d
+}
+
+func (spec *Spec) exporterNames() []string {
+	names := make([]string, 0, len(spec.Exporters))
+	for _, e := range spec.Exporters {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+// Category returns the category of UsageMeter.
+func (um *UsageMeter) Category() supervisor.ObjectCategory {
+	return Category
+}
+
+// Kind returns the kind of UsageMeter.
+func (um *UsageMeter) Kind() string {
+	return Kind
+}
+
+// DefaultSpec returns the default spec of UsageMeter.
+func (um *UsageMeter) DefaultSpec() interface{} {
+	return &Spec{
+		Interval: defaultInterval.String(),
+	}
+}
+
+// Init initializes UsageMeter, the usage is restored from the checkpoint
+// persisted before the restart of the member.
+func (um *UsageMeter) Init(superSpec *supervisor.Spec) {
+	um.superSpec = superSpec
+	um.spec = superSpec.ObjectSpec().(*Spec)
+	um.super = superSpec.Super()
+
+	um.reload(nil)
+}
+
+// Inherit inherits previous generation of UsageMeter, the usage of the
+// current period and the pending batches are kept.
+func (um *UsageMeter) Inherit(superSpec *supervisor.Spec, previousGeneration supervisor.Object) {
+	um.superSpec = superSpec
+	um.spec = superSpec.ObjectSpec().(*Spec)
+	um.super = superSpec.Super()
+
+	prev := previousGeneration.(*UsageMeter)
+	prev.Close()
+	um.reload(prev)
+}
+
+func (um *UsageMeter) reload(prev *UsageMeter) {
+	um.interval = um.spec.interval()
+
+	um.exporters = map[string]exporter{}
+	um.exporterStatuses = map[string]*ExporterStatus{}
+	for _, spec := range um.spec.Exporters {
+		um.exporters[spec.Name] = newExporter(spec)
+		um.exporterStatuses[spec.Name] = &ExporterStatus{}
+	}
+
+	if prev != nil {
+		um.meter = prev.meter
+		um.meter.retain(um.spec.exporterNames())
+		prev.statusMutex.Lock()
+		for name, s := range prev.exporterStatuses {
+			if _, ok := um.exporterStatuses[name]; ok {
+				c := *s
+				um.exporterStatuses[name] = &c
+			}
+		}
+		prev.statusMutex.Unlock()
+	} else {
+		um.meter = newMeter(time.Now(), um.interval)
+		um.restore()
+	}
+
+	um.metrics = newMetrics(um.super)
+	um.done = make(chan struct{})
+	go um.run()
+}
+
+func newMetrics(super *supervisor.Supervisor) *metrics {
+	opt := super.Options()
+	commonLabels := prometheus.Labels{
+		"clusterName":  opt.ClusterName,
+		"clusterRole":  opt.ClusterRole,
+		"instanceName": opt.Name,
+	}
+
+	return &metrics{
+		Requests: prometheushelper.NewCounter("usagemeter_requests_total",
+			"the number of requests metered by the usage meter",
+			[]string{"clusterName", "clusterRole", "instanceName", "usageMeter", "httpServer"},
+		).MustCurryWith(commonLabels),
+		Exports: prometheushelper.NewCounter("usagemeter_exports_total",
+			"the number of batches exported by the exporters of the usage meter by the result",
+			[]string{"clusterName", "clusterRole", "instanceName", "usageMeter", "exporter", "result"},
+		).MustCurryWith(commonLabels),
+	}
+}
+
+// restore restores the usage from the checkpoint in the cluster.
+func (um *UsageMeter) restore() {
+	cls := um.super.Cluster()
+	value, err := cls.Get(cls.Layout().UsageCheckpointKey(um.superSpec.Name()))
+	if err != nil {
+		logger.Errorf("get checkpoint of UsageMeter %s failed: %v", um.superSpec.Name(), err)
+		return
+	}
+	if value == nil {
+		return
+	}
+
+	cp := &checkpoint{}
+	if err := codectool.Unmarshal([]byte(*value), cp); err != nil {
+		logger.Errorf("unmarshal checkpoint of UsageMeter %s failed: %v", um.superSpec.Name(), err)
+		return
+	}
+	um.meter.restore(cp, um.spec.exporterNames())
+	um.meter.retain(um.spec.exporterNames())
+}
+
+// saveCheckpoint persists the usage of the current period and the pending
+// batches in the cluster.
+func (um *UsageMeter) saveCheckpoint() {
+	cp := um.meter.checkpoint(um.super.Options().Name)
+	data, err := codectool.MarshalJSON(cp)
+	if err != nil {
+		logger.Errorf("BUG: marshal checkpoint of UsageMeter %s failed: %v", um.superSpec.Name(), err)
+		return
+	}
+
+	cls := um.super.Cluster()
+	if err = cls.Put(cls.Layout().UsageCheckpointKey(um.superSpec.Name()), string(data)); err != nil {
+		logger.Errorf("save checkpoint of UsageMeter %s failed: %v", um.superSpec.Name(), err)
+	}
+}
+
+func (um *UsageMeter) run() {
+	um.attach()
+
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	lastCheckpoint := time.Now()
+	for {
+		select {
+		case <-um.done:
+			return
+		case now := <-ticker.C:
+			um.attach()
+			if um.meter.rotate(now, um.interval, um.super.Options().Name, um.spec.exporterNames()) {
+				um.saveCheckpoint()
+				lastCheckpoint = now
+			}
+			if um.export(now) || now.Sub(lastCheckpoint) >= checkpointInterval {
+				um.saveCheckpoint()
+				lastCheckpoint = now
+			}
+		}
+	}
+}
+
+// export exports the pending batches by the exporters, an exporter which
+// failed recently is not retried until the retry interval passes. It
+// returns true if any batch is exported.
+func (um *UsageMeter) export(now time.Time) bool {
+	um.meter.exportMutex.Lock()
+	defer um.meter.exportMutex.Unlock()
+
+	exported := false
+	member := um.super.Options().Name
+	for _, task := range um.meter.exportTasks() {
+		for _, name := range task.exporters {
+			select {
+			case <-um.done:
+				return exported
+			default:
+			}
+
+			e := um.exporters[name]
+			status := um.exporterStatus(name)
+			if e == nil || status == nil || (status.LastError != "" && now.Sub(status.LastTry) < retryInterval) {
+				continue
+			}
+
+			spec := um.exporterSpec(name)
+			err := um.exportBatch(e, spec, member, task.batch)
+			um.updateExporterStatus(name, now, err)
+			if err != nil {
+				logger.Errorf("UsageMeter %s: exporter %s failed to export the usage of %v: %v",
+					um.superSpec.Name(), name, task.batch.Start, err)
+				continue
+			}
+			um.meter.exported(task.batch, name)
+			exported = true
+		}
+	}
+	return exported
+}
+
+func (um *UsageMeter) exportBatch(e exporter, spec *ExporterSpec, member string, b *Batch) error {
+	data, err := marshal(b.Records, spec.format())
+	if err != nil {
+		return err
+	}
+	return e.export(batchName(um.superSpec.Name(), member, b.Start, spec.format()), data)
+}
+
+// batchName returns the name of the batch, which is unique in the cluster.
+func batchName(meter, member string, start time.Time, format string) string {
+	return fmt.Sprintf("%s-%s-%s.%s", meter, member, start.UTC().Format("20060102T150405Z"), format)
+}
+
+func (um *UsageMeter) exporterSpec(name string) *ExporterSpec {
+	for _, spec := range um.spec.Exporters {
+		if spec.Name == name {
+			return spec
+		}
+	}
+	return nil
+}
+
+func (um *UsageMeter) exporterStatus(name string) *ExporterStatus {
+	um.statusMutex.Lock()
+	defer um.statusMutex.Unlock()
+	if s := um.exporterStatuses[name]; s != nil {
+		c := *s
+		return &c
+	}
+	return nil
+}
+
+func (um *UsageMeter) updateExporterStatus(name string, now time.Time, err error) {
+	um.statusMutex.Lock()
+	defer um.statusMutex.Unlock()
+
+	s := um.exporterStatuses[name]
+	s.LastTry = now
+	result := "success"
+	if err != nil {
+		s.Failed++
+		s.LastError = err.Error()
+		result = "failure"
+	} else {
+		s.Exported++
+		s.LastError = ""
+	}
+
+	um.metrics.Exports.With(prometheus.Labels{
+		"usageMeter": um.superSpec.Name(),
+		"exporter":   name,
+		"result":     result,
+	}).Inc()
+}
+
+func (um *UsageMeter) getHTTPServer(name string) *httpserver.HTTPServer {
+	entity, exists := um.super.GetSystemController(trafficcontroller.Kind)
+	if !exists {
+		return nil
+	}
+	tc, ok := entity.Instance().(*trafficcontroller.TrafficController)
+	if !ok {
+		return nil
+	}
+
+	entity, exists = tc.GetTrafficGate(um.spec.namespace(), name)
+	if !exists {
+		return nil
+	}
+	hs, _ := entity.Instance().(*httpserver.HTTPServer)
+	return hs
+}
+
+// attach adds the observers to the HTTPServers, it replaces the observers
+// of the previous generation, and attaches to the recreated HTTPServers.
+func (um *UsageMeter) attach() {
+	um.mutex.Lock()
+	defer um.mutex.Unlock()
+
+	if um.closed {
+		return
+	}
+	for _, name := range um.spec.HTTPServers {
+		if hs := um.getHTTPServer(name); hs != nil {
+			hs.AddRequestObserver(um.observerKey(), um.observer(name))
+		}
+	}
+}
+
+func (um *UsageMeter) observerKey() string {
+	return Kind + "/" + um.superSpec.Name()
+}
+
+func (um *UsageMeter) observer(server string) httpserver.RequestObserver {
+	requests := um.metrics.Requests.With(prometheus.Labels{
+		"usageMeter": um.superSpec.Name(),
+		"httpServer": server,
+	})
+	return func(ctx *context.Context, path, backend string, metric *httpstat.Metric) {
+		key := usageKey{httpServer: server, route: path, consumer: um.consumer(ctx)}
+		um.meter.record(key, metric.ReqSize, metric.RespSize)
+		requests.Inc()
+	}
+}
+
+// consumer returns the consumer identified by the TenantLimiter, or the
+// value of the consumer header.
+func (um *UsageMeter) consumer(ctx *context.Context) string {
+	if consumer, ok := tenantmanager.ConsumerDataKey.Get(ctx); ok && consumer != "" {
+		return consumer
+	}
+	if um.spec.ConsumerHeader != "" {
+		if req, ok := ctx.GetRequest(context.DefaultNamespace).(*httpprot.Request); ok {
+			if consumer := req.HTTPHeader().Get(um.spec.ConsumerHeader); consumer != "" {
+				return consumer
+			}
+		}
+	}
+	return anonymous
+}
+
+// Status returns the status of UsageMeter.
+func (um *UsageMeter) Status() *supervisor.Status {
+	um.meter.rwMutex.RLock()
+	p := um.meter.current
+	um.meter.rwMutex.RUnlock()
+
+	status := &Status{
+		Start:          p.start,
+		End:            p.end,
+		Usage:          p.records(um.super.Options().Name),
+		PendingBatches: len(um.meter.pendingBatches()),
+		Exporters:      map[string]*ExporterStatus{},
+	}
+	for name := range um.exporters {
+		status.Exporters[name] = um.exporterStatus(name)
+	}
+	return &supervisor.Status{ObjectStatus: status}
+}
+
+// Close closes UsageMeter, the observers are removed from the HTTPServers
+// before it returns, and the usage is persisted in the cluster.
+func (um *UsageMeter) Close() {
+	um.mutex.Lock()
+	um.closed = true
+	for _, name := range um.spec.HTTPServers {
+		if hs := um.getHTTPServer(name); hs != nil {
+			hs.RemoveRequestObserver(um.observerKey())
+		}
+	}
+	um.mutex.Unlock()
+
+	close(um.done)
+	um.saveCheckpoint()
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package usagemeter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		HTTPServers: []string{"server-demo"},
+		Interval:    "1h",
+		Exporters: []*ExporterSpec{
+			{Name: "file", Format: "csv", File: &FileExporterSpec{Dir: "/tmp"}},
+			{Name: "billing", HTTP: &HTTPExporterSpec{URL: "http://127.0.0.1/usage", Timeout: "5s"}},
+		},
+	}
+	assert.NoError(spec.Validate())
+
+	assert.Error((&Spec{Interval: "10s"}).Validate())
+	assert.Error((&Spec{Interval: "hourly"}).Validate())
+	assert.Error((&Spec{Exporters: []*ExporterSpec{{Name: "e"}}}).Validate())
+	assert.Error((&Spec{Exporters: []*ExporterSpec{{
+		Name: "e",
+		File: &FileExporterSpec{Dir: "/tmp"},
+		HTTP: &HTTPExporterSpec{URL: "http://127.0.0.1/usage"},
+	}}}).Validate())
+	assert.Error((&Spec{Exporters: []*ExporterSpec{
+		{Name: "e", File: &FileExporterSpec{Dir: "/tmp"}},
+		{Name: "e", File: &FileExporterSpec{Dir: "/var/tmp"}},
+	}}).Validate())
+	assert.Error((&Spec{Exporters: []*ExporterSpec{
+		{Name: "e", S3: &S3ExporterSpec{Region: "us-east-1", Bucket: "b", Timeout: "-1s"}},
+	}}).Validate())
+}
+
+func TestMeterRotate(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2026, 10, 16, 10, 20, 0, 0, time.UTC)
+	m := newMeter(now, time.Hour)
+	assert.Equal(time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC), m.current.start)
+
+	m.record(usageKey{httpServer: "s", route: "/b", consumer: "c1"}, 10, 100)
+	m.record(usageKey{httpServer: "s", route: "/a", consumer: "c2"}, 20, 200)
+	m.record(usageKey{httpServer: "s", route: "/a", consumer: "c2"}, 30, 300)
+
+	exporters := []string{"file", "http"}
+	assert.False(m.rotate(now.Add(30*time.Minute), time.Hour, "m1", exporters))
+	assert.Empty(m.pendingBatches())
+
+	assert.True(m.rotate(now.Add(time.Hour), time.Hour, "m1", exporters))
+	batches := m.pendingBatches()
+	assert.Len(batches, 1)
+	b := batches[0]
+	assert.Equal(exporters, b.Exporters)
+	assert.Len(b.Records, 2)
+	assert.Equal(&Record{
+		Start:         time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC),
+		End:           time.Date(2026, 10, 16, 11, 0, 0, 0, time.UTC),
+		Member:        "m1",
+		HTTPServer:    "s",
+		Route:         "/a",
+		Consumer:      "c2",
+		Requests:      2,
+		RequestBytes:  50,
+		ResponseBytes: 500,
+	}, b.Records[0])
+	assert.Equal("/b", b.Records[1].Route)
+
+	// an empty period is not exported.
+	assert.True(m.rotate(now.Add(2*time.Hour), time.Hour, "m1", exporters))
+	assert.Len(m.pendingBatches(), 1)
+
+	// the period is cut short if the interval is changed.
+	m.record(usageKey{httpServer: "s", route: "/a", consumer: "c1"}, 1, 1)
+	cut := time.Date(2026, 10, 16, 12, 30, 0, 0, time.UTC)
+	assert.True(m.rotate(cut, 30*time.Minute, "m1", exporters))
+	batches = m.pendingBatches()
+	assert.Len(batches, 2)
+	assert.Equal(cut, batches[1].End)
+	assert.Equal(cut, batches[1].Records[0].End)
+	assert.Equal(cut, m.current.start)
+
+	tasks := m.exportTasks()
+	m.exported(tasks[0].batch, "file")
+	assert.Len(m.pendingBatches(), 2)
+	m.exported(tasks[0].batch, "http")
+	assert.Len(m.pendingBatches(), 1)
+
+	m.retain([]string{"http"})
+	assert.Equal([]string{"http"}, m.pendingBatches()[0].Exporters)
+	m.retain(nil)
+	assert.Empty(m.pendingBatches())
+}
+
+func TestMeterMaxPendingBatches(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	m := newMeter(now, time.Minute)
+	for i := 0; i < maxPendingBatches+10; i++ {
+		m.record(usageKey{consumer: "c"}, 1, 1)
+		m.rotate(now.Add(time.Duration(i+1)*time.Minute), time.Minute, "m1", []string{"e"})
+	}
+
+	batches := m.pendingBatches()
+	assert.Len(batches, maxPendingBatches)
+	assert.Equal(now.Add(10*time.Minute), batches[0].Start)
+}
+
+func TestMeterCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2026, 10, 16, 10, 20, 0, 0, time.UTC)
+	m := newMeter(now, time.Hour)
+	m.record(usageKey{httpServer: "s", route: "/a", consumer: "c1"}, 10, 100)
+	m.addPending(&Batch{Records: []*Record{{Consumer: "old"}}}, []string{"e"})
+	cp := m.checkpoint("m1")
+
+	// restored in the same period.
+	m2 := newMeter(now.Add(10*time.Minute), time.Hour)
+	m2.record(usageKey{httpServer: "s", route: "/a", consumer: "c1"}, 1, 1)
+	m2.restore(cp, []string{"e"})
+	records := m2.current.records("m1")
+	assert.Len(records, 1)
+	assert.Equal(uint64(2), records[0].Requests)
+	assert.Equal(uint64(11), records[0].RequestBytes)
+	assert.Len(m2.pendingBatches(), 1)
+
+	// restored after the period ends.
+	m3 := newMeter(now.Add(time.Hour), time.Hour)
+	m3.restore(cp, []string{"e"})
+	assert.Empty(m3.current.records("m1"))
+	batches := m3.pendingBatches()
+	assert.Len(batches, 2)
+	assert.Equal("c1", batches[1].Records[0].Consumer)
+	assert.Equal(cp.Start, batches[1].Start)
+}
+
+func TestMarshal(t *testing.T) {
+	assert := assert.New(t)
+
+	start := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	records := []*Record{{
+		Start: start, End: start.Add(time.Hour), Member: "m1",
+		HTTPServer: "s", Route: "/a,b", Consumer: "c1",
+		Requests: 2, RequestBytes: 50, ResponseBytes: 500,
+	}}
+
+	data, err := marshal(records, formatCSV)
+	assert.NoError(err)
+	assert.Equal("start,end,member,httpServer,route,consumer,requests,requestBytes,responseBytes\n"+
+		"2026-10-16T10:00:00Z,2026-10-16T11:00:00Z,m1,s,\"/a,b\",c1,2,50,500\n", string(data))
+
+	data, err = marshal(records, formatJSON)
+	assert.NoError(err)
+	assert.Contains(string(data), `"requestBytes":50`)
+
+	assert.Equal("meter-m1-20261016T100000Z.csv", batchName("meter", "m1", start, formatCSV))
+}
+
+func TestFileExporter(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := filepath.Join(t.TempDir(), "usage")
+	e := newExporter(&ExporterSpec{Name: "file", File: &FileExporterSpec{Dir: dir}})
+	assert.NoError(e.export("batch.json", []byte("[]")))
+
+	data, err := os.ReadFile(filepath.Join(dir, "batch.json"))
+	assert.NoError(err)
+	assert.Equal("[]", string(data))
+	_, err = os.Stat(filepath.Join(dir, "batch.json.tmp"))
+	assert.True(os.IsNotExist(err))
+}
+
+func TestHTTPExporter(t *testing.T) {
+	assert := assert.New(t)
+
+	var header http.Header
+	var body string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	e := newExporter(&ExporterSpec{
+		Name:   "http",
+		Format: formatCSV,
+		HTTP:   &HTTPExporterSpec{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer token"}},
+	})
+	assert.NoError(e.export("batch.csv", []byte("a,b\n")))
+	assert.Equal("a,b\n", body)
+	assert.Equal("text/csv", header.Get("Content-Type"))
+	assert.Equal("Bearer token", header.Get("Authorization"))
+	assert.Equal("batch.csv", header.Get("X-EG-Usage-Batch"))
+
+	status = http.StatusServiceUnavailable
+	assert.Error(e.export("batch.csv", []byte("a,b\n")))
+}
+
+func TestS3Exporter(t *testing.T) {
+	assert := assert.New(t)
+
+	var req *http.Request
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer srv.Close()
+
+	e := newExporter(&ExporterSpec{
+		Name: "s3",
+		S3: &S3ExporterSpec{
+			Endpoint:        srv.URL,
+			Region:          "us-east-1",
+			Bucket:          "billing",
+			Prefix:          "usage/",
+			AccessKeyID:     "AKID",
+			SecretAccessKey: "SECRET",
+		},
+	})
+	assert.NoError(e.export("batch.json", []byte("[]")))
+	assert.Equal(http.MethodPut, req.Method)
+	assert.Equal("/billing/usage/batch.json", req.URL.Path)
+	assert.Equal("[]", body)
+	assert.Equal("4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945", req.Header.Get("X-Amz-Content-Sha256"))
+	auth := req.Header.Get("Authorization")
+	assert.True(strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/"), auth)
+	assert.Contains(auth, "/us-east-1/s3/aws4_request")
+}
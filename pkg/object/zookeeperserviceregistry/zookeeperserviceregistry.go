@@ -211,12 +211,16 @@ func (zk *ZookeeperServiceRegistry) run() {
 
 	zk.update()
 
+	changed := zk.watch(syncInterval)
+
 	for {
 		select {
 		case <-zk.done:
 			return
 		case <-time.After(syncInterval):
 			zk.update()
+		case <-changed:
+			zk.update()
 		}
 	}
 }
@@ -364,19 +368,30 @@ func (zk *ZookeeperServiceRegistry) GetServiceInstance(serviceName, instanceID s
 func (zk *ZookeeperServiceRegistry) ListServiceInstances(serviceName string) (map[string]*serviceregistry.ServiceInstanceSpec, error) {
 	client, err := zk.getClient()
 	if err != nil {
-		return nil, fmt.Errorf("%s get consul client failed: %v",
+		return nil, fmt.Errorf("%s get zookeeper client failed: %v",
 			zk.superSpec.Name(), err)
 	}
 
-	children, _, err := client.Children(zk.serviceZookeeperPrefix(serviceName))
+	return zk.listServiceInstances(client, serviceName)
+}
+
+// listServiceInstances lists the instances stored in the children of the
+// service path, the invalid ones are skipped, so that a broken
+// registration can't affect the others.
+func (zk *ZookeeperServiceRegistry) listServiceInstances(client *zookeeper.Conn, serviceName string) (map[string]*serviceregistry.ServiceInstanceSpec, error) {
+	servicePath := zk.servicePath(serviceName)
+	children, _, err := client.Children(servicePath)
 	if err != nil {
-		return nil, fmt.Errorf("%s get path: %s children failed: %v", zk.superSpec.Name(), zk.spec.Prefix, err)
+		return nil, fmt.Errorf("%s get path: %s children failed: %v", zk.superSpec.Name(), servicePath, err)
 	}
 
 	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
 	for _, child := range children {
-		fullPath := zk.fullPathOfChild(child)
+		fullPath := path.Join(servicePath, child)
 		data, _, err := client.Get(fullPath)
+		if err == zookeeper.ErrNoNode {
+			continue
+		}
 		if err != nil {
 			return nil, fmt.Errorf("%s get child path %s failed: %v", zk.superSpec.Name(), fullPath, err)
 		}
@@ -384,12 +399,26 @@ func (zk *ZookeeperServiceRegistry) ListServiceInstances(serviceName string) (ma
 		instance := &serviceregistry.ServiceInstanceSpec{}
 		err = codectool.Unmarshal(data, instance)
 		if err != nil {
-			return nil, fmt.Errorf("%s unmarshal fullpath %s to json failed: %v", zk.superSpec.Name(), fullPath, err)
+			logger.Warnf("%s unmarshal %s failed: %v", zk.superSpec.Name(), fullPath, err)
+			continue
+		}
+
+		// fill the missing fields from the path, so self-registering
+		// services only need to write the address and the port.
+		if instance.RegistryName == "" {
+			instance.RegistryName = zk.Name()
+		}
+		if instance.ServiceName == "" {
+			instance.ServiceName = serviceName
+		}
+		if instance.InstanceID == "" {
+			instance.InstanceID = child
 		}
 
 		err = instance.Validate()
 		if err != nil {
-			return nil, fmt.Errorf("%s is invalid: %v", data, err)
+			logger.Warnf("%s %s is invalid: %v", zk.superSpec.Name(), fullPath, err)
+			continue
 		}
 
 		instances[instance.Key()] = instance
@@ -402,46 +431,133 @@ func (zk *ZookeeperServiceRegistry) ListServiceInstances(serviceName string) (ma
 func (zk *ZookeeperServiceRegistry) ListAllServiceInstances() (map[string]*serviceregistry.ServiceInstanceSpec, error) {
 	client, err := zk.getClient()
 	if err != nil {
-		return nil, fmt.Errorf("%s get consul client failed: %v",
+		return nil, fmt.Errorf("%s get zookeeper client failed: %v",
 			zk.superSpec.Name(), err)
 	}
 
-	children, _, err := client.Children(zk.spec.Prefix)
+	services, _, err := client.Children(zk.spec.Prefix)
 	if err != nil {
 		return nil, fmt.Errorf("%s get path: %s children failed: %v", zk.superSpec.Name(), zk.spec.Prefix, err)
 	}
 
 	instances := make(map[string]*serviceregistry.ServiceInstanceSpec)
-	for _, child := range children {
-		fullPath := zk.fullPathOfChild(child)
-		data, _, err := client.Get(fullPath)
+	for _, service := range services {
+		serviceInstances, err := zk.listServiceInstances(client, service)
 		if err != nil {
-			return nil, fmt.Errorf("%s get child path %s failed: %v", zk.superSpec.Name(), fullPath, err)
+			return nil, err
+		}
+		for k, v := range serviceInstances {
+			instances[k] = v
 		}
+	}
 
-		instance := &serviceregistry.ServiceInstanceSpec{}
-		err = codectool.Unmarshal(data, instance)
-		if err != nil {
-			return nil, fmt.Errorf("%s unmarshal fullpath %s to json failed: %v", zk.superSpec.Name(), fullPath, err)
+	return instances, nil
+}
+
+// watch watches the children of the prefix and the services in the
+// background, and notifies the returned channel on changes, so that
+// registrations are picked up without waiting for the next sync.
+func (zk *ZookeeperServiceRegistry) watch(retryInterval time.Duration) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+
+	go func() {
+		// watching records the paths being watched, a path is watched
+		// again only after its watch is fired, so the watches are not
+		// accumulated in the client.
+		watching := map[string]bool{}
+		fired := make(chan string, 16)
+
+		for {
+			var retry <-chan time.Time
+			if err := zk.setWatches(watching, fired); err != nil {
+				logger.Errorf("%s watch %s failed: %v", zk.superSpec.Name(), zk.spec.Prefix, err)
+				retry = time.After(retryInterval)
+			}
+
+			select {
+			case <-zk.done:
+				return
+			case <-retry:
+				continue
+			case p := <-fired:
+				delete(watching, p)
+			}
+
+			for drained := false; !drained; {
+				select {
+				case p := <-fired:
+					delete(watching, p)
+				default:
+					drained = true
+				}
+			}
+
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
 		}
+	}()
 
-		err = instance.Validate()
+	return changed
+}
+
+// setWatches sets the watches on the prefix and the services not in
+// watching, the path of a watch is sent to fired when it is fired.
+func (zk *ZookeeperServiceRegistry) setWatches(watching map[string]bool, fired chan<- string) error {
+	client, err := zk.getClient()
+	if err != nil {
+		return err
+	}
+
+	// every watch fires exactly once, either on change or on the close of
+	// the session, so the goroutines always exit.
+	wait := func(p string, ch <-chan zookeeper.Event) {
+		watching[p] = true
+		go func() {
+			<-ch
+			select {
+			case fired <- p:
+			case <-zk.done:
+			}
+		}()
+	}
+
+	var services []string
+	if watching[zk.spec.Prefix] {
+		services, _, err = client.Children(zk.spec.Prefix)
 		if err != nil {
-			return nil, fmt.Errorf("%s is invalid: %v", data, err)
+			return err
 		}
-
-		instances[instance.Key()] = instance
+	} else {
+		var ch <-chan zookeeper.Event
+		services, _, ch, err = client.ChildrenW(zk.spec.Prefix)
+		if err != nil {
+			return err
+		}
+		wait(zk.spec.Prefix, ch)
 	}
 
-	return instances, nil
-}
+	for _, service := range services {
+		p := zk.servicePath(service)
+		if watching[p] {
+			continue
+		}
+		_, _, ch, err := client.ChildrenW(p)
+		if err == zookeeper.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		wait(p, ch)
+	}
 
-func (zk *ZookeeperServiceRegistry) fullPathOfChild(childPath string) string {
-	return path.Join(zk.spec.Prefix, childPath)
+	return nil
 }
 
-func (zk *ZookeeperServiceRegistry) serviceZookeeperPrefix(serviceName string) string {
-	return path.Join(zk.spec.Prefix, serviceName) + "/"
+func (zk *ZookeeperServiceRegistry) servicePath(serviceName string) string {
+	return path.Join(zk.spec.Prefix, serviceName)
 }
 
 func (zk *ZookeeperServiceRegistry) serviceInstanceZookeeperPath(instance *serviceregistry.ServiceInstanceSpec) string {
@@ -62,6 +62,7 @@ type Options struct {
 	ConfigFile      string `yaml:"-"`
 	ForceNewCluster bool   `yaml:"-"`
 	SignalUpgrade   bool   `yaml:"-"`
+	SignalReload    bool   `yaml:"-"`
 
 	// If a config file is specified, below command line flags will be ignored.
 
@@ -75,9 +76,19 @@ type Options struct {
 	ClientCAFile             string            `yaml:"client-ca-file"`
 	Debug                    bool              `yaml:"debug"`
 	DisableAccessLog         bool              `yaml:"disable-access-log"`
+	LogFormat                string            `yaml:"log-format"`
+	LogMaxSize               int               `yaml:"log-max-size"`
+	LogRotateInterval        string            `yaml:"log-rotate-interval"`
+	LogMaxAge                string            `yaml:"log-max-age"`
+	LogMaxFiles              int               `yaml:"log-max-files"`
+	LogCompress              bool              `yaml:"log-compress"`
 	InitialObjectConfigFiles []string          `yaml:"initial-object-config-files"`
 	ObjectsDumpInterval      string            `yaml:"objects-dump-interval"`
 	BasicAuth                map[string]string `yaml:"basic-auth"`
+	EnableDebugAPI           bool              `yaml:"enable-debug-api"`
+	DisableDashboard         bool              `yaml:"disable-dashboard"`
+	ObjectPool               bool              `yaml:"object-pool"`
+	GOMAXPROCS               int               `yaml:"gomaxprocs"`
 
 	// cluster options
 	UseStandaloneEtcd     bool           `yaml:"use-standalone-etcd"`
@@ -138,6 +149,7 @@ func New() *Options {
 	opt.flags.StringVarP(&opt.ConfigFile, "config-file", "f", "", "Load server configuration from a file(yaml format), other command line flags will be ignored if specified.")
 	opt.flags.BoolVar(&opt.ForceNewCluster, "force-new-cluster", false, "Force to create a new one-member cluster.")
 	opt.flags.BoolVar(&opt.SignalUpgrade, "signal-upgrade", false, "Send an upgrade signal to the server based on the local pid file, then exit. The original server will start a graceful upgrade after signal received.")
+	opt.flags.BoolVar(&opt.SignalReload, "signal-reload", false, "Send a reload signal to the server based on the local pid file, then exit. The original server will reload the options which could be changed at runtime after signal received.")
 	opt.flags.StringVar(&opt.Name, "name", "eg-default-name", "Human-readable name for this member.")
 	opt.flags.StringToStringVar(&opt.Labels, "labels", nil, "The labels for the instance of Easegress.")
 	opt.flags.BoolVar(&opt.UseStandaloneEtcd, "use-standalone-etcd", false, "Use standalone etcd instead of embedded .")
@@ -147,9 +159,19 @@ func New() *Options {
 	opt.flags.StringVar(&opt.CertFile, "cert-file", "", "Flag to set the certificate file for https.")
 	opt.flags.StringVar(&opt.KeyFile, "key-file", "", "Flag to set the private key file for https.")
 	opt.flags.BoolVar(&opt.Debug, "debug", false, "Flag to set lowest log level from INFO downgrade DEBUG.")
+	opt.flags.BoolVar(&opt.EnableDebugAPI, "enable-debug-api", false, "Flag to enable the pprof and diagnostics APIs under /debug of the admin API.")
+	opt.flags.BoolVar(&opt.DisableDashboard, "disable-dashboard", false, "Flag to disable the web dashboard at /apis/v2/dashboard of the admin API.")
+	opt.flags.BoolVar(&opt.ObjectPool, "object-pool", false, "Flag to reuse the objects allocated for every request, like the contexts and the header maps, to reduce the GC pressure at high RPS.")
+	opt.flags.IntVar(&opt.GOMAXPROCS, "gomaxprocs", 0, "The max number of CPUs executing Go code simultaneously, 0 means to size it by the CPU quota of the container, and a negative number means to use the default of Go.")
 	opt.flags.StringSliceVar(&opt.InitialObjectConfigFiles, "initial-object-config-files", nil, "List of configuration files for initial objects, these objects will be created at startup if not already exist.")
 	opt.flags.StringVar(&opt.ObjectsDumpInterval, "objects-dump-interval", "", "The time interval to dump running objects config, for example: 30m")
 	opt.flags.BoolVar(&opt.DisableAccessLog, "disable-access", false, "Flag to set whether to disable access logs")
+	opt.flags.StringVar(&opt.LogFormat, "log-format", "text", "Format of the system logs (text, json).")
+	opt.flags.IntVar(&opt.LogMaxSize, "log-max-size", 0, "The max size in megabytes of a log file before it is rotated, 0 means no limit.")
+	opt.flags.StringVar(&opt.LogRotateInterval, "log-rotate-interval", "", "The time interval to rotate the log files, for example: 24h")
+	opt.flags.StringVar(&opt.LogMaxAge, "log-max-age", "", "The max time to keep the rotated log files, for example: 168h")
+	opt.flags.IntVar(&opt.LogMaxFiles, "log-max-files", 0, "The max number of the rotated files to keep for each log file, 0 means no limit.")
+	opt.flags.BoolVar(&opt.LogCompress, "log-compress", false, "Flag to compress the rotated log files with gzip.")
 	opt.flags.StringVar(&opt.HomeDir, "home-dir", "./", "Path to the home directory.")
 	opt.flags.StringVar(&opt.DataDir, "data-dir", "data", "Path to the data directory.")
 	opt.flags.StringVar(&opt.WALDir, "wal-dir", "", "Path to the WAL directory.")
@@ -351,6 +373,31 @@ func (opt *Options) validate() error {
 		return fmt.Errorf("empty cert file or key file")
 	}
 
+	// log
+	switch opt.LogFormat {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("invalid log-format: supported formats are text/json")
+	}
+	if opt.LogMaxSize < 0 {
+		return fmt.Errorf("invalid log-max-size: must not be negative")
+	}
+	if opt.LogMaxFiles < 0 {
+		return fmt.Errorf("invalid log-max-files: must not be negative")
+	}
+	if opt.LogRotateInterval != "" {
+		d, err := time.ParseDuration(opt.LogRotateInterval)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid log-rotate-interval: %s", opt.LogRotateInterval)
+		}
+	}
+	if opt.LogMaxAge != "" {
+		d, err := time.ParseDuration(opt.LogMaxAge)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid log-max-age: %s", opt.LogMaxAge)
+		}
+	}
+
 	// profile: nothing to validate
 
 	// meta
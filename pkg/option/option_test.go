@@ -203,3 +203,28 @@ func TestOption(t *testing.T) {
 		assert.Equal("http://localhost:2379", urls)
 	}
 }
+
+func TestReload(t *testing.T) {
+	assert := assert.New(t)
+	options := New()
+	assert.NoError(options.Parse())
+
+	changed, restartRequired, err := options.Reload()
+	assert.NoError(err)
+	assert.Empty(changed)
+	assert.False(restartRequired)
+
+	options.Debug = true
+	options.Labels = map[string]string{"zone": "a"}
+	options.APIAddr = "localhost:12381"
+	changed, restartRequired, err = options.Reload()
+	assert.NoError(err)
+	assert.Equal([]string{"debug", "labels"}, changed)
+	assert.True(restartRequired)
+	assert.False(options.Snapshot().Debug)
+	assert.Empty(options.Snapshot().Labels)
+	assert.Equal("localhost:12381", options.APIAddr)
+
+	assert.True(sameStringMap(nil, map[string]string{}))
+	assert.False(sameStringMap(map[string]string{"a": "1"}, map[string]string{"a": "2"}))
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package option
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+// reloadMutex protects the options reloaded at runtime, the reads of them
+// out of the main goroutine should go through Snapshot.
+var reloadMutex sync.RWMutex
+
+// Snapshot returns a copy of the options, which is consistent with the
+// concurrent reloads.
+func (opt *Options) Snapshot() Options {
+	reloadMutex.RLock()
+	defer reloadMutex.RUnlock()
+	return *opt
+}
+
+// Reload parses the options again, from the command line flags, the
+// environment variables and the config file, and applies the ones safe to
+// change at runtime: debug, labels, gomaxprocs and basic-auth. It returns
+// the names of the applied options which are changed, and whether the
+// other options are changed, which take effect only after restart.
+func (opt *Options) Reload() (changed []string, restartRequired bool, err error) {
+	next := New()
+	if err := next.Parse(); err != nil {
+		return nil, false, err
+	}
+
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	if next.Debug != opt.Debug {
+		opt.Debug = next.Debug
+		changed = append(changed, "debug")
+	}
+	if !sameStringMap(next.Labels, opt.Labels) {
+		opt.Labels = next.Labels
+		changed = append(changed, "labels")
+	}
+	if next.GOMAXPROCS != opt.GOMAXPROCS {
+		opt.GOMAXPROCS = next.GOMAXPROCS
+		changed = append(changed, "gomaxprocs")
+	}
+	if !sameStringMap(next.BasicAuth, opt.BasicAuth) {
+		opt.BasicAuth = next.BasicAuth
+		changed = append(changed, "basic-auth")
+	}
+
+	buff, err := codectool.MarshalYAML(opt)
+	if err != nil {
+		return changed, false, fmt.Errorf("marshal config to yaml failed: %v", err)
+	}
+	opt.yamlStr = string(buff)
+
+	return changed, opt.yamlStr != next.yamlStr, nil
+}
+
+func sameStringMap(x, y map[string]string) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for k, v := range x {
+		if w, ok := y[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
@@ -209,6 +209,12 @@ func (r *Request) Context() context.Context {
 	return r.ctx
 }
 
+// SetContext sets the context of the request, ctx should be derived from
+// the current context of the request.
+func (r *Request) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
 // FullMethod returns full method name of the grpc request.
 // The returned string is in the format of "/service/method"
 func (r *Request) FullMethod() string {
@@ -24,6 +24,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/protocols"
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
 )
@@ -31,6 +32,22 @@ import (
 // DefaultMaxPayloadSize is the default max allowed payload size.
 const DefaultMaxPayloadSize = 4 * 1024 * 1024
 
+var (
+	// ResponseWriterDataKey is the key of the task data where the
+	// HTTPServer stores the response writer of the request.
+	ResponseWriterDataKey = context.NewDataKey[http.ResponseWriter]("", "HTTP_RESPONSE_WRITER")
+	// RouteCapturesDataKey is the key of the task data where the HTTPServer
+	// stores the path parameters captured by the router.
+	RouteCapturesDataKey = context.NewDataKey[map[string]string]("", "HTTP_ROUTE_CAPTURES")
+	// UpstreamDataKey is the key of the task data where the proxy filters
+	// store the URL of the server the request is sent to.
+	UpstreamDataKey = context.NewDataKey[string]("", "HTTP_UPSTREAM")
+	// StreamResponseDataKey is the key of the task data where the
+	// HTTPServer tells the proxy filters to stream the response payload,
+	// because no filter of the pipeline needs the whole payload.
+	StreamResponseDataKey = context.NewDataKey[bool]("", "HTTP_STREAM_RESPONSE")
+)
+
 func init() {
 	protocols.Register("http", &Protocol{})
 }
@@ -107,6 +124,42 @@ func (p *Protocol) CreateResponse(resp interface{}) (protocols.Response, error)
 	return NewResponse(r)
 }
 
+// jsonPayload is the result of parsing a payload as JSON.
+type jsonPayload struct {
+	value interface{}
+	err   error
+}
+
+// get returns a deep copy of the parsed value, so the callers could modify
+// it without affecting each other.
+func (p *jsonPayload) get() (interface{}, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return copyJSONValue(p.value), nil
+}
+
+// copyJSONValue returns a deep copy of a value decoded from JSON, the
+// objects and the arrays are copied, the others are immutable.
+func copyJSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = copyJSONValue(e)
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, e := range v {
+			a[i] = copyJSONValue(e)
+		}
+		return a
+	default:
+		return v
+	}
+}
+
 func parseJSONBody(body []byte) (interface{}, error) {
 	var v interface{}
 	d := json.NewDecoder(bytes.NewReader(body))
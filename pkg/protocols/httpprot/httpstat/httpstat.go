@@ -20,50 +20,85 @@ package httpstat
 
 import (
 	"math"
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	metrics "github.com/rcrowley/go-metrics"
 
+	"github.com/megaease/easegress/v2/pkg/context"
 	"github.com/megaease/easegress/v2/pkg/util/codecounter"
 	"github.com/megaease/easegress/v2/pkg/util/easemonitor"
 	"github.com/megaease/easegress/v2/pkg/util/sampler"
 )
 
+// MetricDataKey is the key of the task data where the proxies store the
+// metric of the request, which is reported by the HTTPServer.
+var MetricDataKey = context.NewDataKey[*Metric]("", "HTTP_METRIC")
+
+// maxShards is the max number of the shards of the counters.
+const maxShards = 32
+
 type (
 	// HTTPStat is the statistics tool for HTTP traffic.
+	//
+	// The counters are sharded to avoid the contention of the concurrent
+	// updates, a goroutine updates the shard cached by its processor in
+	// shardPool, and Status sums up the shards.
 	HTTPStat struct {
-		mutex sync.RWMutex
+		shards    []counterShard
+		shardPool sync.Pool
+		nextShard uint32
+
+		// statusMutex serializes the calls to Status, which feeds the
+		// EWMAs with the increments of the counts since the last call.
+		statusMutex  sync.Mutex
+		lastCount    uint64
+		lastErrCount uint64
 
-		count  uint64
 		rate1  metrics.EWMA
 		rate5  metrics.EWMA
 		rate15 metrics.EWMA
 
-		errCount  uint64
 		errRate1  metrics.EWMA
 		errRate5  metrics.EWMA
 		errRate15 metrics.EWMA
 
-		total uint64
-		min   uint64
-		max   uint64
-
 		durationSampler *sampler.DurationSampler
 
-		reqSize  uint64
-		respSize uint64
+		// the sketches are flushed by Status, so they have the values
+		// since the last call.
+		reqSizeSketch   *sampler.Sketch
+		respSizeSketch  *sampler.Sketch
+		firstByteSketch *sampler.Sketch
+		durationSketch  *sampler.Sketch
 
 		cc *codecounter.HTTPStatusCodeCounter
 	}
 
+	// counterShard is a shard of the counters, it is padded to a cache
+	// line to avoid false sharing.
+	counterShard struct {
+		count    uint64
+		errCount uint64
+		total    uint64
+		min      uint64
+		max      uint64
+		reqSize  uint64
+		respSize uint64
+		_        [8]byte
+	}
+
 	// Metric is the package of statistics at once.
 	Metric struct {
 		StatusCode int
 		Duration   time.Duration
-		ReqSize    uint64
-		RespSize   uint64
+		// FirstByte is the duration until the response starts to be sent,
+		// it is the same as Duration if it is zero.
+		FirstByte time.Duration
+		ReqSize   uint64
+		RespSize  uint64
 	}
 
 	// RequestMetric contains request metrics.
@@ -104,10 +139,23 @@ type (
 		Count uint64 `json:"cnt"`
 	}
 
+	// Sketches are the mergeable histograms of the requests since the
+	// last status, the sketches of the members are merged to compute the
+	// percentiles of the whole cluster. A sketch is nil if it is empty.
+	Sketches struct {
+		// ReqSize and RespSize are in bytes.
+		ReqSize  *sampler.SketchData `json:"reqSize,omitempty"`
+		RespSize *sampler.SketchData `json:"respSize,omitempty"`
+		// FirstByte and Duration are in milliseconds.
+		FirstByte *sampler.SketchData `json:"firstByte,omitempty"`
+		Duration  *sampler.SketchData `json:"duration,omitempty"`
+	}
+
 	// Status contains all status generated by HTTPStat.
 	Status struct {
 		RequestMetric
-		Codes map[int]uint64 `json:"codes"`
+		Codes    map[int]uint64 `json:"codes"`
+		Sketches *Sketches      `json:"sketches,omitempty"`
 	}
 )
 
@@ -117,7 +165,14 @@ func (m *Metric) isErr() bool {
 
 // New creates an HTTPStat.
 func New() *HTTPStat {
+	n := runtime.GOMAXPROCS(0)
+	if n > maxShards {
+		n = maxShards
+	}
+
 	hs := &HTTPStat{
+		shards: make([]counterShard, n),
+
 		rate1:  metrics.NewEWMA1(),
 		rate5:  metrics.NewEWMA5(),
 		rate15: metrics.NewEWMA15(),
@@ -126,71 +181,135 @@ func New() *HTTPStat {
 		errRate5:  metrics.NewEWMA5(),
 		errRate15: metrics.NewEWMA15(),
 
-		min:             math.MaxUint64,
 		durationSampler: sampler.NewDurationSampler(),
 
+		reqSizeSketch:   sampler.NewSketch(),
+		respSizeSketch:  sampler.NewSketch(),
+		firstByteSketch: sampler.NewSketch(),
+		durationSketch:  sampler.NewSketch(),
+
 		cc: codecounter.New(),
 	}
+	for i := range hs.shards {
+		hs.shards[i].min = math.MaxUint64
+	}
+
+	// the pool caches a shard for every processor, and a shard is shared
+	// by the processors if there are more processors than shards.
+	hs.shardPool.New = func() interface{} {
+		i := atomic.AddUint32(&hs.nextShard, 1)
+		return &hs.shards[int(i)%len(hs.shards)]
+	}
 
 	return hs
 }
 
-// Stat stats the ctx.
+// Stat stats the ctx, it could be called concurrently without locks.
 func (hs *HTTPStat) Stat(m *Metric) {
-	// Note: although this is a data update operation, we are using the RLock here,
-	// which means goroutines can execute this function concurrently, and contentions
-	// are handled by the atomic operations for each item.
-	//
-	// This lock is only a mutex for the 'Status' function below.
-	hs.mutex.RLock()
-	defer hs.mutex.RUnlock()
-
-	atomic.AddUint64(&hs.count, 1)
-	hs.rate1.Update(1)
-	hs.rate5.Update(1)
-	hs.rate15.Update(1)
+	s := hs.shardPool.Get().(*counterShard)
 
+	atomic.AddUint64(&s.count, 1)
 	if m.isErr() {
-		atomic.AddUint64(&hs.errCount, 1)
-		hs.errRate1.Update(1)
-		hs.errRate5.Update(1)
-		hs.errRate15.Update(1)
+		atomic.AddUint64(&s.errCount, 1)
 	}
 
 	duration := uint64(m.Duration.Milliseconds())
-	atomic.AddUint64(&hs.total, duration)
+	atomic.AddUint64(&s.total, duration)
 	for {
-		min := atomic.LoadUint64(&hs.min)
+		min := atomic.LoadUint64(&s.min)
 		if duration >= min {
 			break
 		}
-		if atomic.CompareAndSwapUint64(&hs.min, min, duration) {
+		if atomic.CompareAndSwapUint64(&s.min, min, duration) {
 			break
 		}
 	}
 	for {
-		max := atomic.LoadUint64(&hs.max)
+		max := atomic.LoadUint64(&s.max)
 		if duration <= max {
 			break
 		}
-		if atomic.CompareAndSwapUint64(&hs.max, max, duration) {
+		if atomic.CompareAndSwapUint64(&s.max, max, duration) {
 			break
 		}
 	}
 
-	hs.durationSampler.Update(m.Duration)
+	atomic.AddUint64(&s.reqSize, m.ReqSize)
+	atomic.AddUint64(&s.respSize, m.RespSize)
 
-	atomic.AddUint64(&hs.reqSize, m.ReqSize)
-	atomic.AddUint64(&hs.respSize, m.RespSize)
+	hs.shardPool.Put(s)
 
+	hs.durationSampler.Update(m.Duration)
 	hs.cc.Count(m.StatusCode)
+
+	firstByte := m.FirstByte
+	if firstByte == 0 {
+		firstByte = m.Duration
+	}
+	hs.reqSizeSketch.Add(float64(m.ReqSize))
+	hs.respSizeSketch.Add(float64(m.RespSize))
+	hs.firstByteSketch.Add(float64(firstByte) / float64(time.Millisecond))
+	hs.durationSketch.Add(float64(m.Duration) / float64(time.Millisecond))
+}
+
+// flushSketches flushes the sketches, it returns nil if they are all empty.
+func (hs *HTTPStat) flushSketches() *Sketches {
+	s := &Sketches{
+		ReqSize:   hs.reqSizeSketch.Flush(),
+		RespSize:  hs.respSizeSketch.Flush(),
+		FirstByte: hs.firstByteSketch.Flush(),
+		Duration:  hs.durationSketch.Flush(),
+	}
+	if s.ReqSize == nil && s.RespSize == nil && s.FirstByte == nil && s.Duration == nil {
+		return nil
+	}
+	return s
+}
+
+// sum sums up the counters of the shards.
+func (hs *HTTPStat) sum() *counterShard {
+	total := &counterShard{min: math.MaxUint64}
+	for i := range hs.shards {
+		s := &hs.shards[i]
+		total.count += atomic.LoadUint64(&s.count)
+		total.errCount += atomic.LoadUint64(&s.errCount)
+		total.total += atomic.LoadUint64(&s.total)
+		if min := atomic.LoadUint64(&s.min); min < total.min {
+			total.min = min
+		}
+		if max := atomic.LoadUint64(&s.max); max > total.max {
+			total.max = max
+		}
+		total.reqSize += atomic.LoadUint64(&s.reqSize)
+		total.respSize += atomic.LoadUint64(&s.respSize)
+	}
+	return total
 }
 
 // Status returns HTTPStat Status, It assumes it is called every five seconds.
 // https://github.com/rcrowley/go-metrics/blob/3113b8401b8a98917cde58f8bbd42a1b1c03b1fd/ewma.go#L98-L99
 func (hs *HTTPStat) Status() *Status {
-	hs.mutex.Lock()
-	defer hs.mutex.Unlock()
+	hs.statusMutex.Lock()
+	defer hs.statusMutex.Unlock()
+
+	sum := hs.sum()
+
+	// the counts may be summed while they are being updated, so the
+	// increments are never negative.
+	if sum.count > hs.lastCount {
+		n := int64(sum.count - hs.lastCount)
+		hs.rate1.Update(n)
+		hs.rate5.Update(n)
+		hs.rate15.Update(n)
+		hs.lastCount = sum.count
+	}
+	if sum.errCount > hs.lastErrCount {
+		n := int64(sum.errCount - hs.lastErrCount)
+		hs.errRate1.Update(n)
+		hs.errRate5.Update(n)
+		hs.errRate15.Update(n)
+		hs.lastErrCount = sum.errCount
+	}
 
 	hs.rate1.Tick()
 	hs.rate5.Tick()
@@ -219,18 +338,18 @@ func (hs *HTTPStat) Status() *Status {
 	hs.cc.Reset()
 
 	mean, min := uint64(0), uint64(0)
-	if hs.count > 0 {
-		mean = hs.total / hs.count
-		min = hs.min
+	if sum.count > 0 {
+		mean = sum.total / sum.count
+		min = sum.min
 	}
 	status := &Status{
 		RequestMetric: RequestMetric{
-			Count: hs.count,
+			Count: sum.count,
 			M1:    m1,
 			M5:    m5,
 			M15:   m15,
 
-			ErrCount: hs.errCount,
+			ErrCount: sum.errCount,
 			M1Err:    m1Err,
 			M5Err:    m5Err,
 			M15Err:   m15Err,
@@ -241,7 +360,7 @@ func (hs *HTTPStat) Status() *Status {
 
 			Min:  min,
 			Mean: mean,
-			Max:  hs.max,
+			Max:  sum.max,
 
 			P25:  percentiles[0],
 			P50:  percentiles[1],
@@ -251,11 +370,12 @@ func (hs *HTTPStat) Status() *Status {
 			P99:  percentiles[5],
 			P999: percentiles[6],
 
-			ReqSize:  hs.reqSize,
-			RespSize: hs.respSize,
+			ReqSize:  sum.reqSize,
+			RespSize: sum.respSize,
 		},
 
-		Codes: codes,
+		Codes:    codes,
+		Sketches: hs.flushSketches(),
 	}
 
 	return status
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package httpstat
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPStat(t *testing.T) {
+	assert := assert.New(t)
+
+	hs := New()
+	s := hs.Status()
+	assert.Equal(uint64(0), s.Count)
+	assert.Equal(uint64(0), s.Min)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				code := 200
+				if j%10 == 0 {
+					code = 500
+				}
+				hs.Stat(&Metric{
+					StatusCode: code,
+					Duration:   time.Duration(i*10+1) * time.Millisecond,
+					ReqSize:    10,
+					RespSize:   100,
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	s = hs.Status()
+	assert.Equal(uint64(8000), s.Count)
+	assert.Equal(uint64(800), s.ErrCount)
+	assert.Equal(uint64(1), s.Min)
+	assert.Equal(uint64(71), s.Max)
+	assert.Equal(uint64(36), s.Mean)
+	assert.Equal(uint64(80000), s.ReqSize)
+	assert.Equal(uint64(800000), s.RespSize)
+	assert.Equal(map[int]uint64{200: 7200, 500: 800}, s.Codes)
+	assert.Greater(s.M1, 0.0)
+	assert.Greater(s.M1Err, 0.0)
+	assert.Equal(uint64(8000), s.Sketches.Duration.Count)
+	assert.InEpsilon(71.0, s.Sketches.Duration.Quantile(1), 0.02)
+	assert.InEpsilon(100.0, s.Sketches.RespSize.Quantile(0.5), 0.02)
+	// the first byte duration is the same as the duration if not set.
+	assert.Equal(s.Sketches.Duration, s.Sketches.FirstByte)
+
+	// the counts are accumulated, while the codes are reset.
+	hs.Stat(&Metric{StatusCode: 200, Duration: time.Millisecond})
+	s = hs.Status()
+	assert.Equal(uint64(8001), s.Count)
+	assert.Equal(map[int]uint64{200: 1}, s.Codes)
+	assert.Equal(uint64(1), s.Sketches.Duration.Count)
+
+	hs.Stat(&Metric{StatusCode: 200, Duration: time.Second, FirstByte: 10 * time.Millisecond})
+	s = hs.Status()
+	assert.InEpsilon(10.0, s.Sketches.FirstByte.Quantile(0.5), 0.02)
+	assert.InEpsilon(1000.0, s.Sketches.Duration.Quantile(0.5), 0.02)
+
+	assert.Nil(hs.Status().Sketches)
+}
+
+func BenchmarkHTTPStat(b *testing.B) {
+	hs := New()
+	m := &Metric{StatusCode: 200, Duration: 10 * time.Millisecond, ReqSize: 100, RespSize: 1000}
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			hs.Stat(m)
+		}
+	})
+}
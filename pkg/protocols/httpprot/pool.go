@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package httpprot
+
+import (
+	"net/http"
+	"sync"
+)
+
+// PooledHeader is a copy of an http.Header whose memory is reused by the
+// following copies after it is released.
+type PooledHeader struct {
+	Header http.Header
+	values []string
+}
+
+var headerPool = sync.Pool{
+	New: func() interface{} {
+		return &PooledHeader{Header: http.Header{}}
+	},
+}
+
+// AcquireHeader returns a copy of h from the pool, it is like h.Clone but
+// reuses the memory of the released copies. The caller should call Release
+// after the copy is no longer referenced, by itself or the http.Client.
+func AcquireHeader(h http.Header) *PooledHeader {
+	ph := headerPool.Get().(*PooledHeader)
+
+	n := 0
+	for _, vv := range h {
+		n += len(vv)
+	}
+	if cap(ph.values) < n {
+		ph.values = make([]string, 0, n)
+	}
+
+	for k, vv := range h {
+		if vv == nil {
+			// preserve nil values, which suppress the default headers.
+			ph.Header[k] = nil
+			continue
+		}
+		start := len(ph.values)
+		ph.values = append(ph.values, vv...)
+		// limit the capacity, so appending to the values of a key doesn't
+		// overwrite the values of the next key.
+		ph.Header[k] = ph.values[start:len(ph.values):len(ph.values)]
+	}
+	return ph
+}
+
+// Release puts the copy back to the pool, it must not be used after that.
+func (ph *PooledHeader) Release() {
+	clear(ph.Header)
+	clear(ph.values)
+	ph.values = ph.values[:0]
+	headerPool.Put(ph)
+}
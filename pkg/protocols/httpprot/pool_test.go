@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package httpprot
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPooledHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	h := http.Header{}
+	h.Add("X-A", "a1")
+	h.Add("X-A", "a2")
+	h.Set("X-B", "b")
+	h["X-Nil"] = nil
+
+	ph := AcquireHeader(h)
+	assert.Equal(h, ph.Header)
+
+	// the copy is independent of the source.
+	ph.Header.Add("X-A", "a3")
+	ph.Header.Set("X-B", "b2")
+	assert.Equal([]string{"a1", "a2"}, h.Values("X-A"))
+	assert.Equal([]string{"a1", "a2", "a3"}, ph.Header.Values("X-A"))
+	assert.Equal("b", h.Get("X-B"))
+	ph.Release()
+
+	ph = AcquireHeader(http.Header{"X-C": {"c"}})
+	assert.Equal(http.Header{"X-C": {"c"}}, ph.Header)
+	ph.Release()
+}
+
+func BenchmarkHeaderClone(b *testing.B) {
+	h := http.Header{}
+	for _, k := range []string{"Accept", "User-Agent", "Content-Type", "X-Request-Id", "Cookie"} {
+		h.Set(k, "value-of-"+k)
+	}
+
+	b.Run("Clone", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = h.Clone()
+		}
+	})
+	b.Run("Pool", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			AcquireHeader(h).Release()
+		}
+	})
+}
@@ -45,6 +45,7 @@ type Request struct {
 	stream  *readers.ByteCountReader
 	payload []byte
 	realIP  string
+	json    *jsonPayload
 }
 
 var (
@@ -143,6 +144,38 @@ func (r *Request) FetchPayload(maxPayloadSize int64) error {
 	return err
 }
 
+// FetchStreamPayload initializes the payload as a stream of the body of the
+// underlying http.Request without buffering it. Unlike FetchPayload with a
+// negative maxPayloadSize, the size of the payload is still limited: the
+// request is rejected if its content length is larger than maxPayloadSize,
+// and reading the stream fails with ErrRequestEntityTooLarge once more
+// than maxPayloadSize bytes are read.
+//
+// if maxPayloadSize is a negative number, the size is not limited.
+// if maxPayloadSize is zero, DefaultMaxPayloadSize is used.
+func (r *Request) FetchStreamPayload(maxPayloadSize int64) error {
+	if maxPayloadSize < 0 {
+		return r.FetchPayload(maxPayloadSize)
+	}
+	if maxPayloadSize == 0 {
+		maxPayloadSize = DefaultMaxPayloadSize
+	}
+
+	stdr := r.Request
+	if stdr.ContentLength > maxPayloadSize {
+		return ErrRequestEntityTooLarge
+	}
+	if stdr.ContentLength == 0 {
+		r.SetPayload(nil)
+		return nil
+	}
+
+	// the caller closes the body of an HTTP request, see FetchPayload.
+	body := io.NopCloser(stdr.Body)
+	r.SetPayload(readers.NewLimitReader(body, maxPayloadSize, ErrRequestEntityTooLarge))
+	return nil
+}
+
 // SetPayload set the payload of the request to payload. The payload
 // could be a string, a byte slice, or an io.Reader, and if it is an
 // io.Reader, it will be treated as a stream, if this is not desired,
@@ -151,6 +184,7 @@ func (r *Request) FetchPayload(maxPayloadSize int64) error {
 func (r *Request) SetPayload(payload interface{}) {
 	r.stream = nil
 	r.payload = nil
+	r.json = nil
 
 	if payload == nil {
 		return
@@ -204,6 +238,21 @@ func (r *Request) PayloadSize() int64 {
 	return int64(r.stream.BytesRead())
 }
 
+// JSONPayload parses the payload as JSON and returns the result. The
+// payload is parsed on the first call only, and the parsed result is kept
+// until the payload is replaced, every caller gets a copy of it, so the
+// callers could modify the result freely.
+func (r *Request) JSONPayload() (interface{}, error) {
+	if r.stream != nil {
+		return nil, fmt.Errorf("the payload is a stream")
+	}
+	if r.json == nil {
+		v, err := parseJSONBody(r.payload)
+		r.json = &jsonPayload{value: v, err: err}
+	}
+	return r.json.get()
+}
+
 // ToBuilderRequest wraps the request and returns the wrapper, the
 // return value can be used in the template of the Builder filters.
 func (r *Request) ToBuilderRequest(name string) interface{} {
@@ -215,10 +264,14 @@ func (r *Request) ToBuilderRequest(name string) interface{} {
 		rawBody = r.RawPayload()
 	}
 
-	return &builderRequest{
+	br := &builderRequest{
 		Request: r.Std(),
 		rawBody: rawBody,
 	}
+	if !r.IsStream() {
+		br.parseJSON = r.JSONPayload
+	}
+	return br
 }
 
 // Close closes the request.
@@ -335,6 +388,11 @@ func (r *Request) Context() context.Context {
 	return r.Std().Context()
 }
 
+// SetContext sets the context of the request.
+func (r *Request) SetContext(ctx context.Context) {
+	r.Request = r.Request.WithContext(ctx)
+}
+
 // SetMethod sets the request method.
 func (r *Request) SetMethod(method string) {
 	r.Std().Method = method
@@ -366,6 +424,7 @@ type builderRequest struct {
 	*http.Request
 	rawBody    []byte
 	parsedBody interface{}
+	parseJSON  func() (interface{}, error)
 }
 
 // RawBody returns the body as raw bytes.
@@ -379,13 +438,22 @@ func (r *builderRequest) Body() string {
 }
 
 // JSONBody parses the body as a JSON object and returns the result.
-// The function only parses the body if it is not already parsed.
+// The function only parses the body if it is not already parsed, by
+// this wrapper or by any other user of the request.
 func (r *builderRequest) JSONBody() (interface{}, error) {
 	if r.parsedBody != nil {
 		return r.parsedBody, nil
 	}
 
-	v, err := parseJSONBody(r.rawBody)
+	var (
+		v   interface{}
+		err error
+	)
+	if r.parseJSON != nil {
+		v, err = r.parseJSON()
+	} else {
+		v, err = parseJSONBody(r.rawBody)
+	}
 	r.parsedBody = v
 	return v, err
 }
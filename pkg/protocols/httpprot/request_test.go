@@ -265,3 +265,68 @@ kind: Test
 		assert.Equal("Test", yamlMap["kind"])
 	}
 }
+
+func TestRequestJSONPayload(t *testing.T) {
+	assert := assert.New(t)
+
+	request := getRequest(t, http.MethodPost, "http://127.0.0.1:8888", strings.NewReader(`{"key":"value"}`))
+	assert.Nil(request.FetchPayload(10000))
+
+	v1, err := request.JSONPayload()
+	assert.Nil(err)
+	assert.Equal("value", v1.(map[string]interface{})["key"])
+
+	// every caller gets a copy of the parsed payload.
+	v2, err := request.ToBuilderRequest("a").(*builderRequest).JSONBody()
+	assert.Nil(err)
+	v1.(map[string]interface{})["key"] = "changed"
+	assert.Equal("value", v2.(map[string]interface{})["key"])
+	v3, _ := request.JSONPayload()
+	assert.Equal("value", v3.(map[string]interface{})["key"])
+
+	// replacing the payload discards the parsed one.
+	request.SetPayload("abc")
+	_, err = request.JSONPayload()
+	assert.NotNil(err)
+	request.SetPayload(`[1]`)
+	v1, err = request.JSONPayload()
+	assert.Nil(err)
+	assert.Len(v1, 1)
+
+	assert.Nil(request.FetchStreamPayload(10000))
+	_, err = request.JSONPayload()
+	assert.NotNil(err)
+}
+
+func TestRequestFetchStreamPayload(t *testing.T) {
+	assert := assert.New(t)
+
+	req := getRequest(t, http.MethodPost, "http://127.0.0.1:8888", strings.NewReader("123"))
+	assert.Nil(req.FetchStreamPayload(10))
+	assert.True(req.IsStream())
+	data, err := io.ReadAll(req.GetPayload())
+	assert.Nil(err)
+	assert.Equal("123", string(data))
+	assert.Equal(int64(3), req.PayloadSize())
+	req.Close()
+
+	// content length is larger than the limit.
+	req = getRequest(t, http.MethodPost, "http://127.0.0.1:8888", strings.NewReader("123"))
+	assert.Equal(ErrRequestEntityTooLarge, req.FetchStreamPayload(2))
+
+	// unknown content length, the error is returned when reading.
+	req = getRequest(t, http.MethodPost, "http://127.0.0.1:8888", strings.NewReader("123123"))
+	req.Std().ContentLength = -1
+	assert.Nil(req.FetchStreamPayload(4))
+	_, err = io.ReadAll(req.GetPayload())
+	assert.Equal(ErrRequestEntityTooLarge, err)
+
+	req = getRequest(t, http.MethodPost, "http://127.0.0.1:8888", http.NoBody)
+	req.Std().ContentLength = 0
+	assert.Nil(req.FetchStreamPayload(0))
+	assert.False(req.IsStream())
+
+	req = getRequest(t, http.MethodPost, "http://127.0.0.1:8888", strings.NewReader("123123"))
+	assert.Nil(req.FetchStreamPayload(-1))
+	assert.True(req.IsStream())
+}
@@ -42,6 +42,7 @@ type Response struct {
 	*http.Response
 	stream  *readers.ByteCountReader
 	payload []byte
+	json    *jsonPayload
 }
 
 // ErrResponseEntityTooLarge means the request entity is too large.
@@ -131,6 +132,34 @@ func (r *Response) FetchPayload(maxPayloadSize int64) error {
 	return err
 }
 
+// FetchStreamPayload initializes the payload as a stream of the body of the
+// underlying http.Response without buffering it. The size of the payload
+// is limited like FetchStreamPayload of Request, with the error
+// ErrResponseEntityTooLarge.
+//
+// if maxPayloadSize is a negative number, the size is not limited.
+// if maxPayloadSize is zero, DefaultMaxPayloadSize is used.
+func (r *Response) FetchStreamPayload(maxPayloadSize int64) error {
+	if maxPayloadSize < 0 {
+		return r.FetchPayload(maxPayloadSize)
+	}
+	if maxPayloadSize == 0 {
+		maxPayloadSize = DefaultMaxPayloadSize
+	}
+
+	stdr := r.Response
+	if stdr.ContentLength > maxPayloadSize {
+		return ErrResponseEntityTooLarge
+	}
+	if stdr.ContentLength == 0 {
+		r.SetPayload(nil)
+		return nil
+	}
+
+	r.SetPayload(readers.NewLimitReader(stdr.Body, maxPayloadSize, ErrResponseEntityTooLarge))
+	return nil
+}
+
 // SetPayload set the payload of the response to payload. The payload
 // could be a string, a byte slice, or an io.Reader, and if it is an
 // io.Reader, it will be treated as a stream, if this is not desired,
@@ -139,6 +168,7 @@ func (r *Response) FetchPayload(maxPayloadSize int64) error {
 func (r *Response) SetPayload(payload interface{}) {
 	r.stream = nil
 	r.payload = nil
+	r.json = nil
 
 	if payload == nil {
 		return
@@ -192,6 +222,21 @@ func (r *Response) PayloadSize() int64 {
 	return int64(r.stream.BytesRead())
 }
 
+// JSONPayload parses the payload as JSON and returns the result. The
+// payload is parsed on the first call only, and the parsed result is kept
+// until the payload is replaced, every caller gets a copy of it, so the
+// callers could modify the result freely.
+func (r *Response) JSONPayload() (interface{}, error) {
+	if r.stream != nil {
+		return nil, fmt.Errorf("the payload is a stream")
+	}
+	if r.json == nil {
+		v, err := parseJSONBody(r.payload)
+		r.json = &jsonPayload{value: v, err: err}
+	}
+	return r.json.get()
+}
+
 // ToBuilderResponse wraps the response and returns the wrapper, the
 // return value can be used in the template of the Builder filters.
 func (r *Response) ToBuilderResponse(name string) interface{} {
@@ -203,10 +248,14 @@ func (r *Response) ToBuilderResponse(name string) interface{} {
 		rawBody = r.RawPayload()
 	}
 
-	return &builderResponse{
+	br := &builderResponse{
 		Response: r.Std(),
 		rawBody:  rawBody,
 	}
+	if !r.IsStream() {
+		br.parseJSON = r.JSONPayload
+	}
+	return br
 }
 
 // Std returns the underlying http.Response.
@@ -295,6 +344,7 @@ type builderResponse struct {
 	*http.Response
 	rawBody    []byte
 	parsedBody interface{}
+	parseJSON  func() (interface{}, error)
 }
 
 // RawBody returns the body as raw bytes.
@@ -308,13 +358,22 @@ func (r *builderResponse) Body() string {
 }
 
 // JSONBody parses the body as a JSON object and returns the result.
-// The function only parses the body if it is not already parsed.
+// The function only parses the body if it is not already parsed, by
+// this wrapper or by any other user of the response.
 func (r *builderResponse) JSONBody() (interface{}, error) {
 	if r.parsedBody != nil {
 		return r.parsedBody, nil
 	}
 
-	v, err := parseJSONBody(r.rawBody)
+	var (
+		v   interface{}
+		err error
+	)
+	if r.parseJSON != nil {
+		v, err = r.parseJSON()
+	} else {
+		v, err = parseJSONBody(r.rawBody)
+	}
 	r.parsedBody = v
 	return v, err
 }
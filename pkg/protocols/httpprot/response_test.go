@@ -236,3 +236,38 @@ func TestBuilderResponse(t *testing.T) {
 		assert.NotNil(builderResp)
 	}
 }
+
+func TestResponseFetchStreamPayload(t *testing.T) {
+	assert := assert.New(t)
+
+	newResponse := func(body string, contentLength int64) *Response {
+		resp, err := NewResponse(&http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: contentLength,
+		})
+		assert.Nil(err)
+		return resp
+	}
+
+	resp := newResponse("123", 3)
+	assert.Nil(resp.FetchStreamPayload(10))
+	assert.True(resp.IsStream())
+	data, err := io.ReadAll(resp.GetPayload())
+	assert.Nil(err)
+	assert.Equal("123", string(data))
+	resp.Close()
+
+	resp = newResponse("123", 3)
+	assert.Equal(ErrResponseEntityTooLarge, resp.FetchStreamPayload(2))
+
+	resp = newResponse("123123", -1)
+	assert.Nil(resp.FetchStreamPayload(4))
+	_, err = io.ReadAll(resp.GetPayload())
+	assert.Equal(ErrResponseEntityTooLarge, err)
+
+	resp = newResponse("", 0)
+	assert.Nil(resp.FetchStreamPayload(0))
+	assert.False(resp.IsStream())
+}
@@ -20,32 +20,57 @@ package registry
 
 import (
 	// Filters
+	_ "github.com/megaease/easegress/v2/pkg/filters/accesslog"
+	_ "github.com/megaease/easegress/v2/pkg/filters/accessschedule"
+	_ "github.com/megaease/easegress/v2/pkg/filters/bodycapture"
 	_ "github.com/megaease/easegress/v2/pkg/filters/builder"
 	_ "github.com/megaease/easegress/v2/pkg/filters/certextractor"
+	_ "github.com/megaease/easegress/v2/pkg/filters/concurrencylimiter"
 	_ "github.com/megaease/easegress/v2/pkg/filters/connectcontrol"
 	_ "github.com/megaease/easegress/v2/pkg/filters/corsadaptor"
+	_ "github.com/megaease/easegress/v2/pkg/filters/datamasker"
+	_ "github.com/megaease/easegress/v2/pkg/filters/experimentassigner"
 	_ "github.com/megaease/easegress/v2/pkg/filters/fallback"
+	_ "github.com/megaease/easegress/v2/pkg/filters/featureflag"
 	_ "github.com/megaease/easegress/v2/pkg/filters/headerlookup"
 	_ "github.com/megaease/easegress/v2/pkg/filters/headertojson"
 	_ "github.com/megaease/easegress/v2/pkg/filters/kafka"
 	_ "github.com/megaease/easegress/v2/pkg/filters/kafkabackend"
+	_ "github.com/megaease/easegress/v2/pkg/filters/loadshedder"
+	_ "github.com/megaease/easegress/v2/pkg/filters/localqueuewriter"
 	_ "github.com/megaease/easegress/v2/pkg/filters/meshadaptor"
 	_ "github.com/megaease/easegress/v2/pkg/filters/mock"
 	_ "github.com/megaease/easegress/v2/pkg/filters/mqttclientauth"
+	_ "github.com/megaease/easegress/v2/pkg/filters/objectstoragewriter"
 	_ "github.com/megaease/easegress/v2/pkg/filters/oidcadaptor"
 	_ "github.com/megaease/easegress/v2/pkg/filters/opafilter"
+	_ "github.com/megaease/easegress/v2/pkg/filters/pathrewriter"
+	_ "github.com/megaease/easegress/v2/pkg/filters/protobufvalidator"
 	_ "github.com/megaease/easegress/v2/pkg/filters/proxies/grpcproxy"
 	_ "github.com/megaease/easegress/v2/pkg/filters/proxies/httpproxy"
+	_ "github.com/megaease/easegress/v2/pkg/filters/quota"
 	_ "github.com/megaease/easegress/v2/pkg/filters/ratelimiter"
 	_ "github.com/megaease/easegress/v2/pkg/filters/redirector"
 	_ "github.com/megaease/easegress/v2/pkg/filters/remotefilter"
+	_ "github.com/megaease/easegress/v2/pkg/filters/responsevalidator"
+	_ "github.com/megaease/easegress/v2/pkg/filters/samladaptor"
+	_ "github.com/megaease/easegress/v2/pkg/filters/scattergather"
+	_ "github.com/megaease/easegress/v2/pkg/filters/soapadaptor"
+	_ "github.com/megaease/easegress/v2/pkg/filters/spikearrest"
+	_ "github.com/megaease/easegress/v2/pkg/filters/subpipeline"
+	_ "github.com/megaease/easegress/v2/pkg/filters/tenantlimiter"
+	_ "github.com/megaease/easegress/v2/pkg/filters/tokenissuer"
 	_ "github.com/megaease/easegress/v2/pkg/filters/topicmapper"
 	_ "github.com/megaease/easegress/v2/pkg/filters/validator"
 	_ "github.com/megaease/easegress/v2/pkg/filters/wasmhost"
 
 	// Objects
+	_ "github.com/megaease/easegress/v2/pkg/object/alertmanager"
+	_ "github.com/megaease/easegress/v2/pkg/object/anomalydetector"
 	_ "github.com/megaease/easegress/v2/pkg/object/autocertmanager"
+	_ "github.com/megaease/easegress/v2/pkg/object/cloudmetrics"
 	_ "github.com/megaease/easegress/v2/pkg/object/consulserviceregistry"
+	_ "github.com/megaease/easegress/v2/pkg/object/dnsserviceregistry"
 	_ "github.com/megaease/easegress/v2/pkg/object/easemonitormetrics"
 	_ "github.com/megaease/easegress/v2/pkg/object/etcdserviceregistry"
 	_ "github.com/megaease/easegress/v2/pkg/object/eurekaserviceregistry"
@@ -55,13 +80,20 @@ import (
 	_ "github.com/megaease/easegress/v2/pkg/object/grpcserver"
 	_ "github.com/megaease/easegress/v2/pkg/object/httpserver"
 	_ "github.com/megaease/easegress/v2/pkg/object/ingresscontroller"
+	_ "github.com/megaease/easegress/v2/pkg/object/kubernetesserviceregistry"
+	_ "github.com/megaease/easegress/v2/pkg/object/localqueue"
 	_ "github.com/megaease/easegress/v2/pkg/object/meshcontroller"
 	_ "github.com/megaease/easegress/v2/pkg/object/mock"
 	_ "github.com/megaease/easegress/v2/pkg/object/mqttproxy"
 	_ "github.com/megaease/easegress/v2/pkg/object/nacosserviceregistry"
 	_ "github.com/megaease/easegress/v2/pkg/object/pipeline"
+	_ "github.com/megaease/easegress/v2/pkg/object/promremotewrite"
 	_ "github.com/megaease/easegress/v2/pkg/object/rawconfigtrafficcontroller"
+	_ "github.com/megaease/easegress/v2/pkg/object/scheduler"
+	_ "github.com/megaease/easegress/v2/pkg/object/slo"
+	_ "github.com/megaease/easegress/v2/pkg/object/tenantmanager"
 	_ "github.com/megaease/easegress/v2/pkg/object/trafficcontroller"
+	_ "github.com/megaease/easegress/v2/pkg/object/usagemeter"
 	_ "github.com/megaease/easegress/v2/pkg/object/zookeeperserviceregistry"
 
 	// Routers
@@ -117,6 +117,16 @@ type circuitBreakerWrapper struct {
 	*libcb.CircuitBreaker
 }
 
+// CircuitBreakerState returns the state of the circuit breaker wrapper
+// created by a CircuitBreakerPolicy, ok is false if w is not one.
+func CircuitBreakerState(w Wrapper) (state string, ok bool) {
+	cb, ok := w.(circuitBreakerWrapper)
+	if !ok {
+		return "", false
+	}
+	return cb.State().String(), true
+}
+
 // Wrap wraps the handler function.
 func (w circuitBreakerWrapper) Wrap(handler HandlerFunc) HandlerFunc {
 	return func(ctx context.Context) error {
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package supervisor
+
+import (
+	"reflect"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+// The states of a canary rollout.
+const (
+	// CanaryStateSoaking means the new spec runs on the canary members only.
+	CanaryStateSoaking = "soaking"
+	// CanaryStatePromoted means the new spec is applied to all members.
+	CanaryStatePromoted = "promoted"
+	// CanaryStateRolledBack means the canary members are back to the old spec.
+	CanaryStateRolledBack = "rolledBack"
+)
+
+// canaryConfig is the part of a canary rollout used by the object registry.
+type canaryConfig struct {
+	Spec     map[string]interface{} `json:"spec"`
+	BaseSpec map[string]interface{} `json:"baseSpec"`
+	Members  []string               `json:"members"`
+	State    string                 `json:"state"`
+}
+
+func (c *canaryConfig) hasMember(member string) bool {
+	for _, m := range c.Members {
+		if m == member {
+			return true
+		}
+	}
+	return false
+}
+
+// overrides reports whether the canary spec replaces the stable config of
+// the object. A promoted canary keeps replacing it until the promotion
+// reaches the stable config, so the canary members don't flap back to the
+// old spec in between.
+func (c *canaryConfig) overrides(stable string) bool {
+	switch c.State {
+	case CanaryStateSoaking:
+		return true
+	case CanaryStatePromoted:
+		m := map[string]interface{}{}
+		if err := codectool.UnmarshalJSON([]byte(stable), &m); err != nil {
+			return false
+		}
+		return reflect.DeepEqual(m, c.BaseSpec)
+	default:
+		return false
+	}
+}
+
+// parseCanaries returns the canary rollouts including the member, the key
+// is the name of the object.
+func parseCanaries(kvs map[string]string, prefix, member string) map[string]*canaryConfig {
+	canaries := make(map[string]*canaryConfig)
+	for k, v := range kvs {
+		name := k[len(prefix):]
+		c := &canaryConfig{}
+		if err := codectool.UnmarshalJSON([]byte(v), c); err != nil {
+			logger.Errorf("unmarshal canary of object %s failed: %v", name, err)
+			continue
+		}
+		if c.hasMember(member) {
+			canaries[name] = c
+		}
+	}
+	return canaries
+}
+
+// applyCanaries returns the config with the specs of the objects replaced by
+// their canary specs.
+func applyCanaries(config map[string]string, canaries map[string]*canaryConfig) map[string]string {
+	if len(canaries) == 0 {
+		return config
+	}
+
+	result := make(map[string]string, len(config))
+	for name, jsonConfig := range config {
+		result[name] = jsonConfig
+	}
+
+	for name, c := range canaries {
+		stable, exists := config[name]
+		if !exists || !c.overrides(stable) {
+			continue
+		}
+		data, err := codectool.MarshalJSON(c.Spec)
+		if err != nil {
+			logger.Errorf("marshal canary spec of object %s failed: %v", name, err)
+			continue
+		}
+		result[name] = string(data)
+	}
+
+	return result
+}
@@ -75,6 +75,18 @@ type (
 		configLocalPath       string
 		backupConfigLocalPath string
 
+		// config is the stable config in the cluster, it is nil before
+		// the first sync, and the canary rollouts including this member
+		// replace the specs of their objects in it, then the overrides of
+		// this member are applied.
+		config           map[string]string
+		canarySyncChan   <-chan map[string]string
+		canaryPrefix     string
+		canaries         map[string]*canaryConfig
+		overrideSyncChan <-chan map[string]string
+		overridePrefix   string
+		overrides        map[string]map[string]interface{}
+
 		mutex    sync.Mutex
 		entities map[string]*ObjectEntity
 		watchers map[string]*ObjectEntityWatcher
@@ -155,11 +167,27 @@ func newObjectRegistry(super *Supervisor, initObjs map[string]string, interval s
 		panic(fmt.Errorf("sync prefix %s failed: %v", prefix, err))
 	}
 
+	canaryPrefix := cls.Layout().CanaryPrefix()
+	canarySyncChan, err := syncer.SyncPrefix(canaryPrefix)
+	if err != nil {
+		panic(fmt.Errorf("sync prefix %s failed: %v", canaryPrefix, err))
+	}
+
+	overridePrefix := cls.Layout().OverridePrefix()
+	overrideSyncChan, err := syncer.SyncPrefix(overridePrefix)
+	if err != nil {
+		panic(fmt.Errorf("sync prefix %s failed: %v", overridePrefix, err))
+	}
+
 	or := &ObjectRegistry{
 		super:                 super,
 		configSyncer:          syncer,
 		configSyncChan:        syncChan,
 		configPrefix:          prefix,
+		canarySyncChan:        canarySyncChan,
+		canaryPrefix:          canaryPrefix,
+		overrideSyncChan:      overrideSyncChan,
+		overridePrefix:        overridePrefix,
 		configLocalPath:       filepath.Join(super.Options().AbsHomeDir, configFilePath),
 		backupConfigLocalPath: filepath.Join(super.Options().AbsHomeDir, backupdConfigFilePath),
 		entities:              make(map[string]*ObjectEntity),
@@ -183,12 +211,28 @@ func (or *ObjectRegistry) run() {
 				k = strings.TrimPrefix(k, or.configPrefix)
 				config[k] = v
 			}
-			or.applyConfig(config)
+			or.config = config
+			or.applyConfig(or.effectiveConfig())
 			or.storeConfigInLocal(config)
+		case kv := <-or.canarySyncChan:
+			or.canaries = parseCanaries(kv, or.canaryPrefix, or.super.Options().Name)
+			if or.config != nil {
+				or.applyConfig(or.effectiveConfig())
+			}
+		case kv := <-or.overrideSyncChan:
+			or.overrides = parseOverrides(kv, or.overridePrefix, or.super.Options().Name)
+			if or.config != nil {
+				or.applyConfig(or.effectiveConfig())
+			}
 		}
 	}
 }
 
+// effectiveConfig returns the config running on this member.
+func (or *ObjectRegistry) effectiveConfig() map[string]string {
+	return or.applyOverrides(applyCanaries(or.config, or.canaries))
+}
+
 func (or *ObjectRegistry) applyConfig(config map[string]string) {
 	or.mutex.Lock()
 	defer or.mutex.Unlock()
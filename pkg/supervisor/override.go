@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package supervisor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+// MergeOverride returns the spec with the override of a member applied as a
+// JSON merge patch: the maps are merged recursively, a null removes the
+// field, and any other value replaces it. The spec is not modified.
+func MergeOverride(spec, override map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(spec)+len(override))
+	for k, v := range spec {
+		result[k] = v
+	}
+
+	for k, v := range override {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+		patch, ok := v.(map[string]interface{})
+		if !ok {
+			result[k] = v
+			continue
+		}
+		origin, _ := result[k].(map[string]interface{})
+		result[k] = MergeOverride(origin, patch)
+	}
+
+	return result
+}
+
+// ValidateOverride checks the override doesn't change the identity of the
+// object, and only changes the overridable fields of its kind.
+func ValidateOverride(kind string, override map[string]interface{}) error {
+	for _, field := range []string{"name", "kind"} {
+		if _, exists := override[field]; exists {
+			return fmt.Errorf("%s can't be overridden", field)
+		}
+	}
+
+	o, ok := GetObject(kind).(Overridable)
+	if !ok {
+		return fmt.Errorf("kind %s can't be overridden", kind)
+	}
+	allowed := map[string]bool{}
+	for _, path := range o.OverridableFields() {
+		allowed[path] = true
+	}
+	return validateOverrideFields(override, "", allowed)
+}
+
+// validateOverrideFields checks every field in the override is allowed, or
+// is a map leading to the allowed fields.
+func validateOverrideFields(override map[string]interface{}, prefix string, allowed map[string]bool) error {
+	for k, v := range override {
+		path := prefix + k
+		if allowed[path] {
+			continue
+		}
+
+		patch, ok := v.(map[string]interface{})
+		if !ok || !hasAllowedField(path+".", allowed) {
+			return fmt.Errorf("%s can't be overridden", path)
+		}
+		if err := validateOverrideFields(patch, path+".", allowed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasAllowedField(prefix string, allowed map[string]bool) bool {
+	for path := range allowed {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseOverrides returns the overrides of the member, the key is the name of
+// the object.
+func parseOverrides(kvs map[string]string, prefix, member string) map[string]map[string]interface{} {
+	overrides := make(map[string]map[string]interface{})
+	for k, v := range kvs {
+		k = strings.TrimPrefix(k, prefix)
+		i := strings.LastIndex(k, "/")
+		if i < 0 || k[i+1:] != member {
+			continue
+		}
+
+		name := k[:i]
+		override := map[string]interface{}{}
+		if err := codectool.UnmarshalJSON([]byte(v), &override); err != nil {
+			logger.Errorf("unmarshal override of object %s failed: %v", name, err)
+			continue
+		}
+		overrides[name] = override
+	}
+	return overrides
+}
+
+// applyOverrides returns the config with the overrides of this member
+// applied. An override making the spec invalid is ignored, so the object
+// keeps running with the logical spec shared by all members.
+func (or *ObjectRegistry) applyOverrides(config map[string]string) map[string]string {
+	if len(or.overrides) == 0 {
+		return config
+	}
+
+	result := make(map[string]string, len(config))
+	for name, jsonConfig := range config {
+		result[name] = jsonConfig
+	}
+
+	for name, override := range or.overrides {
+		jsonConfig, exists := config[name]
+		if !exists {
+			continue
+		}
+
+		spec := map[string]interface{}{}
+		if err := codectool.UnmarshalJSON([]byte(jsonConfig), &spec); err != nil {
+			logger.Errorf("BUG: %s: %v", name, err)
+			continue
+		}
+		data, err := codectool.MarshalJSON(MergeOverride(spec, override))
+		if err != nil {
+			logger.Errorf("marshal overridden spec of object %s failed: %v", name, err)
+			continue
+		}
+		if _, err = or.super.NewSpec(string(data)); err != nil {
+			logger.Errorf("override of object %s is ignored: %v", name, err)
+			continue
+		}
+		result[name] = string(data)
+	}
+
+	return result
+}
@@ -95,6 +95,16 @@ type (
 		Inherit(superSpec *Spec, previousGeneration Object)
 	}
 
+	// Overridable is the object whose spec could be overridden on a member.
+	Overridable interface {
+		Object
+
+		// OverridableFields returns the dot separated paths of the fields
+		// depending on the host running the object, a path allows all the
+		// fields under it.
+		OverridableFields() []string
+	}
+
 	// ObjectCategory is the type to classify all objects.
 	ObjectCategory string
 )
@@ -20,6 +20,7 @@ package supervisor
 import (
 	"fmt"
 	"reflect"
+	"sort"
 	"time"
 
 	"github.com/megaease/easegress/v2/pkg/util/codectool"
@@ -50,6 +51,30 @@ type (
 		// RFC3339 format
 		CreatedAt string `json:"createdAt,omitempty"`
 	}
+
+	// Referrer is implemented by the object specs which reference other
+	// objects by name, like the HTTPServer referencing the pipelines in its
+	// rules.
+	Referrer interface {
+		// References returns the names of the referenced objects.
+		References() []string
+	}
+
+	// KindReferrer is implemented by the object specs which depend on the
+	// objects of a kind instead of the objects of names, like the
+	// HTTPServer using the certificates of the AutoCertManager.
+	KindReferrer interface {
+		// KindReferences returns the kinds of the referenced objects.
+		KindReferences() []string
+	}
+
+	// TemplateReferrer is implemented by the object specs which refer to
+	// the shared inline templates by name, like the error pages of the
+	// HTTPServer and the bodies of the Mock filters in a pipeline.
+	TemplateReferrer interface {
+		// TemplateReferences returns the names of the shared templates.
+		TemplateReferences() []string
+	}
 )
 
 func (s *Supervisor) newSpecInternal(meta *MetaSpec, objectSpec interface{}) *Spec {
@@ -189,6 +214,48 @@ func (s *Spec) ObjectSpec() interface{} {
 	return s.objectSpec
 }
 
+// References returns the sorted names of the objects referenced by the
+// object, duplicated and empty names are removed.
+func (s *Spec) References() []string {
+	r, ok := s.objectSpec.(Referrer)
+	if !ok {
+		return nil
+	}
+	return uniqueNames(r.References())
+}
+
+// TemplateReferences returns the sorted names of the shared templates
+// referenced by the object, without duplications.
+func (s *Spec) TemplateReferences() []string {
+	r, ok := s.objectSpec.(TemplateReferrer)
+	if !ok {
+		return nil
+	}
+	return uniqueNames(r.TemplateReferences())
+}
+
+// uniqueNames returns the sorted names without duplications and empty ones.
+func uniqueNames(names []string) []string {
+	var result []string
+	seen := map[string]bool{"": true}
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// KindReferences returns the kinds of the objects referenced by the object.
+func (s *Spec) KindReferences() []string {
+	if r, ok := s.objectSpec.(KindReferrer); ok {
+		return r.KindReferences()
+	}
+	return nil
+}
+
 // Equals compares two Specs.
 func (s *Spec) Equals(other *Spec) bool {
 	return reflect.DeepEqual(s.RawSpec(), other.RawSpec())
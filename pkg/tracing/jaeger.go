@@ -0,0 +1,112 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	jaegerHeader = "uber-trace-id"
+
+	jaegerFlagSampled = 0x01
+)
+
+// jaegerPropagator propagates the span context in the uber-trace-id header
+// of the Jaeger clients, whose value is {trace-id}:{span-id}:{parent-span-id}:{flags}.
+type jaegerPropagator struct{}
+
+var _ propagation.TextMapPropagator = jaegerPropagator{}
+
+// Inject injects the span context of ctx into carrier.
+func (jaegerPropagator) Inject(ctx context.Context, carrier propagation.TextMapCarrier) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	flags := 0
+	if sc.IsSampled() {
+		flags |= jaegerFlagSampled
+	}
+	// the parent span id is deprecated, and is always 0.
+	carrier.Set(jaegerHeader, fmt.Sprintf("%s:%s:0:%x", sc.TraceID(), sc.SpanID(), flags))
+}
+
+// Extract extracts the span context from carrier, ctx is returned as is if
+// the header is missing or invalid.
+func (jaegerPropagator) Extract(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	sc, err := parseJaegerHeader(carrier.Get(jaegerHeader))
+	if err != nil {
+		return ctx
+	}
+	return trace.ContextWithRemoteSpanContext(ctx, sc)
+}
+
+// Fields returns the header used by the propagator.
+func (jaegerPropagator) Fields() []string {
+	return []string{jaegerHeader}
+}
+
+func parseJaegerHeader(value string) (trace.SpanContext, error) {
+	// some clients escape the colons.
+	if v, err := url.QueryUnescape(value); err == nil {
+		value = v
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) != 4 {
+		return trace.SpanContext{}, fmt.Errorf("invalid %s: %q", jaegerHeader, value)
+	}
+
+	// the ids could be shorter than the standard length, as the leading
+	// zeros are omitted by some clients.
+	tid, sid := parts[0], parts[1]
+	if len(tid) == 0 || len(tid) > 32 || len(sid) == 0 || len(sid) > 16 {
+		return trace.SpanContext{}, fmt.Errorf("invalid %s: %q", jaegerHeader, value)
+	}
+	traceID, err := trace.TraceIDFromHex(strings.Repeat("0", 32-len(tid)) + tid)
+	if err != nil {
+		return trace.SpanContext{}, err
+	}
+	spanID, err := trace.SpanIDFromHex(strings.Repeat("0", 16-len(sid)) + sid)
+	if err != nil {
+		return trace.SpanContext{}, err
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return trace.SpanContext{}, err
+	}
+
+	cfg := trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+		Remote:  true,
+	}
+	if flags&jaegerFlagSampled != 0 {
+		cfg.TraceFlags = trace.FlagsSampled
+	}
+	return trace.NewSpanContext(cfg), nil
+}
@@ -52,7 +52,12 @@ type (
 		BatchLimits  *BatchLimitsSpec      `json:"batchLimits,omitempty"`
 		Exporter     *ExporterSpec         `json:"exporter,omitempty"`
 		Zipkin       *ZipkinDeprecatedSpec `json:"zipkin,omitempty"`
-		HeaderFormat headerFormat          `json:"headerFormat,omitempty" jsonschema:"default=trace-context,enum=trace-context,enum=b3"`
+		HeaderFormat headerFormat          `json:"headerFormat,omitempty" jsonschema:"default=trace-context,enum=trace-context,enum=b3,enum=b3multi,enum=jaeger"`
+
+		// ParentBased makes the spans continuing a trace from the clients
+		// follow the sampling decision of the clients, and SampleRate only
+		// applies to the new traces.
+		ParentBased bool `json:"parentBased,omitempty"`
 	}
 
 	// SpanLimitsSpec represents the limits of a span.
@@ -196,7 +201,11 @@ type (
 const (
 	// see: https://www.w3.org/TR/trace-context/
 	headerFormatTraceContext = "trace-context"
-	headerFormatB3           = "b3"
+	// see: https://github.com/openzipkin/b3-propagation
+	headerFormatB3      = "b3"
+	headerFormatB3Multi = "b3multi"
+	// see: https://www.jaegertracing.io/docs/client-libraries/#propagation-format
+	headerFormatJaeger = "jaeger"
 
 	jaegerModeAgent     jaegerMode = "agent"
 	jaegerModeCollector jaegerMode = "collector"
@@ -303,7 +312,7 @@ func New(spec *Spec) (*Tracer, error) {
 
 	opts := []sdktrace.TracerProviderOption{
 		sdktrace.WithRawSpanLimits(spec.newSpanLimits()),
-		sdktrace.WithSampler(spec.newSampler()),
+		sdktrace.WithSampler(spec.newParentBasedSampler()),
 	}
 
 	if r, err := spec.newResource(); err == nil {
@@ -359,6 +368,13 @@ func (spec *Spec) newSampler() sdktrace.Sampler {
 	return sdktrace.TraceIDRatioBased(sampleRate)
 }
 
+func (spec *Spec) newParentBasedSampler() sdktrace.Sampler {
+	if !spec.ParentBased {
+		return spec.newSampler()
+	}
+	return sdktrace.ParentBased(spec.newSampler())
+}
+
 func (spec *Spec) newSpanLimits() sdktrace.SpanLimits {
 	if spec.SpanLimits == nil {
 		return sdktrace.NewSpanLimits()
@@ -413,8 +429,14 @@ func (spec *Spec) newPropagator() propagation.TextMapPropagator {
 		format = headerFormatB3
 	}
 
-	if format == headerFormatB3 {
+	// the b3 propagators extract both the single and multiple headers.
+	switch format {
+	case headerFormatB3:
 		return b3.New(b3.WithInjectEncoding(b3.B3SingleHeader))
+	case headerFormatB3Multi:
+		return b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader))
+	case headerFormatJaeger:
+		return jaegerPropagator{}
 	}
 
 	return propagation.TraceContext{}
@@ -513,6 +535,9 @@ func (t *Tracer) NewSpanForHTTP(ctx context.Context, name string, req *http.Requ
 		return NoopSpan
 	}
 
+	// continue the trace of the client if there is one.
+	ctx = t.propagator.Extract(ctx, propagation.HeaderCarrier(req.Header))
+
 	span := newSpanForCloudflare(ctx, t, name, req)
 	if span != nil {
 		return span
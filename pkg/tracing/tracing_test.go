@@ -361,3 +361,74 @@ func TestEdgeCases(t *testing.T) {
 		childSpan.End()
 	}
 }
+
+func TestNewSpanForHTTPContinuesTrace(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		ServiceName: "test",
+		SampleRate:  0,
+		ParentBased: true,
+		Exporter: &ExporterSpec{
+			Zipkin: &ZipkinSpec{Endpoint: "http://localhost:2181"},
+		},
+	}
+	tracer, err := New(spec)
+	assert.Nil(err)
+	defer tracer.Close()
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/abc", http.NoBody)
+	stdr.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	span := tracer.NewSpanForHTTP(stdr.Context(), "testSpan", stdr)
+	sc := span.SpanContext()
+	assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+	// sampled by the client even if the sample rate is 0.
+	assert.True(sc.IsSampled())
+
+	// the trace context is propagated to the upstream.
+	child := span.NewChild("upstream")
+	upstream, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/abc", http.NoBody)
+	child.InjectHTTP(upstream)
+	assert.Contains(upstream.Header.Get("traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736")
+
+	spec.ParentBased = false
+	tracer, err = New(spec)
+	assert.Nil(err)
+	defer tracer.Close()
+	span = tracer.NewSpanForHTTP(stdr.Context(), "testSpan", stdr)
+	assert.False(span.SpanContext().IsSampled())
+}
+
+func TestJaegerPropagator(t *testing.T) {
+	assert := assert.New(t)
+
+	p := jaegerPropagator{}
+	assert.Equal([]string{jaegerHeader}, p.Fields())
+
+	carrier := propagation.MapCarrier{}
+	ctx := p.Extract(context.Background(), carrier)
+	assert.False(trace.SpanContextFromContext(ctx).IsValid())
+
+	// leading zeros omitted and colons escaped
+	carrier.Set(jaegerHeader, "a3ce929d0e0e4736%3A51f4d7a2f8c0a1b2%3A0%3A1")
+	ctx = p.Extract(context.Background(), carrier)
+	sc := trace.SpanContextFromContext(ctx)
+	assert.True(sc.IsValid())
+	assert.True(sc.IsRemote())
+	assert.True(sc.IsSampled())
+	assert.Equal("0000000000000000a3ce929d0e0e4736", sc.TraceID().String())
+	assert.Equal("51f4d7a2f8c0a1b2", sc.SpanID().String())
+
+	out := propagation.MapCarrier{}
+	p.Inject(ctx, out)
+	assert.Equal("0000000000000000a3ce929d0e0e4736:51f4d7a2f8c0a1b2:0:1", out.Get(jaegerHeader))
+
+	for _, v := range []string{"abc", "0:1:0:1", "xyz:51f4d7a2f8c0a1b2:0:1", "a3ce929d0e0e4736:51f4d7a2f8c0a1b2:0:zz"} {
+		carrier.Set(jaegerHeader, v)
+		ctx = p.Extract(context.Background(), carrier)
+		assert.False(trace.SpanContextFromContext(ctx).IsValid(), v)
+	}
+
+	spec := &Spec{HeaderFormat: headerFormatJaeger, Exporter: &ExporterSpec{}}
+	assert.Equal(jaegerPropagator{}, spec.newPropagator())
+}
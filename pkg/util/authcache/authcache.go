@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package authcache provides a TTL-bound cache of the results of the auth
+// backends, like the token introspection and LDAP, so that the backends are
+// not hit for every request.
+package authcache
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+const (
+	defaultTTL        = 5 * time.Minute
+	defaultMaxEntries = 10000
+	secretSize        = 32
+)
+
+type (
+	// Spec is the spec of a Cache.
+	Spec struct {
+		// TTL is the maximum duration a result is cached, default is 5m.
+		TTL string `json:"ttl,omitempty" jsonschema:"format=duration"`
+		// MaxEntries is the maximum number of the results cached in
+		// memory, default is 10000. It is not used by Redis.
+		MaxEntries int `json:"maxEntries,omitempty" jsonschema:"minimum=1"`
+		// Redis stores the results in Redis instead of in memory, so that
+		// they are shared by all Easegress instances.
+		Redis *RedisSpec `json:"redis,omitempty"`
+	}
+
+	// RedisSpec is the spec of the Redis backend.
+	RedisSpec struct {
+		Addr     string `json:"addr" jsonschema:"required"`
+		Username string `json:"username,omitempty"`
+		Password string `json:"password,omitempty"`
+		DB       int    `json:"db,omitempty"`
+		// KeyPrefix is the prefix of the Redis keys, default is
+		// "easegress:authcache:".
+		KeyPrefix string `json:"keyPrefix,omitempty"`
+	}
+
+	// LoadFunc loads the value of a key on a cache miss, and returns how
+	// long the value could be cached. The TTL of the cache is used if ttl
+	// is zero or longer than it, and the value is not cached if ttl is
+	// negative or err is not nil.
+	LoadFunc func() (value []byte, ttl time.Duration, err error)
+
+	// Cache is a TTL-bound cache. Concurrent misses of a key are loaded
+	// only once to protect the backends from stampedes.
+	Cache struct {
+		ttl    time.Duration
+		secret []byte
+		store  store
+		group  singleflight.Group
+	}
+
+	store interface {
+		get(key string) ([]byte, bool)
+		set(key string, value []byte, ttl time.Duration)
+		del(key string)
+		close()
+	}
+)
+
+// Validate validates the spec of Cache.
+func (spec *Spec) Validate() error {
+	if spec.TTL == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(spec.TTL); err != nil || d <= 0 {
+		return fmt.Errorf("invalid ttl %s", spec.TTL)
+	}
+	return nil
+}
+
+// New creates a Cache, the spec must be valid. The keys are hashed with
+// the secret shared by the members of cls, or a random secret if cls is
+// nil.
+func New(spec *Spec, cls cluster.Cluster) *Cache {
+	c := &Cache{ttl: defaultTTL, secret: secretOf(cls)}
+	if spec.TTL != "" {
+		c.ttl, _ = time.ParseDuration(spec.TTL)
+	}
+
+	if spec.Redis != nil {
+		c.store = newRedisStore(spec.Redis)
+	} else {
+		maxEntries := spec.MaxEntries
+		if maxEntries <= 0 {
+			maxEntries = defaultMaxEntries
+		}
+		c.store = newMemoryStore(maxEntries)
+	}
+
+	return c
+}
+
+func newSecret() []byte {
+	secret := make([]byte, secretSize)
+	rand.Read(secret)
+	return secret
+}
+
+// secretOf returns the secret of the cluster, it is created by the first
+// member using it. All members share the secret, so they share the keys
+// in Redis. A random secret is returned if the cluster is not available,
+// the cached results are not shared then.
+func secretOf(cls cluster.Cluster) []byte {
+	if cls == nil {
+		return newSecret()
+	}
+
+	key := cls.Layout().AuthCacheSecretKey()
+	var value string
+	err := cls.STM(func(stm concurrency.STM) error {
+		value = stm.Get(key)
+		if value == "" {
+			value = hex.EncodeToString(newSecret())
+			stm.Put(key, value)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Errorf("get secret of auth cache failed, use a random one: %v", err)
+		return newSecret()
+	}
+
+	secret, err := hex.DecodeString(value)
+	if err != nil || len(secret) == 0 {
+		logger.Errorf("bad secret of auth cache in cluster, use a random one")
+		return newSecret()
+	}
+	return secret
+}
+
+// hashKey hashes the key with the HMAC of the secret, because the keys may
+// contain credentials, like the tokens and the passwords, which should not
+// be kept in plain text, nor be guessed by the ones who could read the
+// cache, like the other users of the Redis.
+func (c *Cache) hashKey(key string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Get returns the value of key, and loads it with load on a cache miss.
+func (c *Cache) Get(key string, load LoadFunc) ([]byte, error) {
+	key = c.hashKey(key)
+	if value, ok := c.store.get(key); ok {
+		return value, nil
+	}
+
+	value, err, _ := c.group.Do(key, func() (interface{}, error) {
+		// the value may be loaded by another caller after the miss.
+		if value, ok := c.store.get(key); ok {
+			return value, nil
+		}
+
+		value, ttl, err := load()
+		if err != nil {
+			return nil, err
+		}
+		if ttl == 0 || ttl > c.ttl {
+			ttl = c.ttl
+		}
+		if ttl > 0 {
+			c.store.set(key, value, ttl)
+		}
+		return value, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return value.([]byte), nil
+}
+
+// Delete deletes the value of key.
+func (c *Cache) Delete(key string) {
+	c.store.del(c.hashKey(key))
+}
+
+// Close closes the Cache.
+func (c *Cache) Close() {
+	c.store.close()
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authcache
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+
+	"github.com/megaease/easegress/v2/pkg/cluster"
+	"github.com/megaease/easegress/v2/pkg/cluster/clustertest"
+)
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{}).Validate())
+	assert.NoError((&Spec{TTL: "1m"}).Validate())
+	assert.Error((&Spec{TTL: "0s"}).Validate())
+	assert.Error((&Spec{TTL: "x"}).Validate())
+}
+
+func TestGet(t *testing.T) {
+	assert := assert.New(t)
+
+	c := New(&Spec{TTL: "50ms"}, nil)
+	defer c.Close()
+
+	loads := 0
+	load := func(ttl time.Duration) LoadFunc {
+		return func() ([]byte, time.Duration, error) {
+			loads++
+			return []byte("value"), ttl, nil
+		}
+	}
+
+	value, err := c.Get("key", load(0))
+	assert.NoError(err)
+	assert.Equal("value", string(value))
+	value, err = c.Get("key", load(0))
+	assert.NoError(err)
+	assert.Equal("value", string(value))
+	assert.Equal(1, loads)
+
+	// the keys are hashed.
+	_, ok := c.store.get("key")
+	assert.False(ok)
+
+	// expired.
+	time.Sleep(60 * time.Millisecond)
+	c.Get("key", load(0))
+	assert.Equal(2, loads)
+
+	c.Delete("key")
+	c.Get("key", load(0))
+	assert.Equal(3, loads)
+
+	// not cached with a negative ttl.
+	c.Get("negative", load(-1))
+	c.Get("negative", load(-1))
+	assert.Equal(5, loads)
+
+	// the ttl is capped by the ttl of the cache.
+	c.Get("long", load(time.Hour))
+	time.Sleep(60 * time.Millisecond)
+	c.Get("long", load(time.Hour))
+	assert.Equal(7, loads)
+
+	// errors are not cached.
+	_, err = c.Get("error", func() ([]byte, time.Duration, error) {
+		return nil, 0, fmt.Errorf("backend down")
+	})
+	assert.Error(err)
+	value, err = c.Get("error", load(0))
+	assert.NoError(err)
+	assert.Equal("value", string(value))
+}
+
+func TestStampede(t *testing.T) {
+	assert := assert.New(t)
+
+	c := New(&Spec{}, nil)
+	defer c.Close()
+
+	var loads int32
+	load := func() ([]byte, time.Duration, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(50 * time.Millisecond)
+		return []byte("value"), 0, nil
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := c.Get("key", load)
+			assert.NoError(err)
+			assert.Equal("value", string(value))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(int32(1), atomic.LoadInt32(&loads))
+}
+
+func TestSecret(t *testing.T) {
+	assert := assert.New(t)
+
+	store := map[string]string{}
+	cls := clustertest.NewMockedCluster()
+	cls.MockedLayout = func() *cluster.Layout { return &cluster.Layout{} }
+	cls.MockedSTM = func(apply func(concurrency.STM) error) error {
+		return apply(&clustertest.MockedSTM{
+			MockedGet: func(key ...string) string { return store[key[0]] },
+			MockedPut: func(key, val string, opts ...clientv3.OpOption) { store[key] = val },
+		})
+	}
+
+	// the members share the secret, so they share the keys.
+	c1, c2 := New(&Spec{}, cls), New(&Spec{}, cls)
+	defer c1.Close()
+	defer c2.Close()
+	assert.Len(store, 1)
+	assert.Equal(c1.hashKey("user\npassword"), c2.hashKey("user\npassword"))
+
+	// the keys can't be computed without the secret.
+	c3 := New(&Spec{}, nil)
+	defer c3.Close()
+	assert.NotEqual(c1.hashKey("user\npassword"), c3.hashKey("user\npassword"))
+}
+
+func TestMemoryStoreEvict(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newMemoryStore(2)
+	s.set("a", []byte("a"), time.Millisecond)
+	s.set("b", []byte("b"), time.Hour)
+	time.Sleep(5 * time.Millisecond)
+
+	// the expired entry is evicted first.
+	s.set("c", []byte("c"), time.Hour)
+	assert.Len(s.entries, 2)
+	_, ok := s.get("b")
+	assert.True(ok)
+	_, ok = s.get("c")
+	assert.True(ok)
+
+	s.set("d", []byte("d"), time.Hour)
+	assert.Len(s.entries, 2)
+	_, ok = s.get("d")
+	assert.True(ok)
+
+	// updating an entry does not evict others.
+	s.set("d", []byte("e"), time.Hour)
+	assert.Len(s.entries, 2)
+	value, _ := s.get("d")
+	assert.Equal("e", string(value))
+}
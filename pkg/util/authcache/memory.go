@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authcache
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	memoryStore struct {
+		mutex      sync.Mutex
+		maxEntries int
+		entries    map[string]*memoryEntry
+	}
+
+	memoryEntry struct {
+		value    []byte
+		expireAt time.Time
+	}
+)
+
+func newMemoryStore(maxEntries int) *memoryStore {
+	return &memoryStore{
+		maxEntries: maxEntries,
+		entries:    map[string]*memoryEntry{},
+	}
+}
+
+func (s *memoryStore) get(key string) ([]byte, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e := s.entries[key]
+	if e == nil {
+		return nil, false
+	}
+	if time.Now().After(e.expireAt) {
+		delete(s.entries, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (s *memoryStore) set(key string, value []byte, ttl time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.entries[key]; !ok && len(s.entries) >= s.maxEntries {
+		s.evict()
+	}
+	s.entries[key] = &memoryEntry{value: value, expireAt: time.Now().Add(ttl)}
+}
+
+// evict removes the expired entries, or an arbitrary entry if none of them
+// is expired, the caller must hold the lock.
+func (s *memoryStore) evict() {
+	now := time.Now()
+	for k, e := range s.entries {
+		if now.After(e.expireAt) {
+			delete(s.entries, k)
+		}
+	}
+	if len(s.entries) < s.maxEntries {
+		return
+	}
+	for k := range s.entries {
+		delete(s.entries, k)
+		return
+	}
+}
+
+func (s *memoryStore) del(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.entries, key)
+}
+
+func (s *memoryStore) close() {
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package authcache
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/megaease/easegress/v2/pkg/logger"
+)
+
+const defaultKeyPrefix = "easegress:authcache:"
+
+type redisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func newRedisStore(spec *RedisSpec) *redisStore {
+	prefix := spec.KeyPrefix
+	if prefix == "" {
+		prefix = defaultKeyPrefix
+	}
+	return &redisStore{
+		client: redis.NewClient(&redis.Options{
+			Addr:     spec.Addr,
+			Username: spec.Username,
+			Password: spec.Password,
+			DB:       spec.DB,
+		}),
+		prefix: prefix,
+	}
+}
+
+// get returns false on errors, so that the values are loaded from the
+// backends when Redis is not available.
+func (s *redisStore) get(key string) ([]byte, bool) {
+	value, err := s.client.Get(context.Background(), s.prefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, false
+	}
+	if err != nil {
+		logger.Warnf("get auth cache from redis failed: %v", err)
+		return nil, false
+	}
+	return value, true
+}
+
+func (s *redisStore) set(key string, value []byte, ttl time.Duration) {
+	err := s.client.Set(context.Background(), s.prefix+key, value, ttl).Err()
+	if err != nil {
+		logger.Warnf("set auth cache to redis failed: %v", err)
+	}
+}
+
+func (s *redisStore) del(key string) {
+	err := s.client.Del(context.Background(), s.prefix+key).Err()
+	if err != nil {
+		logger.Warnf("delete auth cache from redis failed: %v", err)
+	}
+}
+
+func (s *redisStore) close() {
+	s.client.Close()
+}
@@ -15,12 +15,13 @@
  * limitations under the License.
  */
 
-// Package codecounter provides a goroutine unsafe HTTP status code counter.
+// Package codecounter provides an HTTP status code counter.
 package codecounter
 
 import "sync/atomic"
 
-// HTTPStatusCodeCounter is the goroutine unsafe HTTP status code counter.
+// HTTPStatusCodeCounter is the HTTP status code counter, it could be updated
+// concurrently.
 // It is designed for counting http status code which is 1XX - 5XX,
 // So the code range are limited to [0, 999]
 type HTTPStatusCodeCounter struct {
@@ -46,15 +47,15 @@ func (cc *HTTPStatusCodeCounter) Count(code int) {
 // Reset resets counters of all codes to zero
 func (cc *HTTPStatusCodeCounter) Reset() {
 	for i := 0; i < len(cc.counter); i++ {
-		cc.counter[i] = 0
+		atomic.StoreUint64(&cc.counter[i], 0)
 	}
 }
 
 // Codes returns the codes.
 func (cc *HTTPStatusCodeCounter) Codes() map[int]uint64 {
 	codes := make(map[int]uint64)
-	for i, count := range cc.counter {
-		if count > 0 {
+	for i := range cc.counter {
+		if count := atomic.LoadUint64(&cc.counter[i]); count > 0 {
 			codes[i] = count
 		}
 	}
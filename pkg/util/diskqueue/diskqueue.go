@@ -0,0 +1,530 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package diskqueue implements a disk-backed FIFO queue, a write-ahead log
+// of records in segment files, with the read position persisted, so the
+// records survive the restarts.
+package diskqueue
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSegmentSize is the default size of the segment files.
+	DefaultSegmentSize = 64 << 20
+
+	segmentSuffix = ".seg"
+	cursorFile    = "cursor"
+	headerSize    = 8
+)
+
+var (
+	// ErrEmpty is returned by Peek when there are no records to read.
+	ErrEmpty = errors.New("queue is empty")
+	// ErrClosed is returned when the queue is closed.
+	ErrClosed = errors.New("queue is closed")
+)
+
+type (
+	// Options is the options of a queue.
+	Options struct {
+		// Dir is the directory of the segment files and the cursor.
+		Dir string
+		// SegmentSize is the size a segment file is rolled over at.
+		SegmentSize int64
+		// MaxSize is the max size of the segment files, the oldest
+		// segments are removed even if they are not read when it is
+		// exceeded, zero means no limit.
+		MaxSize int64
+		// MaxAge is the max age of the segment files, a segment is
+		// removed even if it is not read once its last record is older
+		// than MaxAge, zero means no limit.
+		MaxAge time.Duration
+		// Sync syncs the files to the disk on every append and commit.
+		Sync bool
+	}
+
+	// Queue is a disk-backed FIFO queue. A record is read by Peek, and
+	// removed by Commit after it is processed, so a record is delivered at
+	// least once.
+	Queue struct {
+		opts   Options
+		notify chan struct{}
+
+		mutex    sync.Mutex
+		closed   bool
+		segments []*segment
+		size     int64
+		writer   *os.File
+		reader   *os.File
+		readSeg  *segment
+		readOff  int64
+		peeked   int64
+		dropped  int64
+	}
+
+	segment struct {
+		id      int64
+		size    int64
+		modTime time.Time
+	}
+
+	// Stats is the statistics of a queue.
+	Stats struct {
+		Segments int   `json:"segments"`
+		Size     int64 `json:"size"`
+		// Pending is the size of the records not read.
+		Pending int64 `json:"pending"`
+		// Dropped is the size of the records removed before they are
+		// read, by the retention or because they are corrupted.
+		Dropped int64 `json:"dropped"`
+	}
+)
+
+func (s *segment) fileName(dir string) string {
+	return filepath.Join(dir, fmt.Sprintf("%016d%s", s.id, segmentSuffix))
+}
+
+// Open opens the queue in opts.Dir, the directory is created if it does
+// not exist.
+func Open(opts *Options) (*Queue, error) {
+	q := &Queue{opts: *opts, notify: make(chan struct{}, 1)}
+	if q.opts.SegmentSize <= 0 {
+		q.opts.SegmentSize = DefaultSegmentSize
+	}
+
+	if err := os.MkdirAll(q.opts.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := q.loadSegments(); err != nil {
+		return nil, err
+	}
+
+	last := q.segments[len(q.segments)-1]
+	f, err := os.OpenFile(last.fileName(q.opts.Dir), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	q.writer = f
+
+	q.loadCursor()
+	q.retain(time.Now())
+	return q, nil
+}
+
+func (q *Queue) loadSegments() error {
+	entries, err := os.ReadDir(q.opts.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimSuffix(name, segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		q.segments = append(q.segments, &segment{id: id, size: info.Size(), modTime: info.ModTime()})
+	}
+	sort.Slice(q.segments, func(i, j int) bool {
+		return q.segments[i].id < q.segments[j].id
+	})
+
+	if len(q.segments) == 0 {
+		q.segments = []*segment{{id: 1, modTime: time.Now()}}
+		return nil
+	}
+
+	// the last record of the last segment may be incomplete if the
+	// process crashed, the segment is truncated to the last valid record.
+	last := q.segments[len(q.segments)-1]
+	valid, err := validSize(last.fileName(q.opts.Dir))
+	if err != nil {
+		return err
+	}
+	if valid != last.size {
+		if err := os.Truncate(last.fileName(q.opts.Dir), valid); err != nil {
+			return err
+		}
+		last.size = valid
+	}
+
+	for _, s := range q.segments {
+		q.size += s.size
+	}
+	return nil
+}
+
+// validSize returns the size of the valid records at the beginning of the
+// file.
+func validSize(fileName string) (int64, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+
+	off := 0
+	for off+headerSize <= len(data) {
+		n := int(binary.BigEndian.Uint32(data[off:]))
+		end := off + headerSize + n
+		if end > len(data) || crc32.ChecksumIEEE(data[off+headerSize:end]) != binary.BigEndian.Uint32(data[off+4:]) {
+			break
+		}
+		off = end
+	}
+	return int64(off), nil
+}
+
+// loadCursor loads the read position, the records before the first
+// segment have been removed, so the position is moved to the first
+// segment if it points to a removed one.
+func (q *Queue) loadCursor() {
+	q.readSeg, q.readOff = q.segments[0], 0
+
+	data, err := os.ReadFile(filepath.Join(q.opts.Dir, cursorFile))
+	if err != nil {
+		return
+	}
+	var id, off int64
+	if _, err := fmt.Sscanf(string(data), "%d %d", &id, &off); err != nil {
+		return
+	}
+
+	for _, s := range q.segments {
+		if s.id == id {
+			q.readSeg, q.readOff = s, off
+			if off > s.size {
+				q.readOff = s.size
+			}
+			return
+		}
+		if s.id > id {
+			q.readSeg = s
+			return
+		}
+	}
+}
+
+func (q *Queue) saveCursor() error {
+	fileName := filepath.Join(q.opts.Dir, cursorFile)
+	tmp := fileName + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%d %d\n", q.readSeg.id, q.readOff)
+	if err == nil && q.opts.Sync {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, fileName)
+}
+
+// Append appends a record to the queue.
+func (q *Queue) Append(data []byte) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+
+	record := make([]byte, headerSize+len(data))
+	binary.BigEndian.PutUint32(record, uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:], crc32.ChecksumIEEE(data))
+	copy(record[headerSize:], data)
+
+	last := q.segments[len(q.segments)-1]
+	if last.size > 0 && last.size+int64(len(record)) > q.opts.SegmentSize {
+		if err := q.roll(); err != nil {
+			return err
+		}
+		last = q.segments[len(q.segments)-1]
+	}
+
+	n, err := q.writer.Write(record)
+	last.size += int64(n)
+	q.size += int64(n)
+	last.modTime = time.Now()
+	if err != nil {
+		// remove the partial record, so the following records are
+		// readable.
+		if terr := q.writer.Truncate(last.size - int64(n)); terr == nil {
+			last.size -= int64(n)
+			q.size -= int64(n)
+		}
+		return err
+	}
+	if q.opts.Sync {
+		if err := q.writer.Sync(); err != nil {
+			return err
+		}
+	}
+
+	q.retain(last.modTime)
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// roll closes the active segment and starts a new one.
+func (q *Queue) roll() error {
+	last := q.segments[len(q.segments)-1]
+	next := &segment{id: last.id + 1, modTime: time.Now()}
+
+	f, err := os.OpenFile(next.fileName(q.opts.Dir), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if q.opts.Sync {
+		q.writer.Sync()
+	}
+	q.writer.Close()
+	q.writer = f
+	q.segments = append(q.segments, next)
+	return nil
+}
+
+// Retain removes the segments exceeding the max size or the max age.
+func (q *Queue) Retain() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if !q.closed {
+		q.retain(time.Now())
+	}
+}
+
+// retain removes the read segments, and the segments exceeding the max
+// size or the max age. The active segment is never removed.
+func (q *Queue) retain(now time.Time) {
+	cursorMoved := false
+	for len(q.segments) > 1 {
+		s := q.segments[0]
+		read := s.id < q.readSeg.id
+		tooLarge := q.opts.MaxSize > 0 && q.size > q.opts.MaxSize
+		tooOld := q.opts.MaxAge > 0 && now.Sub(s.modTime) > q.opts.MaxAge
+		if !read && !tooLarge && !tooOld {
+			break
+		}
+
+		if s == q.readSeg {
+			q.dropped += s.size - q.readOff
+			q.closeReader()
+			q.readSeg, q.readOff, q.peeked = q.segments[1], 0, 0
+			cursorMoved = true
+		}
+		os.Remove(s.fileName(q.opts.Dir))
+		q.size -= s.size
+		q.segments = q.segments[1:]
+	}
+
+	if cursorMoved {
+		q.saveCursor()
+	}
+}
+
+func (q *Queue) closeReader() {
+	if q.reader != nil {
+		q.reader.Close()
+		q.reader = nil
+	}
+}
+
+// Peek returns the first record not committed, or ErrEmpty if there are
+// none. The same record is returned until it is committed.
+func (q *Queue) Peek() ([]byte, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return nil, ErrClosed
+	}
+
+	for {
+		s := q.readSeg
+		if q.readOff >= s.size {
+			if s == q.segments[len(q.segments)-1] {
+				return nil, ErrEmpty
+			}
+			q.advance()
+			continue
+		}
+
+		if q.reader == nil {
+			f, err := os.Open(s.fileName(q.opts.Dir))
+			if err != nil {
+				return nil, err
+			}
+			q.reader = f
+		}
+
+		data, err := q.readRecord()
+		if err != nil {
+			// the rest of the segment is unreadable.
+			q.dropped += s.size - q.readOff
+			q.readOff = s.size
+			continue
+		}
+		q.peeked = int64(headerSize + len(data))
+		return data, nil
+	}
+}
+
+// advance moves the read position to the next segment.
+func (q *Queue) advance() {
+	for i, s := range q.segments {
+		if s == q.readSeg {
+			q.closeReader()
+			q.readSeg, q.readOff, q.peeked = q.segments[i+1], 0, 0
+			break
+		}
+	}
+	q.saveCursor()
+	q.retain(time.Now())
+}
+
+func (q *Queue) readRecord() ([]byte, error) {
+	header := make([]byte, headerSize)
+	if _, err := q.reader.ReadAt(header, q.readOff); err != nil {
+		return nil, err
+	}
+
+	n := int64(binary.BigEndian.Uint32(header))
+	if q.readOff+headerSize+n > q.readSeg.size {
+		return nil, fmt.Errorf("record exceeds the segment")
+	}
+	data := make([]byte, n)
+	if _, err := q.reader.ReadAt(data, q.readOff+headerSize); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, fmt.Errorf("checksum mismatch")
+	}
+	return data, nil
+}
+
+// Commit removes the record returned by the last Peek.
+func (q *Queue) Commit() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	if q.peeked == 0 {
+		return nil
+	}
+	q.readOff += q.peeked
+	q.peeked = 0
+	return q.saveCursor()
+}
+
+// Notify returns a channel which receives a value after records are
+// appended.
+func (q *Queue) Notify() <-chan struct{} {
+	return q.notify
+}
+
+// Stats returns the statistics of the queue.
+func (q *Queue) Stats() Stats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	stats := Stats{Segments: len(q.segments), Size: q.size, Dropped: q.dropped}
+	counting := false
+	for _, s := range q.segments {
+		if s == q.readSeg {
+			counting = true
+			stats.Pending -= q.readOff
+		}
+		if counting {
+			stats.Pending += s.size
+		}
+	}
+	return stats
+}
+
+// SetOptions updates the options of the open queue, the retention takes
+// effect at once. The directory can't be changed, a queue should be opened
+// in the new directory instead.
+func (q *Queue) SetOptions(opts *Options) error {
+	if opts.Dir != q.opts.Dir {
+		return fmt.Errorf("can't change the directory from %s to %s", q.opts.Dir, opts.Dir)
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.opts.SegmentSize = opts.SegmentSize
+	if q.opts.SegmentSize <= 0 {
+		q.opts.SegmentSize = DefaultSegmentSize
+	}
+	q.opts.MaxSize, q.opts.MaxAge, q.opts.Sync = opts.MaxSize, opts.MaxAge, opts.Sync
+	if !q.closed {
+		q.retain(time.Now())
+	}
+	return nil
+}
+
+// Dir returns the directory of the queue.
+func (q *Queue) Dir() string {
+	return q.opts.Dir
+}
+
+// Close closes the queue.
+func (q *Queue) Close() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	q.closeReader()
+	if q.opts.Sync {
+		q.writer.Sync()
+	}
+	return q.writer.Close()
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package diskqueue
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readAll(t *testing.T, q *Queue) []string {
+	var records []string
+	for {
+		data, err := q.Peek()
+		if err == ErrEmpty {
+			return records
+		}
+		assert.NoError(t, err)
+		records = append(records, string(data))
+		assert.NoError(t, q.Commit())
+	}
+}
+
+func TestAppendAndRead(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	q, err := Open(&Options{Dir: dir, SegmentSize: 64})
+	assert.NoError(err)
+
+	_, err = q.Peek()
+	assert.Equal(ErrEmpty, err)
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(q.Append([]byte(fmt.Sprintf("record-%d", i))))
+	}
+	select {
+	case <-q.Notify():
+	default:
+		t.Fatal("no notification")
+	}
+
+	// a record is returned until it is committed.
+	data, err := q.Peek()
+	assert.NoError(err)
+	assert.Equal("record-0", string(data))
+	data, _ = q.Peek()
+	assert.Equal("record-0", string(data))
+	assert.NoError(q.Commit())
+
+	stats := q.Stats()
+	assert.Equal(int64(16*10), stats.Size)
+	assert.Equal(int64(16*9), stats.Pending)
+	assert.Greater(stats.Segments, 1)
+
+	records := readAll(t, q)
+	assert.Len(records, 9)
+	assert.Equal("record-9", records[8])
+
+	// the read segments are removed.
+	stats = q.Stats()
+	assert.Equal(1, stats.Segments)
+	assert.Zero(stats.Pending)
+	assert.NoError(q.Close())
+
+	_, err = q.Peek()
+	assert.Equal(ErrClosed, err)
+	assert.Equal(ErrClosed, q.Append(nil))
+}
+
+func TestReopen(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	q, err := Open(&Options{Dir: dir, SegmentSize: 64, Sync: true})
+	assert.NoError(err)
+	for i := 0; i < 5; i++ {
+		assert.NoError(q.Append([]byte(fmt.Sprintf("record-%d", i))))
+	}
+	q.Peek()
+	q.Commit()
+	// peeked but not committed.
+	q.Peek()
+	assert.NoError(q.Close())
+
+	// a partial record written before a crash.
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	f, err := os.OpenFile(segments[len(segments)-1], os.O_WRONLY|os.O_APPEND, 0o644)
+	assert.NoError(err)
+	f.Write([]byte{0, 0, 0, 100, 1, 2})
+	f.Close()
+
+	q, err = Open(&Options{Dir: dir, SegmentSize: 64})
+	assert.NoError(err)
+	assert.NoError(q.Append([]byte("record-5")))
+	assert.Equal([]string{"record-1", "record-2", "record-3", "record-4", "record-5"}, readAll(t, q))
+	q.Close()
+}
+
+func TestCorruptedRecord(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	q, err := Open(&Options{Dir: dir, SegmentSize: 32})
+	assert.NoError(err)
+	for i := 0; i < 4; i++ {
+		assert.NoError(q.Append([]byte(fmt.Sprintf("record-%d", i))))
+	}
+
+	// corrupt the data of the first record.
+	f, err := os.OpenFile(q.segments[0].fileName(dir), os.O_WRONLY, 0o644)
+	assert.NoError(err)
+	f.WriteAt([]byte("X"), headerSize)
+	f.Close()
+
+	assert.Equal([]string{"record-2", "record-3"}, readAll(t, q))
+	assert.Equal(int64(32), q.Stats().Dropped)
+	q.Close()
+}
+
+func TestRetention(t *testing.T) {
+	assert := assert.New(t)
+
+	q, err := Open(&Options{Dir: t.TempDir(), SegmentSize: 32, MaxSize: 64})
+	assert.NoError(err)
+	for i := 0; i < 6; i++ {
+		assert.NoError(q.Append([]byte(fmt.Sprintf("record-%d", i))))
+	}
+
+	stats := q.Stats()
+	assert.Equal(int64(64), stats.Size)
+	assert.Equal(int64(32), stats.Dropped)
+	assert.Equal([]string{"record-2", "record-3", "record-4", "record-5"}, readAll(t, q))
+	q.Close()
+
+	q, err = Open(&Options{Dir: t.TempDir(), SegmentSize: 32, MaxAge: time.Minute})
+	assert.NoError(err)
+	for i := 0; i < 4; i++ {
+		assert.NoError(q.Append([]byte(fmt.Sprintf("record-%d", i))))
+	}
+	q.segments[0].modTime = time.Now().Add(-2 * time.Minute)
+	q.Retain()
+	assert.Equal([]string{"record-2", "record-3"}, readAll(t, q))
+	q.Close()
+}
+
+func TestSetOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	q, err := Open(&Options{Dir: dir, SegmentSize: 32})
+	assert.NoError(err)
+	defer q.Close()
+	for i := 0; i < 6; i++ {
+		assert.NoError(q.Append([]byte(fmt.Sprintf("record-%d", i))))
+	}
+
+	// the files are only accessible by the owner.
+	info, err := os.Stat(q.segments[0].fileName(dir))
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0o600), info.Mode().Perm())
+
+	// the retention takes effect at once.
+	assert.NoError(q.SetOptions(&Options{Dir: dir, SegmentSize: 32, MaxSize: 64}))
+	assert.Equal(int64(64), q.Stats().Size)
+	assert.Equal([]string{"record-2", "record-3", "record-4", "record-5"}, readAll(t, q))
+
+	assert.Error(q.SetOptions(&Options{Dir: t.TempDir()}))
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package featureflags provides the feature flags shared by the members,
+// they are managed by the admin API and evaluated by the FeatureFlag filter.
+package featureflags
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Flag is a behavioral toggle shared by all members, it is evaluated per
+// request by the FeatureFlag filter, and flipped at runtime without
+// updating the objects.
+type Flag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Enabled is the kill switch of the flag, the flag is off for all
+	// requests if it is false.
+	Enabled bool `json:"enabled"`
+	// Consumers are the consumers the flag is on for.
+	Consumers []string `json:"consumers,omitempty"`
+	// Headers turn on the flag for the requests having any of the values
+	// in the header.
+	Headers map[string][]string `json:"headers,omitempty"`
+	// Percent is the percentage of the other requests the flag is on for,
+	// chosen by the hash of the flag and the key of the request.
+	Percent   int       `json:"percent,omitempty" jsonschema:"minimum=0,maximum=100"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// flags are the feature flags in this member, the key is the name of the
+// flag.
+var flags sync.Map
+
+// Get returns the feature flag, ok is false if it is not defined.
+func Get(name string) (f *Flag, ok bool) {
+	v, ok := flags.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return v.(*Flag), true
+}
+
+// Put creates or replaces the feature flag in this member.
+func Put(f *Flag) {
+	flags.Store(f.Name, f)
+}
+
+// Delete deletes the feature flag from this member.
+func Delete(name string) {
+	flags.Delete(name)
+}
+
+// Replace replaces all the feature flags in this member, the key is the
+// name of the flag.
+func Replace(all map[string]*Flag) {
+	for name, f := range all {
+		flags.Store(name, f)
+	}
+	flags.Range(func(k, v interface{}) bool {
+		if _, ok := all[k.(string)]; !ok {
+			flags.Delete(k)
+		}
+		return true
+	})
+}
+
+// Validate validates the feature flag.
+func (f *Flag) Validate() error {
+	if f.Percent < 0 || f.Percent > 100 {
+		return fmt.Errorf("percent %d is out of [0, 100]", f.Percent)
+	}
+	return nil
+}
+
+// Evaluate returns whether the flag is on for a request of the consumer,
+// the key identifies the request in the percentage rollout, so the same
+// key always gets the same result as long as the percent is not lowered.
+func (f *Flag) Evaluate(consumer, key string, header http.Header) bool {
+	if !f.Enabled {
+		return false
+	}
+
+	if consumer != "" {
+		for _, c := range f.Consumers {
+			if c == consumer {
+				return true
+			}
+		}
+	}
+
+	for name, values := range f.Headers {
+		v := header.Get(name)
+		if v == "" {
+			continue
+		}
+		for _, value := range values {
+			if value == v {
+				return true
+			}
+		}
+	}
+
+	if f.Percent <= 0 {
+		return false
+	}
+	if f.Percent >= 100 {
+		return true
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(f.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return h.Sum64()%100 < uint64(f.Percent)
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package featureflags
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluate(t *testing.T) {
+	assert := assert.New(t)
+
+	f := &Flag{
+		Name:      "new-ui",
+		Enabled:   true,
+		Consumers: []string{"alice"},
+		Headers:   map[string][]string{"X-Beta": {"yes", "1"}},
+		Percent:   30,
+	}
+
+	assert.True(f.Evaluate("alice", "alice", http.Header{}))
+	assert.True(f.Evaluate("", "k", http.Header{"X-Beta": {"1"}}))
+
+	on := 0
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		v := f.Evaluate("", key, http.Header{})
+		assert.Equal(v, f.Evaluate("", key, http.Header{}), "evaluation is deterministic")
+		if v {
+			on++
+		}
+	}
+	assert.InDelta(3000, on, 300)
+
+	f.Enabled = false
+	assert.False(f.Evaluate("alice", "alice", http.Header{"X-Beta": {"yes"}}))
+
+	f.Enabled, f.Percent = true, 100
+	assert.True(f.Evaluate("", "k", http.Header{}))
+	assert.Error((&Flag{Percent: 101}).Validate())
+}
+
+func TestReplace(t *testing.T) {
+	assert := assert.New(t)
+
+	Put(&Flag{Name: "a"})
+	Put(&Flag{Name: "b"})
+	Replace(map[string]*Flag{"b": {Name: "b", Enabled: true}, "c": {Name: "c"}})
+
+	_, ok := Get("a")
+	assert.False(ok)
+	f, ok := Get("b")
+	assert.True(ok)
+	assert.True(f.Enabled)
+	_, ok = Get("c")
+	assert.True(ok)
+
+	Delete("c")
+	_, ok = Get("c")
+	assert.False(ok)
+}
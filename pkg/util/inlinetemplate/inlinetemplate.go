@@ -0,0 +1,415 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package inlinetemplate implements a small and safe template language, the
+// templates are rendered with the values of the requests, the responses and
+// the context data, like "Hello ${req.header.X-User | default \"guest\"}".
+//
+// A template has no loops, no conditions and no access to anything except
+// the values provided to it, so the rendering time is linear in the size of
+// the template and the values, and a template from an untrusted source is
+// safe to render.
+package inlinetemplate
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MaxOutputSize is the max size of the result of a template.
+const MaxOutputSize = 1 << 20
+
+type (
+	// Values provides the values to render a template.
+	Values interface {
+		// Value returns the value at the path, like ["req", "header",
+		// "X-User"], ok is false if it does not exist.
+		Value(path []string) (value string, ok bool)
+	}
+
+	// Template is a parsed template.
+	Template struct {
+		text  string
+		nodes []*node
+	}
+
+	// node is a piece of text, or an expression if path is not empty.
+	node struct {
+		text  string
+		path  []string
+		calls []*call
+	}
+
+	call struct {
+		fn   *function
+		args []string
+	}
+
+	function struct {
+		// args is the number of the arguments except the value.
+		args int
+		// intArgs is true if the arguments are integers.
+		intArgs bool
+		apply   func(v string, args []string) string
+	}
+)
+
+var functions = map[string]*function{
+	"default": {args: 1, apply: func(v string, args []string) string {
+		if v == "" {
+			return args[0]
+		}
+		return v
+	}},
+	"upper":    {apply: func(v string, _ []string) string { return strings.ToUpper(v) }},
+	"lower":    {apply: func(v string, _ []string) string { return strings.ToLower(v) }},
+	"trim":     {apply: func(v string, _ []string) string { return strings.TrimSpace(v) }},
+	"urlquery": {apply: func(v string, _ []string) string { return url.QueryEscape(v) }},
+	"html":     {apply: func(v string, _ []string) string { return html.EscapeString(v) }},
+	"base64":   {apply: func(v string, _ []string) string { return base64.StdEncoding.EncodeToString([]byte(v)) }},
+	"json": {apply: func(v string, _ []string) string {
+		var buf strings.Builder
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.Encode(v)
+		return strings.TrimSuffix(buf.String(), "\n")
+	}},
+	"replace": {args: 2, apply: func(v string, args []string) string {
+		return strings.ReplaceAll(v, args[0], args[1])
+	}},
+	"truncate": {args: 1, intArgs: true, apply: func(v string, args []string) string {
+		n, _ := strconv.Atoi(args[0])
+		if len(v) > n {
+			return v[:n]
+		}
+		return v
+	}},
+}
+
+// Parse parses the template, "${" starts an expression and "}" ends it,
+// and "$${" is a literal "${".
+func Parse(text string) (*Template, error) {
+	t := &Template{text: text}
+
+	var buf strings.Builder
+	for i := 0; i < len(text); {
+		if strings.HasPrefix(text[i:], "$${") {
+			buf.WriteString("${")
+			i += 3
+			continue
+		}
+		if !strings.HasPrefix(text[i:], "${") {
+			buf.WriteByte(text[i])
+			i++
+			continue
+		}
+
+		end := exprEnd(text, i+2)
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed expression at %d", i)
+		}
+		n, err := parseExpr(text[i+2 : end])
+		if err != nil {
+			return nil, fmt.Errorf("expression at %d: %v", i, err)
+		}
+		if buf.Len() > 0 {
+			t.nodes = append(t.nodes, &node{text: buf.String()})
+			buf.Reset()
+		}
+		t.nodes = append(t.nodes, n)
+		i = end + 1
+	}
+	if buf.Len() > 0 {
+		t.nodes = append(t.nodes, &node{text: buf.String()})
+	}
+
+	return t, nil
+}
+
+// exprEnd returns the index of the "}" ending the expression started at
+// start, the "}" in the quoted strings are skipped.
+func exprEnd(text string, start int) int {
+	quoted := false
+	for i := start; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case '}':
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func parseExpr(expr string) (*node, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+
+	n := &node{}
+	for _, seg := range strings.Split(tokens[0], ".") {
+		if !isName(seg) {
+			return nil, fmt.Errorf("invalid path %s", tokens[0])
+		}
+		n.path = append(n.path, seg)
+	}
+
+	for i := 1; i < len(tokens); {
+		if tokens[i] != "|" || i+1 == len(tokens) {
+			return nil, fmt.Errorf("a function is expected after |")
+		}
+		name := tokens[i+1]
+		fn := functions[name]
+		if fn == nil {
+			return nil, fmt.Errorf("unknown function %s", name)
+		}
+		i += 2
+
+		c := &call{fn: fn}
+		for ; i < len(tokens) && tokens[i] != "|"; i++ {
+			arg := tokens[i]
+			if fn.intArgs {
+				if v, err := strconv.Atoi(arg); err != nil || v < 0 {
+					return nil, fmt.Errorf("function %s: invalid argument %s", name, arg)
+				}
+			} else {
+				if arg, err = strconv.Unquote(arg); err != nil {
+					return nil, fmt.Errorf("function %s: arguments must be quoted strings", name)
+				}
+			}
+			c.args = append(c.args, arg)
+		}
+		if len(c.args) != fn.args {
+			return nil, fmt.Errorf("function %s: %d arguments are expected", name, fn.args)
+		}
+		n.calls = append(n.calls, c)
+	}
+
+	return n, nil
+}
+
+// tokenize splits the expression by spaces, "|" and quoted strings are
+// separate tokens.
+func tokenize(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		switch c := expr[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '|':
+			tokens = append(tokens, "|")
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(expr) && expr[j] != '"'; j++ {
+				if expr[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(expr) {
+				return nil, fmt.Errorf("unclosed string")
+			}
+			tokens = append(tokens, expr[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(expr) && !strings.ContainsRune(" \t\r\n|\"", rune(expr[j])) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// Text returns the text of the template.
+func (t *Template) Text() string {
+	return t.text
+}
+
+// Render renders the template with the values, a missing value is rendered
+// as an empty string.
+func (t *Template) Render(values Values) (string, error) {
+	return t.render(values, false)
+}
+
+// RenderHTML renders the template like Render, but the results of the
+// expressions are HTML-escaped, unless they end with the html function,
+// so the values of the requests can't inject markups into an HTML page.
+func (t *Template) RenderHTML(values Values) (string, error) {
+	return t.render(values, true)
+}
+
+func (t *Template) render(values Values, escape bool) (string, error) {
+	escaper := functions["html"]
+
+	var buf strings.Builder
+	for _, n := range t.nodes {
+		if n.path == nil {
+			buf.WriteString(n.text)
+		} else {
+			v, _ := values.Value(n.path)
+			for _, c := range n.calls {
+				v = c.fn.apply(v, c.args)
+			}
+			if escape && (len(n.calls) == 0 || n.calls[len(n.calls)-1].fn != escaper) {
+				v = escaper.apply(v, nil)
+			}
+			buf.WriteString(v)
+		}
+		if buf.Len() > MaxOutputSize {
+			return "", fmt.Errorf("the result exceeds %d bytes", MaxOutputSize)
+		}
+	}
+	return buf.String(), nil
+}
+
+// shared are the shared templates managed by the admin API, the key is the
+// name of the template.
+var shared sync.Map
+
+// SetShared sets the shared template.
+func SetShared(name string, t *Template) {
+	shared.Store(name, t)
+}
+
+// DeleteShared deletes the shared template.
+func DeleteShared(name string) {
+	shared.Delete(name)
+}
+
+// ReplaceShared replaces all the shared templates.
+func ReplaceShared(templates map[string]*Template) {
+	for name, t := range templates {
+		shared.Store(name, t)
+	}
+	shared.Range(func(k, v interface{}) bool {
+		if _, ok := templates[k.(string)]; !ok {
+			shared.Delete(k)
+		}
+		return true
+	})
+}
+
+// GetShared returns the shared template.
+func GetShared(name string) (*Template, bool) {
+	v, ok := shared.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return v.(*Template), true
+}
+
+type (
+	// Spec is an inline template, or a reference to a shared template.
+	Spec struct {
+		Text string `json:"text,omitempty"`
+		// Ref is the name of a shared template managed by the admin API,
+		// it is looked up when rendering, so the changes of the shared
+		// template take effect at once.
+		Ref string `json:"ref,omitempty"`
+	}
+
+	// Renderer renders the template of a Spec.
+	Renderer struct {
+		template *Template
+		ref      string
+	}
+)
+
+// Validate validates the Spec.
+func (s *Spec) Validate() error {
+	if (s.Text == "") == (s.Ref == "") {
+		return fmt.Errorf("one and only one of text and ref is required")
+	}
+	if s.Text != "" {
+		if _, err := Parse(s.Text); err != nil {
+			return fmt.Errorf("invalid template: %v", err)
+		}
+	}
+	return nil
+}
+
+// NewRenderer creates a Renderer of the spec, the spec must be valid.
+func NewRenderer(spec *Spec) *Renderer {
+	if spec.Ref != "" {
+		return &Renderer{ref: spec.Ref}
+	}
+	t, err := Parse(spec.Text)
+	if err != nil {
+		panic(err)
+	}
+	return &Renderer{template: t}
+}
+
+// Render renders the template with the values.
+func (r *Renderer) Render(values Values) (string, error) {
+	t, err := r.get()
+	if err != nil {
+		return "", err
+	}
+	return t.Render(values)
+}
+
+// RenderHTML renders the template with the values HTML-escaped.
+func (r *Renderer) RenderHTML(values Values) (string, error) {
+	t, err := r.get()
+	if err != nil {
+		return "", err
+	}
+	return t.RenderHTML(values)
+}
+
+func (r *Renderer) get() (*Template, error) {
+	if r.template != nil {
+		return r.template, nil
+	}
+	t, ok := GetShared(r.ref)
+	if !ok {
+		return nil, fmt.Errorf("shared template %s not found", r.ref)
+	}
+	return t, nil
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inlinetemplate
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, text := range []string{
+		"plain text",
+		"${vars.a}",
+		"$${not an expression}",
+		`${vars.a | default "}" | upper | truncate 3}`,
+		`${ req.header.X-User | replace "a" "b" }`,
+	} {
+		_, err := Parse(text)
+		assert.NoError(err, text)
+	}
+
+	for _, text := range []string{
+		"${vars.a",
+		"${}",
+		"${vars..a}",
+		"${vars.a | }",
+		"${vars.a | unknown}",
+		`${vars.a | default}`,
+		`${vars.a | default x}`,
+		`${vars.a | truncate "3"}`,
+		`${vars.a | default "x}`,
+	} {
+		_, err := Parse(text)
+		assert.Error(err, text)
+	}
+}
+
+func TestRender(t *testing.T) {
+	assert := assert.New(t)
+
+	vars := Vars{"name": "<Alice>", "empty": ""}
+	cases := map[string]string{
+		"Hello ${vars.name}!":                              "Hello <Alice>!",
+		"${vars.name | html}":                              "&lt;Alice&gt;",
+		"${vars.name | lower | trim}":                      "<alice>",
+		`${vars.missing | default "guest"}`:                "guest",
+		`${vars.empty | default "guest"}`:                  "guest",
+		"${vars.missing}.":                                 ".",
+		"${vars.name | json}":                              `"<Alice>"`,
+		"${vars.name | truncate 3}":                        "<Al",
+		"${vars.name | urlquery}":                          "%3CAlice%3E",
+		"${vars.name | base64}":                            "PEFsaWNlPg==",
+		`${vars.name | replace "<" "[" | replace ">" "]"}`: "[Alice]",
+		"$${vars.name} costs $5":                           "${vars.name} costs $5",
+	}
+	for text, want := range cases {
+		tmpl, err := Parse(text)
+		assert.NoError(err, text)
+		got, err := tmpl.Render(vars)
+		assert.NoError(err, text)
+		assert.Equal(want, got, text)
+	}
+
+	tmpl, _ := Parse("${vars.big}${vars.big}")
+	_, err := tmpl.Render(Vars{"big": strings.Repeat("x", MaxOutputSize/2+1)})
+	assert.Error(err)
+
+	// the values are escaped once in HTML.
+	cases = map[string]string{
+		"<p>${vars.name}</p>":         "<p>&lt;Alice&gt;</p>",
+		"<p>${vars.name | html}</p>":  "<p>&lt;Alice&gt;</p>",
+		"<p>${vars.name | lower}</p>": "<p>&lt;alice&gt;</p>",
+	}
+	for text, want := range cases {
+		tmpl, _ := Parse(text)
+		got, err := tmpl.RenderHTML(vars)
+		assert.NoError(err, text)
+		assert.Equal(want, got, text)
+	}
+}
+
+func TestRenderer(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&Spec{}).Validate())
+	assert.Error((&Spec{Text: "a", Ref: "b"}).Validate())
+	assert.Error((&Spec{Text: "${"}).Validate())
+	assert.NoError((&Spec{Ref: "page"}).Validate())
+
+	r := NewRenderer(&Spec{Ref: "page"})
+	_, err := r.Render(Vars{})
+	assert.Error(err)
+
+	tmpl, _ := Parse("v1 ${vars.a}")
+	SetShared("page", tmpl)
+	got, err := r.Render(Vars{"a": "x"})
+	assert.NoError(err)
+	assert.Equal("v1 x", got)
+	got, err = r.RenderHTML(Vars{"a": "<x>"})
+	assert.NoError(err)
+	assert.Equal("v1 &lt;x&gt;", got)
+
+	tmpl, _ = Parse("v2 ${vars.a}")
+	ReplaceShared(map[string]*Template{"page": tmpl})
+	got, _ = r.Render(Vars{"a": "x"})
+	assert.Equal("v2 x", got)
+
+	ReplaceShared(nil)
+	_, ok := GetShared("page")
+	assert.False(ok)
+}
+
+func TestContextValues(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.New(nil)
+	stdr, _ := http.NewRequest(http.MethodPost, "http://example.com/orders?id=42", nil)
+	stdr.Header.Set("X-User", "alice")
+	stdr.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(err)
+	ctx.SetInputRequest(req)
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusNotFound)
+	resp.HTTPHeader().Set("X-Trace", "t1")
+	ctx.SetOutputResponse(resp)
+	ctx.SetData("tenant", "acme")
+
+	tmpl, err := Parse("${req.method} ${req.host}${req.path} id=${req.query.id} " +
+		"user=${req.header.X-User} session=${req.cookie.session} " +
+		"status=${resp.status} trace=${resp.header.X-Trace} tenant=${data.tenant} " +
+		"ns=${namespace} code=${vars.code} ${req.unknown}")
+	assert.NoError(err)
+	got, err := tmpl.Render(NewContextValues(ctx, Vars{"code": "E1"}))
+	assert.NoError(err)
+	assert.Equal("POST example.com/orders id=42 user=alice session=s1 "+
+		"status=404 trace=t1 tenant=acme ns=DEFAULT code=E1 ", got)
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package inlinetemplate
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/context"
+	"github.com/megaease/easegress/v2/pkg/protocols/httpprot"
+)
+
+type (
+	// Vars are the values under "vars", provided by the user of the
+	// template, like the status code of an error page.
+	Vars map[string]string
+
+	// ContextValues are the values of a context:
+	//
+	//	req.method, req.scheme, req.host, req.path, req.url, req.realIP,
+	//	req.query.<name>, req.header.<name>, req.cookie.<name>,
+	//	resp.status, resp.header.<name>, data.<key>, namespace, now,
+	//	and vars.<name>.
+	ContextValues struct {
+		Ctx  *context.Context
+		Vars Vars
+	}
+)
+
+// Value implements Values.
+func (v Vars) Value(path []string) (string, bool) {
+	if len(path) != 2 || path[0] != "vars" {
+		return "", false
+	}
+	value, ok := v[path[1]]
+	return value, ok
+}
+
+// NewContextValues returns the values of the context.
+func NewContextValues(ctx *context.Context, vars Vars) *ContextValues {
+	return &ContextValues{Ctx: ctx, Vars: vars}
+}
+
+// Value implements Values.
+func (cv *ContextValues) Value(path []string) (string, bool) {
+	switch path[0] {
+	case "vars":
+		return cv.Vars.Value(path)
+	case "now":
+		if len(path) == 1 {
+			return time.Now().UTC().Format(time.RFC3339), true
+		}
+	case "namespace":
+		if len(path) == 1 {
+			return cv.Ctx.Namespace(), true
+		}
+	case "data":
+		if len(path) == 2 {
+			return dataValue(cv.Ctx.GetData(path[1]))
+		}
+	case "req":
+		if req, ok := cv.Ctx.GetInputRequest().(*httpprot.Request); ok {
+			return requestValue(req, path[1:])
+		}
+	case "resp":
+		if resp, ok := cv.Ctx.GetInputResponse().(*httpprot.Response); ok {
+			return responseValue(resp, path[1:])
+		}
+	}
+	return "", false
+}
+
+func dataValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	case fmt.Stringer:
+		return v.String(), true
+	case bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+		return fmt.Sprint(v), true
+	default:
+		return "", false
+	}
+}
+
+func requestValue(req *httpprot.Request, path []string) (string, bool) {
+	if len(path) == 2 {
+		switch path[0] {
+		case "query":
+			values, ok := req.URL().Query()[path[1]]
+			if !ok || len(values) == 0 {
+				return "", false
+			}
+			return values[0], true
+		case "header":
+			values := req.HTTPHeader().Values(path[1])
+			if len(values) == 0 {
+				return "", false
+			}
+			return values[0], true
+		case "cookie":
+			c, err := req.Cookie(path[1])
+			if err != nil {
+				return "", false
+			}
+			return c.Value, true
+		}
+		return "", false
+	}
+
+	if len(path) != 1 {
+		return "", false
+	}
+	switch path[0] {
+	case "method":
+		return req.Method(), true
+	case "scheme":
+		return req.Scheme(), true
+	case "host":
+		return req.Host(), true
+	case "path":
+		return req.Path(), true
+	case "url":
+		return req.URL().String(), true
+	case "realIP":
+		return req.RealIP(), true
+	}
+	return "", false
+}
+
+func responseValue(resp *httpprot.Response, path []string) (string, bool) {
+	if len(path) == 1 && path[0] == "status" {
+		return strconv.Itoa(resp.StatusCode()), true
+	}
+	if len(path) == 2 && path[0] == "header" {
+		values := resp.HTTPHeader().Values(path[1])
+		if len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	}
+	return "", false
+}
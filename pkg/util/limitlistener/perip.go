@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package limitlistener
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+// ErrTooManyConnections is returned by the connections exceeding the limit
+// of their IP.
+var ErrTooManyConnections = errors.New("too many connections from the IP")
+
+// NewPerIPLimitListener returns a Listener that allows at most n simultaneous
+// connections from each IP. Different from LimitListener, the connections
+// exceeding the limit are accepted, but fail on the first Read with an error
+// wrapping ErrTooManyConnections, and onReject is called with the IP.
+//
+// The IP is checked on the first Read instead of in Accept, so that reading
+// the remote address, which may block if it comes from a PROXY protocol
+// header, does not block the accepting loop.
+func NewPerIPLimitListener(l net.Listener, n uint32, onReject func(ip string)) *PerIPLimitListener {
+	return &PerIPLimitListener{
+		Listener: l,
+		max:      n,
+		onReject: onReject,
+		conns:    map[string]uint32{},
+	}
+}
+
+// PerIPLimitListener is the Listener to limit connections of each IP.
+type PerIPLimitListener struct {
+	net.Listener
+	max      uint32
+	onReject func(ip string)
+
+	mutex sync.Mutex
+	conns map[string]uint32
+}
+
+// Accept accepts one connection.
+func (l *PerIPLimitListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &perIPLimitListenerConn{Conn: c, l: l}, nil
+}
+
+func (l *PerIPLimitListener) acquire(ip string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.conns[ip] >= l.max {
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+func (l *PerIPLimitListener) release(ip string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.conns[ip] <= 1 {
+		delete(l.conns, ip)
+	} else {
+		l.conns[ip]--
+	}
+}
+
+type perIPLimitListenerConn struct {
+	net.Conn
+	l *PerIPLimitListener
+
+	acquireOnce sync.Once
+	ip          string
+	acquired    bool
+
+	releaseOnce sync.Once
+}
+
+func (c *perIPLimitListenerConn) acquire() {
+	c.ip = c.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(c.ip); err == nil {
+		c.ip = host
+	}
+
+	c.acquired = c.l.acquire(c.ip)
+	if !c.acquired && c.l.onReject != nil {
+		c.l.onReject(c.ip)
+	}
+}
+
+func (c *perIPLimitListenerConn) Read(b []byte) (int, error) {
+	c.acquireOnce.Do(c.acquire)
+	if !c.acquired {
+		// wrap the error as a read error, so that the HTTP server closes
+		// the connection silently.
+		return 0, &net.OpError{
+			Op:     "read",
+			Net:    c.LocalAddr().Network(),
+			Source: c.LocalAddr(),
+			Addr:   c.RemoteAddr(),
+			Err:    ErrTooManyConnections,
+		}
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *perIPLimitListenerConn) Close() error {
+	err := c.Conn.Close()
+	// prevent acquiring after close.
+	c.acquireOnce.Do(func() {})
+	c.releaseOnce.Do(func() {
+		if c.acquired {
+			c.l.release(c.ip)
+		}
+	})
+	return err
+}
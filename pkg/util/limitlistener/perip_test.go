@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package limitlistener
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPerIPLimitListener(t *testing.T) {
+	assert := assert.New(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+
+	rejected := []string{}
+	l := NewPerIPLimitListener(ln, 2, func(ip string) {
+		rejected = append(rejected, ip)
+	})
+	defer l.Close()
+
+	accept := func() net.Conn {
+		client, err := net.Dial("tcp", ln.Addr().String())
+		assert.NoError(err)
+		t.Cleanup(func() { client.Close() })
+		client.Write([]byte("x"))
+
+		c, err := l.Accept()
+		assert.NoError(err)
+		return c
+	}
+
+	c1, c2, c3 := accept(), accept(), accept()
+	buf := make([]byte, 1)
+	for _, c := range []net.Conn{c1, c2} {
+		_, err = c.Read(buf)
+		assert.NoError(err)
+	}
+	_, err = c3.Read(buf)
+	assert.ErrorIs(err, ErrTooManyConnections)
+	assert.Equal([]string{"127.0.0.1"}, rejected)
+
+	// closing the rejected connection does not release the quota.
+	c3.Close()
+	c4 := accept()
+	_, err = c4.Read(buf)
+	assert.ErrorIs(err, ErrTooManyConnections)
+	c4.Close()
+
+	c1.Close()
+	c1.Close()
+	c5 := accept()
+	_, err = c5.Read(buf)
+	assert.NoError(err)
+
+	c2.Close()
+	c5.Close()
+	assert.Empty(l.conns)
+
+	// connections closed before reading do not acquire the quota.
+	accept().Close()
+	assert.Empty(l.conns)
+}
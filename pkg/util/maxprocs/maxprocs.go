@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package maxprocs sizes GOMAXPROCS by the CPU quota of the container.
+//
+// The Go runtime sets GOMAXPROCS to the number of CPUs of the host, which
+// over-schedules a process whose CPU time is limited by a cgroup quota: the
+// threads are throttled at the end of every period, and the tail latency
+// goes up.
+package maxprocs
+
+import (
+	"math"
+	"os"
+	"runtime"
+)
+
+// Status is the effective parallelism of the process.
+type Status struct {
+	NumCPU int `json:"numCPU"`
+	// CPUQuota is the number of CPUs the process is allowed to use, it is
+	// zero if there is no quota.
+	CPUQuota   float64 `json:"cpuQuota,omitempty"`
+	GOMAXPROCS int     `json:"gomaxprocs"`
+}
+
+// Set sets GOMAXPROCS and returns the new value. If procs is positive,
+// GOMAXPROCS is set to procs. If it is zero, GOMAXPROCS is set by the CPU
+// quota, unless there is no quota or the GOMAXPROCS environment variable is
+// set. If it is negative, the default of Go is kept.
+func Set(procs int) int {
+	switch {
+	case procs > 0:
+		runtime.GOMAXPROCS(procs)
+	case procs == 0 && os.Getenv("GOMAXPROCS") == "":
+		if quota, ok := Quota(); ok {
+			runtime.GOMAXPROCS(procsByQuota(quota, runtime.NumCPU()))
+		}
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// procsByQuota returns the number of procs to use the quota, it rounds the
+// quota down to avoid being throttled, and is at least 1 and at most numCPU.
+func procsByQuota(quota float64, numCPU int) int {
+	procs := int(math.Floor(quota))
+	if procs < 1 {
+		procs = 1
+	}
+	if procs > numCPU {
+		procs = numCPU
+	}
+	return procs
+}
+
+// CurrentStatus returns the current status.
+func CurrentStatus() *Status {
+	s := &Status{
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+	}
+	if quota, ok := Quota(); ok {
+		s.CPUQuota = quota
+	}
+	return s
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maxprocs
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcsByQuota(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(1, procsByQuota(0.5, 8))
+	assert.Equal(2, procsByQuota(2.5, 8))
+	assert.Equal(4, procsByQuota(4, 8))
+	assert.Equal(8, procsByQuota(16, 8))
+}
+
+func TestSet(t *testing.T) {
+	assert := assert.New(t)
+
+	old := runtime.GOMAXPROCS(0)
+	defer runtime.GOMAXPROCS(old)
+
+	assert.Equal(1, Set(1))
+	assert.Equal(1, Set(-1))
+
+	s := CurrentStatus()
+	assert.Equal(runtime.NumCPU(), s.NumCPU)
+	assert.Equal(1, s.GOMAXPROCS)
+}
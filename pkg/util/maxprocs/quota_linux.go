@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maxprocs
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupRoot is the mount point of the cgroup file systems.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// Quota returns the number of CPUs the process is allowed to use by the
+// CPU quota of its cgroup, both cgroup v1 and v2 are supported. It returns
+// false if there is no quota.
+func Quota() (float64, bool) {
+	return quota("/proc/self/cgroup", cgroupRoot)
+}
+
+func quota(cgroupFile, root string) (float64, bool) {
+	f, err := os.Open(cgroupFile)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+
+	// The lines are in the format of hierarchy-ID:controller-list:path,
+	// the controller list of cgroup v2 is empty.
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		controllers, path := fields[1], fields[2]
+		if controllers == "" {
+			if q, ok := quotaV2(filepath.Join(root, path), root); ok {
+				return q, true
+			}
+			continue
+		}
+
+		for _, c := range strings.Split(controllers, ",") {
+			if c != "cpu" {
+				continue
+			}
+			for _, dir := range []string{controllers, "cpu"} {
+				if q, ok := quotaV1(filepath.Join(root, dir, path), filepath.Join(root, dir)); ok {
+					return q, true
+				}
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// quotaV2 reads the quota from cpu.max in dir, or in root if the cgroup
+// of the process is not visible, which is the case in containers without
+// cgroup namespaces.
+func quotaV2(dirs ...string) (float64, bool) {
+	for _, dir := range dirs {
+		data, err := os.ReadFile(filepath.Join(dir, "cpu.max"))
+		if err != nil {
+			continue
+		}
+
+		// The format is "$MAX $PERIOD", and $MAX is "max" if there is
+		// no quota.
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		return divide(fields[0], fields[1])
+	}
+	return 0, false
+}
+
+// quotaV1 reads the quota from cpu.cfs_quota_us and cpu.cfs_period_us in
+// the first existing one of dirs.
+func quotaV1(dirs ...string) (float64, bool) {
+	for _, dir := range dirs {
+		q, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_quota_us"))
+		if err != nil {
+			continue
+		}
+		p, err := os.ReadFile(filepath.Join(dir, "cpu.cfs_period_us"))
+		if err != nil {
+			continue
+		}
+		return divide(strings.TrimSpace(string(q)), strings.TrimSpace(string(p)))
+	}
+	return 0, false
+}
+
+// divide returns quota/period, it returns false if the quota is not
+// positive, for example, -1 means no quota in cgroup v1.
+func divide(quota, period string) (float64, bool) {
+	q, err := strconv.ParseFloat(quota, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(period, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	return q / p, true
+}
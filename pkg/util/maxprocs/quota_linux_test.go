@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maxprocs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuota(t *testing.T) {
+	assert := assert.New(t)
+
+	writeFile := func(path, content string) {
+		assert.NoError(os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	// cgroup v2.
+	root := t.TempDir()
+	cgroupFile := filepath.Join(root, "cgroup")
+	writeFile(cgroupFile, "0::/eg\n")
+	_, ok := quota(cgroupFile, root)
+	assert.False(ok)
+
+	writeFile(filepath.Join(root, "eg", "cpu.max"), "max 100000\n")
+	_, ok = quota(cgroupFile, root)
+	assert.False(ok)
+
+	writeFile(filepath.Join(root, "eg", "cpu.max"), "150000 100000\n")
+	q, ok := quota(cgroupFile, root)
+	assert.True(ok)
+	assert.Equal(1.5, q)
+
+	// cgroup v2 in a container, the cgroup of the process is not visible.
+	root = t.TempDir()
+	cgroupFile = filepath.Join(root, "cgroup")
+	writeFile(cgroupFile, "0::/kubepods/pod1\n")
+	writeFile(filepath.Join(root, "cpu.max"), "200000 100000\n")
+	q, ok = quota(cgroupFile, root)
+	assert.True(ok)
+	assert.Equal(2.0, q)
+
+	// cgroup v1.
+	root = t.TempDir()
+	cgroupFile = filepath.Join(root, "cgroup")
+	writeFile(cgroupFile, "12:memory:/eg\n11:cpu,cpuacct:/eg\n")
+	writeFile(filepath.Join(root, "cpu,cpuacct", "eg", "cpu.cfs_quota_us"), "-1\n")
+	writeFile(filepath.Join(root, "cpu,cpuacct", "eg", "cpu.cfs_period_us"), "100000\n")
+	_, ok = quota(cgroupFile, root)
+	assert.False(ok)
+
+	writeFile(filepath.Join(root, "cpu,cpuacct", "eg", "cpu.cfs_quota_us"), "50000\n")
+	q, ok = quota(cgroupFile, root)
+	assert.True(ok)
+	assert.Equal(0.5, q)
+
+	_, ok = quota(filepath.Join(root, "not-exist"), root)
+	assert.False(ok)
+}
@@ -0,0 +1,276 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package proxyprotocol provides a Listener that recovers the client
+// addresses from the HAProxy PROXY protocol (version 1 and 2) headers.
+package proxyprotocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultReadHeaderTimeout is the default timeout to read the header.
+	DefaultReadHeaderTimeout = 10 * time.Second
+
+	// the max length of a v1 header, including the CRLF.
+	maxV1HeaderLen = 107
+)
+
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+type (
+	// Listener wraps a net.Listener, the connections it accepts must start
+	// with a PROXY protocol header.
+	Listener struct {
+		net.Listener
+		readHeaderTimeout time.Duration
+	}
+
+	// Conn is a connection accepted by Listener. The header is read on the
+	// first call of Read, RemoteAddr or LocalAddr, so that a slow client
+	// does not block the accepting loop.
+	Conn struct {
+		net.Conn
+		br                *bufio.Reader
+		readHeaderTimeout time.Duration
+
+		once    sync.Once
+		err     error
+		srcAddr net.Addr
+		dstAddr net.Addr
+	}
+)
+
+// NewListener creates a Listener, the connections are closed if the header
+// is not received in readHeaderTimeout.
+func NewListener(l net.Listener, readHeaderTimeout time.Duration) *Listener {
+	if readHeaderTimeout <= 0 {
+		readHeaderTimeout = DefaultReadHeaderTimeout
+	}
+	return &Listener{Listener: l, readHeaderTimeout: readHeaderTimeout}
+}
+
+// Accept accepts one connection.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(c, l.readHeaderTimeout), nil
+}
+
+// NewConn wraps c to read the PROXY protocol header.
+func NewConn(c net.Conn, readHeaderTimeout time.Duration) *Conn {
+	return &Conn{
+		Conn:              c,
+		br:                bufio.NewReader(c),
+		readHeaderTimeout: readHeaderTimeout,
+	}
+}
+
+// Read reads data from the connection, after the header.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.br.Read(b)
+}
+
+// RemoteAddr returns the source address in the header, or the address of
+// the peer if the header does not carry addresses.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.srcAddr != nil {
+		return c.srcAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address in the header, or the local
+// address if the header does not carry addresses.
+func (c *Conn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.dstAddr != nil {
+		return c.dstAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// PeerAddr returns the address of the peer, which is generally the load
+// balancer sending the header.
+func (c *Conn) PeerAddr() net.Addr {
+	return c.Conn.RemoteAddr()
+}
+
+func (c *Conn) readHeader() {
+	// NOTE: the deadline is cleared after reading the header, users of the
+	// connection should set their own deadlines after calling RemoteAddr,
+	// which is what the HTTP server does.
+	c.Conn.SetReadDeadline(time.Now().Add(c.readHeaderTimeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	c.srcAddr, c.dstAddr, c.err = readHeader(c.br)
+	if c.err != nil {
+		c.err = fmt.Errorf("proxy protocol: %v", c.err)
+	}
+}
+
+func readHeader(br *bufio.Reader) (src, dst net.Addr, err error) {
+	b, err := br.Peek(1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch b[0] {
+	case 'P':
+		return readV1Header(br)
+	case v2Signature[0]:
+		return readV2Header(br)
+	default:
+		return nil, nil, fmt.Errorf("missing header")
+	}
+}
+
+// readV1Header reads a header like 'PROXY TCP4 1.1.1.1 2.2.2.2 1111 2222\r\n'.
+func readV1Header(br *bufio.Reader) (src, dst net.Addr, err error) {
+	var line []byte
+	for len(line) < maxV1HeaderLen {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, fmt.Errorf("invalid v1 header")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return nil, nil, fmt.Errorf("invalid v1 header")
+	}
+
+	switch fields[1] {
+	case "UNKNOWN":
+		// the rest of the line should be ignored.
+		return nil, nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, nil, fmt.Errorf("invalid v1 protocol %q", fields[1])
+	}
+
+	if len(fields) != 6 {
+		return nil, nil, fmt.Errorf("invalid v1 header")
+	}
+
+	src, err = parseV1Addr(fields[1], fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err = parseV1Addr(fields[1], fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func parseV1Addr(protocol, ip, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil || (protocol == "TCP4") != (addr.To4() != nil) {
+		return nil, fmt.Errorf("invalid v1 address %q", ip)
+	}
+
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid v1 port %q", port)
+	}
+
+	return &net.TCPAddr{IP: addr, Port: int(p)}, nil
+}
+
+func readV2Header(br *bufio.Reader) (src, dst net.Addr, err error) {
+	header := make([]byte, 16)
+	if _, err = io.ReadFull(br, header); err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(header[:12], v2Signature) {
+		return nil, nil, fmt.Errorf("invalid v2 signature")
+	}
+
+	version, command := header[12]>>4, header[12]&0x0f
+	if version != 2 {
+		return nil, nil, fmt.Errorf("invalid v2 version %d", version)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err = io.ReadFull(br, payload); err != nil {
+		return nil, nil, err
+	}
+
+	switch command {
+	case 0x0:
+		// LOCAL: the connection is established by the proxy itself, for
+		// example, health checks.
+		return nil, nil, nil
+	case 0x1:
+		// PROXY
+	default:
+		return nil, nil, fmt.Errorf("invalid v2 command %d", command)
+	}
+
+	family, transport := header[13]>>4, header[13]&0x0f
+	var addrLen int
+	switch family {
+	case 0x1:
+		addrLen = net.IPv4len
+	case 0x2:
+		addrLen = net.IPv6len
+	default:
+		// AF_UNSPEC, AF_UNIX: the addresses are ignored.
+		return nil, nil, nil
+	}
+
+	if len(payload) < 2*addrLen+4 {
+		return nil, nil, fmt.Errorf("invalid v2 address length %d", len(payload))
+	}
+
+	srcIP := net.IP(payload[:addrLen])
+	dstIP := net.IP(payload[addrLen : 2*addrLen])
+	srcPort := int(binary.BigEndian.Uint16(payload[2*addrLen:]))
+	dstPort := int(binary.BigEndian.Uint16(payload[2*addrLen+2:]))
+
+	// the TLVs after the addresses are ignored.
+	if transport == 0x2 {
+		return &net.UDPAddr{IP: srcIP, Port: srcPort}, &net.UDPAddr{IP: dstIP, Port: dstPort}, nil
+	}
+	return &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}, nil
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxyprotocol
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func v2Header(command, family byte, addrs []byte) []byte {
+	b := append([]byte{}, v2Signature...)
+	b = append(b, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(b[14:], uint16(len(addrs)))
+	return append(b, addrs...)
+}
+
+func pipeConn(t *testing.T, data []byte) *Conn {
+	client, server := net.Pipe()
+	go func() {
+		client.Write(data)
+		client.Close()
+	}()
+	t.Cleanup(func() { server.Close() })
+	return NewConn(server, time.Second)
+}
+
+func TestConn(t *testing.T) {
+	assert := assert.New(t)
+
+	ipv4 := []byte{192, 168, 1, 1, 10, 0, 0, 1, 0x1f, 0x90, 0x00, 0x50}
+	ipv6 := make([]byte, 36)
+	ipv6[15], ipv6[31], ipv6[33], ipv6[35] = 1, 2, 1, 2
+
+	cases := []struct {
+		header string
+		src    string
+		dst    string
+		err    bool
+	}{
+		{header: "PROXY TCP4 1.1.1.1 2.2.2.2 1111 2222\r\n", src: "1.1.1.1:1111", dst: "2.2.2.2:2222"},
+		{header: "PROXY TCP6 ::1 ::2 1111 2222\r\n", src: "[::1]:1111", dst: "[::2]:2222"},
+		{header: "PROXY UNKNOWN ffff::1 ffff::2 1111 2222\r\n", src: "pipe", dst: "pipe"},
+		{header: "PROXY TCP4 ::1 2.2.2.2 1111 2222\r\n", err: true},
+		{header: "PROXY TCP4 1.1.1.1 2.2.2.2 1111 72222\r\n", err: true},
+		{header: "PROXY TCP4 1.1.1.1 2.2.2.2 1111\r\n", err: true},
+		{header: "PROXY UDP4 1.1.1.1 2.2.2.2 1111 2222\r\n", err: true},
+		{header: "PROXY TCP4 1.1.1.1 2.2.2.2 1111 2222\n", err: true},
+		{header: "GET / HTTP/1.1\r\n", err: true},
+		{header: string(v2Header(1, 0x11, ipv4)), src: "192.168.1.1:8080", dst: "10.0.0.1:80"},
+		{header: string(v2Header(1, 0x12, ipv4)), src: "192.168.1.1:8080", dst: "10.0.0.1:80"},
+		{header: string(v2Header(1, 0x21, ipv6)), src: "[::1]:1", dst: "[::2]:2"},
+		{header: string(v2Header(1, 0x11, append(ipv4, 0x04, 0x00, 0x01, 0xff))), src: "192.168.1.1:8080", dst: "10.0.0.1:80"},
+		{header: string(v2Header(0, 0x11, ipv4)), src: "pipe", dst: "pipe"},
+		{header: string(v2Header(1, 0x00, nil)), src: "pipe", dst: "pipe"},
+		{header: string(v2Header(1, 0x11, ipv4[:8])), err: true},
+		{header: string(v2Header(2, 0x11, ipv4)), err: true},
+	}
+
+	for _, c := range cases {
+		conn := pipeConn(t, []byte(c.header+"payload"))
+		data, err := io.ReadAll(conn)
+		if c.err {
+			assert.Error(err, c.header)
+			continue
+		}
+		assert.NoError(err, c.header)
+		assert.Equal("payload", string(data), c.header)
+		assert.Equal(c.src, conn.RemoteAddr().String(), c.header)
+		assert.Equal(c.dst, conn.LocalAddr().String(), c.header)
+		assert.Equal("pipe", conn.PeerAddr().String())
+	}
+}
+
+func TestListener(t *testing.T) {
+	assert := assert.New(t)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	l := NewListener(ln, 100*time.Millisecond)
+	defer l.Close()
+
+	go func() {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return
+		}
+		c.Write([]byte("PROXY TCP4 1.1.1.1 2.2.2.2 1111 2222\r\n"))
+		c.Close()
+
+		// no header is sent, the server should time out.
+		c, err = net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return
+		}
+		time.Sleep(time.Second)
+		c.Close()
+	}()
+
+	c, err := l.Accept()
+	assert.NoError(err)
+	assert.Equal("1.1.1.1:1111", c.RemoteAddr().String())
+	c.Close()
+
+	c, err = l.Accept()
+	assert.NoError(err)
+	start := time.Now()
+	_, err = c.Read(make([]byte, 1))
+	assert.Error(err)
+	assert.Less(time.Since(start), 500*time.Millisecond)
+	c.Close()
+}
@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package readers
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopy(t *testing.T) {
+	assert := assert.New(t)
+
+	data := strings.Repeat("0123456789", 10000)
+	// wrap the writer to hide its ReadFrom method, so the buffer is used.
+	src := NewByteCountReader(strings.NewReader(data))
+	dst := &bytes.Buffer{}
+	n, err := Copy(struct{ io.Writer }{dst}, src)
+	assert.Nil(err)
+	assert.Equal(int64(len(data)), n)
+	assert.Equal(data, dst.String())
+}
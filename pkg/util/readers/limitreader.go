@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package readers
+
+import (
+	"io"
+)
+
+// LimitReader wraps an io.Reader and returns an error once more than the
+// limit bytes are read from it, unlike io.LimitReader which returns io.EOF
+// silently, so the truncation of a stream could be detected.
+type LimitReader struct {
+	r         io.Reader
+	remaining int64
+	err       error
+}
+
+// NewLimitReader wraps an io.Reader to LimitReader and returns it, err is
+// returned when more than limit bytes are read.
+func NewLimitReader(r io.Reader, limit int64, err error) *LimitReader {
+	return &LimitReader{r: r, remaining: limit, err: err}
+}
+
+// Read implements io.Reader.
+func (r *LimitReader) Read(p []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, r.err
+	}
+	// read one more byte than the remaining to detect the overflow.
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.r.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n + int(r.remaining), r.err
+	}
+	return n, err
+}
+
+// Close implements io.Closer and closes the underlying io.Reader if
+// it is an io.Closer.
+func (r *LimitReader) Close() error {
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
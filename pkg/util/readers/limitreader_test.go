@@ -0,0 +1,56 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package readers
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitReader(t *testing.T) {
+	assert := assert.New(t)
+	errTooLarge := errors.New("too large")
+
+	lr := NewLimitReader(io.NopCloser(strings.NewReader("123")), 3, errTooLarge)
+	data, err := io.ReadAll(lr)
+	assert.Nil(err)
+	assert.Equal("123", string(data))
+	assert.Nil(lr.Close())
+
+	lr = NewLimitReader(strings.NewReader("12345"), 3, errTooLarge)
+	data, err = io.ReadAll(lr)
+	assert.Equal(errTooLarge, err)
+	assert.Equal("123", string(data))
+	_, err = lr.Read(make([]byte, 10))
+	assert.Equal(errTooLarge, err)
+
+	// read byte by byte.
+	lr = NewLimitReader(strings.NewReader("12345"), 2, errTooLarge)
+	p := make([]byte, 1)
+	for i := 0; i < 2; i++ {
+		n, err := lr.Read(p)
+		assert.Equal(1, n)
+		assert.Nil(err)
+	}
+	n, err := lr.Read(p)
+	assert.Equal(0, n)
+	assert.Equal(errTooLarge, err)
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package signer provides a signer for HTTP requests.
+// Package s3 uploads the objects to S3 and the S3 compatible storages.
+package s3
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/v2/pkg/util/signer"
+)
+
+type (
+	// Options is the options of an Uploader.
+	Options struct {
+		// Endpoint is the endpoint of an S3 compatible storage, the path
+		// style URLs are used. The virtual hosted style URLs of AWS are
+		// used if it is empty.
+		Endpoint        string
+		Region          string
+		Bucket          string
+		AccessKeyID     string
+		SecretAccessKey string
+		// Timeout is the timeout of an upload, zero means no timeout.
+		Timeout time.Duration
+	}
+
+	// Uploader uploads the objects to a bucket, the requests are signed
+	// with AWS Signature Version 4.
+	Uploader struct {
+		opts   Options
+		client *http.Client
+		signer *signer.Signer
+	}
+)
+
+// NewUploader creates an Uploader.
+func NewUploader(opts *Options) *Uploader {
+	s := signer.New()
+	s.SetLiteral(signer.AWSLiteral)
+	s.SetCredential(opts.AccessKeyID, opts.SecretAccessKey)
+	return &Uploader{
+		opts:   *opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		signer: s,
+	}
+}
+
+// ObjectURL returns the URL of the object of the key.
+func (u *Uploader) ObjectURL(key string) string {
+	if u.opts.Endpoint == "" {
+		return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", u.opts.Bucket, u.opts.Region, key)
+	}
+	return fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(u.opts.Endpoint, "/"), u.opts.Bucket, key)
+}
+
+// Upload puts the data as the object of the key.
+func (u *Uploader) Upload(key, contentType string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, u.ObjectURL(key), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	sum := sha256.Sum256(data)
+	// the payload hash is set, so the signer does not read the body.
+	req.Header.Set(signer.AWSLiteral.ContentSHA256, hex.EncodeToString(sum[:]))
+	ctx := u.signer.NewSigningContext(time.Now(), u.opts.Region, "s3")
+	if err = ctx.Sign(req, nil); err != nil {
+		return err
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
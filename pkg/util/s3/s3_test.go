@@ -0,0 +1,74 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package signer provides a signer for HTTP requests.
+package s3
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObjectURL(t *testing.T) {
+	assert := assert.New(t)
+
+	u := NewUploader(&Options{Region: "us-east-1", Bucket: "billing"})
+	assert.Equal("https://billing.s3.us-east-1.amazonaws.com/usage/batch.json", u.ObjectURL("usage/batch.json"))
+
+	u = NewUploader(&Options{Endpoint: "http://127.0.0.1:9000/", Region: "us-east-1", Bucket: "billing"})
+	assert.Equal("http://127.0.0.1:9000/billing/batch.json", u.ObjectURL("batch.json"))
+}
+
+func TestUpload(t *testing.T) {
+	assert := assert.New(t)
+
+	var req *http.Request
+	var body string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	u := NewUploader(&Options{
+		Endpoint:        srv.URL,
+		Region:          "us-east-1",
+		Bucket:          "logs",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+	})
+	assert.NoError(u.Upload("a/b.jsonl", "application/json", []byte("[]")))
+	assert.Equal(http.MethodPut, req.Method)
+	assert.Equal("/logs/a/b.jsonl", req.URL.Path)
+	assert.Equal("application/json", req.Header.Get("Content-Type"))
+	assert.Equal("[]", body)
+	assert.Equal("4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945", req.Header.Get("X-Amz-Content-Sha256"))
+	auth := req.Header.Get("Authorization")
+	assert.True(strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/"), auth)
+	assert.Contains(auth, "/us-east-1/s3/aws4_request")
+
+	status = http.StatusForbidden
+	assert.Error(u.Upload("a/b.jsonl", "application/json", []byte("[]")))
+}
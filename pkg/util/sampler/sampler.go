@@ -63,7 +63,8 @@ func NewDurationSampler() *DurationSampler {
 }
 
 // Update updates the sample. This function could be called concurrently,
-// but should not be called concurrently with Percentiles.
+// even with Percentiles and Reset, in which case the sample may or may not
+// be counted.
 func (ds *DurationSampler) Update(d time.Duration) {
 	idx := 0
 	for _, s := range segments {
@@ -86,9 +87,9 @@ func (ds *DurationSampler) Update(d time.Duration) {
 // Reset reset the DurationSampler to initial state
 func (ds *DurationSampler) Reset() {
 	for i := 0; i < len(ds.durations); i++ {
-		ds.durations[i] = 0
+		atomic.StoreUint32(&ds.durations[i], 0)
 	}
-	ds.count = 0
+	atomic.StoreUint64(&ds.count, 0)
 }
 
 // Percentiles returns 7 metrics by order:
@@ -100,7 +101,7 @@ func (ds *DurationSampler) Percentiles() []float64 {
 
 	// total is the total number of samples, count is the number of samples
 	// we have seen so far.
-	count, total := uint64(0), float64(ds.count)
+	count, total := uint64(0), float64(atomic.LoadUint64(&ds.count))
 
 	// no samples, the result is all 0
 	if total == 0 {
@@ -112,7 +113,7 @@ func (ds *DurationSampler) Percentiles() []float64 {
 	base := time.Duration(0)
 	for _, s := range segments {
 		for i := 0; i < s.slots; i++ {
-			count += uint64(ds.durations[di])
+			count += uint64(atomic.LoadUint32(&ds.durations[di]))
 			di++
 			// calculate the percentile of samples we have seen against
 			// total samples
@@ -53,3 +53,61 @@ func TestSampler(t *testing.T) {
 	assert.Equal(t, 0.0, p[1])
 	assert.Equal(t, 0.0, p[2])
 }
+
+func TestSketch(t *testing.T) {
+	assert := assert.New(t)
+
+	s := NewSketch()
+	assert.Nil(s.Flush())
+
+	s.Add(0.5)
+	for i := 1; i <= 1000; i++ {
+		s.Add(float64(i))
+	}
+	s.Add(1 << 50)
+
+	d := s.Flush()
+	assert.Equal(uint64(1002), d.Count)
+	assert.Equal(uint64(1), d.Zero)
+	assert.Nil(s.Flush())
+
+	assert.Equal(0.0, d.Quantile(0))
+	for _, q := range []float64{0.25, 0.5, 0.75, 0.99} {
+		expected := q * 1001
+		assert.InEpsilon(expected, d.Quantile(q), sketchAccuracy+0.001, "q=%v", q)
+	}
+	assert.InEpsilon(float64(sketchMaxValue), d.Quantile(1), sketchAccuracy)
+
+	assert.Equal(0.0, (*SketchData)(nil).Quantile(0.5))
+}
+
+func TestSketchMerge(t *testing.T) {
+	assert := assert.New(t)
+
+	// the values of two members, a member serves the fast requests and
+	// the other serves the slow ones.
+	s1, s2, all := NewSketch(), NewSketch(), NewSketch()
+	for i := 1; i <= 900; i++ {
+		s1.Add(float64(i))
+		all.Add(float64(i))
+	}
+	for i := 1; i <= 100; i++ {
+		s2.Add(float64(i * 100))
+		all.Add(float64(i * 100))
+	}
+
+	d1, d2, expected := s1.Flush(), s2.Flush(), all.Flush()
+
+	merged := &SketchData{}
+	merged.Merge(nil)
+	merged.Merge(d1)
+	merged.Merge(d2)
+	assert.Equal(expected, merged)
+
+	// merge in the other order, which extends the bins at the beginning.
+	merged = &SketchData{}
+	merged.Merge(d2)
+	merged.Merge(d1)
+	assert.Equal(expected, merged)
+	assert.InEpsilon(5000.0, merged.Quantile(0.95), sketchAccuracy)
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sampler
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+const (
+	// sketchAccuracy is the max relative error of the quantiles of a
+	// sketch.
+	sketchAccuracy = 0.02
+	// sketchMaxValue is the max value a sketch holds precisely, larger
+	// values are counted as it.
+	sketchMaxValue = 1 << 40
+)
+
+var (
+	sketchGamma    = (1 + sketchAccuracy) / (1 - sketchAccuracy)
+	sketchLogGamma = math.Log(sketchGamma)
+	sketchBins     = sketchIndex(sketchMaxValue) + 1
+)
+
+type (
+	// Sketch is a histogram whose buckets grow exponentially, so the
+	// quantiles computed from it have a relative error less than 2%
+	// whatever the range of the values is.
+	//
+	// Unlike percentiles, the sketches of different instances, like the
+	// members of a cluster, are merged without loss of accuracy, so the
+	// quantiles of all the values of the instances are computed correctly.
+	Sketch struct {
+		zero uint64   // number of the values less than 1
+		bins []uint64 // bins[i] is the number of the values in (gamma^(i-1), gamma^i]
+	}
+
+	// SketchData is the serializable snapshot of a Sketch.
+	SketchData struct {
+		Count uint64 `json:"count"`
+		Zero  uint64 `json:"zero,omitempty"`
+		// Offset is the bin index of the first element of Bins, the bins
+		// before the first and after the last non-empty bins are
+		// omitted.
+		Offset int      `json:"offset"`
+		Bins   []uint64 `json:"bins,omitempty"`
+	}
+)
+
+func sketchIndex(v float64) int {
+	return int(math.Ceil(math.Log(v) / sketchLogGamma))
+}
+
+// sketchValue returns the value representing the bin of index i, whose
+// relative error to any value of the bin is less than sketchAccuracy.
+func sketchValue(i int) float64 {
+	return 2 * math.Pow(sketchGamma, float64(i)) / (sketchGamma + 1)
+}
+
+// NewSketch creates a Sketch.
+func NewSketch() *Sketch {
+	return &Sketch{bins: make([]uint64, sketchBins)}
+}
+
+// Add adds a value to the sketch, it could be called concurrently.
+func (s *Sketch) Add(v float64) {
+	if v < 1 {
+		atomic.AddUint64(&s.zero, 1)
+		return
+	}
+	if v > sketchMaxValue {
+		v = sketchMaxValue
+	}
+	atomic.AddUint64(&s.bins[sketchIndex(v)], 1)
+}
+
+// Flush returns the data of the sketch and resets it, every value added
+// concurrently is either in the data or kept in the sketch. It returns nil
+// if the sketch is empty.
+func (s *Sketch) Flush() *SketchData {
+	data := &SketchData{Zero: atomic.SwapUint64(&s.zero, 0)}
+	data.Count = data.Zero
+
+	first, last := -1, -1
+	for i := range s.bins {
+		if atomic.LoadUint64(&s.bins[i]) == 0 {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		last = i
+	}
+	if first < 0 {
+		if data.Count == 0 {
+			return nil
+		}
+		return data
+	}
+
+	data.Offset = first
+	data.Bins = make([]uint64, last-first+1)
+	for i := range data.Bins {
+		n := atomic.SwapUint64(&s.bins[first+i], 0)
+		data.Bins[i] = n
+		data.Count += n
+	}
+	return data
+}
+
+// Merge merges other into d.
+func (d *SketchData) Merge(other *SketchData) {
+	if other == nil || other.Count == 0 {
+		return
+	}
+
+	d.Count += other.Count
+	d.Zero += other.Zero
+	if len(other.Bins) == 0 {
+		return
+	}
+	if len(d.Bins) == 0 {
+		d.Offset = other.Offset
+		d.Bins = append([]uint64(nil), other.Bins...)
+		return
+	}
+
+	first, last := d.Offset, d.Offset+len(d.Bins)-1
+	if other.Offset < first {
+		first = other.Offset
+	}
+	if l := other.Offset + len(other.Bins) - 1; l > last {
+		last = l
+	}
+	if first != d.Offset || last != d.Offset+len(d.Bins)-1 {
+		bins := make([]uint64, last-first+1)
+		copy(bins[d.Offset-first:], d.Bins)
+		d.Offset, d.Bins = first, bins
+	}
+	for i, n := range other.Bins {
+		d.Bins[other.Offset-d.Offset+i] += n
+	}
+}
+
+// Quantile returns the q-quantile of the values, q is in [0, 1]. It
+// returns 0 if there are no values.
+func (d *SketchData) Quantile(q float64) float64 {
+	if d == nil || d.Count == 0 {
+		return 0
+	}
+
+	rank := uint64(q * float64(d.Count-1))
+	if rank < d.Zero {
+		return 0
+	}
+	count := d.Zero
+	for i, n := range d.Bins {
+		count += n
+		if count > rank {
+			return sketchValue(d.Offset + i)
+		}
+	}
+	return sketchValue(d.Offset + len(d.Bins) - 1)
+}
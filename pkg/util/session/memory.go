@@ -0,0 +1,140 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type memoryStore struct {
+	mutex    sync.Mutex
+	sessions map[string]*Session
+	subjects map[string]map[string]struct{}
+	done     chan struct{}
+}
+
+func newMemoryStore() *memoryStore {
+	ms := &memoryStore{
+		sessions: map[string]*Session{},
+		subjects: map[string]map[string]struct{}{},
+		done:     make(chan struct{}),
+	}
+	go ms.run()
+	return ms
+}
+
+func (ms *memoryStore) run() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ms.done:
+			return
+		case now := <-ticker.C:
+			ms.sweep(now)
+		}
+	}
+}
+
+// sweep removes the expired sessions.
+func (ms *memoryStore) sweep(now time.Time) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	for key, s := range ms.sessions {
+		if !now.Before(s.ExpiresAt) {
+			ms.remove(key)
+		}
+	}
+}
+
+// get returns a copy of the session, so that the callers could modify it
+// without the lock.
+func (ms *memoryStore) get(key string) (*Session, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	s := ms.sessions[key]
+	if s == nil {
+		return nil, nil
+	}
+	cp := *s
+	return &cp, nil
+}
+
+func (ms *memoryStore) save(key string, s *Session) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	cp := *s
+	cp.ID = ""
+	ms.sessions[key] = &cp
+	if s.Subject != "" {
+		keys := ms.subjects[s.Subject]
+		if keys == nil {
+			keys = map[string]struct{}{}
+			ms.subjects[s.Subject] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	return nil
+}
+
+// remove removes the session of the key, the caller must hold the lock.
+func (ms *memoryStore) remove(key string) bool {
+	s := ms.sessions[key]
+	if s == nil {
+		return false
+	}
+	delete(ms.sessions, key)
+	if keys := ms.subjects[s.Subject]; keys != nil {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(ms.subjects, s.Subject)
+		}
+	}
+	return true
+}
+
+func (ms *memoryStore) del(key string) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.remove(key)
+	return nil
+}
+
+func (ms *memoryStore) delSubject(subject string) (int, error) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	count := 0
+	for key := range ms.subjects[subject] {
+		if ms.remove(key) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (ms *memoryStore) close() {
+	close(ms.done)
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/megaease/easegress/v2/pkg/util/codectool"
+)
+
+const defaultKeyPrefix = "easegress:session:"
+
+type redisStore struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+func newRedisStore(spec *RedisSpec, ttl time.Duration) *redisStore {
+	prefix := spec.KeyPrefix
+	if prefix == "" {
+		prefix = defaultKeyPrefix
+	}
+	return &redisStore{
+		client: redis.NewClient(&redis.Options{
+			Addr:     spec.Addr,
+			Username: spec.Username,
+			Password: spec.Password,
+			DB:       spec.DB,
+		}),
+		prefix: prefix,
+		ttl:    ttl,
+	}
+}
+
+func (rs *redisStore) sessionKey(key string) string {
+	return rs.prefix + "s:" + key
+}
+
+// subjectKey is the key of the set of the session keys of the subject.
+func (rs *redisStore) subjectKey(subject string) string {
+	return rs.prefix + "u:" + subject
+}
+
+func (rs *redisStore) get(key string) (*Session, error) {
+	data, err := rs.client.Get(context.Background(), rs.sessionKey(key)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{}
+	if err = codectool.UnmarshalJSON(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (rs *redisStore) save(key string, s *Session) error {
+	ttl := time.Until(s.ExpiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	data, err := codectool.MarshalJSON(s)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	_, err = rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, rs.sessionKey(key), data, ttl)
+		if s.Subject != "" {
+			// no session saved so far lives longer than the TTL, the
+			// keys of the expired sessions in the set are harmless.
+			subjectKey := rs.subjectKey(s.Subject)
+			pipe.SAdd(ctx, subjectKey, key)
+			pipe.Expire(ctx, subjectKey, rs.ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+func (rs *redisStore) del(key string) error {
+	return rs.client.Del(context.Background(), rs.sessionKey(key)).Err()
+}
+
+func (rs *redisStore) delSubject(subject string) (int, error) {
+	ctx := context.Background()
+	subjectKey := rs.subjectKey(subject)
+	keys, err := rs.client.SMembers(ctx, subjectKey).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	sessionKeys := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		sessionKeys = append(sessionKeys, rs.sessionKey(key))
+	}
+	count := 0
+	if len(sessionKeys) > 0 {
+		n, err := rs.client.Del(ctx, sessionKeys...).Result()
+		if err != nil {
+			return 0, err
+		}
+		count = int(n)
+	}
+	return count, rs.client.Del(ctx, subjectKey).Err()
+}
+
+func (rs *redisStore) close() {
+	rs.client.Close()
+}
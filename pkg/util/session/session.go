@@ -0,0 +1,272 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package session provides the sessions managed by the gateway, the session
+// IDs are kept in the cookies, and the sessions are kept in the server side
+// stores, so that they could be invalidated.
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultCookieName = "EG_SESSION"
+	defaultTTL        = 30 * time.Minute
+)
+
+type (
+	// Spec is the spec of a session Manager.
+	Spec struct {
+		CookieName   string `json:"cookieName,omitempty"`
+		CookieDomain string `json:"cookieDomain,omitempty"`
+		CookieSecure bool   `json:"cookieSecure,omitempty"`
+		// TTL is the idle timeout of the sessions, default is 30m. A
+		// session is renewed when it is used after half of its TTL.
+		TTL string `json:"ttl,omitempty" jsonschema:"format=duration"`
+		// MaxLifetime is the maximum lifetime of the sessions no matter
+		// how they are renewed, the lifetime is unlimited if it is empty.
+		MaxLifetime string `json:"maxLifetime,omitempty" jsonschema:"format=duration"`
+		// Redis stores the sessions in Redis instead of in memory, so
+		// that they are shared by all Easegress instances.
+		Redis *RedisSpec `json:"redis,omitempty"`
+	}
+
+	// RedisSpec is the spec of the Redis backend.
+	RedisSpec struct {
+		Addr     string `json:"addr" jsonschema:"required"`
+		Username string `json:"username,omitempty"`
+		Password string `json:"password,omitempty"`
+		DB       int    `json:"db,omitempty"`
+		// KeyPrefix is the prefix of the Redis keys, default is
+		// "easegress:session:".
+		KeyPrefix string `json:"keyPrefix,omitempty"`
+	}
+
+	// Session is a session of a user.
+	Session struct {
+		// ID is the session ID kept in the cookie, it is not persisted,
+		// the sessions are stored by the hashes of the IDs.
+		ID        string            `json:"-"`
+		Subject   string            `json:"subject,omitempty"`
+		Values    map[string]string `json:"values,omitempty"`
+		CreatedAt time.Time         `json:"createdAt"`
+		ExpiresAt time.Time         `json:"expiresAt"`
+	}
+
+	// Manager manages the sessions.
+	Manager struct {
+		spec        *Spec
+		ttl         time.Duration
+		maxLifetime time.Duration
+		store       store
+		refs        int32
+	}
+
+	// store stores the sessions by the hashes of the session IDs.
+	store interface {
+		get(key string) (*Session, error)
+		save(key string, s *Session) error
+		del(key string) error
+		delSubject(subject string) (int, error)
+		close()
+	}
+)
+
+// Validate validates the spec of Manager.
+func (spec *Spec) Validate() error {
+	if spec.TTL != "" {
+		if d, err := time.ParseDuration(spec.TTL); err != nil || d <= 0 {
+			return fmt.Errorf("invalid ttl %s", spec.TTL)
+		}
+	}
+	if spec.MaxLifetime != "" {
+		if d, err := time.ParseDuration(spec.MaxLifetime); err != nil || d <= 0 {
+			return fmt.Errorf("invalid maxLifetime %s", spec.MaxLifetime)
+		}
+	}
+	return nil
+}
+
+// NewManager creates a session Manager, the spec must be valid.
+func NewManager(spec *Spec) *Manager {
+	m := &Manager{spec: spec, ttl: defaultTTL, refs: 1}
+	if spec.TTL != "" {
+		m.ttl, _ = time.ParseDuration(spec.TTL)
+	}
+	if spec.MaxLifetime != "" {
+		m.maxLifetime, _ = time.ParseDuration(spec.MaxLifetime)
+	}
+
+	if spec.Redis != nil {
+		m.store = newRedisStore(spec.Redis, m.ttl)
+	} else {
+		m.store = newMemoryStore()
+	}
+	return m
+}
+
+// Inherit returns prev if it is created by the same spec, so that the
+// sessions survive the reloads of the filters, otherwise it creates a new
+// Manager. A Manager is closed after all its users close it.
+func Inherit(spec *Spec, prev *Manager) *Manager {
+	if prev != nil && reflect.DeepEqual(spec, prev.spec) {
+		atomic.AddInt32(&prev.refs, 1)
+		return prev
+	}
+	return NewManager(spec)
+}
+
+// hashID hashes the session ID, so that the sessions could not be hijacked
+// with the keys of the store.
+func hashID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+func newID() string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// expiresAt returns the expiration time of the session if it is renewed
+// at now.
+func (m *Manager) expiresAt(s *Session, now time.Time) time.Time {
+	expiresAt := now.Add(m.ttl)
+	if m.maxLifetime > 0 {
+		if deadline := s.CreatedAt.Add(m.maxLifetime); deadline.Before(expiresAt) {
+			expiresAt = deadline
+		}
+	}
+	return expiresAt
+}
+
+// Create creates and saves a session of the subject.
+func (m *Manager) Create(subject string, values map[string]string) (*Session, error) {
+	now := time.Now()
+	s := &Session{
+		ID:        newID(),
+		Subject:   subject,
+		Values:    values,
+		CreatedAt: now,
+	}
+	s.ExpiresAt = m.expiresAt(s, now)
+
+	if err := m.store.save(hashID(s.ID), s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get returns the session of the request, it is nil if the request has no
+// valid session. The session is renewed if it is used after half of its
+// TTL.
+func (m *Manager) Get(req *http.Request) *Session {
+	cookie, err := req.Cookie(m.CookieName())
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+
+	key := hashID(cookie.Value)
+	s, err := m.store.get(key)
+	if err != nil || s == nil {
+		return nil
+	}
+
+	now := time.Now()
+	if !now.Before(s.ExpiresAt) {
+		m.store.del(key)
+		return nil
+	}
+	s.ID = cookie.Value
+
+	if s.ExpiresAt.Sub(now) < m.ttl/2 {
+		if expiresAt := m.expiresAt(s, now); expiresAt.After(s.ExpiresAt) {
+			s.ExpiresAt = expiresAt
+			// the session is still valid if it fails to be renewed.
+			m.store.save(key, s)
+		}
+	}
+	return s
+}
+
+// Save saves the session, like after its values are changed.
+func (m *Manager) Save(s *Session) error {
+	return m.store.save(hashID(s.ID), s)
+}
+
+// Delete deletes the session of the ID.
+func (m *Manager) Delete(id string) error {
+	return m.store.del(hashID(id))
+}
+
+// DeleteSubject deletes all sessions of the subject, and returns the number
+// of the deleted sessions.
+func (m *Manager) DeleteSubject(subject string) (int, error) {
+	return m.store.delSubject(subject)
+}
+
+// CookieName returns the name of the session cookie.
+func (m *Manager) CookieName() string {
+	if m.spec.CookieName != "" {
+		return m.spec.CookieName
+	}
+	return defaultCookieName
+}
+
+// Cookie returns the cookie carrying the session ID. It is a browser
+// session cookie, the expiration is controlled by the server side.
+func (m *Manager) Cookie(s *Session) *http.Cookie {
+	return &http.Cookie{
+		Name:     m.CookieName(),
+		Value:    s.ID,
+		Path:     "/",
+		Domain:   m.spec.CookieDomain,
+		Secure:   m.spec.CookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// ExpiredCookie returns the cookie to remove the session cookie from the
+// browser.
+func (m *Manager) ExpiredCookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     m.CookieName(),
+		Path:     "/",
+		Domain:   m.spec.CookieDomain,
+		Secure:   m.spec.CookieSecure,
+		HttpOnly: true,
+		MaxAge:   -1,
+	}
+}
+
+// Close closes the Manager if it is not used by others.
+func (m *Manager) Close() {
+	if atomic.AddInt32(&m.refs, -1) == 0 {
+		m.store.close()
+	}
+}
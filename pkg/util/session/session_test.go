@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package session
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRequest(cookie *http.Cookie) *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/", nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError((&Spec{}).Validate())
+	assert.NoError((&Spec{TTL: "10m", MaxLifetime: "8h"}).Validate())
+	assert.Error((&Spec{TTL: "0s"}).Validate())
+	assert.Error((&Spec{MaxLifetime: "x"}).Validate())
+}
+
+func TestManager(t *testing.T) {
+	assert := assert.New(t)
+
+	m := NewManager(&Spec{CookieName: "sid", CookieSecure: true})
+	defer m.Close()
+
+	s, err := m.Create("alice", map[string]string{"email": "alice@example.com"})
+	assert.NoError(err)
+	assert.NotEmpty(s.ID)
+
+	cookie := m.Cookie(s)
+	assert.Equal("sid", cookie.Name)
+	assert.Equal(s.ID, cookie.Value)
+	assert.True(cookie.Secure)
+	assert.True(cookie.HttpOnly)
+
+	got := m.Get(newRequest(cookie))
+	assert.NotNil(got)
+	assert.Equal(s.ID, got.ID)
+	assert.Equal("alice", got.Subject)
+	assert.Equal("alice@example.com", got.Values["email"])
+
+	// the session IDs are not stored.
+	_, ok := m.store.(*memoryStore).sessions[s.ID]
+	assert.False(ok)
+
+	assert.Nil(m.Get(newRequest(nil)))
+	assert.Nil(m.Get(newRequest(&http.Cookie{Name: "sid", Value: "unknown"})))
+
+	got.Values["role"] = "admin"
+	assert.NoError(m.Save(got))
+	assert.Equal("admin", m.Get(newRequest(cookie)).Values["role"])
+
+	assert.NoError(m.Delete(s.ID))
+	assert.Nil(m.Get(newRequest(cookie)))
+
+	expired := m.ExpiredCookie()
+	assert.Equal("sid", expired.Name)
+	assert.Equal(-1, expired.MaxAge)
+}
+
+func TestRenewal(t *testing.T) {
+	assert := assert.New(t)
+
+	m := NewManager(&Spec{TTL: "100ms", MaxLifetime: "250ms"})
+	defer m.Close()
+
+	s, _ := m.Create("alice", nil)
+	cookie := m.Cookie(s)
+
+	// not renewed in the first half of the TTL.
+	time.Sleep(20 * time.Millisecond)
+	got := m.Get(newRequest(cookie))
+	assert.Equal(s.ExpiresAt, got.ExpiresAt)
+
+	// renewed in the second half of the TTL.
+	time.Sleep(60 * time.Millisecond)
+	got = m.Get(newRequest(cookie))
+	assert.True(got.ExpiresAt.After(s.ExpiresAt))
+
+	// the session expires without being used.
+	time.Sleep(120 * time.Millisecond)
+	assert.Nil(m.Get(newRequest(cookie)))
+
+	// the session expires at the max lifetime even if it is renewed.
+	s, _ = m.Create("alice", nil)
+	cookie = m.Cookie(s)
+	for i := 0; i < 5; i++ {
+		time.Sleep(60 * time.Millisecond)
+		got = m.Get(newRequest(cookie))
+		if i < 3 {
+			assert.NotNil(got)
+		}
+	}
+	assert.Nil(got)
+}
+
+func TestDeleteSubject(t *testing.T) {
+	assert := assert.New(t)
+
+	m := NewManager(&Spec{})
+	defer m.Close()
+
+	s1, _ := m.Create("alice", nil)
+	s2, _ := m.Create("alice", nil)
+	s3, _ := m.Create("bob", nil)
+
+	n, err := m.DeleteSubject("alice")
+	assert.NoError(err)
+	assert.Equal(2, n)
+	assert.Nil(m.Get(newRequest(m.Cookie(s1))))
+	assert.Nil(m.Get(newRequest(m.Cookie(s2))))
+	assert.NotNil(m.Get(newRequest(m.Cookie(s3))))
+
+	n, _ = m.DeleteSubject("alice")
+	assert.Equal(0, n)
+}
+
+func TestInherit(t *testing.T) {
+	assert := assert.New(t)
+
+	m1 := NewManager(&Spec{TTL: "1m"})
+	s, _ := m1.Create("alice", nil)
+
+	// the sessions survive with the same spec.
+	m2 := Inherit(&Spec{TTL: "1m"}, m1)
+	assert.Same(m1, m2)
+	m1.Close()
+	assert.NotNil(m2.Get(newRequest(m2.Cookie(s))))
+
+	m3 := Inherit(&Spec{TTL: "2m"}, m2)
+	assert.NotSame(m2, m3)
+	assert.Nil(m3.Get(newRequest(m3.Cookie(s))))
+	m2.Close()
+	m3.Close()
+
+	m4 := Inherit(&Spec{}, nil)
+	assert.NotNil(m4)
+	m4.Close()
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	assert := assert.New(t)
+
+	ms := newMemoryStore()
+	defer ms.close()
+
+	now := time.Now()
+	ms.save("a", &Session{Subject: "alice", ExpiresAt: now.Add(-time.Second)})
+	ms.save("b", &Session{Subject: "alice", ExpiresAt: now.Add(time.Minute)})
+	ms.sweep(now)
+
+	assert.Len(ms.sessions, 1)
+	assert.Len(ms.subjects["alice"], 1)
+}
@@ -267,6 +267,21 @@ var defaultLiteral = &Literal{
 	SigningKeyPrefix: "",
 }
 
+// AWSLiteral is the literal of AWS Signature Version 4, it signs the
+// requests to AWS and the S3 compatible storages.
+var AWSLiteral = &Literal{
+	ScopeSuffix:      "aws4_request",
+	AlgorithmName:    "X-Amz-Algorithm",
+	AlgorithmValue:   "AWS4-HMAC-SHA256",
+	SignedHeaders:    "X-Amz-SignedHeaders",
+	Signature:        "X-Amz-Signature",
+	Date:             "X-Amz-Date",
+	Expires:          "X-Amz-Expires",
+	Credential:       "X-Amz-Credential",
+	ContentSHA256:    "X-Amz-Content-Sha256",
+	SigningKeyPrefix: "AWS4",
+}
+
 // New creates a new signer
 func New() *Signer {
 	signer := &Signer{
@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package systemd implements the socket activation and the service
+// notification protocols of systemd.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// StateReady tells systemd the service is ready.
+	StateReady = "READY=1"
+	// StateStopping tells systemd the service is stopping.
+	StateStopping = "STOPPING=1"
+	// StateWatchdog keeps the watchdog of systemd alive.
+	StateWatchdog = "WATCHDOG=1"
+)
+
+// StateMainPID returns the state to tell systemd the main process of the
+// service, which is used after a graceful upgrade.
+func StateMainPID(pid int) string {
+	return fmt.Sprintf("MAINPID=%d", pid)
+}
+
+// IsSocketActivated returns whether the listeners are passed to the process
+// by systemd. The listeners passed by a graceful upgrade also come with
+// LISTEN_FDS, but LISTEN_PID is not the pid of the process in that case.
+func IsSocketActivated() bool {
+	if os.Getenv("LISTEN_FDS") == "" {
+		return false
+	}
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	return err == nil && pid == os.Getpid()
+}
+
+// Notify sends the state to systemd, it returns false without error if the
+// process is not started by systemd with a notification socket.
+func Notify(state string) (bool, error) {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return false, nil
+	}
+	// abstract socket.
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the interval to keep the watchdog alive, which is
+// half of the timeout set by systemd. It returns false if the watchdog is
+// not enabled for the process.
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if s := os.Getenv("WATCHDOG_PID"); s != "" {
+		pid, err := strconv.Atoi(s)
+		if err != nil || pid != os.Getpid() {
+			return 0, false
+		}
+	}
+	return time.Duration(usec) * time.Microsecond / 2, true
+}
+
+// TakeOverWatchdog makes the process the owner of the watchdog. It is
+// called by the child process of a graceful upgrade after it tells systemd
+// it is the main process by MAINPID, because WATCHDOG_PID inherited from
+// the parent is the pid of the parent.
+func TakeOverWatchdog() {
+	if os.Getenv("WATCHDOG_PID") != "" {
+		os.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	}
+}
+
+// RunWatchdog keeps the watchdog of systemd alive until done is closed, it
+// returns at once if the watchdog is not enabled.
+func RunWatchdog(done <-chan struct{}) {
+	interval, ok := WatchdogInterval()
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			Notify(StateWatchdog)
+		case <-done:
+			return
+		}
+	}
+}
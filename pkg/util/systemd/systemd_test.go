@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2017, The Easegress Authors
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSocketActivated(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Setenv("LISTEN_FDS", "")
+	t.Setenv("LISTEN_PID", "")
+	assert.False(IsSocketActivated())
+
+	t.Setenv("LISTEN_FDS", "2")
+	assert.False(IsSocketActivated())
+
+	t.Setenv("LISTEN_PID", "1")
+	assert.False(IsSocketActivated())
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	assert.True(IsSocketActivated())
+}
+
+func TestNotify(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Setenv("NOTIFY_SOCKET", "")
+	sent, err := Notify(StateReady)
+	assert.False(sent)
+	assert.NoError(err)
+
+	addr := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram is not supported: %v", err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", addr)
+	sent, err = Notify(StateReady + "\n" + StateMainPID(100))
+	assert.True(sent)
+	assert.NoError(err)
+
+	buff := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buff)
+	assert.NoError(err)
+	assert.Equal("READY=1\nMAINPID=100", string(buff[:n]))
+
+	t.Setenv("NOTIFY_SOCKET", addr+".missing")
+	sent, err = Notify(StateReady)
+	assert.False(sent)
+	assert.Error(err)
+}
+
+func TestWatchdog(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Setenv("WATCHDOG_USEC", "")
+	t.Setenv("WATCHDOG_PID", "")
+	_, ok := WatchdogInterval()
+	assert.False(ok)
+
+	t.Setenv("WATCHDOG_USEC", "20000")
+	interval, ok := WatchdogInterval()
+	assert.True(ok)
+	assert.Equal(10*time.Millisecond, interval)
+
+	t.Setenv("WATCHDOG_PID", "1")
+	_, ok = WatchdogInterval()
+	assert.False(ok)
+
+	// the child process of a graceful upgrade takes over the watchdog.
+	TakeOverWatchdog()
+	_, ok = WatchdogInterval()
+	assert.True(ok)
+
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(os.Getpid()))
+	addr := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram is not supported: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", addr)
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		RunWatchdog(done)
+		close(finished)
+	}()
+
+	buff := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buff)
+	assert.NoError(err)
+	assert.Equal(StateWatchdog, string(buff[:n]))
+
+	close(done)
+	<-finished
+}